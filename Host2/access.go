@@ -0,0 +1,160 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// AuditEntry is one line of the request audit log.
+type AuditEntry struct {
+	Time      string  `json:"time"`
+	Client    string  `json:"client"`
+	Method    string  `json:"method"`
+	Path      string  `json:"path"`
+	Status    int     `json:"status"`
+	LatencyMs float64 `json:"latency_ms"`
+	UserAgent string  `json:"user_agent,omitempty"`
+	Token     bool    `json:"token"`         // whether an API token was presented
+	Key       string  `json:"key,omitempty"` // name of the api.keys entry it matched
+}
+
+var (
+	auditMu   sync.Mutex
+	auditPath string
+	auditFile *os.File
+)
+
+// statusRecorder captures the response code for the audit log.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// parseIPNets accepts CIDRs and bare addresses.
+func parseIPNets(entries []string) ([]*net.IPNet, error) {
+	var nets []*net.IPNet
+	for _, entry := range entries {
+		if ip := net.ParseIP(entry); ip != nil {
+			bits := 128
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 32
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, ipNet, err := net.ParseCIDR(entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid address or CIDR %q", entry)
+		}
+		nets = append(nets, ipNet)
+	}
+	return nets, nil
+}
+
+func containsIP(nets []*net.IPNet, ip net.IP) bool {
+	for _, n := range nets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// clientAllowed applies the deny list first, then the allow list. An empty
+// allow list admits every client that is not denied.
+func clientAllowed(cfg APIConfig, ip net.IP) bool {
+	if ip == nil {
+		return len(cfg.allowNets) == 0 && len(cfg.denyNets) == 0
+	}
+	if containsIP(cfg.denyNets, ip) {
+		return false
+	}
+	return len(cfg.allowNets) == 0 || containsIP(cfg.allowNets, ip)
+}
+
+func remoteIP(r *http.Request) net.IP {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return net.ParseIP(host)
+}
+
+// writeAudit appends an entry to api.audit_log, or to the agent log when no
+// file is configured.
+func writeAudit(path string, entry AuditEntry) {
+	if path == "" {
+		log.Printf("[AUDIT] %s %s %s -> %d (%.1fms)", entry.Client, entry.Method, entry.Path, entry.Status, entry.LatencyMs)
+		return
+	}
+
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return
+	}
+
+	auditMu.Lock()
+	defer auditMu.Unlock()
+	if auditFile == nil || auditPath != path {
+		if auditFile != nil {
+			auditFile.Close()
+			auditFile = nil
+		}
+		file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+		if err != nil {
+			log.Printf("[AUDIT] Cannot open %s: %v", path, err)
+			return
+		}
+		auditFile, auditPath = file, path
+	}
+	if _, err := auditFile.Write(append(data, '\n')); err != nil {
+		log.Printf("[AUDIT] Write to %s failed: %v", path, err)
+	}
+}
+
+// accessMiddleware enforces the client IP lists and rate limit, and
+// records each request in the audit log when api.audit is enabled.
+func accessMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cfg := currentConfig().API
+		start := time.Now()
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+
+		switch {
+		case !clientAllowed(cfg, remoteIP(r)):
+			http.Error(recorder, "Forbidden", http.StatusForbidden)
+		case rateLimited(recorder, r, cfg.RateLimit):
+		default:
+			next.ServeHTTP(recorder, r)
+		}
+
+		if cfg.Audit {
+			keyName := ""
+			if key := matchAPIKey(cfg, r); key != nil {
+				keyName = key.Name
+			}
+			writeAudit(cfg.AuditLog, AuditEntry{
+				Time:      start.UTC().Format("2006-01-02T15:04:05Z"),
+				Client:    r.RemoteAddr,
+				Method:    r.Method,
+				Path:      r.URL.Path,
+				Status:    recorder.status,
+				LatencyMs: float64(time.Since(start).Microseconds()) / 1000,
+				UserAgent: r.UserAgent(),
+				Token:     requestToken(r) != "",
+				Key:       keyName,
+			})
+		}
+	})
+}
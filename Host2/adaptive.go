@@ -0,0 +1,107 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+)
+
+// adaptiveSampler switches the periodic collection to a fast interval
+// while a watch condition holds and back once it has been calm for
+// calm_samples consecutive samples.
+type adaptiveSampler struct {
+	mu       sync.Mutex
+	fast     bool
+	calm     int
+	interval time.Duration
+}
+
+var sampler = &adaptiveSampler{}
+
+// watchTriggered returns a description of the first watch condition the
+// snapshot meets. Without configured conditions any non-ok health counts.
+func watchTriggered(metrics *SystemMetrics, cfg AdaptiveConfig) string {
+	if len(cfg.Watch) == 0 {
+		if metrics.Health != "" && metrics.Health != "ok" {
+			return "health is " + metrics.Health
+		}
+		return ""
+	}
+	samples := flattenMetrics(metrics)
+	for _, cond := range cfg.Watch {
+		for _, sample := range samples {
+			if sample.Name == cond.Metric && thresholdBreached(sample.Value, cond.Operator, cond.Value) {
+				return fmt.Sprintf("%s is %.2f (%s %.2f)", seriesKey(sample.Name, sample.Labels), sample.Value, cond.Operator, cond.Value)
+			}
+		}
+	}
+	return ""
+}
+
+// next returns the delay before the following collection.
+func (a *adaptiveSampler) next(metrics *SystemMetrics) time.Duration {
+	cfg := currentConfig()
+	base := time.Duration(cfg.IntervalSeconds) * time.Second
+	fast := time.Duration(cfg.Adaptive.FastIntervalSeconds) * time.Second
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if !cfg.Adaptive.Enabled || fast >= base {
+		a.fast, a.calm, a.interval = false, 0, base
+		return base
+	}
+
+	reason := ""
+	if metrics != nil {
+		reason = watchTriggered(metrics, cfg.Adaptive)
+	}
+	switch {
+	case reason != "":
+		if !a.fast {
+			log.Printf("[ADAPTIVE] Sampling every %v: %s", fast, reason)
+		}
+		a.fast, a.calm = true, 0
+	case a.fast:
+		a.calm++
+		if a.calm >= cfg.Adaptive.CalmSamples {
+			log.Printf("[ADAPTIVE] Calm for %d samples, back to every %v", a.calm, base)
+			a.fast, a.calm = false, 0
+		}
+	}
+
+	a.interval = base
+	if a.fast {
+		a.interval = fast
+	}
+	return a.interval
+}
+
+// current reports the active interval for /health.
+func (a *adaptiveSampler) current() time.Duration {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.interval == 0 {
+		return time.Duration(currentConfig().IntervalSeconds) * time.Second
+	}
+	return a.interval
+}
+
+func validateWatchConditions(conds []WatchCondition) error {
+	for i := range conds {
+		cond := &conds[i]
+		if cond.Metric == "" {
+			return fmt.Errorf("adaptive.watch[%d]: metric is required", i)
+		}
+		switch strings.TrimSpace(cond.Operator) {
+		case "":
+			cond.Operator = ">"
+		case ">", ">=", "<", "<=":
+		default:
+			return fmt.Errorf("adaptive.watch[%d]: unknown operator %q", i, cond.Operator)
+		}
+	}
+	return nil
+}
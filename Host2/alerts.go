@@ -0,0 +1,153 @@
+package main
+
+import (
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Alert is a condition raised by a collector or rule that stays active
+// until the same ID is resolved.
+type Alert struct {
+	ID        string  `json:"id"`
+	Rule      string  `json:"rule"`
+	Severity  string  `json:"severity"`
+	Message   string  `json:"message"`
+	Value     float64 `json:"value"`
+	StartedAt string  `json:"started_at"`
+	Silenced  bool    `json:"silenced"`
+
+	// notified records whether a firing notification went out, so a
+	// resolution is only sent for alerts the receivers know about
+	notified bool
+}
+
+// AlertRecord is a resolved alert kept for annotation queries.
+type AlertRecord struct {
+	ID        string `json:"id"`
+	Rule      string `json:"rule"`
+	Severity  string `json:"severity"`
+	Message   string `json:"message"`
+	StartedAt string `json:"started_at"`
+	EndedAt   string `json:"ended_at"`
+}
+
+// Resolved alerts kept in memory for /grafana/annotations
+const ALERT_HISTORY_SIZE = 1000
+
+var (
+	alertsMu     sync.Mutex
+	activeAlerts = make(map[string]*Alert)
+	alertHistory []AlertRecord
+)
+
+// raiseAlert activates an alert or refreshes the message and value of an
+// already active one. Only the transition to active is logged. Notification
+// is deferred while the alert is silenced and sent once the silence ends.
+func raiseAlert(alert Alert) {
+	alertsMu.Lock()
+	existing, ok := activeAlerts[alert.ID]
+	if ok {
+		existing.Severity = alert.Severity
+		existing.Message = alert.Message
+		existing.Value = alert.Value
+	} else {
+		alert.StartedAt = time.Now().UTC().Format("2006-01-02T15:04:05Z")
+		existing = &alert
+		activeAlerts[alert.ID] = existing
+		log.Printf("[ALERT] FIRING %s (%s): %s", alert.ID, alert.Severity, alert.Message)
+	}
+
+	var event *AlertEvent
+	if !existing.notified {
+		if silenced, reason := isSilenced(*existing); silenced {
+			if !ok {
+				log.Printf("[ALERT] Notification for %s suppressed: %s", alert.ID, reason)
+			}
+		} else {
+			existing.notified = true
+			event = &AlertEvent{Status: "firing", Alert: *existing}
+		}
+	}
+	alertsMu.Unlock()
+
+	if event != nil {
+		dispatchAlertEvent(*event)
+	}
+}
+
+// resolveAlert clears an active alert; unknown IDs are ignored.
+func resolveAlert(id string) {
+	alertsMu.Lock()
+	existing, ok := activeAlerts[id]
+	if !ok {
+		alertsMu.Unlock()
+		return
+	}
+	delete(activeAlerts, id)
+	alertHistory = append(alertHistory, AlertRecord{
+		ID:        existing.ID,
+		Rule:      existing.Rule,
+		Severity:  existing.Severity,
+		Message:   existing.Message,
+		StartedAt: existing.StartedAt,
+		EndedAt:   time.Now().UTC().Format("2006-01-02T15:04:05Z"),
+	})
+	if len(alertHistory) > ALERT_HISTORY_SIZE {
+		alertHistory = append([]AlertRecord{}, alertHistory[len(alertHistory)-ALERT_HISTORY_SIZE:]...)
+	}
+	alertsMu.Unlock()
+
+	log.Printf("[ALERT] RESOLVED %s", id)
+	if existing.notified {
+		dispatchAlertEvent(AlertEvent{Status: "resolved", Alert: *existing})
+	}
+}
+
+// syncAlerts raises every alert in firing and resolves any other active
+// alert whose ID starts with prefix, for rules that evaluate a whole set of
+// items (disks, processes) at once.
+func syncAlerts(prefix string, firing []Alert) {
+	keep := make(map[string]bool, len(firing))
+	for _, alert := range firing {
+		keep[alert.ID] = true
+		raiseAlert(alert)
+	}
+
+	alertsMu.Lock()
+	var stale []string
+	for id := range activeAlerts {
+		if strings.HasPrefix(id, prefix) && !keep[id] {
+			stale = append(stale, id)
+		}
+	}
+	alertsMu.Unlock()
+
+	for _, id := range stale {
+		resolveAlert(id)
+	}
+}
+
+// resolvedAlerts returns a copy of the resolved alert history, oldest first.
+func resolvedAlerts() []AlertRecord {
+	alertsMu.Lock()
+	defer alertsMu.Unlock()
+	return append([]AlertRecord{}, alertHistory...)
+}
+
+// currentAlerts returns the active alerts ordered by ID.
+func currentAlerts() []Alert {
+	alertsMu.Lock()
+	defer alertsMu.Unlock()
+
+	alerts := make([]Alert, 0, len(activeAlerts))
+	for _, alert := range activeAlerts {
+		current := *alert
+		current.Silenced, _ = isSilenced(current)
+		alerts = append(alerts, current)
+	}
+	sort.Slice(alerts, func(i, j int) bool { return alerts[i].ID < alerts[j].ID })
+	return alerts
+}
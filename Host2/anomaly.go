@@ -0,0 +1,96 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sync"
+)
+
+// rollingStats keeps the last N values of a series for mean/stddev.
+type rollingStats struct {
+	values []float64
+	next   int
+	full   bool
+}
+
+func (r *rollingStats) add(value float64) {
+	if r.full {
+		r.values[r.next] = value
+	} else {
+		r.values = append(r.values, value)
+	}
+	r.next = (r.next + 1) % cap(r.values)
+	if len(r.values) == cap(r.values) {
+		r.full = true
+	}
+}
+
+func (r *rollingStats) meanStddev() (float64, float64) {
+	n := float64(len(r.values))
+	sum := 0.0
+	for _, v := range r.values {
+		sum += v
+	}
+	mean := sum / n
+
+	variance := 0.0
+	for _, v := range r.values {
+		variance += (v - mean) * (v - mean)
+	}
+	return mean, math.Sqrt(variance / n)
+}
+
+var (
+	anomalyMu    sync.Mutex
+	anomalyStats = make(map[string]*rollingStats)
+)
+
+// detectAnomalies compares each watched series against its rolling baseline
+// and returns alerts for values more than Sigma standard deviations away.
+// The value is added to the baseline after it has been scored.
+func detectAnomalies(samples []metricSample) []Alert {
+	cfg := currentConfig().Anomaly
+	if !cfg.Enabled {
+		return nil
+	}
+
+	watched := make(map[string]bool, len(cfg.Metrics))
+	for _, name := range cfg.Metrics {
+		watched[name] = true
+	}
+
+	anomalyMu.Lock()
+	defer anomalyMu.Unlock()
+
+	var firing []Alert
+	for _, sample := range samples {
+		if !watched[sample.Name] {
+			continue
+		}
+		key := seriesKey(sample.Name, sample.Labels)
+		stats, ok := anomalyStats[key]
+		if !ok {
+			stats = &rollingStats{values: make([]float64, 0, cfg.WindowSamples)}
+			anomalyStats[key] = stats
+		}
+
+		if len(stats.values) >= cfg.MinSamples {
+			mean, stddev := stats.meanStddev()
+			// A flat baseline has no spread to score against
+			if stddev > 0 {
+				z := (sample.Value - mean) / stddev
+				if math.Abs(z) >= cfg.Sigma {
+					firing = append(firing, Alert{
+						ID:       "anomaly:" + key,
+						Rule:     "anomaly",
+						Severity: "warning",
+						Message:  fmt.Sprintf("%s is %.2f, %.1f sigma from its baseline mean of %.2f", key, sample.Value, z, mean),
+						Value:    sample.Value,
+					})
+				}
+			}
+		}
+		stats.add(sample.Value)
+	}
+	return firing
+}
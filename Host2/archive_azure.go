@@ -0,0 +1,124 @@
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// azureBlobStore writes block blobs through a container SAS URL
+// (https://<account>.blob.core.windows.net/<container>?sv=...&sig=...), so
+// no account key is stored on the host. Retention additionally needs the
+// list and delete permissions on the SAS.
+type azureBlobStore struct {
+	containerURL string
+}
+
+// blobURL returns the container URL with the blob path inserted before the
+// SAS query, plus any extra query parameters.
+func (s *azureBlobStore) blobURL(key string, extra url.Values) (string, error) {
+	u, err := url.Parse(s.containerURL)
+	if err != nil {
+		return "", err
+	}
+	if key != "" {
+		u.Path = strings.TrimRight(u.Path, "/") + "/" + key
+	}
+	query := u.Query()
+	for k, v := range extra {
+		query[k] = v
+	}
+	u.RawQuery = query.Encode()
+	return u.String(), nil
+}
+
+func (s *azureBlobStore) do(method, target string, body []byte, headers map[string]string) ([]byte, error) {
+	req, err := http.NewRequest(method, target, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("x-ms-version", "2021-08-06")
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := notifyHTTPClient.Do(req)
+	if err != nil {
+		// The URL error would print the SAS signature into the log
+		if urlErr, ok := err.(*url.Error); ok {
+			return nil, fmt.Errorf("%s %s: %v", method, strings.SplitN(target, "?", 2)[0], urlErr.Err)
+		}
+		return nil, err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 16*1024*1024))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		if len(data) > 512 {
+			data = data[:512]
+		}
+		return nil, fmt.Errorf("unexpected status %d: %s", resp.StatusCode, strings.TrimSpace(string(data)))
+	}
+	return data, nil
+}
+
+func (s *azureBlobStore) put(key string, data []byte) error {
+	target, err := s.blobURL(key, nil)
+	if err != nil {
+		return err
+	}
+	_, err = s.do(http.MethodPut, target, data, map[string]string{
+		"x-ms-blob-type": "BlockBlob",
+		"Content-Type":   "application/x-ndjson",
+	})
+	return err
+}
+
+func (s *azureBlobStore) delete(key string) error {
+	target, err := s.blobURL(key, nil)
+	if err != nil {
+		return err
+	}
+	_, err = s.do(http.MethodDelete, target, nil, nil)
+	return err
+}
+
+func (s *azureBlobStore) list(prefix string) (map[string]time.Time, error) {
+	objects := map[string]time.Time{}
+	query := url.Values{"restype": {"container"}, "comp": {"list"}, "prefix": {prefix}}
+	for {
+		target, err := s.blobURL("", query)
+		if err != nil {
+			return nil, err
+		}
+		body, err := s.do(http.MethodGet, target, nil, nil)
+		if err != nil {
+			return nil, err
+		}
+		var result struct {
+			Blobs []struct {
+				Name         string `xml:"Name"`
+				LastModified string `xml:"Properties>Last-Modified"`
+			} `xml:"Blobs>Blob"`
+			NextMarker string `xml:"NextMarker"`
+		}
+		if err := xml.Unmarshal(body, &result); err != nil {
+			return nil, fmt.Errorf("invalid list response: %v", err)
+		}
+		for _, blob := range result.Blobs {
+			if modified, err := time.Parse(time.RFC1123, blob.LastModified); err == nil {
+				objects[blob.Name] = modified
+			}
+		}
+		if result.NextMarker == "" {
+			return objects, nil
+		}
+		query.Set("marker", result.NextMarker)
+	}
+}
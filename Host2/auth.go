@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"log"
+	"net/http"
+	"path"
+	"strings"
+)
+
+// requestToken extracts the API token from "Authorization: Bearer <token>"
+// or the X-API-Key header.
+func requestToken(r *http.Request) string {
+	if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+		return strings.TrimSpace(strings.TrimPrefix(auth, "Bearer "))
+	}
+	return r.Header.Get("X-API-Key")
+}
+
+// matchAPIKey finds the credential a request presents: api.token as an
+// unrestricted admin key, or one of api.keys. It returns nil for none.
+func matchAPIKey(cfg APIConfig, r *http.Request) *APIKey {
+	token := requestToken(r)
+	if token == "" {
+		return nil
+	}
+	if cfg.Token != "" && subtle.ConstantTimeCompare([]byte(token), []byte(cfg.Token)) == 1 {
+		return &APIKey{Name: "token", Scope: "admin"}
+	}
+	for i := range cfg.Keys {
+		if subtle.ConstantTimeCompare([]byte(token), []byte(cfg.Keys[i].Key)) == 1 {
+			return &cfg.Keys[i]
+		}
+	}
+	return nil
+}
+
+// allowsHost reports whether the key may see the host with this name or
+// agent ID.
+func (k *APIKey) allowsHost(hostname, id string) bool {
+	if len(k.Hosts) == 0 {
+		return true
+	}
+	for _, pattern := range k.Hosts {
+		if ok, _ := path.Match(pattern, hostname); ok {
+			return true
+		}
+		if ok, _ := path.Match(pattern, id); ok {
+			return true
+		}
+	}
+	return false
+}
+
+type apiKeyContextKey struct{}
+
+// requestAPIKey returns the key the router accepted for this request, or
+// nil when api.keys is not in use.
+func requestAPIKey(r *http.Request) *APIKey {
+	key, _ := r.Context().Value(apiKeyContextKey{}).(*APIKey)
+	return key
+}
+
+// authorizeRequest enforces api.keys once any are configured: /health
+// stays open for load balancers, reads need a read or admin key and
+// everything else an admin key. Host-restricted keys only reach the agents
+// they list; the /fleet endpoints filter their members instead. The
+// request returned carries the key for requestAPIKey.
+func authorizeRequest(w http.ResponseWriter, r *http.Request, read bool) (*http.Request, bool) {
+	cfg := currentConfig().API
+	if len(cfg.Keys) == 0 || r.URL.Path == "/health" {
+		return r, true
+	}
+	key := matchAPIKey(cfg, r)
+	switch {
+	case key == nil:
+		log.Printf("[AUTH] Rejected %s %s from %s", r.Method, r.URL.Path, r.RemoteAddr)
+		w.Header().Set("WWW-Authenticate", `Bearer realm="host-agent"`)
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return r, false
+	case !read && key.Scope != "admin":
+		log.Printf("[AUTH] Key %q may not %s %s", key.Name, r.Method, r.URL.Path)
+		http.Error(w, "This key is read-only", http.StatusForbidden)
+		return r, false
+	case !strings.HasPrefix(r.URL.Path, "/fleet") && !key.allowsHost(agentHostname(), agentID()):
+		log.Printf("[AUTH] Key %q is not valid for this host", key.Name)
+		http.Error(w, "This key is not valid for this host", http.StatusForbidden)
+		return r, false
+	}
+	return r.WithContext(context.WithValue(r.Context(), apiKeyContextKey{}, key)), true
+}
+
+// requireAPIToken wraps handlers that expose or change agent settings.
+// They need api.token or an admin key, and are refused outright while
+// neither is configured.
+func requireAPIToken(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		cfg := currentConfig().API
+		hasAdmin := cfg.Token != ""
+		for _, k := range cfg.Keys {
+			hasAdmin = hasAdmin || k.Scope == "admin"
+		}
+		if !hasAdmin {
+			http.Error(w, "API token not configured", http.StatusForbidden)
+			return
+		}
+		key := matchAPIKey(cfg, r)
+		if key == nil {
+			log.Printf("[AUTH] Rejected %s %s from %s", r.Method, r.URL.Path, r.RemoteAddr)
+			w.Header().Set("WWW-Authenticate", `Bearer realm="host-agent"`)
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if key.Scope != "admin" {
+			http.Error(w, "This key is read-only", http.StatusForbidden)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// Set by --read-only; disables file writing, and the router refuses every
+// method other than GET
+var readOnlyMode bool
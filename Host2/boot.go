@@ -0,0 +1,195 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	BOOT_SLOWEST_UNITS = 5               // units listed from systemd-analyze blame
+	BOOT_PERF_RETRY    = 5 * time.Minute // while the boot is unfinished or unmeasured
+)
+
+// BootPerformance is how long the current boot took, measured once per
+// boot. Phases are reported as the platform names them.
+type BootPerformance struct {
+	TotalSeconds float64            `json:"total_seconds,omitempty"`
+	Phases       map[string]float64 `json:"phases,omitempty"`        // e.g. firmware, loader, kernel, initrd, userspace; main_path, post_boot on Windows
+	SlowestUnits []BootUnit         `json:"slowest_units,omitempty"` // systemd
+	Method       string             `json:"method,omitempty"`        // "systemd-analyze" or "diagnostics_event"
+	Status       string             `json:"status"`                  // "ok", "pending" (boot not finished or not measured yet) or "unavailable"
+	Error        string             `json:"error,omitempty"`
+}
+
+// BootUnit is a systemd unit with the time it took to start.
+type BootUnit struct {
+	Unit    string  `json:"unit"`
+	Seconds float64 `json:"seconds"`
+}
+
+var bootPerfState = struct {
+	sync.Mutex
+	boot    time.Time
+	perf    BootPerformance
+	checked time.Time
+}{}
+
+// bootPerformance returns the measurement of the boot at boot, measuring
+// it on first use and again every BOOT_PERF_RETRY until it succeeds.
+func bootPerformance(boot, now time.Time) BootPerformance {
+	bootPerfState.Lock()
+	defer bootPerfState.Unlock()
+	if bootPerfState.boot.Equal(boot) && (bootPerfState.perf.Status == "ok" || now.Sub(bootPerfState.checked) < BOOT_PERF_RETRY) {
+		return bootPerfState.perf
+	}
+
+	var perf BootPerformance
+	switch collectorOS {
+	case "linux":
+		perf = systemdBootPerformance()
+	case "windows":
+		perf = windowsBootPerformance(boot)
+	default:
+		perf = BootPerformance{Status: "unavailable"}
+	}
+	bootPerfState.boot, bootPerfState.perf, bootPerfState.checked = boot, perf, now
+	return perf
+}
+
+// latestBootPerformance returns the last measurement without measuring.
+func latestBootPerformance() BootPerformance {
+	bootPerfState.Lock()
+	defer bootPerfState.Unlock()
+	if bootPerfState.perf.Status == "" {
+		return BootPerformance{Status: "pending"}
+	}
+	return bootPerfState.perf
+}
+
+// "Startup finished in 2.1s (kernel) + 1.9s (initrd) + 1min 4.2s (userspace) = 1min 8.2s"
+var systemdPhasePattern = regexp.MustCompile(`([0-9][^+=()]*?) \((\w+)\)`)
+
+// systemdBootPerformance reads the boot phases and the slowest units from
+// systemd-analyze, which fails until the boot has finished.
+func systemdBootPerformance() BootPerformance {
+	perf := BootPerformance{Method: "systemd-analyze", Status: "unavailable"}
+	if _, err := commands.LookPath("systemd-analyze"); err != nil {
+		perf.Method = ""
+		return perf
+	}
+	output, err := commands.Output("systemd-analyze", "time")
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && bytes.Contains(exitErr.Stderr, []byte("not yet finished")) {
+			perf.Status = "pending"
+			return perf
+		}
+		perf.Error = describeCollectorError(err)
+		return perf
+	}
+
+	line, _, _ := strings.Cut(string(output), "\n")
+	summary, total, found := strings.Cut(line, "=")
+	if !strings.HasPrefix(line, "Startup finished in") || !found {
+		perf.Error = fmt.Sprintf("unexpected output %q", line)
+		return perf
+	}
+	perf.Phases = make(map[string]float64)
+	for _, match := range systemdPhasePattern.FindAllStringSubmatch(summary, -1) {
+		if seconds, ok := parseSystemdTimespan(match[1]); ok {
+			perf.Phases[match[2]] = seconds
+		}
+	}
+	perf.TotalSeconds, _ = parseSystemdTimespan(total)
+	perf.Status = "ok"
+
+	// One "1min 2.345s unit.service" line per unit, slowest first
+	if output, err := commands.Output("systemd-analyze", "blame", "--no-pager"); err == nil {
+		for _, line := range strings.Split(string(output), "\n") {
+			fields := strings.Fields(line)
+			if len(fields) < 2 || len(perf.SlowestUnits) == BOOT_SLOWEST_UNITS {
+				continue
+			}
+			if seconds, ok := parseSystemdTimespan(strings.Join(fields[:len(fields)-1], " ")); ok {
+				perf.SlowestUnits = append(perf.SlowestUnits, BootUnit{Unit: fields[len(fields)-1], Seconds: seconds})
+			}
+		}
+	}
+	return perf
+}
+
+var systemdSpanUnits = map[string]float64{
+	"us": 1e-6, "ms": 1e-3, "s": 1, "min": 60, "h": 3600, "d": 86400,
+}
+
+// parseSystemdTimespan parses systemd's "1min 2.345s", "345ms" or "1h 2min".
+func parseSystemdTimespan(s string) (float64, bool) {
+	fields := strings.Fields(s)
+	if len(fields) == 0 {
+		return 0, false
+	}
+	total := 0.0
+	for _, field := range fields {
+		end := strings.IndexFunc(field, func(r rune) bool { return (r < '0' || r > '9') && r != '.' })
+		if end <= 0 {
+			return 0, false
+		}
+		value, err := strconv.ParseFloat(field[:end], 64)
+		scale, known := systemdSpanUnits[field[end:]]
+		if err != nil || !known {
+			return 0, false
+		}
+		total += value * scale
+	}
+	return math.Round(total*1000) / 1000, true
+}
+
+// windowsBootScript reads the newest boot trace Windows records in the
+// Diagnostics-Performance log (event 100) a few minutes after each boot;
+// reading the log needs administrator rights.
+const windowsBootScript = `$e = Get-WinEvent -FilterHashtable @{LogName='Microsoft-Windows-Diagnostics-Performance/Operational'; Id=100} -MaxEvents 1 -ErrorAction Stop
+$d = @{}
+([xml]$e.ToXml()).Event.EventData.Data | ForEach-Object { $d[$_.Name] = $_.'#text' }
+@{ boot_start = $d.BootStartTime; boot_ms = [long]$d.BootTime; main_path_ms = [long]$d.MainPathBootTime; post_boot_ms = [long]$d.BootPostBootTime } | ConvertTo-Json -Compress`
+
+// windowsBootPerformance reports the boot trace when it belongs to the
+// current boot; until Windows writes it, the previous one is ignored.
+func windowsBootPerformance(boot time.Time) BootPerformance {
+	perf := BootPerformance{Method: "diagnostics_event", Status: "unavailable"}
+	output, err := commands.Output("powershell", "-NoProfile", "-Command", windowsBootScript)
+	if err != nil {
+		perf.Error = describeCollectorError(err)
+		return perf
+	}
+	var event struct {
+		BootStart  string `json:"boot_start"`
+		BootMs     int64  `json:"boot_ms"`
+		MainPathMs int64  `json:"main_path_ms"`
+		PostBootMs int64  `json:"post_boot_ms"`
+	}
+	if err := json.Unmarshal(bytes.TrimSpace(output), &event); err != nil {
+		perf.Error = fmt.Sprintf("unexpected output: %v", err)
+		return perf
+	}
+	start, err := time.Parse(time.RFC3339Nano, event.BootStart)
+	if err != nil || start.Sub(boot).Abs() > 10*time.Minute {
+		perf.Status = "pending"
+		return perf
+	}
+	perf.TotalSeconds = float64(event.BootMs) / 1000
+	perf.Phases = map[string]float64{
+		"main_path": float64(event.MainPathMs) / 1000,
+		"post_boot": float64(event.PostBootMs) / 1000,
+	}
+	perf.Status = "ok"
+	return perf
+}
@@ -7,9 +7,15 @@ echo ""
 # Create bin directory
 mkdir -p bin
 
+# Stamp the binaries; set VERSION to override the version in the source
+LDFLAGS="-X main.COMMIT=$(git rev-parse --short HEAD 2>/dev/null) -X main.BUILD_DATE=$(date -u +%Y-%m-%dT%H:%M:%SZ)"
+if [ -n "$VERSION" ]; then
+    LDFLAGS="$LDFLAGS -X main.VERSION=$VERSION"
+fi
+
 # Build for Windows
 echo "[1/3] Building for Windows (amd64)..."
-GOOS=windows GOARCH=amd64 go build -o bin/host-agent-windows.exe main.go
+GOOS=windows GOARCH=amd64 go build -ldflags "$LDFLAGS" -o bin/host-agent-windows.exe .
 if [ $? -eq 0 ]; then
     echo "✓ Windows binary: bin/host-agent-windows.exe"
 else
@@ -18,7 +24,7 @@ fi
 
 # Build for Linux
 echo "[2/3] Building for Linux (amd64)..."
-GOOS=linux GOARCH=amd64 go build -o bin/host-agent-linux main.go
+GOOS=linux GOARCH=amd64 go build -ldflags "$LDFLAGS" -o bin/host-agent-linux .
 if [ $? -eq 0 ]; then
     echo "✓ Linux binary: bin/host-agent-linux"
 else
@@ -27,7 +33,7 @@ fi
 
 # Build for macOS
 echo "[3/3] Building for macOS (amd64)..."
-GOOS=darwin GOARCH=amd64 go build -o bin/host-agent-macos main.go
+GOOS=darwin GOARCH=amd64 go build -ldflags "$LDFLAGS" -o bin/host-agent-macos .
 if [ $? -eq 0 ]; then
     echo "✓ macOS binary: bin/host-agent-macos"
 else
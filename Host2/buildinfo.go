@@ -0,0 +1,132 @@
+package main
+
+import (
+	"runtime"
+	"runtime/debug"
+)
+
+// Set at build time, e.g.
+//
+//	go build -ldflags "-X main.VERSION=1.2.0 -X main.COMMIT=$(git rev-parse --short HEAD) -X main.BUILD_DATE=$(date -u +%Y-%m-%dT%H:%M:%SZ)"
+//
+// Without them COMMIT and BUILD_DATE fall back to the VCS stamp Go records
+// when building from a checkout.
+var (
+	VERSION    = "1.0.0"
+	COMMIT     = ""
+	BUILD_DATE = ""
+)
+
+// Sink and notifier types this binary knows, in config spelling
+var (
+	sinkTypes     = []string{"http", "influxdb", "zabbix", "elasticsearch", "nats", "redis", "mqtt", "kafka", "syslog", "s3", "azure_blob"}
+	notifierTypes = []string{"pagerduty", "opsgenie", "telegram", "webhook"}
+)
+
+// Optional collectors that only exist on some platforms; the rest are
+// built everywhere. Mirrors the build constraints of the collector files.
+var collectorPlatforms = map[string][]string{
+	"event_log":  {"windows"},
+	"hyperv":     {"windows"},
+	"kernel":     {"linux", "windows"},
+	"kernel_log": {"linux"},
+	"raid":       {"linux"},
+	"sockets":    {"linux"},
+	"cgroups":    {"linux"},
+	"numa":       {"linux", "windows"},
+	"hugepages":  {"linux"},
+	"entropy":    {"linux"},
+	"limits":     {"linux"},
+	"quotas":     {"linux", "windows"},
+	"security":   {"linux", "windows"},
+	"updates":    {"linux", "windows"},
+}
+
+// BuildInfo identifies the running binary.
+type BuildInfo struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit,omitempty"`
+	BuildDate string `json:"build_date,omitempty"`
+	Modified  bool   `json:"modified,omitempty"` // built from a checkout with uncommitted changes
+	GoVersion string `json:"go_version"`
+	Platform  string `json:"platform"`
+	Arch      string `json:"arch"`
+}
+
+// FeatureInfo lists what the binary supports, independent of what the
+// configuration enables.
+type FeatureInfo struct {
+	Collectors            []string `json:"collectors"`
+	UnsupportedCollectors []string `json:"unsupported_collectors"` // optional collectors not built for this platform
+	Sinks                 []string `json:"sinks"`
+	Notifiers             []string `json:"notifiers"`
+	OutputFormats         []string `json:"output_formats"`
+	Encodings             []string `json:"encodings"` // /metrics content types
+	EBPF                  bool     `json:"ebpf"`      // eBPF attribution for processes.ebpf, every Linux build
+}
+
+func buildInfo() BuildInfo {
+	info := BuildInfo{
+		Version:   VERSION,
+		Commit:    COMMIT,
+		BuildDate: BUILD_DATE,
+		GoVersion: runtime.Version(),
+		Platform:  runtime.GOOS,
+		Arch:      runtime.GOARCH,
+	}
+	if bi, ok := debug.ReadBuildInfo(); ok {
+		for _, setting := range bi.Settings {
+			switch setting.Key {
+			case "vcs.revision":
+				if info.Commit == "" {
+					info.Commit = setting.Value
+					if len(info.Commit) > 12 {
+						info.Commit = info.Commit[:12]
+					}
+				}
+			case "vcs.time":
+				if info.BuildDate == "" {
+					info.BuildDate = setting.Value
+				}
+			case "vcs.modified":
+				info.Modified = setting.Value == "true"
+			}
+		}
+	}
+	return info
+}
+
+// collectorSupported reports whether an optional collector is built for
+// this platform.
+func collectorSupported(name string) bool {
+	platforms, ok := collectorPlatforms[name]
+	if !ok {
+		return true
+	}
+	for _, platform := range platforms {
+		if platform == runtime.GOOS {
+			return true
+		}
+	}
+	return false
+}
+
+func featureInfo() FeatureInfo {
+	features := FeatureInfo{
+		Collectors:            []string{"system", "cpu", "memory", "disk", "network"},
+		UnsupportedCollectors: []string{},
+		Sinks:                 sinkTypes,
+		Notifiers:             notifierTypes,
+		OutputFormats:         []string{"json", "protobuf"},
+		Encodings:             []string{"application/json", "application/msgpack", "application/cbor"},
+		EBPF:                  ebpfBuilt,
+	}
+	for _, name := range optionalCollectors {
+		if collectorSupported(name) {
+			features.Collectors = append(features.Collectors, name)
+		} else {
+			features.UnsupportedCollectors = append(features.UnsupportedCollectors, name)
+		}
+	}
+	return features
+}
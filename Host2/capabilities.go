@@ -0,0 +1,119 @@
+package main
+
+import (
+	"errors"
+	"io/fs"
+	"log"
+	"os"
+	"strings"
+	"sync"
+)
+
+// CapabilityInfo records a collector that cannot gather full data because
+// the agent lacks privileges, so consumers can tell missing data from zeros.
+type CapabilityInfo struct {
+	Collector string `json:"collector"`
+	Status    string `json:"status"` // "degraded"
+	Reason    string `json:"reason"`
+}
+
+var (
+	capabilitiesOnce sync.Once
+	capabilities     []CapabilityInfo
+)
+
+// probeCapabilities runs the platform privilege checks once at startup and
+// logs every degraded collector.
+func probeCapabilities() []CapabilityInfo {
+	capabilitiesOnce.Do(func() {
+		capabilities = platformCapabilityProbes()
+		if capabilities == nil {
+			capabilities = []CapabilityInfo{}
+		}
+		for _, c := range capabilities {
+			log.Printf("[CAPS] %s collector degraded: %s", c.Collector, c.Reason)
+		}
+	})
+	return capabilities
+}
+
+// platformCapabilityProbes checks the privileges the collectors of this
+// platform need.
+func platformCapabilityProbes() []CapabilityInfo {
+	switch collectorOS {
+	case "linux":
+		return linuxCapabilityProbes()
+	case "windows":
+		return windowsCapabilityProbes()
+	}
+	return nil
+}
+
+func linuxCapabilityProbes() []CapabilityInfo {
+	var degraded []CapabilityInfo
+
+	// The kernel ring buffer is restricted by kernel.dmesg_restrict
+	if kmsg, err := hostFS.Open("/dev/kmsg"); err == nil {
+		kmsg.Close()
+	} else if errors.Is(err, fs.ErrPermission) {
+		degraded = append(degraded, CapabilityInfo{
+			Collector: "kernel_log",
+			Status:    "degraded",
+			Reason:    "cannot read /dev/kmsg; run as root or grant CAP_SYSLOG",
+		})
+	}
+
+	// With hidepid, other users' processes are invisible to non-root
+	if os.Geteuid() != 0 {
+		if data, err := hostFS.ReadFile("/proc/self/mountinfo"); err == nil {
+			for _, line := range strings.Split(string(data), "\n") {
+				fields := strings.Fields(line)
+				if len(fields) > 4 && fields[4] == "/proc" && strings.Contains(line, "hidepid=") &&
+					!strings.Contains(line, "hidepid=0") && !strings.Contains(line, "hidepid=off") {
+					degraded = append(degraded, CapabilityInfo{
+						Collector: "processes",
+						Status:    "degraded",
+						Reason:    "/proc is mounted with hidepid; only the agent user's processes are visible",
+					})
+					break
+				}
+			}
+		}
+	}
+
+	return degraded
+}
+
+func windowsCapabilityProbes() []CapabilityInfo {
+	if admin, known := userIsAdmin(); admin || !known {
+		return nil
+	}
+
+	// WMI thermal zones and other users' process details need elevation
+	return []CapabilityInfo{
+		{
+			Collector: "temperature",
+			Status:    "degraded",
+			Reason:    "MSAcpi_ThermalZoneTemperature requires running as Administrator",
+		},
+		{
+			Collector: "processes",
+			Status:    "degraded",
+			Reason:    "CPU and user details of other users' processes require running as Administrator",
+		},
+	}
+}
+
+// markDegraded replaces a non-ok collector status with "degraded" when the
+// startup probe found missing privileges for that collector.
+func markDegraded(collector string, status *string) {
+	if *status == "ok" || *status == "disabled" {
+		return
+	}
+	for _, c := range probeCapabilities() {
+		if c.Collector == collector {
+			*status = "degraded"
+			return
+		}
+	}
+}
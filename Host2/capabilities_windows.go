@@ -0,0 +1,18 @@
+package main
+
+import "syscall"
+
+var (
+	shell32DLL        = syscall.NewLazyDLL("shell32.dll")
+	procIsUserAnAdmin = shell32DLL.NewProc("IsUserAnAdmin")
+)
+
+// userIsAdmin reports whether the agent runs elevated; known is false when
+// shell32 cannot tell.
+func userIsAdmin() (admin, known bool) {
+	if err := procIsUserAnAdmin.Find(); err != nil {
+		return false, false
+	}
+	result, _, _ := procIsUserAnAdmin.Call()
+	return result != 0, true
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CgroupsInfo breaks host CPU and memory usage down by control group:
+// systemd slices and services, container runtimes and Kubernetes pods.
+type CgroupsInfo struct {
+	Version int           `json:"version"` // 1 or 2
+	Groups  []CgroupUsage `json:"groups"`  // by path, parents before children
+	Status  string        `json:"status"`
+}
+
+// CgroupUsage is the usage of one group including its descendants.
+type CgroupUsage struct {
+	Path          string  `json:"path"`        // relative to the hierarchy root, e.g. "system.slice/docker.service"
+	CPUPercent    float64 `json:"cpu_percent"` // of one core, averaged since the previous sample
+	MemoryMB      float64 `json:"memory_mb"`   // working set: usage minus inactive page cache, as docker and kubelet report it
+	MemoryLimitMB float64 `json:"memory_limit_mb,omitempty"`
+	Tasks         uint64  `json:"tasks,omitempty"` // with the pids controller
+}
+
+const CGROUP_ROOT = "/sys/fs/cgroup"
+
+// Memory limits at or above this mean "no limit" on cgroup v1, which
+// reports the largest page-aligned value instead
+const CGROUP_V1_NO_LIMIT = 1 << 62
+
+// Cumulative CPU seconds of each group at the previous sample
+var cgroupState = struct {
+	sync.Mutex
+	cpu     map[string]float64
+	sampled time.Time
+}{}
+
+// collectCgroupsInfo reads every group down to cgroups.depth levels below
+// the root from the unified hierarchy, or from the v1 cpuacct, memory and
+// pids hierarchies. Cgroups are Linux-only.
+func collectCgroupsInfo(now time.Time, trace *sectionTrace) CgroupsInfo {
+	info := CgroupsInfo{Groups: []CgroupUsage{}, Status: "unavailable"}
+	if collectorOS != "linux" {
+		return info
+	}
+	depth := currentConfig().Cgroups.Depth
+
+	cpu := make(map[string]float64)
+	if _, err := hostFS.Stat(CGROUP_ROOT + "/cgroup.controllers"); err == nil {
+		info.Version = 2
+		for _, path := range cgroupPaths(CGROUP_ROOT, depth) {
+			dir := CGROUP_ROOT + "/" + path
+			group := CgroupUsage{Path: path}
+			if usec, ok := readStatValue(dir+"/cpu.stat", "usage_usec"); ok {
+				cpu[path] = float64(usec) / 1e6
+			}
+			if usage, err := readUint(dir + "/memory.current"); err == nil {
+				inactive, _ := readStatValue(dir+"/memory.stat", "inactive_file")
+				group.MemoryMB = workingSetMB(usage, inactive)
+			}
+			// "max" when unlimited
+			if limit, err := readUint(dir + "/memory.max"); err == nil {
+				group.MemoryLimitMB = math.Round(float64(limit)/1024/1024*10) / 10
+			}
+			group.Tasks, _ = readUint(dir + "/pids.current")
+			info.Groups = append(info.Groups, group)
+		}
+	} else if _, err := hostFS.Stat(CGROUP_ROOT + "/memory"); err == nil {
+		info.Version = 1
+		cpuacct := CGROUP_ROOT + "/cpuacct"
+		if _, err := hostFS.Stat(cpuacct); err != nil {
+			cpuacct = CGROUP_ROOT + "/cpu,cpuacct"
+		}
+		memory, pids := CGROUP_ROOT+"/memory", CGROUP_ROOT+"/pids"
+
+		// Each controller has its own tree; a group may exist in only one
+		seen := map[string]bool{}
+		var paths []string
+		for _, path := range append(cgroupPaths(cpuacct, depth), cgroupPaths(memory, depth)...) {
+			if !seen[path] {
+				seen[path] = true
+				paths = append(paths, path)
+			}
+		}
+		sort.Strings(paths)
+		for _, path := range paths {
+			group := CgroupUsage{Path: path}
+			if nsec, err := readUint(cpuacct + "/" + path + "/cpuacct.usage"); err == nil {
+				cpu[path] = float64(nsec) / 1e9
+			}
+			if usage, err := readUint(memory + "/" + path + "/memory.usage_in_bytes"); err == nil {
+				inactive, _ := readStatValue(memory+"/"+path+"/memory.stat", "total_inactive_file")
+				group.MemoryMB = workingSetMB(usage, inactive)
+			}
+			if limit, err := readUint(memory + "/" + path + "/memory.limit_in_bytes"); err == nil && limit < CGROUP_V1_NO_LIMIT {
+				group.MemoryLimitMB = math.Round(float64(limit)/1024/1024*10) / 10
+			}
+			group.Tasks, _ = readUint(pids + "/" + path + "/pids.current")
+			info.Groups = append(info.Groups, group)
+		}
+	} else {
+		trace.fail("cgroupfs", fmt.Errorf("%s is not mounted", CGROUP_ROOT))
+		return info
+	}
+
+	cgroupState.Lock()
+	elapsed := now.Sub(cgroupState.sampled).Seconds()
+	for i, group := range info.Groups {
+		before, ok := cgroupState.cpu[group.Path]
+		if seconds, found := cpu[group.Path]; found && ok && elapsed > 0 && seconds >= before {
+			info.Groups[i].CPUPercent = math.Round((seconds-before)/elapsed*1000) / 10
+		}
+	}
+	cgroupState.cpu, cgroupState.sampled = cpu, now
+	cgroupState.Unlock()
+
+	trace.ok("cgroup_v" + strconv.Itoa(info.Version))
+	info.Status = "ok"
+	return info
+}
+
+// cgroupPaths lists the groups down to depth levels below root, relative
+// to it and sorted so parents come before their children.
+func cgroupPaths(root string, depth int) []string {
+	var paths []string
+	for level := 1; level <= depth; level++ {
+		matches, _ := hostFS.Glob(root + strings.Repeat("/*", level) + "/cgroup.procs")
+		for _, match := range matches {
+			paths = append(paths, strings.TrimPrefix(path.Dir(match), root+"/"))
+		}
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// readStatValue returns one "key value" line of a stat file such as a
+// cgroup's memory.stat or a NUMA node's numastat.
+func readStatValue(path, key string) (uint64, bool) {
+	data, err := hostFS.ReadFile(path)
+	if err != nil {
+		return 0, false
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if name, value, found := strings.Cut(line, " "); found && name == key {
+			n, err := strconv.ParseUint(strings.TrimSpace(value), 10, 64)
+			return n, err == nil
+		}
+	}
+	return 0, false
+}
+
+func workingSetMB(usage, inactive uint64) float64 {
+	if inactive > usage {
+		inactive = usage
+	}
+	return math.Round(float64(usage-inactive)/1024/1024*10) / 10
+}
@@ -0,0 +1,300 @@
+package main
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// configFinding is one line of the check-config report.
+type configFinding struct {
+	level   string // "OK", "WARN" or "FAIL"
+	subject string
+	detail  string
+}
+
+// pushTarget is a destination the agent sends data to, tested by
+// connecting to it.
+type pushTarget struct {
+	subject string
+	rawURL  string
+	port    string // used when the URL has none
+	tls     bool   // handshake straight away, verifying the certificate
+}
+
+// checkConfigCommand validates the configuration like serve would, then
+// looks for things that only fail at runtime: listen addresses already
+// taken, collectors this platform lacks, WASM plugins that do not load
+// and unreachable push targets.
+func checkConfigCommand(args []string) error {
+	fs := newFlagSet("check-config")
+	offline := fs.Bool("offline", false, "skip the connection tests")
+	timeout := fs.Duration("timeout", 5*time.Second, "time allowed for each connection test")
+	fs.Parse(args)
+
+	path, err := configPath()
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Checking %s\n", path)
+	if _, err := os.Stat(path); err != nil {
+		return fmt.Errorf("cannot read config: %v", err)
+	}
+	cfg, err := loadConfig()
+	if err != nil {
+		fmt.Printf("  FAIL  config: %v\n", err)
+		return fmt.Errorf("the configuration is invalid")
+	}
+
+	findings := []configFinding{{"OK", "config", fmt.Sprintf("valid (%d sinks, %d notifiers, %d rules)", len(cfg.Sinks), len(cfg.Notifiers), len(cfg.Alerts.Rules))}}
+	findings = append(findings, checkListenAddresses(cfg)...)
+	findings = append(findings, checkCollectorSupport(cfg)...)
+	findings = append(findings, checkWasmPlugins(cfg)...)
+	if !*offline {
+		findings = append(findings, checkPushTargets(pushTargets(cfg), *timeout)...)
+	}
+
+	problems := 0
+	for _, f := range findings {
+		fmt.Printf("  %-4s  %s: %s\n", f.level, f.subject, f.detail)
+		if f.level == "FAIL" {
+			problems++
+		}
+	}
+	if problems > 0 {
+		return fmt.Errorf("%d problem(s) found", problems)
+	}
+	fmt.Println("No problems found")
+	return nil
+}
+
+func checkListenAddresses(cfg *AgentConfig) []configFinding {
+	addrs, err := resolveListenAddresses(cfg.API.Listen)
+	if err != nil {
+		return []configFinding{{"FAIL", "api.listen", err.Error()}}
+	}
+	var findings []configFinding
+	for _, addr := range addrs {
+		listener, err := net.Listen("tcp", addr)
+		if err != nil {
+			// Expected while the agent itself is running
+			findings = append(findings, configFinding{"WARN", "api.listen " + addr, fmt.Sprintf("%v (is the agent already running?)", err)})
+			continue
+		}
+		listener.Close()
+		findings = append(findings, configFinding{"OK", "api.listen " + addr, "available"})
+	}
+	return findings
+}
+
+func checkCollectorSupport(cfg *AgentConfig) []configFinding {
+	var findings []configFinding
+	for _, name := range optionalCollectors {
+		if cfg.Collectors[name] && !collectorSupported(name) {
+			findings = append(findings, configFinding{"WARN", "collectors." + name, "not available on " + runtime.GOOS + " and reports nothing"})
+		}
+	}
+	if len(cfg.PerfCounters) > 0 && runtime.GOOS != "windows" {
+		findings = append(findings, configFinding{"WARN", "perf_counters", "only collected on Windows"})
+	}
+	if cfg.Processes.EBPF && !ebpfBuilt {
+		findings = append(findings, configFinding{"WARN", "processes.ebpf", "only available on Linux"})
+	}
+	return findings
+}
+
+// checkWasmPlugins compiles every module in wasm_plugins.dir and checks
+// its imports against the WASI functions the runtime provides, without
+// running it.
+func checkWasmPlugins(cfg *AgentConfig) []configFinding {
+	if cfg.WasmPlugins.Dir == "" {
+		return nil
+	}
+	files, err := wasmPluginFiles(cfg.WasmPlugins.Dir)
+	if err == nil && len(files) == 0 {
+		_, err = os.Stat(cfg.WasmPlugins.Dir)
+	}
+	if err != nil {
+		return []configFinding{{"FAIL", "wasm_plugins.dir", err.Error()}}
+	}
+	if len(files) == 0 {
+		return []configFinding{{"WARN", "wasm_plugins.dir", "no .wasm files"}}
+	}
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	engine, err := newWasmRuntime(wasmMemoryPages(cfg.WasmPlugins.MaxMemoryMB))
+	if err != nil {
+		return []configFinding{{"FAIL", "wasm_plugins", err.Error()}}
+	}
+	defer engine.close()
+	var findings []configFinding
+	for _, name := range names {
+		subject := "wasm_plugins " + filepath.Base(files[name])
+		if _, err := engine.load(files[name]); err != nil {
+			findings = append(findings, configFinding{"FAIL", subject, err.Error()})
+			continue
+		}
+		findings = append(findings, configFinding{"OK", subject, "loads"})
+	}
+	return findings
+}
+
+// pushTargets lists every sink, notifier and fleet endpoint the agent
+// would connect to.
+func pushTargets(cfg *AgentConfig) []pushTarget {
+	var targets []pushTarget
+	for i, s := range cfg.Sinks {
+		subject := fmt.Sprintf("sinks[%d] %s (%s)", i, s.Name, s.Type)
+		target := pushTarget{subject: subject, rawURL: s.URL}
+		switch s.Type {
+		case "s3":
+			if s.URL == "" {
+				target.rawURL = "https://" + s.Bucket + ".s3." + s.Region + ".amazonaws.com"
+			}
+		case "zabbix":
+			target.port = "10051"
+		case "nats":
+			// tls:// upgrades after the plaintext INFO, so only TCP is tested
+			target.port = "4222"
+		case "redis":
+			target.port = "6379"
+			target.tls = strings.HasPrefix(s.URL, "rediss://")
+		case "mqtt":
+			target.port = "1883"
+			if strings.HasPrefix(s.URL, "mqtts://") {
+				target.port, target.tls = "8883", true
+			}
+		case "kafka":
+			// Only the first bootstrap broker is tested
+			target.rawURL, _, _ = strings.Cut(s.URL, ",")
+			target.port = "9092"
+			target.tls = strings.HasPrefix(s.URL, "kafkas://")
+		case "syslog":
+			target.port = "514"
+			if strings.HasPrefix(s.URL, "tls://") {
+				target.port, target.tls = "6514", true
+			}
+		}
+		targets = append(targets, target)
+	}
+	for i, n := range cfg.Notifiers {
+		target := pushTarget{subject: fmt.Sprintf("notifiers[%d] %s (%s)", i, n.Name, n.Type), rawURL: n.URL}
+		if target.rawURL == "" {
+			switch n.Type {
+			case "pagerduty":
+				target.rawURL = PAGERDUTY_EVENTS_URL
+			case "opsgenie":
+				target.rawURL = OPSGENIE_API_URL
+			case "telegram":
+				target.rawURL = TELEGRAM_API_URL
+			}
+		}
+		targets = append(targets, target)
+	}
+	if cfg.Registration.URL != "" {
+		targets = append(targets, pushTarget{subject: "registration.url", rawURL: cfg.Registration.URL})
+	}
+	if cfg.Tunnel.URL != "" {
+		targets = append(targets, pushTarget{subject: "tunnel.url", rawURL: cfg.Tunnel.URL})
+	}
+	if cfg.Update.URL != "" {
+		targets = append(targets, pushTarget{subject: "update.url", rawURL: cfg.Update.URL})
+	}
+	if cfg.Gossip.Enabled {
+		for _, seed := range cfg.Gossip.Seeds {
+			targets = append(targets, pushTarget{subject: "gossip.seeds " + seed, rawURL: "udp://" + gossipSeedAddress(seed)})
+		}
+	}
+	return targets
+}
+
+// checkPushTargets tests all targets concurrently, reporting in order.
+func checkPushTargets(targets []pushTarget, timeout time.Duration) []configFinding {
+	findings := make([]configFinding, len(targets))
+	var wg sync.WaitGroup
+	for i, target := range targets {
+		wg.Add(1)
+		go func(i int, target pushTarget) {
+			defer wg.Done()
+			detail, err := probePushTarget(target, timeout)
+			if err != nil {
+				findings[i] = configFinding{"FAIL", target.subject, err.Error()}
+			} else {
+				findings[i] = configFinding{"OK", target.subject, detail}
+			}
+		}(i, target)
+	}
+	wg.Wait()
+	return findings
+}
+
+// probePushTarget connects to the target's host, completing the TLS
+// handshake for TLS schemes. UDP targets can only be resolved, and unix
+// sockets must exist.
+func probePushTarget(target pushTarget, timeout time.Duration) (string, error) {
+	if target.rawURL == "" {
+		for _, socket := range syslogLocalSockets {
+			if _, err := os.Stat(socket); err == nil {
+				return "local socket " + socket + " exists", nil
+			}
+		}
+		return "", fmt.Errorf("no local syslog socket (%s)", strings.Join(syslogLocalSockets, ", "))
+	}
+	parsed, err := url.Parse(target.rawURL)
+	if err != nil {
+		return "", err
+	}
+	if parsed.Scheme == "unix" {
+		if _, err := os.Stat(parsed.Path); err != nil {
+			return "", err
+		}
+		return "socket exists", nil
+	}
+
+	port := parsed.Port()
+	if port == "" {
+		switch parsed.Scheme {
+		case "http", "ws":
+			port = "80"
+		case "https", "wss":
+			port = "443"
+		default:
+			port = target.port
+		}
+	}
+	address := net.JoinHostPort(parsed.Hostname(), port)
+	if parsed.Scheme == "udp" {
+		if _, err := net.ResolveUDPAddr("udp", address); err != nil {
+			return "", err
+		}
+		return address + " resolves (UDP is not tested further)", nil
+	}
+
+	dialer := &net.Dialer{Timeout: timeout}
+	start := time.Now()
+	if target.tls || parsed.Scheme == "https" || parsed.Scheme == "wss" {
+		conn, err := tls.DialWithDialer(dialer, "tcp", address, &tls.Config{ServerName: parsed.Hostname()})
+		if err != nil {
+			return "", err
+		}
+		conn.Close()
+		return fmt.Sprintf("%s reachable, TLS verified (%v)", address, time.Since(start).Round(time.Millisecond)), nil
+	}
+	conn, err := dialer.Dial("tcp", address)
+	if err != nil {
+		return "", err
+	}
+	conn.Close()
+	return fmt.Sprintf("%s reachable (%v)", address, time.Since(start).Round(time.Millisecond)), nil
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"github.com/shirou/gopsutil/v3/disk"
+)
+
+// ChecksInfo holds the most recent results of the active-check subsystem.
+// Checks run on their own interval so slow probes never delay a snapshot.
+type ChecksInfo struct {
+	LastRun string         `json:"last_run"`
+	Ping    []PingResult   `json:"ping"`
+	HTTP    []HTTPResult   `json:"http"`
+	DNS     []DNSResult    `json:"dns"`
+	Apps    []AppResult    `json:"apps"`
+	Mounts  []MountResult  `json:"mounts"`
+	ISCSI   []ISCSISession `json:"iscsi"`
+}
+
+var (
+	checksMu     sync.RWMutex
+	latestChecks = emptyChecks()
+)
+
+func emptyChecks() ChecksInfo {
+	return ChecksInfo{Ping: []PingResult{}, HTTP: []HTTPResult{}, DNS: []DNSResult{}, Apps: []AppResult{}, Mounts: []MountResult{}, ISCSI: []ISCSISession{}}
+}
+
+// latestCheckResults returns a copy of the last completed check round.
+func latestCheckResults() ChecksInfo {
+	checksMu.RLock()
+	defer checksMu.RUnlock()
+
+	results := latestChecks
+	results.Ping = append([]PingResult{}, latestChecks.Ping...)
+	results.HTTP = append([]HTTPResult{}, latestChecks.HTTP...)
+	results.DNS = append([]DNSResult{}, latestChecks.DNS...)
+	results.Apps = append([]AppResult{}, latestChecks.Apps...)
+	results.Mounts = append([]MountResult{}, latestChecks.Mounts...)
+	results.ISCSI = append([]ISCSISession{}, latestChecks.ISCSI...)
+	return results
+}
+
+// runChecks executes every configured check concurrently.
+func runChecks(cfg ChecksConfig) ChecksInfo {
+	mounts := mountTargets(cfg.Mounts)
+	results := ChecksInfo{
+		Ping:   make([]PingResult, len(cfg.Ping)),
+		HTTP:   make([]HTTPResult, len(cfg.HTTP)),
+		DNS:    make([]DNSResult, len(cfg.DNS)),
+		Apps:   make([]AppResult, len(cfg.Apps)),
+		Mounts: make([]MountResult, len(mounts)),
+		ISCSI:  []ISCSISession{},
+	}
+
+	var wg sync.WaitGroup
+	for i, target := range cfg.Ping {
+		wg.Add(1)
+		go func(i int, target PingTarget) {
+			defer wg.Done()
+			results.Ping[i] = runPingCheck(target)
+		}(i, target)
+	}
+	for i, target := range cfg.HTTP {
+		wg.Add(1)
+		go func(i int, target HTTPTarget) {
+			defer wg.Done()
+			results.HTTP[i] = runHTTPCheck(target)
+		}(i, target)
+	}
+	for i, target := range cfg.DNS {
+		wg.Add(1)
+		go func(i int, target DNSTarget) {
+			defer wg.Done()
+			results.DNS[i] = runDNSCheck(target)
+		}(i, target)
+	}
+	for i, target := range cfg.Apps {
+		wg.Add(1)
+		go func(i int, target AppTarget) {
+			defer wg.Done()
+			results.Apps[i] = runAppCheck(target)
+		}(i, target)
+	}
+	timeout := time.Duration(cfg.Mounts.TimeoutMs) * time.Millisecond
+	for i, target := range mounts {
+		wg.Add(1)
+		go func(i int, target disk.PartitionStat) {
+			defer wg.Done()
+			results.Mounts[i] = runMountCheck(target, timeout)
+		}(i, target)
+	}
+	if cfg.Mounts.ISCSI {
+		results.ISCSI = iscsiSessions()
+	}
+	wg.Wait()
+
+	results.LastRun = time.Now().UTC().Format("2006-01-02T15:04:05Z")
+	return results
+}
+
+// startActiveChecks runs the configured checks until the process exits,
+// picking up new targets and intervals whenever the config is reloaded.
+func startActiveChecks() {
+	for {
+		cfg := currentConfig().Checks
+		reloaded := configReloaded()
+
+		mountsEnabled := cfg.Mounts.Auto || len(cfg.Mounts.Paths) > 0 || cfg.Mounts.ISCSI
+		if len(cfg.Ping) == 0 && len(cfg.HTTP) == 0 && len(cfg.DNS) == 0 && len(cfg.Apps) == 0 && !mountsEnabled {
+			checksMu.Lock()
+			latestChecks = emptyChecks()
+			checksMu.Unlock()
+			<-reloaded
+			continue
+		}
+
+		interval := time.Duration(cfg.IntervalSeconds) * time.Second
+		log.Printf("[CHECKS] Running active checks (%d ping, %d http, %d dns, %d apps, mounts: %v, interval: %v)",
+			len(cfg.Ping), len(cfg.HTTP), len(cfg.DNS), len(cfg.Apps), mountsEnabled, interval)
+
+		for running := true; running; {
+			results := runChecks(cfg)
+
+			checksMu.Lock()
+			latestChecks = results
+			checksMu.Unlock()
+
+			select {
+			case <-time.After(interval):
+			case <-reloaded:
+				running = false
+			}
+		}
+	}
+}
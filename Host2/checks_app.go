@@ -0,0 +1,90 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/shirou/gopsutil/v3/process"
+)
+
+// AppResult reports whether an application is alive by its pidfile, its
+// local port, or both.
+type AppResult struct {
+	Name      string  `json:"name"`
+	PID       int32   `json:"pid,omitempty"`
+	Port      int     `json:"port,omitempty"`
+	LatencyMs float64 `json:"latency_ms"` // port connect time
+	Status    string  `json:"status"`     // "ok", "down" or "error"
+	Error     string  `json:"error,omitempty"`
+}
+
+func runAppCheck(target AppTarget) AppResult {
+	result := AppResult{Name: target.Name, Port: target.Port, Status: "ok"}
+
+	if target.PIDFile != "" {
+		data, err := os.ReadFile(target.PIDFile)
+		switch {
+		case os.IsNotExist(err):
+			// Most daemons remove their pidfile on a clean exit
+			result.Status = "down"
+			result.Error = "pid file does not exist"
+			return result
+		case err != nil:
+			result.Status = "error"
+			result.Error = err.Error()
+			return result
+		}
+		pid, err := strconv.ParseInt(strings.TrimSpace(string(data)), 10, 32)
+		if err != nil || pid <= 0 {
+			result.Status = "error"
+			result.Error = fmt.Sprintf("pid file does not hold a PID: %q", strings.TrimSpace(string(data)))
+			return result
+		}
+		result.PID = int32(pid)
+		if exists, err := process.PidExists(result.PID); err == nil && !exists {
+			result.Status = "down"
+			result.Error = fmt.Sprintf("process %d from stale pid file is not running", pid)
+			return result
+		}
+	}
+
+	if target.Port > 0 {
+		address := net.JoinHostPort(target.Host, strconv.Itoa(target.Port))
+		start := time.Now()
+		conn, err := net.DialTimeout("tcp", address, time.Duration(target.TimeoutMs)*time.Millisecond)
+		result.LatencyMs = float64(time.Since(start).Microseconds()) / 1000
+		if err != nil {
+			result.Status = "down"
+			result.Error = err.Error()
+			return result
+		}
+		conn.Close()
+	}
+	return result
+}
+
+// appCheckAlerts raises one alert per application that is not healthy.
+func appCheckAlerts(results []AppResult) []Alert {
+	severities := make(map[string]string)
+	for _, target := range currentConfig().Checks.Apps {
+		severities[target.Name] = target.Severity
+	}
+
+	var firing []Alert
+	for _, result := range results {
+		if result.Status == "ok" {
+			continue
+		}
+		firing = append(firing, Alert{
+			ID:       "app:" + result.Name,
+			Rule:     "app_check",
+			Severity: severities[result.Name],
+			Message:  fmt.Sprintf("%s is %s: %s", result.Name, result.Status, result.Error),
+		})
+	}
+	return firing
+}
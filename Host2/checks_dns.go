@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"time"
+)
+
+type DNSResult struct {
+	Name      string   `json:"name"`
+	Query     string   `json:"query"`
+	Type      string   `json:"type"`
+	Resolver  string   `json:"resolver"`
+	LatencyMs float64  `json:"latency_ms"`
+	Answers   []string `json:"answers"`
+	Status    string   `json:"status"`
+	Error     string   `json:"error,omitempty"`
+}
+
+func runDNSCheck(target DNSTarget) DNSResult {
+	result := DNSResult{
+		Name:     target.Name,
+		Query:    target.Query,
+		Type:     target.Type,
+		Resolver: target.Resolver,
+		Answers:  []string{},
+		Status:   "error",
+	}
+	if result.Resolver == "" {
+		result.Resolver = "system"
+	}
+
+	resolver := net.DefaultResolver
+	if target.Resolver != "" {
+		// Send queries straight to the configured server instead of the system resolver
+		dialer := &net.Dialer{Timeout: time.Duration(target.TimeoutMs) * time.Millisecond}
+		resolver = &net.Resolver{
+			PreferGo: true,
+			Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+				return dialer.DialContext(ctx, network, target.Resolver)
+			},
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(target.TimeoutMs)*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	answers, err := lookupRecords(ctx, resolver, target.Type, target.Query)
+	result.LatencyMs = float64(time.Since(start).Microseconds()) / 1000
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+
+	result.Answers = answers
+	if len(answers) == 0 {
+		result.Status = "down"
+		result.Error = "no records returned"
+		return result
+	}
+	result.Status = "ok"
+	return result
+}
+
+func lookupRecords(ctx context.Context, resolver *net.Resolver, recordType, query string) ([]string, error) {
+	var answers []string
+
+	switch recordType {
+	case "A", "AAAA":
+		network := "ip4"
+		if recordType == "AAAA" {
+			network = "ip6"
+		}
+		ips, err := resolver.LookupIP(ctx, network, query)
+		if err != nil {
+			return nil, err
+		}
+		for _, ip := range ips {
+			answers = append(answers, ip.String())
+		}
+	case "CNAME":
+		cname, err := resolver.LookupCNAME(ctx, query)
+		if err != nil {
+			return nil, err
+		}
+		answers = append(answers, cname)
+	case "MX":
+		records, err := resolver.LookupMX(ctx, query)
+		if err != nil {
+			return nil, err
+		}
+		for _, mx := range records {
+			answers = append(answers, fmt.Sprintf("%d %s", mx.Pref, mx.Host))
+		}
+	case "TXT":
+		records, err := resolver.LookupTXT(ctx, query)
+		if err != nil {
+			return nil, err
+		}
+		answers = append(answers, records...)
+	default:
+		return nil, fmt.Errorf("unsupported record type %q", recordType)
+	}
+
+	return answers, nil
+}
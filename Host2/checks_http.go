@@ -0,0 +1,107 @@
+package main
+
+import (
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Response bodies larger than this are truncated before substring matching
+const HTTP_CHECK_MAX_BODY = 1024 * 1024
+
+type HTTPResult struct {
+	Name        string   `json:"name"`
+	URL         string   `json:"url"`
+	StatusCode  int      `json:"status_code"`
+	LatencyMs   float64  `json:"latency_ms"`
+	BodyMatched *bool    `json:"body_matched,omitempty"`
+	TLS         *TLSInfo `json:"tls,omitempty"`
+	Status      string   `json:"status"`
+	Error       string   `json:"error,omitempty"`
+}
+
+type TLSInfo struct {
+	Version         string `json:"version"`
+	CipherSuite     string `json:"cipher_suite"`
+	Subject         string `json:"subject"`
+	Issuer          string `json:"issuer"`
+	NotAfter        string `json:"not_after"`
+	DaysUntilExpiry int    `json:"days_until_expiry"`
+}
+
+func runHTTPCheck(target HTTPTarget) HTTPResult {
+	result := HTTPResult{Name: target.Name, URL: target.URL, Status: "error"}
+
+	client := &http.Client{
+		Timeout: time.Duration(target.TimeoutMs) * time.Millisecond,
+		Transport: &http.Transport{
+			TLSClientConfig:   &tls.Config{InsecureSkipVerify: target.InsecureSkipVerify},
+			DisableKeepAlives: true,
+		},
+	}
+	// A check expecting a redirect judges the redirect itself
+	if target.ExpectedStatus >= 300 && target.ExpectedStatus < 400 {
+		client.CheckRedirect = func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		}
+	}
+
+	req, err := http.NewRequest(target.Method, target.URL, nil)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+
+	start := time.Now()
+	resp, err := client.Do(req)
+	if err != nil {
+		result.LatencyMs = float64(time.Since(start).Microseconds()) / 1000
+		result.Error = err.Error()
+		return result
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, HTTP_CHECK_MAX_BODY))
+	result.LatencyMs = float64(time.Since(start).Microseconds()) / 1000
+	result.StatusCode = resp.StatusCode
+	if resp.TLS != nil {
+		result.TLS = tlsDetails(resp.TLS)
+	}
+	if err != nil {
+		result.Error = fmt.Sprintf("failed to read body: %v", err)
+		return result
+	}
+
+	result.Status = "ok"
+	if resp.StatusCode != target.ExpectedStatus {
+		result.Status = "down"
+		result.Error = fmt.Sprintf("expected status %d, got %d", target.ExpectedStatus, resp.StatusCode)
+	}
+	if target.ExpectedBody != "" {
+		matched := strings.Contains(string(body), target.ExpectedBody)
+		result.BodyMatched = &matched
+		if !matched && result.Status == "ok" {
+			result.Status = "down"
+			result.Error = "response body does not contain expected text"
+		}
+	}
+	return result
+}
+
+func tlsDetails(state *tls.ConnectionState) *TLSInfo {
+	info := &TLSInfo{
+		Version:     tls.VersionName(state.Version),
+		CipherSuite: tls.CipherSuiteName(state.CipherSuite),
+	}
+	if len(state.PeerCertificates) > 0 {
+		leaf := state.PeerCertificates[0]
+		info.Subject = leaf.Subject.CommonName
+		info.Issuer = leaf.Issuer.CommonName
+		info.NotAfter = leaf.NotAfter.UTC().Format("2006-01-02T15:04:05Z")
+		info.DaysUntilExpiry = int(time.Until(leaf.NotAfter).Hours() / 24)
+	}
+	return info
+}
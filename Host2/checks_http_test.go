@@ -0,0 +1,38 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRunHTTPCheckRedirects(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/old" {
+			http.Redirect(w, r, "/new", http.StatusMovedPermanently)
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name     string
+		path     string
+		expected int
+		code     int
+		status   string
+	}{
+		{name: "redirect expected", path: "/old", expected: 301, code: 301, status: "ok"},
+		{name: "redirect followed", path: "/old", expected: 200, code: 200, status: "ok"},
+		{name: "no redirect where one is expected", path: "/new", expected: 302, code: 200, status: "down"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := runHTTPCheck(HTTPTarget{Name: tt.name, URL: server.URL + tt.path, Method: "GET", ExpectedStatus: tt.expected, TimeoutMs: 2000})
+			if result.StatusCode != tt.code || result.Status != tt.status {
+				t.Errorf("got %d %s (%s), want %d %s", result.StatusCode, result.Status, result.Error, tt.code, tt.status)
+			}
+		})
+	}
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"encoding/json"
+	"path"
+	"strings"
+)
+
+// iscsiSessions lists the sessions of the Linux and Windows initiators;
+// other platforms have none to report.
+func iscsiSessions() []ISCSISession {
+	switch collectorOS {
+	case "linux":
+		return linuxISCSISessions()
+	case "windows":
+		return windowsISCSISessions()
+	}
+	return []ISCSISession{}
+}
+
+// linuxISCSISessions reads the open-iscsi sessions from sysfs.
+func linuxISCSISessions() []ISCSISession {
+	sessions := []ISCSISession{}
+	dirs, _ := hostFS.Glob("/sys/class/iscsi_session/session*")
+	for _, dir := range dirs {
+		session := ISCSISession{
+			Target: readTrimmed(path.Join(dir, "targetname")),
+			State:  readTrimmed(path.Join(dir, "state")),
+		}
+		// The connection of session N is connectionN:0
+		id := strings.TrimPrefix(path.Base(dir), "session")
+		session.Portal = readTrimmed(path.Join("/sys/class/iscsi_connection", "connection"+id+":0", "persistent_address"))
+		session.Status = "ok"
+		if session.State != "LOGGED_IN" {
+			session.Status = "critical"
+		}
+		sessions = append(sessions, session)
+	}
+	return sessions
+}
+
+// windowsISCSISessions lists sessions of the Microsoft iSCSI initiator.
+func windowsISCSISessions() []ISCSISession {
+	sessions := []ISCSISession{}
+	out, err := commands.Output("powershell", "-NoProfile", "-Command",
+		"ConvertTo-Json -Compress -InputObject @(Get-IscsiSession -ErrorAction SilentlyContinue | Select-Object TargetNodeAddress, InitiatorPortalAddress, IsConnected)")
+	if err != nil {
+		return sessions
+	}
+	var raw []struct {
+		TargetNodeAddress      string `json:"TargetNodeAddress"`
+		InitiatorPortalAddress string `json:"InitiatorPortalAddress"`
+		IsConnected            bool   `json:"IsConnected"`
+	}
+	if json.Unmarshal([]byte(strings.TrimSpace(string(out))), &raw) != nil {
+		return sessions
+	}
+	for _, s := range raw {
+		session := ISCSISession{Target: s.TargetNodeAddress, Portal: s.InitiatorPortalAddress, State: "disconnected", Status: "critical"}
+		if s.IsConnected {
+			session.State, session.Status = "connected", "ok"
+		}
+		sessions = append(sessions, session)
+	}
+	return sessions
+}
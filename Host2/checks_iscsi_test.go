@@ -0,0 +1,57 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestISCSISessions(t *testing.T) {
+	tests := []struct {
+		name    string
+		goos    string
+		files   map[string]string
+		outputs map[string]string
+		want    []ISCSISession
+	}{
+		{
+			name: "open-iscsi",
+			goos: "linux",
+			files: map[string]string{
+				"/sys/class/iscsi_session/session1/targetname":                 "iqn.2003-01.org.linux-iscsi.nas:data\n",
+				"/sys/class/iscsi_session/session1/state":                      "LOGGED_IN\n",
+				"/sys/class/iscsi_connection/connection1:0/persistent_address": "192.168.1.20\n",
+				"/sys/class/iscsi_session/session2/targetname":                 "iqn.2003-01.org.linux-iscsi.nas:backup\n",
+				"/sys/class/iscsi_session/session2/state":                      "FAILED\n",
+			},
+			want: []ISCSISession{
+				{Target: "iqn.2003-01.org.linux-iscsi.nas:data", Portal: "192.168.1.20", State: "LOGGED_IN", Status: "ok"},
+				{Target: "iqn.2003-01.org.linux-iscsi.nas:backup", State: "FAILED", Status: "critical"},
+			},
+		},
+		{
+			name: "Microsoft initiator",
+			goos: "windows",
+			outputs: map[string]string{
+				"powershell -NoProfile -Command ConvertTo-Json -Compress -InputObject @(Get-IscsiSession -ErrorAction SilentlyContinue | Select-Object TargetNodeAddress, InitiatorPortalAddress, IsConnected)": `[{"TargetNodeAddress":"iqn.1991-05.com.microsoft:san-data","InitiatorPortalAddress":"10.0.0.5","IsConnected":true},{"TargetNodeAddress":"iqn.1991-05.com.microsoft:san-logs","InitiatorPortalAddress":"10.0.0.5","IsConnected":false}]` + "\r\n",
+			},
+			want: []ISCSISession{
+				{Target: "iqn.1991-05.com.microsoft:san-data", Portal: "10.0.0.5", State: "connected", Status: "ok"},
+				{Target: "iqn.1991-05.com.microsoft:san-logs", Portal: "10.0.0.5", State: "disconnected", Status: "critical"},
+			},
+		},
+		{
+			name: "no initiator",
+			goos: "darwin",
+			want: []ISCSISession{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			withHost(t, &fakeRunner{outputs: tt.outputs}, newFakeFS(tt.files), nil)
+			withOS(t, tt.goos)
+			if got := iscsiSessions(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %+v\nwant %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"errors"
+	"net"
+	"os"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/shirou/gopsutil/v3/disk"
+)
+
+type MountResult struct {
+	Path            string  `json:"path"`
+	Fstype          string  `json:"fstype"`
+	Source          string  `json:"source"`
+	LatencyMs       float64 `json:"latency_ms"` // stat + statfs of the mount point
+	Server          string  `json:"server,omitempty"`
+	ServerReachable *bool   `json:"server_reachable,omitempty"`
+	ServerLatencyMs float64 `json:"server_latency_ms,omitempty"`
+	Status          string  `json:"status"` // "ok", "stale", "timeout", "unreachable" or "error"
+	Error           string  `json:"error,omitempty"`
+}
+
+type ISCSISession struct {
+	Target string `json:"target"`
+	Portal string `json:"portal"`
+	State  string `json:"state"`
+	Status string `json:"status"`
+}
+
+// Filesystem types probed by checks.mounts.auto, with the port their
+// server listens on
+var networkFilesystems = map[string]string{
+	"nfs": "2049", "nfs4": "2049",
+	"cifs": "445", "smb3": "445", "smbfs": "445",
+	"fuse.sshfs": "22", "glusterfs": "", "fuse.glusterfs": "", "ceph": "", "9p": "",
+}
+
+// mountTargets lists the mounts to probe: every network filesystem when
+// auto is set, plus the configured paths.
+func mountTargets(cfg MountChecksConfig) []disk.PartitionStat {
+	var targets []disk.PartitionStat
+	seen := make(map[string]bool)
+	partitions, _ := disk.Partitions(true)
+	for _, p := range partitions {
+		if _, network := networkFilesystems[p.Fstype]; cfg.Auto && network && !seen[p.Mountpoint] {
+			seen[p.Mountpoint] = true
+			targets = append(targets, p)
+		}
+	}
+	for _, path := range cfg.Paths {
+		if seen[path] {
+			continue
+		}
+		seen[path] = true
+		target := disk.PartitionStat{Mountpoint: path}
+		for _, p := range partitions {
+			if p.Mountpoint == path {
+				target = p
+			}
+		}
+		targets = append(targets, target)
+	}
+	return targets
+}
+
+// runMountCheck stats the mount point with a timeout, then checks whether
+// the server behind it still accepts connections.
+func runMountCheck(target disk.PartitionStat, timeout time.Duration) MountResult {
+	result := MountResult{Path: target.Mountpoint, Fstype: target.Fstype, Source: target.Device, Status: "ok"}
+
+	_, latency, err := boundedProbe("mount:"+target.Mountpoint, timeout, func() (interface{}, error) {
+		if _, err := os.Stat(target.Mountpoint); err != nil {
+			return nil, err
+		}
+		return disk.Usage(target.Mountpoint)
+	})
+	result.LatencyMs = float64(latency.Microseconds()) / 1000
+	if err != nil {
+		result.Error = err.Error()
+		switch {
+		case errors.Is(err, errProbeTimeout):
+			result.Status = "timeout"
+		case errors.Is(err, syscall.ESTALE):
+			result.Status = "stale"
+		case errors.Is(err, syscall.ENOTCONN), errors.Is(err, syscall.EHOSTDOWN), errors.Is(err, syscall.EHOSTUNREACH):
+			result.Status = "unreachable"
+		default:
+			result.Status = "error"
+		}
+	}
+
+	host := mountServer(target.Device)
+	port := networkFilesystems[target.Fstype]
+	if host == "" || port == "" {
+		return result
+	}
+	result.Server = host
+	start := time.Now()
+	conn, err := net.DialTimeout("tcp", net.JoinHostPort(host, port), timeout)
+	reachable := err == nil
+	result.ServerReachable = &reachable
+	if reachable {
+		conn.Close()
+		result.ServerLatencyMs = float64(time.Since(start).Microseconds()) / 1000
+	} else if result.Status == "ok" {
+		// The kernel may still serve cached data, but the server is gone
+		result.Status = "unreachable"
+		result.Error = err.Error()
+	}
+	return result
+}
+
+// mountServer extracts the host from "server:/export", "[v6]:/export",
+// "user@host:path" and "//server/share" style sources.
+func mountServer(source string) string {
+	if strings.HasPrefix(source, "//") || strings.HasPrefix(source, `\\`) {
+		rest := strings.TrimLeft(source, `/\`)
+		if i := strings.IndexAny(rest, `/\`); i >= 0 {
+			rest = rest[:i]
+		}
+		return rest
+	}
+	if strings.HasPrefix(source, "[") {
+		if i := strings.Index(source, "]"); i > 0 {
+			return source[1:i]
+		}
+	}
+	if i := strings.Index(source, ":"); i > 0 {
+		host := source[:i]
+		if at := strings.LastIndex(host, "@"); at >= 0 {
+			host = host[at+1:]
+		}
+		return host
+	}
+	return ""
+}
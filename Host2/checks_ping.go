@@ -0,0 +1,151 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+type PingResult struct {
+	Name              string  `json:"name"`
+	Host              string  `json:"host"`
+	Protocol          string  `json:"protocol"`
+	Port              int     `json:"port,omitempty"`
+	Sent              int     `json:"sent"`
+	Received          int     `json:"received"`
+	PacketLossPercent float64 `json:"packet_loss_percent"`
+	RTTMinMs          float64 `json:"rtt_min_ms"`
+	RTTAvgMs          float64 `json:"rtt_avg_ms"`
+	RTTMaxMs          float64 `json:"rtt_max_ms"`
+	Status            string  `json:"status"`
+	Error             string  `json:"error,omitempty"`
+}
+
+var (
+	// Linux/macOS: "3 packets transmitted, 3 received" / "3 packets received"
+	unixPingCountRe = regexp.MustCompile(`(\d+) packets transmitted, (\d+) (?:packets )?received`)
+	// Linux/macOS: "rtt min/avg/max/mdev = 0.045/0.050/0.056/0.004 ms"
+	unixPingRTTRe = regexp.MustCompile(`= ([\d.]+)/([\d.]+)/([\d.]+)/`)
+	// Windows: "Packets: Sent = 3, Received = 3, Lost = 0 (0% loss)"
+	winPingCountRe = regexp.MustCompile(`Sent = (\d+), Received = (\d+)`)
+	// Windows: "Minimum = 1ms, Maximum = 2ms, Average = 1ms"
+	winPingRTTRe = regexp.MustCompile(`Minimum = (\d+)ms, Maximum = (\d+)ms, Average = (\d+)ms`)
+)
+
+func runPingCheck(target PingTarget) PingResult {
+	result := PingResult{
+		Name:     target.Name,
+		Host:     target.Host,
+		Protocol: target.Protocol,
+		Port:     target.Port,
+		Sent:     target.Count,
+	}
+
+	if target.Protocol == "tcp" {
+		pingTCP(target, &result)
+	} else {
+		pingICMP(target, &result)
+	}
+
+	if result.Sent > 0 {
+		result.PacketLossPercent = float64(result.Sent-result.Received) / float64(result.Sent) * 100
+	}
+
+	switch {
+	case result.Error != "":
+		result.Status = "error"
+	case result.Received == 0:
+		result.Status = "down"
+	case result.Received < result.Sent:
+		result.Status = "degraded"
+	default:
+		result.Status = "ok"
+	}
+	return result
+}
+
+// pingTCP measures TCP connect latency, counting failed connects as lost packets.
+func pingTCP(target PingTarget, result *PingResult) {
+	address := net.JoinHostPort(target.Host, strconv.Itoa(target.Port))
+	timeout := time.Duration(target.TimeoutMs) * time.Millisecond
+
+	var rtts []float64
+	for i := 0; i < target.Count; i++ {
+		start := time.Now()
+		conn, err := net.DialTimeout("tcp", address, timeout)
+		if err != nil {
+			continue
+		}
+		rtts = append(rtts, float64(time.Since(start).Microseconds())/1000)
+		conn.Close()
+	}
+
+	result.Received = len(rtts)
+	if len(rtts) == 0 {
+		return
+	}
+
+	result.RTTMinMs, result.RTTMaxMs = math.MaxFloat64, 0
+	sum := 0.0
+	for _, rtt := range rtts {
+		sum += rtt
+		result.RTTMinMs = math.Min(result.RTTMinMs, rtt)
+		result.RTTMaxMs = math.Max(result.RTTMaxMs, rtt)
+	}
+	result.RTTAvgMs = sum / float64(len(rtts))
+}
+
+// pingICMP shells out to the system ping binary, which already holds the
+// privileges needed for raw ICMP sockets.
+func pingICMP(target PingTarget, result *PingResult) {
+	count := strconv.Itoa(target.Count)
+
+	var args []string
+	switch collectorOS {
+	case "windows":
+		args = []string{"-n", count, "-w", strconv.Itoa(target.TimeoutMs), target.Host}
+	case "linux":
+		timeoutSec := (target.TimeoutMs + 999) / 1000
+		args = []string{"-c", count, "-W", strconv.Itoa(timeoutSec), target.Host}
+	default:
+		// macOS/BSD take the per-packet wait in milliseconds
+		args = []string{"-c", count, "-W", strconv.Itoa(target.TimeoutMs), target.Host}
+	}
+
+	// ping exits non-zero when packets are lost, so parse the output regardless
+	output, err := commands.Output("ping", args...)
+	if len(output) == 0 {
+		if err == nil {
+			err = fmt.Errorf("no output from ping")
+		}
+		result.Error = err.Error()
+		return
+	}
+
+	text := string(output)
+	if collectorOS == "windows" {
+		if m := winPingCountRe.FindStringSubmatch(text); m != nil {
+			result.Sent, _ = strconv.Atoi(m[1])
+			result.Received, _ = strconv.Atoi(m[2])
+		}
+		if m := winPingRTTRe.FindStringSubmatch(text); m != nil {
+			result.RTTMinMs, _ = strconv.ParseFloat(m[1], 64)
+			result.RTTMaxMs, _ = strconv.ParseFloat(m[2], 64)
+			result.RTTAvgMs, _ = strconv.ParseFloat(m[3], 64)
+		}
+		return
+	}
+
+	if m := unixPingCountRe.FindStringSubmatch(text); m != nil {
+		result.Sent, _ = strconv.Atoi(m[1])
+		result.Received, _ = strconv.Atoi(m[2])
+	}
+	if m := unixPingRTTRe.FindStringSubmatch(text); m != nil {
+		result.RTTMinMs, _ = strconv.ParseFloat(m[1], 64)
+		result.RTTAvgMs, _ = strconv.ParseFloat(m[2], 64)
+		result.RTTMaxMs, _ = strconv.ParseFloat(m[3], 64)
+	}
+}
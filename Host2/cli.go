@@ -0,0 +1,157 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+)
+
+const usageText = `Usage: host-agent <command> [flags]
+
+Commands:
+  serve     Run the HTTP API and background collectors (default)
+  collect   Collect metrics once and print them as JSON
+  check     With a name (cpu, memory, disk, temperature or any
+            metric) run a Nagios/Icinga check:
+            check cpu --warn 80 --crit 95; without one, check-config
+  check-config
+            Validate the configuration and test the listen
+            addresses and every push target without serving
+  version   Print version information
+  install   Register the agent as a system service
+  top       Live terminal dashboard
+  netdata   Run as a Netdata external plugin
+  update    Install the latest signed release from update.url
+  record    Capture snapshots to a file: record --output run.jsonl.gz
+  replay    Serve recorded snapshots through the normal API:
+            replay --speed 10x run.jsonl.gz
+
+Run "host-agent <command> -h" for command flags.
+`
+
+func main() {
+	args := os.Args[1:]
+	command := "serve"
+	if len(args) > 0 && len(args[0]) > 0 && args[0][0] != '-' {
+		command, args = args[0], args[1:]
+	}
+
+	var err error
+	switch command {
+	case "serve":
+		err = serveCommand(args)
+	case "collect":
+		err = collectCommand(args)
+	case "check":
+		err = checkCommand(args)
+	case "check-config":
+		err = checkConfigCommand(args)
+	case "version":
+		info := buildInfo()
+		fmt.Printf("host-agent %s (%s/%s, %s)\n", info.Version, info.Platform, info.Arch, info.GoVersion)
+		if info.Commit != "" {
+			modified := ""
+			if info.Modified {
+				modified = " (modified)"
+			}
+			fmt.Printf("commit %s%s, built %s\n", info.Commit, modified, info.BuildDate)
+		}
+	case "install":
+		err = installCommand(args)
+	case "top":
+		err = topCommand(args)
+	case "netdata":
+		err = netdataCommand(args)
+	case "update":
+		err = updateCommand(args)
+	case "record":
+		err = recordCommand(args)
+	case "replay":
+		err = replayCommand(args)
+	case "help":
+		fmt.Print(usageText)
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown command %q\n\n%s", command, usageText)
+		os.Exit(2)
+	}
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// newFlagSet creates a subcommand flag set with the shared --config flag.
+func newFlagSet(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	fs.StringVar(&configPathOverride, "config", "", "config file (default $"+CONFIG_ENV_VAR+" or "+CONFIG_FILE+" next to the executable)")
+	return fs
+}
+
+func serveCommand(args []string) error {
+	fs := newFlagSet("serve")
+	fs.BoolVar(&readOnlyMode, "read-only", false, "disable /refresh, file writing and state-changing endpoints")
+	fs.BoolVar(&simulateMode, "simulate", false, "serve generated metrics instead of reading the OS")
+	fs.Parse(args)
+
+	serve()
+	return nil
+}
+
+// collectCommand takes a single sample and prints it, for cron jobs and
+// debugging without starting the server.
+func collectCommand(args []string) error {
+	fs := newFlagSet("collect")
+	output := fs.String("output", "", "write to this file instead of stdout")
+	compact := fs.Bool("compact", false, "print JSON on a single line")
+	format := fs.String("format", "native", "native or telegraf (for Telegraf's exec input)")
+	fs.BoolVar(&simulateMode, "simulate", false, "print a generated sample instead of reading the OS")
+	fs.Parse(args)
+	if *format != "native" && *format != "telegraf" {
+		return fmt.Errorf("unsupported format %q", *format)
+	}
+
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+	applyConfig(cfg)
+
+	metrics, err := collectMetrics(false)
+	if err != nil {
+		return err
+	}
+
+	var result interface{} = metrics
+	if *format == "telegraf" {
+		result = telegrafMetrics(metrics)
+	}
+
+	var data []byte
+	if *compact {
+		data, err = json.Marshal(result)
+	} else {
+		data, err = json.MarshalIndent(result, "", "  ")
+	}
+	if err != nil {
+		return fmt.Errorf("failed to marshal metrics: %v", err)
+	}
+	data = append(data, '\n')
+
+	if *output != "" {
+		return os.WriteFile(*output, data, 0644)
+	}
+	_, err = os.Stdout.Write(data)
+	return err
+}
+
+// checkCommand runs the Nagios-compatible check it is given a name for;
+// without one it is check-config.
+func checkCommand(args []string) error {
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		nagiosCheckCommand(args[0], args[1:])
+	}
+	return checkConfigCommand(args)
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"path"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Link-local metadata endpoint shared by AWS, GCP and Azure
+const METADATA_HOST = "http://169.254.169.254"
+
+// CloudInfo describes the cloud instance the agent runs on.
+type CloudInfo struct {
+	Provider     string            `json:"provider"` // "aws", "gcp" or "azure"
+	InstanceID   string            `json:"instance_id"`
+	InstanceType string            `json:"instance_type"`
+	Region       string            `json:"region"`
+	Zone         string            `json:"zone"`
+	Tags         map[string]string `json:"tags,omitempty"`
+}
+
+// Metadata is read once and kept until the cloud config changes; instance
+// properties do not change while the agent runs.
+var cloudCache = struct {
+	sync.Mutex
+	cfg  *CloudConfig
+	info *CloudInfo
+}{}
+
+// cloudInfo returns the instance metadata when cloud.enabled is set, or nil
+// when disabled or not running on a supported cloud.
+func cloudInfo() *CloudInfo {
+	cfg := currentConfig().Cloud
+	if !cfg.Enabled {
+		return nil
+	}
+
+	cloudCache.Lock()
+	defer cloudCache.Unlock()
+	if cloudCache.cfg != nil && *cloudCache.cfg == cfg {
+		return cloudCache.info
+	}
+	cloudCache.cfg = &cfg
+	cloudCache.info = detectCloud(cfg)
+	if cloudCache.info != nil {
+		log.Printf("[CLOUD] Detected %s instance %s (%s, %s)", cloudCache.info.Provider, cloudCache.info.InstanceID, cloudCache.info.InstanceType, cloudCache.info.Zone)
+	} else {
+		log.Printf("[CLOUD] No instance metadata service found")
+	}
+	return cloudCache.info
+}
+
+// detectCloud asks each provider's metadata service in parallel and keeps
+// the first answer.
+func detectCloud(cfg CloudConfig) *CloudInfo {
+	client := &http.Client{Timeout: time.Duration(cfg.TimeoutMs) * time.Millisecond}
+	probes := []func(*http.Client, bool) (*CloudInfo, error){awsMetadata, gcpMetadata, azureMetadata}
+
+	results := make(chan *CloudInfo, len(probes))
+	for _, probe := range probes {
+		go func(probe func(*http.Client, bool) (*CloudInfo, error)) {
+			info, err := probe(client, cfg.Tags)
+			if err != nil {
+				info = nil
+			}
+			results <- info
+		}(probe)
+	}
+	var found *CloudInfo
+	for range probes {
+		if info := <-results; info != nil && found == nil {
+			found = info
+		}
+	}
+	return found
+}
+
+func metadataGet(client *http.Client, url string, headers map[string]string) ([]byte, error) {
+	return metadataRequest(client, http.MethodGet, url, headers)
+}
+
+func metadataRequest(client *http.Client, method, url string, headers map[string]string) ([]byte, error) {
+	req, err := http.NewRequest(method, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return body, nil
+}
+
+// awsMetadata uses IMDSv2. Tags are only available when the instance has
+// "allow tags in metadata" enabled.
+func awsMetadata(client *http.Client, withTags bool) (*CloudInfo, error) {
+	token, err := metadataRequest(client, http.MethodPut, METADATA_HOST+"/latest/api/token",
+		map[string]string{"X-aws-ec2-metadata-token-ttl-seconds": "60"})
+	if err != nil {
+		return nil, err
+	}
+	headers := map[string]string{"X-aws-ec2-metadata-token": string(token)}
+
+	body, err := metadataGet(client, METADATA_HOST+"/latest/dynamic/instance-identity/document", headers)
+	if err != nil {
+		return nil, err
+	}
+	var doc struct {
+		InstanceID       string `json:"instanceId"`
+		InstanceType     string `json:"instanceType"`
+		Region           string `json:"region"`
+		AvailabilityZone string `json:"availabilityZone"`
+	}
+	if err := json.Unmarshal(body, &doc); err != nil || doc.InstanceID == "" {
+		return nil, fmt.Errorf("invalid identity document")
+	}
+	info := &CloudInfo{Provider: "aws", InstanceID: doc.InstanceID, InstanceType: doc.InstanceType, Region: doc.Region, Zone: doc.AvailabilityZone}
+
+	if withTags {
+		if keys, err := metadataGet(client, METADATA_HOST+"/latest/meta-data/tags/instance", headers); err == nil {
+			info.Tags = map[string]string{}
+			for _, key := range strings.Fields(string(keys)) {
+				if value, err := metadataGet(client, METADATA_HOST+"/latest/meta-data/tags/instance/"+key, headers); err == nil {
+					info.Tags[key] = string(value)
+				}
+			}
+		}
+	}
+	return info, nil
+}
+
+// gcpMetadata reads the instance document; GCP reports machine type and
+// zone as resource paths. Tags are the instance labels.
+func gcpMetadata(client *http.Client, withTags bool) (*CloudInfo, error) {
+	body, err := metadataGet(client, METADATA_HOST+"/computeMetadata/v1/instance/?recursive=true",
+		map[string]string{"Metadata-Flavor": "Google"})
+	if err != nil {
+		return nil, err
+	}
+	var doc struct {
+		ID          json.Number       `json:"id"`
+		MachineType string            `json:"machineType"`
+		Zone        string            `json:"zone"`
+		Labels      map[string]string `json:"labels"`
+	}
+	if err := json.Unmarshal(body, &doc); err != nil || doc.ID == "" {
+		return nil, fmt.Errorf("invalid instance document")
+	}
+	zone := path.Base(doc.Zone)
+	region := zone
+	if i := strings.LastIndex(zone, "-"); i > 0 {
+		region = zone[:i]
+	}
+	info := &CloudInfo{Provider: "gcp", InstanceID: doc.ID.String(), InstanceType: path.Base(doc.MachineType), Region: region, Zone: zone}
+	if withTags {
+		info.Tags = doc.Labels
+	}
+	return info, nil
+}
+
+func azureMetadata(client *http.Client, withTags bool) (*CloudInfo, error) {
+	body, err := metadataGet(client, METADATA_HOST+"/metadata/instance/compute?api-version=2021-02-01",
+		map[string]string{"Metadata": "true"})
+	if err != nil {
+		return nil, err
+	}
+	var doc struct {
+		VMID     string `json:"vmId"`
+		VMSize   string `json:"vmSize"`
+		Location string `json:"location"`
+		Zone     string `json:"zone"`
+		TagsList []struct {
+			Name  string `json:"name"`
+			Value string `json:"value"`
+		} `json:"tagsList"`
+	}
+	if err := json.Unmarshal(body, &doc); err != nil || doc.VMID == "" {
+		return nil, fmt.Errorf("invalid instance document")
+	}
+	info := &CloudInfo{Provider: "azure", InstanceID: doc.VMID, InstanceType: doc.VMSize, Region: doc.Location, Zone: doc.Zone}
+	if withTags {
+		info.Tags = map[string]string{}
+		for _, tag := range doc.TagsList {
+			info.Tags[tag.Name] = tag.Value
+		}
+	}
+	return info, nil
+}
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// CollectorStatus explains a section's values: how they were obtained or,
+// when collection failed, why, so a zero can be told from a failure.
+type CollectorStatus struct {
+	// "ok", "error", "unavailable", "initializing", "degraded", "disabled"
+	// or "not_applicable"; threshold levels are in the section itself
+	Status      string `json:"status"`
+	Method      string `json:"method,omitempty"` // e.g. "lm-sensors", "hwmon", "nvidia-smi"
+	Error       string `json:"error,omitempty"`
+	LastSuccess string `json:"last_success,omitempty"`
+}
+
+// sectionTrace records, during one collection of a section, the method that
+// produced its values and the ones that were tried without result.
+type sectionTrace struct {
+	method   string
+	failures []string
+}
+
+// ok records the method that produced the section's values.
+func (t *sectionTrace) ok(method string) {
+	if t != nil {
+		t.method = method
+	}
+}
+
+// fail records a method that was tried without result.
+func (t *sectionTrace) fail(method string, err error) {
+	if t == nil {
+		return
+	}
+	message := describeCollectorError(err)
+	if !strings.HasPrefix(message, method+" ") {
+		message = method + ": " + message
+	}
+	t.failures = append(t.failures, message)
+}
+
+func (t *sectionTrace) err() string {
+	if t == nil {
+		return ""
+	}
+	return strings.Join(t.failures, "; ")
+}
+
+// errNoReading is recorded for methods that ran but produced no usable value.
+var errNoReading = errors.New("no usable reading")
+
+// orNoReading is err, or errNoReading when the method ran without error.
+func orNoReading(err error) error {
+	if err == nil {
+		return errNoReading
+	}
+	return err
+}
+
+// describeCollectorError turns exec and file errors into the short form
+// dashboards show, e.g. "sensors binary not found".
+func describeCollectorError(err error) string {
+	var execErr *exec.Error
+	if errors.As(err, &execErr) && errors.Is(execErr.Err, exec.ErrNotFound) {
+		return execErr.Name + " binary not found"
+	}
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		if stderr := strings.TrimSpace(string(exitErr.Stderr)); stderr != "" {
+			return fmt.Sprintf("%v: %s", err, strings.SplitN(stderr, "\n", 2)[0])
+		}
+	}
+	return err.Error()
+}
+
+// trace returns the trace for a section in this collection.
+func (p *sectionPlan) trace(name string) *sectionTrace {
+	if p.traces == nil {
+		p.traces = make(map[string]*sectionTrace)
+	}
+	if p.traces[name] == nil {
+		p.traces[name] = &sectionTrace{}
+	}
+	return p.traces[name]
+}
+
+// sectionCollectorState is the collection state of a section as its own
+// status field reports it; "" for sections without one.
+func sectionCollectorState(metrics *SystemMetrics, name string) string {
+	var status string
+	switch name {
+	case "cpu":
+		status = metrics.CPU.Status
+	case "memory":
+		status = metrics.Memory.Status
+	case "temperature":
+		status = metrics.Temperature.Status
+	case "gpu":
+		status = metrics.GPU.Status
+	case "kernel":
+		status = metrics.Kernel.Status
+	case "event_log":
+		status = metrics.EventLog.Status
+	case "kernel_log":
+		status = metrics.KernelLog.Status
+	case "hyperv":
+		status = metrics.HyperV.Status
+	case "zfs":
+		status = metrics.ZFS.Status
+	case "raid":
+		status = metrics.RAID.Status
+	case "sockets":
+		status = metrics.Sockets.Status
+	case "security":
+		status = metrics.Security.Status
+	case "updates":
+		status = metrics.Updates.Status
+	case "users":
+		status = metrics.Users.Status
+	case "cgroups":
+		status = metrics.Cgroups.Status
+	case "numa":
+		status = metrics.NUMA.Status
+	case "hugepages":
+		status = metrics.Hugepages.Status
+	case "entropy":
+		status = metrics.Entropy.Status
+	case "limits":
+		status = metrics.Limits.Status
+	case "disk_io":
+		status = metrics.DiskIO.Status
+	case "quotas":
+		status = metrics.Quotas.Status
+	}
+	if _, derived := statusRank[status]; derived {
+		return "ok"
+	}
+	return status
+}
+
+// collectorStatuses builds the per-section report. Sections carried over
+// from the previous snapshot keep their previous report; lastSuccess is
+// updated for sections collected successfully now.
+func (p *sectionPlan) collectorStatuses(metrics *SystemMetrics, lastSuccess map[string]time.Time) map[string]CollectorStatus {
+	statuses := make(map[string]CollectorStatus, len(sampledSections))
+	for _, name := range sampledSections {
+		state := sectionCollectorState(metrics, name)
+		if state == "disabled" || state == "not_applicable" {
+			statuses[name] = CollectorStatus{Status: state}
+			continue
+		}
+		if at, ok := p.collected[name]; !ok || !at.Equal(p.now) {
+			if p.prev != nil {
+				if prev, ok := p.prev.Collectors[name]; ok {
+					statuses[name] = prev
+					continue
+				}
+			}
+		}
+
+		trace := p.traces[name]
+		status := CollectorStatus{Status: state}
+		if trace != nil {
+			status.Method = trace.method
+			if trace.method == "" {
+				status.Error = trace.err()
+			}
+		}
+		switch {
+		case status.Error != "" && (state == "" || state == "ok"):
+			status.Status = "error"
+		case state == "":
+			status.Status = "ok"
+		}
+		if status.Status != "ok" && status.Error == "" {
+			status.Error = defaultCollectorError(name, status.Status)
+		}
+
+		if status.Status == "ok" {
+			lastSuccess[name] = p.now
+		}
+		if at, ok := lastSuccess[name]; ok {
+			status.LastSuccess = at.Format("2006-01-02T15:04:05Z")
+		}
+		statuses[name] = status
+	}
+	return statuses
+}
+
+// defaultCollectorError explains a failed state for collectors that do not
+// trace their methods.
+func defaultCollectorError(name, state string) string {
+	switch {
+	case !collectorSupported(name):
+		return "not supported on " + runtime.GOOS
+	case state == "degraded":
+		for _, c := range probeCapabilities() {
+			if c.Collector == name {
+				return c.Reason
+			}
+		}
+	case state == "initializing":
+		return "waiting for a second sample to compute rates"
+	case state == "unavailable":
+		return "no data source found on this host"
+	}
+	return ""
+}
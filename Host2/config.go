@@ -0,0 +1,1738 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"path"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const (
+	CONFIG_FILE    = "agent_config.json"
+	CONFIG_ENV_VAR = "HOST_AGENT_CONFIG"
+)
+
+// AgentConfig holds optional settings loaded from agent_config.json.
+// Every section has usable defaults so the agent runs without a config file.
+type AgentConfig struct {
+	IntervalSeconds int                `json:"interval_seconds"` // periodic collection and file write
+	Collectors      map[string]bool    `json:"collectors"`       // set a collector to false to disable it
+	Checks          ChecksConfig       `json:"checks"`
+	LogWatch        LogWatchSettings   `json:"log_watch"`
+	DirWatch        DirWatchSettings   `json:"dir_watch"`
+	History         HistoryConfig      `json:"history"`
+	SnapshotLog     SnapshotLogConfig  `json:"snapshot_log"`
+	Forecast        ForecastConfig     `json:"forecast"`
+	Alerts          AlertsConfig       `json:"alerts"`
+	Anomaly         AnomalyConfig      `json:"anomaly"`
+	Adaptive        AdaptiveConfig     `json:"adaptive"`
+	Schedule        ScheduleConfig     `json:"schedule"`
+	Spool           SpoolConfig        `json:"spool"`
+	Identity        IdentityConfig     `json:"identity"`
+	Uptime          UptimeConfig       `json:"uptime"`
+	Cloud           CloudConfig        `json:"cloud"`
+	Connectivity    ConnectivityConfig `json:"connectivity"`
+	Processes       ProcessesConfig    `json:"processes"`
+	WasmPlugins     WasmPluginsConfig  `json:"wasm_plugins"`
+	SNMP            SNMPConfig         `json:"snmp"`
+	Registration    RegistrationConfig `json:"registration"`
+	Gossip          GossipConfig       `json:"gossip"`
+	Tunnel          TunnelConfig       `json:"tunnel"`
+	Update          UpdateConfig       `json:"update"`
+	Temperature     TemperatureConfig  `json:"temperature"`
+	Inventory       InventoryConfig    `json:"inventory"`
+	Users           UsersConfig        `json:"users"`
+	Cgroups         CgroupsConfig      `json:"cgroups"`
+	Entropy         EntropyConfig      `json:"entropy"`
+	Quotas          QuotasConfig       `json:"quotas"`
+
+	CollectorIntervals map[string]int        `json:"collector_intervals"` // per-section seconds, default every collection
+	DiskTimeoutMs      int                   `json:"disk_timeout_ms"`     // per-mount usage call, default 2000
+	Exec               []ExecPluginConfig    `json:"exec"`                // custom metric commands
+	FileMetrics        []FileMetricConfig    `json:"file_metrics"`        // numbers read from sysfs/procfs files
+	Labels             map[string]string     `json:"labels"`              // static labels on every snapshot, alert and sink
+	MaintenanceWindows []MaintenanceWindow   `json:"maintenance_windows"`
+	Notifiers          []NotifierConfig      `json:"notifiers"`
+	OutputFormats      []string              `json:"output_formats"`  // metrics files: "json" (go_latest.json) and/or "protobuf" (go_latest.pb), default json
+	PerfCounters       []PerfCounterConfig   `json:"perf_counters"`   // Windows PDH counter paths
+	ProcessWatch       []ProcessWatchConfig  `json:"process_watch"`   // processes that must be running
+	ScheduledTasks     []ScheduledTaskConfig `json:"scheduled_tasks"` // timers, anacron jobs and Windows tasks that must succeed
+	SNMPDevices        []SNMPDeviceConfig    `json:"snmp_devices"`    // switches, routers, UPSes to poll
+	Sinks              []SinkConfig          `json:"sinks"`
+	Thresholds         ThresholdsConfig      `json:"thresholds"`
+	API                APIConfig             `json:"api"`
+}
+
+type ChecksConfig struct {
+	IntervalSeconds int               `json:"interval_seconds"`
+	Ping            []PingTarget      `json:"ping"`
+	HTTP            []HTTPTarget      `json:"http"`
+	DNS             []DNSTarget       `json:"dns"`
+	Apps            []AppTarget       `json:"apps"`
+	Mounts          MountChecksConfig `json:"mounts"`
+}
+
+// MountChecksConfig probes network filesystems for hung, stale or
+// unreachable mounts.
+type MountChecksConfig struct {
+	Auto      bool     `json:"auto"`       // every NFS/SMB/other network mount
+	Paths     []string `json:"paths"`      // additional mount points
+	ISCSI     bool     `json:"iscsi"`      // report iSCSI session state
+	TimeoutMs int      `json:"timeout_ms"` // default 2000
+}
+
+type PingTarget struct {
+	Name      string `json:"name"`
+	Host      string `json:"host"`
+	Protocol  string `json:"protocol"` // "icmp" (default) or "tcp"
+	Port      int    `json:"port"`
+	Count     int    `json:"count"`
+	TimeoutMs int    `json:"timeout_ms"`
+}
+
+type HTTPTarget struct {
+	Name               string `json:"name"`
+	URL                string `json:"url"`
+	Method             string `json:"method"`
+	ExpectedStatus     int    `json:"expected_status"`
+	ExpectedBody       string `json:"expected_body"` // substring the response must contain
+	TimeoutMs          int    `json:"timeout_ms"`
+	InsecureSkipVerify bool   `json:"insecure_skip_verify"`
+}
+
+// AppTarget checks an application by its pidfile, a local port, or both.
+type AppTarget struct {
+	Name      string `json:"name"`
+	PIDFile   string `json:"pid_file"`
+	Port      int    `json:"port"`
+	Host      string `json:"host"`       // default 127.0.0.1
+	Severity  string `json:"severity"`   // default critical
+	TimeoutMs int    `json:"timeout_ms"` // port connect, default 1000
+}
+
+type DNSTarget struct {
+	Name      string `json:"name"`
+	Query     string `json:"query"`
+	Type      string `json:"type"`     // A (default), AAAA, CNAME, MX or TXT
+	Resolver  string `json:"resolver"` // host:port, empty for the system resolver
+	TimeoutMs int    `json:"timeout_ms"`
+}
+
+type LogWatchSettings struct {
+	IntervalSeconds int              `json:"interval_seconds"`
+	Files           []LogWatchConfig `json:"files"`
+}
+
+type LogWatchConfig struct {
+	Name     string             `json:"name"`
+	Path     string             `json:"path"`
+	Patterns []LogPatternConfig `json:"patterns"`
+}
+
+type LogPatternConfig struct {
+	Name           string `json:"name"`
+	Regex          string `json:"regex"`
+	AlertThreshold int    `json:"alert_threshold"` // matches per interval; 0 disables alerting
+	Severity       string `json:"severity"`
+}
+
+// ExecPluginConfig runs a command whose output is merged into the
+// snapshot under custom.<name>.
+type ExecPluginConfig struct {
+	Name            string            `json:"name"`
+	Command         []string          `json:"command"`          // program and arguments, no shell
+	Format          string            `json:"format"`           // "json", "keyvalue" or empty to detect
+	IntervalSeconds int               `json:"interval_seconds"` // default 60
+	TimeoutMs       int               `json:"timeout_ms"`       // default 10000
+	Env             map[string]string `json:"env"`              // added to a minimal environment
+	Dir             string            `json:"dir"`              // working directory
+	User            string            `json:"user"`             // run as this user (Unix, agent must be root)
+	Daemon          bool              `json:"daemon"`           // long-running, speaks the stdio plugin protocol
+}
+
+// WasmPluginsConfig runs every .wasm file in Dir as a WASI command in the
+// built-in runtime; what it prints is merged under custom.<file name>
+// like exec plugin output. Modules get no filesystem, network or
+// environment.
+type WasmPluginsConfig struct {
+	Dir             string `json:"dir"`              // rescanned every interval, empty disables
+	Format          string `json:"format"`           // "json", "keyvalue" or empty to detect
+	IntervalSeconds int    `json:"interval_seconds"` // default 60
+	TimeoutMs       int    `json:"timeout_ms"`       // per run, default 10000
+	MaxMemoryMB     int    `json:"max_memory_mb"`    // linear memory per module, default 64
+}
+
+// FileMetricConfig exposes a number read from a file as a metric.
+type FileMetricConfig struct {
+	Name  string  `json:"name"`  // metric name
+	Path  string  `json:"path"`  // may be a glob, one series per file
+	Key   string  `json:"key"`   // read the line starting with this word
+	Field int     `json:"field"` // whitespace-separated field, after key if set
+	Scale float64 `json:"scale"` // multiplier, default 1
+}
+
+// SNMPDeviceConfig polls a network device over SNMP v1/v2c.
+type SNMPDeviceConfig struct {
+	Name            string          `json:"name"`
+	Host            string          `json:"host"`
+	Port            int             `json:"port"`             // default 161
+	Version         string          `json:"version"`          // "1" or "2c" (default)
+	Community       string          `json:"community"`        // default "public"
+	Interfaces      bool            `json:"interfaces"`       // read the interface table
+	OIDs            []SNMPOIDConfig `json:"oids"`             // sensors and other numbers
+	IntervalSeconds int             `json:"interval_seconds"` // default 60
+	TimeoutMs       int             `json:"timeout_ms"`       // per request, default 2000
+	Retries         int             `json:"retries"`          // resends after a timeout, default 1
+	Severity        string          `json:"severity"`         // unreachable alert, default warning
+}
+
+// SNMPOIDConfig reads one OID from a device as a metric.
+type SNMPOIDConfig struct {
+	Name  string  `json:"name"`  // metric name
+	OID   string  `json:"oid"`   // numeric, e.g. 1.3.6.1.2.1.33.1.2.4.0
+	Scale float64 `json:"scale"` // multiplier, default 1
+}
+
+// PerfCounterConfig exposes a Windows performance counter as a metric.
+type PerfCounterConfig struct {
+	Name  string  `json:"name"`  // metric name
+	Path  string  `json:"path"`  // English counter path, may use (*) for all instances
+	Scale float64 `json:"scale"` // multiplier, default 1
+}
+
+// ProcessWatchConfig names a process that must be running.
+type ProcessWatchConfig struct {
+	Name     string `json:"name"`
+	Pattern  string `json:"pattern"`   // regexp on the process name, default the exact name
+	Cmdline  bool   `json:"cmdline"`   // match the full command line instead
+	MinCount int    `json:"min_count"` // default 1
+	Severity string `json:"severity"`  // of the missing alert, default critical
+}
+
+// ScheduledTaskConfig names a scheduled job whose last run must have
+// succeeded. Exactly one of unit, anacron and task is set.
+type ScheduledTaskConfig struct {
+	Name        string  `json:"name"`
+	Unit        string  `json:"unit"`          // systemd timer or service, e.g. "backup.timer"
+	Anacron     string  `json:"anacron"`       // anacron job identifier, e.g. "cron.daily"
+	Task        string  `json:"task"`          // Windows task path, e.g. "\\Backup\\Nightly"
+	MaxAgeHours float64 `json:"max_age_hours"` // alert when the last run is older, 0 disables
+	Severity    string  `json:"severity"`      // of the alert, default critical
+}
+
+type DirWatchSettings struct {
+	IntervalSeconds int              `json:"interval_seconds"`
+	Directories     []DirWatchConfig `json:"directories"`
+}
+
+type DirWatchConfig struct {
+	Name        string  `json:"name"`
+	Path        string  `json:"path"`
+	AlertSizeMB float64 `json:"alert_size_mb"` // 0 disables alerting
+}
+
+type HistoryConfig struct {
+	RetentionHours int            `json:"retention_hours"` // raw samples
+	Rollups        []RollupConfig `json:"rollups"`
+}
+
+// RollupConfig keeps avg/min/max aggregates at one resolution.
+type RollupConfig struct {
+	Resolution     string `json:"resolution"` // "1m", "5m" or "1h"
+	RetentionHours int    `json:"retention_hours"`
+}
+
+// SnapshotLogConfig enables the NDJSON snapshot log. Rotation happens when
+// either limit is reached; 0 disables that limit.
+type SnapshotLogConfig struct {
+	Path        string  `json:"path"`          // empty disables the log
+	MaxSizeMB   float64 `json:"max_size_mb"`   // default 100
+	MaxAgeHours float64 `json:"max_age_hours"` // default 24
+	Keep        int     `json:"keep"`          // rotated files to keep, default 7
+	Compress    bool    `json:"compress"`      // gzip rotated files
+}
+
+// ForecastConfig controls the disk-full estimate computed from history.
+type ForecastConfig struct {
+	Model       string `json:"model"` // "linear" (default) or "exponential"
+	WindowHours int    `json:"window_hours"`
+	MinSamples  int    `json:"min_samples"`
+}
+
+type AlertsConfig struct {
+	Rules []AlertRule `json:"rules"`
+}
+
+type AlertRule struct {
+	Name     string  `json:"name"`
+	Type     string  `json:"type"`     // "disk_fill" or "threshold"
+	Days     float64 `json:"days"`     // disk_fill: alert when full within this many days
+	Device   string  `json:"device"`   // disk_fill: limit to one mountpoint
+	Metric   string  `json:"metric"`   // threshold: history metric name, e.g. cpu_usage_percent
+	Operator string  `json:"operator"` // threshold: >, >=, < or <=
+	Value    float64 `json:"value"`    // threshold: limit compared against the metric
+	Severity string  `json:"severity"`
+}
+
+// AnomalyConfig enables z-score detection against a rolling baseline for
+// the listed history metric names.
+type AnomalyConfig struct {
+	Enabled       bool     `json:"enabled"`
+	Metrics       []string `json:"metrics"`
+	Sigma         float64  `json:"sigma"`
+	WindowSamples int      `json:"window_samples"`
+	MinSamples    int      `json:"min_samples"`
+}
+
+// IdentityConfig controls how the agent identifies itself downstream.
+type IdentityConfig struct {
+	Hostname string `json:"hostname"` // reported instead of the OS hostname
+	IDFile   string `json:"id_file"`  // default agent_identity.json next to the executable
+}
+
+// UptimeConfig controls reboot tracking and the availability windows.
+type UptimeConfig struct {
+	StateFile   string `json:"state_file"`   // default agent_uptime.json next to the executable
+	WindowsDays []int  `json:"windows_days"` // default 1, 7 and 30
+}
+
+// CloudConfig enables instance metadata lookups on AWS, GCP and Azure.
+type CloudConfig struct {
+	Enabled   bool `json:"enabled"`
+	Tags      bool `json:"tags"`       // also read instance tags/labels
+	TimeoutMs int  `json:"timeout_ms"` // per metadata request, default 1000
+}
+
+// ConnectivityConfig enables default gateway, DNS server and public IP
+// reporting.
+type ConnectivityConfig struct {
+	Enabled                 bool   `json:"enabled"`
+	PublicIP                bool   `json:"public_ip"`                  // also look up the public address
+	PublicIPURL             string `json:"public_ip_url"`              // answers with the address as plain text
+	PublicIPIntervalSeconds int    `json:"public_ip_interval_seconds"` // default 3600
+	TimeoutMs               int    `json:"timeout_ms"`                 // default 3000
+}
+
+// ProcessesConfig adds eBPF attribution to the /processes endpoint. It needs
+// Linux 5.4 or later with kprobes and kernel BTF, and root or CAP_BPF plus
+// CAP_PERFMON; otherwise the extra fields are left out.
+type ProcessesConfig struct {
+	EBPF bool `json:"ebpf"` // per-process network and block I/O rates from kprobes
+}
+
+// SNMPConfig exposes the latest snapshot to SNMP pollers, read-only.
+type SNMPConfig struct {
+	Enabled   bool     `json:"enabled"`
+	Listen    string   `json:"listen"`    // UDP address, default ":1161"
+	Community string   `json:"community"` // v1/v2c community, default "public"
+	BaseOID   string   `json:"base_oid"`  // subtree for the agent's objects
+	Allow     []string `json:"allow"`     // client IPs/CIDRs; empty allows everyone
+
+	baseOID   oid
+	allowNets []*net.IPNet
+}
+
+// ScheduleConfig spreads and aligns periodic collections across a fleet.
+type ScheduleConfig struct {
+	JitterSeconds int  `json:"jitter_seconds"` // random per-agent offset, 0 disables
+	Align         bool `json:"align"`          // collect on wall-clock multiples of the interval
+}
+
+// AdaptiveConfig tightens the periodic interval while a watch condition
+// holds. Without watch conditions a non-ok health triggers it.
+type AdaptiveConfig struct {
+	Enabled             bool             `json:"enabled"`
+	FastIntervalSeconds int              `json:"fast_interval_seconds"` // default 5
+	CalmSamples         int              `json:"calm_samples"`          // calm samples before relaxing, default 12
+	Watch               []WatchCondition `json:"watch"`
+}
+
+// WatchCondition compares a history metric against a value.
+type WatchCondition struct {
+	Metric   string  `json:"metric"`
+	Operator string  `json:"operator"` // >, >=, < or <=
+	Value    float64 `json:"value"`
+}
+
+// MaintenanceWindow is a recurring local-time period during which
+// notifications for matching alerts are suppressed.
+type MaintenanceWindow struct {
+	Name  string   `json:"name"`
+	Match string   `json:"match"` // glob on alert IDs (* matches anything), default "*"
+	Days  []string `json:"days"`  // mon..sun, empty for every day
+	Start string   `json:"start"` // HH:MM
+	End   string   `json:"end"`   // HH:MM, may be earlier than start to wrap midnight
+}
+
+// NotifierConfig configures one alert receiver. Fields not used by the
+// notifier type are ignored.
+type NotifierConfig struct {
+	Type         string            `json:"type"` // "pagerduty", "opsgenie", "telegram" or "webhook"
+	Name         string            `json:"name"`
+	URL          string            `json:"url"`           // API base/endpoint override; webhook target
+	RoutingKey   string            `json:"routing_key"`   // pagerduty
+	APIKey       string            `json:"api_key"`       // opsgenie
+	BotToken     string            `json:"bot_token"`     // telegram
+	ChatID       string            `json:"chat_id"`       // telegram
+	Commands     bool              `json:"commands"`      // telegram: answer /status and /top from ChatID
+	Headers      map[string]string `json:"headers"`       // webhook
+	BodyTemplate string            `json:"body_template"` // webhook: Go text/template over the alert event
+}
+
+// RegistrationConfig announces the agent to a central fleet server.
+type RegistrationConfig struct {
+	URL             string            `json:"url"`              // register and heartbeat POSTs, empty disables
+	IntervalSeconds int               `json:"interval_seconds"` // heartbeat interval, default 60
+	Headers         map[string]string `json:"headers"`
+	AdvertiseURL    string            `json:"advertise_url"` // API base URL the server should use to reach the agent
+}
+
+// GossipConfig lets agents discover each other without a central server.
+type GossipConfig struct {
+	Enabled         bool     `json:"enabled"`
+	Listen          string   `json:"listen"`           // UDP address, default ":7946"
+	Seeds           []string `json:"seeds"`            // host[:port] of any existing members
+	Advertise       string   `json:"advertise"`        // gossip address peers should use, default the packet source
+	APIURL          string   `json:"api_url"`          // API base URL peers should use, default http://<source>:<api port>
+	Secret          string   `json:"secret"`           // shared HMAC key; members without it are ignored
+	APIKey          string   `json:"api_key"`          // sent to peers by /fleet/metrics and /fleet/proxy; use a read key
+	IntervalSeconds int      `json:"interval_seconds"` // default 1
+	SuspectSeconds  int      `json:"suspect_seconds"`  // default 5
+	DeadSeconds     int      `json:"dead_seconds"`     // default 30
+}
+
+// TunnelConfig makes the agent dial out to an aggregator that then queries
+// it, for hosts behind NAT.
+type TunnelConfig struct {
+	URL         string            `json:"url"` // ws:// or wss:// aggregator endpoint, empty disables
+	Headers     map[string]string `json:"headers"`
+	PingSeconds int               `json:"ping_seconds"` // keepalive, default 30
+}
+
+// UpdateConfig points the agent at a signed release channel for
+// "host-agent update" and, with auto, unattended updates.
+type UpdateConfig struct {
+	URL                string `json:"url"`                  // release manifest of the channel to follow
+	PublicKey          string `json:"public_key"`           // Ed25519 key of the manifest signature, PEM or base64
+	Auto               bool   `json:"auto"`                 // install new releases while serving
+	IntervalHours      int    `json:"interval_hours"`       // between automatic checks, default 24
+	HealthCheckSeconds int    `json:"health_check_seconds"` // a new binary must be healthy this long after start, default 60
+
+	publicKey ed25519.PublicKey
+}
+
+// TemperatureConfig selects where the CPU temperature is read from.
+type TemperatureConfig struct {
+	Source       string `json:"source"`        // "auto" (default), a source such as "hwmon" or "lm-sensors", or a group ("wmi", "hwmon", "external")
+	Force        bool   `json:"force"`         // use only source instead of trying it first
+	RetrySeconds int    `json:"retry_seconds"` // before a failed program-based source is run again, default 600
+
+	// Degrees Celsius added to readings of boards that read high or low,
+	// by "cpu", a CPU source such as "hwmon", "gpu", or a drive ("/dev/sda" or "sda")
+	Offsets    map[string]float64 `json:"offsets"`
+	Fahrenheit bool               `json:"fahrenheit"` // also report each reading in Fahrenheit
+
+	// LibreHardwareMonitor's web server, e.g. http://127.0.0.1:8085/data.json,
+	// instead of its WMI namespace
+	LHMURL string `json:"lhm_url"`
+}
+
+// UsersConfig sizes the per-user usage summary (collectors.users).
+type UsersConfig struct {
+	Top int `json:"top"` // users reported, busiest first, default 10
+}
+
+// CgroupsConfig sets how deep the cgroup breakdown goes (collectors.cgroups).
+type CgroupsConfig struct {
+	Depth int `json:"depth"` // levels below the root, default 2 (slices and their services)
+}
+
+// EntropyConfig sets when the entropy pool counts as low (collectors.entropy).
+type EntropyConfig struct {
+	MinAvailable int `json:"min_available"` // bits below which health is a warning, default 200
+}
+
+// QuotasConfig sets which disk quotas are reported (collectors.quotas).
+type QuotasConfig struct {
+	NearLimitPercent int `json:"near_limit_percent"` // of the limit at which an entry is "near_limit" and alerts, default 90
+	Top              int `json:"top"`                // entries reported, fullest first, default 50
+}
+
+// InventoryConfig enables GET /inventory/packages, the installed software
+// list for vulnerability scanners, and GET /inventory/devices.
+type InventoryConfig struct {
+	Enabled        bool `json:"enabled"`
+	RefreshSeconds int  `json:"refresh_seconds"` // between package listings, default 21600
+
+	// USB and PCI devices, scanned every device_interval_seconds (default
+	// 60). With alert_new_devices, devices attached after the agent started
+	// raise an alert until removed, unless their "vendor:product" ID is in
+	// allowed_devices, e.g. "046d:c52b".
+	Devices               bool     `json:"devices"`
+	DeviceIntervalSeconds int      `json:"device_interval_seconds"`
+	AlertNewDevices       bool     `json:"alert_new_devices"`
+	AllowedDevices        []string `json:"allowed_devices"`
+}
+
+// SinkConfig pushes every periodic snapshot to an external system.
+type SinkConfig struct {
+	Type            string            `json:"type"` // "http", "influxdb", "zabbix", "elasticsearch", "nats", "redis", "mqtt", "kafka", "syslog", "s3" or "azure_blob"
+	Name            string            `json:"name"`
+	URL             string            `json:"url"`
+	Host            string            `json:"host"`     // zabbix: host name in Zabbix, default the agent hostname
+	Index           string            `json:"index"`    // elasticsearch: daily index prefix, default "host-agent"
+	Subject         string            `json:"subject"`  // nats, default "host-agent.metrics"
+	Channel         string            `json:"channel"`  // redis: PUBLISH channel, default "host-agent:metrics" without a stream
+	Stream          string            `json:"stream"`   // redis: XADD stream
+	MaxLen          int               `json:"max_len"`  // redis: approximate stream length cap, default 10000
+	Topic           string            `json:"topic"`    // mqtt, default "host-agent/metrics"; kafka, default "host-agent.metrics"
+	QoS             int               `json:"qos"`      // mqtt: 0 or 1, default 0
+	Facility        string            `json:"facility"` // syslog, default "daemon"
+	Headers         map[string]string `json:"headers"`
+	BatchSize       int               `json:"batch_size"`       // snapshots per request, default 10 (archives 1000)
+	IntervalSeconds int               `json:"interval_seconds"` // deliver at most this often, default immediately (archives 3600)
+
+	// Archives (s3, azure_blob)
+	Bucket          string `json:"bucket"`            // s3
+	Region          string `json:"region"`            // s3, default us-east-1
+	AccessKeyID     string `json:"access_key_id"`     // s3, default $AWS_ACCESS_KEY_ID
+	SecretAccessKey string `json:"secret_access_key"` // s3, default $AWS_SECRET_ACCESS_KEY
+	Prefix          string `json:"prefix"`            // object name prefix, default "host-agent/"
+	RetentionDays   int    `json:"retention_days"`    // delete older archives, 0 keeps them
+}
+
+// SpoolConfig bounds the per-sink buffers that hold snapshots until they
+// are delivered.
+type SpoolConfig struct {
+	Dir               string `json:"dir"`                 // default "spool" next to the executable
+	MaxSizeMB         int    `json:"max_size_mb"`         // per sink, default 50
+	MaxBackoffSeconds int    `json:"max_backoff_seconds"` // retry delay cap, default 300
+}
+
+// ThresholdsConfig drives the ok/warning/critical status fields.
+type ThresholdsConfig struct {
+	CPU         ThresholdConfig `json:"cpu"`         // usage percent
+	Memory      ThresholdConfig `json:"memory"`      // usage percent
+	Disk        ThresholdConfig `json:"disk"`        // used percent
+	Temperature ThresholdConfig `json:"temperature"` // CPU degrees Celsius
+	Drive       ThresholdConfig `json:"drive"`       // disk/SSD degrees Celsius
+	Sockets     ThresholdConfig `json:"sockets"`     // conntrack or ephemeral port usage percent
+	Limits      ThresholdConfig `json:"limits"`      // kernel limit usage percent, e.g. fs.file-max
+}
+
+type ThresholdConfig struct {
+	Warning  float64 `json:"warning"`
+	Critical float64 `json:"critical"`
+}
+
+// APIConfig secures the HTTP endpoints that expose or change settings.
+type APIConfig struct {
+	Listen   []string `json:"listen"`    // bind addresses, e.g. "127.0.0.1:8889", "[::1]:8889" or "eth0"; restart to apply
+	Token    string   `json:"token"`     // required by /config; empty disables those endpoints
+	Keys     []APIKey `json:"keys"`      // scoped keys; when set, every endpoint but /health needs one
+	Allow    []string `json:"allow"`     // client IPs/CIDRs; empty allows everyone not denied
+	Deny     []string `json:"deny"`      // client IPs/CIDRs, checked before allow
+	Audit    bool     `json:"audit"`     // record every request
+	AuditLog string   `json:"audit_log"` // JSON lines file; empty writes to the agent log
+
+	RateLimit                RateLimitConfig `json:"rate_limit"`
+	MaxConcurrentCollections int             `json:"max_concurrent_collections"` // default 2
+	CORS                     CORSConfig      `json:"cors"`
+
+	allowNets []*net.IPNet
+	denyNets  []*net.IPNet
+}
+
+// APIKey is a named credential limited to a scope and optionally to some
+// hosts. api.token keeps working as an unrestricted admin key.
+type APIKey struct {
+	Name  string   `json:"name"`
+	Key   string   `json:"key"`
+	Scope string   `json:"scope"` // "read" (GET and queries) or "admin" (everything)
+	Hosts []string `json:"hosts"` // hostnames or agent IDs, globs allowed; empty means every host
+}
+
+// CORSConfig is the cross-origin policy for browser dashboards.
+type CORSConfig struct {
+	AllowedOrigins   []string `json:"allowed_origins"` // exact origins, "*" or "https://*.example.com"
+	AllowedMethods   []string `json:"allowed_methods"`
+	AllowedHeaders   []string `json:"allowed_headers"`
+	AllowCredentials bool     `json:"allow_credentials"`
+	MaxAgeSeconds    int      `json:"max_age_seconds"` // preflight cache lifetime
+}
+
+// RateLimitConfig is a per-client-IP token bucket; 0 requests_per_second
+// disables it.
+type RateLimitConfig struct {
+	RequestsPerSecond float64 `json:"requests_per_second"`
+	Burst             int     `json:"burst"`
+}
+
+// Set by the --config flag; takes precedence over $HOST_AGENT_CONFIG
+var configPathOverride string
+
+var (
+	configMu     sync.RWMutex
+	agentConfig  = defaultConfig()
+	configReload = make(chan struct{})
+)
+
+// Label names usable as Prometheus labels and InfluxDB tags; "host" and
+// "agent_id" are reserved for the identity
+var labelNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// USB and PCI vendor:product IDs in inventory.allowed_devices
+var deviceIDPattern = regexp.MustCompile(`^[0-9A-Fa-f]{4}:[0-9A-Fa-f]{4}$`)
+
+// Index names Elasticsearch and OpenSearch accept
+var elasticsearchIndexPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9._-]*$`)
+
+// Topic names Kafka accepts
+var kafkaTopicPattern = regexp.MustCompile(`^[A-Za-z0-9._-]{1,249}$`)
+
+// Collectors that can be disabled through the collectors map
+var optionalCollectors = []string{"temperature", "gpu", "kernel", "event_log", "kernel_log", "hyperv", "zfs", "raid", "sockets", "security", "updates", "users", "cgroups", "numa", "hugepages", "entropy", "limits", "disk_io", "quotas"}
+
+// currentConfig returns the active configuration. Configs are never
+// modified after being applied, so callers may keep the pointer.
+func currentConfig() *AgentConfig {
+	configMu.RLock()
+	defer configMu.RUnlock()
+	return agentConfig
+}
+
+// configReloaded returns a channel that is closed the next time a new
+// configuration is applied. Background loops select on it to restart with
+// the new settings.
+func configReloaded() <-chan struct{} {
+	configMu.RLock()
+	defer configMu.RUnlock()
+	return configReload
+}
+
+// collectorEnabled reports whether an optional collector should run.
+func collectorEnabled(name string) bool {
+	enabled, ok := currentConfig().Collectors[name]
+	return !ok || enabled
+}
+
+// applyConfig activates a validated configuration and wakes every loop
+// waiting on configReloaded.
+func applyConfig(cfg *AgentConfig) {
+	configMu.Lock()
+	agentConfig = cfg
+	close(configReload)
+	configReload = make(chan struct{})
+	configMu.Unlock()
+
+	history.configure(cfg.History)
+	initNotifiers(cfg.Notifiers)
+}
+
+// reloadConfig re-reads the config file and applies it. On error the
+// running configuration is left untouched.
+func reloadConfig() error {
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+	applyConfig(cfg)
+	log.Printf("[CONFIG] Configuration reloaded")
+	return nil
+}
+
+// watchReloadSignal reloads the configuration on SIGHUP.
+func watchReloadSignal() {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP)
+	for range signals {
+		log.Printf("[CONFIG] SIGHUP received, reloading")
+		if err := reloadConfig(); err != nil {
+			log.Printf("[CONFIG] Reload failed, keeping current configuration: %v", err)
+		}
+	}
+}
+
+func configReloadHandler(w http.ResponseWriter, r *http.Request) {
+	if err := reloadConfig(); err != nil {
+		log.Printf("[CONFIG] Reload failed, keeping current configuration: %v", err)
+		http.Error(w, fmt.Sprintf("Reload failed: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"status":    "success",
+		"message":   "Configuration reloaded",
+		"timestamp": time.Now().UTC().Format(time.RFC3339),
+	})
+}
+
+func defaultConfig() *AgentConfig {
+	return &AgentConfig{
+		IntervalSeconds: int(UPDATE_INTERVAL / time.Second),
+		Collectors:      map[string]bool{},
+		API:             APIConfig{Listen: []string{":" + PORT}},
+		Checks:          ChecksConfig{IntervalSeconds: 30},
+		LogWatch:        LogWatchSettings{IntervalSeconds: 60},
+		DirWatch:        DirWatchSettings{IntervalSeconds: 300},
+		History:         HistoryConfig{RetentionHours: 24},
+		Forecast:        ForecastConfig{Model: "linear", WindowHours: 24, MinSamples: 10},
+		Anomaly: AnomalyConfig{
+			Metrics:       []string{"cpu_usage_percent", "memory_usage_percent", "temperature_cpu_celsius"},
+			Sigma:         3,
+			WindowSamples: 60,
+			MinSamples:    20,
+		},
+		MaintenanceWindows: []MaintenanceWindow{},
+		Thresholds: ThresholdsConfig{
+			CPU:         ThresholdConfig{Warning: 80, Critical: 95},
+			Memory:      ThresholdConfig{Warning: 85, Critical: 95},
+			Disk:        ThresholdConfig{Warning: 85, Critical: 95},
+			Temperature: ThresholdConfig{Warning: 75, Critical: 90},
+			Drive:       ThresholdConfig{Warning: 60, Critical: 70},
+			Sockets:     ThresholdConfig{Warning: 80, Critical: 95},
+			Limits:      ThresholdConfig{Warning: 80, Critical: 95},
+		},
+	}
+}
+
+// configPath returns the config file location: --config or
+// $HOST_AGENT_CONFIG if set, otherwise agent_config.json next to the
+// executable.
+func configPath() (string, error) {
+	if configPathOverride != "" {
+		return configPathOverride, nil
+	}
+	if path := os.Getenv(CONFIG_ENV_VAR); path != "" {
+		return path, nil
+	}
+	exePath, err := os.Executable()
+	if err != nil {
+		return "", fmt.Errorf("failed to get executable path: %v", err)
+	}
+	return filepath.Join(filepath.Dir(exePath), CONFIG_FILE), nil
+}
+
+// loadConfig reads and validates the config file. A missing file is not an
+// error; the defaults are returned instead.
+func loadConfig() (*AgentConfig, error) {
+	path, err := configPath()
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := defaultConfig()
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		log.Printf("[CONFIG] No config file at %s, using defaults", path)
+		// validate fills in the defaults that are not set above
+		return cfg, cfg.validate()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config: %v", err)
+	}
+
+	if err := json.Unmarshal(data, cfg); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %v", path, err)
+	}
+	if err := cfg.validate(); err != nil {
+		return nil, fmt.Errorf("invalid config %s: %v", path, err)
+	}
+
+	log.Printf("[CONFIG] Loaded %s", path)
+	return cfg, nil
+}
+
+// validate fills in per-entry defaults and rejects unusable entries, one
+// section at a time.
+func (c *AgentConfig) validate() error {
+	for _, section := range []func() error{
+		c.validateCollectors, c.validateChecks, c.validateWatchers, c.validateSNMP,
+		c.validatePlugins, c.validateHistory, c.validateAlerts, c.validateFleet,
+		c.validateGossip, c.validateSinks, c.validateAPI, c.validateSchedule,
+	} {
+		if err := section(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validateCollectors checks the collector switches and the settings of
+// individual collectors.
+func (c *AgentConfig) validateCollectors() error {
+	if c.IntervalSeconds <= 0 {
+		c.IntervalSeconds = int(UPDATE_INTERVAL / time.Second)
+	}
+	for name := range c.Collectors {
+		known := false
+		for _, optional := range optionalCollectors {
+			known = known || name == optional
+		}
+		if !known {
+			return fmt.Errorf("collectors: unknown collector %q (valid: %s)", name, strings.Join(optionalCollectors, ", "))
+		}
+	}
+
+	for name := range c.Labels {
+		if !labelNamePattern.MatchString(name) || name == "host" || name == "agent_id" {
+			return fmt.Errorf("labels: invalid label name %q", name)
+		}
+	}
+
+	for name, seconds := range c.CollectorIntervals {
+		known := false
+		for _, section := range sampledSections {
+			known = known || name == section
+		}
+		if !known {
+			return fmt.Errorf("collector_intervals: unknown section %q (valid: %s)", name, strings.Join(sampledSections, ", "))
+		}
+		if seconds < 0 {
+			return fmt.Errorf("collector_intervals: %s must not be negative", name)
+		}
+	}
+
+	if c.DiskTimeoutMs <= 0 {
+		c.DiskTimeoutMs = 2000
+	}
+
+	if c.Temperature.Source == "" {
+		c.Temperature.Source = "auto"
+	}
+	if c.Temperature.Source != "auto" && !temperatureSourceKnown(c.Temperature.Source) {
+		return fmt.Errorf("temperature: unknown source %q (valid: %s)", c.Temperature.Source, strings.Join(temperatureSourceNames(), ", "))
+	}
+	if c.Temperature.Force && c.Temperature.Source == "auto" {
+		return fmt.Errorf("temperature: force requires a source")
+	}
+	if c.Temperature.RetrySeconds <= 0 {
+		c.Temperature.RetrySeconds = 600
+	}
+	for sensor, offset := range c.Temperature.Offsets {
+		if sensor == "" || math.Abs(offset) > 50 {
+			return fmt.Errorf("temperature.offsets: %q must be a sensor with an offset within ±50 degrees", sensor)
+		}
+	}
+	if c.Users.Top <= 0 {
+		c.Users.Top = 10
+	}
+	if c.Cgroups.Depth == 0 {
+		c.Cgroups.Depth = 2
+	}
+	if c.Cgroups.Depth < 1 || c.Cgroups.Depth > 5 {
+		return fmt.Errorf("cgroups.depth must be between 1 and 5")
+	}
+	if c.Entropy.MinAvailable <= 0 {
+		c.Entropy.MinAvailable = 200
+	}
+	if c.Entropy.MinAvailable > 4096 {
+		return fmt.Errorf("entropy.min_available must be at most 4096")
+	}
+	if c.Quotas.NearLimitPercent == 0 {
+		c.Quotas.NearLimitPercent = 90
+	}
+	if c.Quotas.NearLimitPercent < 1 || c.Quotas.NearLimitPercent > 100 {
+		return fmt.Errorf("quotas.near_limit_percent must be between 1 and 100")
+	}
+	if c.Quotas.Top <= 0 {
+		c.Quotas.Top = 50
+	}
+	if c.Inventory.RefreshSeconds <= 0 {
+		c.Inventory.RefreshSeconds = 21600
+	}
+	if c.Inventory.DeviceIntervalSeconds <= 0 {
+		c.Inventory.DeviceIntervalSeconds = 60
+	}
+	for i, id := range c.Inventory.AllowedDevices {
+		if !deviceIDPattern.MatchString(id) {
+			return fmt.Errorf("inventory.allowed_devices: %q must be a vendor:product ID such as 046d:c52b", id)
+		}
+		c.Inventory.AllowedDevices[i] = strings.ToLower(id)
+	}
+	if c.Temperature.LHMURL != "" {
+		if u, err := url.Parse(c.Temperature.LHMURL); err != nil || u.Host == "" || (u.Scheme != "http" && u.Scheme != "https") {
+			return fmt.Errorf("temperature.lhm_url must be an http:// or https:// URL")
+		}
+	}
+
+	if c.Cloud.TimeoutMs <= 0 {
+		c.Cloud.TimeoutMs = 1000
+	}
+
+	if c.Connectivity.PublicIPURL == "" {
+		c.Connectivity.PublicIPURL = "https://api.ipify.org"
+	}
+	if !strings.HasPrefix(c.Connectivity.PublicIPURL, "http://") && !strings.HasPrefix(c.Connectivity.PublicIPURL, "https://") {
+		return fmt.Errorf("connectivity.public_ip_url must be an http(s) URL")
+	}
+	if c.Connectivity.PublicIPIntervalSeconds <= 0 {
+		c.Connectivity.PublicIPIntervalSeconds = 3600
+	}
+	if c.Connectivity.TimeoutMs <= 0 {
+		c.Connectivity.TimeoutMs = 3000
+	}
+	return nil
+}
+
+// validateChecks fills in the defaults of the ping, HTTP, DNS, mount and app
+// checks.
+func (c *AgentConfig) validateChecks() error {
+	if c.Checks.IntervalSeconds <= 0 {
+		c.Checks.IntervalSeconds = 30
+	}
+
+	for i := range c.Checks.Ping {
+		target := &c.Checks.Ping[i]
+		if target.Host == "" {
+			return fmt.Errorf("checks.ping[%d]: host is required", i)
+		}
+		if target.Name == "" {
+			target.Name = target.Host
+		}
+		switch target.Protocol {
+		case "":
+			target.Protocol = "icmp"
+		case "icmp":
+		case "tcp":
+			if target.Port <= 0 || target.Port > 65535 {
+				return fmt.Errorf("checks.ping[%d]: tcp probes need a valid port", i)
+			}
+		default:
+			return fmt.Errorf("checks.ping[%d]: unknown protocol %q", i, target.Protocol)
+		}
+		if target.Count <= 0 {
+			target.Count = 3
+		}
+		if target.TimeoutMs <= 0 {
+			target.TimeoutMs = 1000
+		}
+	}
+
+	for i := range c.Checks.HTTP {
+		target := &c.Checks.HTTP[i]
+		parsed, err := url.Parse(target.URL)
+		if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+			return fmt.Errorf("checks.http[%d]: url must be an absolute http(s) URL", i)
+		}
+		if target.Name == "" {
+			target.Name = parsed.Host
+		}
+		if target.Method == "" {
+			target.Method = "GET"
+		}
+		if target.ExpectedStatus == 0 {
+			target.ExpectedStatus = 200
+		}
+		if target.TimeoutMs <= 0 {
+			target.TimeoutMs = 5000
+		}
+	}
+
+	if c.Checks.Mounts.TimeoutMs <= 0 {
+		c.Checks.Mounts.TimeoutMs = 2000
+	}
+
+	for i := range c.Checks.DNS {
+		target := &c.Checks.DNS[i]
+		if target.Query == "" {
+			return fmt.Errorf("checks.dns[%d]: query is required", i)
+		}
+		if target.Name == "" {
+			target.Name = target.Query
+		}
+		target.Type = strings.ToUpper(target.Type)
+		switch target.Type {
+		case "":
+			target.Type = "A"
+		case "A", "AAAA", "CNAME", "MX", "TXT":
+		default:
+			return fmt.Errorf("checks.dns[%d]: unsupported record type %q", i, target.Type)
+		}
+		if target.Resolver != "" {
+			if _, _, err := net.SplitHostPort(target.Resolver); err != nil {
+				target.Resolver = net.JoinHostPort(target.Resolver, "53")
+			}
+		}
+		if target.TimeoutMs <= 0 {
+			target.TimeoutMs = 2000
+		}
+	}
+	for i := range c.Checks.Apps {
+		target := &c.Checks.Apps[i]
+		if target.PIDFile == "" && target.Port == 0 {
+			return fmt.Errorf("checks.apps[%d]: pid_file or port is required", i)
+		}
+		if target.Port < 0 || target.Port > 65535 {
+			return fmt.Errorf("checks.apps[%d]: invalid port %d", i, target.Port)
+		}
+		if target.Name == "" {
+			if target.PIDFile != "" {
+				target.Name = filepath.Base(target.PIDFile)
+			} else {
+				target.Name = fmt.Sprintf("port-%d", target.Port)
+			}
+		}
+		if target.Host == "" {
+			target.Host = "127.0.0.1"
+		}
+		if target.Severity == "" {
+			target.Severity = "critical"
+		}
+		if target.TimeoutMs <= 0 {
+			target.TimeoutMs = 1000
+		}
+	}
+	return nil
+}
+
+// validateWatchers checks the log, file, process, scheduled task and
+// directory watchers.
+func (c *AgentConfig) validateWatchers() error {
+	if c.LogWatch.IntervalSeconds <= 0 {
+		c.LogWatch.IntervalSeconds = 60
+	}
+	for i := range c.LogWatch.Files {
+		file := &c.LogWatch.Files[i]
+		if file.Path == "" {
+			return fmt.Errorf("log_watch.files[%d]: path is required", i)
+		}
+		if file.Name == "" {
+			file.Name = filepath.Base(file.Path)
+		}
+		if len(file.Patterns) == 0 {
+			return fmt.Errorf("log_watch.files[%d]: at least one pattern is required", i)
+		}
+		for j := range file.Patterns {
+			pattern := &file.Patterns[j]
+			if _, err := regexp.Compile(pattern.Regex); err != nil {
+				return fmt.Errorf("log_watch.files[%d].patterns[%d]: %v", i, j, err)
+			}
+			if pattern.Name == "" {
+				pattern.Name = pattern.Regex
+			}
+			if pattern.Severity == "" {
+				pattern.Severity = "warning"
+			}
+		}
+	}
+
+	for i := range c.FileMetrics {
+		entry := &c.FileMetrics[i]
+		if entry.Path == "" {
+			return fmt.Errorf("file_metrics[%d]: path is required", i)
+		}
+		if _, err := filepath.Match(entry.Path, ""); err != nil {
+			return fmt.Errorf("file_metrics[%d]: invalid path pattern: %v", i, err)
+		}
+		if !labelNamePattern.MatchString(entry.Name) {
+			return fmt.Errorf("file_metrics[%d]: invalid metric name %q", i, entry.Name)
+		}
+		if entry.Field < 0 {
+			return fmt.Errorf("file_metrics[%d]: field must not be negative", i)
+		}
+		if entry.Scale == 0 {
+			entry.Scale = 1
+		}
+	}
+
+	names := make(map[string]bool, len(c.ProcessWatch))
+	for i := range c.ProcessWatch {
+		entry := &c.ProcessWatch[i]
+		if entry.Name == "" {
+			return fmt.Errorf("process_watch[%d]: name is required", i)
+		}
+		if names[entry.Name] {
+			return fmt.Errorf("process_watch[%d]: duplicate name %q", i, entry.Name)
+		}
+		names[entry.Name] = true
+		if entry.Pattern == "" {
+			entry.Pattern = "^" + regexp.QuoteMeta(entry.Name) + "$"
+		}
+		if _, err := regexp.Compile(entry.Pattern); err != nil {
+			return fmt.Errorf("process_watch[%d]: %v", i, err)
+		}
+		if entry.MinCount <= 0 {
+			entry.MinCount = 1
+		}
+		if entry.Severity == "" {
+			entry.Severity = "critical"
+		}
+	}
+
+	names = make(map[string]bool, len(c.ScheduledTasks))
+	for i := range c.ScheduledTasks {
+		entry := &c.ScheduledTasks[i]
+		if entry.Name == "" {
+			return fmt.Errorf("scheduled_tasks[%d]: name is required", i)
+		}
+		if names[entry.Name] {
+			return fmt.Errorf("scheduled_tasks[%d]: duplicate name %q", i, entry.Name)
+		}
+		names[entry.Name] = true
+		sources := 0
+		for _, source := range []string{entry.Unit, entry.Anacron, entry.Task} {
+			if source != "" {
+				sources++
+			}
+		}
+		if sources != 1 {
+			return fmt.Errorf("scheduled_tasks[%d]: exactly one of unit, anacron and task is required", i)
+		}
+		if entry.Unit != "" && !strings.HasSuffix(entry.Unit, ".timer") && !strings.HasSuffix(entry.Unit, ".service") {
+			return fmt.Errorf("scheduled_tasks[%d]: unit must be a .timer or .service", i)
+		}
+		if strings.ContainsRune(entry.Anacron, '/') {
+			return fmt.Errorf("scheduled_tasks[%d]: anacron must be a job identifier, not a path", i)
+		}
+		if entry.Task != "" && !strings.HasPrefix(entry.Task, `\`) {
+			entry.Task = `\` + entry.Task
+		}
+		if entry.MaxAgeHours < 0 {
+			return fmt.Errorf("scheduled_tasks[%d]: max_age_hours must not be negative", i)
+		}
+		if entry.Severity == "" {
+			entry.Severity = "critical"
+		}
+	}
+
+	if c.DirWatch.IntervalSeconds <= 0 {
+		c.DirWatch.IntervalSeconds = 300
+	}
+	for i := range c.DirWatch.Directories {
+		dir := &c.DirWatch.Directories[i]
+		if dir.Path == "" {
+			return fmt.Errorf("dir_watch.directories[%d]: path is required", i)
+		}
+		dir.Path = filepath.Clean(dir.Path)
+		if dir.Name == "" {
+			dir.Name = dir.Path
+		}
+	}
+	return nil
+}
+
+// validateSNMP checks the polled SNMP devices and the built-in SNMP agent.
+func (c *AgentConfig) validateSNMP() error {
+	var err error
+	devices := make(map[string]bool, len(c.SNMPDevices))
+	for i := range c.SNMPDevices {
+		device := &c.SNMPDevices[i]
+		if device.Host == "" {
+			return fmt.Errorf("snmp_devices[%d]: host is required", i)
+		}
+		if device.Name == "" {
+			device.Name = device.Host
+		}
+		if devices[device.Name] {
+			return fmt.Errorf("snmp_devices[%d]: duplicate name %q", i, device.Name)
+		}
+		devices[device.Name] = true
+		if device.Port <= 0 {
+			device.Port = 161
+		}
+		switch device.Version {
+		case "":
+			device.Version = "2c"
+		case "1", "2c":
+		default:
+			return fmt.Errorf("snmp_devices[%d]: version must be 1 or 2c", i)
+		}
+		if device.Community == "" {
+			device.Community = "public"
+		}
+		for j := range device.OIDs {
+			sensor := &device.OIDs[j]
+			if !labelNamePattern.MatchString(sensor.Name) {
+				return fmt.Errorf("snmp_devices[%d].oids[%d]: invalid metric name %q", i, j, sensor.Name)
+			}
+			if _, err := parseOID(sensor.OID); err != nil {
+				return fmt.Errorf("snmp_devices[%d].oids[%d]: %v", i, j, err)
+			}
+			if sensor.Scale == 0 {
+				sensor.Scale = 1
+			}
+		}
+		if device.IntervalSeconds <= 0 {
+			device.IntervalSeconds = 60
+		}
+		if device.TimeoutMs <= 0 {
+			device.TimeoutMs = 2000
+		}
+		if device.Retries <= 0 {
+			device.Retries = 1
+		}
+		if device.Severity == "" {
+			device.Severity = "warning"
+		}
+	}
+
+	if c.SNMP.Listen == "" {
+		c.SNMP.Listen = ":1161"
+	}
+	if c.SNMP.Community == "" {
+		c.SNMP.Community = "public"
+	}
+	if c.SNMP.BaseOID == "" {
+		c.SNMP.BaseOID = "1.3.6.1.4.1.8072.9999.9999"
+	}
+	if c.SNMP.baseOID, err = parseOID(c.SNMP.BaseOID); err != nil {
+		return fmt.Errorf("snmp.base_oid: %v", err)
+	}
+	if c.SNMP.allowNets, err = parseIPNets(c.SNMP.Allow); err != nil {
+		return fmt.Errorf("snmp.allow: %v", err)
+	}
+	return nil
+}
+
+// validatePlugins checks the Windows performance counters, exec plugins
+// and WASM plugins.
+func (c *AgentConfig) validatePlugins() error {
+	for i := range c.PerfCounters {
+		counter := &c.PerfCounters[i]
+		if !strings.HasPrefix(counter.Path, `\`) {
+			return fmt.Errorf("perf_counters[%d]: path must start with \\, e.g. \\Processor(_Total)\\%% Processor Time", i)
+		}
+		if !labelNamePattern.MatchString(counter.Name) {
+			return fmt.Errorf("perf_counters[%d]: invalid metric name %q", i, counter.Name)
+		}
+		if counter.Scale == 0 {
+			counter.Scale = 1
+		}
+	}
+
+	plugins := make(map[string]bool, len(c.Exec))
+	for i := range c.Exec {
+		plugin := &c.Exec[i]
+		if len(plugin.Command) == 0 || plugin.Command[0] == "" {
+			return fmt.Errorf("exec[%d]: command is required", i)
+		}
+		if plugin.Name == "" {
+			plugin.Name = strings.TrimSuffix(filepath.Base(plugin.Command[0]), filepath.Ext(plugin.Command[0]))
+		}
+		if plugins[plugin.Name] {
+			return fmt.Errorf("exec[%d]: duplicate name %q", i, plugin.Name)
+		}
+		plugins[plugin.Name] = true
+		switch plugin.Format {
+		case "", "json", "keyvalue":
+		default:
+			return fmt.Errorf("exec[%d]: format must be json or keyvalue", i)
+		}
+		if plugin.IntervalSeconds <= 0 {
+			plugin.IntervalSeconds = 60
+		}
+		if plugin.TimeoutMs <= 0 {
+			plugin.TimeoutMs = 10000
+		}
+	}
+
+	wasm := &c.WasmPlugins
+	switch wasm.Format {
+	case "", "json", "keyvalue":
+	default:
+		return fmt.Errorf("wasm_plugins.format must be json or keyvalue")
+	}
+	if wasm.IntervalSeconds <= 0 {
+		wasm.IntervalSeconds = 60
+	}
+	if wasm.TimeoutMs <= 0 {
+		wasm.TimeoutMs = 10000
+	}
+	if wasm.MaxMemoryMB <= 0 {
+		wasm.MaxMemoryMB = 64
+	}
+	if wasm.MaxMemoryMB > 4096 {
+		return fmt.Errorf("wasm_plugins.max_memory_mb must be at most 4096")
+	}
+	return nil
+}
+
+// validateHistory checks history retention and rollups, the uptime windows,
+// the snapshot log and forecasting, which defaults to the history window.
+func (c *AgentConfig) validateHistory() error {
+	if c.History.RetentionHours <= 0 {
+		c.History.RetentionHours = 24
+	}
+	if c.History.Rollups == nil {
+		// Set here rather than in defaultConfig so a configured list
+		// replaces the defaults instead of being merged into them
+		c.History.Rollups = []RollupConfig{
+			{Resolution: "1m", RetentionHours: 48},
+			{Resolution: "5m", RetentionHours: 7 * 24},
+			{Resolution: "1h", RetentionHours: 30 * 24},
+		}
+	}
+	seenRollups := map[string]bool{}
+	for i, rollup := range c.History.Rollups {
+		if _, ok := rollupSteps[rollup.Resolution]; !ok {
+			return fmt.Errorf("history.rollups[%d]: resolution must be 1m, 5m or 1h", i)
+		}
+		if seenRollups[rollup.Resolution] {
+			return fmt.Errorf("history.rollups[%d]: duplicate resolution %s", i, rollup.Resolution)
+		}
+		seenRollups[rollup.Resolution] = true
+		if rollup.RetentionHours <= 0 {
+			return fmt.Errorf("history.rollups[%d]: retention_hours must be positive", i)
+		}
+	}
+
+	if c.Uptime.WindowsDays == nil {
+		c.Uptime.WindowsDays = []int{1, 7, 30}
+	}
+	seenWindows := map[int]bool{}
+	for i, days := range c.Uptime.WindowsDays {
+		if days <= 0 || days > 366 {
+			return fmt.Errorf("uptime.windows_days[%d]: must be between 1 and 366", i)
+		}
+		if seenWindows[days] {
+			return fmt.Errorf("uptime.windows_days[%d]: duplicate window %d", i, days)
+		}
+		seenWindows[days] = true
+	}
+	if c.Uptime.StateFile != "" {
+		c.Uptime.StateFile = filepath.Clean(c.Uptime.StateFile)
+	}
+
+	if c.SnapshotLog.MaxSizeMB < 0 || c.SnapshotLog.MaxAgeHours < 0 || c.SnapshotLog.Keep < 0 {
+		return fmt.Errorf("snapshot_log: limits must not be negative")
+	}
+	if c.SnapshotLog.Path != "" {
+		c.SnapshotLog.Path = filepath.Clean(c.SnapshotLog.Path)
+		if c.SnapshotLog.MaxSizeMB == 0 && c.SnapshotLog.MaxAgeHours == 0 {
+			c.SnapshotLog.MaxSizeMB, c.SnapshotLog.MaxAgeHours = 100, 24
+		}
+		if c.SnapshotLog.Keep == 0 {
+			c.SnapshotLog.Keep = 7
+		}
+	}
+
+	switch c.Forecast.Model {
+	case "":
+		c.Forecast.Model = "linear"
+	case "linear", "exponential":
+	default:
+		return fmt.Errorf("forecast.model: unknown model %q", c.Forecast.Model)
+	}
+	if c.Forecast.WindowHours <= 0 {
+		c.Forecast.WindowHours = c.History.RetentionHours
+	}
+	if c.Forecast.MinSamples < 2 {
+		c.Forecast.MinSamples = 10
+	}
+	return nil
+}
+
+// validateAlerts checks thresholds, alert rules, maintenance windows and
+// notifiers.
+func (c *AgentConfig) validateAlerts() error {
+	for name, t := range map[string]ThresholdConfig{
+		"cpu": c.Thresholds.CPU, "memory": c.Thresholds.Memory,
+		"disk": c.Thresholds.Disk, "temperature": c.Thresholds.Temperature,
+		"drive": c.Thresholds.Drive, "sockets": c.Thresholds.Sockets,
+		"limits": c.Thresholds.Limits,
+	} {
+		if t.Warning < 0 || t.Critical < 0 || (t.Warning > 0 && t.Critical > 0 && t.Warning > t.Critical) {
+			return fmt.Errorf("thresholds.%s: warning must not exceed critical", name)
+		}
+	}
+
+	for i := range c.Alerts.Rules {
+		rule := &c.Alerts.Rules[i]
+		if rule.Name == "" {
+			rule.Name = fmt.Sprintf("rule%d", i)
+		}
+		if rule.Severity == "" {
+			rule.Severity = "warning"
+		}
+		switch rule.Type {
+		case "disk_fill":
+			if rule.Days <= 0 {
+				return fmt.Errorf("alerts.rules[%d]: disk_fill rules need days > 0", i)
+			}
+		case "threshold":
+			if rule.Metric == "" {
+				return fmt.Errorf("alerts.rules[%d]: threshold rules need a metric", i)
+			}
+			switch rule.Operator {
+			case "":
+				rule.Operator = ">"
+			case ">", ">=", "<", "<=":
+			default:
+				return fmt.Errorf("alerts.rules[%d]: unknown operator %q", i, rule.Operator)
+			}
+		default:
+			return fmt.Errorf("alerts.rules[%d]: unknown rule type %q", i, rule.Type)
+		}
+	}
+
+	for i := range c.MaintenanceWindows {
+		window := &c.MaintenanceWindows[i]
+		if window.Name == "" {
+			window.Name = fmt.Sprintf("window%d", i)
+		}
+		if window.Match == "" {
+			window.Match = "*"
+		}
+		for _, value := range []string{window.Start, window.End} {
+			if _, err := time.Parse("15:04", value); err != nil {
+				return fmt.Errorf("maintenance_windows[%d]: start and end must be HH:MM", i)
+			}
+		}
+		for _, day := range window.Days {
+			if _, ok := weekdays[strings.ToLower(day)]; !ok {
+				return fmt.Errorf("maintenance_windows[%d]: unknown day %q", i, day)
+			}
+		}
+	}
+
+	for i := range c.Notifiers {
+		n := &c.Notifiers[i]
+		if n.Name == "" {
+			n.Name = fmt.Sprintf("%s%d", n.Type, i)
+		}
+		switch n.Type {
+		case "pagerduty":
+			if n.RoutingKey == "" {
+				return fmt.Errorf("notifiers[%d]: pagerduty needs a routing_key", i)
+			}
+		case "opsgenie":
+			if n.APIKey == "" {
+				return fmt.Errorf("notifiers[%d]: opsgenie needs an api_key", i)
+			}
+		case "telegram":
+			if n.BotToken == "" || n.ChatID == "" {
+				return fmt.Errorf("notifiers[%d]: telegram needs a bot_token and chat_id", i)
+			}
+		case "webhook":
+			if parsed, err := url.Parse(n.URL); err != nil || parsed.Host == "" {
+				return fmt.Errorf("notifiers[%d]: webhook needs an absolute url", i)
+			}
+			if n.BodyTemplate != "" {
+				if _, err := parseWebhookTemplate(n.BodyTemplate); err != nil {
+					return fmt.Errorf("notifiers[%d]: invalid body_template: %v", i, err)
+				}
+			}
+		default:
+			return fmt.Errorf("notifiers[%d]: unknown notifier type %q (valid: %s)", i, n.Type, strings.Join(notifierTypes, ", "))
+		}
+	}
+	return nil
+}
+
+// validateFleet checks registration, the tunnel and self-update.
+func (c *AgentConfig) validateFleet() error {
+	if c.Registration.URL != "" {
+		if parsed, err := url.Parse(c.Registration.URL); err != nil || parsed.Host == "" {
+			return fmt.Errorf("registration.url must be an absolute URL")
+		}
+	}
+	if c.Registration.IntervalSeconds <= 0 {
+		c.Registration.IntervalSeconds = 60
+	}
+
+	if c.Tunnel.URL != "" {
+		if parsed, err := url.Parse(c.Tunnel.URL); err != nil || parsed.Host == "" || (parsed.Scheme != "ws" && parsed.Scheme != "wss") {
+			return fmt.Errorf("tunnel.url must be a ws:// or wss:// URL")
+		}
+	}
+	if c.Tunnel.PingSeconds <= 0 {
+		c.Tunnel.PingSeconds = 30
+	}
+
+	if c.Update.URL != "" {
+		if u, err := url.Parse(c.Update.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			return fmt.Errorf("update.url must be an http:// or https:// URL")
+		}
+		if c.Update.PublicKey == "" {
+			return fmt.Errorf("update.public_key is required to verify releases")
+		}
+	}
+	if c.Update.PublicKey != "" {
+		key, err := parseUpdateKey(c.Update.PublicKey)
+		if err != nil {
+			return fmt.Errorf("update.public_key: %v", err)
+		}
+		c.Update.publicKey = key
+	}
+	if c.Update.IntervalHours <= 0 {
+		c.Update.IntervalHours = 24
+	}
+	if c.Update.HealthCheckSeconds <= 0 {
+		c.Update.HealthCheckSeconds = 60
+	}
+	return nil
+}
+
+// validateGossip checks the gossip timers and seeds.
+func (c *AgentConfig) validateGossip() error {
+	if c.Gossip.Listen == "" {
+		c.Gossip.Listen = ":7946"
+	}
+	for i, seed := range c.Gossip.Seeds {
+		c.Gossip.Seeds[i] = gossipSeedAddress(seed)
+	}
+	if c.Gossip.IntervalSeconds <= 0 {
+		c.Gossip.IntervalSeconds = 1
+	}
+	if c.Gossip.SuspectSeconds <= 0 {
+		c.Gossip.SuspectSeconds = 5
+	}
+	if c.Gossip.DeadSeconds <= 0 {
+		c.Gossip.DeadSeconds = 30
+	}
+	if c.Gossip.SuspectSeconds <= c.Gossip.IntervalSeconds || c.Gossip.DeadSeconds <= c.Gossip.SuspectSeconds {
+		return fmt.Errorf("gossip: need interval_seconds < suspect_seconds < dead_seconds")
+	}
+	// Unsigned gossip lets anyone on the network name a member's API URL,
+	// which would receive the key
+	if c.Gossip.APIKey != "" && c.Gossip.Secret == "" {
+		return fmt.Errorf("gossip.api_key requires gossip.secret")
+	}
+	return nil
+}
+
+// validateSinks fills in per-type sink defaults and the spool limits.
+func (c *AgentConfig) validateSinks() error {
+	sinkNames := make(map[string]bool, len(c.Sinks))
+	for i := range c.Sinks {
+		s := &c.Sinks[i]
+		switch s.Type {
+		case "http", "influxdb", "zabbix", "azure_blob":
+		case "nats":
+			if s.Subject == "" {
+				s.Subject = "host-agent.metrics"
+			}
+			if strings.ContainsAny(s.Subject, " \t\r\n*>") {
+				return fmt.Errorf("sinks[%d]: subject must not contain whitespace or wildcards", i)
+			}
+			if scheme := strings.SplitN(s.URL, "://", 2)[0]; scheme != "nats" && scheme != "tls" {
+				return fmt.Errorf("sinks[%d]: nats url must start with nats:// or tls://", i)
+			}
+		case "mqtt":
+			if s.Topic == "" {
+				s.Topic = "host-agent/metrics"
+			}
+			if strings.ContainsAny(s.Topic, "+#\x00") {
+				return fmt.Errorf("sinks[%d]: topic must not contain wildcards", i)
+			}
+			if s.QoS != 0 && s.QoS != 1 {
+				return fmt.Errorf("sinks[%d]: qos must be 0 or 1", i)
+			}
+			if scheme := strings.SplitN(s.URL, "://", 2)[0]; scheme != "mqtt" && scheme != "mqtts" {
+				return fmt.Errorf("sinks[%d]: mqtt url must start with mqtt:// or mqtts://", i)
+			}
+		case "kafka":
+			if s.Topic == "" {
+				s.Topic = "host-agent.metrics"
+			}
+			if !kafkaTopicPattern.MatchString(s.Topic) || s.Topic == "." || s.Topic == ".." {
+				return fmt.Errorf("sinks[%d]: kafka topic must be 1-249 letters, digits, '.', '_' or '-'", i)
+			}
+			if scheme := strings.SplitN(s.URL, "://", 2)[0]; scheme != "kafka" && scheme != "kafkas" {
+				return fmt.Errorf("sinks[%d]: kafka url must start with kafka:// or kafkas://", i)
+			}
+		case "syslog":
+			if s.Facility == "" {
+				s.Facility = "daemon"
+			}
+			if _, ok := syslogFacilities[s.Facility]; !ok {
+				return fmt.Errorf("sinks[%d]: unknown syslog facility %q", i, s.Facility)
+			}
+			if s.URL == "" && runtime.GOOS == "windows" {
+				return fmt.Errorf("sinks[%d]: syslog needs a url on Windows", i)
+			}
+			if scheme := strings.SplitN(s.URL, "://", 2)[0]; s.URL != "" && scheme != "udp" && scheme != "tcp" && scheme != "tls" && scheme != "unix" {
+				return fmt.Errorf("sinks[%d]: syslog url must start with udp://, tcp://, tls:// or unix://", i)
+			}
+		case "redis":
+			if s.Channel == "" && s.Stream == "" {
+				s.Channel = "host-agent:metrics"
+			}
+			if s.MaxLen <= 0 {
+				s.MaxLen = 10000
+			}
+			if scheme := strings.SplitN(s.URL, "://", 2)[0]; scheme != "redis" && scheme != "rediss" {
+				return fmt.Errorf("sinks[%d]: redis url must start with redis:// or rediss://", i)
+			}
+		case "s3":
+			if s.Bucket == "" {
+				return fmt.Errorf("sinks[%d]: s3 needs a bucket", i)
+			}
+			if s.Region == "" {
+				s.Region = "us-east-1"
+			}
+		case "elasticsearch":
+			if s.Index == "" {
+				s.Index = "host-agent"
+			}
+			if !elasticsearchIndexPattern.MatchString(s.Index) {
+				return fmt.Errorf("sinks[%d]: index must be lowercase letters, digits, '.', '_' or '-'", i)
+			}
+		default:
+			return fmt.Errorf("sinks[%d]: unknown sink type %q (valid: %s)", i, s.Type, strings.Join(sinkTypes, ", "))
+		}
+		// S3 defaults to the AWS endpoint of the region, syslog to the
+		// local socket
+		if parsed, err := url.Parse(s.URL); (err != nil || parsed.Host == "") && !((s.Type == "s3" || s.Type == "syslog") && s.URL == "") && !strings.HasPrefix(s.URL, "unix://") {
+			return fmt.Errorf("sinks[%d]: %s needs an absolute url", i, s.Type)
+		}
+		if s.Name == "" {
+			s.Name = fmt.Sprintf("%d", i)
+		}
+		if sinkNames[s.Type+":"+s.Name] {
+			return fmt.Errorf("sinks[%d]: duplicate name %q", i, s.Name)
+		}
+		sinkNames[s.Type+":"+s.Name] = true
+		archive := s.Type == "s3" || s.Type == "azure_blob"
+		if s.BatchSize <= 0 {
+			s.BatchSize = 10
+			if archive {
+				s.BatchSize = 1000
+			}
+		}
+		if s.IntervalSeconds <= 0 && archive {
+			s.IntervalSeconds = 3600
+		}
+		if archive && s.Prefix == "" {
+			s.Prefix = "host-agent/"
+		}
+		if s.Prefix != "" && !strings.HasSuffix(s.Prefix, "/") {
+			s.Prefix += "/"
+		}
+		if s.RetentionDays < 0 {
+			return fmt.Errorf("sinks[%d]: retention_days must not be negative", i)
+		}
+	}
+	if c.Spool.MaxSizeMB <= 0 {
+		c.Spool.MaxSizeMB = 50
+	}
+	if c.Spool.MaxBackoffSeconds <= 0 {
+		c.Spool.MaxBackoffSeconds = 300
+	}
+	return nil
+}
+
+// validateAPI checks the output formats, listeners, rate limits, CORS, keys
+// and access lists of the HTTP API.
+func (c *AgentConfig) validateAPI() error {
+	if len(c.OutputFormats) == 0 {
+		c.OutputFormats = []string{"json"}
+	}
+	for _, format := range c.OutputFormats {
+		if format != "json" && format != "protobuf" {
+			return fmt.Errorf("output_formats: unknown format %q (json or protobuf)", format)
+		}
+	}
+
+	if len(c.API.Listen) == 0 {
+		c.API.Listen = []string{":" + PORT}
+	}
+	for _, entry := range c.API.Listen {
+		if _, _, err := splitListenEntry(entry); err != nil {
+			return fmt.Errorf("api.listen: %v", err)
+		}
+	}
+
+	if c.API.RateLimit.RequestsPerSecond < 0 {
+		return fmt.Errorf("api.rate_limit.requests_per_second must not be negative")
+	}
+	if c.API.RateLimit.Burst < 1 {
+		c.API.RateLimit.Burst = int(math.Max(1, math.Ceil(c.API.RateLimit.RequestsPerSecond)))
+	}
+	if c.API.MaxConcurrentCollections <= 0 {
+		c.API.MaxConcurrentCollections = 2
+	}
+	if c.API.CORS.AllowedOrigins == nil {
+		c.API.CORS.AllowedOrigins = []string{"*"}
+	}
+	if len(c.API.CORS.AllowedMethods) == 0 {
+		c.API.CORS.AllowedMethods = []string{"GET", "HEAD", "POST", "PUT", "DELETE", "OPTIONS"}
+	}
+	if len(c.API.CORS.AllowedHeaders) == 0 {
+		c.API.CORS.AllowedHeaders = []string{"Authorization", "Content-Type", "X-API-Key"}
+	}
+	for _, origin := range c.API.CORS.AllowedOrigins {
+		if origin == "*" && c.API.CORS.AllowCredentials {
+			return fmt.Errorf("api.cors: allow_credentials cannot be combined with the * origin")
+		}
+	}
+
+	keyNames := map[string]bool{}
+	for i := range c.API.Keys {
+		k := &c.API.Keys[i]
+		if k.Name == "" || k.Key == "" {
+			return fmt.Errorf("api.keys[%d]: name and key are required", i)
+		}
+		if keyNames[k.Name] {
+			return fmt.Errorf("api.keys: duplicate name %q", k.Name)
+		}
+		keyNames[k.Name] = true
+		if k.Scope == "" {
+			k.Scope = "read"
+		}
+		if k.Scope != "read" && k.Scope != "admin" {
+			return fmt.Errorf("api.keys %q: unknown scope %q (use read or admin)", k.Name, k.Scope)
+		}
+		for _, host := range k.Hosts {
+			if _, err := path.Match(host, ""); err != nil {
+				return fmt.Errorf("api.keys %q: invalid host pattern %q", k.Name, host)
+			}
+		}
+	}
+
+	var err error
+	if c.API.allowNets, err = parseIPNets(c.API.Allow); err != nil {
+		return fmt.Errorf("api.allow: %v", err)
+	}
+	if c.API.denyNets, err = parseIPNets(c.API.Deny); err != nil {
+		return fmt.Errorf("api.deny: %v", err)
+	}
+	return nil
+}
+
+// validateSchedule checks collection jitter, adaptive intervals and anomaly
+// detection.
+func (c *AgentConfig) validateSchedule() error {
+	if c.Schedule.JitterSeconds < 0 {
+		return fmt.Errorf("schedule.jitter_seconds must not be negative")
+	}
+
+	if c.Adaptive.FastIntervalSeconds <= 0 {
+		c.Adaptive.FastIntervalSeconds = 5
+	}
+	if c.Adaptive.CalmSamples <= 0 {
+		c.Adaptive.CalmSamples = 12
+	}
+	if err := validateWatchConditions(c.Adaptive.Watch); err != nil {
+		return err
+	}
+
+	if c.Anomaly.Sigma <= 0 {
+		c.Anomaly.Sigma = 3
+	}
+	if c.Anomaly.WindowSamples < 2 {
+		c.Anomaly.WindowSamples = 60
+	}
+	if c.Anomaly.MinSamples < 2 || c.Anomaly.MinSamples > c.Anomaly.WindowSamples {
+		c.Anomaly.MinSamples = c.Anomaly.WindowSamples / 3
+		if c.Anomaly.MinSamples < 2 {
+			c.Anomaly.MinSamples = 2
+		}
+	}
+	return nil
+}
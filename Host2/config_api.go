@@ -0,0 +1,245 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// runtimeSettings are the config keys that PUT /config may change.
+// Everything else still requires editing the file.
+type runtimeSettings struct {
+	IntervalSeconds int              `json:"interval_seconds"`
+	Collectors      map[string]bool  `json:"collectors"`
+	Thresholds      ThresholdsConfig `json:"thresholds"`
+}
+
+// Serializes read-modify-write cycles on the config file
+var configWriteMu sync.Mutex
+
+// cloneConfig deep-copies a configuration so an applied one is never
+// modified in place.
+func cloneConfig(cfg *AgentConfig) (*AgentConfig, error) {
+	data, err := json.Marshal(cfg)
+	if err != nil {
+		return nil, err
+	}
+	clone := &AgentConfig{}
+	if err := json.Unmarshal(data, clone); err != nil {
+		return nil, err
+	}
+	return clone, nil
+}
+
+// redactedConfig returns a copy of the configuration with credentials
+// masked, for display.
+func redactedConfig(cfg *AgentConfig) (*AgentConfig, error) {
+	clone, err := cloneConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+	redact := func(s *string) {
+		if *s != "" {
+			*s = "<redacted>"
+		}
+	}
+	redact(&clone.API.Token)
+	redact(&clone.Gossip.Secret)
+	redact(&clone.Gossip.APIKey)
+	redact(&clone.SNMP.Community)
+	for i := range clone.API.Keys {
+		redact(&clone.API.Keys[i].Key)
+	}
+	for key, value := range clone.Tunnel.Headers {
+		redact(&value)
+		clone.Tunnel.Headers[key] = value
+	}
+	for key, value := range clone.Registration.Headers {
+		redact(&value)
+		clone.Registration.Headers[key] = value
+	}
+	for i := range clone.Sinks {
+		s := &clone.Sinks[i]
+		for key, value := range s.Headers {
+			redact(&value)
+			s.Headers[key] = value
+		}
+		redact(&s.SecretAccessKey)
+		if parsed, err := url.Parse(s.URL); err == nil {
+			// The signature of an Azure SAS URL is its credential
+			if parsed.Query().Get("sig") != "" {
+				query := parsed.Query()
+				query.Set("sig", "<redacted>")
+				parsed.RawQuery = query.Encode()
+			}
+			// NATS, Redis, MQTT and Kafka take passwords and tokens in the URL
+			if parsed.User != nil {
+				if _, ok := parsed.User.Password(); ok {
+					parsed.User = url.UserPassword(parsed.User.Username(), "redacted")
+				} else {
+					parsed.User = url.User("redacted")
+				}
+			}
+			s.URL = parsed.String()
+		} else if scheme, rest, ok := strings.Cut(s.URL, "://"); ok {
+			// Kafka broker lists with several ports do not parse as a URL
+			if i := strings.LastIndex(rest, "@"); i >= 0 {
+				user, _, _ := strings.Cut(rest[:i], ":")
+				s.URL = scheme + "://" + user + ":redacted@" + rest[i+1:]
+			}
+		}
+	}
+	for i := range clone.SNMPDevices {
+		redact(&clone.SNMPDevices[i].Community)
+	}
+	for i := range clone.Notifiers {
+		n := &clone.Notifiers[i]
+		redact(&n.RoutingKey)
+		redact(&n.APIKey)
+		redact(&n.BotToken)
+		// Slack and Discord webhooks carry their token in the path
+		if parsed, err := url.Parse(n.URL); err == nil && (parsed.Path != "" || parsed.RawQuery != "" || parsed.User != nil) {
+			n.URL = (&url.URL{Scheme: parsed.Scheme, Host: parsed.Host, Path: "/redacted"}).String()
+		}
+		for key, value := range n.Headers {
+			redact(&value)
+			n.Headers[key] = value
+		}
+	}
+	return clone, nil
+}
+
+// persistSettings writes the runtime settings into the config file, keeping
+// every other key exactly as the user wrote it. The file is replaced
+// atomically.
+func persistSettings(settings runtimeSettings) error {
+	path, err := configPath()
+	if err != nil {
+		return err
+	}
+
+	raw := map[string]json.RawMessage{}
+	data, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to read config: %v", err)
+	}
+	if err == nil {
+		if err := json.Unmarshal(data, &raw); err != nil {
+			return fmt.Errorf("failed to parse %s: %v", path, err)
+		}
+	}
+
+	for key, value := range map[string]interface{}{
+		"interval_seconds": settings.IntervalSeconds,
+		"collectors":       settings.Collectors,
+		"thresholds":       settings.Thresholds,
+	} {
+		encoded, err := json.Marshal(value)
+		if err != nil {
+			return err
+		}
+		raw[key] = encoded
+	}
+
+	out, err := json.MarshalIndent(raw, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".agent_config-*.json")
+	if err != nil {
+		return fmt.Errorf("failed to write config: %v", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(append(out, '\n')); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write config: %v", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write config: %v", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to replace config: %v", err)
+	}
+	return nil
+}
+
+// updateSettings merges a JSON body of runtime settings over the active
+// configuration, persists it and applies it.
+func updateSettings(r *http.Request) (*AgentConfig, int, error) {
+	configWriteMu.Lock()
+	defer configWriteMu.Unlock()
+
+	cfg, err := cloneConfig(currentConfig())
+	if err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+
+	// Decoding over the current values makes partial updates work,
+	// including single threshold levels and individual collectors
+	settings := runtimeSettings{
+		IntervalSeconds: cfg.IntervalSeconds,
+		Collectors:      cfg.Collectors,
+		Thresholds:      cfg.Thresholds,
+	}
+	if settings.Collectors == nil {
+		settings.Collectors = map[string]bool{}
+	}
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&settings); err != nil {
+		return nil, http.StatusBadRequest, fmt.Errorf("invalid settings: %v", err)
+	}
+	if settings.IntervalSeconds <= 0 {
+		return nil, http.StatusBadRequest, fmt.Errorf("interval_seconds must be positive")
+	}
+
+	cfg.IntervalSeconds = settings.IntervalSeconds
+	cfg.Collectors = settings.Collectors
+	cfg.Thresholds = settings.Thresholds
+	if err := cfg.validate(); err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+
+	if err := persistSettings(settings); err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+	applyConfig(cfg)
+	return cfg, http.StatusOK, nil
+}
+
+// configResponse renders a configuration with credentials masked.
+func configResponse(w http.ResponseWriter, cfg *AgentConfig) {
+	redacted, err := redactedConfig(cfg)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to encode config: %v", err), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"config":    redacted,
+		"timestamp": time.Now().UTC().Format(time.RFC3339),
+	})
+}
+
+func configGetHandler(w http.ResponseWriter, r *http.Request) {
+	configResponse(w, currentConfig())
+}
+
+func configUpdateHandler(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, 64*1024)
+	updated, status, err := updateSettings(r)
+	if err != nil {
+		log.Printf("[CONFIG] Update rejected: %v", err)
+		http.Error(w, fmt.Sprintf("Update failed: %v", err), status)
+		return
+	}
+	log.Printf("[CONFIG] Runtime settings updated by %s", r.RemoteAddr)
+	configResponse(w, updated)
+}
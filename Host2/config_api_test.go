@@ -0,0 +1,48 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestRedactedConfig(t *testing.T) {
+	cfg := defaultConfig()
+	cfg.API.Token = "admin-token"
+	cfg.Gossip.Secret = "gossip-secret"
+	cfg.Gossip.APIKey = "gossip-key"
+	cfg.SNMP.Community = "agent-community"
+	cfg.SNMPDevices = []SNMPDeviceConfig{{Name: "core-switch", Host: "192.168.1.2", Community: "device-community"}}
+	cfg.Sinks = []SinkConfig{
+		{Type: "redis", URL: "redis://:sink-password@cache:6379/0"},
+		{Type: "kafka", URL: "kafkas://agent:kafka-password@k1:9093,k2:9093"},
+	}
+	cfg.Notifiers = []NotifierConfig{
+		{Type: "webhook", Name: "slack", URL: "https://hooks.slack.com/services/T0001/B0002/slack-token"},
+		{Type: "webhook", Name: "discord", URL: "https://discord.com/api/webhooks/123/discord-token?wait=true"},
+		{Type: "telegram", Name: "ops", BotToken: "bot-token", ChatID: "42"},
+	}
+
+	redacted, err := redactedConfig(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := json.Marshal(redacted)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, secret := range []string{"admin-token", "gossip-secret", "gossip-key", "agent-community", "device-community", "sink-password", "kafka-password", "slack-token", "discord-token", "bot-token"} {
+		if strings.Contains(string(data), secret) {
+			t.Errorf("%s is not redacted", secret)
+		}
+	}
+	if got := redacted.Notifiers[0].URL; got != "https://hooks.slack.com/redacted" {
+		t.Errorf("webhook URL %q, want the host kept", got)
+	}
+	if got := redacted.Sinks[1].URL; got != "kafkas://agent:redacted@k1:9093,k2:9093" {
+		t.Errorf("kafka URL %q, want the brokers kept", got)
+	}
+	if cfg.SNMP.Community != "agent-community" || cfg.Notifiers[0].URL != "https://hooks.slack.com/services/T0001/B0002/slack-token" {
+		t.Errorf("the applied configuration was modified")
+	}
+}
@@ -0,0 +1,261 @@
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ConnectivityInfo describes how the host reaches the outside world.
+type ConnectivityInfo struct {
+	Gateway           string   `json:"gateway"`
+	GatewayInterface  string   `json:"gateway_interface"`
+	DNSServers        []string `json:"dns_servers"`
+	PublicIP          string   `json:"public_ip,omitempty"`
+	PublicIPCheckedAt string   `json:"public_ip_checked_at,omitempty"`
+}
+
+// Last reported values, for change logging, and the cached public IP so the
+// lookup service is not asked on every collection
+var connectivityState = struct {
+	sync.Mutex
+	last     *ConnectivityInfo
+	publicIP string
+	checked  time.Time
+	url      string
+}{}
+
+// collectConnectivity returns the default gateway, DNS servers and public
+// IP when connectivity.enabled is set, or nil when disabled.
+func collectConnectivity() *ConnectivityInfo {
+	cfg := currentConfig().Connectivity
+	if !cfg.Enabled {
+		return nil
+	}
+
+	info := platformConnectivity()
+	if info.DNSServers == nil {
+		info.DNSServers = []string{}
+	}
+
+	connectivityState.Lock()
+	defer connectivityState.Unlock()
+
+	if cfg.PublicIP {
+		refresh := connectivityState.url != cfg.PublicIPURL ||
+			time.Since(connectivityState.checked) >= time.Duration(cfg.PublicIPIntervalSeconds)*time.Second
+		// A gateway change usually means a new uplink, so look again
+		if last := connectivityState.last; last != nil && last.Gateway != info.Gateway {
+			refresh = true
+		}
+		if refresh {
+			ip, err := lookupPublicIP(cfg)
+			if err != nil {
+				log.Printf("[NET] Public IP lookup via %s failed: %v", cfg.PublicIPURL, err)
+			} else {
+				connectivityState.publicIP = ip
+			}
+			connectivityState.checked = time.Now().UTC()
+			connectivityState.url = cfg.PublicIPURL
+		}
+		info.PublicIP = connectivityState.publicIP
+		if info.PublicIP != "" {
+			info.PublicIPCheckedAt = connectivityState.checked.Format("2006-01-02T15:04:05Z")
+		}
+	}
+
+	if last := connectivityState.last; last != nil {
+		logConnectivityChanges(last, info)
+	}
+	connectivityState.last = info
+	return info
+}
+
+func logConnectivityChanges(last, info *ConnectivityInfo) {
+	if last.Gateway != info.Gateway || last.GatewayInterface != info.GatewayInterface {
+		log.Printf("[NET] Default gateway changed from %s (%s) to %s (%s)", last.Gateway, last.GatewayInterface, info.Gateway, info.GatewayInterface)
+	}
+	if strings.Join(last.DNSServers, ",") != strings.Join(info.DNSServers, ",") {
+		log.Printf("[NET] DNS servers changed from [%s] to [%s]", strings.Join(last.DNSServers, ", "), strings.Join(info.DNSServers, ", "))
+	}
+	if last.PublicIP != "" && info.PublicIP != "" && last.PublicIP != info.PublicIP {
+		log.Printf("[NET] Public IP changed from %s to %s", last.PublicIP, info.PublicIP)
+	}
+}
+
+// lookupPublicIP asks the configured service, which must answer with the
+// address as plain text.
+func lookupPublicIP(cfg ConnectivityConfig) (string, error) {
+	client := &http.Client{Timeout: time.Duration(cfg.TimeoutMs) * time.Millisecond}
+	resp, err := client.Get(cfg.PublicIPURL)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 256))
+	if err != nil {
+		return "", err
+	}
+	ip := net.ParseIP(strings.TrimSpace(string(body)))
+	if ip == nil {
+		return "", fmt.Errorf("response is not an IP address: %q", strings.TrimSpace(string(body)))
+	}
+	return ip.String(), nil
+}
+
+// platformConnectivity finds the default gateway and DNS servers. Other
+// than on Linux and Windows it asks route(8), which prints "gateway:" and
+// "interface:" lines on macOS and the BSDs.
+func platformConnectivity() *ConnectivityInfo {
+	switch collectorOS {
+	case "linux":
+		return linuxConnectivity()
+	case "windows":
+		return windowsConnectivity()
+	}
+	info := &ConnectivityInfo{}
+	if data, err := hostFS.ReadFile("/etc/resolv.conf"); err == nil {
+		info.DNSServers = parseResolvConf(string(data))
+	}
+
+	out, err := commands.Output("route", "-n", "get", "default")
+	if err != nil {
+		return info
+	}
+	for _, line := range strings.Split(string(out), "\n") {
+		key, value, ok := strings.Cut(strings.TrimSpace(line), ":")
+		if !ok {
+			continue
+		}
+		switch key {
+		case "gateway":
+			info.Gateway = strings.TrimSpace(value)
+		case "interface":
+			info.GatewayInterface = strings.TrimSpace(value)
+		}
+	}
+	return info
+}
+
+// linuxConnectivity reads the routing tables and resolv.conf.
+func linuxConnectivity() *ConnectivityInfo {
+	info := &ConnectivityInfo{DNSServers: dnsServers()}
+	info.Gateway, info.GatewayInterface = defaultGateway()
+	return info
+}
+
+// defaultGateway reads the IPv4 routing table, falling back to IPv6 when
+// the host has no IPv4 default route.
+func defaultGateway() (string, string) {
+	if data, err := hostFS.ReadFile("/proc/net/route"); err == nil {
+		// Iface Destination Gateway Flags RefCnt Use Metric, addresses in
+		// host byte order; the lowest metric wins
+		var gateway, iface string
+		bestMetric := -1
+		for _, line := range strings.Split(string(data), "\n")[1:] {
+			fields := strings.Fields(line)
+			if len(fields) < 7 || fields[1] != "00000000" || fields[2] == "00000000" {
+				continue
+			}
+			raw, err := hex.DecodeString(fields[2])
+			metric, merr := strconv.Atoi(fields[6])
+			if err != nil || merr != nil || len(raw) != 4 {
+				continue
+			}
+			if bestMetric >= 0 && metric >= bestMetric {
+				continue
+			}
+			gateway, iface, bestMetric = net.IPv4(raw[3], raw[2], raw[1], raw[0]).String(), fields[0], metric
+		}
+		if gateway != "" {
+			return gateway, iface
+		}
+	}
+
+	if data, err := hostFS.ReadFile("/proc/net/ipv6_route"); err == nil {
+		// dest prefixlen src srclen nexthop metric refcnt use flags iface
+		for _, line := range strings.Split(string(data), "\n") {
+			fields := strings.Fields(line)
+			if len(fields) < 10 || fields[1] != "00" || strings.Trim(fields[0], "0") != "" || strings.Trim(fields[4], "0") == "" {
+				continue
+			}
+			raw, err := hex.DecodeString(fields[4])
+			if err != nil || len(raw) != 16 {
+				continue
+			}
+			return net.IP(raw).String(), fields[9]
+		}
+	}
+	return "", ""
+}
+
+// dnsServers reads resolv.conf. With systemd-resolved the file only lists
+// the local stub, so the upstream servers are taken from resolved's own copy.
+func dnsServers() []string {
+	data, err := hostFS.ReadFile("/etc/resolv.conf")
+	if err != nil {
+		return nil
+	}
+	servers := parseResolvConf(string(data))
+	if len(servers) == 1 && servers[0] == "127.0.0.53" {
+		if upstream, err := hostFS.ReadFile("/run/systemd/resolve/resolv.conf"); err == nil {
+			if found := parseResolvConf(string(upstream)); len(found) > 0 {
+				return found
+			}
+		}
+	}
+	return servers
+}
+
+// Default route with the lowest combined metric, and the DNS servers of
+// every interface that is up
+const connectivityScript = `$route = Get-NetRoute -DestinationPrefix '0.0.0.0/0','::/0' -ErrorAction SilentlyContinue |
+  Where-Object { $_.NextHop -ne '0.0.0.0' -and $_.NextHop -ne '::' } |
+  Sort-Object { $_.RouteMetric + $_.InterfaceMetric } | Select-Object -First 1
+$up = @(Get-NetAdapter -ErrorAction SilentlyContinue | Where-Object { $_.Status -eq 'Up' } | ForEach-Object { $_.ifIndex })
+$dns = Get-DnsClientServerAddress -ErrorAction SilentlyContinue |
+  Where-Object { $up -contains $_.InterfaceIndex } | ForEach-Object { $_.ServerAddresses }
+ConvertTo-Json -Compress -InputObject ([pscustomobject]@{ Gateway = $route.NextHop; Interface = $route.InterfaceAlias; DNS = @($dns | Select-Object -Unique) })`
+
+// windowsConnectivity asks PowerShell's networking cmdlets.
+func windowsConnectivity() *ConnectivityInfo {
+	info := &ConnectivityInfo{}
+	out, err := commands.Output("powershell", "-NoProfile", "-Command", connectivityScript)
+	if err != nil {
+		return info
+	}
+
+	var result struct {
+		Gateway   string   `json:"Gateway"`
+		Interface string   `json:"Interface"`
+		DNS       []string `json:"DNS"`
+	}
+	if err := json.Unmarshal([]byte(strings.TrimSpace(string(out))), &result); err != nil {
+		return info
+	}
+	info.Gateway, info.GatewayInterface, info.DNSServers = result.Gateway, result.Interface, result.DNS
+	return info
+}
+
+// parseResolvConf returns the nameserver entries of a resolv.conf file.
+func parseResolvConf(data string) []string {
+	var servers []string
+	for _, line := range strings.Split(data, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) >= 2 && fields[0] == "nameserver" {
+			servers = append(servers, fields[1])
+		}
+	}
+	return servers
+}
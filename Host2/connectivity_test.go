@@ -0,0 +1,134 @@
+package main
+
+import (
+	"reflect"
+	"slices"
+	"testing"
+)
+
+func TestDefaultGateway(t *testing.T) {
+	const header = "Iface\tDestination\tGateway \tFlags\tRefCnt\tUse\tMetric\tMask\t\tMTU\tWindow\tIRTT\n"
+	tests := []struct {
+		name  string
+		files map[string]string
+		gw    string
+		iface string
+	}{
+		{
+			name: "lowest metric wins",
+			files: map[string]string{"/proc/net/route": header +
+				"wlan0\t00000000\t0102A8C0\t0003\t0\t0\t600\t00000000\t0\t0\t0\n" +
+				"eth0\t00000000\t0100000A\t0003\t0\t0\t100\t00000000\t0\t0\t0\n" +
+				"eth0\t0000000A\t00000000\t0001\t0\t0\t100\t00FFFFFF\t0\t0\t0\n"},
+			gw:    "10.0.0.1",
+			iface: "eth0",
+		},
+		{
+			name: "IPv6 only",
+			files: map[string]string{
+				"/proc/net/route":      header,
+				"/proc/net/ipv6_route": "00000000000000000000000000000000 00 00000000000000000000000000000000 00 fe800000000000000000000000000001 00000400 00000001 00000000 00000003 eth0\n",
+			},
+			gw:    "fe80::1",
+			iface: "eth0",
+		},
+		{
+			name: "no default route",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			withHost(t, nil, newFakeFS(tt.files), nil)
+			gw, iface := defaultGateway()
+			if gw != tt.gw || iface != tt.iface {
+				t.Errorf("got %q via %q, want %q via %q", gw, iface, tt.gw, tt.iface)
+			}
+		})
+	}
+}
+
+func TestDNSServers(t *testing.T) {
+	tests := []struct {
+		name  string
+		files map[string]string
+		want  []string
+	}{
+		{
+			name:  "plain resolv.conf",
+			files: map[string]string{"/etc/resolv.conf": "# generated\nsearch example.com\nnameserver 1.1.1.1\nnameserver 9.9.9.9\n"},
+			want:  []string{"1.1.1.1", "9.9.9.9"},
+		},
+		{
+			name: "systemd-resolved stub",
+			files: map[string]string{
+				"/etc/resolv.conf":                 "nameserver 127.0.0.53\noptions edns0\n",
+				"/run/systemd/resolve/resolv.conf": "nameserver 192.168.1.1\n",
+			},
+			want: []string{"192.168.1.1"},
+		},
+		{
+			name:  "stub without resolved's copy",
+			files: map[string]string{"/etc/resolv.conf": "nameserver 127.0.0.53\n"},
+			want:  []string{"127.0.0.53"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			withHost(t, nil, newFakeFS(tt.files), nil)
+			if got := dnsServers(); !slices.Equal(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPlatformConnectivity(t *testing.T) {
+	tests := []struct {
+		name    string
+		goos    string
+		files   map[string]string
+		outputs map[string]string
+		want    ConnectivityInfo
+	}{
+		{
+			name: "Linux",
+			goos: "linux",
+			files: map[string]string{
+				"/proc/net/route":  "Iface\tDestination\tGateway\nenp3s0\t00000000\t0101A8C0\t0003\t0\t0\t0\t00000000\t0\t0\t0\n",
+				"/etc/resolv.conf": "nameserver 192.168.1.1\n",
+			},
+			want: ConnectivityInfo{Gateway: "192.168.1.1", GatewayInterface: "enp3s0", DNSServers: []string{"192.168.1.1"}},
+		},
+		{
+			name: "Windows",
+			goos: "windows",
+			outputs: map[string]string{
+				"powershell -NoProfile -Command " + connectivityScript: `{"Gateway":"10.0.0.1","Interface":"Ethernet","DNS":["10.0.0.2","1.1.1.1"]}` + "\r\n",
+			},
+			want: ConnectivityInfo{Gateway: "10.0.0.1", GatewayInterface: "Ethernet", DNSServers: []string{"10.0.0.2", "1.1.1.1"}},
+		},
+		{
+			name:  "macOS",
+			goos:  "darwin",
+			files: map[string]string{"/etc/resolv.conf": "nameserver 192.168.0.1\n"},
+			outputs: map[string]string{
+				"route -n get default": "   route to: default\ndestination: default\n       mask: default\n    gateway: 192.168.0.1\n  interface: en0\n      flags: <UP,GATEWAY,DONE,STATIC,PRCLONING>\n",
+			},
+			want: ConnectivityInfo{Gateway: "192.168.0.1", GatewayInterface: "en0", DNSServers: []string{"192.168.0.1"}},
+		},
+		{
+			name: "FreeBSD without a default route",
+			goos: "freebsd",
+			want: ConnectivityInfo{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			withHost(t, &fakeRunner{outputs: tt.outputs}, newFakeFS(tt.files), nil)
+			withOS(t, tt.goos)
+			if got := platformConnectivity(); !reflect.DeepEqual(*got, tt.want) {
+				t.Errorf("got %+v, want %+v", *got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,22 @@
+package main
+
+import (
+	"embed"
+	"net/http"
+)
+
+//go:embed dashboard/index.html
+var dashboardFS embed.FS
+
+// dashboardHandler serves the single-page dashboard. It polls /metrics and
+// draws sparklines from /history, so it needs no other assets.
+func dashboardHandler(w http.ResponseWriter, r *http.Request) {
+	page, err := dashboardFS.ReadFile("dashboard/index.html")
+	if err != nil {
+		http.Error(w, "Dashboard not available", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Write(page)
+}
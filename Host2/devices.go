@@ -0,0 +1,409 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// HardwareDevice is an attached USB or PCI device.
+type HardwareDevice struct {
+	Bus       string `json:"bus"`        // "usb" or "pci"
+	Address   string `json:"address"`    // e.g. "1-1.2" or "0000:00:1f.3"; the instance ID on Windows
+	VendorID  string `json:"vendor_id"`  // e.g. "8086"
+	ProductID string `json:"product_id"` // e.g. "a348"
+	Vendor    string `json:"vendor,omitempty"`
+	Product   string `json:"product,omitempty"`
+	Class     string `json:"class,omitempty"`  // e.g. "0x030000" (PCI), "Net" (Windows)
+	Driver    string `json:"driver,omitempty"` // bound kernel driver(s) or service
+	FirstSeen string `json:"first_seen"`       // when the agent first saw it attached
+}
+
+// DeviceChange is a device attached or removed between two scans.
+type DeviceChange struct {
+	Time   string         `json:"time"`
+	Action string         `json:"action"` // "attached" or "removed"
+	Device HardwareDevice `json:"device"`
+}
+
+// Device changes kept for /inventory/devices
+const DEVICE_CHANGE_HISTORY = 100
+
+// Devices of the last scan, the ones present at the first scan after start
+// (which never alert) and recent changes
+var deviceState = struct {
+	sync.Mutex
+	devices  []HardwareDevice
+	baseline map[string]bool
+	changes  []DeviceChange
+	scanned  time.Time
+	err      string
+}{}
+
+func (d HardwareDevice) key() string {
+	return d.Bus + "|" + d.Address + "|" + d.VendorID + ":" + d.ProductID
+}
+
+// startDeviceWatch scans the USB and PCI buses every
+// inventory.device_interval_seconds while inventory.devices is set.
+func startDeviceWatch() {
+	for {
+		cfg := currentConfig().Inventory
+		reloaded := configReloaded()
+		if !cfg.Devices {
+			deviceState.Lock()
+			deviceState.devices, deviceState.baseline, deviceState.changes, deviceState.scanned = nil, nil, nil, time.Time{}
+			deviceState.Unlock()
+			syncAlerts("device_attached:", nil)
+			<-reloaded
+			continue
+		}
+
+		for running := true; running; {
+			scanDevices(cfg)
+			select {
+			case <-time.After(time.Duration(cfg.DeviceIntervalSeconds) * time.Second):
+			case <-reloaded:
+				running = false
+			}
+		}
+	}
+}
+
+// scanDevices lists the devices, records what changed since the last scan
+// and alerts on devices that were not attached at the first scan.
+func scanDevices(cfg InventoryConfig) {
+	devices, err := listDevices()
+	now := clock.Now().UTC()
+	stamp := now.Format("2006-01-02T15:04:05Z")
+
+	deviceState.Lock()
+	if err != nil {
+		if deviceState.err == "" {
+			log.Printf("[INVENTORY] Listing devices failed: %s", describeCollectorError(err))
+		}
+		deviceState.err = describeCollectorError(err)
+		deviceState.scanned = now
+		deviceState.Unlock()
+		return
+	}
+	deviceState.err = ""
+
+	previous := make(map[string]HardwareDevice, len(deviceState.devices))
+	for _, d := range deviceState.devices {
+		previous[d.key()] = d
+	}
+	current := make(map[string]bool, len(devices))
+	for i := range devices {
+		key := devices[i].key()
+		current[key] = true
+		if old, ok := previous[key]; ok {
+			devices[i].FirstSeen = old.FirstSeen
+			continue
+		}
+		devices[i].FirstSeen = stamp
+		if deviceState.baseline != nil {
+			deviceState.changes = append(deviceState.changes, DeviceChange{stamp, "attached", devices[i]})
+			log.Printf("[INVENTORY] %s device attached: %s", strings.ToUpper(devices[i].Bus), describeDevice(devices[i]))
+		}
+	}
+	for key, d := range previous {
+		if !current[key] {
+			deviceState.changes = append(deviceState.changes, DeviceChange{stamp, "removed", d})
+			log.Printf("[INVENTORY] %s device removed: %s", strings.ToUpper(d.Bus), describeDevice(d))
+		}
+	}
+	if len(deviceState.changes) > DEVICE_CHANGE_HISTORY {
+		deviceState.changes = append([]DeviceChange{}, deviceState.changes[len(deviceState.changes)-DEVICE_CHANGE_HISTORY:]...)
+	}
+	if deviceState.baseline == nil {
+		deviceState.baseline = current
+	}
+	baseline := deviceState.baseline
+	deviceState.devices = devices
+	deviceState.scanned = now
+	deviceState.Unlock()
+
+	var firing []Alert
+	if cfg.AlertNewDevices {
+		allowed := make(map[string]bool, len(cfg.AllowedDevices))
+		for _, id := range cfg.AllowedDevices {
+			allowed[id] = true
+		}
+		for _, d := range devices {
+			if baseline[d.key()] || allowed[d.VendorID+":"+d.ProductID] {
+				continue
+			}
+			firing = append(firing, Alert{
+				ID:       "device_attached:" + d.Bus + ":" + d.Address,
+				Rule:     "device_attached",
+				Severity: "warning",
+				Message:  fmt.Sprintf("%s device attached at %s: %s", strings.ToUpper(d.Bus), d.Address, describeDevice(d)),
+			})
+		}
+	}
+	syncAlerts("device_attached:", firing)
+}
+
+func describeDevice(d HardwareDevice) string {
+	name := strings.TrimSpace(d.Vendor + " " + d.Product)
+	if name == "" {
+		return d.VendorID + ":" + d.ProductID
+	}
+	return fmt.Sprintf("%s (%s:%s)", name, d.VendorID, d.ProductID)
+}
+
+// inventoryDevicesHandler serves the devices of the last scan and recent
+// changes, optionally only one bus (?bus=usb|pci).
+func inventoryDevicesHandler(w http.ResponseWriter, r *http.Request) {
+	if !currentConfig().Inventory.Devices {
+		http.Error(w, "Device inventory is disabled (inventory.devices)", http.StatusNotFound)
+		return
+	}
+	bus := r.URL.Query().Get("bus")
+	if bus != "" && bus != "usb" && bus != "pci" {
+		http.Error(w, "bus must be usb or pci", http.StatusBadRequest)
+		return
+	}
+
+	deviceState.Lock()
+	defer deviceState.Unlock()
+	if deviceState.scanned.IsZero() {
+		w.Header().Set("Retry-After", "5")
+		http.Error(w, "Devices not scanned yet", http.StatusServiceUnavailable)
+		return
+	}
+	devices := []HardwareDevice{}
+	for _, d := range deviceState.devices {
+		if bus == "" || d.Bus == bus {
+			devices = append(devices, d)
+		}
+	}
+	changes := []DeviceChange{}
+	for _, c := range deviceState.changes {
+		if bus == "" || c.Device.Bus == bus {
+			changes = append(changes, c)
+		}
+	}
+	response := map[string]interface{}{
+		"count":      len(devices),
+		"devices":    devices,
+		"changes":    changes,
+		"scanned_at": deviceState.scanned.Format("2006-01-02T15:04:05Z"),
+	}
+	if deviceState.err != "" {
+		response["error"] = deviceState.err
+	}
+	writeJSON(w, http.StatusOK, response)
+}
+
+// listDevices returns the USB and PCI devices ordered by bus and address.
+func listDevices() ([]HardwareDevice, error) {
+	var devices []HardwareDevice
+	var err error
+	switch collectorOS {
+	case "linux":
+		devices = append(sysfsPCIDevices(), sysfsUSBDevices()...)
+	case "windows":
+		devices, err = pnpDevices()
+	default:
+		return nil, fmt.Errorf("not supported on %s", collectorOS)
+	}
+	if devices == nil {
+		devices = []HardwareDevice{}
+	}
+	sort.Slice(devices, func(i, j int) bool {
+		if devices[i].Bus != devices[j].Bus {
+			return devices[i].Bus < devices[j].Bus
+		}
+		return devices[i].Address < devices[j].Address
+	})
+	return devices, err
+}
+
+// ueventValue returns a KEY=value entry of a sysfs uevent file.
+func ueventValue(uevent, key string) string {
+	for _, line := range strings.Split(uevent, "\n") {
+		if value, ok := strings.CutPrefix(line, key+"="); ok {
+			return value
+		}
+	}
+	return ""
+}
+
+// sysfsPCIDevices reads /sys/bus/pci/devices, naming devices from the
+// pci.ids database when it is installed.
+func sysfsPCIDevices() []HardwareDevice {
+	var devices []HardwareDevice
+	dirs, _ := hostFS.Glob("/sys/bus/pci/devices/*")
+	for _, dir := range dirs {
+		uevent := readTrimmed(filepath.Join(dir, "uevent"))
+		vendor, product, _ := strings.Cut(strings.ToLower(ueventValue(uevent, "PCI_ID")), ":")
+		if vendor == "" {
+			continue
+		}
+		d := HardwareDevice{
+			Bus:       "pci",
+			Address:   filepath.Base(dir),
+			VendorID:  vendor,
+			ProductID: product,
+			Class:     readTrimmed(filepath.Join(dir, "class")),
+			Driver:    ueventValue(uevent, "DRIVER"),
+		}
+		d.Vendor, d.Product = pciIDs.lookup(vendor, product)
+		devices = append(devices, d)
+	}
+	return devices
+}
+
+// usbInterfacePattern matches interface entries such as "1-1.2:1.0"; the
+// devices themselves are "1-1.2" and the root hubs "usb1".
+var usbInterfacePattern = regexp.MustCompile(`:\d+\.\d+$`)
+
+// sysfsUSBDevices reads /sys/bus/usb/devices with the names the devices
+// report and the drivers bound to their interfaces.
+func sysfsUSBDevices() []HardwareDevice {
+	var devices []HardwareDevice
+	entries, _ := hostFS.Glob("/sys/bus/usb/devices/*")
+	drivers := map[string][]string{}
+	for _, entry := range entries {
+		name := filepath.Base(entry)
+		if !usbInterfacePattern.MatchString(name) {
+			continue
+		}
+		parent := name[:strings.LastIndex(name, ":")]
+		if driver := ueventValue(readTrimmed(filepath.Join(entry, "uevent")), "DRIVER"); driver != "" && !slices.Contains(drivers[parent], driver) {
+			drivers[parent] = append(drivers[parent], driver)
+		}
+	}
+	for _, entry := range entries {
+		name := filepath.Base(entry)
+		vendor := readTrimmed(filepath.Join(entry, "idVendor"))
+		if usbInterfacePattern.MatchString(name) || vendor == "" {
+			continue
+		}
+		devices = append(devices, HardwareDevice{
+			Bus:       "usb",
+			Address:   name,
+			VendorID:  vendor,
+			ProductID: readTrimmed(filepath.Join(entry, "idProduct")),
+			Vendor:    readTrimmed(filepath.Join(entry, "manufacturer")),
+			Product:   readTrimmed(filepath.Join(entry, "product")),
+			Class:     readTrimmed(filepath.Join(entry, "bDeviceClass")),
+			Driver:    strings.Join(drivers[name], ","),
+		})
+	}
+	return devices
+}
+
+// idsDatabase resolves vendor and device names from a pci.ids file. Names
+// are looked up by scanning the file once per unknown ID pair, as only a
+// few dozen devices are ever present.
+type idsDatabase struct {
+	mu    sync.Mutex
+	paths []string
+	names map[string][2]string
+}
+
+var pciIDs = &idsDatabase{paths: []string{"/usr/share/misc/pci.ids", "/usr/share/hwdata/pci.ids", "/usr/share/pci.ids"}}
+
+func (db *idsDatabase) lookup(vendor, device string) (string, string) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	if db.names == nil {
+		db.names = make(map[string][2]string)
+	}
+	if names, ok := db.names[vendor+":"+device]; ok {
+		return names[0], names[1]
+	}
+
+	var names [2]string
+	for _, path := range db.paths {
+		file, err := hostFS.Open(path)
+		if err != nil {
+			continue
+		}
+		// Vendors start a line ("8086  Intel Corporation"), their devices
+		// follow indented by one tab, subsystems by two
+		inVendor := false
+		scanner := bufio.NewScanner(file)
+		for scanner.Scan() {
+			line := scanner.Text()
+			if line == "" || line[0] == '#' {
+				continue
+			}
+			if line[0] != '\t' {
+				if inVendor {
+					break // the next vendor
+				}
+				if id, name, ok := strings.Cut(line, "  "); ok && id == vendor {
+					names[0], inVendor = name, true
+				}
+				continue
+			}
+			if inVendor && !strings.HasPrefix(line, "\t\t") {
+				if id, name, ok := strings.Cut(line[1:], "  "); ok && id == device {
+					names[1] = name
+					break
+				}
+			}
+		}
+		file.Close()
+		break
+	}
+	db.names[vendor+":"+device] = names
+	return names[0], names[1]
+}
+
+// pnpDeviceScript lists present USB and PCI devices from WMI.
+const pnpDeviceScript = `@(Get-CimInstance Win32_PnPEntity -Filter "DeviceID LIKE 'USB\\%' OR DeviceID LIKE 'PCI\\%'" |
+  Select-Object DeviceID, Name, Manufacturer, Service, PNPClass) | ConvertTo-Json -Compress`
+
+// pnpIDPattern extracts the IDs of "PCI\VEN_8086&DEV_A348&..." and
+// "USB\VID_046D&PID_C52B\...".
+var pnpIDPattern = regexp.MustCompile(`(?i)(?:VEN|VID)_([0-9A-F]{4})&(?:DEV|PID)_([0-9A-F]{4})`)
+
+func pnpDevices() ([]HardwareDevice, error) {
+	output, err := commands.Output("powershell", "-NoProfile", "-Command", pnpDeviceScript)
+	if err != nil {
+		return nil, err
+	}
+	var entries []struct{ DeviceID, Name, Manufacturer, Service, PNPClass string }
+	if err := json.Unmarshal(bytes.TrimSpace(output), &entries); err != nil {
+		return nil, fmt.Errorf("unexpected output: %v", err)
+	}
+	var devices []HardwareDevice
+	for _, e := range entries {
+		ids := pnpIDPattern.FindStringSubmatch(e.DeviceID)
+		if ids == nil {
+			// USB interfaces of composite devices ("USB\VID_...&MI_00") are
+			// listed with the device; hubs without IDs are skipped
+			continue
+		}
+		if strings.Contains(strings.ToUpper(e.DeviceID), "&MI_") {
+			continue
+		}
+		bus, _, _ := strings.Cut(strings.ToLower(e.DeviceID), `\`)
+		devices = append(devices, HardwareDevice{
+			Bus:       bus,
+			Address:   e.DeviceID,
+			VendorID:  strings.ToLower(ids[1]),
+			ProductID: strings.ToLower(ids[2]),
+			Vendor:    e.Manufacturer,
+			Product:   e.Name,
+			Class:     e.PNPClass,
+			Driver:    e.Service,
+		})
+	}
+	return devices, nil
+}
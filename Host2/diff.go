@@ -0,0 +1,126 @@
+package main
+
+import (
+	"net/http"
+	"sort"
+	"time"
+)
+
+// SeriesDiff is the change of one series between two snapshots.
+type SeriesDiff struct {
+	From  float64 `json:"from"`
+	To    float64 `json:"to"`
+	Delta float64 `json:"delta"`
+}
+
+type NetworkDiff struct {
+	Iface   string  `json:"iface"`
+	RxBytes float64 `json:"rx_bytes"`
+	TxBytes float64 `json:"tx_bytes"`
+}
+
+type DiskDiff struct {
+	Device       string  `json:"device"`
+	UsedGBChange float64 `json:"used_gb_change"`
+}
+
+// snapshotNear returns the raw sample closest to t.
+func (h *historyStore) snapshotNear(t time.Time) (historySample, bool) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	if len(h.samples) == 0 {
+		return historySample{}, false
+	}
+	i := sort.Search(len(h.samples), func(i int) bool { return !h.samples[i].Time.Before(t) })
+	switch {
+	case i == len(h.samples):
+		i--
+	case i > 0 && t.Sub(h.samples[i-1].Time) < h.samples[i].Time.Sub(t):
+		i--
+	}
+	return h.samples[i], true
+}
+
+// counterDelta handles counters that reset (reboot, interface re-creation)
+// by counting from zero.
+func counterDelta(from, to float64) float64 {
+	if to < from {
+		return to
+	}
+	return to - from
+}
+
+// metricsDiffHandler compares the stored snapshots nearest to ?from= and
+// ?to= (RFC3339 or unix seconds; to defaults to now).
+func metricsDiffHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	if query.Get("from") == "" {
+		http.Error(w, "from is required (RFC3339 or unix seconds)", http.StatusBadRequest)
+		return
+	}
+	fromTime, err := parseTimeParam(query.Get("from"))
+	if err != nil {
+		http.Error(w, "from must be RFC3339 or unix seconds", http.StatusBadRequest)
+		return
+	}
+	toTime := time.Now().UTC()
+	if v := query.Get("to"); v != "" {
+		if toTime, err = parseTimeParam(v); err != nil {
+			http.Error(w, "to must be RFC3339 or unix seconds", http.StatusBadRequest)
+			return
+		}
+	}
+
+	before, ok := history.snapshotNear(fromTime)
+	after, _ := history.snapshotNear(toTime)
+	if !ok {
+		http.Error(w, "No history recorded yet", http.StatusNotFound)
+		return
+	}
+
+	series := map[string]SeriesDiff{}
+	network := []NetworkDiff{}
+	disks := []DiskDiff{}
+	for key, to := range after.Values {
+		from, ok := before.Values[key]
+		if !ok {
+			continue
+		}
+		series[key] = SeriesDiff{From: from, To: to, Delta: to - from}
+	}
+
+	keys := make([]string, 0, len(series))
+	for key := range series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		name, labels := history.seriesInfo(key)
+		switch name {
+		case "network_rx_bytes":
+			tx := series[seriesKey("network_tx_bytes", labels)]
+			network = append(network, NetworkDiff{
+				Iface:   labels["iface"],
+				RxBytes: counterDelta(series[key].From, series[key].To),
+				TxBytes: counterDelta(tx.From, tx.To),
+			})
+		case "disk_used_gb":
+			disks = append(disks, DiskDiff{Device: labels["device"], UsedGBChange: series[key].Delta})
+		}
+	}
+
+	uptime := series["uptime_seconds"]
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"from":                     before.Time.Format("2006-01-02T15:04:05Z"),
+		"to":                       after.Time.Format("2006-01-02T15:04:05Z"),
+		"elapsed_seconds":          after.Time.Sub(before.Time).Seconds(),
+		"uptime_delta_seconds":     uptime.Delta,
+		"rebooted":                 uptime.To < uptime.From,
+		"temperature_change":       series["temperature_cpu_celsius"].Delta,
+		"cpu_usage_percent_change": series["cpu_usage_percent"].Delta,
+		"memory_used_mb_change":    series["memory_used_mb"].Delta,
+		"network":                  network,
+		"disk":                     disks,
+		"series":                   series,
+	})
+}
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+type DirWatchInfo struct {
+	Name           string  `json:"name"`
+	Path           string  `json:"path"`
+	SizeBytes      int64   `json:"size_bytes"`
+	SizeMB         float64 `json:"size_mb"`
+	FileCount      int     `json:"file_count"`
+	DirCount       int     `json:"dir_count"`
+	GrowthBytes    int64   `json:"growth_bytes"`
+	ScanDurationMs float64 `json:"scan_duration_ms"`
+	LastScan       string  `json:"last_scan"`
+	Status         string  `json:"status"`
+	Error          string  `json:"error,omitempty"`
+}
+
+// dirListing caches the entries of one directory. While the directory's
+// mtime is unchanged its entries are the same, so only file sizes need to
+// be refreshed and the directory itself is not re-read.
+type dirListing struct {
+	modTime time.Time
+	files   []string
+	subdirs []string
+}
+
+// dirScanner measures one watched tree, reusing listings between scans.
+type dirScanner struct {
+	cfg      DirWatchConfig
+	listings map[string]*dirListing
+	lastSize int64
+	scanned  bool
+}
+
+var (
+	dirWatchMu     sync.RWMutex
+	latestDirWatch = []DirWatchInfo{}
+)
+
+func latestDirWatchResults() []DirWatchInfo {
+	dirWatchMu.RLock()
+	defer dirWatchMu.RUnlock()
+	return append([]DirWatchInfo{}, latestDirWatch...)
+}
+
+func newDirScanner(cfg DirWatchConfig) *dirScanner {
+	return &dirScanner{cfg: cfg, listings: make(map[string]*dirListing)}
+}
+
+func (s *dirScanner) scan() DirWatchInfo {
+	start := time.Now()
+	result := DirWatchInfo{
+		Name:     s.cfg.Name,
+		Path:     s.cfg.Path,
+		LastScan: start.UTC().Format("2006-01-02T15:04:05Z"),
+		Status:   "ok",
+	}
+
+	if _, err := os.Stat(s.cfg.Path); err != nil {
+		result.Status = "error"
+		result.Error = err.Error()
+		return result
+	}
+
+	seen := make(map[string]bool)
+	s.walk(s.cfg.Path, &result, seen)
+
+	// Forget directories that no longer exist
+	for dir := range s.listings {
+		if !seen[dir] {
+			delete(s.listings, dir)
+		}
+	}
+
+	if s.scanned {
+		result.GrowthBytes = result.SizeBytes - s.lastSize
+	}
+	s.lastSize, s.scanned = result.SizeBytes, true
+
+	result.SizeMB = float64(result.SizeBytes) / 1024 / 1024
+	result.ScanDurationMs = float64(time.Since(start).Microseconds()) / 1000
+	return result
+}
+
+func (s *dirScanner) walk(dir string, result *DirWatchInfo, seen map[string]bool) {
+	info, err := os.Lstat(dir)
+	if err != nil {
+		return
+	}
+	seen[dir] = true
+	result.DirCount++
+
+	listing, ok := s.listings[dir]
+	if !ok || !listing.modTime.Equal(info.ModTime()) {
+		listing = readDirListing(dir, info.ModTime())
+		s.listings[dir] = listing
+	}
+
+	for _, file := range listing.files {
+		fileInfo, err := os.Lstat(file)
+		if err != nil {
+			continue
+		}
+		result.SizeBytes += fileInfo.Size()
+		result.FileCount++
+	}
+	for _, subdir := range listing.subdirs {
+		s.walk(subdir, result, seen)
+	}
+}
+
+// readDirListing reads a directory, skipping symlinks so the walk never
+// leaves the watched tree or loops.
+func readDirListing(dir string, modTime time.Time) *dirListing {
+	listing := &dirListing{modTime: modTime}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return listing
+	}
+	for _, entry := range entries {
+		path := filepath.Join(dir, entry.Name())
+		switch {
+		case entry.Type()&os.ModeSymlink != 0:
+			continue
+		case entry.IsDir():
+			listing.subdirs = append(listing.subdirs, path)
+		case entry.Type().IsRegular():
+			listing.files = append(listing.files, path)
+		}
+	}
+	return listing
+}
+
+func evaluateDirAlert(cfg DirWatchConfig, result DirWatchInfo) {
+	if cfg.AlertSizeMB <= 0 {
+		return
+	}
+	id := "dir_size:" + cfg.Name
+	if result.Status == "ok" && result.SizeMB >= cfg.AlertSizeMB {
+		raiseAlert(Alert{
+			ID:       id,
+			Rule:     "dir_size",
+			Severity: "warning",
+			Message:  fmt.Sprintf("%s is %.0f MB (limit %.0f MB)", cfg.Path, result.SizeMB, cfg.AlertSizeMB),
+			Value:    result.SizeMB,
+		})
+	} else {
+		resolveAlert(id)
+	}
+}
+
+// startDirWatchers scans the configured directories until the process
+// exits. Scanners (and their cached listings) survive a config reload when
+// the directory settings are unchanged.
+func startDirWatchers() {
+	scanners := make(map[DirWatchConfig]*dirScanner)
+	for {
+		cfg := currentConfig().DirWatch
+		reloaded := configReloaded()
+
+		current := make(map[DirWatchConfig]*dirScanner, len(cfg.Directories))
+		ordered := make([]*dirScanner, len(cfg.Directories))
+		for i, dirCfg := range cfg.Directories {
+			scanner, ok := scanners[dirCfg]
+			if !ok {
+				scanner = newDirScanner(dirCfg)
+			}
+			current[dirCfg] = scanner
+			ordered[i] = scanner
+		}
+		scanners = current
+
+		if len(ordered) == 0 {
+			dirWatchMu.Lock()
+			latestDirWatch = []DirWatchInfo{}
+			dirWatchMu.Unlock()
+			<-reloaded
+			continue
+		}
+
+		interval := time.Duration(cfg.IntervalSeconds) * time.Second
+		log.Printf("[DIRWATCH] Watching %d directories (interval: %v)", len(ordered), interval)
+
+		for running := true; running; {
+			results := make([]DirWatchInfo, len(ordered))
+			for i, scanner := range ordered {
+				results[i] = scanner.scan()
+				evaluateDirAlert(scanner.cfg, results[i])
+			}
+
+			dirWatchMu.Lock()
+			latestDirWatch = results
+			dirWatchMu.Unlock()
+
+			select {
+			case <-time.After(interval):
+			case <-reloaded:
+				running = false
+			}
+		}
+	}
+}
@@ -0,0 +1,23 @@
+package main
+
+// DiskIOInfo reports per-device I/O rates and latency as iostat -x does,
+// averaged since the previous sample.
+type DiskIOInfo struct {
+	Devices []DiskDeviceIO `json:"devices"`
+	Status  string         `json:"status"`
+}
+
+type DiskDeviceIO struct {
+	Device        string  `json:"device"`
+	Name          string  `json:"name,omitempty"` // device-mapper name, e.g. "vg0-root"
+	ReadsPerSec   float64 `json:"reads_per_sec"`
+	WritesPerSec  float64 `json:"writes_per_sec"`
+	ReadKBPerSec  float64 `json:"read_kb_per_sec"`
+	WriteKBPerSec float64 `json:"write_kb_per_sec"`
+	ReadAwaitMs   float64 `json:"read_await_ms"`  // average time a read took, queueing included
+	WriteAwaitMs  float64 `json:"write_await_ms"` // average time a write took, queueing included
+	AwaitMs       float64 `json:"await_ms"`       // both together
+	UtilPercent   float64 `json:"util_percent"`   // time the device was busy; parallel devices such as SSDs can be at 100% with capacity to spare
+	QueueSize     float64 `json:"queue_size"`     // average requests in flight (aqu-sz)
+	InFlight      uint64  `json:"in_flight"`      // requests in flight at the sample
+}
@@ -0,0 +1,105 @@
+//go:build !windows
+
+package main
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/shirou/gopsutil/v3/disk"
+)
+
+// Counters of each device at the previous sample
+var diskIOState = struct {
+	sync.Mutex
+	counters map[string]disk.IOCountersStat
+	sampled  time.Time
+}{}
+
+// collectDiskIOInfo applies iostat's arithmetic to the cumulative counters
+// of /proc/diskstats (or the platform's equivalent). The first call only
+// records the baseline.
+func collectDiskIOInfo(now time.Time, trace *sectionTrace) DiskIOInfo {
+	info := DiskIOInfo{Devices: []DiskDeviceIO{}, Status: "unavailable"}
+	counters, err := disk.IOCounters()
+	if err != nil {
+		trace.fail("gopsutil", err)
+		return info
+	}
+
+	diskIOState.Lock()
+	previous, since := diskIOState.counters, diskIOState.sampled
+	diskIOState.counters, diskIOState.sampled = counters, now
+	diskIOState.Unlock()
+	trace.ok("gopsutil")
+
+	elapsedMs := float64(now.Sub(since).Milliseconds())
+	if previous == nil || elapsedMs <= 0 {
+		info.Status = "initializing"
+		return info
+	}
+
+	for name, current := range counters {
+		if !wholeDiskDevice(name) || current.ReadCount+current.WriteCount == 0 {
+			continue
+		}
+		before, ok := previous[name]
+		if !ok {
+			continue
+		}
+		reads := ioDelta(current.ReadCount, before.ReadCount)
+		writes := ioDelta(current.WriteCount, before.WriteCount)
+		readMs := ioDelta(current.ReadTime, before.ReadTime)
+		writeMs := ioDelta(current.WriteTime, before.WriteTime)
+		seconds := elapsedMs / 1000
+
+		device := DiskDeviceIO{
+			Device:        name,
+			Name:          current.Label,
+			ReadsPerSec:   math.Round(reads/seconds*10) / 10,
+			WritesPerSec:  math.Round(writes/seconds*10) / 10,
+			ReadKBPerSec:  math.Round(ioDelta(current.ReadBytes, before.ReadBytes)/1024/seconds*10) / 10,
+			WriteKBPerSec: math.Round(ioDelta(current.WriteBytes, before.WriteBytes)/1024/seconds*10) / 10,
+			UtilPercent:   math.Round(math.Min(ioDelta(current.IoTime, before.IoTime)/elapsedMs*100, 100)*10) / 10,
+			QueueSize:     math.Round(ioDelta(current.WeightedIO, before.WeightedIO)/elapsedMs*100) / 100,
+			InFlight:      current.IopsInProgress,
+		}
+		if reads > 0 {
+			device.ReadAwaitMs = math.Round(readMs/reads*100) / 100
+		}
+		if writes > 0 {
+			device.WriteAwaitMs = math.Round(writeMs/writes*100) / 100
+		}
+		if reads+writes > 0 {
+			device.AwaitMs = math.Round((readMs+writeMs)/(reads+writes)*100) / 100
+		}
+		info.Devices = append(info.Devices, device)
+	}
+	sort.Slice(info.Devices, func(i, j int) bool { return info.Devices[i].Device < info.Devices[j].Device })
+	info.Status = "ok"
+	return info
+}
+
+// wholeDiskDevice leaves out partitions, whose I/O is already counted on
+// their disk, and loop and RAM disks on Linux.
+func wholeDiskDevice(name string) bool {
+	if collectorOS != "linux" {
+		return true
+	}
+	if strings.HasPrefix(name, "loop") || strings.HasPrefix(name, "ram") {
+		return false
+	}
+	_, err := hostFS.Stat("/sys/block/" + name)
+	return err == nil
+}
+
+// ioDelta is the increase of a cumulative counter, zero if it reset.
+func ioDelta(current, previous uint64) float64 {
+	if current < previous {
+		return 0
+	}
+	return float64(current - previous)
+}
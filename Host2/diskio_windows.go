@@ -0,0 +1,85 @@
+package main
+
+import (
+	"log"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	counterDiskReads      = `\PhysicalDisk(*)\Disk Reads/sec`
+	counterDiskWrites     = `\PhysicalDisk(*)\Disk Writes/sec`
+	counterDiskReadBytes  = `\PhysicalDisk(*)\Disk Read Bytes/sec`
+	counterDiskWriteBytes = `\PhysicalDisk(*)\Disk Write Bytes/sec`
+	counterDiskSecRead    = `\PhysicalDisk(*)\Avg. Disk sec/Read`
+	counterDiskSecWrite   = `\PhysicalDisk(*)\Avg. Disk sec/Write`
+	counterDiskSecXfer    = `\PhysicalDisk(*)\Avg. Disk sec/Transfer`
+	counterDiskIdle       = `\PhysicalDisk(*)\% Idle Time`
+	counterDiskQueue      = `\PhysicalDisk(*)\Avg. Disk Queue Length`
+	counterDiskInFlight   = `\PhysicalDisk(*)\Current Disk Queue Length`
+)
+
+var diskIOState = struct {
+	sync.Mutex
+	query *pdhQuery
+}{}
+
+// collectDiskIOInfo reads the PhysicalDisk performance counters, which
+// Windows already averages over the time since the previous collection.
+// Instances are named by disk number and drive letters, e.g. "0 C: D:".
+func collectDiskIOInfo(now time.Time, trace *sectionTrace) DiskIOInfo {
+	info := DiskIOInfo{Devices: []DiskDeviceIO{}, Status: "unavailable"}
+
+	diskIOState.Lock()
+	defer diskIOState.Unlock()
+
+	if diskIOState.query == nil {
+		query, err := newPDHQuery([]string{
+			counterDiskReads, counterDiskWrites, counterDiskReadBytes, counterDiskWriteBytes,
+			counterDiskSecRead, counterDiskSecWrite, counterDiskSecXfer,
+			counterDiskIdle, counterDiskQueue, counterDiskInFlight,
+		})
+		if err != nil {
+			log.Printf("[DISKIO] Error opening performance counters: %v", err)
+			trace.fail("pdh", err)
+			return info
+		}
+		diskIOState.query = query
+		trace.ok("pdh")
+		info.Status = "initializing"
+		return info
+	}
+
+	values, err := diskIOState.query.collectInstances()
+	if err != nil {
+		log.Printf("[DISKIO] Error collecting performance counters: %v", err)
+		trace.fail("pdh", err)
+		return info
+	}
+	for instance := range values[counterDiskReads] {
+		if instance == "_Total" {
+			continue
+		}
+		value := func(path string) float64 { return values[path][instance] }
+		info.Devices = append(info.Devices, DiskDeviceIO{
+			Device:        strings.TrimSpace(instance),
+			ReadsPerSec:   math.Round(value(counterDiskReads)*10) / 10,
+			WritesPerSec:  math.Round(value(counterDiskWrites)*10) / 10,
+			ReadKBPerSec:  math.Round(value(counterDiskReadBytes)/1024*10) / 10,
+			WriteKBPerSec: math.Round(value(counterDiskWriteBytes)/1024*10) / 10,
+			ReadAwaitMs:   math.Round(value(counterDiskSecRead)*1000*100) / 100,
+			WriteAwaitMs:  math.Round(value(counterDiskSecWrite)*1000*100) / 100,
+			AwaitMs:       math.Round(value(counterDiskSecXfer)*1000*100) / 100,
+			UtilPercent:   math.Round(math.Max(100-value(counterDiskIdle), 0)*10) / 10,
+			QueueSize:     math.Round(value(counterDiskQueue)*100) / 100,
+			InFlight:      uint64(value(counterDiskInFlight)),
+		})
+	}
+	sort.Slice(info.Devices, func(i, j int) bool { return info.Devices[i].Device < info.Devices[j].Device })
+	trace.ok("pdh")
+	info.Status = "ok"
+	return info
+}
@@ -0,0 +1,219 @@
+package main
+
+import (
+	"encoding/json"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// DriveTemperature is the temperature of one disk or SSD.
+type DriveTemperature struct {
+	Device  string  `json:"device"`
+	Model   string  `json:"model,omitempty"`
+	Celsius float64 `json:"celsius"`
+	Source  string  `json:"source"` // "hwmon", "nvme-cli", "smartctl" or "storage"
+	Status  string  `json:"status"`
+
+	Fahrenheit *float64 `json:"fahrenheit,omitempty"` // with temperature.fahrenheit
+}
+
+// collectDriveTemperatures reads the native sources of Linux and Windows
+// and relies on smartctl elsewhere.
+func collectDriveTemperatures() []DriveTemperature {
+	switch collectorOS {
+	case "linux":
+		return linuxDriveTemperatures()
+	case "windows":
+		return windowsDriveTemperatures()
+	}
+	drives := []DriveTemperature{}
+	if _, err := commands.LookPath("smartctl"); err != nil {
+		return drives
+	}
+	for _, dev := range smartctlDevices() {
+		if drive, ok := smartctlTemperature(dev); ok {
+			drives = append(drives, drive)
+		}
+	}
+	return drives
+}
+
+// linuxDriveTemperatures reads the kernel's nvme and drivetemp hwmon
+// sensors, then asks nvme-cli and smartctl about drives hwmon missed.
+func linuxDriveTemperatures() []DriveTemperature {
+	drives := []DriveTemperature{}
+	seen := make(map[string]bool)
+
+	hwmons, _ := hostFS.Glob("/sys/class/hwmon/hwmon*")
+	for _, dir := range hwmons {
+		name := readTrimmed(path.Join(dir, "name"))
+		if name != "nvme" && name != "drivetemp" {
+			continue
+		}
+		raw := readTrimmed(path.Join(dir, "temp1_input"))
+		milli, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			continue
+		}
+		device := hwmonBlockDevice(dir, name)
+		if device == "" || seen[device] {
+			continue
+		}
+		seen[device] = true
+		drives = append(drives, DriveTemperature{
+			Device:  device,
+			Model:   readTrimmed(path.Join(dir, "device", "model")),
+			Celsius: milli / 1000,
+			Source:  "hwmon",
+			Status:  "ok",
+		})
+	}
+
+	if _, err := commands.LookPath("nvme"); err == nil {
+		controllers, _ := hostFS.Glob("/dev/nvme[0-9]")
+		controllers2, _ := hostFS.Glob("/dev/nvme[0-9][0-9]")
+		for _, dev := range append(controllers, controllers2...) {
+			if seen[dev] {
+				continue
+			}
+			if drive, ok := nvmeCLITemperature(dev); ok {
+				seen[dev] = true
+				drives = append(drives, drive)
+			}
+		}
+	}
+
+	if _, err := commands.LookPath("smartctl"); err == nil {
+		for _, dev := range smartctlDevices() {
+			if seen[dev] {
+				continue
+			}
+			if drive, ok := smartctlTemperature(dev); ok {
+				seen[dev] = true
+				drives = append(drives, drive)
+			}
+		}
+	}
+	return drives
+}
+
+// hwmonBlockDevice finds the /dev path a hwmon sensor belongs to: the
+// controller for nvme, the first block device for drivetemp.
+func hwmonBlockDevice(dir, kind string) string {
+	device, err := hostFS.EvalSymlinks(path.Join(dir, "device"))
+	if err != nil {
+		return ""
+	}
+	if kind == "nvme" {
+		base := path.Base(device)
+		if strings.HasPrefix(base, "nvme") {
+			return "/dev/" + base
+		}
+		// Newer kernels attach the sensor to the PCI function
+		if names, _ := hostFS.Glob(path.Join(device, "nvme", "nvme*")); len(names) > 0 {
+			return "/dev/" + path.Base(names[0])
+		}
+		return ""
+	}
+	if names, _ := hostFS.Glob(path.Join(device, "block", "*")); len(names) > 0 {
+		return "/dev/" + path.Base(names[0])
+	}
+	return ""
+}
+
+// nvmeCLITemperature reads the SMART log, which reports Kelvin.
+func nvmeCLITemperature(device string) (DriveTemperature, bool) {
+	out, err := commands.Output("nvme", "smart-log", device, "-o", "json")
+	if err != nil {
+		return DriveTemperature{}, false
+	}
+	var log struct {
+		Temperature float64 `json:"temperature"`
+	}
+	if json.Unmarshal(out, &log) != nil || log.Temperature <= 0 {
+		return DriveTemperature{}, false
+	}
+	return DriveTemperature{Device: device, Celsius: log.Temperature - 273.15, Source: "nvme-cli", Status: "ok"}, true
+}
+
+// windowsDriveTemperatures reads the storage reliability counters, which
+// Windows fills from SMART/NVMe health logs.
+func windowsDriveTemperatures() []DriveTemperature {
+	drives := []DriveTemperature{}
+	script := `ConvertTo-Json -Compress -InputObject @(Get-PhysicalDisk | ForEach-Object {
+  $r = $_ | Get-StorageReliabilityCounter -ErrorAction SilentlyContinue
+  [pscustomobject]@{ Device = $_.DeviceId; Model = $_.FriendlyName; Temperature = $r.Temperature }
+})`
+	out, err := commands.Output("powershell", "-NoProfile", "-Command", script)
+	if err != nil {
+		return drives
+	}
+	var disks []struct {
+		Device      string   `json:"Device"`
+		Model       string   `json:"Model"`
+		Temperature *float64 `json:"Temperature"`
+	}
+	if json.Unmarshal([]byte(strings.TrimSpace(string(out))), &disks) != nil {
+		return drives
+	}
+	for _, d := range disks {
+		// Drives that do not report a temperature return 0 or nothing
+		if d.Temperature == nil || *d.Temperature <= 0 {
+			continue
+		}
+		drives = append(drives, DriveTemperature{
+			Device:  `\\.\PhysicalDrive` + d.Device,
+			Model:   d.Model,
+			Celsius: *d.Temperature,
+			Source:  "storage",
+			Status:  "ok",
+		})
+	}
+	return drives
+}
+
+// smartctlTemperature reads the current temperature through smartctl's
+// JSON output (smartmontools 7+), for drives without another source.
+func smartctlTemperature(device string) (DriveTemperature, bool) {
+	// smartctl uses bit-mapped exit codes for drive warnings, so the
+	// output is parsed even when it exits non-zero
+	out, _ := commands.Output("smartctl", "-A", "-i", "-j", device)
+	var report struct {
+		ModelName   string `json:"model_name"`
+		Temperature struct {
+			Current *float64 `json:"current"`
+		} `json:"temperature"`
+	}
+	if err := json.Unmarshal(out, &report); err != nil || report.Temperature.Current == nil {
+		return DriveTemperature{}, false
+	}
+	return DriveTemperature{
+		Device:  device,
+		Model:   report.ModelName,
+		Celsius: *report.Temperature.Current,
+		Source:  "smartctl",
+		Status:  "ok",
+	}, true
+}
+
+// smartctlDevices lists the drives smartctl can see.
+func smartctlDevices() []string {
+	out, err := commands.Output("smartctl", "--scan", "-j")
+	if err != nil {
+		return nil
+	}
+	var scan struct {
+		Devices []struct {
+			Name string `json:"name"`
+		} `json:"devices"`
+	}
+	if json.Unmarshal(out, &scan) != nil {
+		return nil
+	}
+	var devices []string
+	for _, d := range scan.Devices {
+		devices = append(devices, d.Name)
+	}
+	return devices
+}
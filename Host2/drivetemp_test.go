@@ -0,0 +1,99 @@
+package main
+
+import (
+	"io/fs"
+	"reflect"
+	"testing"
+	"testing/fstest"
+)
+
+func TestCollectDriveTemperatures(t *testing.T) {
+	const windowsScript = `ConvertTo-Json -Compress -InputObject @(Get-PhysicalDisk | ForEach-Object {
+  $r = $_ | Get-StorageReliabilityCounter -ErrorAction SilentlyContinue
+  [pscustomobject]@{ Device = $_.DeviceId; Model = $_.FriendlyName; Temperature = $r.Temperature }
+})`
+	// nvme-cli reports Kelvin; converted at run time, as the collector does
+	kelvin := 315.0
+	link := func(target string) *fstest.MapFile {
+		return &fstest.MapFile{Data: []byte(target), Mode: fs.ModeSymlink}
+	}
+	tests := []struct {
+		name    string
+		goos    string
+		files   map[string]string
+		links   map[string]string
+		outputs map[string]string
+		want    []DriveTemperature
+	}{
+		{
+			name: "Linux hwmon, nvme-cli and smartctl",
+			goos: "linux",
+			files: map[string]string{
+				"/sys/class/hwmon/hwmon0/name":                                                       "nvme\n",
+				"/sys/class/hwmon/hwmon0/temp1_input":                                                "38850\n",
+				"/sys/class/hwmon/hwmon1/name":                                                       "drivetemp\n",
+				"/sys/class/hwmon/hwmon1/temp1_input":                                                "31000\n",
+				"/sys/class/hwmon/hwmon2/name":                                                       "coretemp\n",
+				"/sys/class/hwmon/hwmon2/temp1_input":                                                "55000\n",
+				"/sys/devices/pci0000:00/0000:00:1d.0/0000:3d:00.0/nvme/nvme0/model":                 "Samsung SSD 980\n",
+				"/sys/devices/pci0000:00/0000:00:17.0/ata1/host0/target0:0:0/0:0:0:0/block/sda/size": "1953525168\n",
+				"/dev/nvme0": "",
+				"/dev/nvme1": "",
+			},
+			links: map[string]string{
+				"/sys/class/hwmon/hwmon0/device": "../../../devices/pci0000:00/0000:00:1d.0/0000:3d:00.0/nvme/nvme0",
+				"/sys/class/hwmon/hwmon1/device": "/sys/devices/pci0000:00/0000:00:17.0/ata1/host0/target0:0:0/0:0:0:0",
+			},
+			outputs: map[string]string{
+				"nvme smart-log /dev/nvme1 -o json": `{"critical_warning":0,"temperature":315}`,
+				"smartctl --scan -j":                `{"devices":[{"name":"/dev/sda"},{"name":"/dev/sdb"}]}`,
+				"smartctl -A -i -j /dev/sdb":        `{"model_name":"WDC WD40EFRX","temperature":{"current":29}}`,
+			},
+			want: []DriveTemperature{
+				{Device: "/dev/nvme0", Model: "Samsung SSD 980", Celsius: 38.85, Source: "hwmon", Status: "ok"},
+				{Device: "/dev/sda", Celsius: 31, Source: "hwmon", Status: "ok"},
+				{Device: "/dev/nvme1", Celsius: kelvin - 273.15, Source: "nvme-cli", Status: "ok"},
+				{Device: "/dev/sdb", Model: "WDC WD40EFRX", Celsius: 29, Source: "smartctl", Status: "ok"},
+			},
+		},
+		{
+			name: "Windows storage reliability counters",
+			goos: "windows",
+			outputs: map[string]string{
+				"powershell -NoProfile -Command " + windowsScript: `[{"Device":"0","Model":"NVMe KXG60ZNV512G","Temperature":41},{"Device":"1","Model":"USB Flash","Temperature":0}]` + "\r\n",
+			},
+			want: []DriveTemperature{
+				{Device: `\\.\PhysicalDrive0`, Model: "NVMe KXG60ZNV512G", Celsius: 41, Source: "storage", Status: "ok"},
+			},
+		},
+		{
+			name: "FreeBSD smartctl",
+			goos: "freebsd",
+			outputs: map[string]string{
+				"smartctl --scan -j":          `{"devices":[{"name":"/dev/ada0"}]}`,
+				"smartctl -A -i -j /dev/ada0": `{"model_name":"ST2000DM008","temperature":{"current":34}}`,
+			},
+			want: []DriveTemperature{
+				{Device: "/dev/ada0", Model: "ST2000DM008", Celsius: 34, Source: "smartctl", Status: "ok"},
+			},
+		},
+		{
+			name: "macOS without smartctl",
+			goos: "darwin",
+			want: []DriveTemperature{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			files := newFakeFS(tt.files)
+			for name, target := range tt.links {
+				files[name[1:]] = link(target)
+			}
+			withHost(t, &fakeRunner{outputs: tt.outputs}, files, nil)
+			withOS(t, tt.goos)
+			if got := collectDriveTemperatures(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %+v\nwant %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,411 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"runtime"
+	"strconv"
+	"sync"
+
+	"github.com/cilium/ebpf"
+	"github.com/cilium/ebpf/asm"
+	"github.com/cilium/ebpf/btf"
+	"github.com/cilium/ebpf/link"
+	"github.com/cilium/ebpf/rlimit"
+)
+
+// Every Linux build has the programs; whether they load is up to the kernel
+const ebpfBuilt = true
+
+const (
+	// Processes tracked at once; exited ones are pruned on every read
+	EBPF_MAX_PROCESSES = 16384
+	// Offsets of the counters in a map value, one uint64 each
+	EBPF_NET_SENT    = 0
+	EBPF_NET_RECV    = 8
+	EBPF_BLOCK_READ  = 16
+	EBPF_BLOCK_WRITE = 24
+	EBPF_VALUE_SIZE  = 32
+	// Oldest kernel the programs are written for
+	EBPF_KERNEL_FLOOR = "Linux 5.4 with CONFIG_KPROBES and CONFIG_DEBUG_INFO_BTF"
+	// Stack slot the programs copy kernel memory to
+	EBPF_SCRATCH = -48
+)
+
+// ebpfCounters is a value of the counter map.
+type ebpfCounters struct {
+	NetSent, NetRecv      uint64
+	BlockRead, BlockWrite uint64
+}
+
+// ptRegs gives the offsets in struct pt_regs, the context of a kprobe
+// program, of the first three arguments and the return value.
+type ptRegs struct{ arg1, arg2, arg3, ret int16 }
+
+var ptRegsByArch = map[string]ptRegs{
+	"amd64": {arg1: 112, arg2: 104, arg3: 96, ret: 80}, // di, si, dx, ax
+	"arm64": {arg1: 0, arg2: 8, arg3: 16, ret: 0},      // x0, x1, x2, x0
+}
+
+var ebpfState struct {
+	sync.Mutex
+	tracer *ebpfTracer
+	err    error
+}
+
+// processIOCounters returns the cumulative per-process byte counts gathered
+// by the kprobe programs, loading them on first use, and whether the
+// network counters are live. It returns nil when processes.ebpf is off or
+// the programs could not be loaded; the reason is logged once and kept for
+// ebpfStatus.
+func processIOCounters() (map[int32]processIO, bool) {
+	ebpfState.Lock()
+	defer ebpfState.Unlock()
+	if !currentConfig().Processes.EBPF {
+		if ebpfState.tracer != nil {
+			ebpfState.tracer.close()
+		}
+		ebpfState.tracer, ebpfState.err = nil, nil
+		return nil, false
+	}
+	if ebpfState.tracer == nil && ebpfState.err == nil {
+		ebpfState.tracer, ebpfState.err = loadEBPFTracer()
+		if ebpfState.err != nil {
+			log.Printf("[EBPF] Per-process I/O attribution unavailable: %v", ebpfState.err)
+		}
+	}
+	if ebpfState.tracer == nil {
+		return nil, false
+	}
+	counters, err := ebpfState.tracer.read()
+	if err != nil {
+		log.Printf("[EBPF] Failed to read counters: %v", err)
+		return nil, false
+	}
+	return counters, ebpfState.tracer.network
+}
+
+// ebpfStatus describes the attribution for the /processes response: empty
+// when processes.ebpf is off, else "ok" or the reason it is unavailable.
+func ebpfStatus() string {
+	ebpfState.Lock()
+	defer ebpfState.Unlock()
+	switch {
+	case !currentConfig().Processes.EBPF:
+		return ""
+	case ebpfState.err != nil:
+		return "unavailable: " + ebpfState.err.Error()
+	case ebpfState.tracer != nil && !ebpfState.tracer.network:
+		return "ok (block I/O only, the TCP functions could not be probed)"
+	}
+	return "ok"
+}
+
+// ebpfTracer holds the counter map and the kprobe programs counting into
+// it. The programs read function arguments and return values, and the
+// fields of struct bio at offsets relocated from the running kernel's BTF,
+// so one binary runs on any kernel from EBPF_KERNEL_FLOOR on without
+// kernel headers.
+type ebpfTracer struct {
+	counters *ebpf.Map
+	progs    []*ebpf.Program
+	links    []link.Link
+	network  bool
+}
+
+func loadEBPFTracer() (*ebpfTracer, error) {
+	regs, ok := ptRegsByArch[runtime.GOARCH]
+	if !ok {
+		return nil, fmt.Errorf("not supported on %s", runtime.GOARCH)
+	}
+	spec, err := btf.LoadKernelSpec()
+	if err != nil {
+		return nil, fmt.Errorf("kernel BTF: %v (needs %s)", err, EBPF_KERNEL_FLOOR)
+	}
+	opf, err := btfMemberOffset(spec, "bio", "bi_opf")
+	if err != nil {
+		return nil, err
+	}
+	size, err := btfMemberOffset(spec, "bio", "bi_iter", "bi_size")
+	if err != nil {
+		return nil, err
+	}
+
+	// Kernels before 5.11 charge maps and programs to RLIMIT_MEMLOCK
+	if err := rlimit.RemoveMemlock(); err != nil {
+		return nil, fmt.Errorf("raising the memlock limit: %v (needs root or CAP_BPF and CAP_PERFMON)", err)
+	}
+	counters, err := ebpf.NewMap(&ebpf.MapSpec{
+		Type:       ebpf.Hash,
+		KeySize:    4,
+		ValueSize:  EBPF_VALUE_SIZE,
+		MaxEntries: EBPF_MAX_PROCESSES,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("creating map: %v (needs root or CAP_BPF and CAP_PERFMON)", err)
+	}
+	t := &ebpfTracer{counters: counters}
+	fd := counters.FD()
+
+	if err := t.attach("submit_bio", false, bioProgram(fd, regs, opf, size)); err != nil {
+		t.close()
+		return nil, err
+	}
+	// tcp_cleanup_rbuf gets the bytes tcp_recvmsg copied to the reader
+	sent := t.attach("tcp_sendmsg", false, sizeProgram(fd, regs.arg3, EBPF_NET_SENT))
+	recv := t.attach("tcp_cleanup_rbuf", false, sizeProgram(fd, regs.arg2, EBPF_NET_RECV))
+	t.network = sent == nil && recv == nil
+	if !t.network {
+		log.Printf("[EBPF] Network attribution off: %v", firstError(sent, recv))
+	} else {
+		// UDP is best effort: udpv6 may be in a module that is not loaded
+		for _, fn := range []string{"udp_sendmsg", "udpv6_sendmsg"} {
+			if err := t.attach(fn, false, sizeProgram(fd, regs.arg3, EBPF_NET_SENT)); err != nil {
+				log.Printf("[EBPF] %v", err)
+			}
+		}
+		for _, fn := range []string{"udp_recvmsg", "udpv6_recvmsg"} {
+			if err := t.attach(fn, true, sizeProgram(fd, regs.ret, EBPF_NET_RECV)); err != nil {
+				log.Printf("[EBPF] %v", err)
+			}
+		}
+	}
+	log.Printf("[EBPF] Attributing I/O to processes with %d kprobes", len(t.links))
+	return t, nil
+}
+
+func firstError(errs ...error) error {
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// loadKprobeProgram passes a program through the verifier.
+func loadKprobeProgram(insns asm.Instructions) (*ebpf.Program, error) {
+	return ebpf.NewProgram(&ebpf.ProgramSpec{
+		Name:         "sysmon_io",
+		Type:         ebpf.Kprobe,
+		Instructions: insns,
+		License:      "GPL",
+	})
+}
+
+// attach loads a program and attaches it to the entry of a kernel
+// function, or to its return with ret.
+func (t *ebpfTracer) attach(fn string, ret bool, insns asm.Instructions) error {
+	prog, err := loadKprobeProgram(insns)
+	if err != nil {
+		return fmt.Errorf("loading the %s program: %v", fn, err)
+	}
+	t.progs = append(t.progs, prog)
+	probe := link.Kprobe
+	if ret {
+		probe = link.Kretprobe
+	}
+	l, err := probe(fn, prog, nil)
+	switch {
+	case errors.Is(err, ebpf.ErrNotSupported):
+		return fmt.Errorf("probing %s: kprobes not supported (needs %s)", fn, EBPF_KERNEL_FLOOR)
+	case err != nil:
+		return fmt.Errorf("probing %s: %v", fn, err)
+	}
+	t.links = append(t.links, l)
+	return nil
+}
+
+// read returns the counters of every process in the map and forgets the
+// ones that have exited.
+func (t *ebpfTracer) read() (map[int32]processIO, error) {
+	counters := map[int32]processIO{}
+	var exited []uint32
+	var pid uint32
+	var value ebpfCounters
+	entries := t.counters.Iterate()
+	for entries.Next(&pid, &value) {
+		if _, err := hostFS.Stat("/proc/" + strconv.FormatUint(uint64(pid), 10)); err != nil {
+			exited = append(exited, pid)
+			continue
+		}
+		counters[int32(pid)] = processIO{
+			NetSent:    value.NetSent,
+			NetRecv:    value.NetRecv,
+			BlockRead:  value.BlockRead,
+			BlockWrite: value.BlockWrite,
+		}
+	}
+	if err := entries.Err(); err != nil {
+		return nil, err
+	}
+	for _, pid := range exited {
+		t.counters.Delete(pid)
+	}
+	return counters, nil
+}
+
+// close detaches the programs and frees them and the map.
+func (t *ebpfTracer) close() {
+	for _, l := range t.links {
+		l.Close()
+	}
+	for _, prog := range t.progs {
+		prog.Close()
+	}
+	t.counters.Close()
+}
+
+// btfMemberOffset returns the byte offset of a field of a struct, following
+// path through nested structs and anonymous unions as the kernel's BTF
+// lays them out. This is the field relocation a CO-RE loader performs.
+func btfMemberOffset(spec *btf.Spec, typeName string, path ...string) (int32, error) {
+	typ, err := spec.AnyTypeByName(typeName)
+	if err != nil {
+		return 0, fmt.Errorf("kernel BTF: %s: %v", typeName, err)
+	}
+	var bits btf.Bits
+	for _, name := range path {
+		members, ok := btfMembers(typ)
+		if !ok {
+			return 0, fmt.Errorf("kernel BTF: %s: not a struct", typeName)
+		}
+		member, offset, ok := btfFindMember(members, name)
+		if !ok {
+			return 0, fmt.Errorf("kernel BTF: %s has no %s", typeName, name)
+		}
+		if member.BitfieldSize != 0 || offset%8 != 0 {
+			return 0, fmt.Errorf("kernel BTF: %s.%s is a bit field", typeName, name)
+		}
+		bits += offset
+		typ = member.Type
+	}
+	return int32(bits / 8), nil
+}
+
+func btfMembers(typ btf.Type) ([]btf.Member, bool) {
+	switch typ := btf.UnderlyingType(typ).(type) {
+	case *btf.Struct:
+		return typ.Members, true
+	case *btf.Union:
+		return typ.Members, true
+	}
+	return nil, false
+}
+
+// btfFindMember looks for name among members and inside their anonymous
+// structs and unions, returning its offset from the start of members.
+func btfFindMember(members []btf.Member, name string) (btf.Member, btf.Bits, bool) {
+	for _, member := range members {
+		if member.Name == name {
+			return member, member.Offset, true
+		}
+		if member.Name != "" {
+			continue
+		}
+		if inner, ok := btfMembers(member.Type); ok {
+			if found, offset, ok := btfFindMember(inner, name); ok {
+				return found, member.Offset + offset, true
+			}
+		}
+	}
+	return btf.Member{}, 0, false
+}
+
+// sizeProgram counts the int at offset reg of pt_regs, a byte count that
+// is negative on errors, into the counter at offset counter.
+func sizeProgram(mapFD int, reg, counter int16) asm.Instructions {
+	insns := asm.Instructions{
+		asm.LoadMem(asm.R7, asm.R1, reg, asm.DWord),
+		asm.LSh.Imm(asm.R7, 32),
+		asm.ArSh.Imm(asm.R7, 32),
+		asm.JSLE.Imm(asm.R7, 0, "exit"),
+	}
+	insns = append(insns, addToCounter(mapFD, counter, "count")...)
+	return append(insns, exitProgram()...)
+}
+
+// bioProgram counts the size of every bio submitted for reading or
+// writing. REQ_OP_READ and REQ_OP_WRITE are 0 and 1 in the low byte of
+// bi_opf on every kernel since 4.10.
+func bioProgram(mapFD int, regs ptRegs, opf, size int32) asm.Instructions {
+	insns := asm.Instructions{
+		asm.LoadMem(asm.R6, asm.R1, regs.arg1, asm.DWord),
+	}
+	insns = append(insns, probeRead(opf)...)
+	insns = append(insns,
+		asm.LoadMem(asm.R8, asm.R10, EBPF_SCRATCH, asm.Word),
+		asm.And.Imm(asm.R8, 0xff),
+	)
+	insns = append(insns, probeRead(size)...)
+	insns = append(insns,
+		asm.LoadMem(asm.R7, asm.R10, EBPF_SCRATCH, asm.Word),
+		asm.JEq.Imm(asm.R7, 0, "exit"),
+		asm.JEq.Imm(asm.R8, 1, "write"),
+		asm.JNE.Imm(asm.R8, 0, "exit"),
+	)
+	insns = append(insns, addToCounter(mapFD, EBPF_BLOCK_READ, "read")...)
+	write := addToCounter(mapFD, EBPF_BLOCK_WRITE, "write")
+	write[0] = write[0].WithSymbol("write")
+	insns = append(insns, write...)
+	return append(insns, exitProgram()...)
+}
+
+// probeRead copies the 4 bytes at offset into the struct R6 points to into
+// the scratch slot, exiting when the read faults. bpf_probe_read rather
+// than bpf_probe_read_kernel keeps Linux 5.4 supported.
+func probeRead(offset int32) asm.Instructions {
+	return asm.Instructions{
+		asm.Mov.Reg(asm.R1, asm.R10),
+		asm.Add.Imm(asm.R1, EBPF_SCRATCH),
+		asm.Mov.Imm(asm.R2, 4),
+		asm.Mov.Reg(asm.R3, asm.R6),
+		asm.Add.Imm(asm.R3, offset),
+		asm.FnProbeRead.Call(),
+		asm.JNE.Imm(asm.R0, 0, "exit"),
+	}
+}
+
+// addToCounter adds R7 to a counter of the calling process, creating its
+// entry if needed, then jumps to the exit; its labels start with name. The
+// key goes on the stack at R10-4 and a zero value at R10-40.
+func addToCounter(mapFD int, counter int16, name string) asm.Instructions {
+	add := asm.StoreXAdd(asm.R0, asm.R7, asm.DWord)
+	add.Offset = counter
+	return asm.Instructions{
+		asm.FnGetCurrentPidTgid.Call(),
+		asm.RSh.Imm(asm.R0, 32),
+		asm.StoreMem(asm.R10, -4, asm.R0, asm.Word),
+		asm.LoadMapPtr(asm.R1, mapFD),
+		asm.Mov.Reg(asm.R2, asm.R10),
+		asm.Add.Imm(asm.R2, -4),
+		asm.FnMapLookupElem.Call(),
+		asm.JNE.Imm(asm.R0, 0, name+"_add"),
+		asm.StoreImm(asm.R10, -40, 0, asm.DWord),
+		asm.StoreImm(asm.R10, -32, 0, asm.DWord),
+		asm.StoreImm(asm.R10, -24, 0, asm.DWord),
+		asm.StoreImm(asm.R10, -16, 0, asm.DWord),
+		asm.LoadMapPtr(asm.R1, mapFD),
+		asm.Mov.Reg(asm.R2, asm.R10),
+		asm.Add.Imm(asm.R2, -4),
+		asm.Mov.Reg(asm.R3, asm.R10),
+		asm.Add.Imm(asm.R3, -40),
+		asm.Mov.Imm(asm.R4, int32(ebpf.UpdateNoExist)),
+		asm.FnMapUpdateElem.Call(),
+		asm.LoadMapPtr(asm.R1, mapFD),
+		asm.Mov.Reg(asm.R2, asm.R10),
+		asm.Add.Imm(asm.R2, -4),
+		asm.FnMapLookupElem.Call(),
+		asm.JEq.Imm(asm.R0, 0, "exit"),
+		add.WithSymbol(name + "_add"),
+		asm.Ja.Label("exit"),
+	}
+}
+
+func exitProgram() asm.Instructions {
+	return asm.Instructions{
+		asm.Mov.Imm(asm.R0, 0).WithSymbol("exit"),
+		asm.Return(),
+	}
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/cilium/ebpf"
+	"github.com/cilium/ebpf/asm"
+	"github.com/cilium/ebpf/btf"
+)
+
+// bioSpec is a BTF spec with a struct bio whose size sits in a nested
+// struct and whose opf sits in an anonymous union, at made-up offsets.
+func bioSpec(t *testing.T) *btf.Spec {
+	t.Helper()
+	u32 := &btf.Int{Name: "unsigned int", Size: 4}
+	u64 := &btf.Int{Name: "long long unsigned int", Size: 8}
+	iter := &btf.Struct{Name: "bvec_iter", Size: 16, Members: []btf.Member{
+		{Name: "bi_sector", Type: u64, Offset: 0},
+		{Name: "bi_size", Type: u32, Offset: 64},
+	}}
+	bio := &btf.Struct{Name: "bio", Size: 48, Members: []btf.Member{
+		{Name: "bi_next", Type: u64, Offset: 0},
+		{Type: &btf.Union{Size: 4, Members: []btf.Member{{Name: "bi_opf", Type: u32}}}, Offset: 96},
+		{Name: "bi_iter", Type: iter, Offset: 256},
+	}}
+	b, err := btf.NewBuilder([]btf.Type{bio})
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw, err := b.Marshal(nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	spec, err := btf.LoadSpecFromReader(bytes.NewReader(raw))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return spec
+}
+
+func TestBTFMemberOffset(t *testing.T) {
+	spec := bioSpec(t)
+	if got, err := btfMemberOffset(spec, "bio", "bi_opf"); err != nil || got != 12 {
+		t.Errorf("bi_opf = %d, %v; want 12", got, err)
+	}
+	if got, err := btfMemberOffset(spec, "bio", "bi_iter", "bi_size"); err != nil || got != 40 {
+		t.Errorf("bi_iter.bi_size = %d, %v; want 40", got, err)
+	}
+	if _, err := btfMemberOffset(spec, "bio", "bi_status"); err == nil {
+		t.Error("missing member found")
+	}
+	if _, err := btfMemberOffset(spec, "request", "bio"); err == nil {
+		t.Error("missing struct found")
+	}
+}
+
+// TestEBPFProgramsVerify loads every program into the kernel, which runs
+// the verifier on them; it needs root and is skipped otherwise.
+func TestEBPFProgramsVerify(t *testing.T) {
+	m, err := ebpf.NewMap(&ebpf.MapSpec{Type: ebpf.Hash, KeySize: 4, ValueSize: EBPF_VALUE_SIZE, MaxEntries: 1})
+	if errors.Is(err, os.ErrPermission) || errors.Is(err, ebpf.ErrNotSupported) {
+		t.Skipf("cannot create maps: %v", err)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+
+	for arch, regs := range ptRegsByArch {
+		programs := map[string]asm.Instructions{
+			"size": sizeProgram(m.FD(), regs.arg3, EBPF_NET_SENT),
+			"bio":  bioProgram(m.FD(), regs, 16, 40),
+		}
+		for name, insns := range programs {
+			t.Run(arch+"/"+name, func(t *testing.T) {
+				prog, err := loadKprobeProgram(insns)
+				if err != nil {
+					t.Fatal(err)
+				}
+				prog.Close()
+			})
+		}
+	}
+}
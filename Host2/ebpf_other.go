@@ -0,0 +1,18 @@
+//go:build !linux
+
+package main
+
+// The programs are Linux kprobes
+const ebpfBuilt = false
+
+// processIOCounters needs Linux.
+func processIOCounters() (map[int32]processIO, bool) {
+	return nil, false
+}
+
+func ebpfStatus() string {
+	if currentConfig().Processes.EBPF {
+		return "unavailable: eBPF attribution needs Linux"
+	}
+	return ""
+}
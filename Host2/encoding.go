@@ -0,0 +1,277 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Binary response encodings offered through the Accept header
+const (
+	CONTENT_TYPE_MSGPACK = "application/msgpack"
+	CONTENT_TYPE_CBOR    = "application/cbor"
+)
+
+// negotiateEncoding picks the response content type from the Accept header:
+// application/json, application/msgpack (or application/x-msgpack) or
+// application/cbor, by q-value and then order. Anything else means JSON.
+func negotiateEncoding(r *http.Request) string {
+	best, bestQ := "application/json", 0.0
+	for _, part := range strings.Split(r.Header.Get("Accept"), ",") {
+		fields := strings.Split(part, ";")
+		mediaType := strings.ToLower(strings.TrimSpace(fields[0]))
+		q := 1.0
+		for _, param := range fields[1:] {
+			if value, ok := strings.CutPrefix(strings.TrimSpace(param), "q="); ok {
+				if parsed, err := strconv.ParseFloat(value, 64); err == nil {
+					q = parsed
+				}
+			}
+		}
+		switch mediaType {
+		case "application/x-msgpack":
+			mediaType = CONTENT_TYPE_MSGPACK
+		case CONTENT_TYPE_MSGPACK, CONTENT_TYPE_CBOR, "application/json":
+		default:
+			continue
+		}
+		if q > bestQ {
+			best, bestQ = mediaType, q
+		}
+	}
+	return best
+}
+
+// writeEncoded writes v as JSON, MessagePack or CBOR depending on the
+// request's Accept header. The binary encodings carry exactly the JSON
+// document (same field names, omitted fields and nulls), so consumers can
+// switch without a second schema.
+func writeEncoded(w http.ResponseWriter, r *http.Request, status int, v interface{}) {
+	w.Header().Add("Vary", "Accept")
+	contentType := negotiateEncoding(r)
+	if contentType == "application/json" {
+		writeJSON(w, status, v)
+		return
+	}
+
+	data, err := encodeBinary(v, contentType)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to encode response: %v", err), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(status)
+	w.Write(data)
+}
+
+// encodeBinary converts v through its JSON form to MessagePack or CBOR.
+func encodeBinary(v interface{}, contentType string) ([]byte, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var doc interface{}
+	if err := decoder.Decode(&doc); err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	if contentType == CONTENT_TYPE_CBOR {
+		writeCBOR(&buf, doc)
+	} else {
+		writeMsgpack(&buf, doc)
+	}
+	return buf.Bytes(), nil
+}
+
+// sortedKeys orders map keys so encodings are deterministic.
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// numberValue classifies a JSON number as a signed or unsigned integer, or
+// a float when it has a fraction or exponent or overflows 64 bits.
+func numberValue(n json.Number) (i int64, u uint64, f float64, kind byte) {
+	if i, err := strconv.ParseInt(string(n), 10, 64); err == nil {
+		return i, 0, 0, 'i'
+	}
+	if u, err := strconv.ParseUint(string(n), 10, 64); err == nil {
+		return 0, u, 0, 'u'
+	}
+	f, _ = strconv.ParseFloat(string(n), 64)
+	return 0, 0, f, 'f'
+}
+
+// writeMsgpack encodes a decoded JSON document in the smallest MessagePack
+// representation of each value. Floats that survive a round trip through
+// float32 are sent as float32.
+func writeMsgpack(buf *bytes.Buffer, v interface{}) {
+	switch value := v.(type) {
+	case nil:
+		buf.WriteByte(0xc0)
+	case bool:
+		if value {
+			buf.WriteByte(0xc3)
+		} else {
+			buf.WriteByte(0xc2)
+		}
+	case json.Number:
+		i, u, f, kind := numberValue(value)
+		switch {
+		case kind == 'u':
+			buf.WriteByte(0xcf)
+			binary.Write(buf, binary.BigEndian, u)
+		case kind == 'f' && float64(float32(f)) == f:
+			buf.WriteByte(0xca)
+			binary.Write(buf, binary.BigEndian, math.Float32bits(float32(f)))
+		case kind == 'f':
+			buf.WriteByte(0xcb)
+			binary.Write(buf, binary.BigEndian, math.Float64bits(f))
+		case i >= 0 && i < 128:
+			buf.WriteByte(byte(i))
+		case i >= -32 && i < 0:
+			buf.WriteByte(byte(int8(i)))
+		case i >= 0 && i <= math.MaxUint8:
+			buf.Write([]byte{0xcc, byte(i)})
+		case i >= 0 && i <= math.MaxUint16:
+			buf.WriteByte(0xcd)
+			binary.Write(buf, binary.BigEndian, uint16(i))
+		case i >= 0 && i <= math.MaxUint32:
+			buf.WriteByte(0xce)
+			binary.Write(buf, binary.BigEndian, uint32(i))
+		case i >= 0:
+			buf.WriteByte(0xcf)
+			binary.Write(buf, binary.BigEndian, uint64(i))
+		case i >= math.MinInt8:
+			buf.Write([]byte{0xd0, byte(int8(i))})
+		case i >= math.MinInt16:
+			buf.WriteByte(0xd1)
+			binary.Write(buf, binary.BigEndian, int16(i))
+		case i >= math.MinInt32:
+			buf.WriteByte(0xd2)
+			binary.Write(buf, binary.BigEndian, int32(i))
+		default:
+			buf.WriteByte(0xd3)
+			binary.Write(buf, binary.BigEndian, i)
+		}
+	case string:
+		n := len(value)
+		switch {
+		case n < 32:
+			buf.WriteByte(0xa0 | byte(n))
+		case n <= math.MaxUint8:
+			buf.Write([]byte{0xd9, byte(n)})
+		case n <= math.MaxUint16:
+			buf.WriteByte(0xda)
+			binary.Write(buf, binary.BigEndian, uint16(n))
+		default:
+			buf.WriteByte(0xdb)
+			binary.Write(buf, binary.BigEndian, uint32(n))
+		}
+		buf.WriteString(value)
+	case []interface{}:
+		writeMsgpackLength(buf, len(value), 0x90, 0xdc)
+		for _, item := range value {
+			writeMsgpack(buf, item)
+		}
+	case map[string]interface{}:
+		writeMsgpackLength(buf, len(value), 0x80, 0xde)
+		for _, k := range sortedKeys(value) {
+			writeMsgpack(buf, k)
+			writeMsgpack(buf, value[k])
+		}
+	}
+}
+
+// writeMsgpackLength writes an array or map header: the fix form below 16
+// entries, otherwise the 16 or 32 bit form (code16 and code16+1).
+func writeMsgpackLength(buf *bytes.Buffer, n int, fix, code16 byte) {
+	switch {
+	case n < 16:
+		buf.WriteByte(fix | byte(n))
+	case n <= math.MaxUint16:
+		buf.WriteByte(code16)
+		binary.Write(buf, binary.BigEndian, uint16(n))
+	default:
+		buf.WriteByte(code16 + 1)
+		binary.Write(buf, binary.BigEndian, uint32(n))
+	}
+}
+
+// writeCBOR encodes a decoded JSON document as CBOR (RFC 8949) with
+// definite lengths, using float32 where it is lossless like writeMsgpack.
+func writeCBOR(buf *bytes.Buffer, v interface{}) {
+	switch value := v.(type) {
+	case nil:
+		buf.WriteByte(0xf6)
+	case bool:
+		if value {
+			buf.WriteByte(0xf5)
+		} else {
+			buf.WriteByte(0xf4)
+		}
+	case json.Number:
+		i, u, f, kind := numberValue(value)
+		switch {
+		case kind == 'u':
+			writeCBORHead(buf, 0, u)
+		case kind == 'f' && float64(float32(f)) == f:
+			buf.WriteByte(0xfa)
+			binary.Write(buf, binary.BigEndian, math.Float32bits(float32(f)))
+		case kind == 'f':
+			buf.WriteByte(0xfb)
+			binary.Write(buf, binary.BigEndian, math.Float64bits(f))
+		case i >= 0:
+			writeCBORHead(buf, 0, uint64(i))
+		default:
+			writeCBORHead(buf, 1, uint64(-1-i))
+		}
+	case string:
+		writeCBORHead(buf, 3, uint64(len(value)))
+		buf.WriteString(value)
+	case []interface{}:
+		writeCBORHead(buf, 4, uint64(len(value)))
+		for _, item := range value {
+			writeCBOR(buf, item)
+		}
+	case map[string]interface{}:
+		writeCBORHead(buf, 5, uint64(len(value)))
+		for _, k := range sortedKeys(value) {
+			writeCBOR(buf, k)
+			writeCBOR(buf, value[k])
+		}
+	}
+}
+
+// writeCBORHead writes a major type with its argument in the shortest form.
+func writeCBORHead(buf *bytes.Buffer, major byte, n uint64) {
+	major <<= 5
+	switch {
+	case n < 24:
+		buf.WriteByte(major | byte(n))
+	case n <= math.MaxUint8:
+		buf.Write([]byte{major | 24, byte(n)})
+	case n <= math.MaxUint16:
+		buf.WriteByte(major | 25)
+		binary.Write(buf, binary.BigEndian, uint16(n))
+	case n <= math.MaxUint32:
+		buf.WriteByte(major | 26)
+		binary.Write(buf, binary.BigEndian, uint32(n))
+	default:
+		buf.WriteByte(major | 27)
+		binary.Write(buf, binary.BigEndian, n)
+	}
+}
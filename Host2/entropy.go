@@ -0,0 +1,56 @@
+package main
+
+import (
+	"strconv"
+)
+
+// EntropyInfo reports the kernel entropy pool and what feeds it. Headless
+// VMs without a hardware RNG can stall at boot, or in anything reading
+// /dev/random, until enough entropy has been gathered.
+type EntropyInfo struct {
+	Available int         `json:"available"` // bits; since kernel 5.18 this stays at 256 once the RNG is seeded
+	PoolSize  int         `json:"pool_size"`
+	HWRNG     string      `json:"hw_rng,omitempty"` // current hardware RNG such as "virtio_rng.0", or "none"
+	Daemons   []RNGDaemon `json:"daemons,omitempty"`
+	Status    string      `json:"status"` // "warning" below entropy.min_available
+}
+
+// RNGDaemon is an installed entropy daemon such as rngd or haveged.
+type RNGDaemon struct {
+	Unit   string `json:"unit"`
+	Active bool   `json:"active"`
+}
+
+// Entropy daemons checked with systemd; only installed ones are reported
+var rngDaemonUnits = []string{"rngd.service", "rng-tools.service", "haveged.service", "jitterentropy.service"}
+
+// collectEntropyInfo reads the pool from /proc/sys/kernel/random, the
+// hardware RNG from /sys/class/misc/hw_random and the daemons from systemd.
+// Other platforms report "unavailable".
+func collectEntropyInfo(trace *sectionTrace) EntropyInfo {
+	info := EntropyInfo{Status: "unavailable"}
+	if collectorOS != "linux" {
+		return info
+	}
+	available, err := strconv.Atoi(readTrimmed("/proc/sys/kernel/random/entropy_avail"))
+	if err != nil {
+		trace.fail("procfs", err)
+		return info
+	}
+	info.Available = available
+	info.PoolSize, _ = strconv.Atoi(readTrimmed("/proc/sys/kernel/random/poolsize"))
+	info.HWRNG = readTrimmed("/sys/class/misc/hw_random/rng_current")
+
+	if _, err := commands.LookPath("systemctl"); err == nil {
+		for _, unit := range rngDaemonUnits {
+			props, err := systemdProperties(unit, "LoadState", "ActiveState")
+			if err != nil {
+				continue
+			}
+			info.Daemons = append(info.Daemons, RNGDaemon{Unit: unit, Active: props["ActiveState"] == "active"})
+		}
+	}
+	trace.ok("procfs")
+	info.Status = "ok"
+	return info
+}
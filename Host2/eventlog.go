@@ -0,0 +1,20 @@
+package main
+
+// EventLogInfo counts Critical and Error events written to the Windows
+// event log since the previous sample.
+type EventLogInfo struct {
+	Since    string              `json:"since"`
+	Channels []EventChannelCount `json:"channels"`
+	Status   string              `json:"status"`
+}
+
+type EventChannelCount struct {
+	Channel  string `json:"channel"`
+	Critical int    `json:"critical"`
+	Error    int    `json:"error"`
+	Status   string `json:"status"`
+	Message  string `json:"message,omitempty"`
+}
+
+// Channels counted by the event log collector
+var eventLogChannels = []string{"System", "Application"}
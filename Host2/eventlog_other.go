@@ -0,0 +1,8 @@
+//go:build !windows
+
+package main
+
+// collectEventLogInfo is Windows-only.
+func collectEventLogInfo(advance bool) EventLogInfo {
+	return EventLogInfo{Channels: []EventChannelCount{}, Status: "unavailable"}
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+const (
+	evtQueryChannelPath      = 0x1
+	evtQueryForwardDirection = 0x100
+	errorNoMoreItems         = syscall.Errno(259)
+
+	// Event levels as defined by the Windows Event Log schema
+	eventLevelCritical = 1
+	eventLevelError    = 2
+
+	eventBatchSize = 64
+)
+
+var (
+	wevtapiDLL   = syscall.NewLazyDLL("wevtapi.dll")
+	procEvtQuery = wevtapiDLL.NewProc("EvtQuery")
+	procEvtNext  = wevtapiDLL.NewProc("EvtNext")
+	procEvtClose = wevtapiDLL.NewProc("EvtClose")
+
+	eventLogMu        sync.Mutex
+	lastEventLogCheck time.Time
+)
+
+// collectEventLogInfo counts Critical and Error events per channel in the
+// window between the previous sample and now. The first call only records
+// the starting point. Without advance the window keeps its start, so the
+// next sample counts the same events.
+func collectEventLogInfo(advance bool) EventLogInfo {
+	info := EventLogInfo{Channels: []EventChannelCount{}, Status: "unavailable"}
+	if err := wevtapiDLL.Load(); err != nil {
+		return info
+	}
+
+	eventLogMu.Lock()
+	defer eventLogMu.Unlock()
+
+	now := clock.Now().UTC()
+	if lastEventLogCheck.IsZero() {
+		if advance {
+			lastEventLogCheck = now
+		}
+		info.Status = "initializing"
+		return info
+	}
+	since := lastEventLogCheck
+	if advance {
+		lastEventLogCheck = now
+	}
+
+	info.Since = since.Format("2006-01-02T15:04:05Z")
+	info.Status = "ok"
+	for _, channel := range eventLogChannels {
+		count := EventChannelCount{Channel: channel, Status: "ok"}
+		var err error
+		if count.Critical, err = countEvents(channel, eventLevelCritical, since, now); err == nil {
+			count.Error, err = countEvents(channel, eventLevelError, since, now)
+		}
+		if err != nil {
+			count.Status = "error"
+			count.Message = err.Error()
+		}
+		info.Channels = append(info.Channels, count)
+	}
+	return info
+}
+
+// countEvents runs an XPath query against a channel and counts the matches
+// without rendering the events themselves.
+func countEvents(channel string, level int, from, to time.Time) (int, error) {
+	query := fmt.Sprintf("*[System[Level=%d and TimeCreated[@SystemTime>='%s' and @SystemTime<'%s']]]",
+		level, from.Format("2006-01-02T15:04:05.000Z"), to.Format("2006-01-02T15:04:05.000Z"))
+
+	channelPtr, err := syscall.UTF16PtrFromString(channel)
+	if err != nil {
+		return 0, err
+	}
+	queryPtr, err := syscall.UTF16PtrFromString(query)
+	if err != nil {
+		return 0, err
+	}
+
+	results, _, callErr := procEvtQuery.Call(0, uintptr(unsafe.Pointer(channelPtr)), uintptr(unsafe.Pointer(queryPtr)),
+		evtQueryChannelPath|evtQueryForwardDirection)
+	if results == 0 {
+		return 0, fmt.Errorf("EvtQuery(%s) failed: %v", channel, callErr)
+	}
+	defer procEvtClose.Call(results)
+
+	count := 0
+	events := make([]uintptr, eventBatchSize)
+	for {
+		var returned uint32
+		ok, _, callErr := procEvtNext.Call(results, eventBatchSize, uintptr(unsafe.Pointer(&events[0])), 0, 0,
+			uintptr(unsafe.Pointer(&returned)))
+		if ok == 0 {
+			if callErr == errorNoMoreItems {
+				return count, nil
+			}
+			return count, fmt.Errorf("EvtNext(%s) failed: %v", channel, callErr)
+		}
+		for _, event := range events[:returned] {
+			procEvtClose.Call(event)
+		}
+		count += int(returned)
+	}
+}
@@ -0,0 +1,251 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os/exec"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Largest stdout accepted from an exec plugin
+const EXEC_MAX_OUTPUT = 1024 * 1024
+
+// ExecResult is the last run of one exec plugin; Data holds the values it
+// printed, numbers as float64.
+type ExecResult struct {
+	Data       map[string]interface{} `json:"data"`
+	LastRun    string                 `json:"last_run"`
+	DurationMs float64                `json:"duration_ms"`
+	Status     string                 `json:"status"` // "ok", "error" or "timeout"
+	Error      string                 `json:"error,omitempty"`
+}
+
+var (
+	execMu     sync.RWMutex
+	latestExec = map[string]ExecResult{}
+)
+
+// latestExecResults returns a copy of the results of the configured
+// plugins and of the WASM plugins, keyed by plugin name; an exec plugin
+// hides a WASM plugin of the same name.
+func latestExecResults() map[string]ExecResult {
+	results := latestWasmResults()
+	execMu.RLock()
+	defer execMu.RUnlock()
+	for name, result := range latestExec {
+		results[name] = result
+	}
+	return results
+}
+
+// limitedBuffer keeps the first limit bytes written and remembers whether
+// more were offered.
+type limitedBuffer struct {
+	bytes.Buffer
+	limit     int
+	truncated bool
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if room := b.limit - b.Len(); len(p) > room {
+		b.truncated = true
+		if room > 0 {
+			b.Buffer.Write(p[:room])
+		}
+		return len(p), nil
+	}
+	return b.Buffer.Write(p)
+}
+
+// runExecPlugin runs the command without a shell, in a minimal
+// environment and its own process group, and kills the whole group when
+// the timeout expires.
+func runExecPlugin(cfg ExecPluginConfig) ExecResult {
+	start := time.Now()
+	result := ExecResult{Data: map[string]interface{}{}, LastRun: start.UTC().Format("2006-01-02T15:04:05Z"), Status: "error"}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(cfg.TimeoutMs)*time.Millisecond)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, cfg.Command[0], cfg.Command[1:]...)
+	cmd.Dir = cfg.Dir
+	cmd.Env = execEnv(cfg.Env)
+	stdout := &limitedBuffer{limit: EXEC_MAX_OUTPUT}
+	stderr := &limitedBuffer{limit: 512}
+	cmd.Stdout, cmd.Stderr = stdout, stderr
+	if err := sandboxCommand(cmd, cfg); err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	// Children that inherited stdout must not keep Wait blocked
+	cmd.WaitDelay = time.Second
+
+	err := cmd.Run()
+	result.DurationMs = float64(time.Since(start).Microseconds()) / 1000
+	switch {
+	case ctx.Err() == context.DeadlineExceeded:
+		result.Status = "timeout"
+		result.Error = fmt.Sprintf("killed after %d ms", cfg.TimeoutMs)
+		return result
+	case err != nil:
+		result.Error = err.Error()
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			result.Error += ": " + msg
+		}
+		return result
+	case stdout.truncated:
+		result.Error = fmt.Sprintf("output exceeds %d bytes", EXEC_MAX_OUTPUT)
+		return result
+	}
+
+	data, err := parseExecOutput(stdout.Bytes(), cfg.Format)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	result.Data = data
+	result.Status = "ok"
+	return result
+}
+
+// parseExecOutput reads a JSON object or key=value lines. Without a
+// configured format, output starting with "{" is taken as JSON.
+func parseExecOutput(out []byte, format string) (map[string]interface{}, error) {
+	trimmed := bytes.TrimSpace(out)
+	if format == "json" || (format == "" && bytes.HasPrefix(trimmed, []byte("{"))) {
+		data := map[string]interface{}{}
+		if err := json.Unmarshal(trimmed, &data); err != nil {
+			return nil, fmt.Errorf("invalid JSON output: %v", err)
+		}
+		return data, nil
+	}
+
+	data := map[string]interface{}{}
+	for i, line := range strings.Split(string(trimmed), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		key, value, ok := strings.Cut(line, "=")
+		if !ok || strings.TrimSpace(key) == "" {
+			return nil, fmt.Errorf("line %d is not key=value: %q", i+1, line)
+		}
+		key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+		if number, err := strconv.ParseFloat(value, 64); err == nil {
+			data[key] = number
+		} else {
+			data[key] = value
+		}
+	}
+	return data, nil
+}
+
+var metricNameInvalid = regexp.MustCompile(`[^a-z0-9_]+`)
+
+// execSamples turns the numeric and boolean values of a plugin's output
+// into custom_<key> samples labelled with the plugin; nested objects are
+// joined with "_".
+func execSamples(plugin string, data map[string]interface{}) []metricSample {
+	labels := map[string]string{"plugin": plugin}
+	var samples []metricSample
+	var walk func(prefix string, value interface{})
+	walk = func(prefix string, value interface{}) {
+		switch v := value.(type) {
+		case float64:
+			samples = append(samples, metricSample{Name: "custom_" + prefix, Labels: labels, Value: v})
+		case bool:
+			flag := 0.0
+			if v {
+				flag = 1
+			}
+			samples = append(samples, metricSample{Name: "custom_" + prefix, Labels: labels, Value: flag})
+		case map[string]interface{}:
+			keys := make([]string, 0, len(v))
+			for key := range v {
+				keys = append(keys, key)
+			}
+			sort.Strings(keys)
+			for _, key := range keys {
+				name := strings.Trim(metricNameInvalid.ReplaceAllString(strings.ToLower(key), "_"), "_")
+				if prefix != "" {
+					name = prefix + "_" + name
+				}
+				walk(name, v[key])
+			}
+		}
+	}
+	walk("", data)
+	return samples
+}
+
+// startExecPlugins runs every configured plugin on its own interval until
+// the process exits, restarting the set when the config is reloaded.
+func startExecPlugins() {
+	for {
+		plugins := currentConfig().Exec
+		reloaded := configReloaded()
+
+		execMu.Lock()
+		for name := range latestExec {
+			configured := false
+			for _, plugin := range plugins {
+				configured = configured || plugin.Name == name
+			}
+			if !configured {
+				delete(latestExec, name)
+			}
+		}
+		execMu.Unlock()
+
+		if len(plugins) > 0 {
+			log.Printf("[EXEC] Running %d exec plugins", len(plugins))
+		}
+		for _, plugin := range plugins {
+			go runExecLoop(plugin, reloaded)
+		}
+		<-reloaded
+	}
+}
+
+func runExecLoop(cfg ExecPluginConfig, stop <-chan struct{}) {
+	if cfg.Daemon {
+		runDaemonLoop(cfg, stop)
+		return
+	}
+
+	interval := time.Duration(cfg.IntervalSeconds) * time.Second
+	for {
+		result := runExecPlugin(cfg)
+		if result.Status != "ok" {
+			log.Printf("[EXEC] %s: %s", cfg.Name, result.Error)
+		}
+		storeExecResult(cfg.Name, result, stop)
+
+		select {
+		case <-time.After(interval):
+		case <-stop:
+			return
+		}
+	}
+}
+
+// storeExecResult publishes a result unless the plugin was superseded by a
+// reload while it ran.
+func storeExecResult(name string, result ExecResult, stop <-chan struct{}) {
+	select {
+	case <-stop:
+		return
+	default:
+	}
+	execMu.Lock()
+	latestExec[name] = result
+	execMu.Unlock()
+}
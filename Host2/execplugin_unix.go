@@ -0,0 +1,43 @@
+//go:build !windows
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"os/user"
+	"strconv"
+	"syscall"
+)
+
+// execEnv gives plugins PATH and the configured variables only, so agent
+// secrets in the environment do not leak into user scripts.
+func execEnv(extra map[string]string) []string {
+	env := []string{"PATH=" + os.Getenv("PATH"), "LANG=C"}
+	for key, value := range extra {
+		env = append(env, key+"="+value)
+	}
+	return env
+}
+
+// sandboxCommand starts the plugin in its own process group, so a timeout
+// kills everything it spawned, and drops to cfg.User when set.
+func sandboxCommand(cmd *exec.Cmd, cfg ExecPluginConfig) error {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error {
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	}
+
+	if cfg.User == "" {
+		return nil
+	}
+	account, err := user.Lookup(cfg.User)
+	if err != nil {
+		return fmt.Errorf("user %s: %v", cfg.User, err)
+	}
+	uid, _ := strconv.ParseUint(account.Uid, 10, 32)
+	gid, _ := strconv.ParseUint(account.Gid, 10, 32)
+	cmd.SysProcAttr.Credential = &syscall.Credential{Uid: uint32(uid), Gid: uint32(gid)}
+	return nil
+}
@@ -0,0 +1,33 @@
+//go:build windows
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+)
+
+// execEnv gives plugins the variables Windows programs need to start and
+// the configured ones, so agent secrets do not leak into user scripts.
+func execEnv(extra map[string]string) []string {
+	var env []string
+	for _, key := range []string{"PATH", "SystemRoot", "TEMP", "TMP", "PATHEXT", "COMSPEC"} {
+		if value := os.Getenv(key); value != "" {
+			env = append(env, key+"="+value)
+		}
+	}
+	for key, value := range extra {
+		env = append(env, key+"="+value)
+	}
+	return env
+}
+
+// sandboxCommand cannot switch users on Windows; the default cancel kills
+// the plugin process itself.
+func sandboxCommand(cmd *exec.Cmd, cfg ExecPluginConfig) error {
+	if cfg.User != "" {
+		return fmt.Errorf("user is not supported on Windows")
+	}
+	return nil
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// parseTimeParam accepts RFC3339 or unix seconds.
+func parseTimeParam(value string) (time.Time, error) {
+	if seconds, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return time.Unix(seconds, 0).UTC(), nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
+
+// exportHandler writes stored history as tidy CSV with one row per
+// timestamp, metric and label set:
+//
+//	/export?format=csv&fields=cpu_usage_percent,disk_used_percent&minutes=120
+//
+// fields takes metric names, series keys or /regex/ entries; from and to
+// (RFC3339 or unix seconds) override minutes, and resolution/agg select
+// rollups as for /history.
+func exportHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	if format := query.Get("format"); format != "" && format != "csv" {
+		http.Error(w, fmt.Sprintf("Unsupported format %q", format), http.StatusBadRequest)
+		return
+	}
+
+	to := time.Now().UTC()
+	from := to.Add(-time.Hour)
+	if v := query.Get("minutes"); v != "" {
+		minutes, err := strconv.Atoi(v)
+		if err != nil || minutes <= 0 {
+			http.Error(w, "minutes must be a positive integer", http.StatusBadRequest)
+			return
+		}
+		from = to.Add(-time.Duration(minutes) * time.Minute)
+	}
+	for name, target := range map[string]*time.Time{"from": &from, "to": &to} {
+		if v := query.Get(name); v != "" {
+			t, err := parseTimeParam(v)
+			if err != nil {
+				http.Error(w, name+" must be RFC3339 or unix seconds", http.StatusBadRequest)
+				return
+			}
+			*target = t
+		}
+	}
+
+	resolution, agg, err := parseResolution(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	fields := query.Get("fields")
+	if fields == "" {
+		http.Error(w, "fields is required, e.g. fields=cpu_usage_percent,memory_usage_percent", http.StatusBadRequest)
+		return
+	}
+	seen := map[string]bool{}
+	var keys []string
+	for _, field := range strings.Split(fields, ",") {
+		matched, err := history.matchSeries(strings.TrimSpace(field))
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Invalid field %q: %v", field, err), http.StatusBadRequest)
+			return
+		}
+		for _, key := range matched {
+			if !seen[key] {
+				seen[key] = true
+				keys = append(keys, key)
+			}
+		}
+	}
+
+	type row struct {
+		time   time.Time
+		metric string
+		labels string
+		value  float64
+	}
+	var rows []row
+	for _, key := range keys {
+		name, labels := history.seriesInfo(key)
+		pairs := make([]string, 0, len(labels))
+		for k, v := range labels {
+			pairs = append(pairs, k+"="+v)
+		}
+		sort.Strings(pairs)
+		points, _ := history.pointsAt(key, from, to, resolution, agg)
+		for _, p := range points {
+			rows = append(rows, row{p.Time, name, strings.Join(pairs, ";"), p.Value})
+		}
+	}
+	sort.SliceStable(rows, func(i, j int) bool { return rows[i].time.Before(rows[j].time) })
+
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", `attachment; filename="metrics.csv"`)
+	out := csv.NewWriter(w)
+	out.Write([]string{"timestamp", "metric", "value", "labels"})
+	for _, r := range rows {
+		out.Write([]string{
+			r.time.Format("2006-01-02T15:04:05Z"),
+			r.metric,
+			strconv.FormatFloat(r.value, 'f', -1, 64),
+			r.labels,
+		})
+	}
+	out.Flush()
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Largest file read by the file metrics collector
+const FILE_METRIC_MAX_READ = 64 * 1024
+
+// FileMetricValue is a number read from one file.
+type FileMetricValue struct {
+	Name  string  `json:"name"`
+	Path  string  `json:"path"`
+	Value float64 `json:"value"`
+	Error string  `json:"error,omitempty"`
+}
+
+// collectFileMetrics reads every file_metrics entry. A glob path reports
+// one value per matching file.
+func collectFileMetrics() []FileMetricValue {
+	values := []FileMetricValue{}
+	for _, entry := range currentConfig().FileMetrics {
+		paths, _ := filepath.Glob(entry.Path)
+		if len(paths) == 0 {
+			values = append(values, FileMetricValue{Name: entry.Name, Path: entry.Path, Error: "no such file"})
+			continue
+		}
+		for _, path := range paths {
+			value := FileMetricValue{Name: entry.Name, Path: path}
+			number, err := readFileMetric(path, entry.Key, entry.Field)
+			if err != nil {
+				value.Error = err.Error()
+			} else {
+				value.Value = number * entry.Scale
+			}
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+// readFileMetric parses a number from a file. Without key the first field
+// of the file is used; with key, field counts the fields after the line
+// that starts with key, as in /proc/meminfo ("MemFree:  123 kB").
+func readFileMetric(path, key string, field int) (float64, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+	data, err := io.ReadAll(io.LimitReader(file, FILE_METRIC_MAX_READ))
+	if err != nil {
+		return 0, err
+	}
+
+	var fields []string
+	if key == "" {
+		fields = strings.Fields(string(data))
+	} else {
+		for _, line := range strings.Split(string(data), "\n") {
+			lineFields := strings.Fields(line)
+			if len(lineFields) > 0 && strings.TrimRight(lineFields[0], ":=") == key {
+				fields = lineFields[1:]
+				break
+			}
+		}
+		if fields == nil {
+			return 0, fmt.Errorf("no line starting with %q", key)
+		}
+	}
+	if field >= len(fields) {
+		return 0, fmt.Errorf("field %d not present", field)
+	}
+	number, err := strconv.ParseFloat(fields[field], 64)
+	if err != nil {
+		return 0, fmt.Errorf("not a number: %q", fields[field])
+	}
+	return number, nil
+}
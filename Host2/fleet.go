@@ -0,0 +1,209 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Time allowed for each peer when aggregating or proxying
+const FLEET_PEER_TIMEOUT = 10 * time.Second
+
+var fleetHTTPClient = &http.Client{Timeout: FLEET_PEER_TIMEOUT}
+
+// FleetSnapshot is one member's entry in GET /fleet/metrics.
+type FleetSnapshot struct {
+	AgentID  string         `json:"agent_id"`
+	Hostname string         `json:"hostname"`
+	Status   string         `json:"status"`
+	APIURL   string         `json:"api_url"`
+	Metrics  *SystemMetrics `json:"metrics,omitempty"`
+	Error    string         `json:"error,omitempty"`
+}
+
+func fleetHandler(w http.ResponseWriter, r *http.Request) {
+	if !currentConfig().Gossip.Enabled {
+		http.Error(w, "Gossip is disabled (gossip.enabled)", http.StatusNotFound)
+		return
+	}
+	members := visibleFleetMembers(r)
+	counts := map[string]int{"alive": 0, "suspect": 0, "dead": 0}
+	for _, m := range members {
+		counts[m.Status]++
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"members": members,
+		"counts":  counts,
+	})
+}
+
+// fleetMetricsHandler collects this agent's snapshot and fetches every
+// other live member's /metrics concurrently. Members that fail are listed
+// with their error instead of failing the whole response.
+func fleetMetricsHandler(w http.ResponseWriter, r *http.Request) {
+	if !currentConfig().Gossip.Enabled {
+		http.Error(w, "Gossip is disabled (gossip.enabled)", http.StatusNotFound)
+		return
+	}
+	includeSuspect := r.URL.Query().Get("include_suspect") == "true"
+
+	var members []FleetMember
+	for _, m := range visibleFleetMembers(r) {
+		if m.Status == "alive" || (m.Status == "suspect" && includeSuspect) {
+			members = append(members, m)
+		}
+	}
+
+	results := make([]FleetSnapshot, len(members))
+	var wg sync.WaitGroup
+	for i, m := range members {
+		results[i] = FleetSnapshot{AgentID: m.AgentID, Hostname: m.Hostname, Status: m.Status, APIURL: m.APIURL}
+		wg.Add(1)
+		go func(result *FleetSnapshot, m FleetMember) {
+			defer wg.Done()
+			var err error
+			if m.Self {
+				result.Metrics, err = collectForRequest(r)
+			} else {
+				result.Metrics, err = fetchPeerMetrics(m.APIURL)
+			}
+			if err != nil {
+				result.Error = err.Error()
+			}
+		}(&results[i], m)
+	}
+	wg.Wait()
+
+	healthy := 0
+	for _, result := range results {
+		if result.Metrics != nil {
+			healthy++
+		}
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"timestamp": time.Now().UTC().Format("2006-01-02T15:04:05Z"),
+		"members":   results,
+		"reachable": healthy,
+		"total":     len(results),
+	})
+}
+
+// visibleFleetMembers lists the members the request's API key may see.
+func visibleFleetMembers(r *http.Request) []FleetMember {
+	members := fleetMembers()
+	key := requestAPIKey(r)
+	if key == nil {
+		return members
+	}
+	visible := members[:0]
+	for _, m := range members {
+		if key.allowsHost(m.Hostname, m.AgentID) {
+			visible = append(visible, m)
+		}
+	}
+	return visible
+}
+
+// newPeerRequest builds a GET to a member, authenticated with
+// gossip.api_key when one is set. The key only goes out with signed gossip,
+// where member API URLs come from agents holding the secret.
+func newPeerRequest(ctx context.Context, target string) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return nil, err
+	}
+	if cfg := currentConfig().Gossip; cfg.APIKey != "" && cfg.Secret != "" {
+		req.Header.Set("X-API-Key", cfg.APIKey)
+	}
+	return req, nil
+}
+
+func fetchPeerMetrics(apiURL string) (*SystemMetrics, error) {
+	if apiURL == "" {
+		return nil, fmt.Errorf("member advertises no API URL")
+	}
+	req, err := newPeerRequest(context.Background(), strings.TrimSuffix(apiURL, "/")+"/metrics")
+	if err != nil {
+		return nil, err
+	}
+	resp, err := fleetHTTPClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return nil, fmt.Errorf("unexpected status %d: %s", resp.StatusCode, strings.TrimSpace(string(detail)))
+	}
+	var metrics SystemMetrics
+	if err := json.NewDecoder(resp.Body).Decode(&metrics); err != nil {
+		return nil, fmt.Errorf("invalid metrics: %v", err)
+	}
+	return &metrics, nil
+}
+
+// fleetProxyHandler forwards a GET to one member's API:
+// /fleet/proxy?agent=<agent_id or hostname>&path=/processes?sort=cpu.
+// The caller's credentials are not forwarded; peers see gossip.api_key, so
+// endpoints that need the API token cannot be reached through a peer.
+// Host-restricted keys can only proxy to the members they list.
+func fleetProxyHandler(w http.ResponseWriter, r *http.Request) {
+	if !currentConfig().Gossip.Enabled {
+		http.Error(w, "Gossip is disabled (gossip.enabled)", http.StatusNotFound)
+		return
+	}
+	query := r.URL.Query()
+	target, path := query.Get("agent"), query.Get("path")
+	if target == "" || !strings.HasPrefix(path, "/") || strings.HasPrefix(path, "//") {
+		http.Error(w, "agent and an absolute path are required", http.StatusBadRequest)
+		return
+	}
+	// Proxying to /fleet would let two agents bounce a request forever
+	if strings.HasPrefix(path, "/fleet") {
+		http.Error(w, "The fleet endpoints cannot be proxied", http.StatusBadRequest)
+		return
+	}
+
+	var member *FleetMember
+	for _, m := range visibleFleetMembers(r) {
+		if m.AgentID == target || m.Hostname == target {
+			m := m
+			member = &m
+			break
+		}
+	}
+	if member == nil {
+		http.Error(w, fmt.Sprintf("Unknown member %q", target), http.StatusNotFound)
+		return
+	}
+	if member.APIURL == "" {
+		http.Error(w, "Member advertises no API URL", http.StatusBadGateway)
+		return
+	}
+
+	req, err := newPeerRequest(r.Context(), strings.TrimSuffix(member.APIURL, "/")+path)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if accept := r.Header.Get("Accept"); accept != "" {
+		req.Header.Set("Accept", accept)
+	}
+	resp, err := fleetHTTPClient.Do(req)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Member %s unreachable: %v", member.Hostname, err), http.StatusBadGateway)
+		return
+	}
+	defer resp.Body.Close()
+	if contentType := resp.Header.Get("Content-Type"); contentType != "" {
+		w.Header().Set("Content-Type", contentType)
+	}
+	w.Header().Set("X-Fleet-Member", member.AgentID)
+	w.WriteHeader(resp.StatusCode)
+	io.Copy(w, resp.Body)
+}
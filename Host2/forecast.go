@@ -0,0 +1,87 @@
+package main
+
+import (
+	"math"
+	"time"
+)
+
+// applyDiskForecasts estimates how fast each filesystem is growing from the
+// history store and how many days remain until it is full.
+func applyDiskForecasts(disks []DiskInfo) {
+	cfg := currentConfig().Forecast
+	now := time.Now().UTC()
+	from := now.Add(-time.Duration(cfg.WindowHours) * time.Hour)
+
+	for i := range disks {
+		disk := &disks[i]
+		if disk.Status == "timeout" {
+			continue
+		}
+		points := history.points(seriesKey("disk_used_gb", map[string]string{"device": disk.Device}), from, now)
+		if len(points) < cfg.MinSamples {
+			continue
+		}
+
+		var perDay, days float64
+		var ok bool
+		if cfg.Model == "exponential" {
+			perDay, days, ok = exponentialForecast(points, disk.UsedGB, disk.TotalGB)
+		} else {
+			perDay, days, ok = linearForecast(points, disk.UsedGB, disk.TotalGB)
+		}
+		disk.GrowthGBPerDay = perDay
+		if ok {
+			disk.DaysUntilFull = &days
+		}
+	}
+}
+
+// fitLine performs a least-squares fit of y against time in days, returning
+// the slope per day. ok is false if all samples share one timestamp.
+func fitLine(points []historyPoint, y func(float64) float64) (slope float64, ok bool) {
+	origin := points[0].Time
+	var sumX, sumY, sumXY, sumXX float64
+	n := float64(len(points))
+	for _, p := range points {
+		x := p.Time.Sub(origin).Hours() / 24
+		v := y(p.Value)
+		sumX += x
+		sumY += v
+		sumXY += x * v
+		sumXX += x * x
+	}
+	denominator := n*sumXX - sumX*sumX
+	if denominator == 0 {
+		return 0, false
+	}
+	return (n*sumXY - sumX*sumY) / denominator, true
+}
+
+// linearForecast assumes constant growth in GB per day.
+func linearForecast(points []historyPoint, used, total float64) (perDay, days float64, ok bool) {
+	slope, ok := fitLine(points, func(v float64) float64 { return v })
+	if !ok || slope <= 0 {
+		return slope, 0, false
+	}
+	return slope, math.Max(total-used, 0) / slope, true
+}
+
+// exponentialForecast assumes usage grows by a constant percentage per day,
+// fitting a line to log(used).
+func exponentialForecast(points []historyPoint, used, total float64) (perDay, days float64, ok bool) {
+	for _, p := range points {
+		if p.Value <= 0 {
+			return 0, 0, false
+		}
+	}
+	rate, ok := fitLine(points, math.Log)
+	if !ok || rate <= 0 || used <= 0 {
+		return 0, 0, false
+	}
+	// Growth per day at the current usage level
+	perDay = used * (math.Exp(rate) - 1)
+	if used >= total {
+		return perDay, 0, true
+	}
+	return perDay, math.Log(total/used) / rate, true
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+var errProbeTimeout = errors.New("timed out")
+
+// probeCall is one filesystem call that may be blocked in the kernel.
+type probeCall struct {
+	start time.Time
+	done  chan struct{}
+	value interface{}
+	err   error
+}
+
+// Filesystem calls in flight, by key. A call on a hung mount can block
+// forever, so a key never gets a second goroutine while the first one is
+// running; later callers wait on the same call instead.
+var probes = struct {
+	sync.Mutex
+	calls map[string]*probeCall
+}{calls: make(map[string]*probeCall)}
+
+// boundedProbe runs probe in a goroutine and gives up after timeout,
+// returning the probe's result and how long it took. Callers joining a
+// running call get that call's result.
+func boundedProbe(key string, timeout time.Duration, probe func() (interface{}, error)) (interface{}, time.Duration, error) {
+	probes.Lock()
+	call, running := probes.calls[key]
+	if !running {
+		call = &probeCall{start: time.Now(), done: make(chan struct{})}
+		probes.calls[key] = call
+		go func() {
+			call.value, call.err = probe()
+			probes.Lock()
+			delete(probes.calls, key)
+			probes.Unlock()
+			close(call.done)
+		}()
+	}
+	probes.Unlock()
+
+	select {
+	case <-call.done:
+		return call.value, time.Since(call.start), call.err
+	case <-time.After(timeout):
+		return nil, timeout, errProbeTimeout
+	}
+}
@@ -2,15 +2,23 @@ module system-monitor-agent
 
 go 1.21
 
-require github.com/shirou/gopsutil/v3 v3.23.11
+require (
+	github.com/cilium/ebpf v0.16.0
+	github.com/segmentio/kafka-go v0.4.47
+	github.com/shirou/gopsutil/v3 v3.23.11
+	github.com/tetratelabs/wazero v1.8.2
+)
 
 require (
 	github.com/go-ole/go-ole v1.2.6 // indirect
+	github.com/klauspost/compress v1.15.9 // indirect
 	github.com/lufia/plan9stats v0.0.0-20211012122336-39d0f177ccd0 // indirect
+	github.com/pierrec/lz4/v4 v4.1.15 // indirect
 	github.com/power-devops/perfstat v0.0.0-20210106213030-5aafc221ea8c // indirect
 	github.com/shoenig/go-m1cpu v0.1.6 // indirect
 	github.com/tklauser/go-sysconf v0.3.12 // indirect
 	github.com/tklauser/numcpus v0.6.1 // indirect
 	github.com/yusufpapurcu/wmi v1.2.3 // indirect
-	golang.org/x/sys v0.15.0 // indirect
+	golang.org/x/exp v0.0.0-20230224173230-c95f2b4c22f2 // indirect
+	golang.org/x/sys v0.20.0 // indirect
 )
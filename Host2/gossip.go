@@ -0,0 +1,359 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/json"
+	"log"
+	"math/rand"
+	"net"
+	"net/url"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// Peers each member gossips with per round
+	GOSSIP_FANOUT = 3
+	// Other members carried per message, keeping it within one datagram
+	GOSSIP_MAX_MEMBERS = 40
+	// Every this many rounds a seed is contacted even with live peers, so
+	// partitioned groups find each other again
+	GOSSIP_SEED_ROUNDS = 10
+	// Dead members are listed this long before being forgotten
+	GOSSIP_FORGET_AFTER = 10 * time.Minute
+	GOSSIP_MAX_PACKET   = 65507
+)
+
+// GossipMember is one agent as its peers know it. Generation is the
+// agent's start time, so a restarted agent's heartbeats win over the
+// counters of its previous run.
+type GossipMember struct {
+	AgentID    string            `json:"agent_id"`
+	Hostname   string            `json:"hostname"`
+	Addr       string            `json:"addr"`    // gossip UDP address
+	APIURL     string            `json:"api_url"` // base URL of the HTTP API
+	APIPort    string            `json:"api_port,omitempty"`
+	Generation int64             `json:"generation"`
+	Heartbeat  uint64            `json:"heartbeat"`
+	Health     string            `json:"health,omitempty"`
+	Version    string            `json:"version"`
+	Labels     map[string]string `json:"labels,omitempty"`
+}
+
+// newer reports whether m carries later state than other.
+func (m GossipMember) newer(other GossipMember) bool {
+	if m.Generation != other.Generation {
+		return m.Generation > other.Generation
+	}
+	return m.Heartbeat > other.Heartbeat
+}
+
+type gossipPeer struct {
+	member  GossipMember
+	updated time.Time // when the heartbeat last advanced
+}
+
+// gossipMessage is exchanged push-pull: a "sync" is answered with an "ack"
+// carrying the receiver's view.
+type gossipMessage struct {
+	Type    string         `json:"type"`
+	From    string         `json:"from"`
+	Members []GossipMember `json:"members"`
+}
+
+var gossipState = struct {
+	sync.Mutex
+	self   GossipMember
+	peers  map[string]*gossipPeer
+	rounds int
+}{peers: map[string]*gossipPeer{}}
+
+// startGossip runs the membership protocol while gossip is enabled,
+// restarting it on every config reload.
+func startGossip() {
+	generation := time.Now().UnixNano()
+	for {
+		reloaded := configReloaded()
+		cfg := currentConfig().Gossip
+		var conn net.PacketConn
+		if cfg.Enabled {
+			var err error
+			if conn, err = net.ListenPacket("udp", cfg.Listen); err != nil {
+				log.Printf("[GOSSIP] Failed to listen on %s: %v", cfg.Listen, err)
+			} else {
+				log.Printf("[GOSSIP] Listening on %s (%d seeds)", conn.LocalAddr(), len(cfg.Seeds))
+				gossipState.Lock()
+				gossipState.self.Generation = generation
+				gossipState.Unlock()
+				go receiveGossip(conn, cfg)
+				go runGossipRounds(conn, cfg, reloaded)
+			}
+		} else {
+			gossipState.Lock()
+			gossipState.peers = map[string]*gossipPeer{}
+			gossipState.Unlock()
+		}
+		<-reloaded
+		if conn != nil {
+			conn.Close()
+		}
+	}
+}
+
+// refreshSelf advances the agent's own heartbeat and republishes its
+// current identity and health.
+func refreshSelf(cfg GossipConfig) {
+	apiPort := ""
+	if addrs, err := resolveListenAddresses(currentConfig().API.Listen); err == nil && len(addrs) > 0 {
+		_, apiPort, _ = net.SplitHostPort(addrs[0])
+	}
+	health := ""
+	sectionState.Lock()
+	if last := sectionState.last; last != nil {
+		health = last.Health
+	}
+	sectionState.Unlock()
+
+	gossipState.Lock()
+	defer gossipState.Unlock()
+	self := &gossipState.self
+	self.AgentID = agentID()
+	self.Hostname = agentHostname()
+	self.Addr = cfg.Advertise
+	if self.Addr == "" {
+		self.Addr = cfg.Listen
+	}
+	self.APIURL = cfg.APIURL
+	self.APIPort = apiPort
+	self.Heartbeat++
+	self.Health = health
+	self.Version = VERSION
+	self.Labels = currentConfig().Labels
+}
+
+func runGossipRounds(conn net.PacketConn, cfg GossipConfig, stop <-chan struct{}) {
+	interval := time.Duration(cfg.IntervalSeconds) * time.Second
+	for {
+		refreshSelf(cfg)
+		gossipState.Lock()
+		gossipState.rounds++
+		contactSeed := gossipState.rounds%GOSSIP_SEED_ROUNDS == 1
+		var live []string
+		for _, peer := range gossipState.peers {
+			if gossipStatus(peer, cfg, time.Now()) != "dead" {
+				live = append(live, peer.member.Addr)
+			}
+		}
+		gossipState.Unlock()
+
+		rand.Shuffle(len(live), func(i, j int) { live[i], live[j] = live[j], live[i] })
+		if len(live) > GOSSIP_FANOUT {
+			live = live[:GOSSIP_FANOUT]
+		}
+		targets := live
+		if (len(live) == 0 || contactSeed) && len(cfg.Seeds) > 0 {
+			targets = append(targets, cfg.Seeds[rand.Intn(len(cfg.Seeds))])
+		}
+		for _, target := range targets {
+			sendGossip(conn, cfg, target, "sync")
+		}
+
+		select {
+		case <-time.After(interval):
+		case <-stop:
+			return
+		}
+	}
+}
+
+// gossipView returns the agent's own entry followed by a random sample of
+// the members that are not dead.
+func gossipView(cfg GossipConfig) []GossipMember {
+	gossipState.Lock()
+	defer gossipState.Unlock()
+	members := []GossipMember{gossipState.self}
+	now := time.Now()
+	for _, peer := range gossipState.peers {
+		if gossipStatus(peer, cfg, now) != "dead" {
+			members = append(members, peer.member)
+		}
+	}
+	others := members[1:]
+	rand.Shuffle(len(others), func(i, j int) { others[i], others[j] = others[j], others[i] })
+	if len(others) > GOSSIP_MAX_MEMBERS {
+		members = members[:1+GOSSIP_MAX_MEMBERS]
+	}
+	return members
+}
+
+func sendGossip(conn net.PacketConn, cfg GossipConfig, target, kind string) {
+	addr, err := net.ResolveUDPAddr("udp", target)
+	if err != nil {
+		log.Printf("[GOSSIP] Cannot resolve %s: %v", target, err)
+		return
+	}
+	data, err := json.Marshal(gossipMessage{Type: kind, From: agentID(), Members: gossipView(cfg)})
+	if err != nil {
+		return
+	}
+	conn.WriteTo(sealGossip(cfg.Secret, data), addr)
+}
+
+// sealGossip prefixes the message with its HMAC-SHA256 when a secret is
+// configured; openGossip checks and strips it.
+func sealGossip(secret string, data []byte) []byte {
+	if secret == "" {
+		return data
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(data)
+	return append(mac.Sum(nil), data...)
+}
+
+func openGossip(secret string, packet []byte) ([]byte, bool) {
+	if secret == "" {
+		return packet, true
+	}
+	if len(packet) < sha256.Size {
+		return nil, false
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(packet[sha256.Size:])
+	return packet[sha256.Size:], hmac.Equal(mac.Sum(nil), packet[:sha256.Size])
+}
+
+func receiveGossip(conn net.PacketConn, cfg GossipConfig) {
+	buf := make([]byte, GOSSIP_MAX_PACKET)
+	for {
+		n, from, err := conn.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		data, ok := openGossip(cfg.Secret, buf[:n])
+		if !ok {
+			continue
+		}
+		var msg gossipMessage
+		if err := json.Unmarshal(data, &msg); err != nil || msg.From == "" || msg.From == agentID() {
+			continue
+		}
+		sourceIP := from.(*net.UDPAddr).IP.String()
+		mergeGossip(msg, sourceIP, cfg.Secret != "")
+		if msg.Type == "sync" {
+			sendGossip(conn, cfg, from.String(), "ack")
+		}
+	}
+}
+
+// mergeGossip keeps the newest state of every member. The sender's own
+// entry gets the packet's source address wherever it advertised no host,
+// which is what lets agents listening on all interfaces find each other.
+// Unless messages are signed, API URLs are only taken from a member's own
+// packets and must point at their source, so a forged or relayed entry
+// cannot aim /fleet requests at another host.
+func mergeGossip(msg gossipMessage, sourceIP string, signed bool) {
+	gossipState.Lock()
+	defer gossipState.Unlock()
+	now := time.Now()
+	for _, member := range msg.Members {
+		if member.AgentID == "" || member.AgentID == gossipState.self.AgentID {
+			continue
+		}
+		peer, ok := gossipState.peers[member.AgentID]
+		if member.AgentID == msg.From {
+			fillGossipAddresses(&member, sourceIP, signed)
+		} else if !signed {
+			member.APIURL = ""
+			if ok {
+				member.APIURL = peer.member.APIURL
+			}
+		}
+		if !ok {
+			log.Printf("[GOSSIP] Discovered %s (%s) at %s", member.Hostname, member.AgentID, member.Addr)
+			gossipState.peers[member.AgentID] = &gossipPeer{member: member, updated: now}
+			continue
+		}
+		if member.newer(peer.member) {
+			peer.member = member
+			peer.updated = now
+		}
+	}
+	for id, peer := range gossipState.peers {
+		if now.Sub(peer.updated) > GOSSIP_FORGET_AFTER {
+			delete(gossipState.peers, id)
+		}
+	}
+}
+
+func fillGossipAddresses(member *GossipMember, sourceIP string, signed bool) {
+	if host, port, err := net.SplitHostPort(member.Addr); err == nil {
+		if ip := net.ParseIP(host); host == "" || (ip != nil && ip.IsUnspecified()) {
+			member.Addr = net.JoinHostPort(sourceIP, port)
+		}
+	}
+	if member.APIURL != "" && !signed {
+		if parsed, err := url.Parse(member.APIURL); err != nil || !net.ParseIP(parsed.Hostname()).Equal(net.ParseIP(sourceIP)) {
+			member.APIURL = ""
+		}
+	}
+	if member.APIURL == "" && member.APIPort != "" {
+		member.APIURL = "http://" + net.JoinHostPort(sourceIP, member.APIPort)
+	}
+}
+
+// gossipStatus classifies a peer by how long its heartbeat has not moved.
+func gossipStatus(peer *gossipPeer, cfg GossipConfig, now time.Time) string {
+	age := now.Sub(peer.updated)
+	switch {
+	case age >= time.Duration(cfg.DeadSeconds)*time.Second:
+		return "dead"
+	case age >= time.Duration(cfg.SuspectSeconds)*time.Second:
+		return "suspect"
+	}
+	return "alive"
+}
+
+// FleetMember is one entry of GET /fleet.
+type FleetMember struct {
+	GossipMember
+	Status   string `json:"status"` // "alive", "suspect" or "dead"
+	Self     bool   `json:"self"`
+	LastSeen string `json:"last_seen"`
+}
+
+// fleetMembers lists this agent and every known peer, by hostname.
+func fleetMembers() []FleetMember {
+	cfg := currentConfig().Gossip
+	gossipState.Lock()
+	defer gossipState.Unlock()
+	now := time.Now()
+	self := gossipState.self
+	if self.APIURL == "" && self.APIPort != "" {
+		self.APIURL = "http://" + net.JoinHostPort("127.0.0.1", self.APIPort)
+	}
+	members := []FleetMember{{GossipMember: self, Status: "alive", Self: true, LastSeen: now.UTC().Format("2006-01-02T15:04:05Z")}}
+	for _, peer := range gossipState.peers {
+		members = append(members, FleetMember{
+			GossipMember: peer.member,
+			Status:       gossipStatus(peer, cfg, now),
+			LastSeen:     peer.updated.UTC().Format("2006-01-02T15:04:05Z"),
+		})
+	}
+	sort.Slice(members, func(i, j int) bool {
+		if members[i].Hostname != members[j].Hostname {
+			return members[i].Hostname < members[j].Hostname
+		}
+		return members[i].AgentID < members[j].AgentID
+	})
+	return members
+}
+
+// gossipSeedAddress adds the default port to a seed given as a bare host.
+func gossipSeedAddress(seed string) string {
+	if _, _, err := net.SplitHostPort(seed); err != nil {
+		return net.JoinHostPort(seed, "7946")
+	}
+	return seed
+}
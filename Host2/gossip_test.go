@@ -0,0 +1,78 @@
+package main
+
+import "testing"
+
+func TestMergeGossipAPIURL(t *testing.T) {
+	member := func(id, apiURL string) GossipMember {
+		return GossipMember{AgentID: id, Hostname: id, Addr: ":7946", APIURL: apiURL, APIPort: "8889", Generation: 1, Heartbeat: 1}
+	}
+	tests := []struct {
+		name   string
+		known  string // API URL already known for node2
+		msg    gossipMessage
+		signed bool
+		want   string
+	}{
+		{
+			name: "sender without api_url",
+			msg:  gossipMessage{From: "node2", Members: []GossipMember{member("node2", "")}},
+			want: "http://10.0.0.2:8889",
+		},
+		{
+			name: "sender advertising its own address",
+			msg:  gossipMessage{From: "node2", Members: []GossipMember{member("node2", "https://10.0.0.2:9443")}},
+			want: "https://10.0.0.2:9443",
+		},
+		{
+			name: "unsigned sender pointing elsewhere",
+			msg:  gossipMessage{From: "node2", Members: []GossipMember{member("node2", "http://169.254.169.254/latest")}},
+			want: "http://10.0.0.2:8889",
+		},
+		{
+			name:   "signed sender behind NAT",
+			msg:    gossipMessage{From: "node2", Members: []GossipMember{member("node2", "https://node2.example.com")}},
+			signed: true,
+			want:   "https://node2.example.com",
+		},
+		{
+			name: "unsigned relay of an unknown member",
+			msg:  gossipMessage{From: "node3", Members: []GossipMember{member("node2", "http://169.254.169.254")}},
+			want: "",
+		},
+		{
+			name:  "unsigned relay keeps what the member said itself",
+			known: "http://10.0.0.2:8889",
+			msg:   gossipMessage{From: "node3", Members: []GossipMember{member("node2", "http://169.254.169.254")}},
+			want:  "http://10.0.0.2:8889",
+		},
+		{
+			name:   "signed relay",
+			msg:    gossipMessage{From: "node3", Members: []GossipMember{member("node2", "http://10.0.0.2:8889")}},
+			signed: true,
+			want:   "http://10.0.0.2:8889",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gossipState.Lock()
+			gossipState.peers = map[string]*gossipPeer{}
+			if tt.known != "" {
+				known := member("node2", tt.known)
+				known.Heartbeat = 0
+				gossipState.peers["node2"] = &gossipPeer{member: known}
+			}
+			gossipState.Unlock()
+
+			mergeGossip(tt.msg, "10.0.0.2", tt.signed)
+			gossipState.Lock()
+			defer gossipState.Unlock()
+			peer, ok := gossipState.peers["node2"]
+			if !ok {
+				t.Fatal("node2 was not merged")
+			}
+			if peer.member.APIURL != tt.want {
+				t.Errorf("api_url %q, want %q", peer.member.APIURL, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Request and response shapes of the Grafana JSON datasource
+// (simpod-json-datasource / grafana-simple-json-datasource).
+
+type grafanaRange struct {
+	From time.Time `json:"from"`
+	To   time.Time `json:"to"`
+}
+
+type grafanaTarget struct {
+	Target string `json:"target"`
+	RefID  string `json:"refId"`
+	Type   string `json:"type"` // "timeserie" (default) or "table"
+	Hide   bool   `json:"hide"`
+}
+
+type grafanaQuery struct {
+	Range         grafanaRange    `json:"range"`
+	IntervalMs    int64           `json:"intervalMs"`
+	MaxDataPoints int             `json:"maxDataPoints"`
+	Targets       []grafanaTarget `json:"targets"`
+}
+
+type grafanaSeries struct {
+	Target     string       `json:"target"`
+	Datapoints [][2]float64 `json:"datapoints"` // [value, unix ms]
+}
+
+type grafanaColumn struct {
+	Text string `json:"text"`
+	Type string `json:"type"`
+}
+
+type grafanaTable struct {
+	Type    string          `json:"type"`
+	Columns []grafanaColumn `json:"columns"`
+	Rows    [][]interface{} `json:"rows"`
+}
+
+type grafanaAnnotation struct {
+	Time    int64    `json:"time"`
+	TimeEnd int64    `json:"timeEnd,omitempty"`
+	Title   string   `json:"title"`
+	Text    string   `json:"text"`
+	Tags    []string `json:"tags"`
+}
+
+// grafanaRangeOrDefault falls back to the last hour when Grafana sends no
+// range (e.g. from the query editor).
+func grafanaRangeOrDefault(r grafanaRange) (time.Time, time.Time) {
+	to := r.To
+	if to.IsZero() {
+		to = time.Now().UTC()
+	}
+	from := r.From
+	if from.IsZero() || !from.Before(to) {
+		from = to.Add(-time.Hour)
+	}
+	return from, to
+}
+
+// downsample averages points into at most max buckets.
+func downsample(points []historyPoint, max int) []historyPoint {
+	if max <= 0 || len(points) <= max {
+		return points
+	}
+	out := make([]historyPoint, 0, max)
+	size := float64(len(points)) / float64(max)
+	for i := 0; i < max; i++ {
+		start, end := int(float64(i)*size), int(float64(i+1)*size)
+		if end <= start {
+			continue
+		}
+		sum := 0.0
+		for _, p := range points[start:end] {
+			sum += p.Value
+		}
+		out = append(out, historyPoint{Time: points[start].Time, Value: sum / float64(end-start)})
+	}
+	return out
+}
+
+// grafanaTestHandler answers the datasource connection test.
+func grafanaTestHandler(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+// grafanaSearchHandler lists metric names and series keys containing the
+// typed text.
+func grafanaSearchHandler(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Target string `json:"target"`
+	}
+	json.NewDecoder(r.Body).Decode(&req)
+
+	seen := map[string]bool{}
+	results := []string{}
+	for _, key := range history.seriesKeys() {
+		name := key
+		if i := strings.IndexByte(key, '{'); i >= 0 {
+			name = key[:i]
+		}
+		for _, candidate := range []string{name, key} {
+			if !seen[candidate] && strings.Contains(candidate, req.Target) {
+				seen[candidate] = true
+				results = append(results, candidate)
+			}
+		}
+	}
+	sort.Strings(results)
+	writeJSON(w, http.StatusOK, results)
+}
+
+// grafanaQueryHandler returns time series or a table for each target.
+func grafanaQueryHandler(w http.ResponseWriter, r *http.Request) {
+	var req grafanaQuery
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid JSON: %v", err), http.StatusBadRequest)
+		return
+	}
+	from, to := grafanaRangeOrDefault(req.Range)
+
+	response := []interface{}{}
+	for _, target := range req.Targets {
+		if target.Hide || target.Target == "" {
+			continue
+		}
+		keys, err := history.matchSeries(target.Target)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Invalid target %q: %v", target.Target, err), http.StatusBadRequest)
+			return
+		}
+
+		if target.Type == "table" {
+			table := grafanaTable{
+				Type: "table",
+				Columns: []grafanaColumn{
+					{Text: "Time", Type: "time"},
+					{Text: "Series", Type: "string"},
+					{Text: "Value", Type: "number"},
+				},
+				Rows: [][]interface{}{},
+			}
+			for _, key := range keys {
+				for _, p := range history.points(key, from, to) {
+					table.Rows = append(table.Rows, []interface{}{p.Time.UnixMilli(), key, p.Value})
+				}
+			}
+			response = append(response, table)
+			continue
+		}
+
+		for _, key := range keys {
+			series := grafanaSeries{Target: key, Datapoints: [][2]float64{}}
+			for _, p := range downsample(history.points(key, from, to), req.MaxDataPoints) {
+				series.Datapoints = append(series.Datapoints, [2]float64{p.Value, float64(p.Time.UnixMilli())})
+			}
+			response = append(response, series)
+		}
+	}
+	writeJSON(w, http.StatusOK, response)
+}
+
+// grafanaAnnotationsHandler turns alerts active during the range into
+// region annotations tagged with rule and severity. The annotation query
+// text, when set, filters on alert ID or message.
+func grafanaAnnotationsHandler(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Range      grafanaRange `json:"range"`
+		Annotation struct {
+			Query string `json:"query"`
+		} `json:"annotation"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid JSON: %v", err), http.StatusBadRequest)
+		return
+	}
+	from, to := grafanaRangeOrDefault(req.Range)
+	filter := req.Annotation.Query
+
+	annotations := []grafanaAnnotation{}
+	add := func(id, rule, severity, message, startedAt string, endedAt time.Time) {
+		start, err := time.Parse("2006-01-02T15:04:05Z", startedAt)
+		if err != nil || start.After(to) || endedAt.Before(from) {
+			return
+		}
+		if filter != "" && !strings.Contains(id, filter) && !strings.Contains(message, filter) {
+			return
+		}
+		annotations = append(annotations, grafanaAnnotation{
+			Time:    start.UnixMilli(),
+			TimeEnd: endedAt.UnixMilli(),
+			Title:   id,
+			Text:    message,
+			Tags:    []string{rule, severity},
+		})
+	}
+
+	for _, record := range resolvedAlerts() {
+		ended, err := time.Parse("2006-01-02T15:04:05Z", record.EndedAt)
+		if err == nil {
+			add(record.ID, record.Rule, record.Severity, record.Message, record.StartedAt, ended)
+		}
+	}
+	now := time.Now().UTC()
+	for _, alert := range currentAlerts() {
+		add(alert.ID, alert.Rule, alert.Severity, alert.Message, alert.StartedAt, now)
+	}
+	writeJSON(w, http.StatusOK, annotations)
+}
@@ -0,0 +1,703 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// metricSample is one numeric value flattened out of a snapshot.
+type metricSample struct {
+	Name   string
+	Labels map[string]string
+	Value  float64
+}
+
+// historySample holds every series value recorded at one point in time,
+// keyed by seriesKey.
+type historySample struct {
+	Time   time.Time
+	Values map[string]float64
+}
+
+type historyPoint struct {
+	Time  time.Time
+	Value float64
+}
+
+// aggregate summarises the raw values that fell into one rollup bucket.
+type aggregate struct {
+	Count int
+	Sum   float64
+	Min   float64
+	Max   float64
+}
+
+func (a *aggregate) add(value float64) {
+	if a.Count == 0 || value < a.Min {
+		a.Min = value
+	}
+	if a.Count == 0 || value > a.Max {
+		a.Max = value
+	}
+	a.Count++
+	a.Sum += value
+}
+
+// value returns the avg (default), min or max of the bucket.
+func (a *aggregate) value(agg string) float64 {
+	switch agg {
+	case "min":
+		return a.Min
+	case "max":
+		return a.Max
+	}
+	return a.Sum / float64(a.Count)
+}
+
+type rollupBucket struct {
+	Start  time.Time
+	Values map[string]*aggregate
+}
+
+// rollupTier keeps fixed-width aggregates of every series for longer than
+// raw samples are kept.
+type rollupTier struct {
+	name      string
+	step      time.Duration
+	retention time.Duration
+	buckets   []rollupBucket
+}
+
+// historyStore keeps flattened snapshots in memory for the raw retention
+// window and rolls them up into coarser tiers with their own retention.
+type historyStore struct {
+	mu        sync.RWMutex
+	retention time.Duration
+	samples   []historySample
+	tiers     []*rollupTier           // finest first
+	series    map[string]metricSample // series key -> name and labels
+	lastSeen  map[string]time.Time    // series key -> time of its last point
+}
+
+var history = newHistoryStore(24 * time.Hour)
+
+func newHistoryStore(retention time.Duration) *historyStore {
+	return &historyStore{retention: retention, series: make(map[string]metricSample), lastSeen: make(map[string]time.Time)}
+}
+
+// Rollup resolutions accepted in history.rollups
+var rollupSteps = map[string]time.Duration{"1m": time.Minute, "5m": 5 * time.Minute, "1h": time.Hour}
+
+// seriesKey renders a series identifier in Prometheus style, e.g.
+// disk_used_gb{device="/"}.
+func seriesKey(name string, labels map[string]string) string {
+	if len(labels) == 0 {
+		return name
+	}
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var b strings.Builder
+	b.WriteString(name)
+	b.WriteByte('{')
+	for i, k := range keys {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(k + `="` + labels[k] + `"`)
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+// configure applies history settings. Existing rollup data is kept for
+// tiers that are still configured.
+func (h *historyStore) configure(cfg HistoryConfig) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.retention = time.Duration(cfg.RetentionHours) * time.Hour
+
+	existing := make(map[string]*rollupTier, len(h.tiers))
+	for _, tier := range h.tiers {
+		existing[tier.name] = tier
+	}
+	h.tiers = nil
+	for _, rollup := range cfg.Rollups {
+		tier, ok := existing[rollup.Resolution]
+		if !ok {
+			tier = &rollupTier{name: rollup.Resolution, step: rollupSteps[rollup.Resolution]}
+		}
+		tier.retention = time.Duration(rollup.RetentionHours) * time.Hour
+		h.tiers = append(h.tiers, tier)
+	}
+	sort.Slice(h.tiers, func(i, j int) bool { return h.tiers[i].step < h.tiers[j].step })
+}
+
+// add records a snapshot, folds it into every rollup tier and drops data
+// older than each retention window, so a series that stops reporting ages
+// out of every tier on that tier's schedule. Series whose last point has
+// left the longest window are forgotten, so short-lived label values such
+// as removed cgroups do not pile up.
+func (h *historyStore) add(metrics *SystemMetrics) {
+	timestamp, err := time.Parse("2006-01-02T15:04:05Z", metrics.Timestamp)
+	if err != nil {
+		timestamp = time.Now().UTC()
+	}
+
+	sample := historySample{Time: timestamp, Values: make(map[string]float64)}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for _, m := range flattenMetrics(metrics) {
+		key := seriesKey(m.Name, m.Labels)
+		sample.Values[key] = m.Value
+		if _, ok := h.series[key]; !ok {
+			h.series[key] = metricSample{Name: m.Name, Labels: m.Labels}
+		}
+		h.lastSeen[key] = timestamp
+	}
+	h.samples = append(h.samples, sample)
+
+	cutoff := timestamp.Add(-h.retention)
+	drop := 0
+	for drop < len(h.samples) && h.samples[drop].Time.Before(cutoff) {
+		drop++
+	}
+	if drop > 0 {
+		h.samples = append([]historySample{}, h.samples[drop:]...)
+	}
+	keep := h.retention
+	for _, tier := range h.tiers {
+		if tier.retention > keep {
+			keep = tier.retention
+		}
+	}
+	for key, seen := range h.lastSeen {
+		if seen.Before(timestamp.Add(-keep)) {
+			delete(h.series, key)
+			delete(h.lastSeen, key)
+		}
+	}
+
+	for _, tier := range h.tiers {
+		start := timestamp.Truncate(tier.step)
+		if n := len(tier.buckets); n == 0 || !tier.buckets[n-1].Start.Equal(start) {
+			tier.buckets = append(tier.buckets, rollupBucket{Start: start, Values: make(map[string]*aggregate)})
+		}
+		bucket := tier.buckets[len(tier.buckets)-1]
+		for key, value := range sample.Values {
+			agg, ok := bucket.Values[key]
+			if !ok {
+				agg = &aggregate{}
+				bucket.Values[key] = agg
+			}
+			agg.add(value)
+		}
+
+		cutoff := timestamp.Add(-tier.retention)
+		drop := 0
+		for drop < len(tier.buckets) && tier.buckets[drop].Start.Before(cutoff) {
+			drop++
+		}
+		if drop > 0 {
+			tier.buckets = append([]rollupBucket{}, tier.buckets[drop:]...)
+		}
+	}
+}
+
+// points returns the values of one series between from and to (inclusive)
+// at automatically chosen resolution, averaging rollups.
+func (h *historyStore) points(key string, from, to time.Time) []historyPoint {
+	points, _ := h.pointsAt(key, from, to, "auto", "avg")
+	return points
+}
+
+// pointsAt returns one series at the given resolution ("raw", a rollup
+// such as "5m", or "auto") using the avg, min or max of each rollup
+// bucket. Auto uses raw samples when they cover from, otherwise the finest
+// rollup that does, otherwise the rollup reaching back furthest. The
+// resolution actually used is returned.
+func (h *historyStore) pointsAt(key string, from, to time.Time, resolution, agg string) ([]historyPoint, string) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	if resolution == "auto" || resolution == "" {
+		resolution = h.autoResolution(from)
+	}
+
+	var points []historyPoint
+	if resolution == "raw" {
+		for _, sample := range h.samples {
+			if sample.Time.Before(from) || sample.Time.After(to) {
+				continue
+			}
+			if value, ok := sample.Values[key]; ok {
+				points = append(points, historyPoint{Time: sample.Time, Value: value})
+			}
+		}
+		return points, resolution
+	}
+
+	for _, tier := range h.tiers {
+		if tier.name != resolution {
+			continue
+		}
+		for _, bucket := range tier.buckets {
+			if bucket.Start.Before(from.Truncate(tier.step)) || bucket.Start.After(to) {
+				continue
+			}
+			if a, ok := bucket.Values[key]; ok {
+				points = append(points, historyPoint{Time: bucket.Start, Value: a.value(agg)})
+			}
+		}
+	}
+	return points, resolution
+}
+
+// autoResolution picks raw samples when they reach back to from, else the
+// finest rollup that does, else whatever reaches back furthest. A rollup
+// only counts when it holds whole buckets older than the finer data, so a
+// freshly started agent keeps using raw samples. Callers hold h.mu.
+func (h *historyStore) autoResolution(from time.Time) string {
+	if len(h.samples) == 0 || !h.samples[0].Time.After(from) {
+		return "raw"
+	}
+	best, oldest := "raw", h.samples[0].Time
+	for _, tier := range h.tiers {
+		if len(tier.buckets) == 0 {
+			continue
+		}
+		start := tier.buckets[0].Start
+		if start.Add(tier.step).After(oldest) {
+			continue
+		}
+		if !start.After(from) {
+			return tier.name
+		}
+		best, oldest = tier.name, start
+	}
+	return best
+}
+
+// parseResolution validates the resolution and agg query parameters.
+func parseResolution(r *http.Request) (string, string, error) {
+	resolution := r.URL.Query().Get("resolution")
+	if _, ok := rollupSteps[resolution]; !ok && resolution != "" && resolution != "auto" && resolution != "raw" {
+		return "", "", fmt.Errorf("resolution must be auto, raw, 1m, 5m or 1h")
+	}
+	agg := r.URL.Query().Get("agg")
+	switch agg {
+	case "":
+		agg = "avg"
+	case "avg", "min", "max":
+	default:
+		return "", "", fmt.Errorf("agg must be avg, min or max")
+	}
+	return resolution, agg, nil
+}
+
+// Metric names of the temperature section's hardware sensors by type
+var hardwareSensorMetrics = map[string]string{
+	"temperature": "sensor_temperature_celsius",
+	"fan":         "sensor_fan_rpm",
+	"voltage":     "sensor_voltage_volts",
+	"power":       "sensor_power_watts",
+}
+
+// flattenMetrics converts a snapshot into individual labelled values.
+func flattenMetrics(m *SystemMetrics) []metricSample {
+	samples := []metricSample{
+		{Name: "uptime_seconds", Value: float64(m.System.UptimeSeconds)},
+		{Name: "cpu_usage_percent", Value: m.CPU.UsagePercent},
+		{Name: "memory_used_mb", Value: float64(m.Memory.UsedMB)},
+		{Name: "memory_available_mb", Value: float64(m.Memory.AvailableMB)},
+		{Name: "memory_usage_percent", Value: m.Memory.UsagePercent},
+		{Name: "temperature_cpu_celsius", Value: float64(m.Temperature.CPUCelsius)},
+		{Name: "kernel_context_switches_per_sec", Value: m.Kernel.ContextSwitchesPerSec},
+		{Name: "kernel_interrupts_per_sec", Value: m.Kernel.InterruptsPerSec},
+	}
+	if m.Kernel.ForksPerSec != nil {
+		samples = append(samples, metricSample{Name: "kernel_forks_per_sec", Value: *m.Kernel.ForksPerSec})
+	}
+	if m.Uptime.Boot.Status == "ok" {
+		samples = append(samples, metricSample{Name: "boot_duration_seconds", Value: m.Uptime.Boot.TotalSeconds})
+		for phase, seconds := range m.Uptime.Boot.Phases {
+			samples = append(samples, metricSample{Name: "boot_phase_seconds", Labels: map[string]string{"phase": phase}, Value: seconds})
+		}
+	}
+	for _, a := range m.Uptime.Availability {
+		samples = append(samples, metricSample{Name: "availability_percent", Labels: map[string]string{"window": a.Window}, Value: a.Percent})
+	}
+
+	for _, d := range m.Disk {
+		if d.Status == "timeout" {
+			continue
+		}
+		labels := map[string]string{"device": d.Device}
+		readOnly := 0.0
+		if d.Status == "read_only" {
+			readOnly = 1
+		}
+		samples = append(samples,
+			metricSample{Name: "disk_total_gb", Labels: labels, Value: d.TotalGB},
+			metricSample{Name: "disk_used_gb", Labels: labels, Value: d.UsedGB},
+			metricSample{Name: "disk_used_percent", Labels: labels, Value: d.UsedPercent},
+			metricSample{Name: "disk_read_only", Labels: labels, Value: readOnly},
+		)
+	}
+	if m.MissingMounts != nil {
+		samples = append(samples, metricSample{Name: "mounts_missing", Value: float64(len(m.MissingMounts))})
+	}
+	for _, n := range m.Network {
+		labels := map[string]string{"iface": n.Iface}
+		samples = append(samples,
+			metricSample{Name: "network_rx_bytes", Labels: labels, Value: float64(n.RxBytes)},
+			metricSample{Name: "network_tx_bytes", Labels: labels, Value: float64(n.TxBytes)},
+		)
+	}
+	for _, g := range m.GPU.Devices {
+		labels := map[string]string{"model": g.Model}
+		samples = append(samples,
+			metricSample{Name: "gpu_utilization_percent", Labels: labels, Value: float64(g.UtilizationPercent)},
+			metricSample{Name: "gpu_memory_used_mb", Labels: labels, Value: float64(g.MemoryUsedMB)},
+			metricSample{Name: "gpu_temperature_celsius", Labels: labels, Value: float64(g.TemperatureCelsius)},
+		)
+	}
+	for _, s := range m.Temperature.Sensors {
+		labels := map[string]string{"hardware": s.Hardware, "sensor": s.Name}
+		if name, ok := hardwareSensorMetrics[s.Type]; ok && s.Value != 0 {
+			samples = append(samples, metricSample{Name: name, Labels: labels, Value: s.Value})
+		}
+		if s.Type == "voltage" {
+			alarm := 0.0
+			if s.Alarm {
+				alarm = 1
+			}
+			samples = append(samples, metricSample{Name: "sensor_voltage_alarm", Labels: labels, Value: alarm})
+		}
+	}
+	for _, value := range m.FileMetrics {
+		if value.Error == "" {
+			samples = append(samples, metricSample{Name: value.Name, Labels: map[string]string{"path": value.Path}, Value: value.Value})
+		}
+	}
+	for _, counter := range m.PerfCounters.Counters {
+		if counter.Error != "" {
+			continue
+		}
+		var labels map[string]string
+		if counter.Instance != "" {
+			labels = map[string]string{"instance": counter.Instance}
+		}
+		samples = append(samples, metricSample{Name: counter.Name, Labels: labels, Value: counter.Value})
+	}
+	for _, device := range m.SNMPDevices {
+		labels := map[string]string{"device": device.Name}
+		up := 0.0
+		if device.Status == "ok" {
+			up = 1
+		}
+		samples = append(samples, metricSample{Name: "snmp_up", Labels: labels, Value: up})
+		for _, iface := range device.Interfaces {
+			ifLabels := map[string]string{"device": device.Name, "iface": iface.Name}
+			ifUp := 0.0
+			if iface.Status == "up" {
+				ifUp = 1
+			}
+			samples = append(samples,
+				metricSample{Name: "snmp_if_up", Labels: ifLabels, Value: ifUp},
+				metricSample{Name: "snmp_if_rx_bytes_per_sec", Labels: ifLabels, Value: iface.RxBytesPerSec},
+				metricSample{Name: "snmp_if_tx_bytes_per_sec", Labels: ifLabels, Value: iface.TxBytesPerSec},
+				metricSample{Name: "snmp_if_in_errors", Labels: ifLabels, Value: float64(iface.InErrors)},
+				metricSample{Name: "snmp_if_out_errors", Labels: ifLabels, Value: float64(iface.OutErrors)},
+			)
+		}
+		for _, sensor := range device.Sensors {
+			if sensor.Error == "" {
+				samples = append(samples, metricSample{Name: sensor.Name, Labels: labels, Value: sensor.Value})
+			}
+		}
+	}
+	for name, result := range m.Custom {
+		up := 0.0
+		if result.Status == "ok" {
+			up = 1
+		}
+		samples = append(samples, metricSample{Name: "exec_up", Labels: map[string]string{"plugin": name}, Value: up})
+		samples = append(samples, execSamples(name, result.Data)...)
+	}
+	for _, app := range m.Checks.Apps {
+		labels := map[string]string{"name": app.Name}
+		up := 0.0
+		if app.Status == "ok" {
+			up = 1
+		}
+		samples = append(samples, metricSample{Name: "app_up", Labels: labels, Value: up})
+		if app.Port > 0 {
+			samples = append(samples, metricSample{Name: "app_connect_ms", Labels: labels, Value: app.LatencyMs})
+		}
+	}
+	for _, mount := range m.Checks.Mounts {
+		labels := map[string]string{"path": mount.Path}
+		healthy := 0.0
+		if mount.Status == "ok" {
+			healthy = 1
+		}
+		samples = append(samples,
+			metricSample{Name: "mount_healthy", Labels: labels, Value: healthy},
+			metricSample{Name: "mount_latency_ms", Labels: labels, Value: mount.LatencyMs},
+		)
+	}
+	for _, drive := range m.Temperature.Drives {
+		samples = append(samples, metricSample{Name: "drive_temperature_celsius", Labels: map[string]string{"device": drive.Device}, Value: drive.Celsius})
+	}
+	for _, pool := range m.ZFS.Pools {
+		labels := map[string]string{"pool": pool.Name}
+		online := 0.0
+		if pool.Health == "ONLINE" {
+			online = 1
+		}
+		samples = append(samples,
+			metricSample{Name: "zfs_pool_online", Labels: labels, Value: online},
+			metricSample{Name: "zfs_pool_capacity_percent", Labels: labels, Value: pool.CapacityPercent},
+			metricSample{Name: "zfs_pool_errors", Labels: labels, Value: float64(pool.ReadErrors + pool.WriteErrors + pool.ChecksumErrors + uint64(pool.DataErrors))},
+		)
+	}
+	for _, array := range m.RAID.Arrays {
+		labels := map[string]string{"array": array.Name}
+		degraded := 0.0
+		if array.Degraded {
+			degraded = 1
+		}
+		samples = append(samples,
+			metricSample{Name: "md_degraded", Labels: labels, Value: degraded},
+			metricSample{Name: "md_sync_percent", Labels: labels, Value: array.SyncPercent},
+		)
+	}
+	for _, vg := range m.RAID.VolumeGroups {
+		labels := map[string]string{"vg": vg.Name}
+		samples = append(samples,
+			metricSample{Name: "lvm_vg_free_gb", Labels: labels, Value: vg.FreeGB},
+			metricSample{Name: "lvm_vg_free_percent", Labels: labels, Value: vg.FreePercent},
+		)
+	}
+	if m.Security.Status == "ok" {
+		samples = append(samples, metricSample{Name: "cpu_vulnerabilities_unmitigated", Value: float64(m.Security.Vulnerable)})
+	}
+	if m.Security.Firewall.Name != "" {
+		enabled := 0.0
+		if m.Security.Firewall.State == "enabled" {
+			enabled = 1
+		}
+		samples = append(samples, metricSample{Name: "firewall_enabled", Value: enabled})
+	}
+	for _, u := range m.Users.Top {
+		labels := map[string]string{"user": u.User}
+		samples = append(samples,
+			metricSample{Name: "user_cpu_percent", Labels: labels, Value: u.CPUPercent},
+			metricSample{Name: "user_memory_mb", Labels: labels, Value: u.MemoryMB},
+			metricSample{Name: "user_processes", Labels: labels, Value: float64(u.Processes)},
+		)
+	}
+	for _, q := range m.Quotas.Entries {
+		labels := map[string]string{"filesystem": q.Filesystem, "type": q.Type, "name": q.Name}
+		samples = append(samples, metricSample{Name: "quota_used_percent", Labels: labels, Value: q.UsedPercent})
+	}
+	for _, d := range m.DiskIO.Devices {
+		labels := map[string]string{"device": d.Device}
+		samples = append(samples,
+			metricSample{Name: "disk_await_ms", Labels: labels, Value: d.AwaitMs},
+			metricSample{Name: "disk_util_percent", Labels: labels, Value: d.UtilPercent},
+			metricSample{Name: "disk_queue_size", Labels: labels, Value: d.QueueSize},
+		)
+	}
+	for _, l := range m.Limits.Limits {
+		samples = append(samples, metricSample{Name: "kernel_limit_percent", Labels: map[string]string{"limit": l.Name}, Value: l.Percent})
+	}
+	if _, collected := statusRank[m.Entropy.Status]; collected {
+		samples = append(samples, metricSample{Name: "entropy_available", Value: float64(m.Entropy.Available)})
+	}
+	for _, p := range m.Hugepages.Pools {
+		labels := map[string]string{"size_kb": strconv.FormatUint(p.SizeKB, 10)}
+		samples = append(samples,
+			metricSample{Name: "hugepages_total", Labels: labels, Value: float64(p.Total)},
+			metricSample{Name: "hugepages_free", Labels: labels, Value: float64(p.Free)},
+			metricSample{Name: "hugepages_reserved", Labels: labels, Value: float64(p.Reserved)},
+		)
+	}
+	if m.Hugepages.Status == "ok" {
+		samples = append(samples, metricSample{Name: "anon_hugepages_mb", Value: float64(m.Hugepages.AnonHugepagesMB)})
+	}
+	for _, n := range m.NUMA.Nodes {
+		labels := map[string]string{"node": strconv.Itoa(n.Node)}
+		samples = append(samples, metricSample{Name: "numa_memory_free_mb", Labels: labels, Value: float64(n.MemoryFreeMB)})
+		if n.MemoryTotalMB > 0 {
+			samples = append(samples, metricSample{Name: "numa_memory_used_percent", Labels: labels, Value: n.MemoryUsedPercent})
+		}
+	}
+	for _, g := range m.Cgroups.Groups {
+		labels := map[string]string{"cgroup": g.Path}
+		samples = append(samples,
+			metricSample{Name: "cgroup_cpu_percent", Labels: labels, Value: g.CPUPercent},
+			metricSample{Name: "cgroup_memory_mb", Labels: labels, Value: g.MemoryMB},
+		)
+	}
+	if m.Updates.Status == "ok" {
+		reboot := 0.0
+		if m.Updates.RebootRequired {
+			reboot = 1
+		}
+		samples = append(samples,
+			metricSample{Name: "updates_pending", Value: float64(m.Updates.Pending)},
+			metricSample{Name: "updates_security", Value: float64(m.Updates.Security)},
+			metricSample{Name: "reboot_required", Value: reboot},
+		)
+	}
+	for _, w := range m.ProcessWatch {
+		labels := map[string]string{"name": w.Name}
+		running := 0.0
+		if w.Running {
+			running = 1
+		}
+		samples = append(samples,
+			metricSample{Name: "process_running", Labels: labels, Value: running},
+			metricSample{Name: "process_count", Labels: labels, Value: float64(w.Count)},
+			metricSample{Name: "process_cpu_percent", Labels: labels, Value: w.CPUPercent},
+			metricSample{Name: "process_memory_mb", Labels: labels, Value: w.MemoryMB},
+			metricSample{Name: "process_restarts", Labels: labels, Value: float64(w.Restarts)},
+		)
+	}
+	for _, t := range m.ScheduledTasks {
+		labels := map[string]string{"name": t.Name}
+		failed := 0.0
+		if t.Status == "failed" {
+			failed = 1
+		}
+		samples = append(samples, metricSample{Name: "scheduled_task_failed", Labels: labels, Value: failed})
+		if t.LastRun != "" {
+			samples = append(samples, metricSample{Name: "scheduled_task_age_hours", Labels: labels, Value: t.AgeHours})
+		}
+	}
+	if _, collected := statusRank[m.Sockets.Status]; collected {
+		samples = append(samples,
+			metricSample{Name: "sockets_time_wait", Value: float64(m.Sockets.TimeWait)},
+			metricSample{Name: "sockets_established", Value: float64(m.Sockets.Established)},
+			metricSample{Name: "sockets_ephemeral_percent", Value: m.Sockets.EphemeralPercent},
+		)
+		if m.Sockets.ConntrackMax > 0 {
+			samples = append(samples,
+				metricSample{Name: "conntrack_count", Value: float64(m.Sockets.ConntrackCount)},
+				metricSample{Name: "conntrack_percent", Value: m.Sockets.ConntrackPercent},
+			)
+		}
+	}
+	if m.ZFS.ARC != nil {
+		samples = append(samples,
+			metricSample{Name: "zfs_arc_size_mb", Value: m.ZFS.ARC.SizeMB},
+			metricSample{Name: "zfs_arc_hit_rate_percent", Value: m.ZFS.ARC.HitRatePercent},
+		)
+	}
+	for _, vm := range m.HyperV.VMs {
+		labels := map[string]string{"vm": vm.Name}
+		samples = append(samples,
+			metricSample{Name: "hyperv_vm_cpu_usage_percent", Labels: labels, Value: vm.CPUUsagePercent},
+			metricSample{Name: "hyperv_vm_memory_assigned_mb", Labels: labels, Value: float64(vm.MemoryAssignedMB)},
+		)
+	}
+	return samples
+}
+
+// seriesKeys returns every recorded series key, sorted.
+func (h *historyStore) seriesKeys() []string {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	keys := make([]string, 0, len(h.series))
+	for k := range h.series {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// seriesInfo returns the metric name and labels of a series key.
+func (h *historyStore) seriesInfo(key string) (string, map[string]string) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	series := h.series[key]
+	return series.Name, series.Labels
+}
+
+// matchSeries resolves a query target to series keys: an exact key, a
+// metric name matching all of its label variants, or a /regex/ over keys.
+func (h *historyStore) matchSeries(target string) ([]string, error) {
+	var re *regexp.Regexp
+	if len(target) > 1 && strings.HasPrefix(target, "/") && strings.HasSuffix(target, "/") {
+		var err error
+		if re, err = regexp.Compile(target[1 : len(target)-1]); err != nil {
+			return nil, err
+		}
+	}
+
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	var keys []string
+	for key, series := range h.series {
+		if key == target || series.Name == target || (re != nil && re.MatchString(key)) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+// historyHandler returns the points of one series over the last `minutes`
+// (default 60) at the requested resolution and aggregation, or the list of
+// known series when no series is given.
+func historyHandler(w http.ResponseWriter, r *http.Request) {
+	key := r.URL.Query().Get("series")
+	if key == "" {
+		writeJSON(w, http.StatusOK, map[string]interface{}{"series": history.seriesKeys()})
+		return
+	}
+
+	minutes := 60
+	if v := r.URL.Query().Get("minutes"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			http.Error(w, "minutes must be a positive integer", http.StatusBadRequest)
+			return
+		}
+		minutes = n
+	}
+
+	resolution, agg, err := parseResolution(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	to := time.Now().UTC()
+	type point struct {
+		Time  string  `json:"time"`
+		Value float64 `json:"value"`
+	}
+	points := []point{}
+	stored, used := history.pointsAt(key, to.Add(-time.Duration(minutes)*time.Minute), to, resolution, agg)
+	for _, p := range stored {
+		points = append(points, point{Time: p.Time.Format("2006-01-02T15:04:05Z"), Value: p.Value})
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"series":     key,
+		"resolution": used,
+		"points":     points,
+	})
+}
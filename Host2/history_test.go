@@ -0,0 +1,52 @@
+package main
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestHistoryForgetsVanishedSeries(t *testing.T) {
+	start := time.Date(2025, 10, 12, 0, 0, 0, 0, time.UTC)
+	snapshot := func(at time.Time, devices ...string) *SystemMetrics {
+		m := &SystemMetrics{Timestamp: at.Format("2006-01-02T15:04:05Z")}
+		for _, device := range devices {
+			m.Disk = append(m.Disk, DiskInfo{Device: device, UsedPercent: 50, Status: "ok"})
+		}
+		return m
+	}
+	usb := seriesKey("disk_used_percent", map[string]string{"device": "/media/usb"})
+
+	tests := []struct {
+		name    string
+		at      time.Duration
+		devices []string
+		raw     bool
+		known   bool
+	}{
+		{name: "attached", at: 0, devices: []string{"/", "/media/usb"}, raw: true, known: true},
+		{name: "removed, still within retention", at: 30 * time.Minute, devices: []string{"/"}, raw: true, known: true},
+		{name: "last point left the raw window", at: 61 * time.Minute, devices: []string{"/"}, known: true},
+		{name: "last point left the rollup window", at: 24*time.Hour + time.Minute, devices: []string{"/"}, known: false},
+		{name: "attached again", at: 24*time.Hour + 2*time.Minute, devices: []string{"/", "/media/usb"}, raw: true, known: true},
+	}
+	h := newHistoryStore(time.Hour)
+	h.configure(HistoryConfig{RetentionHours: 1, Rollups: []RollupConfig{{Resolution: "5m", RetentionHours: 24}}})
+	for _, tt := range tests {
+		h.add(snapshot(start.Add(tt.at), tt.devices...))
+		if known := slices.Contains(h.seriesKeys(), usb); known != tt.known {
+			t.Errorf("%s: series known = %v, want %v", tt.name, known, tt.known)
+		}
+		if _, ok := h.lastSeen[usb]; ok != tt.known {
+			t.Errorf("%s: last seen kept = %v, want %v", tt.name, ok, tt.known)
+		}
+		points, _ := h.pointsAt(usb, start, start.Add(tt.at), "raw", "avg")
+		if raw := len(points) > 0; raw != tt.raw {
+			t.Errorf("%s: raw points kept = %v, want %v", tt.name, raw, tt.raw)
+		}
+		points, _ = h.pointsAt(usb, start, start.Add(tt.at), "5m", "avg")
+		if rolledUp := len(points) > 0; rolledUp != tt.known {
+			t.Errorf("%s: rollups kept = %v, want %v", tt.name, rolledUp, tt.known)
+		}
+	}
+}
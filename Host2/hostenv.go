@@ -0,0 +1,72 @@
+package main
+
+import (
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"time"
+)
+
+// CommandRunner runs external programs for the collectors.
+type CommandRunner interface {
+	// Output runs the program and returns its standard output.
+	Output(name string, args ...string) ([]byte, error)
+	// Run runs the program, discarding its output.
+	Run(name string, args ...string) error
+	// LookPath reports where the program is installed, as exec.LookPath.
+	LookPath(file string) (string, error)
+}
+
+// FS reads the host files the collectors parse (/proc, /sys, /etc, ...).
+// Paths are absolute host paths.
+type FS interface {
+	ReadFile(name string) ([]byte, error)
+	Open(name string) (io.ReadCloser, error)
+	Glob(pattern string) ([]string, error)
+	Stat(name string) (os.FileInfo, error)
+	// EvalSymlinks resolves the links in a path, as filepath.EvalSymlinks.
+	EvalSymlinks(name string) (string, error)
+}
+
+// Clock supplies the time collections are stamped with.
+type Clock interface {
+	Now() time.Time
+}
+
+// The collectors reach the host only through these, so tests can swap in
+// fixture outputs and files, a fixed clock and another platform's GOOS to
+// cover its parsing paths anywhere.
+var (
+	commands    CommandRunner = execRunner{}
+	hostFS      FS            = osFS{}
+	clock       Clock         = systemClock{}
+	collectorOS               = runtime.GOOS
+)
+
+type execRunner struct{}
+
+func (execRunner) Output(name string, args ...string) ([]byte, error) {
+	return exec.Command(name, args...).Output()
+}
+
+func (execRunner) Run(name string, args ...string) error {
+	return exec.Command(name, args...).Run()
+}
+
+func (execRunner) LookPath(file string) (string, error) {
+	return exec.LookPath(file)
+}
+
+type osFS struct{}
+
+func (osFS) ReadFile(name string) ([]byte, error)     { return os.ReadFile(name) }
+func (osFS) Open(name string) (io.ReadCloser, error)  { return os.Open(name) }
+func (osFS) Glob(pattern string) ([]string, error)    { return filepath.Glob(pattern) }
+func (osFS) Stat(name string) (os.FileInfo, error)    { return os.Stat(name) }
+func (osFS) EvalSymlinks(name string) (string, error) { return filepath.EvalSymlinks(name) }
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time { return time.Now() }
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+// fakeRunner answers commands from canned outputs keyed by the full command
+// line; anything else fails as if the program were not installed.
+type fakeRunner struct {
+	outputs map[string]string
+	calls   []string
+}
+
+func (r *fakeRunner) Output(name string, args ...string) ([]byte, error) {
+	line := strings.Join(append([]string{name}, args...), " ")
+	r.calls = append(r.calls, line)
+	if out, ok := r.outputs[line]; ok {
+		return []byte(out), nil
+	}
+	return nil, errors.New(name + ": executable file not found in $PATH")
+}
+
+func (r *fakeRunner) Run(name string, args ...string) error {
+	_, err := r.Output(name, args...)
+	return err
+}
+
+func (r *fakeRunner) LookPath(file string) (string, error) {
+	for line := range r.outputs {
+		if line == file || strings.HasPrefix(line, file+" ") {
+			return "/usr/bin/" + file, nil
+		}
+	}
+	return "", errors.New(file + ": executable file not found in $PATH")
+}
+
+// fakeFS serves absolute host paths from an in-memory tree.
+type fakeFS fstest.MapFS
+
+func newFakeFS(files map[string]string) fakeFS {
+	tree := fakeFS{}
+	for name, data := range files {
+		tree[strings.TrimPrefix(name, "/")] = &fstest.MapFile{Data: []byte(data)}
+	}
+	return tree
+}
+
+func (f fakeFS) ReadFile(name string) ([]byte, error) {
+	return fs.ReadFile(fstest.MapFS(f), strings.TrimPrefix(name, "/"))
+}
+
+func (f fakeFS) Open(name string) (io.ReadCloser, error) {
+	return fstest.MapFS(f).Open(strings.TrimPrefix(name, "/"))
+}
+
+func (f fakeFS) Glob(pattern string) ([]string, error) {
+	matches, err := fs.Glob(fstest.MapFS(f), strings.TrimPrefix(pattern, "/"))
+	for i := range matches {
+		matches[i] = "/" + matches[i]
+	}
+	return matches, err
+}
+
+func (f fakeFS) Stat(name string) (os.FileInfo, error) {
+	return fs.Stat(fstest.MapFS(f), strings.TrimPrefix(name, "/"))
+}
+
+// EvalSymlinks follows entries with fs.ModeSymlink, whose data is the link
+// target, absolute or relative to the link's directory.
+func (f fakeFS) EvalSymlinks(name string) (string, error) {
+	parts := strings.Split(strings.TrimPrefix(path.Clean(name), "/"), "/")
+	resolved := ""
+	for links := 0; len(parts) > 0; {
+		next := path.Join(resolved, parts[0])
+		parts = parts[1:]
+		if file, ok := f[next]; ok && file.Mode&fs.ModeSymlink != 0 {
+			if links++; links > 40 {
+				return "", errors.New(name + ": too many links")
+			}
+			target := string(file.Data)
+			if !strings.HasPrefix(target, "/") {
+				target = path.Join("/"+resolved, target)
+			}
+			parts = append(strings.Split(strings.TrimPrefix(path.Clean(target), "/"), "/"), parts...)
+			resolved = ""
+			continue
+		}
+		resolved = next
+	}
+	if _, err := f.Stat("/" + resolved); err != nil {
+		return "", err
+	}
+	return "/" + resolved, nil
+}
+
+// fakeClock is a clock tests move by hand.
+type fakeClock struct{ now time.Time }
+
+func (c *fakeClock) Now() time.Time { return c.now }
+
+// withHost swaps the collectors' host access for the fakes until the test
+// ends. A nil argument keeps the real one.
+func withHost(t *testing.T, runner CommandRunner, files FS, now Clock) {
+	t.Helper()
+	saved := []any{commands, hostFS, clock}
+	t.Cleanup(func() {
+		commands = saved[0].(CommandRunner)
+		hostFS = saved[1].(FS)
+		clock = saved[2].(Clock)
+	})
+	if runner != nil {
+		commands = runner
+	}
+	if files != nil {
+		hostFS = files
+	}
+	if now != nil {
+		clock = now
+	}
+}
+
+// withOS makes the collectors take goos's paths until the test ends.
+func withOS(t *testing.T, goos string) {
+	t.Helper()
+	saved := collectorOS
+	t.Cleanup(func() { collectorOS = saved })
+	collectorOS = goos
+}
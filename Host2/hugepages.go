@@ -0,0 +1,108 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// HugepagesInfo reports the explicit hugepage pools and the transparent
+// hugepage settings, which database hosts depend on: a pool too small for
+// the database's shared memory, or THP set to "always" where the vendor
+// asks for "never", shows up as latency rather than as an error.
+type HugepagesInfo struct {
+	Pools           []HugepagePool `json:"pools"`
+	THPEnabled      string         `json:"thp_enabled,omitempty"` // "always", "madvise" or "never"
+	THPDefrag       string         `json:"thp_defrag,omitempty"`  // e.g. "madvise" or "defer+madvise"
+	AnonHugepagesMB uint64         `json:"anon_hugepages_mb"`     // memory currently backed by transparent hugepages
+	Status          string         `json:"status"`
+}
+
+// HugepagePool is the pool of one hugepage size, counted in pages.
+type HugepagePool struct {
+	SizeKB   uint64 `json:"size_kb"`
+	Default  bool   `json:"default,omitempty"` // the size hugetlbfs and SHM_HUGETLB use unless told otherwise
+	Total    uint64 `json:"total"`
+	Free     uint64 `json:"free"`
+	Reserved uint64 `json:"reserved"` // promised to a mapping but not yet faulted in; free pages include these
+	Surplus  uint64 `json:"surplus"`  // allocated above total under nr_overcommit_hugepages
+	TotalMB  uint64 `json:"total_mb"`
+	UsedMB   uint64 `json:"used_mb"` // in use or reserved
+}
+
+const (
+	HUGEPAGES_ROOT = "/sys/kernel/mm/hugepages"
+	THP_ROOT       = "/sys/kernel/mm/transparent_hugepage"
+)
+
+// collectHugepagesInfo reads one pool per hugepage size from sysfs and the
+// default size and transparent hugepage usage from /proc/meminfo. Other
+// platforms report "unavailable".
+func collectHugepagesInfo(trace *sectionTrace) HugepagesInfo {
+	info := HugepagesInfo{Pools: []HugepagePool{}, Status: "unavailable"}
+	if collectorOS != "linux" {
+		return info
+	}
+
+	var defaultKB uint64
+	if data, err := hostFS.ReadFile("/proc/meminfo"); err == nil {
+		// "Hugepagesize:       2048 kB"
+		for _, line := range strings.Split(string(data), "\n") {
+			fields := strings.Fields(line)
+			if len(fields) < 2 {
+				continue
+			}
+			kb, _ := strconv.ParseUint(fields[1], 10, 64)
+			switch fields[0] {
+			case "Hugepagesize:":
+				defaultKB = kb
+			case "AnonHugePages:":
+				info.AnonHugepagesMB = kb / 1024
+			}
+		}
+	}
+
+	dirs, _ := hostFS.Glob(HUGEPAGES_ROOT + "/hugepages-*kB")
+	for _, dir := range dirs {
+		size, err := strconv.ParseUint(strings.TrimSuffix(strings.TrimPrefix(path.Base(dir), "hugepages-"), "kB"), 10, 64)
+		if err != nil {
+			continue
+		}
+		pool := HugepagePool{SizeKB: size, Default: size == defaultKB}
+		pool.Total, _ = readUint(dir + "/nr_hugepages")
+		pool.Free, _ = readUint(dir + "/free_hugepages")
+		pool.Reserved, _ = readUint(dir + "/resv_hugepages")
+		pool.Surplus, _ = readUint(dir + "/surplus_hugepages")
+		pool.TotalMB = pool.Total * size / 1024
+		if pool.Total > pool.Free {
+			pool.UsedMB = (pool.Total - pool.Free) * size / 1024
+		}
+		pool.UsedMB += pool.Reserved * size / 1024
+		info.Pools = append(info.Pools, pool)
+	}
+	sort.Slice(info.Pools, func(i, j int) bool { return info.Pools[i].SizeKB < info.Pools[j].SizeKB })
+
+	info.THPEnabled = selectedOption(readTrimmed(THP_ROOT + "/enabled"))
+	info.THPDefrag = selectedOption(readTrimmed(THP_ROOT + "/defrag"))
+
+	if len(info.Pools) == 0 && info.THPEnabled == "" {
+		trace.fail("sysfs", fmt.Errorf("%s not found (kernel without hugepage support)", HUGEPAGES_ROOT))
+		return info
+	}
+	trace.ok("sysfs")
+	info.Status = "ok"
+	return info
+}
+
+// selectedOption returns the bracketed choice of a sysfs setting such as
+// "always [madvise] never".
+func selectedOption(value string) string {
+	for _, option := range strings.Fields(value) {
+		if strings.HasPrefix(option, "[") && strings.HasSuffix(option, "]") {
+			return strings.Trim(option, "[]")
+		}
+	}
+	return ""
+}
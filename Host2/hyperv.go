@@ -0,0 +1,119 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"sync"
+)
+
+// HyperVInfo lists the virtual machines on a Hyper-V host.
+type HyperVInfo struct {
+	VMs    []HyperVVM `json:"vms"`
+	Status string     `json:"status"`
+}
+
+type HyperVVM struct {
+	Name             string  `json:"name"`
+	ID               string  `json:"id"`
+	State            string  `json:"state"` // "running", "off", "paused", "saved", ...
+	UptimeSeconds    uint64  `json:"uptime_seconds"`
+	MemoryAssignedMB uint64  `json:"memory_assigned_mb"`
+	CPUUsagePercent  float64 `json:"cpu_usage_percent"` // average over the VM's virtual processors
+	VirtualCPUs      int     `json:"virtual_cpus"`
+}
+
+var (
+	hyperVOnce    sync.Once
+	hyperVPresent bool
+)
+
+// Lists VMs from the Hyper-V WMI provider and joins the dynamic memory
+// and hypervisor virtual processor performance classes by VM name
+const hyperVScript = `$ErrorActionPreference = 'Stop'
+$vms = Get-CimInstance -Namespace root/virtualization/v2 -ClassName Msvm_ComputerSystem -Filter "Caption='Virtual Machine'"
+$mem = @{}
+Get-CimInstance Win32_PerfFormattedData_BalancerStats_HyperVDynamicMemoryVM -ErrorAction SilentlyContinue | ForEach-Object { $mem[$_.Name] = $_.PhysicalMemory }
+$cpu = @{}
+Get-CimInstance Win32_PerfFormattedData_HvStats_HyperVHypervisorVirtualProcessor -ErrorAction SilentlyContinue |
+  Where-Object { $_.Name -like '*:Hv VP *' } |
+  ForEach-Object { $n = $_.Name.Split(':')[0]; $cpu[$n] = @($cpu[$n]) + $_.PercentTotalRunTime }
+ConvertTo-Json -Compress -InputObject @($vms | ForEach-Object {
+  [pscustomobject]@{ Name = $_.ElementName; ID = $_.Name; State = $_.EnabledState; OnTimeMs = $_.OnTimeInMilliseconds;
+                     MemoryMB = $mem[$_.ElementName]; CPU = @($cpu[$_.ElementName] | Where-Object { $_ -ne $null }) }
+})`
+
+// collectHyperVInfo reports every VM on a Windows host. Hosts without the
+// Hyper-V role (or without rights to its namespace) report "unavailable".
+func collectHyperVInfo() HyperVInfo {
+	info := HyperVInfo{VMs: []HyperVVM{}, Status: "unavailable"}
+	if collectorOS != "windows" {
+		return info
+	}
+
+	// Skip PowerShell entirely on hosts without the management service
+	hyperVOnce.Do(func() {
+		hyperVPresent = commands.Run("sc", "query", "vmms") == nil
+	})
+	if !hyperVPresent {
+		return info
+	}
+
+	out, err := commands.Output("powershell", "-NoProfile", "-Command", hyperVScript)
+	if err != nil {
+		return info
+	}
+
+	var vms []struct {
+		Name     string    `json:"Name"`
+		ID       string    `json:"ID"`
+		State    int       `json:"State"`
+		OnTimeMs uint64    `json:"OnTimeMs"`
+		MemoryMB uint64    `json:"MemoryMB"`
+		CPU      []float64 `json:"CPU"`
+	}
+	if err := json.Unmarshal([]byte(strings.TrimSpace(string(out))), &vms); err != nil {
+		return info
+	}
+
+	for _, vm := range vms {
+		entry := HyperVVM{
+			Name:             vm.Name,
+			ID:               vm.ID,
+			State:            hyperVState(vm.State),
+			UptimeSeconds:    vm.OnTimeMs / 1000,
+			MemoryAssignedMB: vm.MemoryMB,
+			VirtualCPUs:      len(vm.CPU),
+		}
+		for _, load := range vm.CPU {
+			entry.CPUUsagePercent += load / float64(len(vm.CPU))
+		}
+		info.VMs = append(info.VMs, entry)
+	}
+	info.Status = "ok"
+	return info
+}
+
+// hyperVState maps Msvm_ComputerSystem.EnabledState to a readable state.
+func hyperVState(enabledState int) string {
+	switch enabledState {
+	case 2:
+		return "running"
+	case 3:
+		return "off"
+	case 6, 32769:
+		return "saved"
+	case 9, 32768:
+		return "paused"
+	case 10, 32770:
+		return "starting"
+	case 4, 32774:
+		return "stopping"
+	case 32773:
+		return "saving"
+	case 32776:
+		return "pausing"
+	case 32777:
+		return "resuming"
+	}
+	return "unknown"
+}
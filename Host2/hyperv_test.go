@@ -0,0 +1,55 @@
+package main
+
+import (
+	"reflect"
+	"sync"
+	"testing"
+)
+
+func TestCollectHyperVInfo(t *testing.T) {
+	tests := []struct {
+		name    string
+		goos    string
+		outputs map[string]string
+		want    HyperVInfo
+	}{
+		{
+			name: "host with VMs",
+			goos: "windows",
+			outputs: map[string]string{
+				"sc query vmms": "SERVICE_NAME: vmms\r\n        STATE              : 4  RUNNING\r\n",
+				"powershell -NoProfile -Command " + hyperVScript: `[{"Name":"web01","ID":"6A3B1E2C-0000-4C4D-9E11-AB12CD34EF56","State":2,"OnTimeMs":7265000,"MemoryMB":4096,"CPU":[30,10]},` +
+					`{"Name":"build","ID":"0F1E2D3C-0000-4B5A-8C7D-112233445566","State":3,"OnTimeMs":0,"MemoryMB":0,"CPU":[]}]` + "\r\n",
+			},
+			want: HyperVInfo{
+				VMs: []HyperVVM{
+					{Name: "web01", ID: "6A3B1E2C-0000-4C4D-9E11-AB12CD34EF56", State: "running", UptimeSeconds: 7265, MemoryAssignedMB: 4096, CPUUsagePercent: 20, VirtualCPUs: 2},
+					{Name: "build", ID: "0F1E2D3C-0000-4B5A-8C7D-112233445566", State: "off"},
+				},
+				Status: "ok",
+			},
+		},
+		{
+			name: "no Hyper-V role",
+			goos: "windows",
+			want: HyperVInfo{VMs: []HyperVVM{}, Status: "unavailable"},
+		},
+		{
+			name: "not Windows",
+			goos: "linux",
+			want: HyperVInfo{VMs: []HyperVVM{}, Status: "unavailable"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			withHost(t, &fakeRunner{outputs: tt.outputs}, nil, nil)
+			withOS(t, tt.goos)
+			// The service check runs once per process
+			hyperVOnce = sync.Once{}
+			t.Cleanup(func() { hyperVOnce = sync.Once{} })
+			if got := collectHyperVInfo(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %+v\nwant %+v", got, tt.want)
+			}
+		})
+	}
+}
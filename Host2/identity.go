@@ -0,0 +1,151 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Default identity file, next to the executable
+const IDENTITY_FILE = "agent_identity.json"
+
+// agentIdentity is persisted so the agent keeps its ID across reboots and
+// renames. The machine ID it was created on is recorded too: a cloned VM
+// that gets a fresh machine ID also gets a fresh agent ID.
+type agentIdentity struct {
+	AgentID   string `json:"agent_id"`
+	MachineID string `json:"machine_id,omitempty"`
+	CreatedAt string `json:"created_at"`
+}
+
+var identity = struct {
+	sync.Mutex
+	path string
+	id   string
+}{}
+
+func agentHostname() string {
+	if override := currentConfig().Identity.Hostname; override != "" {
+		return override
+	}
+	hostname, _ := os.Hostname()
+	return hostname
+}
+
+// newUUID returns a random RFC 4122 version 4 UUID.
+func newUUID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
+
+func identityPath() string {
+	if path := currentConfig().Identity.IDFile; path != "" {
+		return path
+	}
+	exePath, err := os.Executable()
+	if err != nil {
+		return IDENTITY_FILE
+	}
+	return filepath.Join(filepath.Dir(exePath), IDENTITY_FILE)
+}
+
+// agentID returns the stable agent ID, loading or creating the identity
+// file on first use. In read-only mode a missing ID is not persisted.
+func agentID() string {
+	path := identityPath()
+	identity.Lock()
+	defer identity.Unlock()
+	if identity.id != "" && identity.path == path {
+		return identity.id
+	}
+	identity.path = path
+	identity.id = loadIdentity(path)
+	return identity.id
+}
+
+func loadIdentity(path string) string {
+	machine := machineID()
+
+	var stored agentIdentity
+	data, err := os.ReadFile(path)
+	if err == nil {
+		if err := json.Unmarshal(data, &stored); err != nil {
+			log.Printf("[IDENTITY] Ignoring unreadable %s: %v", path, err)
+		}
+	} else if !os.IsNotExist(err) {
+		log.Printf("[IDENTITY] Failed to read %s: %v", path, err)
+	}
+	if stored.AgentID != "" && (stored.MachineID == "" || machine == "" || stored.MachineID == machine) {
+		return stored.AgentID
+	}
+	if stored.AgentID != "" {
+		log.Printf("[IDENTITY] Machine ID changed (cloned machine?), replacing agent ID %s", stored.AgentID)
+	}
+
+	created := agentIdentity{
+		AgentID:   newUUID(),
+		MachineID: machine,
+		CreatedAt: time.Now().UTC().Format("2006-01-02T15:04:05Z"),
+	}
+	if readOnlyMode {
+		log.Printf("[IDENTITY] Read-only mode, agent ID %s is not persisted", created.AgentID)
+		return created.AgentID
+	}
+	out, _ := json.MarshalIndent(created, "", "  ")
+	if err := os.WriteFile(path, append(out, '\n'), 0644); err != nil {
+		log.Printf("[IDENTITY] Failed to persist agent ID to %s: %v", path, err)
+	} else {
+		log.Printf("[IDENTITY] Created agent ID %s in %s", created.AgentID, path)
+	}
+	return created.AgentID
+}
+
+// machineID returns the ID the OS keeps per installation, or "" where
+// there is none and the identity file alone keeps the ID.
+func machineID() string {
+	switch collectorOS {
+	case "linux":
+		return linuxMachineID()
+	case "windows":
+		return windowsMachineID()
+	}
+	return ""
+}
+
+// linuxMachineID returns the systemd/D-Bus machine ID, which image tooling
+// regenerates for clones.
+func linuxMachineID() string {
+	for _, path := range []string{"/etc/machine-id", "/var/lib/dbus/machine-id"} {
+		if data, err := hostFS.ReadFile(path); err == nil {
+			if id := strings.TrimSpace(string(data)); id != "" {
+				return id
+			}
+		}
+	}
+	return ""
+}
+
+// windowsMachineID returns the MachineGuid that Windows setup (and sysprep)
+// generates per installation.
+func windowsMachineID() string {
+	out, err := commands.Output("reg", "query", `HKLM\SOFTWARE\Microsoft\Cryptography`, "/v", "MachineGuid")
+	if err != nil {
+		return ""
+	}
+	for _, line := range strings.Split(string(out), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 3 && fields[0] == "MachineGuid" {
+			return fields[2]
+		}
+	}
+	return ""
+}
@@ -0,0 +1,52 @@
+package main
+
+import "testing"
+
+func TestMachineID(t *testing.T) {
+	tests := []struct {
+		name    string
+		goos    string
+		files   map[string]string
+		outputs map[string]string
+		want    string
+	}{
+		{
+			name:  "systemd",
+			goos:  "linux",
+			files: map[string]string{"/etc/machine-id": "4c7f1a0e2b9d4e6f8a1b3c5d7e9f0a12\n"},
+			want:  "4c7f1a0e2b9d4e6f8a1b3c5d7e9f0a12",
+		},
+		{
+			name: "empty machine-id falls back to D-Bus",
+			goos: "linux",
+			files: map[string]string{
+				"/etc/machine-id":          "\n",
+				"/var/lib/dbus/machine-id": "0a1b2c3d4e5f60718293a4b5c6d7e8f9\n",
+			},
+			want: "0a1b2c3d4e5f60718293a4b5c6d7e8f9",
+		},
+		{
+			name: "registry",
+			goos: "windows",
+			outputs: map[string]string{
+				`reg query HKLM\SOFTWARE\Microsoft\Cryptography /v MachineGuid`: "\r\nHKEY_LOCAL_MACHINE\\SOFTWARE\\Microsoft\\Cryptography\r\n    MachineGuid    REG_SZ    5d2c8e1a-3f4b-4c6d-9e8f-0a1b2c3d4e5f\r\n\r\n",
+			},
+			want: "5d2c8e1a-3f4b-4c6d-9e8f-0a1b2c3d4e5f",
+		},
+		{
+			name:  "macOS keeps only the identity file",
+			goos:  "darwin",
+			files: map[string]string{"/etc/machine-id": "4c7f1a0e2b9d4e6f8a1b3c5d7e9f0a12\n"},
+			want:  "",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			withHost(t, &fakeRunner{outputs: tt.outputs}, newFakeFS(tt.files), nil)
+			withOS(t, tt.goos)
+			if got := machineID(); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+const systemdUnitTemplate = `[Unit]
+Description=Native Go Host Agent
+After=network-online.target
+Wants=network-online.target
+
+[Service]
+ExecStart=%s
+ExecReload=/bin/kill -HUP $MAINPID
+Restart=on-failure
+RestartSec=5
+
+[Install]
+WantedBy=multi-user.target
+`
+
+const launchdPlistTemplate = `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">
+<plist version="1.0">
+<dict>
+  <key>Label</key>
+  <string>%s</string>
+  <key>ProgramArguments</key>
+  <array>
+%s  </array>
+  <key>RunAtLoad</key>
+  <true/>
+  <key>KeepAlive</key>
+  <true/>
+</dict>
+</plist>
+`
+
+// installCommand registers "host-agent serve" to start at boot: a systemd
+// unit on Linux, a launchd daemon on macOS and a SYSTEM startup task on
+// Windows.
+func installCommand(args []string) error {
+	fs := newFlagSet("install")
+	name := fs.String("name", "host-agent", "service name")
+	readOnly := fs.Bool("read-only", false, "install the service in read-only mode")
+	dryRun := fs.Bool("dry-run", false, "print what would be done without changing anything")
+	fs.Parse(args)
+
+	exePath, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("failed to get executable path: %v", err)
+	}
+	if exePath, err = filepath.Abs(exePath); err != nil {
+		return err
+	}
+
+	command := []string{exePath, "serve"}
+	if configPathOverride != "" {
+		abs, err := filepath.Abs(configPathOverride)
+		if err != nil {
+			return err
+		}
+		command = append(command, "--config", abs)
+	}
+	if *readOnly {
+		command = append(command, "--read-only")
+	}
+
+	var file, content string
+	var steps [][]string
+	switch runtime.GOOS {
+	case "linux":
+		file = filepath.Join("/etc/systemd/system", *name+".service")
+		quoted := make([]string, len(command))
+		for i, arg := range command {
+			quoted[i] = quoteUnitArg(arg)
+		}
+		content = fmt.Sprintf(systemdUnitTemplate, strings.Join(quoted, " "))
+		steps = [][]string{
+			{"systemctl", "daemon-reload"},
+			{"systemctl", "enable", "--now", *name},
+		}
+	case "darwin":
+		label := "com." + *name
+		file = filepath.Join("/Library/LaunchDaemons", label+".plist")
+		var items strings.Builder
+		for _, arg := range command {
+			fmt.Fprintf(&items, "    <string>%s</string>\n", xmlEscape(arg))
+		}
+		content = fmt.Sprintf(launchdPlistTemplate, label, items.String())
+		steps = [][]string{{"launchctl", "load", "-w", file}}
+	case "windows":
+		// A startup task avoids the service control handshake a Windows
+		// service binary would need
+		quoted := make([]string, len(command))
+		for i, arg := range command {
+			quoted[i] = `"` + arg + `"`
+		}
+		steps = [][]string{
+			{"schtasks", "/Create", "/F", "/TN", *name, "/SC", "ONSTART", "/RU", "SYSTEM", "/RL", "HIGHEST", "/TR", strings.Join(quoted, " ")},
+			{"schtasks", "/Run", "/TN", *name},
+		}
+	default:
+		return fmt.Errorf("install is not supported on %s", runtime.GOOS)
+	}
+
+	if *dryRun {
+		if file != "" {
+			fmt.Printf("Would write %s:\n%s\n", file, content)
+		}
+		for _, step := range steps {
+			fmt.Printf("Would run: %s\n", strings.Join(step, " "))
+		}
+		return nil
+	}
+
+	if file != "" {
+		if err := os.WriteFile(file, []byte(content), 0644); err != nil {
+			return fmt.Errorf("failed to write %s (run as root?): %v", file, err)
+		}
+		fmt.Printf("Wrote %s\n", file)
+	}
+	for _, step := range steps {
+		out, err := exec.Command(step[0], step[1:]...).CombinedOutput()
+		if err != nil {
+			return fmt.Errorf("%s failed: %v: %s", strings.Join(step, " "), err, strings.TrimSpace(string(out)))
+		}
+	}
+	fmt.Printf("Installed and started %s\n", *name)
+	return nil
+}
+
+// quoteUnitArg quotes a systemd ExecStart argument when needed.
+func quoteUnitArg(arg string) string {
+	if !strings.ContainsAny(arg, " \t\"\\") {
+		return arg
+	}
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(arg) + `"`
+}
+
+func xmlEscape(s string) string {
+	return strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;").Replace(s)
+}
@@ -0,0 +1,254 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// InstalledPackage is one installed package or application.
+type InstalledPackage struct {
+	Name      string `json:"name"`
+	Version   string `json:"version"`
+	Arch      string `json:"arch,omitempty"`
+	Publisher string `json:"publisher,omitempty"` // Windows
+	Source    string `json:"source"`              // "dpkg", "rpm", "brew", "brew_cask" or "windows_registry"
+}
+
+// packageSource lists the packages of one package manager; ok is false
+// when it is not installed.
+type packageSource struct {
+	name string
+	os   []string
+	list func() ([]InstalledPackage, bool, error)
+}
+
+var packageSources = []packageSource{
+	{"dpkg", []string{"linux"}, dpkgPackages},
+	{"rpm", []string{"linux"}, rpmPackages},
+	{"brew", []string{"linux", "darwin"}, brewPackages},
+	{"windows_registry", []string{"windows"}, registryPackages},
+}
+
+// Latest inventory, refreshed every inventory.refresh_seconds because
+// listing every package takes seconds and rarely changes
+var inventoryState = struct {
+	sync.Mutex
+	packages  []InstalledPackage
+	sources   []string
+	errors    map[string]string
+	refreshed time.Time
+}{}
+
+// startInventory keeps the package inventory current while
+// inventory.enabled is set.
+func startInventory() {
+	for {
+		cfg := currentConfig().Inventory
+		reloaded := configReloaded()
+		if !cfg.Enabled {
+			inventoryState.Lock()
+			inventoryState.packages, inventoryState.refreshed = nil, time.Time{}
+			inventoryState.Unlock()
+			<-reloaded
+			continue
+		}
+
+		// A reload does not force a refresh unless one is due anyway
+		inventoryState.Lock()
+		wait := time.Until(inventoryState.refreshed.Add(time.Duration(cfg.RefreshSeconds) * time.Second))
+		inventoryState.Unlock()
+		if wait <= 0 {
+			refreshInventory()
+			wait = time.Duration(cfg.RefreshSeconds) * time.Second
+		}
+
+		select {
+		case <-time.After(wait):
+		case <-reloaded:
+		}
+	}
+}
+
+// refreshInventory lists the packages of every package manager present.
+func refreshInventory() {
+	start := clock.Now()
+	packages := []InstalledPackage{}
+	sources := []string{}
+	failures := map[string]string{}
+	for _, source := range packageSources {
+		if !slices.Contains(source.os, collectorOS) {
+			continue
+		}
+		list, ok, err := source.list()
+		if !ok {
+			continue
+		}
+		if err != nil {
+			failures[source.name] = describeCollectorError(err)
+			log.Printf("[INVENTORY] Listing %s packages failed: %s", source.name, failures[source.name])
+			continue
+		}
+		sources = append(sources, source.name)
+		packages = append(packages, list...)
+	}
+	sort.SliceStable(packages, func(i, j int) bool {
+		return strings.ToLower(packages[i].Name) < strings.ToLower(packages[j].Name)
+	})
+	log.Printf("[INVENTORY] %d packages from %s in %v", len(packages), strings.Join(sources, ", "), clock.Now().Sub(start).Round(time.Millisecond))
+
+	inventoryState.Lock()
+	defer inventoryState.Unlock()
+	inventoryState.packages = packages
+	inventoryState.sources = sources
+	inventoryState.errors = failures
+	inventoryState.refreshed = clock.Now().UTC()
+}
+
+// inventoryPackagesHandler serves the cached inventory, optionally
+// filtered by ?name= (substring, case-insensitive) and ?source=.
+func inventoryPackagesHandler(w http.ResponseWriter, r *http.Request) {
+	if !currentConfig().Inventory.Enabled {
+		http.Error(w, "Inventory is disabled (inventory.enabled)", http.StatusNotFound)
+		return
+	}
+	inventoryState.Lock()
+	packages, sources, failures, refreshed := inventoryState.packages, inventoryState.sources, inventoryState.errors, inventoryState.refreshed
+	inventoryState.Unlock()
+	if refreshed.IsZero() {
+		w.Header().Set("Retry-After", "30")
+		http.Error(w, "Inventory not collected yet", http.StatusServiceUnavailable)
+		return
+	}
+
+	name := strings.ToLower(r.URL.Query().Get("name"))
+	source := r.URL.Query().Get("source")
+	matched := []InstalledPackage{}
+	for _, p := range packages {
+		if (name == "" || strings.Contains(strings.ToLower(p.Name), name)) && (source == "" || p.Source == source) {
+			matched = append(matched, p)
+		}
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"count":        len(matched),
+		"packages":     matched,
+		"sources":      sources,
+		"errors":       failures,
+		"refreshed_at": refreshed.Format("2006-01-02T15:04:05Z"),
+	})
+}
+
+// dpkgPackages lists installed packages ("ii") from the dpkg database.
+func dpkgPackages() ([]InstalledPackage, bool, error) {
+	if _, err := commands.LookPath("dpkg-query"); err != nil {
+		return nil, false, nil
+	}
+	output, err := commands.Output("dpkg-query", "-W", "-f", "${db:Status-Abbrev}\t${Package}\t${Version}\t${Architecture}\n")
+	if err != nil {
+		return nil, true, err
+	}
+	var packages []InstalledPackage
+	for _, fields := range tabLines(output, 4) {
+		if strings.TrimSpace(fields[0]) == "ii" {
+			packages = append(packages, InstalledPackage{Name: fields[1], Version: fields[2], Arch: fields[3], Source: "dpkg"})
+		}
+	}
+	return packages, true, nil
+}
+
+// rpmPackages lists the rpm database, with the epoch in the version when a
+// package has one, as vulnerability feeds compare it.
+func rpmPackages() ([]InstalledPackage, bool, error) {
+	if _, err := commands.LookPath("rpm"); err != nil {
+		return nil, false, nil
+	}
+	output, err := commands.Output("rpm", "-qa", "--qf", "%{NAME}\t%|EPOCH?{%{EPOCH}:}:{}|%{VERSION}-%{RELEASE}\t%{ARCH}\n")
+	if err != nil {
+		return nil, true, err
+	}
+	var packages []InstalledPackage
+	for _, fields := range tabLines(output, 3) {
+		if fields[0] == "gpg-pubkey" {
+			continue
+		}
+		packages = append(packages, InstalledPackage{Name: fields[0], Version: fields[1], Arch: fields[2], Source: "rpm"})
+	}
+	return packages, true, nil
+}
+
+// brewPackages lists Homebrew formulae and casks, "name version..." per
+// line; the newest installed version is reported.
+func brewPackages() ([]InstalledPackage, bool, error) {
+	if _, err := commands.LookPath("brew"); err != nil {
+		return nil, false, nil
+	}
+	var packages []InstalledPackage
+	for _, kind := range []string{"--formula", "--cask"} {
+		output, err := commands.Output("brew", "list", kind, "--versions")
+		if err != nil {
+			return nil, true, err
+		}
+		source := "brew"
+		if kind == "--cask" {
+			source = "brew_cask"
+		}
+		for _, line := range strings.Split(string(output), "\n") {
+			if fields := strings.Fields(line); len(fields) >= 2 {
+				packages = append(packages, InstalledPackage{Name: fields[0], Version: fields[len(fields)-1], Source: source})
+			}
+		}
+	}
+	return packages, true, nil
+}
+
+// registryPackagesScript reads the uninstall entries Programs and Features
+// shows, machine-wide (64- and 32-bit) and for the agent's user.
+const registryPackagesScript = `$keys = 'HKLM:\Software\Microsoft\Windows\CurrentVersion\Uninstall\*',
+  'HKLM:\Software\WOW6432Node\Microsoft\Windows\CurrentVersion\Uninstall\*',
+  'HKCU:\Software\Microsoft\Windows\CurrentVersion\Uninstall\*'
+@(Get-ItemProperty $keys -ErrorAction SilentlyContinue |
+  Where-Object { $_.DisplayName -and -not $_.SystemComponent -and -not $_.ParentKeyName } |
+  Select-Object DisplayName, DisplayVersion, Publisher) | ConvertTo-Json -Compress`
+
+func registryPackages() ([]InstalledPackage, bool, error) {
+	output, err := commands.Output("powershell", "-NoProfile", "-Command", registryPackagesScript)
+	if err != nil {
+		return nil, true, err
+	}
+	var entries []struct{ DisplayName, DisplayVersion, Publisher string }
+	if err := json.Unmarshal(bytes.TrimSpace(output), &entries); err != nil {
+		return nil, true, fmt.Errorf("unexpected output: %v", err)
+	}
+	// The 32- and 64-bit views list some applications twice
+	seen := make(map[InstalledPackage]bool, len(entries))
+	var packages []InstalledPackage
+	for _, e := range entries {
+		p := InstalledPackage{Name: e.DisplayName, Version: e.DisplayVersion, Publisher: e.Publisher, Source: "windows_registry"}
+		if !seen[p] {
+			seen[p] = true
+			packages = append(packages, p)
+		}
+	}
+	return packages, true, nil
+}
+
+// tabLines splits output into lines of exactly n tab-separated fields.
+func tabLines(output []byte, n int) [][]string {
+	var lines [][]string
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	for scanner.Scan() {
+		if fields := strings.Split(scanner.Text(), "\t"); len(fields) == n {
+			lines = append(lines, fields)
+		}
+	}
+	return lines
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"bufio"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// KernelActivityInfo reports scheduler and process-creation activity as
+// per-second rates computed between consecutive samples.
+type KernelActivityInfo struct {
+	ContextSwitchesPerSec float64  `json:"context_switches_per_sec"`
+	InterruptsPerSec      float64  `json:"interrupts_per_sec"`
+	ForksPerSec           *float64 `json:"forks_per_sec,omitempty"` // Linux only
+	Status                string   `json:"status"`
+}
+
+// counterRate converts two samples of a monotonically increasing counter
+// into a per-second rate, treating counter resets as zero activity.
+func counterRate(current, previous uint64, seconds float64) float64 {
+	if seconds <= 0 || current < previous {
+		return 0
+	}
+	return float64(current-previous) / seconds
+}
+
+type kernelCounters struct {
+	ctxt      uint64
+	intr      uint64
+	processes uint64
+	sampledAt time.Time
+}
+
+var (
+	procStatMu   sync.Mutex
+	lastProcStat *kernelCounters
+)
+
+// collectKernelActivity derives rates from the cumulative ctxt, intr and
+// processes counters in /proc/stat on Linux, and asks the platform
+// elsewhere. The first call only primes the baseline.
+func collectKernelActivity() KernelActivityInfo {
+	if collectorOS != "linux" {
+		return platformKernelActivity()
+	}
+	info := KernelActivityInfo{Status: "unavailable"}
+
+	current, err := readProcStatCounters()
+	if err != nil {
+		return info
+	}
+
+	procStatMu.Lock()
+	previous := lastProcStat
+	lastProcStat = current
+	procStatMu.Unlock()
+
+	if previous == nil {
+		info.Status = "initializing"
+		return info
+	}
+
+	seconds := current.sampledAt.Sub(previous.sampledAt).Seconds()
+	info.ContextSwitchesPerSec = counterRate(current.ctxt, previous.ctxt, seconds)
+	info.InterruptsPerSec = counterRate(current.intr, previous.intr, seconds)
+	forks := counterRate(current.processes, previous.processes, seconds)
+	info.ForksPerSec = &forks
+	info.Status = "ok"
+	return info
+}
+
+func readProcStatCounters() (*kernelCounters, error) {
+	file, err := hostFS.Open("/proc/stat")
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	counters := &kernelCounters{sampledAt: clock.Now()}
+	scanner := bufio.NewScanner(file)
+	// The intr line lists every IRQ and can exceed the default buffer size
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 {
+			continue
+		}
+		value, err := strconv.ParseUint(fields[1], 10, 64)
+		if err != nil {
+			continue
+		}
+		switch fields[0] {
+		case "ctxt":
+			counters.ctxt = value
+		case "intr":
+			// First value is the total across all interrupt sources
+			counters.intr = value
+		case "processes":
+			counters.processes = value
+		}
+	}
+	return counters, scanner.Err()
+}
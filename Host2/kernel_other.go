@@ -0,0 +1,8 @@
+//go:build !windows
+
+package main
+
+// platformKernelActivity is not implemented on this platform.
+func platformKernelActivity() KernelActivityInfo {
+	return KernelActivityInfo{Status: "unavailable"}
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCollectKernelActivity(t *testing.T) {
+	stat := func(ctxt, intr, processes string) string {
+		return "cpu  100 0 50 1000 0 0 0 0 0 0\nintr " + intr + " 0 12 0\nctxt " + ctxt + "\nbtime 1760000000\nprocesses " + processes + "\n"
+	}
+	tests := []struct {
+		name   string
+		first  string
+		second string
+		want   KernelActivityInfo
+		forks  float64
+	}{
+		{
+			name:   "rates over ten seconds",
+			first:  stat("1000", "500", "100"),
+			second: stat("6000", "2500", "150"),
+			want:   KernelActivityInfo{ContextSwitchesPerSec: 500, InterruptsPerSec: 200, Status: "ok"},
+			forks:  5,
+		},
+		{
+			name:   "counters that went backwards",
+			first:  stat("6000", "2500", "150"),
+			second: stat("10", "10", "1"),
+			want:   KernelActivityInfo{Status: "ok"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			now := &fakeClock{now: time.Date(2025, 10, 12, 0, 0, 0, 0, time.UTC)}
+			withHost(t, nil, newFakeFS(map[string]string{"/proc/stat": tt.first}), now)
+			withOS(t, "linux")
+			lastProcStat = nil
+
+			if got := collectKernelActivity(); got.Status != "initializing" {
+				t.Fatalf("first sample status %q, want initializing", got.Status)
+			}
+			now.now = now.now.Add(10 * time.Second)
+			hostFS = newFakeFS(map[string]string{"/proc/stat": tt.second})
+			got := collectKernelActivity()
+			if got.ForksPerSec == nil || *got.ForksPerSec != tt.forks {
+				t.Errorf("forks_per_sec %v, want %v", got.ForksPerSec, tt.forks)
+			}
+			got.ForksPerSec = nil
+			if got != tt.want {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+
+	withHost(t, nil, newFakeFS(nil), nil)
+	withOS(t, "linux")
+	if got := collectKernelActivity(); got.Status != "unavailable" {
+		t.Errorf("without /proc/stat: status %q, want unavailable", got.Status)
+	}
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"log"
+	"sync"
+)
+
+const (
+	counterContextSwitches = `\System\Context Switches/sec`
+	counterInterrupts      = `\Processor(_Total)\Interrupts/sec`
+)
+
+var (
+	kernelMu    sync.Mutex
+	kernelQuery *pdhQuery
+)
+
+// platformKernelActivity reads the System and Processor performance
+// counters. Windows has no fork counter, so forks_per_sec is left out.
+func platformKernelActivity() KernelActivityInfo {
+	info := KernelActivityInfo{Status: "unavailable"}
+
+	kernelMu.Lock()
+	defer kernelMu.Unlock()
+
+	if kernelQuery == nil {
+		query, err := newPDHQuery([]string{counterContextSwitches, counterInterrupts})
+		if err != nil {
+			log.Printf("[KERNEL] Error opening performance counters: %v", err)
+			return info
+		}
+		kernelQuery = query
+		info.Status = "initializing"
+		return info
+	}
+
+	values, err := kernelQuery.collect()
+	if err != nil {
+		log.Printf("[KERNEL] Error collecting performance counters: %v", err)
+		return info
+	}
+
+	info.ContextSwitchesPerSec = values[counterContextSwitches]
+	info.InterruptsPerSec = values[counterInterrupts]
+	info.Status = "ok"
+	return info
+}
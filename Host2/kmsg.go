@@ -0,0 +1,186 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// How long a read of /dev/kmsg waits for a record once all are read
+const KMSG_READ_WAIT = 50 * time.Millisecond
+
+// KernelLogInfo reports kernel ring buffer events of interest logged since
+// the previous sample, plus the most recent matching message.
+type KernelLogInfo struct {
+	OOMKills          int    `json:"oom_kills"`
+	IOErrors          int    `json:"io_errors"`
+	HardwareErrors    int    `json:"hardware_errors"`
+	LastMessage       string `json:"last_message,omitempty"`
+	LastMessageType   string `json:"last_message_type,omitempty"`
+	LastMessageUptime string `json:"last_message_uptime,omitempty"`
+	Status            string `json:"status"`
+	Error             string `json:"error,omitempty"`
+}
+
+// Substrings that classify a kernel message, checked in order
+var kernelLogPatterns = []struct {
+	category string
+	markers  []string
+}{
+	{"oom", []string{"Killed process", "Out of memory:", "invoked oom-killer", "oom-kill:", "Memory cgroup out of memory"}},
+	{"io_error", []string{"I/O error", "blk_update_request", "critical medium error", "EXT4-fs error", "XFS (", "Buffer I/O error"}},
+	{"hardware", []string{"Machine check", "mce:", "[Hardware Error]", "EDAC ", "PCIe Bus Error", "temperature above threshold"}},
+}
+
+// oomKill reports whether an "oom" message is the single line the kernel
+// logs per killed process. The "invoked oom-killer" and "oom-kill:" lines
+// before it describe the same kill.
+func oomKill(message string) bool {
+	return strings.Contains(message, "Killed process")
+}
+
+// classifyKernelMessage returns the category of a kernel message, or "" if
+// it is not one of the tracked anomalies.
+func classifyKernelMessage(message string) string {
+	for _, pattern := range kernelLogPatterns {
+		for _, marker := range pattern.markers {
+			if strings.Contains(message, marker) {
+				// XFS logs plenty of routine messages; only count its errors
+				if marker == "XFS (" && !strings.Contains(message, "error") {
+					continue
+				}
+				return pattern.category
+			}
+		}
+	}
+	return ""
+}
+
+var (
+	kmsgMu      sync.Mutex
+	kmsgLastSeq int64 = -1
+)
+
+// collectKernelLogInfo reads /dev/kmsg on Linux and counts tracked
+// anomalies in records newer than the previous sample. The first call records the
+// current position so boot-time history is not reported as new. Without
+// advance the position stays, so the next sample counts the same records.
+func collectKernelLogInfo(advance bool) KernelLogInfo {
+	info := KernelLogInfo{Status: "unavailable"}
+
+	if collectorOS != "linux" {
+		return info
+	}
+	kmsg, err := hostFS.Open("/dev/kmsg")
+	if err != nil {
+		info.Error = fmt.Sprintf("cannot open /dev/kmsg: %v", err)
+		return info
+	}
+	defer kmsg.Close()
+	// A read waits for the next record once all are read, until the deadline
+	if file, ok := kmsg.(interface{ SetReadDeadline(time.Time) error }); ok {
+		file.SetReadDeadline(time.Now().Add(KMSG_READ_WAIT))
+	}
+
+	kmsgMu.Lock()
+	defer kmsgMu.Unlock()
+
+	firstRun := kmsgLastSeq < 0
+	if firstRun && !advance {
+		info.Status = "initializing"
+		return info
+	}
+	last := kmsgLastSeq
+	buf := make([]byte, 8192)
+	for {
+		n, err := kmsg.Read(buf)
+		if errors.Is(err, syscall.EPIPE) {
+			// Records were overwritten while reading; continue with the next one
+			continue
+		}
+		if n <= 0 {
+			break
+		}
+
+		// /dev/kmsg returns exactly one record per read, other readers may
+		// return several
+		for _, record := range splitKmsgRecords(string(buf[:n])) {
+			seq, uptime, message, ok := parseKmsgRecord(record)
+			if !ok || seq <= last {
+				continue
+			}
+			last = seq
+			if firstRun {
+				continue
+			}
+
+			category := classifyKernelMessage(message)
+			switch category {
+			case "oom":
+				if oomKill(message) {
+					info.OOMKills++
+				}
+			case "io_error":
+				info.IOErrors++
+			case "hardware":
+				info.HardwareErrors++
+			default:
+				continue
+			}
+			info.LastMessage = message
+			info.LastMessageType = category
+			info.LastMessageUptime = uptime.String()
+		}
+		if err != nil {
+			break
+		}
+	}
+
+	if advance {
+		kmsgLastSeq = last
+	}
+	info.Status = "ok"
+	if firstRun {
+		info.Status = "initializing"
+	}
+	return info
+}
+
+// parseKmsgRecord splits a "prio,seq,usec,flags[,...];message" record.
+func parseKmsgRecord(record string) (int64, time.Duration, string, bool) {
+	header, message, found := strings.Cut(record, ";")
+	if !found {
+		return 0, 0, "", false
+	}
+	fields := strings.Split(header, ",")
+	if len(fields) < 3 {
+		return 0, 0, "", false
+	}
+	seq, err := strconv.ParseInt(fields[1], 10, 64)
+	if err != nil {
+		return 0, 0, "", false
+	}
+	usec, _ := strconv.ParseInt(fields[2], 10, 64)
+
+	// Continuation lines (" KEY=value") follow the message after a newline
+	message, _, _ = strings.Cut(message, "\n")
+	return seq, time.Duration(usec) * time.Microsecond, message, true
+}
+
+// splitKmsgRecords splits what a read returned at the start of each
+// record; continuation lines start with a space.
+func splitKmsgRecords(data string) []string {
+	var records []string
+	for _, line := range strings.SplitAfter(data, "\n") {
+		if n := len(records); n > 0 && strings.HasPrefix(line, " ") {
+			records[n-1] += line
+		} else if line != "" {
+			records = append(records, line)
+		}
+	}
+	return records
+}
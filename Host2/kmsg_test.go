@@ -0,0 +1,78 @@
+package main
+
+import "testing"
+
+func TestClassifyKernelMessage(t *testing.T) {
+	tests := []struct {
+		message  string
+		category string
+		kill     bool
+	}{
+		{"stress invoked oom-killer: gfp_mask=0x140cca(GFP_HIGHUSER_MOVABLE|__GFP_COMP), order=0, oom_score_adj=0", "oom", false},
+		{"oom-kill:constraint=CONSTRAINT_NONE,nodemask=(null),cpuset=/,mems_allowed=0,global_oom,task_memcg=/user.slice,task=stress,pid=4242,uid=1000", "oom", false},
+		{"Out of memory: Killed process 4242 (stress) total-vm:8390660kB, anon-rss:7864320kB, file-rss:0kB, shmem-rss:0kB, UID:1000 pgtables:15412kB oom_score_adj:0", "oom", true},
+		{"Memory cgroup out of memory: Killed process 977 (java) total-vm:4123456kB, anon-rss:1048576kB, file-rss:0kB, shmem-rss:0kB, UID:0 pgtables:2300kB oom_score_adj:0", "oom", true},
+		{"Out of memory: Kill process 4242 (stress) score 901 or sacrifice child", "oom", false},
+		{"Killed process 4242 (stress) total-vm:8390660kB, anon-rss:7864320kB, file-rss:0kB", "oom", true},
+		{"blk_update_request: I/O error, dev sdb, sector 2048 op 0x0:(READ) flags 0x0 phys_seg 1 prio class 0", "io_error", false},
+		{"XFS (sdb1): Mounting V5 Filesystem", "", false},
+		{"XFS (sdb1): metadata I/O error in \"xfs_trans_read_buf_map\" at daddr 0x2 len 1 error 5", "io_error", false},
+		{"mce: [Hardware Error]: Machine check events logged", "hardware", false},
+		{"e1000e 0000:00:1f.6 eth0: NIC Link is Up 1000 Mbps Full Duplex", "", false},
+	}
+	for _, tt := range tests {
+		category := classifyKernelMessage(tt.message)
+		if category != tt.category {
+			t.Errorf("classifyKernelMessage(%q) = %q, want %q", tt.message, category, tt.category)
+		}
+		if kill := category == "oom" && oomKill(tt.message); kill != tt.kill {
+			t.Errorf("oomKill(%q) = %v, want %v", tt.message, kill, tt.kill)
+		}
+	}
+}
+
+func TestCollectKernelLogInfo(t *testing.T) {
+	withOS(t, "linux")
+	kmsgMu.Lock()
+	saved := kmsgLastSeq
+	kmsgLastSeq = -1
+	kmsgMu.Unlock()
+	t.Cleanup(func() { kmsgLastSeq = saved })
+
+	boot := "6,1,1000,-;Linux version 6.8.0\n" +
+		"3,2,2000,-;Out of memory: Killed process 12 (old) total-vm:1024kB\n"
+	withHost(t, nil, newFakeFS(map[string]string{"/dev/kmsg": boot}), nil)
+	if info := collectKernelLogInfo(true); info.Status != "initializing" || info.OOMKills != 0 {
+		t.Fatalf("first call = %+v, want initializing without counts", info)
+	}
+
+	logged := boot +
+		"3,3,5000000,-;Out of memory: Killed process 42 (stress) total-vm:8390660kB\n" +
+		"3,4,6000000,-;blk_update_request: I/O error, dev sdb, sector 2048\n" +
+		" SUBSYSTEM=block\n" +
+		" DEVICE=b8:16\n" +
+		"6,5,7000000,-;e1000e 0000:00:1f.6 eth0: NIC Link is Up\n"
+	withHost(t, nil, newFakeFS(map[string]string{"/dev/kmsg": logged}), nil)
+	want := KernelLogInfo{
+		OOMKills:          1,
+		IOErrors:          1,
+		LastMessage:       "blk_update_request: I/O error, dev sdb, sector 2048",
+		LastMessageType:   "io_error",
+		LastMessageUptime: "6s",
+		Status:            "ok",
+	}
+	if info := collectKernelLogInfo(false); info != want {
+		t.Errorf("without advancing = %+v, want %+v", info, want)
+	}
+	if info := collectKernelLogInfo(true); info != want {
+		t.Errorf("advancing = %+v, want %+v", info, want)
+	}
+	if info := collectKernelLogInfo(true); info != (KernelLogInfo{Status: "ok"}) {
+		t.Errorf("nothing new = %+v", info)
+	}
+
+	withOS(t, "windows")
+	if info := collectKernelLogInfo(true); info.Status != "unavailable" {
+		t.Errorf("on Windows status = %q, want unavailable", info.Status)
+	}
+}
@@ -0,0 +1,276 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// A reading is shared by the temperature source, the sensor list and the
+// GPU collector of one collection
+const LHM_READING_TTL = 2 * time.Second
+
+var lhmHTTPClient = &http.Client{Timeout: 5 * time.Second}
+
+// lhmScript reads the sensors from LibreHardwareMonitor's WMI namespace,
+// or from OpenHardwareMonitor's, which has the same classes.
+const lhmScript = `foreach ($ns in 'root/LibreHardwareMonitor', 'root/OpenHardwareMonitor') {
+  try {
+    $h = @(Get-CimInstance -Namespace $ns -ClassName Hardware -ErrorAction Stop | Select-Object Identifier, Name)
+    $s = @(Get-CimInstance -Namespace $ns -ClassName Sensor -ErrorAction Stop | Select-Object Identifier, Name, SensorType, Value, Parent)
+    ConvertTo-Json -Compress -Depth 3 @{ hardware = $h; sensors = $s }
+    exit 0
+  } catch {}
+}
+Write-Error 'LibreHardwareMonitor is not running (no WMI namespace)'
+exit 1`
+
+// lhmSensor is a sensor with the identifier of its hardware, e.g.
+// "/amdcpu/0", "/gpu-nvidia/0" or "/lpc/nct6798d".
+type lhmSensor struct {
+	HardwareSensor
+	parent string
+}
+
+var lhmCache = struct {
+	sync.Mutex
+	sensors []lhmSensor
+	err     error
+	until   time.Time
+}{}
+
+// lhmSensors returns LibreHardwareMonitor's current readings. A failure is
+// remembered for temperature.retry_seconds, so hosts without it do not
+// start PowerShell on every collection.
+func lhmSensors() ([]lhmSensor, error) {
+	lhmCache.Lock()
+	defer lhmCache.Unlock()
+	now := clock.Now()
+	if now.Before(lhmCache.until) {
+		if lhmCache.err != nil {
+			return nil, fmt.Errorf("%s (retried after %s)", describeCollectorError(lhmCache.err), lhmCache.until.UTC().Format("2006-01-02T15:04:05Z"))
+		}
+		return lhmCache.sensors, nil
+	}
+
+	cfg := currentConfig().Temperature
+	if cfg.LHMURL != "" {
+		lhmCache.sensors, lhmCache.err = fetchLHMData(cfg.LHMURL)
+	} else {
+		lhmCache.sensors, lhmCache.err = queryLHMWMI()
+	}
+	lhmCache.until = now.Add(LHM_READING_TTL)
+	if lhmCache.err != nil {
+		lhmCache.until = now.Add(time.Duration(cfg.RetrySeconds) * time.Second)
+	}
+	return lhmCache.sensors, lhmCache.err
+}
+
+// lhmSensorType maps LibreHardwareMonitor sensor types, or the groups
+// they are listed under in data.json, to the reported type and unit.
+func lhmSensorType(name string) (string, string) {
+	switch strings.TrimSuffix(strings.ToLower(name), "s") {
+	case "temperature":
+		return "temperature", "°C"
+	case "fan":
+		return "fan", "RPM"
+	case "voltage":
+		return "voltage", "V"
+	case "power":
+		return "power", "W"
+	}
+	return "", ""
+}
+
+func queryLHMWMI() ([]lhmSensor, error) {
+	output, err := commands.Output("powershell", "-NoProfile", "-Command", lhmScript)
+	if err != nil {
+		return nil, err
+	}
+	var data struct {
+		Hardware []struct{ Identifier, Name string }
+		Sensors  []struct {
+			Identifier, Name, SensorType, Parent string
+			Value                                float64
+		}
+	}
+	if err := json.Unmarshal(output, &data); err != nil {
+		return nil, fmt.Errorf("unexpected output: %v", err)
+	}
+	names := make(map[string]string, len(data.Hardware))
+	for _, h := range data.Hardware {
+		names[h.Identifier] = h.Name
+	}
+	var sensors []lhmSensor
+	for _, s := range data.Sensors {
+		kind, unit := lhmSensorType(s.SensorType)
+		if kind == "" {
+			continue
+		}
+		sensors = append(sensors, lhmSensor{
+			HardwareSensor: HardwareSensor{Hardware: names[s.Parent], Name: s.Name, Type: kind, Value: s.Value, Unit: unit},
+			parent:         s.Parent,
+		})
+	}
+	return sensors, nil
+}
+
+// lhmNode is an entry of the data.json tree: computer, hardware, sensor
+// group ("Temperatures", "Fans", ...) and sensor. Newer releases add the
+// sensor's identifier and type.
+type lhmNode struct {
+	Text     string
+	Value    string
+	ImageURL string
+	SensorId string
+	Type     string
+	Children []lhmNode
+}
+
+// fetchLHMData reads the JSON tree of LibreHardwareMonitor's web server
+// (Options > Remote Web Server), e.g. http://127.0.0.1:8085/data.json.
+func fetchLHMData(url string) ([]lhmSensor, error) {
+	resp, err := lhmHTTPClient.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s: unexpected status %d", url, resp.StatusCode)
+	}
+	var root lhmNode
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 16<<20)).Decode(&root); err != nil {
+		return nil, fmt.Errorf("%s: %v", url, err)
+	}
+	var sensors []lhmSensor
+	collectLHMNodes(root, nil, &sensors)
+	return sensors, nil
+}
+
+// collectLHMNodes walks the tree; ancestors holds the path to node.
+func collectLHMNodes(node lhmNode, ancestors []lhmNode, sensors *[]lhmSensor) {
+	if len(node.Children) > 0 {
+		for _, child := range node.Children {
+			collectLHMNodes(child, append(ancestors[:len(ancestors):len(ancestors)], node), sensors)
+		}
+		return
+	}
+	if len(ancestors) < 2 {
+		return
+	}
+	group, hardware := ancestors[len(ancestors)-1], ancestors[len(ancestors)-2]
+	sensorType := node.Type
+	if sensorType == "" {
+		sensorType = group.Text
+	}
+	kind, unit := lhmSensorType(sensorType)
+	fields := strings.Fields(strings.Replace(node.Value, ",", ".", 1))
+	if kind == "" || len(fields) == 0 {
+		return
+	}
+	value, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return
+	}
+
+	// The hardware identifier is the sensor's minus "/<type>/<index>";
+	// older releases only have the hardware's icon
+	parent := path.Dir(path.Dir(node.SensorId))
+	if node.SensorId == "" {
+		parent = "/" + strings.TrimSuffix(path.Base(hardware.ImageURL), ".png")
+	}
+	*sensors = append(*sensors, lhmSensor{
+		HardwareSensor: HardwareSensor{Hardware: hardware.Text, Name: node.Text, Type: kind, Value: value, Unit: unit},
+		parent:         parent,
+	})
+}
+
+// lhmKind classifies a hardware identifier as "cpu", "gpu" or "".
+func lhmKind(parent string) string {
+	switch {
+	case strings.Contains(parent, "cpu"):
+		return "cpu"
+	case strings.Contains(parent, "gpu"), strings.HasSuffix(parent, "/nvidia"), strings.HasSuffix(parent, "/ati"):
+		return "gpu"
+	}
+	return ""
+}
+
+// lhmTemperature picks the representative temperature of a CPU or GPU:
+// the first of the preferred sensor names, else the hottest.
+func lhmTemperature(sensors []lhmSensor, kind string, preferred ...string) (float64, string, bool) {
+	var hottest *lhmSensor
+	for _, name := range preferred {
+		for i := range sensors {
+			s := &sensors[i]
+			if s.Type == "temperature" && lhmKind(s.parent) == kind && s.Name == name && s.Value > 0 {
+				return s.Value, s.Hardware, true
+			}
+		}
+	}
+	for i := range sensors {
+		s := &sensors[i]
+		if s.Type == "temperature" && lhmKind(s.parent) == kind && (hottest == nil || s.Value > hottest.Value) {
+			hottest = s
+		}
+	}
+	if hottest == nil || hottest.Value <= 0 {
+		return 0, "", false
+	}
+	return hottest.Value, hottest.Hardware, true
+}
+
+// tempFromLHM is the "librehardwaremonitor" temperature source.
+func tempFromLHM() (int, error) {
+	sensors, err := lhmSensors()
+	if err != nil {
+		return 0, err
+	}
+	celsius, _, ok := lhmTemperature(sensors, "cpu", "CPU Package", "Core (Tctl/Tdie)", "Core (Tctl)", "Core Average", "CPU Core")
+	if !ok {
+		return 0, errNoReading
+	}
+	return int(celsius), nil
+}
+
+// addLHMReadings fills in the GPU temperature and the motherboard, CPU and
+// GPU sensor list when LibreHardwareMonitor is available.
+func addLHMReadings(info *TemperatureInfo) {
+	sensors, err := lhmSensors()
+	if err != nil {
+		return
+	}
+	if info.GPUCelsius == 0 {
+		if celsius, hardware, ok := lhmTemperature(sensors, "gpu", "GPU Core", "GPU Hot Spot"); ok {
+			info.GPUCelsius = int(celsius)
+			info.GPUVendor = hardware
+		}
+	}
+	for _, s := range sensors {
+		info.Sensors = append(info.Sensors, s.HardwareSensor)
+	}
+}
+
+// lhmGPUTemperature returns the core temperature LibreHardwareMonitor
+// reports for the GPU with the given name, for adapters WMI lists without
+// one.
+func lhmGPUTemperature(model string) int {
+	sensors, err := lhmSensors()
+	if err != nil {
+		return 0
+	}
+	var matching []lhmSensor
+	for _, s := range sensors {
+		if s.Hardware == model {
+			matching = append(matching, s)
+		}
+	}
+	celsius, _, _ := lhmTemperature(matching, "gpu", "GPU Core")
+	return int(celsius)
+}
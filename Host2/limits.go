@@ -0,0 +1,123 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// LimitsInfo reports how close the host is to kernel-wide limits that fail
+// allocations outright when reached, such as "Too many open files" from
+// fs.file-max or fork failing at kernel.pid_max.
+type LimitsInfo struct {
+	Limits []KernelLimit `json:"limits"`
+	Status string        `json:"status"` // of the most used limit
+}
+
+// KernelLimit is one limit with the sysctl that sets it.
+type KernelLimit struct {
+	Name    string  `json:"name"`   // e.g. "file_handles", "pids"
+	Sysctl  string  `json:"sysctl"` // e.g. "fs.file-max"
+	Used    uint64  `json:"used"`
+	Max     uint64  `json:"max"`
+	Percent float64 `json:"percent"`
+	Status  string  `json:"status"`
+}
+
+// usedPercent is the figure the limits threshold applies to.
+func (l LimitsInfo) usedPercent() float64 {
+	highest := 0.0
+	for _, limit := range l.Limits {
+		if limit.Percent > highest {
+			highest = limit.Percent
+		}
+	}
+	return highest
+}
+
+// collectLimitsInfo compares current usage from /proc with the matching
+// sysctls on Linux. Limits whose files are missing, e.g. System V IPC in a
+// kernel built without it, are left out.
+func collectLimitsInfo(trace *sectionTrace) LimitsInfo {
+	info := LimitsInfo{Limits: []KernelLimit{}, Status: "unavailable"}
+	if collectorOS != "linux" {
+		return info
+	}
+	add := func(name, sysctl string, used, max uint64) {
+		if max == 0 {
+			return
+		}
+		info.Limits = append(info.Limits, KernelLimit{
+			Name:    name,
+			Sysctl:  sysctl,
+			Used:    used,
+			Max:     max,
+			Percent: math.Round(float64(used)/float64(max)*1000) / 10,
+			Status:  "ok",
+		})
+	}
+
+	// "allocated unused max"; unused is always 0 on current kernels
+	if fields := strings.Fields(readTrimmed("/proc/sys/fs/file-nr")); len(fields) == 3 {
+		allocated, _ := strconv.ParseUint(fields[0], 10, 64)
+		unused, _ := strconv.ParseUint(fields[1], 10, 64)
+		max, _ := strconv.ParseUint(fields[2], 10, 64)
+		if unused <= allocated {
+			add("file_handles", "fs.file-max", allocated-unused, max)
+		}
+	}
+
+	// "0.62 0.49 0.39 2/73 20062": the fourth field counts every thread,
+	// and each thread takes a PID
+	if fields := strings.Fields(readTrimmed("/proc/loadavg")); len(fields) >= 4 {
+		if _, total, found := strings.Cut(fields[3], "/"); found {
+			threads, _ := strconv.ParseUint(total, 10, 64)
+			pidMax, _ := readUint("/proc/sys/kernel/pid_max")
+			threadsMax, _ := readUint("/proc/sys/kernel/threads-max")
+			add("pids", "kernel.pid_max", threads, pidMax)
+			add("threads", "kernel.threads-max", threads, threadsMax)
+		}
+	}
+
+	if aio, err := readUint("/proc/sys/fs/aio-nr"); err == nil {
+		aioMax, _ := readUint("/proc/sys/fs/aio-max-nr")
+		add("aio_requests", "fs.aio-max-nr", aio, aioMax)
+	}
+
+	// kernel.sem is "SEMMSL SEMMNS SEMOPM SEMMNI"
+	var semmni uint64
+	if fields := strings.Fields(readTrimmed("/proc/sys/kernel/sem")); len(fields) == 4 {
+		semmni, _ = strconv.ParseUint(fields[3], 10, 64)
+	}
+	shmmni, _ := readUint("/proc/sys/kernel/shmmni")
+	msgmni, _ := readUint("/proc/sys/kernel/msgmni")
+	if count, err := countSysVIPC("shm"); err == nil {
+		add("ipc_shared_memory", "kernel.shmmni", count, shmmni)
+	}
+	if count, err := countSysVIPC("sem"); err == nil {
+		add("ipc_semaphore_sets", "kernel.sem", count, semmni)
+	}
+	if count, err := countSysVIPC("msg"); err == nil {
+		add("ipc_message_queues", "kernel.msgmni", count, msgmni)
+	}
+
+	if len(info.Limits) == 0 {
+		trace.fail("procfs", fmt.Errorf("/proc/sys not readable"))
+		return info
+	}
+	trace.ok("procfs")
+	info.Status = "ok"
+	return info
+}
+
+// countSysVIPC counts the objects listed in /proc/sysvipc/<kind> after its
+// header line.
+func countSysVIPC(kind string) (uint64, error) {
+	data, err := hostFS.ReadFile("/proc/sysvipc/" + kind)
+	if err != nil {
+		return 0, err
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	return uint64(len(lines) - 1), nil
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// splitListenEntry parses "host:port", "[v6]:port", a bare host or a bare
+// interface name; a missing port defaults to PORT.
+func splitListenEntry(entry string) (string, string, error) {
+	host, port, err := net.SplitHostPort(entry)
+	if err != nil {
+		// No port given; a bare IPv6 address may still contain colons
+		host, port = strings.Trim(entry, "[]"), PORT
+	}
+	if _, err := net.LookupPort("tcp", port); err != nil {
+		return "", "", fmt.Errorf("invalid port in %q", entry)
+	}
+	return host, port, nil
+}
+
+// resolveListenAddresses turns api.listen entries into concrete addresses.
+// An interface name as host expands to every address of that interface.
+func resolveListenAddresses(entries []string) ([]string, error) {
+	var addrs []string
+	for _, entry := range entries {
+		host, port, err := splitListenEntry(entry)
+		if err != nil {
+			return nil, err
+		}
+		if host == "" || net.ParseIP(strings.SplitN(host, "%", 2)[0]) != nil {
+			addrs = append(addrs, net.JoinHostPort(host, port))
+			continue
+		}
+
+		iface, err := net.InterfaceByName(host)
+		if err != nil {
+			// Leave host names to the resolver
+			addrs = append(addrs, net.JoinHostPort(host, port))
+			continue
+		}
+		ifaceAddrs, err := iface.Addrs()
+		if err != nil || len(ifaceAddrs) == 0 {
+			return nil, fmt.Errorf("interface %s has no addresses", host)
+		}
+		for _, a := range ifaceAddrs {
+			ipNet, ok := a.(*net.IPNet)
+			if !ok {
+				continue
+			}
+			ip := ipNet.IP.String()
+			if ipNet.IP.To4() == nil && ipNet.IP.IsLinkLocalUnicast() {
+				ip += "%" + iface.Name
+			}
+			addrs = append(addrs, net.JoinHostPort(ip, port))
+		}
+	}
+	return addrs, nil
+}
+
+// bindListeners binds every configured address before anything is served,
+// so a bad address fails startup instead of leaving the agent half
+// reachable.
+func bindListeners() ([]net.Listener, error) {
+	addrs, err := resolveListenAddresses(currentConfig().API.Listen)
+	if err != nil {
+		return nil, err
+	}
+
+	var listeners []net.Listener
+	for _, addr := range addrs {
+		listener, err := net.Listen("tcp", addr)
+		if err != nil {
+			for _, l := range listeners {
+				l.Close()
+			}
+			return nil, fmt.Errorf("cannot listen on %s: %v", addr, err)
+		}
+		log.Printf("[HTTP] Listening on %s", listener.Addr())
+		listeners = append(listeners, listener)
+	}
+	return listeners, nil
+}
+
+// listenerURL is the base URL a local client reaches a listener at; the
+// wildcard addresses are shown as localhost.
+func listenerURL(listener net.Listener) string {
+	host, port, err := net.SplitHostPort(listener.Addr().String())
+	if err != nil {
+		return "http://" + listener.Addr().String()
+	}
+	if ip := net.ParseIP(host); ip != nil && ip.IsUnspecified() {
+		host = "localhost"
+	}
+	return "http://" + net.JoinHostPort(host, port)
+}
+
+// serveListeners serves the API on every bound listener until one fails.
+func serveListeners(listeners []net.Listener, handler http.Handler) error {
+	errs := make(chan error, len(listeners))
+	for _, listener := range listeners {
+		go func(l net.Listener) {
+			errs <- http.Serve(l, handler)
+		}(listener)
+	}
+	return <-errs
+}
@@ -0,0 +1,263 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"reflect"
+	"regexp"
+	"sync"
+	"time"
+)
+
+// Upper bound on bytes read from a single file per interval, so a burst of
+// log output cannot stall the watcher
+const LOG_WATCH_MAX_READ = 16 * 1024 * 1024
+
+type LogWatchInfo struct {
+	Name      string            `json:"name"`
+	Path      string            `json:"path"`
+	LinesRead int               `json:"lines_read"`
+	Patterns  []LogPatternCount `json:"patterns"`
+	LastRun   string            `json:"last_run"`
+	Status    string            `json:"status"`
+	Error     string            `json:"error,omitempty"`
+}
+
+// LogPatternCount reports matches during the last interval and since start.
+type LogPatternCount struct {
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+	Total uint64 `json:"total"`
+}
+
+// logTail follows a single file across appends, truncation and rotation.
+type logTail struct {
+	cfg      LogWatchConfig
+	patterns []*regexp.Regexp
+	totals   []uint64
+	file     *os.File
+	info     os.FileInfo
+	offset   int64
+	partial  []byte
+}
+
+var (
+	logWatchMu     sync.RWMutex
+	latestLogWatch = []LogWatchInfo{}
+)
+
+func latestLogWatchResults() []LogWatchInfo {
+	logWatchMu.RLock()
+	defer logWatchMu.RUnlock()
+	return append([]LogWatchInfo{}, latestLogWatch...)
+}
+
+func newLogTail(cfg LogWatchConfig) *logTail {
+	tail := &logTail{cfg: cfg, totals: make([]uint64, len(cfg.Patterns))}
+	for _, pattern := range cfg.Patterns {
+		// Patterns are validated when the config is loaded
+		tail.patterns = append(tail.patterns, regexp.MustCompile(pattern.Regex))
+	}
+	return tail
+}
+
+// open (re)opens the file. On first open it starts at the end so existing
+// history is not counted; after rotation the new file is read from the start.
+func (t *logTail) open(fromStart bool) error {
+	file, err := os.Open(t.cfg.Path)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	if t.file != nil {
+		t.file.Close()
+	}
+	t.file, t.info, t.partial = file, info, nil
+	t.offset = 0
+	if !fromStart {
+		t.offset = info.Size()
+	}
+	return nil
+}
+
+// poll reads lines appended since the previous poll and counts matches.
+func (t *logTail) poll() LogWatchInfo {
+	result := LogWatchInfo{
+		Name:     t.cfg.Name,
+		Path:     t.cfg.Path,
+		Patterns: make([]LogPatternCount, len(t.cfg.Patterns)),
+		LastRun:  time.Now().UTC().Format("2006-01-02T15:04:05Z"),
+		Status:   "ok",
+	}
+	for i, pattern := range t.cfg.Patterns {
+		result.Patterns[i] = LogPatternCount{Name: pattern.Name, Total: t.totals[i]}
+	}
+
+	if err := t.checkFile(); err != nil {
+		result.Status = "error"
+		result.Error = err.Error()
+		return result
+	}
+
+	if _, err := t.file.Seek(t.offset, io.SeekStart); err != nil {
+		result.Status = "error"
+		result.Error = err.Error()
+		return result
+	}
+	chunk, err := io.ReadAll(io.LimitReader(t.file, LOG_WATCH_MAX_READ))
+	if err != nil {
+		result.Status = "error"
+		result.Error = err.Error()
+		return result
+	}
+	t.offset += int64(len(chunk))
+
+	data := append(t.partial, chunk...)
+	lastNewline := bytes.LastIndexByte(data, '\n')
+	if lastNewline < 0 {
+		t.partial = data
+		return result
+	}
+	t.partial = append([]byte{}, data[lastNewline+1:]...)
+
+	for _, line := range bytes.Split(data[:lastNewline], []byte{'\n'}) {
+		result.LinesRead++
+		for i, re := range t.patterns {
+			if re.Match(line) {
+				result.Patterns[i].Count++
+			}
+		}
+	}
+	for i := range result.Patterns {
+		t.totals[i] += uint64(result.Patterns[i].Count)
+		result.Patterns[i].Total = t.totals[i]
+	}
+	return result
+}
+
+// checkFile detects rotation (a different file now lives at the path) and
+// truncation (the file shrank below our offset).
+func (t *logTail) checkFile() error {
+	if t.file == nil {
+		return t.open(false)
+	}
+
+	current, err := os.Stat(t.cfg.Path)
+	if err != nil {
+		return fmt.Errorf("file unavailable: %v", err)
+	}
+	if !os.SameFile(current, t.info) {
+		log.Printf("[LOGWATCH] %s was rotated, reopening", t.cfg.Path)
+		return t.open(true)
+	}
+	if current.Size() < t.offset {
+		log.Printf("[LOGWATCH] %s was truncated, reading from start", t.cfg.Path)
+		t.offset, t.partial = 0, nil
+	}
+	return nil
+}
+
+// evaluateLogAlerts raises an alert for every pattern whose per-interval
+// count reached its configured threshold.
+func evaluateLogAlerts(cfg LogWatchConfig, result LogWatchInfo) {
+	for i, pattern := range cfg.Patterns {
+		if pattern.AlertThreshold <= 0 {
+			continue
+		}
+		id := fmt.Sprintf("log_pattern:%s:%s", cfg.Name, pattern.Name)
+		count := result.Patterns[i].Count
+		if count >= pattern.AlertThreshold {
+			raiseAlert(Alert{
+				ID:       id,
+				Rule:     "log_pattern",
+				Severity: pattern.Severity,
+				Message:  fmt.Sprintf("%d lines matching %q in %s during the last interval", count, pattern.Name, cfg.Path),
+				Value:    float64(count),
+			})
+		} else {
+			resolveAlert(id)
+		}
+	}
+}
+
+// startLogWatchers polls the configured files until the process exits.
+// On config reload, tails for files whose settings did not change keep
+// their position so no lines are counted twice or missed.
+func startLogWatchers() {
+	var tails []*logTail
+	for {
+		cfg := currentConfig().LogWatch
+		reloaded := configReloaded()
+		tails = reconcileLogTails(tails, cfg.Files)
+
+		if len(tails) == 0 {
+			logWatchMu.Lock()
+			latestLogWatch = []LogWatchInfo{}
+			logWatchMu.Unlock()
+			<-reloaded
+			continue
+		}
+
+		interval := time.Duration(cfg.IntervalSeconds) * time.Second
+		log.Printf("[LOGWATCH] Watching %d log files (interval: %v)", len(tails), interval)
+
+		for running := true; running; {
+			select {
+			case <-time.After(interval):
+			case <-reloaded:
+				running = false
+				continue
+			}
+
+			results := make([]LogWatchInfo, len(tails))
+			for i, tail := range tails {
+				results[i] = tail.poll()
+				evaluateLogAlerts(tail.cfg, results[i])
+			}
+
+			logWatchMu.Lock()
+			latestLogWatch = results
+			logWatchMu.Unlock()
+		}
+	}
+}
+
+// reconcileLogTails returns tails for the configured files, reusing existing
+// tails whose configuration is unchanged and closing the rest.
+func reconcileLogTails(existing []*logTail, files []LogWatchConfig) []*logTail {
+	tails := make([]*logTail, 0, len(files))
+	reused := make(map[*logTail]bool)
+	for _, fileCfg := range files {
+		var tail *logTail
+		for _, t := range existing {
+			if !reused[t] && reflect.DeepEqual(t.cfg, fileCfg) {
+				tail = t
+				reused[t] = true
+				break
+			}
+		}
+		if tail == nil {
+			tail = newLogTail(fileCfg)
+			// Establish the starting offset so the first interval only sees new lines
+			if err := tail.open(false); err != nil {
+				log.Printf("[LOGWATCH] Error opening %s: %v", fileCfg.Path, err)
+			}
+		}
+		tails = append(tails, tail)
+	}
+
+	for _, t := range existing {
+		if !reused[t] && t.file != nil {
+			t.file.Close()
+		}
+	}
+	return tails
+}
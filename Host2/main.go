@@ -7,10 +7,8 @@ import (
 	"log"
 	"net/http"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"runtime"
-	"strconv"
 	"strings"
 	"time"
 
@@ -29,23 +27,62 @@ const (
 
 // SystemMetrics matches the existing JSON schema
 type SystemMetrics struct {
-	Timestamp   string          `json:"timestamp"`
-	Platform    string          `json:"platform"`
-	System      SystemInfo      `json:"system"`
-	CPU         CPUInfo         `json:"cpu"`
-	Memory      MemoryInfo      `json:"memory"`
-	Disk        []DiskInfo      `json:"disk"`
-	Network     []NetworkInfo   `json:"network"`
-	Temperature TemperatureInfo `json:"temperature"`
-	GPU         GPUInfo         `json:"gpu"`
-	Source      string          `json:"source"`
+	Timestamp      string                     `json:"timestamp"`
+	Platform       string                     `json:"platform"`
+	Health         string                     `json:"health"` // worst of the section statuses
+	Labels         map[string]string          `json:"labels"` // static labels from config
+	System         SystemInfo                 `json:"system"`
+	Uptime         UptimeInfo                 `json:"uptime"` // availability from recorded reboots
+	CPU            CPUInfo                    `json:"cpu"`
+	Memory         MemoryInfo                 `json:"memory"`
+	Disk           []DiskInfo                 `json:"disk"`
+	MissingMounts  []MissingMount             `json:"missing_mounts"` // in /etc/fstab but not mounted
+	DiskIO         DiskIOInfo                 `json:"disk_io"`
+	Network        []NetworkInfo              `json:"network"`
+	Connectivity   *ConnectivityInfo          `json:"connectivity,omitempty"` // when connectivity.enabled
+	Temperature    TemperatureInfo            `json:"temperature"`
+	GPU            GPUInfo                    `json:"gpu"`
+	Kernel         KernelActivityInfo         `json:"kernel"`
+	Checks         ChecksInfo                 `json:"checks"`
+	LogWatch       []LogWatchInfo             `json:"log_watch"`
+	EventLog       EventLogInfo               `json:"event_log"`
+	KernelLog      KernelLogInfo              `json:"kernel_log"`
+	HyperV         HyperVInfo                 `json:"hyperv"`
+	ZFS            ZFSInfo                    `json:"zfs"`
+	RAID           RAIDInfo                   `json:"raid"`
+	Sockets        SocketsInfo                `json:"sockets"`
+	Security       SecurityInfo               `json:"security"`
+	Updates        UpdatesInfo                `json:"updates"`
+	Users          UsersInfo                  `json:"users"`
+	Cgroups        CgroupsInfo                `json:"cgroups"`
+	NUMA           NUMAInfo                   `json:"numa"`
+	Hugepages      HugepagesInfo              `json:"hugepages"`
+	Entropy        EntropyInfo                `json:"entropy"`
+	Limits         LimitsInfo                 `json:"limits"`
+	Quotas         QuotasInfo                 `json:"quotas"`
+	DirWatch       []DirWatchInfo             `json:"dir_watch"`
+	ProcessWatch   []WatchedProcess           `json:"process_watch"`
+	ScheduledTasks []ScheduledTaskInfo        `json:"scheduled_tasks"`
+	Custom         map[string]ExecResult      `json:"custom"` // exec plugin output by plugin name
+	PerfCounters   PerfCountersInfo           `json:"perf_counters"`
+	FileMetrics    []FileMetricValue          `json:"file_metrics"`
+	SNMPDevices    []SNMPDeviceInfo           `json:"snmp_devices"` // last poll of each snmp_devices entry
+	Alerts         []Alert                    `json:"alerts"`
+	Degraded       []CapabilityInfo           `json:"degraded_collectors"`
+	CollectedAt    map[string]string          `json:"collected_at"` // per section, see collector_intervals
+	Collectors     map[string]CollectorStatus `json:"collectors"`   // per section: method, error, last success
+	Source         string                     `json:"source"`
 }
 
 type SystemInfo struct {
-	OS            string `json:"os"`
-	Hostname      string `json:"hostname"`
-	UptimeSeconds uint64 `json:"uptime_seconds"`
-	Kernel        string `json:"kernel"`
+	OS            string     `json:"os"`
+	Hostname      string     `json:"hostname"`
+	AgentID       string     `json:"agent_id"` // stable across renames, see identity
+	UptimeSeconds uint64     `json:"uptime_seconds"`
+	Kernel        string     `json:"kernel"`
+	Cloud         *CloudInfo `json:"cloud,omitempty"` // when cloud.enabled
+
+	Virtualization VirtualizationInfo `json:"virtualization"`
 }
 
 type CPUInfo struct {
@@ -74,6 +111,12 @@ type DiskInfo struct {
 	TotalGB     float64 `json:"total_gb"`
 	UsedGB      float64 `json:"used_gb"`
 	UsedPercent float64 `json:"used_percent"`
+	ReadOnly    bool    `json:"read_only"`
+	// Growth estimate from the history store; DaysUntilFull is null while
+	// there is not enough history or usage is not growing
+	GrowthGBPerDay float64  `json:"growth_gb_per_day"`
+	DaysUntilFull  *float64 `json:"days_until_full"`
+	Status         string   `json:"status"`
 }
 
 type NetworkInfo struct {
@@ -87,7 +130,18 @@ type TemperatureInfo struct {
 	CPUVendor  string `json:"cpu_vendor"`
 	GPUCelsius int    `json:"gpu_celsius"`
 	GPUVendor  string `json:"gpu_vendor"`
-	Status     string `json:"status"`
+	Source     string `json:"source,omitempty"` // which temperature source produced the CPU reading
+	Status     string `json:"status"`           // of the CPU reading
+
+	// With temperature.fahrenheit
+	CPUFahrenheit *float64 `json:"cpu_fahrenheit,omitempty"`
+	GPUFahrenheit *float64 `json:"gpu_fahrenheit,omitempty"`
+
+	Drives []DriveTemperature `json:"drives"`
+
+	// Motherboard, CPU and GPU temperatures, fans, voltages and power from
+	// LibreHardwareMonitor, and voltage and power rails from hwmon and SMC
+	Sensors []HardwareSensor `json:"sensors,omitempty"`
 }
 
 type GPUInfo struct {
@@ -104,446 +158,439 @@ type GPUDevice struct {
 	MemoryTotalMB      int    `json:"memory_total_mb"`
 	TemperatureCelsius int    `json:"temperature_celsius"`
 	Status             string `json:"status"`
+
+	TemperatureFahrenheit *float64 `json:"temperature_fahrenheit,omitempty"` // with temperature.fahrenheit
 }
 
-func collectMetrics() (*SystemMetrics, error) {
+// collectMetrics takes one snapshot. Periodic samplers pass scheduled; other
+// callers (HTTP polls, one-shot commands) see the events since the last
+// scheduled sample without consuming them, and leave the state files alone.
+func collectMetrics(scheduled bool) (*SystemMetrics, error) {
+	plan := planSections(scheduled)
+	if simulateMode {
+		return simulatedMetrics(plan), nil
+	}
+	if replay != nil {
+		return replay.next(plan), nil
+	}
 	metrics := &SystemMetrics{
-		Timestamp: time.Now().UTC().Format("2006-01-02T15:04:05Z"),
-		Platform:  runtime.GOOS,
+		Timestamp: plan.now.Format("2006-01-02T15:04:05Z"),
+		Platform:  collectorOS,
 		Source:    "native-go-agent",
+		Labels:    currentConfig().Labels,
 	}
+	prev := plan.prev
 
 	// System Info
-	hostInfo, err := host.Info()
-	if err != nil {
-		log.Printf("Error getting host info: %v", err)
-	} else {
-		metrics.System = SystemInfo{
-			OS:            hostInfo.OS,
-			Hostname:      hostInfo.Hostname,
-			UptimeSeconds: hostInfo.Uptime,
-			Kernel:        hostInfo.KernelVersion,
+	if plan.due("system") {
+		hostInfo, err := host.Info()
+		if err != nil {
+			log.Printf("Error getting host info: %v", err)
+			plan.trace("system").fail("gopsutil", err)
+		} else {
+			plan.trace("system").ok("gopsutil")
+			metrics.System = SystemInfo{
+				OS:            hostInfo.OS,
+				Hostname:      hostInfo.Hostname,
+				UptimeSeconds: hostInfo.Uptime,
+				Kernel:        hostInfo.KernelVersion,
+			}
 		}
+	} else {
+		metrics.System = prev.System
 	}
+	if override := currentConfig().Identity.Hostname; override != "" {
+		metrics.System.Hostname = override
+	}
+	metrics.System.AgentID = agentID()
+	metrics.System.Cloud = cloudInfo()
+	metrics.System.Virtualization = virtualization()
+	metrics.Uptime = collectUptime(plan.now, plan.scheduled)
 
 	// CPU Info
-	cpuPercent, err := cpu.Percent(time.Second, false)
-	if err != nil {
-		log.Printf("Error getting CPU usage: %v", err)
-	}
+	if plan.due("cpu") {
+		cpuPercent, err := cpu.Percent(time.Second, false)
+		if err != nil {
+			log.Printf("Error getting CPU usage: %v", err)
+			plan.trace("cpu").fail("gopsutil", err)
+		} else {
+			plan.trace("cpu").ok("gopsutil")
+		}
 
-	cpuCount, _ := cpu.Counts(true)
-	cpuInfoList, _ := cpu.Info()
+		cpuCount, _ := cpu.Counts(true)
+		cpuInfoList, _ := cpu.Info()
 
-	cpuUsage := 0.0
-	if len(cpuPercent) > 0 {
-		cpuUsage = cpuPercent[0]
-	}
+		cpuUsage := 0.0
+		if len(cpuPercent) > 0 {
+			cpuUsage = cpuPercent[0]
+		}
 
-	vendor := ""
-	model := ""
-	if len(cpuInfoList) > 0 {
-		vendor = cpuInfoList[0].VendorID
-		model = cpuInfoList[0].ModelName
-	}
+		vendor := ""
+		model := ""
+		if len(cpuInfoList) > 0 {
+			vendor = cpuInfoList[0].VendorID
+			model = cpuInfoList[0].ModelName
+		}
 
-	metrics.CPU = CPUInfo{
-		UsagePercent:      cpuUsage,
-		LogicalProcessors: cpuCount,
-		Vendor:            vendor,
-		Model:             model,
-		Status:            "ok",
+		metrics.CPU = CPUInfo{
+			UsagePercent:      cpuUsage,
+			LogicalProcessors: cpuCount,
+			Vendor:            vendor,
+			Model:             model,
+			Status:            "ok",
+		}
+	} else {
+		metrics.CPU = prev.CPU
+		resetStatus(&metrics.CPU.Status)
 	}
 
 	// Memory Info
-	memInfo, err := mem.VirtualMemory()
-	if err != nil {
-		log.Printf("Error getting memory info: %v", err)
-	} else {
-		metrics.Memory = MemoryInfo{
-			TotalMB:      memInfo.Total / 1024 / 1024,
-			UsedMB:       memInfo.Used / 1024 / 1024,
-			FreeMB:       memInfo.Free / 1024 / 1024,
-			AvailableMB:  memInfo.Available / 1024 / 1024,
-			UsagePercent: memInfo.UsedPercent,
-			Status:       "ok",
+	if plan.due("memory") {
+		memInfo, err := mem.VirtualMemory()
+		if err != nil {
+			log.Printf("Error getting memory info: %v", err)
+			plan.trace("memory").fail("gopsutil", err)
+		} else {
+			plan.trace("memory").ok("gopsutil")
+			metrics.Memory = MemoryInfo{
+				TotalMB:      memInfo.Total / 1024 / 1024,
+				UsedMB:       memInfo.Used / 1024 / 1024,
+				FreeMB:       memInfo.Free / 1024 / 1024,
+				AvailableMB:  memInfo.Available / 1024 / 1024,
+				UsagePercent: memInfo.UsedPercent,
+				Status:       "ok",
+			}
 		}
+	} else {
+		metrics.Memory = prev.Memory
+		resetStatus(&metrics.Memory.Status)
 	}
 
 	// Disk Info
-	partitions, err := disk.Partitions(false)
-	if err != nil {
-		log.Printf("Error getting disk partitions: %v", err)
-	} else {
-		for _, partition := range partitions {
-			usage, err := disk.Usage(partition.Mountpoint)
-			if err != nil {
-				continue
+	if plan.due("disk") {
+		mounts := readMountTable()
+		metrics.MissingMounts = mounts.missing()
+		partitions, err := disk.Partitions(false)
+		if err != nil {
+			log.Printf("Error getting disk partitions: %v", err)
+			plan.trace("disk").fail("gopsutil", err)
+		} else {
+			plan.trace("disk").ok("gopsutil")
+			timeout := time.Duration(currentConfig().DiskTimeoutMs) * time.Millisecond
+			for _, partition := range partitions {
+				// statfs on a dead network mount can block forever
+				value, _, err := boundedProbe("usage:"+partition.Mountpoint, timeout, func() (interface{}, error) {
+					return disk.Usage(partition.Mountpoint)
+				})
+				if err == errProbeTimeout {
+					log.Printf("[DISK] Usage of %s timed out after %v", partition.Mountpoint, timeout)
+					metrics.Disk = append(metrics.Disk, DiskInfo{
+						Device:     partition.Mountpoint,
+						Filesystem: partition.Fstype,
+						Status:     "timeout",
+					})
+					continue
+				}
+				if err != nil {
+					continue
+				}
+				usage := value.(*disk.UsageStat)
+
+				info := DiskInfo{
+					Device:      partition.Mountpoint,
+					Filesystem:  partition.Fstype,
+					TotalGB:     float64(usage.Total) / 1024 / 1024 / 1024,
+					UsedGB:      float64(usage.Used) / 1024 / 1024 / 1024,
+					UsedPercent: usage.UsedPercent,
+				}
+				// Read-only where it should be writable: a failing disk, usually
+				readOnly, unexpected := mounts.readOnly(partition)
+				info.ReadOnly = readOnly
+				if unexpected {
+					info.Status = "read_only"
+				}
+				metrics.Disk = append(metrics.Disk, info)
 			}
 
-			metrics.Disk = append(metrics.Disk, DiskInfo{
-				Device:      partition.Mountpoint,
-				Filesystem:  partition.Fstype,
-				TotalGB:     float64(usage.Total) / 1024 / 1024 / 1024,
-				UsedGB:      float64(usage.Used) / 1024 / 1024 / 1024,
-				UsedPercent: usage.UsedPercent,
-			})
+			// Disk-full estimates from historical usage
+			applyDiskForecasts(metrics.Disk)
 		}
-	}
-
-	// Network Info
-	netStats, err := net.IOCounters(true)
-	if err != nil {
-		log.Printf("Error getting network stats: %v", err)
 	} else {
-		for _, stat := range netStats {
-			metrics.Network = append(metrics.Network, NetworkInfo{
-				Iface:   stat.Name,
-				RxBytes: stat.BytesRecv,
-				TxBytes: stat.BytesSent,
-			})
+		// Copied, since statuses are re-derived in place below
+		metrics.Disk = append([]DiskInfo(nil), prev.Disk...)
+		metrics.MissingMounts = prev.MissingMounts
+		for i := range metrics.Disk {
+			resetStatus(&metrics.Disk[i].Status)
 		}
 	}
 
-	// Temperature (multi-method collection)
-	metrics.Temperature = collectTemperatureInfo(vendor)
-
-	// GPU Info (using nvidia-smi if available)
-	metrics.GPU = collectGPUInfo()
-
-	return metrics, nil
-}
+	// Per-device I/O latency, utilisation and queue depth
+	metrics.DiskIO = DiskIOInfo{Devices: []DiskDeviceIO{}, Status: "disabled"}
+	if collectorEnabled("disk_io") {
+		if plan.due("disk_io") {
+			metrics.DiskIO = collectDiskIOInfo(plan.now, plan.trace("disk_io"))
+		} else {
+			metrics.DiskIO = prev.DiskIO
+		}
+	}
 
-// collectTemperatureInfo tries multiple methods to get CPU temperature
-func collectTemperatureInfo(cpuVendor string) TemperatureInfo {
-	tempInfo := TemperatureInfo{
-		CPUCelsius: 0,
-		CPUVendor:  cpuVendor,
-		GPUCelsius: 0,
-		GPUVendor:  "",
-		Status:     "unavailable",
+	// Network Info
+	if plan.due("network") {
+		netStats, err := net.IOCounters(true)
+		if err != nil {
+			log.Printf("Error getting network stats: %v", err)
+			plan.trace("network").fail("gopsutil", err)
+		} else {
+			plan.trace("network").ok("gopsutil")
+			for _, stat := range netStats {
+				metrics.Network = append(metrics.Network, NetworkInfo{
+					Iface:   stat.Name,
+					RxBytes: stat.BytesRecv,
+					TxBytes: stat.BytesSent,
+				})
+			}
+		}
+		metrics.Connectivity = collectConnectivity()
+	} else {
+		metrics.Network = prev.Network
+		metrics.Connectivity = prev.Connectivity
 	}
 
-	// Method 1: Try gopsutil sensors (works on Linux/macOS)
-	if temp := getTempFromGopsutil(); temp > 0 {
-		tempInfo.CPUCelsius = temp
-		tempInfo.Status = "ok"
-		return tempInfo
+	// Temperature (multi-method collection)
+	metrics.Temperature = TemperatureInfo{Status: "disabled", Drives: []DriveTemperature{}}
+	if collectorEnabled("temperature") && !sensorsApplicable("temperature") {
+		metrics.Temperature.Status = "not_applicable"
+	} else if collectorEnabled("temperature") {
+		if plan.due("temperature") {
+			metrics.Temperature = collectTemperatureInfo(metrics.CPU.Vendor, plan.trace("temperature"))
+			markDegraded("temperature", &metrics.Temperature.Status)
+			metrics.Temperature.Drives = collectDriveTemperatures()
+			calibrateTemperatures(&metrics.Temperature)
+		} else {
+			metrics.Temperature = prev.Temperature
+			resetStatus(&metrics.Temperature.Status)
+			metrics.Temperature.Drives = append([]DriveTemperature(nil), prev.Temperature.Drives...)
+			for i := range metrics.Temperature.Drives {
+				resetStatus(&metrics.Temperature.Drives[i].Status)
+			}
+		}
 	}
 
-	// Method 2: Try Windows WMI
-	if runtime.GOOS == "windows" {
-		if temp := getTempFromWMI(); temp > 0 {
-			tempInfo.CPUCelsius = temp
-			tempInfo.Status = "ok"
-			return tempInfo
+	// GPU Info (using nvidia-smi if available)
+	metrics.GPU = GPUInfo{Status: "disabled", Devices: []GPUDevice{}}
+	if collectorEnabled("gpu") {
+		if plan.due("gpu") {
+			metrics.GPU = collectGPUInfo(plan.trace("gpu"))
+			calibrateGPUTemperatures(&metrics.GPU)
+		} else {
+			metrics.GPU = prev.GPU
 		}
 	}
 
-	// Method 3: Try external tools
-	if temp := getTempFromExternalTools(); temp > 0 {
-		tempInfo.CPUCelsius = temp
-		tempInfo.Status = "ok"
-		return tempInfo
+	// Kernel activity (context switches, interrupts, forks)
+	metrics.Kernel = KernelActivityInfo{Status: "disabled"}
+	if collectorEnabled("kernel") {
+		if plan.due("kernel") {
+			metrics.Kernel = collectKernelActivity()
+		} else {
+			metrics.Kernel = prev.Kernel
+		}
 	}
 
-	return tempInfo
-}
+	// Active checks (results from the background check loop)
+	metrics.Checks = latestCheckResults()
 
-// getTempFromGopsutil uses gopsutil sensors (Linux/macOS)
-func getTempFromGopsutil() int {
-	// Note: gopsutil v3 doesn't have sensors package by default
-	// This would require github.com/shirou/gopsutil/v3/sensors
-	// For now, return 0 (not implemented)
-	return 0
-}
+	// Log file pattern counters (from the background log watcher)
+	metrics.LogWatch = latestLogWatchResults()
 
-// getTempFromWMI queries Windows WMI for temperature - ENHANCED with multiple methods
-func getTempFromWMI() int {
-	if runtime.GOOS != "windows" {
-		return 0
-	}
-
-	// METHOD 1: Try MSAcpi_ThermalZoneTemperature (most reliable)
-	cmd := exec.Command("wmic", "/namespace:\\\\root\\wmi", "PATH", "MSAcpi_ThermalZoneTemperature", "GET", "CurrentTemperature")
-	output, err := cmd.Output()
-	if err == nil {
-		lines := strings.Split(string(output), "\n")
-		for _, line := range lines {
-			line = strings.TrimSpace(line)
-			if line == "" || strings.Contains(line, "CurrentTemperature") {
-				continue
-			}
-			if temp, err := strconv.Atoi(line); err == nil {
-				// WMI returns temperature in tenths of Kelvin
-				// Convert to Celsius: (temp / 10) - 273.15
-				celsius := (temp / 10) - 273
-				if celsius > 0 && celsius < 150 {
-					return celsius
-				}
-			}
+	// Windows Event Log error counts
+	metrics.EventLog = EventLogInfo{Channels: []EventChannelCount{}, Status: "disabled"}
+	if collectorEnabled("event_log") {
+		if plan.due("event_log") {
+			metrics.EventLog = collectEventLogInfo(plan.scheduled)
+		} else {
+			metrics.EventLog = prev.EventLog
 		}
 	}
 
-	// METHOD 2: Try Win32_TemperatureProbe
-	cmd = exec.Command("wmic", "path", "Win32_TemperatureProbe", "get", "CurrentReading")
-	output, err = cmd.Output()
-	if err == nil {
-		lines := strings.Split(string(output), "\n")
-		for _, line := range lines {
-			line = strings.TrimSpace(line)
-			if line == "" || strings.Contains(line, "CurrentReading") {
-				continue
-			}
-			if temp, err := strconv.Atoi(line); err == nil {
-				// Win32_TemperatureProbe returns in tenths of Kelvin
-				celsius := (temp / 10) - 273
-				if celsius > 0 && celsius < 150 {
-					return celsius
-				}
-			}
+	// Kernel ring buffer anomalies (OOM kills, I/O and hardware errors)
+	metrics.KernelLog = KernelLogInfo{Status: "disabled"}
+	if collectorEnabled("kernel_log") {
+		if plan.due("kernel_log") {
+			metrics.KernelLog = collectKernelLogInfo(plan.scheduled)
+			markDegraded("kernel_log", &metrics.KernelLog.Status)
+		} else {
+			metrics.KernelLog = prev.KernelLog
 		}
 	}
 
-	// METHOD 3: Try Win32_PerfFormattedData_Counters_ThermalZoneInformation
-	cmd = exec.Command("wmic", "path", "Win32_PerfFormattedData_Counters_ThermalZoneInformation", "get", "Temperature")
-	output, err = cmd.Output()
-	if err == nil {
-		lines := strings.Split(string(output), "\n")
-		for _, line := range lines {
-			line = strings.TrimSpace(line)
-			if line == "" || strings.Contains(line, "Temperature") {
-				continue
-			}
-			if temp, err := strconv.Atoi(line); err == nil {
-				// This returns Kelvin directly
-				celsius := temp - 273
-				if celsius > 0 && celsius < 150 {
-					return celsius
-				}
-			}
+	// ZFS pool health, scrubs and ARC
+	metrics.ZFS = ZFSInfo{Pools: []ZFSPool{}, Status: "disabled"}
+	if collectorEnabled("zfs") {
+		if plan.due("zfs") {
+			metrics.ZFS = collectZFSInfo(plan.trace("zfs"))
+		} else {
+			metrics.ZFS = prev.ZFS
 		}
 	}
 
-	// METHOD 4: Try PowerShell WMI query (more reliable on some systems)
-	cmd = exec.Command("powershell", "-Command", "(Get-WmiObject -Namespace root/wmi -Class MSAcpi_ThermalZoneTemperature | Select-Object -First 1).CurrentTemperature")
-	output, err = cmd.Output()
-	if err == nil {
-		line := strings.TrimSpace(string(output))
-		if temp, err := strconv.Atoi(line); err == nil {
-			celsius := (temp / 10) - 273
-			if celsius > 0 && celsius < 150 {
-				return celsius
-			}
+	// Software RAID arrays and LVM volume groups
+	metrics.RAID = RAIDInfo{Arrays: []MDArray{}, VolumeGroups: []LVMVolumeGroup{}, Status: "disabled"}
+	if collectorEnabled("raid") {
+		if plan.due("raid") {
+			metrics.RAID = collectRAIDInfo(plan.trace("raid"))
+		} else {
+			metrics.RAID = prev.RAID
 		}
 	}
 
-	// METHOD 5: Try CIM (newer Windows interface)
-	cmd = exec.Command("powershell", "-Command", "(Get-CimInstance -ClassName CIM_TemperatureSensor | Select-Object -First 1).CurrentReading")
-	output, err = cmd.Output()
-	if err == nil {
-		line := strings.TrimSpace(string(output))
-		if temp, err := strconv.ParseFloat(line, 64); err == nil {
-			celsius := int(temp)
-			if celsius > 0 && celsius < 150 {
-				return celsius
-			}
+	// Conntrack and socket table pressure
+	metrics.Sockets = SocketsInfo{Status: "disabled"}
+	if collectorEnabled("sockets") {
+		if plan.due("sockets") {
+			metrics.Sockets = collectSocketsInfo()
+		} else {
+			metrics.Sockets = prev.Sockets
+			resetStatus(&metrics.Sockets.Status)
 		}
 	}
 
-	return 0
-}
-
-// getTempFromExternalTools tries platform-specific external tools
-func getTempFromExternalTools() int {
-	switch runtime.GOOS {
-	case "linux":
-		return getTempFromLinuxSensors()
-	case "windows":
-		return getTempFromWindowsTools()
-	case "darwin":
-		return getTempFromMacTools()
-	default:
-		return 0
+	// CPU vulnerability mitigations and microcode
+	metrics.Security = SecurityInfo{CPUVulnerabilities: []CPUVulnerability{}, AccessControl: []AccessControl{}, Status: "disabled"}
+	if collectorEnabled("security") {
+		if plan.due("security") {
+			metrics.Security = collectSecurityInfo(plan.trace("security"))
+		} else {
+			metrics.Security = prev.Security
+		}
 	}
-}
 
-// getTempFromLinuxSensors uses lm-sensors on Linux - ENHANCED with multiple fallbacks
-func getTempFromLinuxSensors() int {
-	// METHOD 1: Try sensors command (lm-sensors package)
-	cmd := exec.Command("sensors", "-u")
-	output, err := cmd.Output()
-	if err == nil {
-		lines := strings.Split(string(output), "\n")
-		for _, line := range lines {
-			// Look for coretemp or k10temp (AMD/Intel)
-			if strings.Contains(line, "_input:") && (strings.Contains(line, "temp") || strings.Contains(line, "Core")) {
-				fields := strings.Fields(line)
-				if len(fields) >= 2 {
-					if temp, err := strconv.ParseFloat(fields[1], 64); err == nil {
-						if temp > 0 && temp < 150 {
-							return int(temp)
-						}
-					}
-				}
-			}
+	// Pending package updates and reboot-required flags
+	metrics.Updates = UpdatesInfo{Sources: []UpdateSource{}, RebootReasons: []string{}, Status: "disabled"}
+	if collectorEnabled("updates") {
+		if plan.due("updates") {
+			metrics.Updates = collectUpdatesInfo(plan.trace("updates"))
+		} else {
+			metrics.Updates = prev.Updates
 		}
 	}
 
-	// METHOD 2: Try /sys/class/hwmon (direct kernel interface)
-	hwmonDirs, _ := filepath.Glob("/sys/class/hwmon/hwmon*")
-	for _, hwmonDir := range hwmonDirs {
-		// Read hwmon name to identify CPU sensors
-		nameBytes, err := os.ReadFile(filepath.Join(hwmonDir, "name"))
-		if err != nil {
-			continue
+	// CPU and memory summed by process owner
+	metrics.Users = UsersInfo{Top: []UserUsage{}, Status: "disabled"}
+	if collectorEnabled("users") {
+		if plan.due("users") {
+			metrics.Users = collectUsersInfo(plan.now, metrics.Memory.TotalMB, plan.trace("users"))
+		} else {
+			metrics.Users = prev.Users
 		}
-		name := strings.ToLower(strings.TrimSpace(string(nameBytes)))
+	}
 
-		// Look for CPU-related sensors (coretemp, k10temp, zenpower)
-		if strings.Contains(name, "coretemp") || strings.Contains(name, "k10temp") ||
-			strings.Contains(name, "zenpower") || strings.Contains(name, "cpu") {
-			// Find temperature input files
-			tempFiles, _ := filepath.Glob(filepath.Join(hwmonDir, "temp*_input"))
-			for _, tempFile := range tempFiles {
-				tempBytes, err := os.ReadFile(tempFile)
-				if err != nil {
-					continue
-				}
-				if temp, err := strconv.Atoi(strings.TrimSpace(string(tempBytes))); err == nil {
-					celsius := temp / 1000 // Convert from millidegrees
-					if celsius > 0 && celsius < 150 {
-						return celsius
-					}
-				}
-			}
+	// CPU and memory by systemd slice, service and container cgroup
+	metrics.Cgroups = CgroupsInfo{Groups: []CgroupUsage{}, Status: "disabled"}
+	if collectorEnabled("cgroups") {
+		if plan.due("cgroups") {
+			metrics.Cgroups = collectCgroupsInfo(plan.now, plan.trace("cgroups"))
+		} else {
+			metrics.Cgroups = prev.Cgroups
 		}
 	}
 
-	// METHOD 3: Try /sys/class/thermal/thermal_zone* (thermal zones)
-	thermalZones, _ := filepath.Glob("/sys/class/thermal/thermal_zone*/temp")
-	for _, zoneTempFile := range thermalZones {
-		tempBytes, err := os.ReadFile(zoneTempFile)
-		if err != nil {
-			continue
-		}
-		if temp, err := strconv.Atoi(strings.TrimSpace(string(tempBytes))); err == nil {
-			celsius := temp / 1000
-			if celsius > 0 && celsius < 150 {
-				return celsius
-			}
+	// NUMA nodes with their CPUs and memory
+	metrics.NUMA = NUMAInfo{Nodes: []NUMANode{}, Status: "disabled"}
+	if collectorEnabled("numa") {
+		if plan.due("numa") {
+			metrics.NUMA = collectNUMAInfo(plan.trace("numa"))
+		} else {
+			metrics.NUMA = prev.NUMA
 		}
 	}
 
-	// METHOD 4: Try acpi command (if available)
-	cmd = exec.Command("acpi", "-t")
-	output, err = cmd.Output()
-	if err == nil {
-		lines := strings.Split(string(output), "\n")
-		for _, line := range lines {
-			if strings.Contains(line, "ok,") {
-				// Parse format: "Thermal 0: ok, 45.0 degrees C"
-				parts := strings.Split(line, ",")
-				if len(parts) >= 2 {
-					tempStr := strings.TrimSpace(parts[1])
-					tempStr = strings.Split(tempStr, " ")[0]
-					if temp, err := strconv.ParseFloat(tempStr, 64); err == nil {
-						if temp > 0 && temp < 150 {
-							return int(temp)
-						}
-					}
-				}
-			}
+	// Hugepage pools and transparent hugepage settings
+	metrics.Hugepages = HugepagesInfo{Pools: []HugepagePool{}, Status: "disabled"}
+	if collectorEnabled("hugepages") {
+		if plan.due("hugepages") {
+			metrics.Hugepages = collectHugepagesInfo(plan.trace("hugepages"))
+		} else {
+			metrics.Hugepages = prev.Hugepages
 		}
 	}
 
-	// METHOD 5: Try reading CPU package temperature directly
-	packageTempFiles := []string{
-		"/sys/devices/platform/coretemp.0/hwmon/hwmon*/temp1_input", // Intel
-		"/sys/devices/platform/k10temp.0/hwmon/hwmon*/temp1_input",  // AMD
-	}
-	for _, pattern := range packageTempFiles {
-		matches, _ := filepath.Glob(pattern)
-		for _, match := range matches {
-			tempBytes, err := os.ReadFile(match)
-			if err != nil {
-				continue
-			}
-			if temp, err := strconv.Atoi(strings.TrimSpace(string(tempBytes))); err == nil {
-				celsius := temp / 1000
-				if celsius > 0 && celsius < 150 {
-					return celsius
-				}
-			}
+	// Kernel entropy pool and the RNGs feeding it
+	metrics.Entropy = EntropyInfo{Status: "disabled"}
+	if collectorEnabled("entropy") {
+		if plan.due("entropy") {
+			metrics.Entropy = collectEntropyInfo(plan.trace("entropy"))
+		} else {
+			metrics.Entropy = prev.Entropy
+			resetStatus(&metrics.Entropy.Status)
 		}
 	}
 
-	return 0
-}
-
-// getTempFromWindowsTools tries Windows-specific tools
-func getTempFromWindowsTools() int {
-	// Try OpenHardwareMonitor CLI (if installed)
-	cmd := exec.Command("OpenHardwareMonitorCLI.exe", "/cpu")
-	output, err := cmd.Output()
-	if err == nil {
-		lines := strings.Split(string(output), "\n")
-		for _, line := range lines {
-			if strings.Contains(strings.ToLower(line), "temperature") {
-				fields := strings.Fields(line)
-				for _, field := range fields {
-					if temp, err := strconv.ParseFloat(strings.TrimSuffix(field, "°C"), 64); err == nil {
-						if temp > 0 && temp < 150 {
-							return int(temp)
-						}
-					}
-				}
-			}
+	// Usage of kernel-wide limits such as fs.file-max
+	metrics.Limits = LimitsInfo{Limits: []KernelLimit{}, Status: "disabled"}
+	if collectorEnabled("limits") {
+		if plan.due("limits") {
+			metrics.Limits = collectLimitsInfo(plan.trace("limits"))
+		} else {
+			// Copied, since statuses are re-derived in place
+			metrics.Limits = prev.Limits
+			metrics.Limits.Limits = append([]KernelLimit(nil), prev.Limits.Limits...)
+			resetStatus(&metrics.Limits.Status)
 		}
 	}
 
-	return 0
-}
-
-// getTempFromMacTools tries macOS-specific tools
-func getTempFromMacTools() int {
-	// Try osx-cpu-temp (if installed via brew)
-	cmd := exec.Command("osx-cpu-temp")
-	output, err := cmd.Output()
-	if err == nil {
-		// Output format: "61.8°C"
-		str := strings.TrimSpace(string(output))
-		str = strings.TrimSuffix(str, "°C")
-		if temp, err := strconv.ParseFloat(str, 64); err == nil {
-			if temp > 0 && temp < 150 {
-				return int(temp)
-			}
+	// User and group disk quotas
+	metrics.Quotas = QuotasInfo{Entries: []QuotaEntry{}, Status: "disabled"}
+	if collectorEnabled("quotas") {
+		if plan.due("quotas") {
+			metrics.Quotas = collectQuotasInfo(plan.now, plan.trace("quotas"))
+		} else {
+			metrics.Quotas = prev.Quotas
+			resetStatus(&metrics.Quotas.Status)
 		}
 	}
 
-	// Try smc command
-	cmd = exec.Command("smc", "-k", "TC0P", "-r")
-	output, err = cmd.Output()
-	if err == nil {
-		lines := strings.Split(string(output), "\n")
-		for _, line := range lines {
-			if strings.Contains(line, "bytes") {
-				fields := strings.Fields(line)
-				for _, field := range fields {
-					if temp, err := strconv.ParseFloat(field, 64); err == nil {
-						if temp > 0 && temp < 150 {
-							return int(temp)
-						}
-					}
-				}
-			}
+	// Hyper-V virtual machines (Windows hosts with the Hyper-V role)
+	metrics.HyperV = HyperVInfo{VMs: []HyperVVM{}, Status: "disabled"}
+	if collectorEnabled("hyperv") {
+		if plan.due("hyperv") {
+			metrics.HyperV = collectHyperVInfo()
+		} else {
+			metrics.HyperV = prev.HyperV
 		}
 	}
 
-	return 0
+	// Watched directory sizes (from the background directory scanner)
+	metrics.DirWatch = latestDirWatchResults()
+	metrics.ProcessWatch = collectProcessWatch()
+	metrics.ScheduledTasks = collectScheduledTasks()
+	metrics.Custom = latestExecResults()
+	metrics.SNMPDevices = latestSNMPDevices()
+
+	metrics.FileMetrics = collectFileMetrics()
+
+	// Windows performance counters from perf_counters
+	metrics.PerfCounters = PerfCountersInfo{Counters: []PerfCounterValue{}, Status: "disabled"}
+	if len(currentConfig().PerfCounters) > 0 {
+		metrics.PerfCounters = collectPerfCounters()
+	}
+
+	// Currently firing alerts
+	metrics.Alerts = currentAlerts()
+
+	// Collectors limited by missing privileges
+	metrics.Degraded = probeCapabilities()
+
+	// Derive ok/warning/critical statuses and overall health
+	applyStatusThresholds(metrics)
+
+	// Per-section collection times
+	plan.finish(metrics)
+
+	return metrics, nil
 }
 
-func collectGPUInfo() GPUInfo {
+func collectGPUInfo(trace *sectionTrace) GPUInfo {
 	gpuInfo := GPUInfo{
 		Status:  "unavailable",
 		Count:   0,
@@ -551,24 +598,24 @@ func collectGPUInfo() GPUInfo {
 	}
 
 	// 1. Try NVIDIA (nvidia-smi) - Best Data
-	if nvidiaInfo := collectNvidiaInfo(); nvidiaInfo.Status == "ok" {
+	if nvidiaInfo := collectNvidiaInfo(trace); nvidiaInfo.Status == "ok" {
 		return nvidiaInfo
 	}
 
 	// 2. Fallback: Windows Generic (WMI/CIM) - Essential Data (Name)
-	if runtime.GOOS == "windows" {
-		return collectWindowsGPUs()
+	if collectorOS == "windows" {
+		return collectWindowsGPUs(trace)
 	}
 
 	return gpuInfo
 }
 
-func collectNvidiaInfo() GPUInfo {
+func collectNvidiaInfo(trace *sectionTrace) GPUInfo {
 	gpuInfo := GPUInfo{Status: "unavailable"}
 
-	cmd := exec.Command("nvidia-smi", "--query-gpu=name,utilization.gpu,memory.used,memory.total,temperature.gpu", "--format=csv,noheader,nounits")
-	output, err := cmd.Output()
+	output, err := commands.Output("nvidia-smi", "--query-gpu=name,utilization.gpu,memory.used,memory.total,temperature.gpu", "--format=csv,noheader,nounits")
 	if err != nil {
+		trace.fail("nvidia-smi", err)
 		return gpuInfo
 	}
 
@@ -597,18 +644,21 @@ func collectNvidiaInfo() GPUInfo {
 	if len(gpuInfo.Devices) > 0 {
 		gpuInfo.Status = "ok"
 		gpuInfo.Count = len(gpuInfo.Devices)
+		trace.ok("nvidia-smi")
+	} else {
+		trace.fail("nvidia-smi", errNoReading)
 	}
 
 	return gpuInfo
 }
 
-func collectWindowsGPUs() GPUInfo {
+func collectWindowsGPUs(trace *sectionTrace) GPUInfo {
 	gpuInfo := GPUInfo{Status: "unavailable"}
 
 	// Use PowerShell to get clean JSON output for Video Controllers
-	cmd := exec.Command("powershell", "-Command", "Get-CimInstance Win32_VideoController | Select-Object Name, AdapterRAM | ConvertTo-Json -Compress")
-	output, err := cmd.Output()
+	output, err := commands.Output("powershell", "-Command", "Get-CimInstance Win32_VideoController | Select-Object Name, AdapterRAM | ConvertTo-Json -Compress")
 	if err != nil {
+		trace.fail("cim Win32_VideoController", err)
 		return gpuInfo
 	}
 
@@ -619,7 +669,7 @@ func collectWindowsGPUs() GPUInfo {
 	}
 
 	var controllers []WinVideoController
-	
+
 	// Handle single object vs array return from PowerShell
 	jsonStr := strings.TrimSpace(string(output))
 	if strings.HasPrefix(jsonStr, "{") {
@@ -651,12 +701,9 @@ func collectWindowsGPUs() GPUInfo {
 			}
 		}
 
-		// Attempt to get Temperature via Generic Tools
-		// Note: Accurate GPU temp for AMD/Intel often requires complex API calls (ADL/IGCL)
-		// We try to grab the generic CPU temp as a proxy or 0 if unknown.
-		// A future improvement could try OpenHardwareMonitor specifically for this GPU.
-		temp := 0 
-		
+		// WMI has no GPU temperature; LibreHardwareMonitor reads it when running
+		temp := lhmGPUTemperature(card.Name)
+
 		gpuInfo.Devices = append(gpuInfo.Devices, GPUDevice{
 			Vendor:             vendor,
 			Model:              card.Name,
@@ -671,33 +718,35 @@ func collectWindowsGPUs() GPUInfo {
 	if len(gpuInfo.Devices) > 0 {
 		gpuInfo.Status = "ok"
 		gpuInfo.Count = len(gpuInfo.Devices)
+		trace.ok("cim Win32_VideoController")
+	} else {
+		trace.fail("cim Win32_VideoController", errNoReading)
 	}
 
 	return gpuInfo
 }
 
 func metricsHandler(w http.ResponseWriter, r *http.Request) {
-	metrics, err := collectMetrics()
+	metrics, err := collectForRequest(r)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Error collecting metrics: %v", err), http.StatusInternalServerError)
+		writeCollectError(w, err)
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	w.Header().Set("Access-Control-Allow-Origin", "*")
-
-	json.NewEncoder(w).Encode(metrics)
+	switch format := r.URL.Query().Get("format"); format {
+	case "", "native":
+		writeEncoded(w, r, http.StatusOK, metrics)
+	case "telegraf":
+		writeEncoded(w, r, http.StatusOK, telegrafMetrics(metrics))
+	default:
+		http.Error(w, fmt.Sprintf("Unsupported format %q", format), http.StatusBadRequest)
+	}
 }
 
 func refreshHandler(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
-	}
-
-	metrics, err := collectMetrics()
+	metrics, err := collectForRequest(r)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Error collecting metrics: %v", err), http.StatusInternalServerError)
+		writeCollectError(w, err)
 		return
 	}
 
@@ -706,8 +755,7 @@ func refreshHandler(w http.ResponseWriter, r *http.Request) {
 		log.Printf("[ERROR] Failed to write metrics to file during refresh: %v", err)
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]interface{}{
+	writeJSON(w, http.StatusOK, map[string]interface{}{
 		"status":    "success",
 		"message":   "Native metrics refreshed and written to file",
 		"timestamp": metrics.Timestamp,
@@ -715,16 +763,31 @@ func refreshHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 func healthHandler(w http.ResponseWriter, r *http.Request) {
-	response := map[string]string{
-		"status":    "ok",
-		"service":   "native-go-agent",
-		"platform":  runtime.GOOS,
-		"port":      PORT,
+	response := map[string]interface{}{
+		"status":              "ok",
+		"service":             "native-go-agent",
+		"platform":            runtime.GOOS,
+		"hostname":            agentHostname(),
+		"agent_id":            agentID(),
+		"port":                PORT,
+		"read_only":           readOnlyMode,
+		"interval_seconds":    sampler.current().Seconds(),
+		"degraded_collectors": probeCapabilities(),
+		"timestamp":           time.Now().UTC().Format(time.RFC3339),
+	}
+
+	writeJSON(w, http.StatusOK, response)
+}
+
+func alertsHandler(w http.ResponseWriter, r *http.Request) {
+	alerts := currentAlerts()
+	response := map[string]interface{}{
+		"count":     len(alerts),
+		"alerts":    alerts,
 		"timestamp": time.Now().UTC().Format(time.RFC3339),
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(response)
+	writeJSON(w, http.StatusOK, response)
 }
 
 func writeMetricsToFile(metrics *SystemMetrics) error {
@@ -735,90 +798,208 @@ func writeMetricsToFile(metrics *SystemMetrics) error {
 	}
 	exeDir := filepath.Dir(exePath)
 
-	// Write to Host2/go_latest.json
-	outputPath := filepath.Join(exeDir, OUTPUT_FILE)
+	for _, format := range currentConfig().OutputFormats {
+		switch format {
+		case "json":
+			// Write to Host2/go_latest.json
+			outputPath := filepath.Join(exeDir, OUTPUT_FILE)
 
-	data, err := json.MarshalIndent(metrics, "", "  ")
-	if err != nil {
-		return fmt.Errorf("failed to marshal metrics: %v", err)
-	}
+			data, err := json.MarshalIndent(metrics, "", "  ")
+			if err != nil {
+				return fmt.Errorf("failed to marshal metrics: %v", err)
+			}
 
-	err = ioutil.WriteFile(outputPath, data, 0644)
-	if err != nil {
-		return fmt.Errorf("failed to write file: %v", err)
-	}
+			err = ioutil.WriteFile(outputPath, data, 0644)
+			if err != nil {
+				return fmt.Errorf("failed to write file: %v", err)
+			}
+
+			log.Printf("[FILE] Metrics written to %s", outputPath)
+		case "protobuf":
+			// Replaced atomically so readers never see a torn message
+			outputPath := filepath.Join(exeDir, OUTPUT_FILE_PROTOBUF)
+			tmpPath := outputPath + ".tmp"
+			if err := ioutil.WriteFile(tmpPath, encodeSnapshotProto(metrics), 0644); err != nil {
+				return fmt.Errorf("failed to write file: %v", err)
+			}
+			if err := os.Rename(tmpPath, outputPath); err != nil {
+				return fmt.Errorf("failed to replace %s: %v", outputPath, err)
+			}
 
-	log.Printf("[FILE] Metrics written to %s", outputPath)
+			log.Printf("[FILE] Metrics written to %s", outputPath)
+		}
+	}
 	return nil
 }
 
-func startPeriodicFileWriter() {
-	ticker := time.NewTicker(UPDATE_INTERVAL)
-	defer ticker.Stop()
-
-	log.Printf("[FILE] Starting periodic file writer (interval: %v)", UPDATE_INTERVAL)
-
-	// Write immediately on start
-	metrics, err := collectMetrics()
+// collectAndStore takes one periodic sample: it writes the file, records
+// history and evaluates alert rules.
+func collectAndStore() *SystemMetrics {
+	metrics, err := collectMetricsLimited(nil, true)
 	if err != nil {
-		log.Printf("[FILE] Error collecting initial metrics: %v", err)
-	} else {
+		log.Printf("[FILE] Error collecting metrics: %v", err)
+		return nil
+	}
+
+	if !readOnlyMode {
 		if err := writeMetricsToFile(metrics); err != nil {
-			log.Printf("[FILE] Error writing initial metrics: %v", err)
+			log.Printf("[FILE] Error writing metrics: %v", err)
 		}
+		snapshots.append(metrics)
 	}
+	publishToSinks(metrics)
+	history.add(metrics)
+	evaluateAlertRules(metrics)
+	return metrics
+}
 
-	// Then write every 60 seconds
-	for range ticker.C {
-		metrics, err := collectMetrics()
-		if err != nil {
-			log.Printf("[FILE] Error collecting metrics: %v", err)
-			continue
+func startPeriodicFileWriter() {
+	interval := time.Duration(currentConfig().IntervalSeconds) * time.Second
+	log.Printf("[FILE] Starting periodic file writer (interval: %v)", interval)
+
+	// Write on start, after the jitter or wall-clock alignment delay
+	time.Sleep(startDelay())
+	metrics := collectAndStore()
+
+	// Then write every interval, which adaptive sampling may shorten, and
+	// pick up interval changes on reload
+	for {
+		reloaded := configReloaded()
+		delay := scheduledDelay(sampler.next(metrics))
+		if replay != nil {
+			// Follow the recording's own spacing at the replay speed
+			delay = replay.delay()
 		}
-
-		if err := writeMetricsToFile(metrics); err != nil {
-			log.Printf("[FILE] Error writing metrics: %v", err)
+		select {
+		case <-time.After(delay):
+			metrics = collectAndStore()
+		case <-reloaded:
+			if next := time.Duration(currentConfig().IntervalSeconds) * time.Second; next != interval {
+				interval = next
+				log.Printf("[FILE] Interval changed to %v", interval)
+			}
 		}
 	}
 }
 
-func main() {
-	http.HandleFunc("/metrics", metricsHandler)
-	http.HandleFunc("/refresh", refreshHandler)
-	http.HandleFunc("/health", healthHandler)
-	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
-		response := map[string]interface{}{
-			"name":     "Native Go Host Agent",
-			"version":  "1.0.0",
-			"platform": runtime.GOOS,
-			"endpoints": map[string]string{
-				"/":        "This endpoint (API info)",
-				"/health":  "Health check",
-				"/metrics": "System metrics (native)",
-			},
-		}
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(response)
+// serve runs the HTTP API and the background collectors until the process
+// is stopped.
+func serve() {
+	cfg, err := loadConfig()
+	if err != nil {
+		log.Fatalf("[CONFIG] %v", err)
+	}
+	applyConfig(cfg)
+	checkPendingUpdate()
+	go watchReloadSignal()
+	probeCapabilities()
+
+	api := newRouter()
+	api.handle("GET", "/", "This endpoint (API info)", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"name":      "Native Go Host Agent",
+			"version":   VERSION,
+			"platform":  runtime.GOOS,
+			"build":     buildInfo(),
+			"features":  featureInfo(),
+			"endpoints": api.endpoints(),
+		})
 	})
+	api.handle("GET", "/health", "Health check", healthHandler)
+	api.handle("GET", "/metrics", "System metrics (?format=native|telegraf; JSON, MessagePack or CBOR by Accept)", metricsHandler)
+	api.handle("GET", "/metrics/diff", "Change between two stored snapshots (?from=&to=)", metricsDiffHandler)
+	api.handle("POST", "/refresh", "Collect now and rewrite the metrics file", refreshHandler)
+	api.handle("GET", "/history", "Stored history of one series (?series=&minutes=) or the list of series", historyHandler)
+	api.handle("GET", "/grafana", "Grafana JSON datasource root (connection test)", grafanaTestHandler)
+	api.handle("GET", "/grafana/", "Grafana JSON datasource root (connection test)", grafanaTestHandler)
+	api.handleQuery("/grafana/search", "Grafana JSON datasource: list metrics", grafanaSearchHandler)
+	api.handleQuery("/grafana/query", "Grafana JSON datasource: time series and tables from history", grafanaQueryHandler)
+	api.handleQuery("/grafana/annotations", "Grafana JSON datasource: alerts as annotations", grafanaAnnotationsHandler)
+	api.handle("GET", "/stats", "Min/max/avg/p50/p95/p99 of CPU, memory, disk and temperature (?window=1h)", statsHandler)
+	api.handle("GET", "/export", "History as tidy CSV (?fields=&minutes= or from/to)", exportHandler)
+	api.handle("GET", "/dashboard", "Built-in web dashboard", dashboardHandler)
+	api.handle("GET", "/dashboard/", "Built-in web dashboard", dashboardHandler)
+	api.handle("GET", "/processes", "Busiest processes with CPU, memory, I/O, connections and eBPF attribution (?sort=cpu|memory|io|net&limit=)", processesHandler)
+	api.handle("GET", "/uptime", "Reboot history and availability per uptime.windows_days window", uptimeHandler)
+	api.handle("GET", "/ports", "Listening TCP/UDP sockets with owning process (?protocol=tcp|udp)", portsHandler)
+	api.handle("GET", "/inventory/packages", "Installed packages and applications with versions (?name=&source=), when inventory.enabled", inventoryPackagesHandler)
+	api.handle("GET", "/inventory/devices", "Attached USB and PCI devices and recent changes (?bus=usb|pci), when inventory.devices", inventoryDevicesHandler)
+	api.handle("GET", "/alerts", "Active alerts (rules, anomalies, watchers)", alertsHandler)
+	api.handle("GET", "/alerts/silence", "List, create or delete alert silences", listSilencesHandler)
+	api.handle("POST", "/alerts/silence", "", requireAPIToken(createSilenceHandler))
+	api.handle("DELETE", "/alerts/silence", "", requireAPIToken(deleteSilenceHandler))
+	api.handle("GET", "/config", "Effective configuration or update runtime settings, requires API token", requireAPIToken(configGetHandler))
+	api.handle("PUT", "/config", "", requireAPIToken(configUpdateHandler))
+	api.handle("POST", "/config/reload", "Re-read the config file, requires API token", requireAPIToken(configReloadHandler))
+	api.handle("GET", "/fleet", "Gossip members with alive/suspect/dead status", fleetHandler)
+	api.handle("GET", "/fleet/metrics", "Metrics of every live gossip member (?include_suspect=true)", fleetMetricsHandler)
+	api.handle("GET", "/fleet/proxy", "Forward a GET to one member (?agent=&path=)", fleetProxyHandler)
+
+	listeners, err := bindListeners()
+	if err != nil {
+		log.Fatal(err)
+	}
 
 	fmt.Println("==========================================================")
 	fmt.Println("  Native Go Host Agent - System Monitor")
 	fmt.Println("==========================================================")
 	fmt.Println()
 	fmt.Printf("[*] Platform:  %s\n", runtime.GOOS)
-	fmt.Printf("[*] Port:      %s\n", PORT)
+	fmt.Printf("[*] Listen:    %s\n", strings.Join(cfg.API.Listen, ", "))
+	fmt.Println("[*] TLS:       off, put a TLS-terminating proxy in front for HTTPS")
+	if readOnlyMode {
+		fmt.Println("[*] Mode:      read-only")
+	}
 	fmt.Println()
 	fmt.Println("[*] Endpoints:")
-	fmt.Printf("   - GET  http://localhost:%s/         (API Info)\n", PORT)
-	fmt.Printf("   - GET  http://localhost:%s/health   (Health Check)\n", PORT)
-	fmt.Printf("   - GET  http://localhost:%s/metrics  (System Metrics)\n", PORT)
+	for _, listener := range listeners {
+		base := listenerURL(listener)
+		fmt.Printf("   - GET  %s/         (API Info)\n", base)
+		fmt.Printf("   - GET  %s/health   (Health Check)\n", base)
+		fmt.Printf("   - GET  %s/metrics  (System Metrics)\n", base)
+		fmt.Printf("   - GET  %s/alerts   (Active Alerts)\n", base)
+	}
 	fmt.Println()
 	fmt.Println("[*] Press Ctrl+C to stop")
 	fmt.Println()
 	fmt.Println("==========================================================")
 
 	// Start background file writer
+	startSinks()
 	go startPeriodicFileWriter()
 
-	log.Fatal(http.ListenAndServe(":"+PORT, nil))
+	// Start active checks (ping probes)
+	go startActiveChecks()
+
+	// Start log file watchers
+	go startLogWatchers()
+
+	// Start directory size watchers
+	go startDirWatchers()
+
+	// Start exec and WebAssembly metric plugins
+	go startExecPlugins()
+	go startWasmPlugins()
+
+	// List installed packages and attached devices for /inventory
+	go startInventory()
+	go startDeviceWatch()
+
+	// Start the SNMP agent and device poller
+	go startSNMPAgent()
+	go startSNMPPoller()
+
+	// Register with the fleet server and send heartbeats
+	go startRegistration(api.endpoints())
+	go startAutoUpdate()
+
+	// Discover peers for /fleet
+	go startGossip()
+
+	handler := chain(api, recoverMiddleware, accessMiddleware, corsMiddleware, gzipMiddleware)
+
+	// Serve an aggregator over an outbound connection
+	go startTunnel(handler)
+
+	log.Fatal(serveListeners(listeners, handler))
 }
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/shirou/gopsutil/v3/disk"
+)
+
+// MissingMount is an /etc/fstab entry that is not mounted.
+type MissingMount struct {
+	Mountpoint string `json:"mountpoint"`
+	Source     string `json:"source"`
+	Fstype     string `json:"fstype"`
+}
+
+// Mount points seen writable since the agent started
+var mountState = struct {
+	sync.Mutex
+	writable map[string]bool
+}{writable: map[string]bool{}}
+
+type fstabEntry struct {
+	source, mountpoint, fstype string
+	options                    []string
+}
+
+// mountTable holds what one disk collection compares the mounts against.
+type mountTable struct {
+	fstab   map[string]fstabEntry // by mount point
+	superRO map[string]bool       // mount points whose filesystem the kernel made read-only
+}
+
+// superblockReadOnly lists the mount points whose filesystem is read-only
+// although the mount itself may say rw: when ext4 or XFS hit an error and
+// remount read-only, only the superblock options in mountinfo change. Other
+// platforms need no such check; their mount options already tell.
+func superblockReadOnly() map[string]bool {
+	if collectorOS != "linux" {
+		return nil
+	}
+	readOnly := map[string]bool{}
+	data, err := hostFS.ReadFile("/proc/self/mountinfo")
+	if err != nil {
+		return readOnly
+	}
+	// "36 35 98:0 /mnt1 /mnt2 rw,noatime master:1 - ext3 /dev/root ro,errors=continue"
+	for _, line := range strings.Split(string(data), "\n") {
+		mount, super, found := strings.Cut(line, " - ")
+		fields, superFields := strings.Fields(mount), strings.Fields(super)
+		if !found || len(fields) < 5 || len(superFields) < 3 {
+			continue
+		}
+		if slices.Contains(strings.Split(superFields[2], ","), "ro") {
+			readOnly[unescapeFstab(fields[4])] = true
+		}
+	}
+	return readOnly
+}
+
+func readMountTable() mountTable {
+	table := mountTable{fstab: map[string]fstabEntry{}, superRO: superblockReadOnly()}
+	if collectorOS == "windows" {
+		return table
+	}
+	data, err := hostFS.ReadFile("/etc/fstab")
+	if err != nil {
+		return table
+	}
+	// "UUID=... /data ext4 defaults,noatime 0 2"
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 4 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		entry := fstabEntry{
+			source:     unescapeFstab(fields[0]),
+			mountpoint: filepath.Clean(unescapeFstab(fields[1])),
+			fstype:     fields[2],
+			options:    strings.Split(fields[3], ","),
+		}
+		if entry.fstype == "swap" || !strings.HasPrefix(entry.mountpoint, "/") {
+			continue
+		}
+		table.fstab[entry.mountpoint] = entry
+	}
+	return table
+}
+
+// readOnly reports whether the partition is mounted read-only, and
+// whether that is unexpected: /etc/fstab mounts it read-write, or the agent
+// saw it writable earlier. Filesystems such as ext4 with errors=remount-ro
+// turn read-only by themselves when the disk under them fails.
+func (t mountTable) readOnly(p disk.PartitionStat) (readOnly, unexpected bool) {
+	readOnly = slices.Contains(p.Opts, "ro") || t.superRO[p.Mountpoint]
+
+	mountState.Lock()
+	defer mountState.Unlock()
+	if !readOnly {
+		mountState.writable[p.Mountpoint] = true
+		return false, false
+	}
+	entry, inFstab := t.fstab[p.Mountpoint]
+	return true, mountState.writable[p.Mountpoint] || (inFstab && !slices.Contains(entry.options, "ro"))
+}
+
+// missing lists the /etc/fstab entries mounted at boot that are not
+// mounted now.
+func (t mountTable) missing() []MissingMount {
+	missing := []MissingMount{}
+	if len(t.fstab) == 0 {
+		return missing
+	}
+	partitions, err := disk.Partitions(true)
+	if err != nil {
+		return missing
+	}
+	mounted := make(map[string]bool, len(partitions))
+	for _, p := range partitions {
+		mounted[p.Mountpoint] = true
+	}
+	for _, entry := range t.fstab {
+		if mounted[entry.mountpoint] || slices.Contains(entry.options, "noauto") {
+			continue
+		}
+		missing = append(missing, MissingMount{Mountpoint: entry.mountpoint, Source: entry.source, Fstype: entry.fstype})
+	}
+	sort.Slice(missing, func(i, j int) bool { return missing[i].Mountpoint < missing[j].Mountpoint })
+	return missing
+}
+
+// unescapeFstab decodes the octal escapes fstab and mountinfo use for
+// spaces and tabs ("/mnt/my\040disk").
+func unescapeFstab(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+4 <= len(s) {
+			if n, err := strconv.ParseUint(s[i+1:i+4], 8, 8); err == nil {
+				b.WriteByte(byte(n))
+				i += 3
+				continue
+			}
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
+
+// mountAlerts fires for filesystems that turned read-only and fstab mounts
+// that are missing.
+func mountAlerts(disks []DiskInfo, missing []MissingMount) []Alert {
+	var firing []Alert
+	for _, d := range disks {
+		if d.Status == "read_only" {
+			firing = append(firing, Alert{
+				ID:       "mount:read_only:" + d.Device,
+				Rule:     "mount",
+				Severity: "critical",
+				Message:  fmt.Sprintf("%s (%s) is mounted read-only", d.Device, d.Filesystem),
+				Value:    1,
+			})
+		}
+	}
+	for _, m := range missing {
+		firing = append(firing, Alert{
+			ID:       "mount:missing:" + m.Mountpoint,
+			Rule:     "mount",
+			Severity: "warning",
+			Message:  fmt.Sprintf("%s (%s from %s) is in /etc/fstab but not mounted", m.Mountpoint, m.Fstype, m.Source),
+			Value:    1,
+		})
+	}
+	return firing
+}
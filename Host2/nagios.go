@@ -0,0 +1,194 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Nagios plugin exit codes
+const (
+	NAGIOS_OK       = 0
+	NAGIOS_WARNING  = 1
+	NAGIOS_CRITICAL = 2
+	NAGIOS_UNKNOWN  = 3
+)
+
+var nagiosStates = []string{"OK", "WARNING", "CRITICAL", "UNKNOWN"}
+
+// nagiosAlias maps the short check names to a history metric, its unit and
+// the configured thresholds used when --warn/--crit are not given.
+type nagiosAlias struct {
+	metric    string
+	unit      string
+	threshold func(ThresholdsConfig) ThresholdConfig
+}
+
+var nagiosAliases = map[string]nagiosAlias{
+	"cpu":         {"cpu_usage_percent", "%", func(t ThresholdsConfig) ThresholdConfig { return t.CPU }},
+	"memory":      {"memory_usage_percent", "%", func(t ThresholdsConfig) ThresholdConfig { return t.Memory }},
+	"disk":        {"disk_used_percent", "%", func(t ThresholdsConfig) ThresholdConfig { return t.Disk }},
+	"temperature": {"temperature_cpu_celsius", "", func(t ThresholdsConfig) ThresholdConfig { return t.Temperature }},
+}
+
+// nagiosCheckCommand collects once and evaluates one metric as a
+// Nagios/Icinga plugin: a single status line with performance data and
+// the matching exit code. It exits the process itself.
+func nagiosCheckCommand(target string, args []string) {
+	fs := newFlagSet("check " + target)
+	warn := fs.Float64("warn", -1, "warning threshold (default from thresholds in the config for cpu, memory, disk, temperature)")
+	crit := fs.Float64("crit", -1, "critical threshold")
+	below := fs.Bool("below", false, "alert when the value falls below the thresholds instead of exceeding them")
+	label := fs.String("label", "", "only check series with this label, as name=value (e.g. device=/dev/sda1)")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: host-agent check <cpu|memory|disk|temperature|metric> [flags]\n\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	code, output := runNagiosCheck(target, *warn, *crit, *below, *label)
+	fmt.Println(output)
+	os.Exit(code)
+}
+
+func runNagiosCheck(target string, warn, crit float64, below bool, label string) (int, string) {
+	service := strings.ToUpper(target)
+	unknown := func(format string, args ...interface{}) (int, string) {
+		return NAGIOS_UNKNOWN, service + " UNKNOWN - " + fmt.Sprintf(format, args...)
+	}
+
+	cfg, err := loadConfig()
+	if err != nil {
+		return unknown("%v", err)
+	}
+	metric, unit := target, ""
+	if alias, ok := nagiosAliases[target]; ok {
+		metric, unit = alias.metric, alias.unit
+		// A zero configured level is disabled, like in the thresholds
+		t := alias.threshold(cfg.Thresholds)
+		if warn < 0 && t.Warning > 0 {
+			warn = t.Warning
+		}
+		if crit < 0 && t.Critical > 0 {
+			crit = t.Critical
+		}
+	}
+	if warn < 0 && crit < 0 {
+		return unknown("--warn or --crit is required for %s", metric)
+	}
+	var labelName, labelValue string
+	if label != "" {
+		var ok bool
+		if labelName, labelValue, ok = strings.Cut(label, "="); !ok {
+			return unknown("--label must be name=value")
+		}
+	}
+
+	applyConfig(cfg)
+	metrics, err := collectMetrics(false)
+	if err != nil {
+		return unknown("collection failed: %v", err)
+	}
+	if target == "temperature" && metrics.Temperature.CPUCelsius == 0 {
+		return unknown("no CPU temperature sensor (%s)", metrics.Temperature.Status)
+	}
+
+	var samples []metricSample
+	for _, sample := range flattenMetrics(metrics) {
+		if sample.Name == metric && (labelName == "" || sample.Labels[labelName] == labelValue) {
+			samples = append(samples, sample)
+		}
+	}
+	if len(samples) == 0 {
+		return unknown("no series named %s", metric)
+	}
+	sort.Slice(samples, func(i, j int) bool {
+		return seriesKey(samples[i].Name, samples[i].Labels) < seriesKey(samples[j].Name, samples[j].Labels)
+	})
+
+	// The worst series sets the state; the message names every series
+	// that is not OK, or the single series when all are fine
+	state := NAGIOS_OK
+	var problems, perfdata []string
+	for _, sample := range samples {
+		sampleState := nagiosState(sample.Value, warn, crit, below)
+		if sampleState > state {
+			state = sampleState
+		}
+		text := fmt.Sprintf("%s = %s%s", seriesKey(sample.Name, sample.Labels), formatNagiosValue(sample.Value), unit)
+		if sampleState != NAGIOS_OK {
+			problems = append(problems, text+" "+nagiosStates[sampleState])
+		}
+		perfdata = append(perfdata, nagiosPerfdata(sample, unit, warn, crit, below))
+	}
+
+	var message string
+	switch {
+	case len(problems) > 0:
+		message = strings.Join(problems, ", ")
+	case len(samples) == 1:
+		message = fmt.Sprintf("%s = %s%s", seriesKey(samples[0].Name, samples[0].Labels), formatNagiosValue(samples[0].Value), unit)
+	default:
+		message = fmt.Sprintf("%d series of %s within limits", len(samples), metric)
+	}
+	return state, fmt.Sprintf("%s %s - %s | %s", service, nagiosStates[state], message, strings.Join(perfdata, " "))
+}
+
+// nagiosState compares a value with thresholds; a negative threshold is
+// unset.
+func nagiosState(value, warn, crit float64, below bool) int {
+	exceeds := func(limit float64) bool {
+		if limit < 0 {
+			return false
+		}
+		if below {
+			return value < limit
+		}
+		return value >= limit
+	}
+	switch {
+	case exceeds(crit):
+		return NAGIOS_CRITICAL
+	case exceeds(warn):
+		return NAGIOS_WARNING
+	}
+	return NAGIOS_OK
+}
+
+func formatNagiosValue(v float64) string {
+	return strconv.FormatFloat(math.Round(v*100)/100, 'f', -1, 64)
+}
+
+// nagiosPerfdata renders 'label'=value[UOM];warn;crit;min;max, with the
+// label values appended to the metric name. Lower limits use the "x:"
+// range syntax.
+func nagiosPerfdata(sample metricSample, unit string, warn, crit float64, below bool) string {
+	label := sample.Name
+	keys := make([]string, 0, len(sample.Labels))
+	for k := range sample.Labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		label += "_" + sample.Labels[k]
+	}
+	label = strings.ReplaceAll(label, "'", "")
+
+	threshold := func(v float64) string {
+		switch {
+		case v < 0:
+			return ""
+		case below:
+			return formatNagiosValue(v) + ":"
+		}
+		return formatNagiosValue(v)
+	}
+	minMax := ";"
+	if unit == "%" {
+		minMax = "0;100"
+	}
+	return fmt.Sprintf("'%s'=%s%s;%s;%s;%s", label, formatNagiosValue(sample.Value), unit, threshold(warn), threshold(crit), minMax)
+}
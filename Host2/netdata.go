@@ -0,0 +1,169 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"math"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Netdata dimensions are integers; values are sent multiplied by this and
+// divided back by Netdata
+const NETDATA_PRECISION = 1000
+
+var netdataIDInvalid = regexp.MustCompile(`[^A-Za-z0-9_.-]+`)
+
+// netdataUnits guesses chart units from the metric name suffix.
+func netdataUnits(name string) string {
+	for _, suffix := range []struct{ suffix, units string }{
+		{"_percent", "percentage"},
+		{"_celsius", "Celsius"},
+		{"_bytes_per_sec", "bytes/s"},
+		{"_per_sec", "events/s"},
+		{"_bytes", "bytes"},
+		{"_mb", "MiB"},
+		{"_gb", "GiB"},
+		{"_seconds", "seconds"},
+		{"_ms", "milliseconds"},
+	} {
+		if strings.HasSuffix(name, suffix.suffix) {
+			return suffix.units
+		}
+	}
+	return "value"
+}
+
+// netdataDimension names a series within its metric's chart by its label
+// values, or "value" for unlabelled metrics.
+func netdataDimension(labels map[string]string) (id, name string) {
+	if len(labels) == 0 {
+		return "value", "value"
+	}
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	values := make([]string, len(keys))
+	for i, k := range keys {
+		values[i] = labels[k]
+	}
+	return netdataIDInvalid.ReplaceAllString(strings.Join(values, "_"), "_"), strings.ReplaceAll(strings.Join(values, " "), "'", "")
+}
+
+// netdataCommand runs as a Netdata external plugin: Netdata starts it with
+// the update frequency in seconds and reads chart definitions and values
+// from stdout. Each metric is one chart with a dimension per label set.
+func netdataCommand(args []string) error {
+	fs := newFlagSet("netdata")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: host-agent netdata [flags] [update_every]\n\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	updateEvery := 1
+	if fs.NArg() > 0 {
+		n, err := strconv.Atoi(fs.Arg(0))
+		if err != nil || n <= 0 {
+			return fmt.Errorf("update_every must be a positive number of seconds")
+		}
+		updateEvery = n
+	}
+
+	out := bufio.NewWriter(os.Stdout)
+	cfg, err := loadConfig()
+	if err != nil {
+		// Tells Netdata not to restart the plugin
+		fmt.Fprintln(out, "DISABLE")
+		out.Flush()
+		return err
+	}
+	applyConfig(cfg)
+
+	// Dimensions already sent per chart; a chart is redefined whenever a
+	// new series appears
+	defined := map[string]map[string]bool{}
+	interval := time.Duration(updateEvery) * time.Second
+	var last time.Time
+	for {
+		start := time.Now()
+		metrics, err := collectMetrics(true)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "host-agent netdata: %v\n", err)
+		} else {
+			var sinceLast time.Duration
+			if !last.IsZero() {
+				sinceLast = start.Sub(last)
+			}
+			writeNetdataUpdate(out, metrics, defined, updateEvery, sinceLast)
+			last = start
+		}
+		// Netdata closed the pipe, so stop
+		if err := out.Flush(); err != nil {
+			return nil
+		}
+		time.Sleep(interval - time.Since(start)%interval)
+	}
+}
+
+// writeNetdataUpdate sends one round of values; sinceLast is zero on the
+// first round.
+func writeNetdataUpdate(out *bufio.Writer, metrics *SystemMetrics, defined map[string]map[string]bool, updateEvery int, sinceLast time.Duration) {
+	charts := map[string][]metricSample{}
+	for _, sample := range flattenMetrics(metrics) {
+		if !math.IsNaN(sample.Value) && !math.IsInf(sample.Value, 0) {
+			charts[sample.Name] = append(charts[sample.Name], sample)
+		}
+	}
+	names := make([]string, 0, len(charts))
+	for name := range charts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		samples := charts[name]
+		sort.Slice(samples, func(i, j int) bool {
+			return seriesKey(name, samples[i].Labels) < seriesKey(name, samples[j].Labels)
+		})
+		chart := "host_agent." + name
+		dims := defined[chart]
+		changed := dims == nil
+		if dims == nil {
+			dims = map[string]bool{}
+			defined[chart] = dims
+		}
+		for _, sample := range samples {
+			if id, _ := netdataDimension(sample.Labels); !dims[id] {
+				changed = true
+			}
+		}
+
+		if changed {
+			family, _, _ := strings.Cut(name, "_")
+			fmt.Fprintf(out, "CHART %s '' '%s' '%s' '%s' '%s' line 100000 %d\n", chart, name, netdataUnits(name), family, chart, updateEvery)
+			for _, sample := range samples {
+				id, dimName := netdataDimension(sample.Labels)
+				dims[id] = true
+				fmt.Fprintf(out, "DIMENSION %s '%s' absolute 1 %d\n", id, dimName, NETDATA_PRECISION)
+			}
+		}
+
+		if sinceLast == 0 {
+			fmt.Fprintf(out, "BEGIN %s\n", chart)
+		} else {
+			fmt.Fprintf(out, "BEGIN %s %d\n", chart, sinceLast.Microseconds())
+		}
+		for _, sample := range samples {
+			id, _ := netdataDimension(sample.Labels)
+			fmt.Fprintf(out, "SET %s = %d\n", id, int64(math.Round(sample.Value*NETDATA_PRECISION)))
+		}
+		fmt.Fprintln(out, "END")
+	}
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// AlertEvent is delivered to notifiers when an alert starts firing or
+// resolves.
+type AlertEvent struct {
+	Status    string            `json:"status"` // "firing" or "resolved"
+	Alert     Alert             `json:"alert"`
+	Hostname  string            `json:"hostname"`
+	AgentID   string            `json:"agent_id"`
+	Labels    map[string]string `json:"labels"`
+	Timestamp string            `json:"timestamp"`
+}
+
+// notifier delivers alert events to an external system.
+type notifier interface {
+	name() string
+	notify(event AlertEvent) error
+}
+
+var (
+	notifiersMu sync.RWMutex
+	notifiers   []notifier
+	// notifierStop is closed when notifiers are rebuilt, stopping background
+	// goroutines (bot pollers) that belong to the previous set
+	notifierStop = make(chan struct{})
+)
+
+// dispatchAlertEvent fans an event out to every configured notifier in the
+// background so slow receivers never block collection.
+func dispatchAlertEvent(event AlertEvent) {
+	event.Hostname = agentHostname()
+	event.AgentID = agentID()
+	event.Labels = currentConfig().Labels
+	event.Timestamp = time.Now().UTC().Format("2006-01-02T15:04:05Z")
+
+	publishAlertToSinks(event)
+
+	notifiersMu.RLock()
+	defer notifiersMu.RUnlock()
+	for _, n := range notifiers {
+		go func(n notifier) {
+			if err := n.notify(event); err != nil {
+				log.Printf("[NOTIFY] %s failed for %s: %v", n.name(), event.Alert.ID, err)
+			}
+		}(n)
+	}
+}
+
+var notifyHTTPClient = &http.Client{Timeout: 10 * time.Second}
+
+// postJSON sends a JSON body and treats any non-2xx response as an error.
+func postJSON(url string, headers map[string]string, body interface{}) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return fmt.Errorf("failed to marshal body: %v", err)
+	}
+	return postRaw(url, "application/json", headers, data)
+}
+
+func postRaw(url, contentType string, headers map[string]string, data []byte) error {
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := notifyHTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("unexpected status %d: %s", resp.StatusCode, strings.TrimSpace(string(detail)))
+	}
+	return nil
+}
+
+// alertDedupKey identifies an alert across evaluations and hosts, so
+// receivers update a single incident instead of opening duplicates.
+func alertDedupKey(event AlertEvent) string {
+	return event.Hostname + "/" + event.Alert.ID
+}
+
+// initNotifiers builds the notifier list from config.
+func initNotifiers(cfg []NotifierConfig) {
+	notifiersMu.Lock()
+	defer notifiersMu.Unlock()
+
+	close(notifierStop)
+	notifierStop = make(chan struct{})
+	notifiers = nil
+	for _, c := range cfg {
+		switch c.Type {
+		case "pagerduty":
+			notifiers = append(notifiers, &pagerDutyNotifier{cfg: c})
+		case "opsgenie":
+			notifiers = append(notifiers, &opsgenieNotifier{cfg: c})
+		case "telegram":
+			telegram := &telegramNotifier{cfg: c}
+			notifiers = append(notifiers, telegram)
+			if c.Commands {
+				go telegram.pollCommands(notifierStop)
+			}
+		case "webhook":
+			webhook, err := newWebhookNotifier(c)
+			if err != nil {
+				log.Printf("[NOTIFY] Skipping webhook %q: %v", c.Name, err)
+				continue
+			}
+			notifiers = append(notifiers, webhook)
+		}
+		log.Printf("[NOTIFY] Enabled %s notifier %q", c.Type, c.Name)
+	}
+}
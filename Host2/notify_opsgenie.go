@@ -0,0 +1,69 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+const OPSGENIE_API_URL = "https://api.opsgenie.com"
+
+// opsgenieNotifier creates and closes Opsgenie alerts, using the dedup key
+// as the alert alias so repeat notifications update the same alert.
+type opsgenieNotifier struct {
+	cfg NotifierConfig
+}
+
+func (n *opsgenieNotifier) name() string { return "opsgenie:" + n.cfg.Name }
+
+func (n *opsgenieNotifier) notify(event AlertEvent) error {
+	base := n.cfg.URL
+	if base == "" {
+		base = OPSGENIE_API_URL
+	}
+	base = strings.TrimSuffix(base, "/")
+	headers := map[string]string{"Authorization": "GenieKey " + n.cfg.APIKey}
+	alias := alertDedupKey(event)
+
+	if event.Status == "resolved" {
+		closeURL := fmt.Sprintf("%s/v2/alerts/%s/close?identifierType=alias", base, url.PathEscape(alias))
+		return postJSON(closeURL, headers, map[string]string{
+			"source": event.Hostname,
+			"note":   "Resolved by host agent",
+		})
+	}
+
+	message := fmt.Sprintf("[%s] %s", event.Hostname, event.Alert.Message)
+	// Opsgenie rejects messages longer than 130 characters
+	if len(message) > 130 {
+		message = message[:127] + "..."
+	}
+	details := map[string]string{
+		"alert_id": event.Alert.ID,
+		"value":    fmt.Sprintf("%g", event.Alert.Value),
+	}
+	for k, v := range event.Labels {
+		details[k] = v
+	}
+	return postJSON(base+"/v2/alerts", headers, map[string]interface{}{
+		"message":     message,
+		"alias":       alias,
+		"description": event.Alert.Message,
+		"source":      event.Hostname,
+		"priority":    opsgeniePriority(event.Alert.Severity),
+		"tags":        []string{"host-agent", event.Alert.Rule},
+		"details":     details,
+	})
+}
+
+func opsgeniePriority(severity string) string {
+	switch severity {
+	case "critical":
+		return "P1"
+	case "error":
+		return "P2"
+	case "warning":
+		return "P3"
+	}
+	return "P4"
+}
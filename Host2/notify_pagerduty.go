@@ -0,0 +1,52 @@
+package main
+
+import "fmt"
+
+const PAGERDUTY_EVENTS_URL = "https://events.pagerduty.com/v2/enqueue"
+
+// pagerDutyNotifier sends alerts to the PagerDuty Events API v2.
+type pagerDutyNotifier struct {
+	cfg NotifierConfig
+}
+
+func (n *pagerDutyNotifier) name() string { return "pagerduty:" + n.cfg.Name }
+
+func (n *pagerDutyNotifier) notify(event AlertEvent) error {
+	body := map[string]interface{}{
+		"routing_key": n.cfg.RoutingKey,
+		"dedup_key":   alertDedupKey(event),
+	}
+
+	if event.Status == "resolved" {
+		body["event_action"] = "resolve"
+	} else {
+		body["event_action"] = "trigger"
+		body["payload"] = map[string]interface{}{
+			"summary":   fmt.Sprintf("[%s] %s", event.Hostname, event.Alert.Message),
+			"source":    event.Hostname,
+			"severity":  pagerDutySeverity(event.Alert.Severity),
+			"component": event.Alert.Rule,
+			"timestamp": event.Alert.StartedAt,
+			"custom_details": map[string]interface{}{
+				"alert_id": event.Alert.ID,
+				"value":    event.Alert.Value,
+				"labels":   event.Labels,
+			},
+		}
+	}
+
+	url := n.cfg.URL
+	if url == "" {
+		url = PAGERDUTY_EVENTS_URL
+	}
+	return postJSON(url, nil, body)
+}
+
+// pagerDutySeverity maps alert severities onto the four PagerDuty accepts.
+func pagerDutySeverity(severity string) string {
+	switch severity {
+	case "critical", "error", "warning", "info":
+		return severity
+	}
+	return "warning"
+}
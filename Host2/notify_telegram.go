@@ -0,0 +1,165 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const TELEGRAM_API_URL = "https://api.telegram.org"
+
+// telegramNotifier posts alert events to a chat and, when commands are
+// enabled, answers /status and /top queries sent from that chat.
+type telegramNotifier struct {
+	cfg NotifierConfig
+}
+
+func (n *telegramNotifier) name() string { return "telegram:" + n.cfg.Name }
+
+func (n *telegramNotifier) apiURL(method string) string {
+	base := n.cfg.URL
+	if base == "" {
+		base = TELEGRAM_API_URL
+	}
+	return fmt.Sprintf("%s/bot%s/%s", strings.TrimSuffix(base, "/"), n.cfg.BotToken, method)
+}
+
+func (n *telegramNotifier) notify(event AlertEvent) error {
+	icon := "🔥"
+	if event.Status == "resolved" {
+		icon = "✅"
+	}
+	text := fmt.Sprintf("%s %s [%s] %s\n%s", icon, strings.ToUpper(event.Status), event.Alert.Severity, event.Hostname, event.Alert.Message)
+	return n.sendMessage(n.cfg.ChatID, text)
+}
+
+func (n *telegramNotifier) sendMessage(chatID, text string) error {
+	return postJSON(n.apiURL("sendMessage"), nil, map[string]interface{}{
+		"chat_id": chatID,
+		"text":    text,
+	})
+}
+
+type telegramUpdate struct {
+	UpdateID int64 `json:"update_id"`
+	Message  *struct {
+		Text string `json:"text"`
+		Chat struct {
+			ID int64 `json:"id"`
+		} `json:"chat"`
+	} `json:"message"`
+}
+
+// pollCommands long-polls getUpdates and replies to commands until stop is
+// closed. Messages from chats other than the configured one are ignored.
+func (n *telegramNotifier) pollCommands(stop <-chan struct{}) {
+	log.Printf("[TELEGRAM] Listening for bot commands")
+	client := &http.Client{Timeout: 40 * time.Second}
+	var offset int64
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		<-stop
+		cancel()
+	}()
+
+	for ctx.Err() == nil {
+		query := url.Values{"timeout": {"30"}, "offset": {strconv.FormatInt(offset, 10)}}
+		req, _ := http.NewRequestWithContext(ctx, http.MethodGet, n.apiURL("getUpdates")+"?"+query.Encode(), nil)
+		resp, err := client.Do(req)
+		if err != nil {
+			if ctx.Err() == nil {
+				log.Printf("[TELEGRAM] getUpdates failed: %v", err)
+				time.Sleep(10 * time.Second)
+			}
+			continue
+		}
+
+		var body struct {
+			OK     bool             `json:"ok"`
+			Result []telegramUpdate `json:"result"`
+		}
+		err = json.NewDecoder(resp.Body).Decode(&body)
+		resp.Body.Close()
+		if err != nil || !body.OK {
+			log.Printf("[TELEGRAM] Invalid getUpdates response (status %d): %v", resp.StatusCode, err)
+			time.Sleep(10 * time.Second)
+			continue
+		}
+
+		for _, update := range body.Result {
+			offset = update.UpdateID + 1
+			if update.Message == nil || strconv.FormatInt(update.Message.Chat.ID, 10) != n.cfg.ChatID {
+				continue
+			}
+			if reply := telegramCommandReply(update.Message.Text); reply != "" {
+				if err := n.sendMessage(n.cfg.ChatID, reply); err != nil {
+					log.Printf("[TELEGRAM] Reply failed: %v", err)
+				}
+			}
+		}
+	}
+}
+
+func telegramCommandReply(text string) string {
+	fields := strings.Fields(text)
+	if len(fields) == 0 {
+		return ""
+	}
+	// Commands in groups arrive as /status@BotName
+	command, _, _ := strings.Cut(fields[0], "@")
+
+	switch command {
+	case "/status":
+		metrics, err := collectMetricsLimited(nil, false)
+		if err != nil {
+			return fmt.Sprintf("Error collecting metrics: %v", err)
+		}
+		return formatStatusSummary(metrics)
+	case "/top":
+		procs, err := topProcesses(10, time.Second, "cpu")
+		if err != nil {
+			return fmt.Sprintf("Error listing processes: %v", err)
+		}
+		var b strings.Builder
+		b.WriteString("Top processes by CPU:\n")
+		for _, p := range procs {
+			fmt.Fprintf(&b, "%6.1f%% %7.0f MB  %s (%d)\n", p.CPUPercent, p.MemoryMB, p.Name, p.PID)
+		}
+		return b.String()
+	case "/help", "/start":
+		return "Commands:\n/status - CPU, memory, disk and alert summary\n/top - busiest processes"
+	}
+	return ""
+}
+
+// formatStatusSummary renders a short plain-text overview of a snapshot.
+func formatStatusSummary(m *SystemMetrics) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s (%s)\n", m.System.Hostname, m.Platform)
+	fmt.Fprintf(&b, "Uptime: %s\n", (time.Duration(m.System.UptimeSeconds) * time.Second).String())
+	fmt.Fprintf(&b, "CPU: %.1f%%\n", m.CPU.UsagePercent)
+	fmt.Fprintf(&b, "Memory: %.1f%% (%d/%d MB)\n", m.Memory.UsagePercent, m.Memory.UsedMB, m.Memory.TotalMB)
+	if m.Temperature.Status == "ok" {
+		fmt.Fprintf(&b, "CPU temp: %d°C\n", m.Temperature.CPUCelsius)
+	}
+	for _, d := range m.Disk {
+		fmt.Fprintf(&b, "Disk %s: %.1f%% of %.0f GB\n", d.Device, d.UsedPercent, d.TotalGB)
+	}
+	if len(m.Alerts) == 0 {
+		b.WriteString("No active alerts")
+	} else {
+		fmt.Fprintf(&b, "%d active alerts:\n", len(m.Alerts))
+		for _, a := range m.Alerts {
+			fmt.Fprintf(&b, "- [%s] %s\n", a.Severity, a.Message)
+		}
+	}
+	return b.String()
+}
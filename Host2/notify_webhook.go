@@ -0,0 +1,72 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"text/template"
+)
+
+// webhookTemplateFuncs are available inside body templates. json quotes a
+// value so it can be embedded in a JSON document safely.
+var webhookTemplateFuncs = template.FuncMap{
+	"json": func(v interface{}) (string, error) {
+		data, err := json.Marshal(v)
+		return string(data), err
+	},
+	"upper": strings.ToUpper,
+	"lower": strings.ToLower,
+}
+
+// webhookNotifier POSTs alert events to an arbitrary URL. Without a body
+// template the event is sent as JSON.
+type webhookNotifier struct {
+	cfg      NotifierConfig
+	template *template.Template
+}
+
+func newWebhookNotifier(cfg NotifierConfig) (*webhookNotifier, error) {
+	n := &webhookNotifier{cfg: cfg}
+	if cfg.BodyTemplate != "" {
+		tmpl, err := parseWebhookTemplate(cfg.BodyTemplate)
+		if err != nil {
+			return nil, err
+		}
+		n.template = tmpl
+	}
+	return n, nil
+}
+
+func parseWebhookTemplate(text string) (*template.Template, error) {
+	return template.New("body").Funcs(webhookTemplateFuncs).Option("missingkey=error").Parse(text)
+}
+
+func (n *webhookNotifier) name() string { return "webhook:" + n.cfg.Name }
+
+func (n *webhookNotifier) notify(event AlertEvent) error {
+	var body []byte
+	if n.template == nil {
+		data, err := json.Marshal(event)
+		if err != nil {
+			return err
+		}
+		body = data
+	} else {
+		var buf bytes.Buffer
+		if err := n.template.Execute(&buf, event); err != nil {
+			return err
+		}
+		body = buf.Bytes()
+	}
+
+	contentType := "application/json"
+	headers := make(map[string]string, len(n.cfg.Headers))
+	for k, v := range n.cfg.Headers {
+		if strings.EqualFold(k, "Content-Type") {
+			contentType = v
+			continue
+		}
+		headers[k] = v
+	}
+	return postRaw(n.cfg.URL, contentType, headers, body)
+}
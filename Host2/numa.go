@@ -0,0 +1,130 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// NUMAInfo lists the NUMA nodes with their CPUs and memory, which
+// capacity planners on multi-socket servers need per node rather than for
+// the whole host.
+type NUMAInfo struct {
+	Nodes  []NUMANode `json:"nodes"`
+	Status string     `json:"status"`
+}
+
+type NUMANode struct {
+	Node              int     `json:"node"`
+	CPUs              string  `json:"cpus"` // in the kernel's cpulist format, e.g. "0-15,32-47"
+	CPUCount          int     `json:"cpu_count"`
+	MemoryTotalMB     uint64  `json:"memory_total_mb,omitempty"` // Linux
+	MemoryFreeMB      uint64  `json:"memory_free_mb"`
+	MemoryUsedMB      uint64  `json:"memory_used_mb,omitempty"` // Linux
+	MemoryUsedPercent float64 `json:"memory_used_percent,omitempty"`
+	Distances         []int   `json:"distances,omitempty"`     // to every node in order, 10 is local (Linux)
+	LocalAllocs       uint64  `json:"local_allocs,omitempty"`  // pages allocated on this node as intended since boot (Linux)
+	MissedAllocs      uint64  `json:"missed_allocs,omitempty"` // pages intended for this node allocated elsewhere since boot (Linux)
+}
+
+// parseCPUList expands a cpulist such as "0-3,8,10-11".
+func parseCPUList(list string) []int {
+	var cpus []int
+	for _, part := range strings.Split(strings.TrimSpace(list), ",") {
+		first, last, isRange := strings.Cut(part, "-")
+		low, err := strconv.Atoi(first)
+		if err != nil {
+			continue
+		}
+		high := low
+		if isRange {
+			if high, err = strconv.Atoi(last); err != nil {
+				continue
+			}
+		}
+		for cpu := low; cpu <= high; cpu++ {
+			cpus = append(cpus, cpu)
+		}
+	}
+	return cpus
+}
+
+// formatCPUList renders CPU numbers as a cpulist, collapsing runs.
+func formatCPUList(cpus []int) string {
+	sort.Ints(cpus)
+	var parts []string
+	for i := 0; i < len(cpus); {
+		j := i
+		for j+1 < len(cpus) && cpus[j+1] == cpus[j]+1 {
+			j++
+		}
+		if j == i {
+			parts = append(parts, strconv.Itoa(cpus[i]))
+		} else {
+			parts = append(parts, strconv.Itoa(cpus[i])+"-"+strconv.Itoa(cpus[j]))
+		}
+		i = j + 1
+	}
+	return strings.Join(parts, ",")
+}
+
+// collectNUMAInfo reads every node under /sys/devices/system/node on Linux
+// and asks the platform elsewhere. Kernels built with NUMA support show a
+// single node0 on one-socket machines.
+func collectNUMAInfo(trace *sectionTrace) NUMAInfo {
+	if collectorOS != "linux" {
+		return platformNUMAInfo(trace)
+	}
+	info := NUMAInfo{Nodes: []NUMANode{}, Status: "unavailable"}
+	dirs, _ := hostFS.Glob("/sys/devices/system/node/node[0-9]*")
+	for _, dir := range dirs {
+		id, err := strconv.Atoi(strings.TrimPrefix(path.Base(dir), "node"))
+		if err != nil {
+			continue
+		}
+		node := NUMANode{Node: id, CPUs: readTrimmed(dir + "/cpulist")}
+		node.CPUCount = len(parseCPUList(node.CPUs))
+
+		// "Node 0 MemTotal:       6147400 kB"
+		if data, err := hostFS.ReadFile(dir + "/meminfo"); err == nil {
+			for _, line := range strings.Split(string(data), "\n") {
+				fields := strings.Fields(line)
+				if len(fields) < 4 {
+					continue
+				}
+				kb, _ := strconv.ParseUint(fields[3], 10, 64)
+				switch fields[2] {
+				case "MemTotal:":
+					node.MemoryTotalMB = kb / 1024
+				case "MemFree:":
+					node.MemoryFreeMB = kb / 1024
+				case "MemUsed:":
+					node.MemoryUsedMB = kb / 1024
+				}
+			}
+		}
+		if node.MemoryTotalMB > 0 {
+			node.MemoryUsedPercent = math.Round(float64(node.MemoryUsedMB)/float64(node.MemoryTotalMB)*1000) / 10
+		}
+		for _, field := range strings.Fields(readTrimmed(dir + "/distance")) {
+			if distance, err := strconv.Atoi(field); err == nil {
+				node.Distances = append(node.Distances, distance)
+			}
+		}
+		node.LocalAllocs, _ = readStatValue(dir+"/numastat", "numa_hit")
+		node.MissedAllocs, _ = readStatValue(dir+"/numastat", "numa_miss")
+		info.Nodes = append(info.Nodes, node)
+	}
+	sort.Slice(info.Nodes, func(i, j int) bool { return info.Nodes[i].Node < info.Nodes[j].Node })
+
+	if len(info.Nodes) == 0 {
+		trace.fail("sysfs", fmt.Errorf("/sys/devices/system/node not found (kernel without NUMA support)"))
+		return info
+	}
+	trace.ok("sysfs")
+	info.Status = "ok"
+	return info
+}
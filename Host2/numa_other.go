@@ -0,0 +1,8 @@
+//go:build !windows
+
+package main
+
+// platformNUMAInfo is not implemented on this platform.
+func platformNUMAInfo(trace *sectionTrace) NUMAInfo {
+	return NUMAInfo{Nodes: []NUMANode{}, Status: "unavailable"}
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"math/bits"
+	"syscall"
+	"unsafe"
+)
+
+var (
+	kernel32DLL                      = syscall.NewLazyDLL("kernel32.dll")
+	procGetNumaHighestNodeNumber     = kernel32DLL.NewProc("GetNumaHighestNodeNumber")
+	procGetNumaAvailableMemoryNodeEx = kernel32DLL.NewProc("GetNumaAvailableMemoryNodeEx")
+	procGetNumaNodeProcessorMaskEx   = kernel32DLL.NewProc("GetNumaNodeProcessorMaskEx")
+)
+
+// GROUP_AFFINITY
+type groupAffinity struct {
+	Mask     uintptr
+	Group    uint16
+	Reserved [3]uint16
+}
+
+// platformNUMAInfo enumerates the nodes through the NUMA API. Windows
+// reports the available memory of a node but not its size, and the
+// processors of a node in its first processor group only.
+func platformNUMAInfo(trace *sectionTrace) NUMAInfo {
+	info := NUMAInfo{Nodes: []NUMANode{}, Status: "unavailable"}
+	var highest uint32
+	if r, _, err := procGetNumaHighestNodeNumber.Call(uintptr(unsafe.Pointer(&highest))); r == 0 {
+		trace.fail("numa_api", err)
+		return info
+	}
+	for n := uint32(0); n <= highest; n++ {
+		var available uint64
+		if r, _, _ := procGetNumaAvailableMemoryNodeEx.Call(uintptr(n), uintptr(unsafe.Pointer(&available))); r == 0 {
+			continue // node numbers may have gaps
+		}
+		node := NUMANode{Node: int(n), MemoryFreeMB: available / 1024 / 1024}
+		var affinity groupAffinity
+		if r, _, _ := procGetNumaNodeProcessorMaskEx.Call(uintptr(n), uintptr(unsafe.Pointer(&affinity))); r != 0 {
+			var cpus []int
+			for bit := 0; bit < bits.UintSize; bit++ {
+				if affinity.Mask&(uintptr(1)<<bit) != 0 {
+					cpus = append(cpus, int(affinity.Group)*bits.UintSize+bit)
+				}
+			}
+			node.CPUs, node.CPUCount = formatCPUList(cpus), len(cpus)
+		}
+		info.Nodes = append(info.Nodes, node)
+	}
+	trace.ok("numa_api")
+	info.Status = "ok"
+	return info
+}
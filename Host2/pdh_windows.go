@@ -0,0 +1,156 @@
+package main
+
+import (
+	"fmt"
+	"syscall"
+	"unsafe"
+)
+
+const (
+	pdhFmtDouble        = 0x00000200
+	pdhCstatusValidData = 0x00000000
+	pdhCstatusNewData   = 0x00000001
+	pdhMoreData         = 0x800007D2
+)
+
+var (
+	pdhDLL                          = syscall.NewLazyDLL("pdh.dll")
+	procPdhOpenQueryW               = pdhDLL.NewProc("PdhOpenQueryW")
+	procPdhAddEnglishCounterW       = pdhDLL.NewProc("PdhAddEnglishCounterW")
+	procPdhCollectQueryData         = pdhDLL.NewProc("PdhCollectQueryData")
+	procPdhGetFormattedCounterValue = pdhDLL.NewProc("PdhGetFormattedCounterValue")
+	procPdhGetFormattedCounterArray = pdhDLL.NewProc("PdhGetFormattedCounterArrayW")
+	procPdhCloseQuery               = pdhDLL.NewProc("PdhCloseQuery")
+)
+
+// pdhFmtCounterValueDouble mirrors PDH_FMT_COUNTERVALUE for PDH_FMT_DOUBLE.
+type pdhFmtCounterValueDouble struct {
+	CStatus     uint32
+	_           uint32
+	DoubleValue float64
+}
+
+// pdhFmtCounterValueItemDouble mirrors PDH_FMT_COUNTERVALUE_ITEM_W, one
+// instance of a wildcard counter.
+type pdhFmtCounterValueItemDouble struct {
+	Name  *uint16
+	Value pdhFmtCounterValueDouble
+}
+
+// pdhQuery wraps a PDH query handle and the counters registered on it.
+// Rate counters need two collections, so queries are kept open between samples.
+type pdhQuery struct {
+	handle   uintptr
+	counters map[string]uintptr
+}
+
+func newPDHQuery(paths []string) (*pdhQuery, error) {
+	if err := pdhDLL.Load(); err != nil {
+		return nil, fmt.Errorf("failed to load pdh.dll: %v", err)
+	}
+
+	q := &pdhQuery{counters: make(map[string]uintptr)}
+	if ret, _, _ := procPdhOpenQueryW.Call(0, 0, uintptr(unsafe.Pointer(&q.handle))); ret != 0 {
+		return nil, fmt.Errorf("PdhOpenQuery failed: 0x%x", ret)
+	}
+
+	for _, path := range paths {
+		if err := q.add(path); err != nil {
+			q.close()
+			return nil, err
+		}
+	}
+
+	// Prime the query so rate counters have a baseline
+	procPdhCollectQueryData.Call(q.handle)
+	return q, nil
+}
+
+// add registers one more counter path on the query.
+func (q *pdhQuery) add(path string) error {
+	pathPtr, err := syscall.UTF16PtrFromString(path)
+	if err != nil {
+		return err
+	}
+	var counter uintptr
+	ret, _, _ := procPdhAddEnglishCounterW.Call(q.handle, uintptr(unsafe.Pointer(pathPtr)), 0, uintptr(unsafe.Pointer(&counter)))
+	if ret != 0 {
+		return fmt.Errorf("PdhAddEnglishCounter(%s) failed: 0x%x", path, ret)
+	}
+	q.counters[path] = counter
+	return nil
+}
+
+// collect samples all counters and returns their values keyed by path.
+// Counters without valid data are omitted.
+func (q *pdhQuery) collect() (map[string]float64, error) {
+	if ret, _, _ := procPdhCollectQueryData.Call(q.handle); ret != 0 {
+		return nil, fmt.Errorf("PdhCollectQueryData failed: 0x%x", ret)
+	}
+
+	values := make(map[string]float64, len(q.counters))
+	for path, counter := range q.counters {
+		var value pdhFmtCounterValueDouble
+		ret, _, _ := procPdhGetFormattedCounterValue.Call(counter, pdhFmtDouble, 0, uintptr(unsafe.Pointer(&value)))
+		if ret != 0 {
+			continue
+		}
+		if value.CStatus == pdhCstatusValidData || value.CStatus == pdhCstatusNewData {
+			values[path] = value.DoubleValue
+		}
+	}
+	return values, nil
+}
+
+func (q *pdhQuery) close() {
+	if q.handle != 0 {
+		procPdhCloseQuery.Call(q.handle)
+		q.handle = 0
+	}
+}
+
+// collectInstances samples all counters and returns, per path, the value of
+// every instance a wildcard path such as \PhysicalDisk(*)\% Disk Time
+// expands to; paths without instances report a single "" entry.
+func (q *pdhQuery) collectInstances() (map[string]map[string]float64, error) {
+	if ret, _, _ := procPdhCollectQueryData.Call(q.handle); ret != 0 {
+		return nil, fmt.Errorf("PdhCollectQueryData failed: 0x%x", ret)
+	}
+
+	values := make(map[string]map[string]float64, len(q.counters))
+	for path, counter := range q.counters {
+		var size, count uint32
+		ret, _, _ := procPdhGetFormattedCounterArray.Call(counter, pdhFmtDouble, uintptr(unsafe.Pointer(&size)), uintptr(unsafe.Pointer(&count)), 0)
+		if ret != pdhMoreData || size == 0 {
+			continue
+		}
+		buf := make([]byte, size)
+		ret, _, _ = procPdhGetFormattedCounterArray.Call(counter, pdhFmtDouble, uintptr(unsafe.Pointer(&size)), uintptr(unsafe.Pointer(&count)), uintptr(unsafe.Pointer(&buf[0])))
+		if ret != 0 {
+			continue
+		}
+
+		items := unsafe.Slice((*pdhFmtCounterValueItemDouble)(unsafe.Pointer(&buf[0])), count)
+		instances := make(map[string]float64, count)
+		for _, item := range items {
+			if item.Value.CStatus != pdhCstatusValidData && item.Value.CStatus != pdhCstatusNewData {
+				continue
+			}
+			instances[utf16PtrToString(item.Name)] = item.Value.DoubleValue
+		}
+		values[path] = instances
+	}
+	return values, nil
+}
+
+// utf16PtrToString reads a NUL-terminated UTF-16 string.
+func utf16PtrToString(p *uint16) string {
+	if p == nil {
+		return ""
+	}
+	var chars []uint16
+	for ptr := unsafe.Pointer(p); *(*uint16)(ptr) != 0; ptr = unsafe.Add(ptr, 2) {
+		chars = append(chars, *(*uint16)(ptr))
+	}
+	return syscall.UTF16ToString(chars)
+}
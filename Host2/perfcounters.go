@@ -0,0 +1,16 @@
+package main
+
+// PerfCountersInfo holds the configured Windows performance counters.
+type PerfCountersInfo struct {
+	Counters []PerfCounterValue `json:"counters"`
+	Status   string             `json:"status"`
+}
+
+// PerfCounterValue is one counter, or one instance of a wildcard counter.
+type PerfCounterValue struct {
+	Name     string  `json:"name"`
+	Path     string  `json:"path"`
+	Instance string  `json:"instance,omitempty"`
+	Value    float64 `json:"value"`
+	Error    string  `json:"error,omitempty"`
+}
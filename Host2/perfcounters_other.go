@@ -0,0 +1,8 @@
+//go:build !windows
+
+package main
+
+// collectPerfCounters is Windows only.
+func collectPerfCounters() PerfCountersInfo {
+	return PerfCountersInfo{Counters: []PerfCounterValue{}, Status: "unavailable"}
+}
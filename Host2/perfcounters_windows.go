@@ -0,0 +1,85 @@
+package main
+
+import (
+	"log"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// The open query for perf_counters, rebuilt when the configured paths change
+var perfCounters = struct {
+	sync.Mutex
+	key    string
+	query  *pdhQuery
+	errors map[string]string
+}{}
+
+// collectPerfCounters samples every configured counter path. Paths that
+// PDH rejects are reported with their error instead of failing the rest.
+func collectPerfCounters() PerfCountersInfo {
+	configured := currentConfig().PerfCounters
+	info := PerfCountersInfo{Counters: []PerfCounterValue{}, Status: "unavailable"}
+
+	var paths []string
+	for _, counter := range configured {
+		paths = append(paths, counter.Path)
+	}
+	key := strings.Join(paths, "\n")
+
+	perfCounters.Lock()
+	defer perfCounters.Unlock()
+
+	if perfCounters.query == nil || perfCounters.key != key {
+		if perfCounters.query != nil {
+			perfCounters.query.close()
+			perfCounters.query = nil
+		}
+		query, err := newPDHQuery(nil)
+		if err != nil {
+			log.Printf("[PERF] Error opening performance counters: %v", err)
+			return info
+		}
+		perfCounters.errors = make(map[string]string)
+		for _, path := range paths {
+			if err := query.add(path); err != nil {
+				log.Printf("[PERF] %v", err)
+				perfCounters.errors[path] = err.Error()
+			}
+		}
+		// Baseline for rate counters; values follow on the next collection
+		procPdhCollectQueryData.Call(query.handle)
+		perfCounters.query, perfCounters.key = query, key
+		info.Status = "initializing"
+		return info
+	}
+
+	values, err := perfCounters.query.collectInstances()
+	if err != nil {
+		log.Printf("[PERF] Error collecting performance counters: %v", err)
+		return info
+	}
+
+	for _, counter := range configured {
+		if msg, failed := perfCounters.errors[counter.Path]; failed {
+			info.Counters = append(info.Counters, PerfCounterValue{Name: counter.Name, Path: counter.Path, Error: msg})
+			continue
+		}
+		instances := values[counter.Path]
+		names := make([]string, 0, len(instances))
+		for instance := range instances {
+			names = append(names, instance)
+		}
+		sort.Strings(names)
+		for _, instance := range names {
+			info.Counters = append(info.Counters, PerfCounterValue{
+				Name:     counter.Name,
+				Path:     counter.Path,
+				Instance: instance,
+				Value:    instances[instance] * counter.Scale,
+			})
+		}
+	}
+	info.Status = "ok"
+	return info
+}
@@ -0,0 +1,257 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os/exec"
+	"time"
+)
+
+// Version string a daemon plugin must send in its handshake
+const PLUGIN_PROTOCOL = "host-agent-plugin/1"
+
+// Consecutive collect timeouts after which a daemon plugin is restarted
+const PLUGIN_MAX_TIMEOUTS = 3
+
+var errPluginExited = errors.New("plugin exited")
+
+// pluginMessage is one line of the stdio protocol. The plugin opens with
+// {"protocol": ...}; the agent sends {"method": "collect", "id": n} and
+// the plugin answers {"id": n, "data": {...}} or {"id": n, "error": "..."}.
+// {"method": "shutdown"} asks it to exit before stdin is closed.
+type pluginMessage struct {
+	Protocol string                 `json:"protocol,omitempty"`
+	Name     string                 `json:"name,omitempty"`
+	Version  string                 `json:"version,omitempty"`
+	Method   string                 `json:"method,omitempty"`
+	ID       int                    `json:"id,omitempty"`
+	Data     map[string]interface{} `json:"data,omitempty"`
+	Error    string                 `json:"error,omitempty"`
+}
+
+// daemonPlugin is one running long-lived plugin process.
+type daemonPlugin struct {
+	cfg    ExecPluginConfig
+	cancel context.CancelFunc
+	stdin  io.WriteCloser
+	lines  chan []byte
+	exited chan struct{}
+	seq    int
+}
+
+// startDaemon launches the plugin with the same sandbox as one-shot exec
+// plugins and waits for its handshake.
+func startDaemon(cfg ExecPluginConfig) (*daemonPlugin, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cmd := exec.CommandContext(ctx, cfg.Command[0], cfg.Command[1:]...)
+	cmd.Dir = cfg.Dir
+	cmd.Env = execEnv(cfg.Env)
+	if err := sandboxCommand(cmd, cfg); err != nil {
+		cancel()
+		return nil, err
+	}
+	cmd.WaitDelay = time.Second
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		cancel()
+		return nil, err
+	}
+
+	d := &daemonPlugin{cfg: cfg, cancel: cancel, stdin: stdin, lines: make(chan []byte, 16), exited: make(chan struct{})}
+	go func() {
+		scanner := bufio.NewScanner(stdout)
+		scanner.Buffer(make([]byte, 64*1024), EXEC_MAX_OUTPUT)
+		for scanner.Scan() {
+			d.lines <- append([]byte{}, scanner.Bytes()...)
+		}
+		close(d.lines)
+	}()
+	go func() {
+		// Plugins report their own problems on stderr
+		scanner := bufio.NewScanner(stderr)
+		for scanner.Scan() {
+			log.Printf("[PLUGIN] %s: %s", cfg.Name, scanner.Text())
+		}
+	}()
+	go func() {
+		cmd.Wait()
+		close(d.exited)
+	}()
+
+	var hello pluginMessage
+	if err := d.read(&hello, time.Duration(cfg.TimeoutMs)*time.Millisecond); err != nil {
+		d.kill()
+		return nil, fmt.Errorf("handshake: %v", err)
+	}
+	if hello.Protocol != PLUGIN_PROTOCOL {
+		d.kill()
+		return nil, fmt.Errorf("handshake: unsupported protocol %q, want %q", hello.Protocol, PLUGIN_PROTOCOL)
+	}
+	log.Printf("[PLUGIN] Started %s (%s %s, pid %d)", cfg.Name, hello.Name, hello.Version, cmd.Process.Pid)
+	return d, nil
+}
+
+// read decodes the next stdout line into msg.
+func (d *daemonPlugin) read(msg *pluginMessage, timeout time.Duration) error {
+	select {
+	case line, ok := <-d.lines:
+		if !ok {
+			return errPluginExited
+		}
+		if err := json.Unmarshal(line, msg); err != nil {
+			return fmt.Errorf("invalid message %q: %v", line, err)
+		}
+		return nil
+	case <-time.After(timeout):
+		return errProbeTimeout
+	}
+}
+
+func (d *daemonPlugin) send(msg pluginMessage) error {
+	line, _ := json.Marshal(msg)
+	if _, err := d.stdin.Write(append(line, '\n')); err != nil {
+		return errPluginExited
+	}
+	return nil
+}
+
+// collect asks for one sample. Late answers to earlier requests that timed
+// out are skipped.
+func (d *daemonPlugin) collect(timeout time.Duration) (map[string]interface{}, error) {
+	d.seq++
+	if err := d.send(pluginMessage{Method: "collect", ID: d.seq}); err != nil {
+		return nil, err
+	}
+	deadline := time.Now().Add(timeout)
+	for {
+		var reply pluginMessage
+		if err := d.read(&reply, time.Until(deadline)); err != nil {
+			return nil, err
+		}
+		if reply.ID != d.seq {
+			continue
+		}
+		if reply.Error != "" {
+			return nil, errors.New(reply.Error)
+		}
+		if reply.Data == nil {
+			reply.Data = map[string]interface{}{}
+		}
+		return reply.Data, nil
+	}
+}
+
+// stop asks the plugin to exit and kills its process group if it has not
+// done so within a second.
+func (d *daemonPlugin) stop() {
+	d.send(pluginMessage{Method: "shutdown"})
+	d.stdin.Close()
+	select {
+	case <-d.exited:
+	case <-time.After(time.Second):
+	}
+	d.kill()
+}
+
+func (d *daemonPlugin) kill() {
+	d.cancel()
+	<-d.exited
+}
+
+// runDaemonLoop keeps a daemon plugin running, collecting from it every
+// interval. A crashed or unresponsive plugin is restarted with exponential
+// backoff; the agent itself is never affected.
+func runDaemonLoop(cfg ExecPluginConfig, stop <-chan struct{}) {
+	interval := time.Duration(cfg.IntervalSeconds) * time.Second
+	timeout := time.Duration(cfg.TimeoutMs) * time.Millisecond
+	backoff := time.Second
+
+	for {
+		d, err := startDaemon(cfg)
+		if err != nil {
+			log.Printf("[PLUGIN] %s: %v, retrying in %v", cfg.Name, err, backoff)
+			storeExecResult(cfg.Name, ExecResult{
+				Data:    map[string]interface{}{},
+				LastRun: time.Now().UTC().Format("2006-01-02T15:04:05Z"),
+				Status:  "error",
+				Error:   err.Error(),
+			}, stop)
+			select {
+			case <-time.After(backoff):
+			case <-stop:
+				return
+			}
+			if backoff *= 2; backoff > time.Minute {
+				backoff = time.Minute
+			}
+			continue
+		}
+
+		timeouts := 0
+		for restart := false; !restart; {
+			start := time.Now()
+			result := ExecResult{Data: map[string]interface{}{}, LastRun: start.UTC().Format("2006-01-02T15:04:05Z"), Status: "ok"}
+			data, err := d.collect(timeout)
+			result.DurationMs = float64(time.Since(start).Microseconds()) / 1000
+			switch {
+			case err == nil:
+				result.Data = data
+				timeouts, backoff = 0, time.Second
+			case err == errProbeTimeout:
+				result.Status = "timeout"
+				result.Error = fmt.Sprintf("no answer within %d ms", cfg.TimeoutMs)
+				timeouts++
+				restart = timeouts >= PLUGIN_MAX_TIMEOUTS
+			case err == errPluginExited:
+				result.Status = "error"
+				result.Error = "plugin exited"
+				restart = true
+			default:
+				result.Status = "error"
+				result.Error = err.Error()
+			}
+			storeExecResult(cfg.Name, result, stop)
+
+			if restart {
+				log.Printf("[PLUGIN] %s: %s, restarting in %v", cfg.Name, result.Error, backoff)
+				d.kill()
+				select {
+				case <-time.After(backoff):
+				case <-stop:
+					return
+				}
+				if backoff *= 2; backoff > time.Minute {
+					backoff = time.Minute
+				}
+				break
+			}
+
+			select {
+			case <-time.After(interval):
+			case <-stop:
+				d.stop()
+				return
+			}
+		}
+	}
+}
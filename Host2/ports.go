@@ -0,0 +1,119 @@
+package main
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/shirou/gopsutil/v3/net"
+	"github.com/shirou/gopsutil/v3/process"
+)
+
+// ListeningPort is one socket accepting connections (TCP) or datagrams
+// (UDP). PID and process are empty when the agent may not inspect the
+// owner, e.g. sockets of other users without root.
+type ListeningPort struct {
+	Protocol string `json:"protocol"` // "tcp", "tcp6", "udp" or "udp6"
+	Address  string `json:"address"`
+	Port     uint32 `json:"port"`
+	PID      int32  `json:"pid,omitempty"`
+	Process  string `json:"process,omitempty"`
+}
+
+// listeningPorts returns listening TCP sockets and unconnected UDP
+// sockets, ordered by port. A socket shared by forked workers is listed
+// once per process.
+func listeningPorts() ([]ListeningPort, error) {
+	conns, err := net.Connections("inet")
+	if err != nil {
+		return nil, err
+	}
+
+	names := map[int32]string{}
+	seen := map[ListeningPort]bool{}
+	ports := []ListeningPort{}
+	for _, conn := range conns {
+		var protocol string
+		switch conn.Type {
+		case syscall.SOCK_STREAM:
+			if conn.Status != "LISTEN" {
+				continue
+			}
+			protocol = "tcp"
+		case syscall.SOCK_DGRAM:
+			if conn.Raddr.Port != 0 {
+				continue
+			}
+			protocol = "udp"
+		default:
+			continue
+		}
+		if conn.Family == syscall.AF_INET6 {
+			protocol += "6"
+		}
+
+		port := ListeningPort{Protocol: protocol, Address: conn.Laddr.IP, Port: conn.Laddr.Port, PID: conn.Pid}
+		if port.PID > 0 {
+			name, ok := names[port.PID]
+			if !ok {
+				if p, err := process.NewProcess(port.PID); err == nil {
+					name, _ = p.Name()
+				}
+				names[port.PID] = name
+			}
+			port.Process = name
+		}
+		if !seen[port] {
+			seen[port] = true
+			ports = append(ports, port)
+		}
+	}
+
+	sort.Slice(ports, func(i, j int) bool {
+		a, b := ports[i], ports[j]
+		if a.Port != b.Port {
+			return a.Port < b.Port
+		}
+		if a.Protocol != b.Protocol {
+			return a.Protocol < b.Protocol
+		}
+		if a.Address != b.Address {
+			return a.Address < b.Address
+		}
+		return a.PID < b.PID
+	})
+	return ports, nil
+}
+
+// portsHandler lists listening sockets, optionally only one protocol
+// family (?protocol=tcp or udp, covering IPv4 and IPv6).
+func portsHandler(w http.ResponseWriter, r *http.Request) {
+	filter := r.URL.Query().Get("protocol")
+	if filter != "" && filter != "tcp" && filter != "udp" {
+		http.Error(w, "protocol must be tcp or udp", http.StatusBadRequest)
+		return
+	}
+
+	ports, err := listeningPorts()
+	if err != nil {
+		http.Error(w, "Failed to list sockets: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if filter != "" {
+		kept := ports[:0]
+		for _, port := range ports {
+			if strings.HasPrefix(port.Protocol, filter) {
+				kept = append(kept, port)
+			}
+		}
+		ports = kept
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"count":     len(ports),
+		"ports":     ports,
+		"timestamp": time.Now().UTC().Format(time.RFC3339),
+	})
+}
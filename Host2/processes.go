@@ -0,0 +1,192 @@
+package main
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/shirou/gopsutil/v3/net"
+	"github.com/shirou/gopsutil/v3/process"
+)
+
+type ProcessInfo struct {
+	PID              int32   `json:"pid"`
+	Name             string  `json:"name"`
+	Username         string  `json:"username"`
+	CPUPercent       float64 `json:"cpu_percent"`
+	MemoryMB         float64 `json:"memory_mb"`
+	ReadBytesPerSec  float64 `json:"read_bytes_per_sec"`
+	WriteBytesPerSec float64 `json:"write_bytes_per_sec"`
+	ReadBytes        uint64  `json:"read_bytes"`  // since process start
+	WriteBytes       uint64  `json:"write_bytes"` // since process start
+	Connections      int     `json:"connections"` // open TCP/UDP sockets
+
+	// With processes.ebpf: TCP and UDP payload and bios submitted to
+	// block devices, including direct I/O the page cache counters above miss
+	NetSentBytesPerSec    *float64 `json:"net_sent_bytes_per_sec,omitempty"`
+	NetRecvBytesPerSec    *float64 `json:"net_recv_bytes_per_sec,omitempty"`
+	BlockReadBytesPerSec  *float64 `json:"block_read_bytes_per_sec,omitempty"`
+	BlockWriteBytesPerSec *float64 `json:"block_write_bytes_per_sec,omitempty"`
+}
+
+// processIO holds the cumulative byte counts the eBPF programs attribute to
+// one process.
+type processIO struct {
+	NetSent, NetRecv      uint64
+	BlockRead, BlockWrite uint64
+}
+
+// Orderings accepted by topProcesses
+var processSortKeys = []string{"cpu", "memory", "io", "net"}
+
+// topProcesses samples CPU time and I/O counters of every process twice,
+// interval apart, and returns the n busiest by sortBy ("cpu", "memory" or
+// "io", read plus write rate, or "net", sent plus received rate with eBPF).
+// CPU percent is relative to a single core, as in top. I/O of other users'
+// processes needs root on Linux.
+func topProcesses(n int, interval time.Duration, sortBy string) ([]ProcessInfo, error) {
+	procs, err := process.Processes()
+	if err != nil {
+		return nil, err
+	}
+
+	before := make(map[int32]float64, len(procs))
+	beforeIO := make(map[int32]*process.IOCountersStat, len(procs))
+	for _, p := range procs {
+		if times, err := p.Times(); err == nil {
+			before[p.Pid] = times.User + times.System
+		}
+		if io, err := p.IOCounters(); err == nil {
+			beforeIO[p.Pid] = io
+		}
+	}
+	beforeEBPF, _ := processIOCounters()
+	start := time.Now()
+	time.Sleep(interval)
+	elapsed := time.Since(start).Seconds()
+	afterEBPF, network := processIOCounters()
+
+	var result []ProcessInfo
+	for _, p := range procs {
+		startCPU, ok := before[p.Pid]
+		if !ok {
+			continue
+		}
+		times, err := p.Times()
+		if err != nil {
+			continue
+		}
+
+		info := ProcessInfo{
+			PID:        p.Pid,
+			CPUPercent: (times.User + times.System - startCPU) / elapsed * 100,
+		}
+		info.Name, _ = p.Name()
+		info.Username, _ = p.Username()
+		if mem, err := p.MemoryInfo(); err == nil {
+			info.MemoryMB = float64(mem.RSS) / 1024 / 1024
+		}
+		if io, err := p.IOCounters(); err == nil {
+			info.ReadBytes, info.WriteBytes = io.ReadBytes, io.WriteBytes
+			if prev, ok := beforeIO[p.Pid]; ok {
+				info.ReadBytesPerSec = counterRate(io.ReadBytes, prev.ReadBytes, elapsed)
+				info.WriteBytesPerSec = counterRate(io.WriteBytes, prev.WriteBytes, elapsed)
+			}
+		}
+		if afterEBPF != nil {
+			// A process first seen during the interval started from zero
+			now, prev := afterEBPF[p.Pid], beforeEBPF[p.Pid]
+			rate := func(current, previous uint64) *float64 {
+				value := counterRate(current, previous, elapsed)
+				return &value
+			}
+			if network {
+				info.NetSentBytesPerSec = rate(now.NetSent, prev.NetSent)
+				info.NetRecvBytesPerSec = rate(now.NetRecv, prev.NetRecv)
+			}
+			info.BlockReadBytesPerSec = rate(now.BlockRead, prev.BlockRead)
+			info.BlockWriteBytesPerSec = rate(now.BlockWrite, prev.BlockWrite)
+		}
+		result = append(result, info)
+	}
+
+	rank := func(p ProcessInfo) float64 { return p.CPUPercent }
+	switch sortBy {
+	case "memory":
+		rank = func(p ProcessInfo) float64 { return p.MemoryMB }
+	case "io":
+		rank = func(p ProcessInfo) float64 { return p.ReadBytesPerSec + p.WriteBytesPerSec }
+	case "net":
+		rank = func(p ProcessInfo) float64 {
+			if p.NetSentBytesPerSec == nil {
+				return 0
+			}
+			return *p.NetSentBytesPerSec + *p.NetRecvBytesPerSec
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if a, b := rank(result[i]), rank(result[j]); a != b {
+			return a > b
+		}
+		return result[i].MemoryMB > result[j].MemoryMB
+	})
+	if len(result) > n {
+		result = result[:n]
+	}
+
+	// One pass over the socket tables instead of walking each process's fds
+	if conns, err := net.Connections("inet"); err == nil {
+		counts := make(map[int32]int)
+		for _, conn := range conns {
+			counts[conn.Pid]++
+		}
+		for i := range result {
+			result[i].Connections = counts[result[i].PID]
+		}
+	}
+	return result, nil
+}
+
+// processesHandler lists the busiest processes (?sort=cpu|memory|io|net,
+// ?limit=, default 10).
+func processesHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	sortBy := query.Get("sort")
+	if sortBy == "" {
+		sortBy = "cpu"
+	}
+	valid := false
+	for _, key := range processSortKeys {
+		valid = valid || sortBy == key
+	}
+	if !valid {
+		http.Error(w, "sort must be cpu, memory, io or net", http.StatusBadRequest)
+		return
+	}
+	limit := 10
+	if v := query.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			http.Error(w, "limit must be a positive integer", http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+
+	procs, err := topProcesses(limit, time.Second, sortBy)
+	if err != nil {
+		http.Error(w, "Failed to list processes: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	response := map[string]interface{}{
+		"sort":      sortBy,
+		"count":     len(procs),
+		"processes": procs,
+		"timestamp": time.Now().UTC().Format(time.RFC3339),
+	}
+	if status := ebpfStatus(); status != "" {
+		response["ebpf"] = status
+	}
+	writeJSON(w, http.StatusOK, response)
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/shirou/gopsutil/v3/process"
+)
+
+// WatchedProcess reports one process_watch entry. PID and uptime belong to
+// the oldest matching process, usually the parent of any workers; CPU and
+// memory are summed over all matches.
+type WatchedProcess struct {
+	Name          string  `json:"name"`
+	Running       bool    `json:"running"`
+	Count         int     `json:"count"`
+	PID           int32   `json:"pid,omitempty"`
+	UptimeSeconds uint64  `json:"uptime_seconds"`
+	CPUPercent    float64 `json:"cpu_percent"`
+	MemoryMB      float64 `json:"memory_mb"`
+	Restarts      int     `json:"restarts"` // since the agent started
+	LastRestart   string  `json:"last_restart,omitempty"`
+	Status        string  `json:"status"` // "ok", "missing" or "restarted"
+}
+
+// watchState remembers the previous sample of one entry, to detect
+// restarts and compute CPU between samples.
+type watchState struct {
+	pid      int32
+	created  int64
+	cpu      map[int32]float64
+	at       time.Time
+	restarts int
+	last     string
+}
+
+var processWatch = struct {
+	sync.Mutex
+	state map[string]*watchState
+	// restart counts already alerted on, per entry
+	alerted map[string]int
+}{state: make(map[string]*watchState), alerted: make(map[string]int)}
+
+type matchedProcess struct {
+	proc    *process.Process
+	created int64
+}
+
+// collectProcessWatch matches every configured entry against the process
+// table. A changed PID of the oldest match between two samples counts as a
+// restart.
+func collectProcessWatch() []WatchedProcess {
+	entries := currentConfig().ProcessWatch
+	results := []WatchedProcess{}
+	if len(entries) == 0 {
+		return results
+	}
+
+	procs, err := process.Processes()
+	if err != nil {
+		log.Printf("[PROCWATCH] Error listing processes: %v", err)
+		return results
+	}
+
+	// Names and command lines are read at most once per process
+	names := make(map[int32]string, len(procs))
+	cmdlines := make(map[int32]string)
+	now := time.Now()
+
+	processWatch.Lock()
+	defer processWatch.Unlock()
+
+	seen := make(map[string]bool, len(entries))
+	for _, entry := range entries {
+		pattern := regexp.MustCompile(entry.Pattern)
+		var matches []matchedProcess
+		for _, p := range procs {
+			var subject string
+			if entry.Cmdline {
+				line, ok := cmdlines[p.Pid]
+				if !ok {
+					line, _ = p.Cmdline()
+					cmdlines[p.Pid] = line
+				}
+				subject = line
+			} else {
+				name, ok := names[p.Pid]
+				if !ok {
+					name, _ = p.Name()
+					names[p.Pid] = name
+				}
+				subject = name
+			}
+			if subject == "" || !pattern.MatchString(subject) {
+				continue
+			}
+			created, _ := p.CreateTime()
+			matches = append(matches, matchedProcess{proc: p, created: created})
+		}
+		sort.Slice(matches, func(i, j int) bool { return matches[i].created < matches[j].created })
+
+		seen[entry.Name] = true
+		state, ok := processWatch.state[entry.Name]
+		if !ok {
+			state = &watchState{}
+			processWatch.state[entry.Name] = state
+		}
+
+		result := WatchedProcess{Name: entry.Name, Count: len(matches), Running: len(matches) >= entry.MinCount, Status: "ok"}
+		cpuTimes := make(map[int32]float64, len(matches))
+		elapsed := now.Sub(state.at).Seconds()
+		for _, m := range matches {
+			if times, err := m.proc.Times(); err == nil {
+				cpuTimes[m.proc.Pid] = times.User + times.System
+				if previous, ok := state.cpu[m.proc.Pid]; ok && elapsed > 0 && cpuTimes[m.proc.Pid] >= previous {
+					result.CPUPercent += (cpuTimes[m.proc.Pid] - previous) / elapsed * 100
+				}
+			}
+			if mem, err := m.proc.MemoryInfo(); err == nil {
+				result.MemoryMB += float64(mem.RSS) / 1024 / 1024
+			}
+		}
+
+		if len(matches) > 0 {
+			oldest := matches[0]
+			result.PID = oldest.proc.Pid
+			result.UptimeSeconds = uint64(now.Sub(time.UnixMilli(oldest.created)).Seconds())
+			if state.pid != 0 && (state.pid != oldest.proc.Pid || state.created != oldest.created) {
+				state.restarts++
+				state.last = now.UTC().Format("2006-01-02T15:04:05Z")
+				result.Status = "restarted"
+				log.Printf("[PROCWATCH] %s restarted (pid %d -> %d)", entry.Name, state.pid, oldest.proc.Pid)
+			}
+			state.pid, state.created = oldest.proc.Pid, oldest.created
+		} else {
+			// A process that comes back after being missing is a start,
+			// not a restart; the missing alert already covered the gap
+			state.pid, state.created = 0, 0
+		}
+		if !result.Running {
+			result.Status = "missing"
+		}
+		state.cpu, state.at = cpuTimes, now
+		result.Restarts, result.LastRestart = state.restarts, state.last
+		results = append(results, result)
+	}
+
+	// Forget entries removed from the config
+	for name := range processWatch.state {
+		if !seen[name] {
+			delete(processWatch.state, name)
+			delete(processWatch.alerted, name)
+		}
+	}
+	return results
+}
+
+// processWatchAlerts raises a missing alert per entry while too few
+// processes match, and a restart alert for one evaluation after each
+// restart, even when the restart was seen by an on-demand collection.
+func processWatchAlerts(watched []WatchedProcess) []Alert {
+	severities := make(map[string]string)
+	for _, entry := range currentConfig().ProcessWatch {
+		severities[entry.Name] = entry.Severity
+	}
+
+	processWatch.Lock()
+	defer processWatch.Unlock()
+
+	var firing []Alert
+	for _, w := range watched {
+		if !w.Running {
+			firing = append(firing, Alert{
+				ID:       "process:missing:" + w.Name,
+				Rule:     "process_watch",
+				Severity: severities[w.Name],
+				Message:  fmt.Sprintf("%s is not running (%d matching processes)", w.Name, w.Count),
+				Value:    float64(w.Count),
+			})
+		}
+		if w.Restarts > processWatch.alerted[w.Name] {
+			processWatch.alerted[w.Name] = w.Restarts
+			firing = append(firing, Alert{
+				ID:       "process:restarted:" + w.Name,
+				Rule:     "process_watch",
+				Severity: "warning",
+				Message:  fmt.Sprintf("%s restarted at %s, now pid %d (restart #%d since agent start)", w.Name, w.LastRestart, w.PID, w.Restarts),
+				Value:    float64(w.Restarts),
+			})
+		}
+	}
+	return firing
+}
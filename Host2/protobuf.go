@@ -0,0 +1,185 @@
+package main
+
+import (
+	"encoding/binary"
+	"math"
+	"sort"
+	"time"
+)
+
+// Protobuf copy of go_latest.json, see snapshot.proto
+const OUTPUT_FILE_PROTOBUF = "go_latest.pb"
+
+// Protobuf wire types
+const (
+	PB_VARINT  = 0
+	PB_FIXED64 = 1
+	PB_BYTES   = 2
+)
+
+// pbWriter appends protobuf wire format. Like proto3, zero scalars are
+// left out; explicit presence is written with the *Always methods.
+type pbWriter struct {
+	buf []byte
+}
+
+func (p *pbWriter) tag(field, wireType int) {
+	p.buf = binary.AppendUvarint(p.buf, uint64(field)<<3|uint64(wireType))
+}
+
+func (p *pbWriter) uint(field int, v uint64) {
+	if v != 0 {
+		p.tag(field, PB_VARINT)
+		p.buf = binary.AppendUvarint(p.buf, v)
+	}
+}
+
+// int encodes int32/int64 fields; negative values take ten bytes, so
+// fields that are often negative are sint instead.
+func (p *pbWriter) int(field int, v int64) {
+	p.uint(field, uint64(v))
+}
+
+func (p *pbWriter) sint(field int, v int64) {
+	p.uint(field, uint64(v<<1)^uint64(v>>63))
+}
+
+func (p *pbWriter) bool(field int, v bool) {
+	if v {
+		p.uint(field, 1)
+	}
+}
+
+func (p *pbWriter) double(field int, v float64) {
+	if v != 0 {
+		p.doubleAlways(field, v)
+	}
+}
+
+func (p *pbWriter) doubleAlways(field int, v float64) {
+	p.tag(field, PB_FIXED64)
+	p.buf = binary.LittleEndian.AppendUint64(p.buf, math.Float64bits(v))
+}
+
+func (p *pbWriter) string(field int, v string) {
+	if v != "" {
+		p.tag(field, PB_BYTES)
+		p.buf = binary.AppendUvarint(p.buf, uint64(len(v)))
+		p.buf = append(p.buf, v...)
+	}
+}
+
+// message writes an embedded message, even when it is empty, so repeated
+// fields keep their element count.
+func (p *pbWriter) message(field int, build func(m *pbWriter)) {
+	var m pbWriter
+	build(&m)
+	p.tag(field, PB_BYTES)
+	p.buf = binary.AppendUvarint(p.buf, uint64(len(m.buf)))
+	p.buf = append(p.buf, m.buf...)
+}
+
+// stringMap writes a map<string, string> as key-sorted entries.
+func (p *pbWriter) stringMap(field int, values map[string]string) {
+	keys := make([]string, 0, len(values))
+	for k := range values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		p.message(field, func(m *pbWriter) {
+			m.string(1, k)
+			m.string(2, values[k])
+		})
+	}
+}
+
+// encodeSnapshotProto renders a snapshot as a hostagent.v1.Snapshot.
+func encodeSnapshotProto(metrics *SystemMetrics) []byte {
+	var p pbWriter
+	if at, err := time.Parse("2006-01-02T15:04:05Z", metrics.Timestamp); err == nil {
+		p.int(1, at.Unix())
+	}
+	p.string(2, metrics.System.Hostname)
+	p.string(3, metrics.System.AgentID)
+	p.string(4, metrics.Platform)
+	p.string(5, metrics.System.OS)
+	p.string(6, metrics.System.Kernel)
+	p.uint(7, metrics.System.UptimeSeconds)
+	p.string(8, metrics.Health)
+	p.stringMap(9, metrics.Labels)
+	p.message(10, func(m *pbWriter) {
+		m.double(1, metrics.CPU.UsagePercent)
+		m.uint(2, uint64(metrics.CPU.LogicalProcessors))
+		m.double(3, metrics.CPU.Load1)
+		m.double(4, metrics.CPU.Load5)
+		m.double(5, metrics.CPU.Load15)
+		m.string(6, metrics.CPU.Status)
+	})
+	p.message(11, func(m *pbWriter) {
+		m.uint(1, metrics.Memory.TotalMB)
+		m.uint(2, metrics.Memory.UsedMB)
+		m.uint(3, metrics.Memory.FreeMB)
+		m.uint(4, metrics.Memory.AvailableMB)
+		m.double(5, metrics.Memory.UsagePercent)
+		m.string(6, metrics.Memory.Status)
+	})
+	for _, disk := range metrics.Disk {
+		p.message(12, func(m *pbWriter) {
+			m.string(1, disk.Device)
+			m.string(2, disk.Filesystem)
+			m.double(3, disk.TotalGB)
+			m.double(4, disk.UsedGB)
+			m.double(5, disk.UsedPercent)
+			m.double(6, disk.GrowthGBPerDay)
+			if disk.DaysUntilFull != nil {
+				m.doubleAlways(7, *disk.DaysUntilFull)
+			}
+			m.string(8, disk.Status)
+		})
+	}
+	for _, iface := range metrics.Network {
+		p.message(13, func(m *pbWriter) {
+			m.string(1, iface.Iface)
+			m.uint(2, iface.RxBytes)
+			m.uint(3, iface.TxBytes)
+		})
+	}
+	p.message(14, func(m *pbWriter) {
+		m.sint(1, int64(metrics.Temperature.CPUCelsius))
+		m.string(2, metrics.Temperature.CPUVendor)
+		m.sint(3, int64(metrics.Temperature.GPUCelsius))
+		m.string(4, metrics.Temperature.GPUVendor)
+		m.string(5, metrics.Temperature.Status)
+	})
+	for _, gpu := range metrics.GPU.Devices {
+		p.message(15, func(m *pbWriter) {
+			m.string(1, gpu.Vendor)
+			m.string(2, gpu.Model)
+			m.int(3, int64(gpu.UtilizationPercent))
+			m.int(4, int64(gpu.MemoryUsedMB))
+			m.int(5, int64(gpu.MemoryTotalMB))
+			m.sint(6, int64(gpu.TemperatureCelsius))
+			m.string(7, gpu.Status)
+		})
+	}
+	for _, alert := range metrics.Alerts {
+		p.message(16, func(m *pbWriter) {
+			m.string(1, alert.ID)
+			m.string(2, alert.Rule)
+			m.string(3, alert.Severity)
+			m.string(4, alert.Message)
+			m.double(5, alert.Value)
+			m.string(6, alert.StartedAt)
+			m.bool(7, alert.Silenced)
+		})
+	}
+	for _, sample := range flattenMetrics(metrics) {
+		p.message(17, func(m *pbWriter) {
+			m.string(1, sample.Name)
+			m.stringMap(2, sample.Labels)
+			m.double(3, sample.Value)
+		})
+	}
+	return p.buf
+}
@@ -0,0 +1,258 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/shirou/gopsutil/v3/disk"
+)
+
+// Windows reports "no limit" as the largest unsigned value
+const QUOTA_NO_LIMIT = 1 << 62
+
+// QuotasInfo reports disk quota usage, fullest first, for file servers
+// where one user reaching a limit fails only that user's writes.
+type QuotasInfo struct {
+	Entries   []QuotaEntry `json:"entries"`    // quotas.top of them
+	Total     int          `json:"total"`      // users and groups with a limit
+	NearLimit int          `json:"near_limit"` // entries not "ok"
+	Status    string       `json:"status"`
+}
+
+// QuotaEntry is the quota of one user or group on one filesystem. Limits
+// are 0 when not set.
+type QuotaEntry struct {
+	Filesystem    string  `json:"filesystem"` // mount point, or the device when not mounted
+	Type          string  `json:"type"`       // "user" or "group"
+	Name          string  `json:"name"`       // "#1001" when the id has no name; DOMAIN\user on Windows
+	UsedMB        float64 `json:"used_mb"`
+	SoftLimitMB   float64 `json:"soft_limit_mb"` // the warning level on Windows
+	HardLimitMB   float64 `json:"hard_limit_mb"`
+	Files         uint64  `json:"files,omitempty"`
+	FileSoftLimit uint64  `json:"file_soft_limit,omitempty"`
+	FileHardLimit uint64  `json:"file_hard_limit,omitempty"`
+	UsedPercent   float64 `json:"used_percent"`            // of the hard limit, or the soft one without; the fuller of space and files
+	GraceExpires  string  `json:"grace_expires,omitempty"` // when over the soft limit
+	Status        string  `json:"status"`                  // "ok", "near_limit", "grace" (over the soft limit) or "exceeded"
+}
+
+// collectQuotasInfo reads every user and group quota with repquota on
+// Linux, which needs root, and from Win32_DiskQuota on NTFS volumes.
+func collectQuotasInfo(now time.Time, trace *sectionTrace) QuotasInfo {
+	info := QuotasInfo{Entries: []QuotaEntry{}, Status: "unavailable"}
+	var entries []QuotaEntry
+	var err error
+	method := "repquota"
+	switch collectorOS {
+	case "linux":
+		entries, err = repquotaEntries(now)
+	case "windows":
+		method = "win32_diskquota"
+		entries, err = windowsQuotaEntries()
+	default:
+		err = fmt.Errorf("not supported on %s", collectorOS)
+	}
+	if err != nil {
+		trace.fail(method, err)
+		return info
+	}
+
+	nearPercent := float64(currentConfig().Quotas.NearLimitPercent)
+	for i := range entries {
+		e := &entries[i]
+		if e.Status == "" {
+			switch {
+			case e.HardLimitMB > 0 && e.UsedMB >= e.HardLimitMB,
+				e.FileHardLimit > 0 && e.Files >= e.FileHardLimit:
+				e.Status = "exceeded"
+			case e.UsedPercent >= nearPercent:
+				e.Status = "near_limit"
+			default:
+				e.Status = "ok"
+			}
+		}
+		if e.Status != "ok" {
+			info.NearLimit++
+		}
+	}
+	sort.SliceStable(entries, func(i, j int) bool { return entries[i].UsedPercent > entries[j].UsedPercent })
+	info.Total = len(entries)
+	if top := currentConfig().Quotas.Top; len(entries) > top {
+		entries = entries[:top]
+	}
+	info.Entries = append(info.Entries, entries...)
+	trace.ok(method)
+	info.Status = "ok"
+	return info
+}
+
+// repquotaEntries parses "repquota -augp", which prints one report per
+// filesystem and quota type, sizes in 1K blocks and grace times as Unix
+// times (0 when not over the soft limit):
+//
+//	*** Report for user quotas on device /dev/sdb1
+//	User            used    soft    hard  grace    used  soft  hard  grace
+//	alice     +-  1050000 1000000 1100000 1697650000  120     0     0     0
+func repquotaEntries(now time.Time) ([]QuotaEntry, error) {
+	output, err := commands.Output("repquota", "-augp")
+	if err != nil {
+		return nil, err
+	}
+	mounts := map[string]string{}
+	if partitions, err := disk.Partitions(false); err == nil {
+		for _, p := range partitions {
+			mounts[p.Device] = p.Mountpoint
+		}
+	}
+
+	var entries []QuotaEntry
+	var filesystem, kind string
+	for _, line := range strings.Split(string(output), "\n") {
+		if rest, found := strings.CutPrefix(line, "*** Report for "); found {
+			// "user quotas on device /dev/sdb1"
+			fields := strings.Fields(rest)
+			kind, filesystem = fields[0], fields[len(fields)-1]
+			if mountpoint, ok := mounts[filesystem]; ok {
+				filesystem = mountpoint
+			}
+			continue
+		}
+		fields := strings.Fields(line)
+		if filesystem == "" || len(fields) != 10 || len(fields[1]) != 2 || strings.Trim(fields[1], "+-") != "" {
+			continue
+		}
+		var n [8]uint64
+		valid := true
+		for i := range n {
+			if n[i], err = strconv.ParseUint(fields[i+2], 10, 64); err != nil {
+				valid = false
+			}
+		}
+		if !valid {
+			continue
+		}
+		used, soft, hard, blockGrace, files, fileSoft, fileHard, fileGrace := n[0], n[1], n[2], n[3], n[4], n[5], n[6], n[7]
+		if soft == 0 && hard == 0 && fileSoft == 0 && fileHard == 0 {
+			continue
+		}
+		entry := QuotaEntry{
+			Filesystem:    filesystem,
+			Type:          kind,
+			Name:          fields[0],
+			UsedMB:        math.Round(float64(used)/1024*10) / 10,
+			SoftLimitMB:   math.Round(float64(soft)/1024*10) / 10,
+			HardLimitMB:   math.Round(float64(hard)/1024*10) / 10,
+			Files:         files,
+			FileSoftLimit: fileSoft,
+			FileHardLimit: fileHard,
+			UsedPercent:   math.Max(quotaPercent(used, soft, hard), quotaPercent(files, fileSoft, fileHard)),
+		}
+		// The earlier expiry of space and files decides
+		grace := blockGrace
+		if fileGrace > 0 && (grace == 0 || fileGrace < grace) {
+			grace = fileGrace
+		}
+		if grace > 0 {
+			expires := time.Unix(int64(grace), 0).UTC()
+			entry.GraceExpires = expires.Format("2006-01-02T15:04:05Z")
+			entry.Status = "grace"
+			if !now.Before(expires) {
+				entry.Status = "exceeded"
+			}
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// quotaPercent is usage against the hard limit, or the soft one without.
+func quotaPercent(used, soft, hard uint64) float64 {
+	limit := hard
+	if limit == 0 {
+		limit = soft
+	}
+	if limit == 0 {
+		return 0
+	}
+	return math.Round(float64(used)/float64(limit)*1000) / 10
+}
+
+// windowsQuotaScript lists the quota entries of every volume with quotas
+// enabled; reading them needs administrator rights.
+const windowsQuotaScript = `ConvertTo-Json -Compress -InputObject @(Get-CimInstance Win32_DiskQuota -ErrorAction Stop | ForEach-Object {
+  @{ volume = $_.QuotaVolume.DeviceID; user = $_.User.Domain + '\' + $_.User.Name; used = [uint64]$_.DiskSpaceUsed; limit = [uint64]$_.Limit; warning = [uint64]$_.WarningLimit }
+})`
+
+func windowsQuotaEntries() ([]QuotaEntry, error) {
+	output, err := commands.Output("powershell", "-NoProfile", "-Command", windowsQuotaScript)
+	if err != nil {
+		return nil, err
+	}
+	var rows []struct {
+		Volume  string `json:"volume"`
+		User    string `json:"user"`
+		Used    uint64 `json:"used"`
+		Limit   uint64 `json:"limit"`
+		Warning uint64 `json:"warning"`
+	}
+	if err := json.Unmarshal(bytes.TrimSpace(output), &rows); err != nil {
+		return nil, fmt.Errorf("unexpected output: %v", err)
+	}
+
+	var entries []QuotaEntry
+	for _, row := range rows {
+		if row.Limit >= QUOTA_NO_LIMIT {
+			row.Limit = 0
+		}
+		if row.Warning >= QUOTA_NO_LIMIT {
+			row.Warning = 0
+		}
+		if row.Limit == 0 && row.Warning == 0 {
+			continue
+		}
+		entry := QuotaEntry{
+			Filesystem:  row.Volume,
+			Type:        "user",
+			Name:        row.User,
+			UsedMB:      math.Round(float64(row.Used)/1024/1024*10) / 10,
+			SoftLimitMB: math.Round(float64(row.Warning)/1024/1024*10) / 10,
+			HardLimitMB: math.Round(float64(row.Limit)/1024/1024*10) / 10,
+			UsedPercent: quotaPercent(row.Used, row.Warning, row.Limit),
+		}
+		// Windows has no grace period; past the warning level is a warning
+		if row.Warning > 0 && row.Used >= row.Warning && (row.Limit == 0 || row.Used < row.Limit) {
+			entry.Status = "grace"
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// quotaAlerts warns about entries near or over their soft limit and is
+// critical for those that cannot write any more.
+func quotaAlerts(quotas QuotasInfo) []Alert {
+	var firing []Alert
+	for _, e := range quotas.Entries {
+		severity := "warning"
+		switch e.Status {
+		case "ok":
+			continue
+		case "exceeded":
+			severity = "critical"
+		}
+		firing = append(firing, Alert{
+			ID:       "quota:" + e.Type + ":" + e.Name + ":" + e.Filesystem,
+			Rule:     "quota",
+			Severity: severity,
+			Message:  fmt.Sprintf("%s %s is at %.1f%% of its quota on %s (%s)", e.Type, e.Name, e.UsedPercent, e.Filesystem, e.Status),
+			Value:    e.UsedPercent,
+		})
+	}
+	return firing
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"bufio"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// RAIDInfo reports Linux software RAID arrays and LVM volume groups.
+type RAIDInfo struct {
+	Arrays       []MDArray        `json:"arrays"`
+	VolumeGroups []LVMVolumeGroup `json:"volume_groups"`
+	Status       string           `json:"status"`
+}
+
+type MDArray struct {
+	Name          string  `json:"name"`
+	State         string  `json:"state"` // "active" or "inactive"
+	Level         string  `json:"level"`
+	Devices       int     `json:"devices"`        // expected members
+	ActiveDevices int     `json:"active_devices"` // members in sync
+	FailedDevices int     `json:"failed_devices"`
+	Degraded      bool    `json:"degraded"`
+	SyncAction    string  `json:"sync_action"` // "resync", "recovery", "reshape", "check" or ""
+	SyncPercent   float64 `json:"sync_percent"`
+	SyncFinishMin float64 `json:"sync_finish_minutes"`
+	Status        string  `json:"status"`
+}
+
+type LVMVolumeGroup struct {
+	Name        string  `json:"name"`
+	SizeGB      float64 `json:"size_gb"`
+	FreeGB      float64 `json:"free_gb"`
+	FreePercent float64 `json:"free_percent"`
+	PVCount     int     `json:"pv_count"`
+	LVCount     int     `json:"lv_count"`
+}
+
+var (
+	mdHeaderPattern = regexp.MustCompile(`^(md\S+)\s*:\s*(\S+)\s+(.*)$`)
+	mdCountsPattern = regexp.MustCompile(`\[(\d+)/(\d+)\]`)
+	mdSyncPattern   = regexp.MustCompile(`(resync|recovery|reshape|check|repair)\s*=\s*([\d.]+)%`)
+	mdFinishPattern = regexp.MustCompile(`finish=([\d.]+)min`)
+)
+
+// collectRAIDInfo reads /proc/mdstat and, when the LVM tools are installed
+// (and the agent may use them), the volume groups. Both are Linux-only.
+func collectRAIDInfo(trace *sectionTrace) RAIDInfo {
+	info := RAIDInfo{Arrays: []MDArray{}, VolumeGroups: []LVMVolumeGroup{}, Status: "unavailable"}
+	if collectorOS != "linux" {
+		return info
+	}
+
+	if data, err := hostFS.ReadFile("/proc/mdstat"); err == nil {
+		info.Arrays = parseMDStat(string(data))
+		info.Status = "ok"
+		trace.ok("mdstat")
+	} else {
+		trace.fail("mdstat", err)
+	}
+
+	if _, err := commands.LookPath("vgs"); err != nil {
+		trace.fail("vgs", err)
+		return info
+	}
+	out, err := commands.Output("vgs", "--noheadings", "--units", "b", "--nosuffix", "--separator", "|",
+		"-o", "vg_name,vg_size,vg_free,pv_count,lv_count")
+	if err != nil {
+		trace.fail("vgs", err)
+		return info
+	}
+	for _, line := range strings.Split(string(out), "\n") {
+		fields := strings.Split(strings.TrimSpace(line), "|")
+		if len(fields) != 5 {
+			continue
+		}
+		size, _ := strconv.ParseFloat(fields[1], 64)
+		free, _ := strconv.ParseFloat(fields[2], 64)
+		vg := LVMVolumeGroup{
+			Name:   fields[0],
+			SizeGB: size / 1024 / 1024 / 1024,
+			FreeGB: free / 1024 / 1024 / 1024,
+		}
+		vg.PVCount, _ = strconv.Atoi(fields[3])
+		vg.LVCount, _ = strconv.Atoi(fields[4])
+		if size > 0 {
+			vg.FreePercent = free / size * 100
+		}
+		info.VolumeGroups = append(info.VolumeGroups, vg)
+	}
+	if info.Status == "ok" {
+		trace.ok("mdstat, vgs")
+	} else {
+		trace.ok("vgs")
+	}
+	info.Status = "ok"
+	return info
+}
+
+// parseMDStat parses the contents of /proc/mdstat.
+func parseMDStat(text string) []MDArray {
+	arrays := []MDArray{}
+	var current *MDArray
+	scanner := bufio.NewScanner(strings.NewReader(text))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if m := mdHeaderPattern.FindStringSubmatch(line); m != nil {
+			arrays = append(arrays, MDArray{Name: m[1], State: m[2]})
+			current = &arrays[len(arrays)-1]
+			for _, field := range strings.Fields(m[3]) {
+				switch {
+				case strings.HasPrefix(field, "("):
+					// (auto-read-only), (read-only)
+				case strings.Contains(field, "["):
+					current.Devices++
+					if strings.HasSuffix(field, "(F)") {
+						current.FailedDevices++
+					}
+				default:
+					current.Level = field
+				}
+			}
+			// Until a [n/m] line says otherwise, every listed member counts
+			current.ActiveDevices = current.Devices - current.FailedDevices
+			continue
+		}
+		if current == nil || line == "" {
+			continue
+		}
+		if m := mdCountsPattern.FindStringSubmatch(line); m != nil {
+			current.Devices, _ = strconv.Atoi(m[1])
+			current.ActiveDevices, _ = strconv.Atoi(m[2])
+		}
+		if m := mdSyncPattern.FindStringSubmatch(line); m != nil {
+			current.SyncAction = m[1]
+			current.SyncPercent, _ = strconv.ParseFloat(m[2], 64)
+			if f := mdFinishPattern.FindStringSubmatch(line); f != nil {
+				current.SyncFinishMin, _ = strconv.ParseFloat(f[1], 64)
+			}
+		}
+	}
+
+	for i := range arrays {
+		a := &arrays[i]
+		a.Degraded = a.ActiveDevices < a.Devices
+		a.Status = mdArrayStatus(*a)
+	}
+	return arrays
+}
+
+// mdArrayStatus: a degraded array is critical until a rebuild is running,
+// which makes it a warning; an inactive array is critical.
+func mdArrayStatus(a MDArray) string {
+	switch {
+	case a.State != "active":
+		return "critical"
+	case a.Degraded && (a.SyncAction == "recovery" || a.SyncAction == "reshape"):
+		return "warning"
+	case a.Degraded:
+		return "critical"
+	}
+	return "ok"
+}
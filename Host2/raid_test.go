@@ -0,0 +1,132 @@
+package main
+
+import "testing"
+
+func TestParseMDStat(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want []MDArray
+	}{
+		{
+			name: "healthy mirror",
+			text: `Personalities : [raid1]
+md0 : active raid1 sdb1[1] sda1[0]
+      1046528 blocks super 1.2 [2/2] [UU]
+
+unused devices: <none>
+`,
+			want: []MDArray{{Name: "md0", State: "active", Level: "raid1", Devices: 2, ActiveDevices: 2, Status: "ok"}},
+		},
+		{
+			name: "degraded array rebuilding",
+			text: `md1 : active raid5 sdd1[3] sdc1[2](F) sdb1[1] sda1[0]
+      3139584 blocks super 1.2 level 5, 512k chunk, algorithm 2 [3/2] [UU_]
+      [==>..................]  recovery = 12.6% (132224/1046528) finish=2.5min speed=6010K/sec
+`,
+			want: []MDArray{{Name: "md1", State: "active", Level: "raid5", Devices: 3, ActiveDevices: 2, FailedDevices: 1,
+				Degraded: true, SyncAction: "recovery", SyncPercent: 12.6, SyncFinishMin: 2.5, Status: "warning"}},
+		},
+		{
+			name: "degraded without rebuild and an inactive array",
+			text: `md2 : active raid1 sda2[0]
+      1046528 blocks [2/1] [U_]
+md3 : inactive sdc3[0](S)
+      1046528 blocks
+`,
+			want: []MDArray{
+				{Name: "md2", State: "active", Level: "raid1", Devices: 2, ActiveDevices: 1, Degraded: true, Status: "critical"},
+				{Name: "md3", State: "inactive", Devices: 1, ActiveDevices: 1, Status: "critical"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := parseMDStat(tt.text)
+			if len(got) != len(tt.want) {
+				t.Fatalf("parsed %d arrays, want %d: %+v", len(got), len(tt.want), got)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("array %d:\n got %+v\nwant %+v", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestCollectRAIDInfo(t *testing.T) {
+	const mdstat = "md0 : active raid1 sdb1[1] sda1[0]\n      1046528 blocks [2/2] [UU]\n"
+	const vgs = "vgs --noheadings --units b --nosuffix --separator | -o vg_name,vg_size,vg_free,pv_count,lv_count"
+	tests := []struct {
+		name    string
+		goos    string
+		files   map[string]string
+		outputs map[string]string
+		status  string
+		method  string
+		arrays  int
+		groups  []LVMVolumeGroup
+	}{
+		{
+			name:   "neither mdstat nor LVM",
+			goos:   "linux",
+			status: "unavailable",
+		},
+		{
+			name:   "mdstat only",
+			goos:   "linux",
+			files:  map[string]string{"/proc/mdstat": mdstat},
+			status: "ok",
+			method: "mdstat",
+			arrays: 1,
+		},
+		{
+			name:    "mdstat and volume groups",
+			goos:    "linux",
+			files:   map[string]string{"/proc/mdstat": mdstat},
+			outputs: map[string]string{vgs: "  vg0|10737418240|2684354560|2|3\n  broken|line\n"},
+			status:  "ok",
+			method:  "mdstat, vgs",
+			arrays:  1,
+			groups:  []LVMVolumeGroup{{Name: "vg0", SizeGB: 10, FreeGB: 2.5, FreePercent: 25, PVCount: 2, LVCount: 3}},
+		},
+		{
+			name:    "volume groups without md",
+			goos:    "linux",
+			outputs: map[string]string{vgs: "vg0|1073741824|0|1|1\n"},
+			status:  "ok",
+			method:  "vgs",
+			groups:  []LVMVolumeGroup{{Name: "vg0", SizeGB: 1, PVCount: 1, LVCount: 1}},
+		},
+		{
+			name:    "not Linux",
+			goos:    "windows",
+			files:   map[string]string{"/proc/mdstat": mdstat},
+			outputs: map[string]string{vgs: "vg0|1073741824|0|1|1\n"},
+			status:  "unavailable",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			withHost(t, &fakeRunner{outputs: tt.outputs}, newFakeFS(tt.files), nil)
+			withOS(t, tt.goos)
+			trace := &sectionTrace{}
+			info := collectRAIDInfo(trace)
+			if info.Status != tt.status || trace.method != tt.method {
+				t.Fatalf("status %q via %q, want %q via %q", info.Status, trace.method, tt.status, tt.method)
+			}
+			if len(info.Arrays) != tt.arrays {
+				t.Errorf("%d arrays, want %d", len(info.Arrays), tt.arrays)
+			}
+			if len(info.VolumeGroups) != len(tt.groups) {
+				t.Fatalf("volume groups %+v, want %+v", info.VolumeGroups, tt.groups)
+			}
+			for i := range tt.groups {
+				if info.VolumeGroups[i] != tt.groups[i] {
+					t.Errorf("volume group %+v, want %+v", info.VolumeGroups[i], tt.groups[i])
+				}
+			}
+		})
+	}
+}
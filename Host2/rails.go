@@ -0,0 +1,132 @@
+package main
+
+import (
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// smcRails are the SMC keys of the voltage and power rails Macs commonly
+// expose; keys a model lacks read as no value and are left out.
+var smcRails = []struct {
+	key, name, kind string
+}{
+	{"VC0C", "CPU Core", "voltage"},
+	{"VG0C", "GPU Core", "voltage"},
+	{"VD0R", "DC In", "voltage"},
+	{"VP0R", "12V Rail", "voltage"},
+	{"PC0C", "CPU Core", "power"},
+	{"PCPC", "CPU Package", "power"},
+	{"PG0C", "GPU Core", "power"},
+	{"PDTR", "DC In", "power"},
+	{"PSTR", "System Total", "power"},
+}
+
+// collectRailSensors reads voltage and power rails: hwmon on Linux, the
+// SMC on macOS. Undervoltage from a weak PSU or SBC power supply shows up
+// here before it shows up as crashes.
+func collectRailSensors() []HardwareSensor {
+	switch collectorOS {
+	case "linux":
+		return hwmonRails()
+	case "darwin":
+		if _, err := commands.LookPath("smc"); err != nil {
+			return nil
+		}
+		var sensors []HardwareSensor
+		for _, rail := range smcRails {
+			value, err := smcValue(rail.key)
+			if err != nil || value == 0 {
+				continue
+			}
+			unit := "V"
+			if rail.kind == "power" {
+				unit = "W"
+			}
+			sensors = append(sensors, HardwareSensor{Hardware: "SMC", Name: rail.name, Type: rail.kind, Value: value, Unit: unit})
+		}
+		return sensors
+	}
+	return nil
+}
+
+// hwmonRails reads in*_input (millivolts) and power*_input or
+// power*_average (microwatts) of every hwmon chip, with their labels,
+// limits and alarm flags. Chips that only flag undervoltage, such as the
+// Raspberry Pi's rpi_volt, are reported with the alarm and no value.
+func hwmonRails() []HardwareSensor {
+	var sensors []HardwareSensor
+	chips, _ := hostFS.Glob("/sys/class/hwmon/hwmon*")
+	for _, chip := range chips {
+		hardware := readTrimmed(filepath.Join(chip, "name"))
+		if hardware == "" {
+			continue
+		}
+
+		channels := make(map[string]bool)
+		for _, pattern := range []string{"in*_input", "in*_alarm", "in*_lcrit_alarm", "power*_input", "power*_average"} {
+			files, _ := hostFS.Glob(filepath.Join(chip, pattern))
+			for _, file := range files {
+				// in*_alarm also matches intrusion0_alarm
+				channel := strings.SplitN(filepath.Base(file), "_", 2)[0]
+				if _, err := strconv.Atoi(strings.TrimPrefix(strings.TrimPrefix(channel, "power"), "in")); err == nil {
+					channels[channel] = true
+				}
+			}
+		}
+		names := make([]string, 0, len(channels))
+		for channel := range channels {
+			names = append(names, channel)
+		}
+		sort.Strings(names)
+		for _, channel := range names {
+			sensor := HardwareSensor{Hardware: hardware, Name: channel, Type: "voltage", Unit: "V"}
+			scale := 1000.0
+			if strings.HasPrefix(channel, "power") {
+				sensor.Type, sensor.Unit, scale = "power", "W", 1e6
+			}
+			if label := readTrimmed(filepath.Join(chip, channel+"_label")); label != "" {
+				sensor.Name = label
+			}
+			base := filepath.Join(chip, channel)
+			value, ok := readSysScaled(base+"_input", scale)
+			if !ok && sensor.Type == "power" {
+				value, ok = readSysScaled(base+"_average", scale)
+			}
+			sensor.Value = value
+			if min, ok := readSysScaled(base+"_min", scale); ok {
+				sensor.Min = &min
+			}
+			if max, ok := readSysScaled(base+"_max", scale); ok && max > 0 {
+				sensor.Max = &max
+			}
+			for _, suffix := range []string{"_alarm", "_min_alarm", "_max_alarm", "_lcrit_alarm", "_crit_alarm"} {
+				if readTrimmed(base+suffix) == "1" {
+					sensor.Alarm = true
+				}
+			}
+			if ok || sensor.Alarm || hardware == "rpi_volt" {
+				sensors = append(sensors, sensor)
+			}
+		}
+	}
+	return sensors
+}
+
+func readTrimmed(path string) string {
+	data, err := hostFS.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
+
+// readSysScaled reads an integer sysfs value divided by scale.
+func readSysScaled(path string, scale float64) (float64, bool) {
+	value, err := strconv.ParseInt(readTrimmed(path), 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	return float64(value) / scale, true
+}
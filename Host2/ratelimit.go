@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// How long an HTTP request waits for a free collection slot
+const COLLECTION_WAIT = 15 * time.Second
+
+var errCollectionBusy = errors.New("too many concurrent collections")
+
+// tokenBucket refills at rate tokens per second up to burst.
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// rateLimiter keeps one token bucket per client IP.
+type rateLimiter struct {
+	mu        sync.Mutex
+	buckets   map[string]*tokenBucket
+	lastPrune time.Time
+}
+
+var clientLimiter = &rateLimiter{buckets: map[string]*tokenBucket{}}
+
+// allow takes a token for the client and, when none is left, returns how
+// long until the next one is available.
+func (l *rateLimiter) allow(client string, cfg RateLimitConfig, now time.Time) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	// Drop buckets of clients that have been idle long enough to be full again
+	if now.Sub(l.lastPrune) > time.Minute {
+		full := time.Duration(float64(cfg.Burst)/cfg.RequestsPerSecond*float64(time.Second)) + time.Minute
+		for key, bucket := range l.buckets {
+			if now.Sub(bucket.last) > full {
+				delete(l.buckets, key)
+			}
+		}
+		l.lastPrune = now
+	}
+
+	bucket, ok := l.buckets[client]
+	if !ok {
+		bucket = &tokenBucket{tokens: float64(cfg.Burst), last: now}
+		l.buckets[client] = bucket
+	}
+	bucket.tokens = math.Min(float64(cfg.Burst), bucket.tokens+now.Sub(bucket.last).Seconds()*cfg.RequestsPerSecond)
+	bucket.last = now
+
+	if bucket.tokens < 1 {
+		wait := time.Duration((1 - bucket.tokens) / cfg.RequestsPerSecond * float64(time.Second))
+		return false, wait
+	}
+	bucket.tokens--
+	return true, 0
+}
+
+// rateLimited answers 429 when the client has exhausted its bucket.
+func rateLimited(w http.ResponseWriter, r *http.Request, cfg RateLimitConfig) bool {
+	if cfg.RequestsPerSecond <= 0 {
+		return false
+	}
+	client := r.RemoteAddr
+	if ip := remoteIP(r); ip != nil {
+		client = ip.String()
+	}
+
+	ok, wait := clientLimiter.allow(client, cfg, time.Now())
+	if ok {
+		return false
+	}
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+	http.Error(w, "Too many requests", http.StatusTooManyRequests)
+	return true
+}
+
+var (
+	collectSlotsMu sync.Mutex
+	collectSlots   chan struct{}
+)
+
+// collectionSlots returns the semaphore sized by
+// api.max_concurrent_collections, replacing it when the limit changes.
+// Holders of a slot in a replaced semaphore release into that one.
+func collectionSlots() chan struct{} {
+	limit := currentConfig().API.MaxConcurrentCollections
+	collectSlotsMu.Lock()
+	defer collectSlotsMu.Unlock()
+	if collectSlots == nil || cap(collectSlots) != limit {
+		collectSlots = make(chan struct{}, limit)
+	}
+	return collectSlots
+}
+
+// collectMetricsLimited runs collectMetrics once a collection slot is free,
+// so concurrent pollers cannot spawn unbounded nvidia-smi/wmic processes.
+// A nil done channel waits indefinitely.
+func collectMetricsLimited(done <-chan struct{}, scheduled bool) (*SystemMetrics, error) {
+	slots := collectionSlots()
+	select {
+	case slots <- struct{}{}:
+	case <-done:
+		return nil, errCollectionBusy
+	}
+	defer func() { <-slots }()
+	return collectMetrics(scheduled)
+}
+
+// collectForRequest waits for a collection slot for at most
+// COLLECTION_WAIT or until the client goes away.
+func collectForRequest(r *http.Request) (*SystemMetrics, error) {
+	ctx, cancel := context.WithTimeout(r.Context(), COLLECTION_WAIT)
+	defer cancel()
+	return collectMetricsLimited(ctx.Done(), false)
+}
+
+// writeCollectError maps collection failures to HTTP responses.
+func writeCollectError(w http.ResponseWriter, err error) {
+	if errors.Is(err, errCollectionBusy) {
+		w.Header().Set("Retry-After", "5")
+		http.Error(w, "Agent busy, too many concurrent collections", http.StatusServiceUnavailable)
+		return
+	}
+	http.Error(w, "Error collecting metrics: "+err.Error(), http.StatusInternalServerError)
+}
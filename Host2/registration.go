@@ -0,0 +1,196 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+)
+
+// RegistrationEvent is POSTed to registration.url: "register" on startup,
+// after a config change and whenever the server no longer knows the agent,
+// then "heartbeat" every interval. A host whose heartbeats stop for a few
+// intervals can be considered dead.
+type RegistrationEvent struct {
+	Event            string            `json:"event"` // "register" or "heartbeat"
+	AgentID          string            `json:"agent_id"`
+	Hostname         string            `json:"hostname"`
+	Labels           map[string]string `json:"labels"`
+	Timestamp        string            `json:"timestamp"`
+	Sequence         uint64            `json:"sequence"` // per process, restarts at 1
+	IntervalSeconds  int               `json:"interval_seconds"`
+	Health           string            `json:"health,omitempty"` // of the latest snapshot
+	ActiveAlerts     int               `json:"active_alerts"`
+	UptimeSeconds    uint64            `json:"uptime_seconds,omitempty"`
+	AgentStartedAt   string            `json:"agent_started_at"`
+	RegistrationInfo *RegistrationInfo `json:"registration,omitempty"` // register events only
+}
+
+// RegistrationInfo describes the agent to the fleet server.
+type RegistrationInfo struct {
+	Version            string           `json:"version"`
+	Platform           string           `json:"platform"`
+	OS                 string           `json:"os,omitempty"`
+	Kernel             string           `json:"kernel,omitempty"`
+	AdvertiseURL       string           `json:"advertise_url,omitempty"`
+	Listen             []string         `json:"listen"`
+	ReadOnly           bool             `json:"read_only"`
+	Collectors         []string         `json:"collectors"` // optional collectors that are enabled
+	DegradedCollectors []CapabilityInfo `json:"degraded_collectors"`
+	Endpoints          []string         `json:"endpoints"`
+	Sinks              []string         `json:"sinks"`
+	OutputFormats      []string         `json:"output_formats"`
+}
+
+// errNotRegistered is returned when the server answers 404 or 410 to a
+// heartbeat, meaning it has forgotten the agent.
+var errNotRegistered = fmt.Errorf("server does not know this agent")
+
+// startRegistration keeps the agent registered with registration.url. The
+// endpoint list comes from the API router.
+func startRegistration(endpoints map[string]string) {
+	paths := make([]string, 0, len(endpoints))
+	for path := range endpoints {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	started := time.Now().UTC().Format("2006-01-02T15:04:05Z")
+	var sequence uint64
+	for {
+		cfg := currentConfig()
+		reloaded := configReloaded()
+		if cfg.Registration.URL == "" {
+			<-reloaded
+			continue
+		}
+
+		interval := time.Duration(cfg.Registration.IntervalSeconds) * time.Second
+		registered := false
+		backoff := time.Second
+	loop:
+		for {
+			sequence++
+			event := newRegistrationEvent(cfg, started, sequence)
+			if !registered {
+				event.Event = "register"
+				event.RegistrationInfo = newRegistrationInfo(cfg, paths)
+			}
+
+			wait := interval
+			switch err := postRegistration(cfg.Registration, event); {
+			case err == errNotRegistered:
+				log.Printf("[REGISTER] %s; registering again", err)
+				registered = false
+				wait = 0
+			case err != nil:
+				log.Printf("[REGISTER] %s to %s failed: %v", event.Event, cfg.Registration.URL, err)
+				// Registration is retried sooner than heartbeats are sent
+				if !registered {
+					wait = backoff
+					if backoff *= 2; backoff > interval {
+						backoff = interval
+					}
+				}
+			case !registered:
+				log.Printf("[REGISTER] Registered with %s (heartbeat every %v)", cfg.Registration.URL, interval)
+				registered = true
+				backoff = time.Second
+			}
+
+			select {
+			case <-time.After(wait):
+			case <-reloaded:
+				break loop
+			}
+		}
+	}
+}
+
+func newRegistrationEvent(cfg *AgentConfig, started string, sequence uint64) RegistrationEvent {
+	event := RegistrationEvent{
+		Event:           "heartbeat",
+		AgentID:         agentID(),
+		Hostname:        agentHostname(),
+		Labels:          cfg.Labels,
+		Timestamp:       time.Now().UTC().Format("2006-01-02T15:04:05Z"),
+		Sequence:        sequence,
+		IntervalSeconds: cfg.Registration.IntervalSeconds,
+		ActiveAlerts:    len(currentAlerts()),
+		AgentStartedAt:  started,
+	}
+	sectionState.Lock()
+	if last := sectionState.last; last != nil {
+		event.Health = last.Health
+		event.UptimeSeconds = last.System.UptimeSeconds
+	}
+	sectionState.Unlock()
+	return event
+}
+
+func newRegistrationInfo(cfg *AgentConfig, endpoints []string) *RegistrationInfo {
+	info := &RegistrationInfo{
+		Version:            VERSION,
+		Platform:           runtime.GOOS,
+		AdvertiseURL:       cfg.Registration.AdvertiseURL,
+		Listen:             cfg.API.Listen,
+		ReadOnly:           readOnlyMode,
+		Collectors:         []string{},
+		DegradedCollectors: probeCapabilities(),
+		Endpoints:          endpoints,
+		Sinks:              []string{},
+		OutputFormats:      cfg.OutputFormats,
+	}
+	for _, name := range optionalCollectors {
+		if collectorEnabled(name) {
+			info.Collectors = append(info.Collectors, name)
+		}
+	}
+	for _, s := range cfg.Sinks {
+		info.Sinks = append(info.Sinks, s.Type+":"+s.Name)
+	}
+	sectionState.Lock()
+	if last := sectionState.last; last != nil {
+		info.OS = last.System.OS
+		info.Kernel = last.System.Kernel
+	}
+	sectionState.Unlock()
+	return info
+}
+
+// postRegistration sends one event. A 404 or 410 answer to a heartbeat
+// means the server lost the agent (restart, expiry) and wants it back.
+func postRegistration(cfg RegistrationConfig, event RegistrationEvent) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, cfg.URL, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range cfg.Headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := notifyHTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if event.Event == "heartbeat" && (resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusGone) {
+		return errNotRegistered
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("unexpected status %d: %s", resp.StatusCode, strings.TrimSpace(string(detail)))
+	}
+	return nil
+}
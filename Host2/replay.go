@@ -0,0 +1,315 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// replaySource serves recorded snapshots in place of collections, on a
+// clock that runs speed times faster than real time from the first
+// snapshot's timestamp.
+type replaySource struct {
+	mu        sync.Mutex
+	snapshots []*SystemMetrics
+	times     []time.Time
+	speed     float64
+	loop      bool
+	keepTime  bool
+	started   time.Time
+	announced int
+}
+
+// Set by the replay command; collections then come from the recording
+var replay *replaySource
+
+// readSnapshots loads a recording: JSON lines of snapshots as written by
+// "host-agent record" or snapshot_log, optionally gzipped. Snapshots are
+// ordered by timestamp; lines that do not parse are skipped.
+func readSnapshots(path string) ([]*SystemMetrics, []time.Time, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer file.Close()
+
+	reader := bufio.NewReader(file)
+	var input io.Reader = reader
+	if magic, _ := reader.Peek(2); bytes.Equal(magic, []byte{0x1f, 0x8b}) {
+		gz, err := gzip.NewReader(reader)
+		if err != nil {
+			return nil, nil, err
+		}
+		defer gz.Close()
+		input = gz
+	}
+
+	type entry struct {
+		metrics *SystemMetrics
+		at      time.Time
+	}
+	var entries []entry
+	skipped := 0
+	scanner := bufio.NewScanner(input)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		var metrics SystemMetrics
+		if err := json.Unmarshal(line, &metrics); err != nil {
+			skipped++
+			continue
+		}
+		at, err := time.Parse("2006-01-02T15:04:05Z", metrics.Timestamp)
+		if err != nil {
+			skipped++
+			continue
+		}
+		entries = append(entries, entry{&metrics, at})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, nil, err
+	}
+	if skipped > 0 {
+		log.Printf("[REPLAY] Skipped %d unreadable lines in %s", skipped, path)
+	}
+	if len(entries) == 0 {
+		return nil, nil, fmt.Errorf("%s contains no snapshots", path)
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool { return entries[i].at.Before(entries[j].at) })
+	snapshots := make([]*SystemMetrics, len(entries))
+	times := make([]time.Time, len(entries))
+	for i, e := range entries {
+		snapshots[i], times[i] = e.metrics, e.at
+	}
+	return snapshots, times, nil
+}
+
+// position returns the index of the snapshot due at now and the recorded
+// time the replay clock shows.
+func (r *replaySource) position(now time.Time) (int, time.Time) {
+	first, last := r.times[0], r.times[len(r.times)-1]
+	offset := time.Duration(float64(now.Sub(r.started)) * r.speed)
+	if r.loop && last.After(first) {
+		// One interval's pause after the last snapshot before starting over
+		span := last.Sub(first)
+		if len(r.times) > 1 {
+			span += span / time.Duration(len(r.times)-1)
+		}
+		offset %= span
+	}
+	clock := first.Add(offset)
+	i := sort.Search(len(r.times), func(i int) bool { return r.times[i].After(clock) }) - 1
+	if i < 0 {
+		i = 0
+	}
+	return i, clock
+}
+
+// next returns a copy of the snapshot due now. Statuses derived from
+// thresholds are evaluated again with the local configuration, alerts are
+// the local ones, and the timestamp is the current time unless the
+// recorded ones are kept.
+func (r *replaySource) next(plan *sectionPlan) *SystemMetrics {
+	r.mu.Lock()
+	i, _ := r.position(plan.now)
+	if i != r.announced {
+		r.announced = i
+		log.Printf("[REPLAY] Snapshot %d/%d, recorded %s", i+1, len(r.snapshots), r.snapshots[i].Timestamp)
+	}
+	data, _ := json.Marshal(r.snapshots[i])
+	r.mu.Unlock()
+
+	metrics := &SystemMetrics{}
+	json.Unmarshal(data, metrics)
+	if !r.keepTime {
+		metrics.Timestamp = plan.now.Format("2006-01-02T15:04:05Z")
+	}
+	metrics.Source = "replay"
+	metrics.Alerts = currentAlerts()
+	resetStatus(&metrics.CPU.Status)
+	resetStatus(&metrics.Memory.Status)
+	resetStatus(&metrics.Temperature.Status)
+	resetStatus(&metrics.Sockets.Status)
+	for j := range metrics.Disk {
+		resetStatus(&metrics.Disk[j].Status)
+	}
+	for j := range metrics.Temperature.Drives {
+		resetStatus(&metrics.Temperature.Drives[j].Status)
+	}
+	applyStatusThresholds(metrics)
+
+	for _, name := range sampledSections {
+		plan.collected[name] = plan.now
+		// Keep the recorded methods and errors
+		if recorded, ok := metrics.Collectors[name]; ok {
+			trace := plan.trace(name)
+			trace.method = recorded.Method
+			if recorded.Error != "" {
+				trace.failures = []string{recorded.Error}
+			}
+		}
+	}
+	plan.finish(metrics)
+	return metrics
+}
+
+// delay returns how long until the next recorded snapshot is due, so the
+// periodic collection follows the recording instead of interval_seconds.
+func (r *replaySource) delay() time.Duration {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := time.Now()
+	i, clock := r.position(now)
+	var wait time.Duration
+	switch {
+	case i+1 < len(r.times):
+		wait = r.times[i+1].Sub(clock)
+	case r.loop:
+		wait = r.times[len(r.times)-1].Sub(r.times[0]) / time.Duration(len(r.times))
+	default:
+		// The recording is over; the last snapshot stays in place
+		return time.Duration(currentConfig().IntervalSeconds) * time.Second
+	}
+	wait = time.Duration(float64(wait) / r.speed)
+	if wait < 100*time.Millisecond {
+		wait = 100 * time.Millisecond
+	}
+	return wait
+}
+
+// parseSpeed accepts "10x", "10" or "0.5x".
+func parseSpeed(s string) (float64, error) {
+	speed, err := strconv.ParseFloat(strings.TrimSuffix(strings.ToLower(s), "x"), 64)
+	if err != nil || speed <= 0 {
+		return 0, fmt.Errorf("invalid speed %q (use e.g. 10x)", s)
+	}
+	return speed, nil
+}
+
+// replayCommand serves a recording through the normal API.
+func replayCommand(args []string) error {
+	fs := newFlagSet("replay")
+	speedFlag := fs.String("speed", "1x", "playback speed relative to the recording, e.g. 10x")
+	loop := fs.Bool("loop", false, "start over after the last snapshot")
+	keepTime := fs.Bool("keep-timestamps", false, "report the recorded timestamps instead of the current time")
+	fs.BoolVar(&readOnlyMode, "read-only", false, "disable /refresh, file writing and state-changing endpoints")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: host-agent replay [flags] FILE\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return fmt.Errorf("a recording is required")
+	}
+	speed, err := parseSpeed(*speedFlag)
+	if err != nil {
+		return err
+	}
+
+	snapshots, times, err := readSnapshots(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	log.Printf("[REPLAY] %d snapshots from %s to %s at %gx", len(snapshots), snapshots[0].Timestamp, snapshots[len(snapshots)-1].Timestamp, speed)
+	replay = &replaySource{
+		snapshots: snapshots,
+		times:     times,
+		speed:     speed,
+		loop:      *loop,
+		keepTime:  *keepTime,
+		started:   time.Now(),
+		announced: -1,
+	}
+	serve()
+	return nil
+}
+
+// recordCommand collects snapshots at a fixed interval and appends them to
+// a file as JSON lines (gzipped when the name ends in .gz) until the
+// duration or count is reached or the command is interrupted.
+func recordCommand(args []string) error {
+	fs := newFlagSet("record")
+	output := fs.String("output", "recording.jsonl", "file to write; a .gz name is compressed")
+	interval := fs.Duration("interval", 0, "time between snapshots (default interval_seconds)")
+	duration := fs.Duration("duration", 0, "stop after this long (default until interrupted)")
+	count := fs.Int("count", 0, "stop after this many snapshots")
+	fs.BoolVar(&simulateMode, "simulate", false, "record generated metrics instead of reading the OS")
+	fs.Parse(args)
+
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+	applyConfig(cfg)
+	if *interval <= 0 {
+		*interval = time.Duration(cfg.IntervalSeconds) * time.Second
+	}
+
+	file, err := os.OpenFile(*output, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	var out io.Writer = file
+	if strings.HasSuffix(*output, ".gz") {
+		gz := gzip.NewWriter(file)
+		defer gz.Close()
+		out = gz
+	}
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+	var deadline <-chan time.Time
+	if *duration > 0 {
+		deadline = time.After(*duration)
+	}
+
+	fmt.Fprintf(os.Stderr, "Recording to %s every %v (Ctrl-C to stop)\n", *output, *interval)
+	for recorded := 0; *count <= 0 || recorded < *count; recorded++ {
+		metrics, err := collectMetrics(true)
+		if err != nil {
+			return err
+		}
+		history.add(metrics)
+		line, err := json.Marshal(metrics)
+		if err != nil {
+			return err
+		}
+		if _, err := out.Write(append(line, '\n')); err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "\r%d snapshots", recorded+1)
+
+		if *count > 0 && recorded+1 >= *count {
+			break
+		}
+		select {
+		case <-time.After(*interval):
+		case <-deadline:
+			fmt.Fprintln(os.Stderr)
+			return nil
+		case <-stop:
+			fmt.Fprintln(os.Stderr)
+			return nil
+		}
+	}
+	fmt.Fprintln(os.Stderr)
+	return nil
+}
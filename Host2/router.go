@@ -0,0 +1,113 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// route holds the handlers registered for one path, keyed by method.
+type route struct {
+	description string
+	handlers    map[string]http.HandlerFunc
+	queries     map[string]bool // non-GET methods that do not change state
+}
+
+// router dispatches on exact path and method. It answers 404 for unknown
+// paths, 405 with an Allow header for unknown methods, handles HEAD through
+// GET and OPTIONS itself, and refuses state-changing methods in read-only
+// mode.
+type router struct {
+	routes map[string]*route
+}
+
+func newRouter() *router {
+	return &router{routes: map[string]*route{}}
+}
+
+// handle registers h for method on path. The first description given for a
+// path is listed by the API info endpoint.
+func (rt *router) handle(method, path, description string, h http.HandlerFunc) {
+	rte, ok := rt.routes[path]
+	if !ok {
+		rte = &route{description: description, handlers: map[string]http.HandlerFunc{}, queries: map[string]bool{}}
+		rt.routes[path] = rte
+	}
+	rte.handlers[method] = h
+}
+
+// handleQuery registers a POST handler that only reads, such as a query
+// with a JSON body, so it stays available in read-only mode.
+func (rt *router) handleQuery(path, description string, h http.HandlerFunc) {
+	rt.handle(http.MethodPost, path, description, h)
+	rt.routes[path].queries[http.MethodPost] = true
+}
+
+// allowed lists the methods accepted on a route.
+func (rte *route) allowed() []string {
+	methods := []string{http.MethodOptions}
+	for method := range rte.handlers {
+		methods = append(methods, method)
+		if method == http.MethodGet {
+			methods = append(methods, http.MethodHead)
+		}
+	}
+	sort.Strings(methods)
+	return methods
+}
+
+func (rt *router) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	rte, ok := rt.routes[r.URL.Path]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	method := r.Method
+	if method == http.MethodHead {
+		method = http.MethodGet
+	}
+	h, ok := rte.handlers[method]
+	if !ok {
+		w.Header().Set("Allow", strings.Join(rte.allowed(), ", "))
+		if r.Method == http.MethodOptions {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if readOnlyMode && method != http.MethodGet && !rte.queries[method] {
+		http.Error(w, "Agent is running in read-only mode", http.StatusForbidden)
+		return
+	}
+	r, ok = authorizeRequest(w, r, method == http.MethodGet || rte.queries[method])
+	if !ok {
+		return
+	}
+	h(w, r)
+}
+
+// endpoints describes every route as "METHODS" -> path -> description for
+// the API info endpoint.
+func (rt *router) endpoints() map[string]string {
+	endpoints := make(map[string]string, len(rt.routes))
+	for path, rte := range rt.routes {
+		var methods []string
+		for method := range rte.handlers {
+			methods = append(methods, method)
+		}
+		sort.Strings(methods)
+		endpoints[path] = rte.description + " (" + strings.Join(methods, ", ") + ")"
+	}
+	return endpoints
+}
+
+// writeJSON encodes v as the response body with the given status.
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,71 @@
+package main
+
+import "fmt"
+
+// evaluateAlertRules checks the configured alert rules and the anomaly
+// detector against a snapshot. Each rule owns the alerts under its own ID
+// prefix.
+func evaluateAlertRules(metrics *SystemMetrics) {
+	samples := flattenMetrics(metrics)
+	syncAlerts("anomaly:", detectAnomalies(samples))
+	syncAlerts("process:", processWatchAlerts(metrics.ProcessWatch))
+	syncAlerts("scheduled_task:", scheduledTaskAlerts(metrics.ScheduledTasks))
+	syncAlerts("mount:", mountAlerts(metrics.Disk, metrics.MissingMounts))
+	syncAlerts("quota:", quotaAlerts(metrics.Quotas))
+	syncAlerts("app:", appCheckAlerts(metrics.Checks.Apps))
+	syncAlerts("snmp:", snmpDeviceAlerts(metrics.SNMPDevices))
+
+	for _, rule := range currentConfig().Alerts.Rules {
+		prefix := rule.Type + ":" + rule.Name + ":"
+		var firing []Alert
+
+		switch rule.Type {
+		case "disk_fill":
+			for _, disk := range metrics.Disk {
+				if rule.Device != "" && rule.Device != disk.Device {
+					continue
+				}
+				if disk.DaysUntilFull == nil || *disk.DaysUntilFull > rule.Days {
+					continue
+				}
+				firing = append(firing, Alert{
+					ID:       prefix + disk.Device,
+					Rule:     rule.Type,
+					Severity: rule.Severity,
+					Message:  fmt.Sprintf("%s will fill in %.1f days (growing %.2f GB/day)", disk.Device, *disk.DaysUntilFull, disk.GrowthGBPerDay),
+					Value:    *disk.DaysUntilFull,
+				})
+			}
+		case "threshold":
+			for _, sample := range samples {
+				if sample.Name != rule.Metric || !thresholdBreached(sample.Value, rule.Operator, rule.Value) {
+					continue
+				}
+				key := seriesKey(sample.Name, sample.Labels)
+				firing = append(firing, Alert{
+					ID:       prefix + key,
+					Rule:     rule.Type,
+					Severity: rule.Severity,
+					Message:  fmt.Sprintf("%s is %.2f (%s %.2f)", key, sample.Value, rule.Operator, rule.Value),
+					Value:    sample.Value,
+				})
+			}
+		}
+
+		syncAlerts(prefix, firing)
+	}
+}
+
+func thresholdBreached(value float64, operator string, limit float64) bool {
+	switch operator {
+	case ">":
+		return value > limit
+	case ">=":
+		return value >= limit
+	case "<":
+		return value < limit
+	case "<=":
+		return value <= limit
+	}
+	return false
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"log"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// Per-process offset within schedule.jitter_seconds, picked once so an
+// agent keeps a stable slot relative to the wall-clock boundaries
+var jitter = struct {
+	sync.Mutex
+	seconds int
+	offset  time.Duration
+}{}
+
+// jitterOffset returns this agent's fixed offset for the configured jitter.
+func jitterOffset(cfg ScheduleConfig) time.Duration {
+	jitter.Lock()
+	defer jitter.Unlock()
+	if jitter.seconds != cfg.JitterSeconds {
+		jitter.seconds = cfg.JitterSeconds
+		jitter.offset = 0
+		if cfg.JitterSeconds > 0 {
+			jitter.offset = time.Duration(rand.Int63n(int64(cfg.JitterSeconds) * int64(time.Second)))
+		}
+	}
+	return jitter.offset
+}
+
+// startDelay is the wait before the first periodic collection.
+func startDelay() time.Duration {
+	cfg := currentConfig()
+	delay := jitterOffset(cfg.Schedule)
+	if cfg.Schedule.Align {
+		delay = alignedDelay(time.Duration(cfg.IntervalSeconds)*time.Second, time.Now())
+	}
+	if delay > 0 {
+		log.Printf("[FILE] First collection in %v", delay.Round(time.Millisecond))
+	}
+	return delay
+}
+
+// scheduledDelay turns an interval into the wait before the next
+// collection, aligned to wall-clock multiples of the interval when
+// schedule.align is set.
+func scheduledDelay(interval time.Duration) time.Duration {
+	if !currentConfig().Schedule.Align {
+		return interval
+	}
+	return alignedDelay(interval, time.Now())
+}
+
+// alignedDelay returns the time from now until the next wall-clock
+// multiple of interval (e.g. :00 of each minute) plus the jitter offset.
+// A boundary less than half an interval away is skipped so collections
+// never bunch up.
+func alignedDelay(interval time.Duration, now time.Time) time.Duration {
+	offset := jitterOffset(currentConfig().Schedule) % interval
+	next := now.Truncate(interval).Add(offset)
+	for next.Sub(now) < interval/2 {
+		next = next.Add(interval)
+	}
+	return next.Sub(now)
+}
@@ -0,0 +1,278 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ScheduledTaskInfo reports the last run of one scheduled_tasks entry.
+type ScheduledTaskInfo struct {
+	Name       string  `json:"name"`
+	Type       string  `json:"type"` // "systemd", "anacron" or "windows"
+	LastRun    string  `json:"last_run,omitempty"`
+	LastResult string  `json:"last_result,omitempty"` // "success", "running", or how it failed, e.g. "exit-code 2"
+	NextRun    string  `json:"next_run,omitempty"`
+	AgeHours   float64 `json:"age_hours"` // since the last run
+	Status     string  `json:"status"`    // "ok", "failed", "overdue", "never_run" or "unknown"
+	Error      string  `json:"error,omitempty"`
+}
+
+// collectScheduledTasks reads the last run of every configured job. A
+// job is "failed" when its last run failed and "overdue" when it last ran
+// longer ago than max_age_hours, which catches timers that stopped firing.
+func collectScheduledTasks() []ScheduledTaskInfo {
+	entries := currentConfig().ScheduledTasks
+	results := []ScheduledTaskInfo{}
+	if len(entries) == 0 {
+		return results
+	}
+
+	var windows map[string]windowsTaskRun
+	var windowsErr error
+	now := clock.Now()
+	for _, entry := range entries {
+		info := ScheduledTaskInfo{Name: entry.Name}
+		var lastRun time.Time
+		var err error
+		switch {
+		case entry.Unit != "":
+			info.Type = "systemd"
+			lastRun, err = systemdUnitRun(entry.Unit, &info)
+		case entry.Anacron != "":
+			info.Type = "anacron"
+			lastRun, err = anacronRun(entry.Anacron)
+			if err == nil && !lastRun.IsZero() {
+				// anacron records only the day; it has no result
+				info.LastResult = "success"
+			}
+		case entry.Task != "":
+			info.Type = "windows"
+			if windows == nil && windowsErr == nil {
+				windows, windowsErr = windowsTaskRuns(entries)
+			}
+			err = windowsErr
+			if err == nil {
+				run := windows[entry.Task]
+				lastRun, info.LastResult, info.NextRun, err = run.lastRun, run.result, run.nextRun, run.err
+			}
+		}
+
+		switch {
+		case err != nil:
+			info.Status = "unknown"
+			info.Error = describeCollectorError(err)
+		case lastRun.IsZero():
+			info.Status = "never_run"
+			info.LastResult = ""
+		default:
+			info.LastRun = lastRun.UTC().Format("2006-01-02T15:04:05Z")
+			info.AgeHours = math.Round(now.Sub(lastRun).Hours()*100) / 100
+			info.Status = "ok"
+			if info.LastResult != "success" && info.LastResult != "running" {
+				info.Status = "failed"
+			} else if entry.MaxAgeHours > 0 && info.AgeHours > entry.MaxAgeHours {
+				info.Status = "overdue"
+			}
+		}
+		results = append(results, info)
+	}
+	return results
+}
+
+// scheduledTaskAlerts raises an alert per job whose last run failed, is
+// older than max_age_hours, or that never ran although it should have.
+func scheduledTaskAlerts(tasks []ScheduledTaskInfo) []Alert {
+	entries := make(map[string]ScheduledTaskConfig)
+	for _, entry := range currentConfig().ScheduledTasks {
+		entries[entry.Name] = entry
+	}
+
+	var firing []Alert
+	for _, t := range tasks {
+		entry := entries[t.Name]
+		var message string
+		switch {
+		case t.Status == "failed":
+			message = fmt.Sprintf("%s failed at %s (%s)", t.Name, t.LastRun, t.LastResult)
+		case t.Status == "overdue":
+			message = fmt.Sprintf("%s last ran %.1f hours ago (limit %g)", t.Name, t.AgeHours, entry.MaxAgeHours)
+		case t.Status == "never_run" && entry.MaxAgeHours > 0:
+			message = fmt.Sprintf("%s has never run", t.Name)
+		default:
+			continue
+		}
+		firing = append(firing, Alert{
+			ID:       "scheduled_task:" + t.Name,
+			Rule:     "scheduled_task",
+			Severity: entry.Severity,
+			Message:  message,
+			Value:    t.AgeHours,
+		})
+	}
+	return firing
+}
+
+// systemdTimestamp parses systemctl's "Fri 2026-10-17 03:00:00 UTC";
+// "n/a" and "" mean never.
+func systemdTimestamp(value string) time.Time {
+	t, err := time.ParseInLocation("Mon 2006-01-02 15:04:05 MST", value, time.Local)
+	if err != nil {
+		return time.Time{}
+	}
+	return t
+}
+
+// systemdProperties runs "systemctl show" for the given properties.
+func systemdProperties(unit string, names ...string) (map[string]string, error) {
+	args := []string{"show", unit}
+	for _, name := range names {
+		args = append(args, "-p", name)
+	}
+	output, err := commands.Output("systemctl", args...)
+	if err != nil {
+		return nil, err
+	}
+	props := make(map[string]string, len(names))
+	for _, line := range strings.Split(string(output), "\n") {
+		if key, value, ok := strings.Cut(strings.TrimSpace(line), "="); ok {
+			props[key] = value
+		}
+	}
+	if props["LoadState"] == "not-found" {
+		return nil, fmt.Errorf("unit %s not found", unit)
+	}
+	return props, nil
+}
+
+// systemdUnitRun reads the last run of a timer's service, or of a service
+// started some other way (e.g. by cron with systemd-run).
+func systemdUnitRun(unit string, info *ScheduledTaskInfo) (time.Time, error) {
+	service := unit
+	if strings.HasSuffix(unit, ".timer") {
+		timer, err := systemdProperties(unit, "LoadState", "Unit", "NextElapseUSecRealtime")
+		if err != nil {
+			return time.Time{}, err
+		}
+		service = timer["Unit"]
+		if next := systemdTimestamp(timer["NextElapseUSecRealtime"]); !next.IsZero() {
+			info.NextRun = next.UTC().Format("2006-01-02T15:04:05Z")
+		}
+	}
+
+	props, err := systemdProperties(service, "LoadState", "ActiveState", "Result", "ExecMainStatus", "ExecMainStartTimestamp")
+	if err != nil {
+		return time.Time{}, err
+	}
+	started := systemdTimestamp(props["ExecMainStartTimestamp"])
+	switch {
+	case props["ActiveState"] == "activating":
+		// A oneshot job stays "activating" until it exits
+		info.LastResult = "running"
+	case props["Result"] == "success":
+		info.LastResult = "success"
+	case props["Result"] == "exit-code":
+		info.LastResult = "exit-code " + props["ExecMainStatus"]
+	default:
+		info.LastResult = props["Result"]
+	}
+	return started, nil
+}
+
+// anacronRun reads the day a job last ran from its timestamp file,
+// "20261017", which anacron creates on the first run.
+func anacronRun(job string) (time.Time, error) {
+	data, err := hostFS.ReadFile("/var/spool/anacron/" + job)
+	if errors.Is(err, fs.ErrNotExist) {
+		return time.Time{}, nil
+	}
+	if err != nil {
+		return time.Time{}, err
+	}
+	day, err := time.ParseInLocation("20060102", strings.TrimSpace(string(data)), time.Local)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("unexpected anacron timestamp %q", strings.TrimSpace(string(data)))
+	}
+	return day, nil
+}
+
+type windowsTaskRun struct {
+	lastRun time.Time
+	result  string
+	nextRun string
+	err     error
+}
+
+// windowsTaskScript reads the run information of the listed tasks in one
+// PowerShell start; $tasks is prepended by windowsTaskRuns.
+const windowsTaskScript = `
+ConvertTo-Json -Compress -InputObject @(foreach ($p in $tasks) {
+  $i = $p.LastIndexOf('\')
+  try {
+    $t = Get-ScheduledTaskInfo -TaskPath $p.Substring(0, $i + 1) -TaskName $p.Substring($i + 1) -ErrorAction Stop
+    $r = @{ task = $p; result = $t.LastTaskResult }
+    if ($t.LastRunTime -and $t.LastRunTime.Year -gt 2000) { $r.last_run = $t.LastRunTime.ToUniversalTime().ToString('yyyy-MM-ddTHH:mm:ssZ') }
+    if ($t.NextRunTime) { $r.next_run = $t.NextRunTime.ToUniversalTime().ToString('yyyy-MM-ddTHH:mm:ssZ') }
+    $r
+  } catch { @{ task = $p; error = $_.Exception.Message } }
+})`
+
+// Task Scheduler result codes that are states rather than failures
+const (
+	TASK_RUNNING      = 0x41301
+	TASK_NOT_YET_RUN  = 0x41303
+	TASK_NO_MORE_RUNS = 0x41304
+)
+
+// windowsTaskRuns reads every configured Windows task, by path.
+func windowsTaskRuns(entries []ScheduledTaskConfig) (map[string]windowsTaskRun, error) {
+	var quoted []string
+	for _, entry := range entries {
+		if entry.Task != "" {
+			quoted = append(quoted, "'"+strings.ReplaceAll(entry.Task, "'", "''")+"'")
+		}
+	}
+	script := "$tasks = @(" + strings.Join(quoted, ", ") + ")" + windowsTaskScript
+	output, err := commands.Output("powershell", "-NoProfile", "-Command", script)
+	if err != nil {
+		return nil, err
+	}
+	var rows []struct {
+		Task    string `json:"task"`
+		Result  int64  `json:"result"`
+		LastRun string `json:"last_run"`
+		NextRun string `json:"next_run"`
+		Error   string `json:"error"`
+	}
+	if err := json.Unmarshal(bytes.TrimSpace(output), &rows); err != nil {
+		return nil, fmt.Errorf("unexpected output: %v", err)
+	}
+
+	runs := make(map[string]windowsTaskRun, len(rows))
+	for _, row := range rows {
+		run := windowsTaskRun{nextRun: row.NextRun}
+		switch {
+		case row.Error != "":
+			run.err = fmt.Errorf("%s", row.Error)
+		case row.Result == TASK_NOT_YET_RUN:
+		case row.Result == 0, row.Result == TASK_NO_MORE_RUNS:
+			run.result = "success"
+		case row.Result == TASK_RUNNING:
+			run.result = "running"
+		default:
+			// HRESULTs such as 0x80070005 (access denied) arrive negative
+			run.result = "result 0x" + strconv.FormatUint(uint64(uint32(row.Result)), 16)
+		}
+		if run.err == nil && row.LastRun != "" && row.Result != TASK_NOT_YET_RUN {
+			run.lastRun, _ = time.Parse("2006-01-02T15:04:05Z", row.LastRun)
+		}
+		runs[row.Task] = run
+	}
+	return runs, nil
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// Sections of SystemMetrics that collector_intervals may slow down
+var sampledSections = []string{"system", "cpu", "memory", "disk", "network", "temperature", "gpu", "kernel", "event_log", "kernel_log", "hyperv", "zfs", "raid", "sockets", "security", "updates", "users", "cgroups", "numa", "hugepages", "entropy", "limits", "disk_io", "quotas"}
+
+// Intervals of sections too slow to collect every time, unless
+// collector_intervals sets one
+var defaultSectionIntervals = map[string]int{"updates": 3600, "quotas": 300}
+
+// Last full snapshot, when each section in it was collected and when each
+// was last collected successfully
+var sectionState = struct {
+	sync.Mutex
+	last        *SystemMetrics
+	collected   map[string]time.Time
+	lastSuccess map[string]time.Time
+}{collected: make(map[string]time.Time), lastSuccess: make(map[string]time.Time)}
+
+// sectionPlan decides, for one collection, which sections are refreshed and
+// which are carried over from the previous snapshot.
+type sectionPlan struct {
+	now       time.Time
+	prev      *SystemMetrics
+	collected map[string]time.Time
+	traces    map[string]*sectionTrace
+	// Only a scheduled collection moves the "since the previous sample"
+	// cursors, saves state and is kept for the next plan; any other reports
+	// since the scheduled one
+	scheduled bool
+}
+
+func planSections(scheduled bool) *sectionPlan {
+	sectionState.Lock()
+	defer sectionState.Unlock()
+
+	plan := &sectionPlan{
+		now:       clock.Now().UTC(),
+		prev:      sectionState.last,
+		collected: make(map[string]time.Time, len(sectionState.collected)),
+		scheduled: scheduled,
+	}
+	for name, at := range sectionState.collected {
+		plan.collected[name] = at
+	}
+	return plan
+}
+
+// due reports whether a section should be collected now. Sections without
+// an interval of their own or a default one are collected every time.
+func (p *sectionPlan) due(name string) bool {
+	seconds, ok := currentConfig().CollectorIntervals[name]
+	if !ok {
+		seconds = defaultSectionIntervals[name]
+	}
+	interval := time.Duration(seconds) * time.Second
+	last, ok := p.collected[name]
+	// One second of slack absorbs the drift of the periodic loop
+	if p.prev == nil || !ok || interval <= 0 || p.now.Sub(last) >= interval-time.Second {
+		p.collected[name] = p.now
+		return true
+	}
+	return false
+}
+
+// finish stamps the snapshot with per-section collection times and
+// collector statuses and, for a scheduled collection, keeps it for the next
+// plan. A request or command in between does not use up sections due at the
+// next scheduled collection, which would keep their cursors from moving.
+func (p *sectionPlan) finish(metrics *SystemMetrics) {
+	metrics.CollectedAt = make(map[string]string, len(p.collected))
+	for name, at := range p.collected {
+		metrics.CollectedAt[name] = at.Format("2006-01-02T15:04:05Z")
+	}
+
+	sectionState.Lock()
+	defer sectionState.Unlock()
+	metrics.Collectors = p.collectorStatuses(metrics, sectionState.lastSuccess)
+	if p.scheduled {
+		sectionState.last = metrics
+		sectionState.collected = p.collected
+	}
+}
+
+// resetStatus turns a threshold-derived status of a carried-over section
+// back into the "ok" placeholder, so it is evaluated again and still counts
+// towards health.
+func resetStatus(status *string) {
+	if _, derived := statusRank[*status]; derived {
+		*status = "ok"
+	}
+}
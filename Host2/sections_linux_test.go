@@ -0,0 +1,67 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// A section carried over between collections must have its threshold
+// status evaluated again, and keep counting towards health.
+func TestCarriedOverSectionKeepsStatus(t *testing.T) {
+	cfg := defaultConfig()
+	for _, name := range optionalCollectors {
+		cfg.Collectors[name] = name == "quotas"
+	}
+	cfg.Uptime.StateFile = filepath.Join(t.TempDir(), "agent_uptime.json")
+	if err := cfg.validate(); err != nil {
+		t.Fatal(err)
+	}
+	// Only the quotas may raise health, whatever the load of this host
+	cfg.Thresholds = ThresholdsConfig{}
+	previous := currentConfig()
+	applyConfig(cfg)
+	t.Cleanup(func() {
+		if previous != nil {
+			applyConfig(previous)
+		}
+	})
+
+	const repquota = "*** Report for user quotas on device /dev/sdb1\n" +
+		"Block grace time: 7days; Inode grace time: 7days\n" +
+		"alice     --   950000       0 1000000      0    12     0     0     0\n" +
+		"bob       --    10000       0 1000000      0     3     0     0     0\n"
+	now := &fakeClock{now: time.Date(2025, 10, 12, 0, 0, 0, 0, time.UTC)}
+	withHost(t, &fakeRunner{outputs: map[string]string{"repquota -augp": repquota}}, newFakeFS(nil), now)
+	sectionState.Lock()
+	sectionState.last = nil
+	sectionState.collected = map[string]time.Time{}
+	sectionState.lastSuccess = map[string]time.Time{}
+	sectionState.Unlock()
+
+	tests := []struct {
+		name    string
+		advance time.Duration
+		carried bool
+	}{
+		{name: "collected", advance: 0},
+		{name: "carried over", advance: time.Minute, carried: true},
+		{name: "collected again", advance: 5 * time.Minute},
+	}
+	for _, tt := range tests {
+		now.now = now.now.Add(tt.advance)
+		metrics, err := collectMetrics(true)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if at := metrics.CollectedAt["quotas"]; (at != now.now.Format("2006-01-02T15:04:05Z")) == !tt.carried {
+			t.Errorf("%s: quotas collected at %s", tt.name, at)
+		}
+		if metrics.Quotas.NearLimit != 1 || metrics.Quotas.Status != "warning" {
+			t.Errorf("%s: %d near the limit with status %q, want 1 and warning", tt.name, metrics.Quotas.NearLimit, metrics.Quotas.Status)
+		}
+		if metrics.Health != "warning" {
+			t.Errorf("%s: health %q ignores the quota warning", tt.name, metrics.Health)
+		}
+	}
+}
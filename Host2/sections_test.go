@@ -0,0 +1,61 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// A poll between scheduled collections must not use up a section due at
+// the next one, or the event log and kernel log cursors would only move
+// when no request happened to come first.
+func TestUnscheduledCollectionKeepsSectionsDue(t *testing.T) {
+	cfg := defaultConfig()
+	cfg.CollectorIntervals = map[string]int{"kernel_log": 60}
+	if err := cfg.validate(); err != nil {
+		t.Fatal(err)
+	}
+	previous := currentConfig()
+	applyConfig(cfg)
+	t.Cleanup(func() {
+		if previous != nil {
+			applyConfig(previous)
+		}
+	})
+
+	now := &fakeClock{now: time.Date(2025, 10, 12, 0, 0, 0, 0, time.UTC)}
+	withHost(t, &fakeRunner{}, newFakeFS(nil), now)
+	sectionState.Lock()
+	sectionState.last = nil
+	sectionState.collected = map[string]time.Time{}
+	sectionState.lastSuccess = map[string]time.Time{}
+	sectionState.Unlock()
+
+	tests := []struct {
+		name      string
+		advance   time.Duration
+		scheduled bool
+		due       bool
+	}{
+		{name: "first scheduled", advance: 0, scheduled: true, due: true},
+		{name: "poll before the interval", advance: 30 * time.Second, due: false},
+		{name: "poll after the interval", advance: 40 * time.Second, due: true},
+		{name: "scheduled after the poll", advance: time.Second, scheduled: true, due: true},
+		{name: "scheduled again", advance: 10 * time.Second, scheduled: true, due: false},
+	}
+	var scheduled *SystemMetrics
+	for _, tt := range tests {
+		now.now = now.now.Add(tt.advance)
+		plan := planSections(tt.scheduled)
+		if plan.prev != scheduled {
+			t.Errorf("%s: planned from a snapshot other than the last scheduled one", tt.name)
+		}
+		if due := plan.due("kernel_log"); due != tt.due {
+			t.Errorf("%s: kernel_log due = %v, want %v", tt.name, due, tt.due)
+		}
+		metrics := &SystemMetrics{}
+		plan.finish(metrics)
+		if tt.scheduled {
+			scheduled = metrics
+		}
+	}
+}
@@ -0,0 +1,245 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os/exec"
+	"path"
+	"sort"
+	"strings"
+)
+
+// SecurityInfo reports the host's exposure to CPU side-channel
+// vulnerabilities and the microcode revision the mitigations depend on.
+type SecurityInfo struct {
+	CPUVulnerabilities []CPUVulnerability `json:"cpu_vulnerabilities"`
+	Vulnerable         int                `json:"vulnerable"` // vulnerabilities the CPU has without a mitigation
+	Microcode          string             `json:"microcode"`  // revision, e.g. "0xf4"; "" when unknown
+	Firewall           FirewallStatus     `json:"firewall"`
+	AccessControl      []AccessControl    `json:"access_control"` // SELinux and AppArmor, where the kernel has them
+	Status             string             `json:"status"`
+}
+
+// FirewallStatus reports whether the host firewall filters traffic.
+type FirewallStatus struct {
+	Name     string            `json:"name"`  // "ufw", "firewalld" or "windows_defender"; "" when none was found
+	State    string            `json:"state"` // "enabled", "partial" (some Windows profiles off), "disabled" or "unknown"
+	Profiles []FirewallProfile `json:"profiles,omitempty"`
+}
+
+// FirewallProfile is a Windows Defender Firewall profile.
+type FirewallProfile struct {
+	Name    string `json:"name"` // "Domain", "Private" or "Public"
+	Enabled bool   `json:"enabled"`
+}
+
+// AccessControl is the state of a mandatory access control module.
+type AccessControl struct {
+	Name string `json:"name"` // "selinux" or "apparmor"
+	// SELinux: "enforcing", "permissive" or "disabled"; AppArmor:
+	// "enforcing" with profiles in enforce mode, else "enabled" or "disabled"
+	Mode             string `json:"mode"`
+	EnforcedProfiles int    `json:"enforced_profiles,omitempty"` // AppArmor, when readable (root)
+	ComplainProfiles int    `json:"complain_profiles,omitempty"`
+}
+
+type CPUVulnerability struct {
+	Name   string `json:"name"`   // e.g. "meltdown", "spectre_v2", "retbleed"
+	State  string `json:"state"`  // "not_affected", "mitigated", "vulnerable" or "unknown"
+	Detail string `json:"detail"` // as the OS reports it, e.g. "Mitigation: PTI"
+}
+
+// vulnerabilityState classifies the kernel's description of a
+// vulnerability, e.g. "Not affected", "Mitigation: Retpolines; IBPB:
+// conditional" or "Vulnerable: Clear CPU buffers attempted, no microcode".
+func vulnerabilityState(detail string) string {
+	lower := strings.ToLower(detail)
+	switch {
+	case strings.HasPrefix(lower, "not affected"):
+		return "not_affected"
+	case strings.Contains(lower, "mitigation"):
+		return "mitigated"
+	case strings.Contains(lower, "vulnerable"):
+		return "vulnerable"
+	}
+	return "unknown"
+}
+
+// countVulnerable sets info.Vulnerable from the list.
+func countVulnerable(info *SecurityInfo) {
+	info.Vulnerable = 0
+	for _, v := range info.CPUVulnerabilities {
+		if v.State == "vulnerable" {
+			info.Vulnerable++
+		}
+	}
+}
+
+// collectSecurityInfo reads the kernel's verdict on each known CPU
+// vulnerability from /sys/devices/system/cpu/vulnerabilities, the loaded
+// microcode revision from /proc/cpuinfo, and the firewall and SELinux or
+// AppArmor state on Linux, and asks the platform elsewhere.
+func collectSecurityInfo(trace *sectionTrace) SecurityInfo {
+	if collectorOS != "linux" {
+		return platformSecurityInfo(trace)
+	}
+	info := SecurityInfo{CPUVulnerabilities: []CPUVulnerability{}, AccessControl: []AccessControl{}, Status: "unavailable"}
+
+	files, _ := hostFS.Glob("/sys/devices/system/cpu/vulnerabilities/*")
+	sort.Strings(files)
+	for _, file := range files {
+		detail := readTrimmed(file)
+		if detail == "" {
+			continue
+		}
+		info.CPUVulnerabilities = append(info.CPUVulnerabilities, CPUVulnerability{
+			Name:   path.Base(file),
+			State:  vulnerabilityState(detail),
+			Detail: detail,
+		})
+	}
+	countVulnerable(&info)
+	info.Microcode = linuxMicrocode()
+	info.Firewall = linuxFirewall()
+	info.AccessControl = linuxAccessControl()
+
+	if len(info.CPUVulnerabilities) == 0 {
+		// Kernels before 4.15 have no vulnerabilities directory
+		trace.fail("sysfs", fmt.Errorf("/sys/devices/system/cpu/vulnerabilities not found"))
+		return info
+	}
+	trace.ok("sysfs")
+	info.Status = "ok"
+	return info
+}
+
+// linuxMicrocode returns the "microcode" field of the first processor in
+// /proc/cpuinfo; ARM CPUs have none.
+func linuxMicrocode() string {
+	file, err := hostFS.Open("/proc/cpuinfo")
+	if err != nil {
+		return ""
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		key, value, found := strings.Cut(scanner.Text(), ":")
+		if found && strings.TrimSpace(key) == "microcode" {
+			return strings.TrimSpace(value)
+		}
+	}
+	return ""
+}
+
+// linuxFirewall reports ufw from its configuration, which is readable
+// without root, and firewalld from its daemon. An installed but disabled
+// ufw is only reported on hosts without firewalld.
+func linuxFirewall() FirewallStatus {
+	if data, err := hostFS.ReadFile("/etc/ufw/ufw.conf"); err == nil {
+		status := FirewallStatus{Name: "ufw", State: "disabled"}
+		for _, line := range strings.Split(string(data), "\n") {
+			if key, value, found := strings.Cut(strings.TrimSpace(line), "="); found && key == "ENABLED" && strings.EqualFold(strings.Trim(value, `"' `), "yes") {
+				status.State = "enabled"
+			}
+		}
+		if status.State == "enabled" {
+			return status
+		}
+	}
+	if _, err := commands.LookPath("firewall-cmd"); err == nil {
+		// "running", or "not running" with exit status 252
+		output, err := commands.Output("firewall-cmd", "--state")
+		var exitErr *exec.ExitError
+		switch {
+		case err == nil && strings.TrimSpace(string(output)) == "running":
+			return FirewallStatus{Name: "firewalld", State: "enabled"}
+		case err == nil, errors.As(err, &exitErr) && exitErr.ExitCode() == 252:
+			return FirewallStatus{Name: "firewalld", State: "disabled"}
+		default:
+			return FirewallStatus{Name: "firewalld", State: "unknown"}
+		}
+	}
+	if _, err := hostFS.Stat("/etc/ufw/ufw.conf"); err == nil {
+		return FirewallStatus{Name: "ufw", State: "disabled"}
+	}
+	return FirewallStatus{State: "unknown"}
+}
+
+// linuxAccessControl reads the SELinux mode from selinuxfs and the
+// AppArmor state from its module parameters and securityfs.
+func linuxAccessControl() []AccessControl {
+	modules := []AccessControl{}
+	switch readTrimmed("/sys/fs/selinux/enforce") {
+	case "1":
+		modules = append(modules, AccessControl{Name: "selinux", Mode: "enforcing"})
+	case "0":
+		modules = append(modules, AccessControl{Name: "selinux", Mode: "permissive"})
+	default:
+		if _, err := hostFS.Stat("/etc/selinux/config"); err == nil {
+			modules = append(modules, AccessControl{Name: "selinux", Mode: "disabled"})
+		}
+	}
+
+	switch readTrimmed("/sys/module/apparmor/parameters/enabled") {
+	case "Y":
+		apparmor := AccessControl{Name: "apparmor", Mode: "enabled"}
+		// One "name (mode)" line per loaded profile; root only
+		if data, err := hostFS.ReadFile("/sys/kernel/security/apparmor/profiles"); err == nil {
+			for _, line := range strings.Split(string(data), "\n") {
+				switch {
+				case strings.HasSuffix(line, "(enforce)"):
+					apparmor.EnforcedProfiles++
+				case strings.HasSuffix(line, "(complain)"):
+					apparmor.ComplainProfiles++
+				}
+			}
+			if apparmor.EnforcedProfiles > 0 {
+				apparmor.Mode = "enforcing"
+			}
+		}
+		modules = append(modules, apparmor)
+	case "N":
+		modules = append(modules, AccessControl{Name: "apparmor", Mode: "disabled"})
+	}
+	return modules
+}
+
+// windowsFirewallScript lists the Windows Defender Firewall profiles;
+// Enabled is a GpoBoolean, converted so JSON gets the name
+const windowsFirewallScript = `@(Get-NetFirewallProfile | Select-Object Name, @{n='Enabled';e={[string]$_.Enabled}}) | ConvertTo-Json -Compress`
+
+// windowsFirewall reports Windows Defender Firewall as enabled when every
+// profile is, and partial when only some are.
+func windowsFirewall() FirewallStatus {
+	output, err := commands.Output("powershell", "-NoProfile", "-Command", windowsFirewallScript)
+	if err != nil {
+		log.Printf("[SECURITY] Error reading firewall profiles: %s", describeCollectorError(err))
+		return FirewallStatus{State: "unknown"}
+	}
+	var profiles []struct{ Name, Enabled string }
+	if err := json.Unmarshal(output, &profiles); err != nil || len(profiles) == 0 {
+		return FirewallStatus{State: "unknown"}
+	}
+
+	status := FirewallStatus{Name: "windows_defender"}
+	enabled := 0
+	for _, p := range profiles {
+		on := p.Enabled == "True"
+		if on {
+			enabled++
+		}
+		status.Profiles = append(status.Profiles, FirewallProfile{Name: p.Name, Enabled: on})
+	}
+	switch enabled {
+	case len(profiles):
+		status.State = "enabled"
+	case 0:
+		status.State = "disabled"
+	default:
+		status.State = "partial"
+	}
+	return status
+}
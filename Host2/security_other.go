@@ -0,0 +1,8 @@
+//go:build !windows
+
+package main
+
+// platformSecurityInfo is not implemented on this platform.
+func platformSecurityInfo(trace *sectionTrace) SecurityInfo {
+	return SecurityInfo{CPUVulnerabilities: []CPUVulnerability{}, AccessControl: []AccessControl{}, Status: "unavailable"}
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"syscall"
+	"unsafe"
+)
+
+// System information classes and flags of the speculation control state,
+// as read by Microsoft's SpeculationControl module
+const (
+	systemKernelVaShadowInformation     = 196
+	systemSpeculationControlInformation = 201
+
+	kvaShadowEnabled           = 0x01
+	kvaShadowPcid              = 0x04
+	kvaShadowRequired          = 0x10
+	kvaShadowRequiredAvailable = 0x20
+	l1tfInvalidPteBitMask      = 0xfc0
+
+	scfBpbEnabled                   = 0x01
+	scfBpbDisabledSystemPolicy      = 0x02
+	scfBpbDisabledNoHardwareSupport = 0x04
+	scfSsbdAvailable                = 0x100
+	scfSsbdSupported                = 0x200
+	scfSsbdSystemWide               = 0x400
+	scfSsbdRequired                 = 0x1000
+	scfRetpolineEnabled             = 0x4000
+	scfEnhancedIbrs                 = 0x10000
+	scfMdsHardwareProtected         = 0x1000000
+	scfMbClearEnabled               = 0x2000000
+	scfMbClearReported              = 0x4000000
+)
+
+var procNtQuerySystemInformation = syscall.NewLazyDLL("ntdll.dll").NewProc("NtQuerySystemInformation")
+
+// querySystemFlags reads a 32-bit system information class; Windows
+// builds without the January 2018 updates do not know these classes.
+func querySystemFlags(class uintptr) (uint32, error) {
+	var flags, length uint32
+	if err := procNtQuerySystemInformation.Find(); err != nil {
+		return 0, err
+	}
+	status, _, _ := procNtQuerySystemInformation.Call(class, uintptr(unsafe.Pointer(&flags)), unsafe.Sizeof(flags), uintptr(unsafe.Pointer(&length)))
+	if status != 0 {
+		return 0, fmt.Errorf("NtQuerySystemInformation(%d) failed: 0x%x", class, status)
+	}
+	return flags, nil
+}
+
+// platformSecurityInfo reads the kernel's speculation control state, the
+// one Get-SpeculationControlSettings reports, the microcode revision
+// Windows loaded from the registry, and the firewall profiles.
+func platformSecurityInfo(trace *sectionTrace) SecurityInfo {
+	info := SecurityInfo{CPUVulnerabilities: []CPUVulnerability{}, AccessControl: []AccessControl{}, Status: "unavailable"}
+	add := func(name, state, detail string) {
+		info.CPUVulnerabilities = append(info.CPUVulnerabilities, CPUVulnerability{Name: name, State: state, Detail: detail})
+	}
+
+	if kva, err := querySystemFlags(systemKernelVaShadowInformation); err != nil {
+		trace.fail("NtQuerySystemInformation", err)
+	} else if kva&kvaShadowRequiredAvailable != 0 && kva&kvaShadowRequired == 0 {
+		add("meltdown", "not_affected", "Not affected")
+		add("l1tf", "not_affected", "Not affected")
+	} else {
+		switch {
+		case kva&kvaShadowEnabled != 0 && kva&kvaShadowPcid != 0:
+			add("meltdown", "mitigated", "Mitigation: KVA shadow with PCID")
+		case kva&kvaShadowEnabled != 0:
+			add("meltdown", "mitigated", "Mitigation: KVA shadow")
+		case kva&kvaShadowRequiredAvailable != 0:
+			add("meltdown", "vulnerable", "Vulnerable: KVA shadow disabled")
+		default:
+			add("meltdown", "unknown", "KVA shadow disabled")
+		}
+		if kva&l1tfInvalidPteBitMask != 0 {
+			add("l1tf", "mitigated", "Mitigation: PTE inversion")
+		} else if kva&kvaShadowRequiredAvailable != 0 {
+			add("l1tf", "vulnerable", "Vulnerable")
+		}
+	}
+
+	if scf, err := querySystemFlags(systemSpeculationControlInformation); err != nil {
+		trace.fail("NtQuerySystemInformation", err)
+	} else {
+		switch {
+		case scf&scfBpbEnabled != 0 && scf&scfEnhancedIbrs != 0:
+			add("spectre_v2", "mitigated", "Mitigation: Enhanced IBRS")
+		case scf&scfBpbEnabled != 0 && scf&scfRetpolineEnabled != 0:
+			add("spectre_v2", "mitigated", "Mitigation: Retpolines, IBPB")
+		case scf&scfBpbEnabled != 0:
+			add("spectre_v2", "mitigated", "Mitigation: IBRS, IBPB")
+		case scf&scfBpbDisabledNoHardwareSupport != 0:
+			add("spectre_v2", "vulnerable", "Vulnerable: no microcode support")
+		case scf&scfBpbDisabledSystemPolicy != 0:
+			add("spectre_v2", "vulnerable", "Vulnerable: disabled by system policy")
+		default:
+			add("spectre_v2", "vulnerable", "Vulnerable")
+		}
+
+		switch {
+		case scf&scfSsbdAvailable == 0:
+		case scf&scfSsbdRequired == 0:
+			add("spec_store_bypass", "not_affected", "Not affected")
+		case scf&scfSsbdSystemWide != 0:
+			add("spec_store_bypass", "mitigated", "Mitigation: SSBD enabled system-wide")
+		case scf&scfSsbdSupported != 0:
+			add("spec_store_bypass", "mitigated", "Mitigation: SSBD available per process")
+		default:
+			add("spec_store_bypass", "vulnerable", "Vulnerable: no microcode support")
+		}
+
+		switch {
+		case scf&scfMbClearReported == 0:
+		case scf&scfMdsHardwareProtected != 0:
+			add("mds", "not_affected", "Not affected")
+		case scf&scfMbClearEnabled != 0:
+			add("mds", "mitigated", "Mitigation: Clear CPU buffers")
+		default:
+			add("mds", "vulnerable", "Vulnerable")
+		}
+	}
+	countVulnerable(&info)
+	info.Microcode = windowsMicrocode()
+	info.Firewall = windowsFirewall()
+
+	if len(info.CPUVulnerabilities) > 0 || info.Firewall.Name != "" {
+		trace.ok("NtQuerySystemInformation")
+		info.Status = "ok"
+	}
+	return info
+}
+
+// windowsMicrocode returns the "Update Revision" of the first processor:
+// 8 bytes with the revision in the upper half on Intel and the lower half
+// on AMD.
+func windowsMicrocode() string {
+	var key syscall.Handle
+	path, _ := syscall.UTF16PtrFromString(`HARDWARE\DESCRIPTION\System\CentralProcessor\0`)
+	if syscall.RegOpenKeyEx(syscall.HKEY_LOCAL_MACHINE, path, 0, syscall.KEY_READ, &key) != nil {
+		return ""
+	}
+	defer syscall.RegCloseKey(key)
+
+	name, _ := syscall.UTF16PtrFromString("Update Revision")
+	var valueType uint32
+	buf := make([]byte, 8)
+	size := uint32(len(buf))
+	if syscall.RegQueryValueEx(key, name, nil, &valueType, &buf[0], &size) != nil || size != 8 {
+		return ""
+	}
+	revision := binary.LittleEndian.Uint32(buf[4:])
+	if revision == 0 {
+		revision = binary.LittleEndian.Uint32(buf[:4])
+	}
+	if revision == 0 {
+		return ""
+	}
+	return fmt.Sprintf("0x%x", revision)
+}
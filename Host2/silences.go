@@ -0,0 +1,378 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Silence suppresses notifications for alerts whose ID matches the glob
+// pattern in Match until EndsAt. CreatedBy is the API key that created it
+// and the client's address.
+type Silence struct {
+	ID        string `json:"id"`
+	Match     string `json:"match"`
+	Comment   string `json:"comment"`
+	CreatedBy string `json:"created_by"`
+	CreatedAt string `json:"created_at"`
+	StartsAt  string `json:"starts_at"`
+	EndsAt    string `json:"ends_at"`
+}
+
+// SilenceAudit records who created or removed a silence, named like
+// Silence.CreatedBy.
+type SilenceAudit struct {
+	Time      string `json:"time"`
+	Action    string `json:"action"` // "create", "delete" or "expire"
+	SilenceID string `json:"silence_id"`
+	Match     string `json:"match"`
+	By        string `json:"by"`
+	Comment   string `json:"comment,omitempty"`
+}
+
+const (
+	// Number of audit entries kept
+	SILENCE_AUDIT_SIZE = 200
+	// State file next to the spool directory, so silences and their audit
+	// log survive restarts
+	SILENCES_FILE = "silences.json"
+)
+
+// silenceRecord is the content of the state file.
+type silenceRecord struct {
+	Silences []Silence      `json:"silences"`
+	Audit    []SilenceAudit `json:"audit"`
+}
+
+var (
+	silencesMu   sync.Mutex
+	silences     = make(map[string]*Silence)
+	silenceAudit []SilenceAudit
+	// Whether the state file has been read; silences are loaded on first use
+	silencesLoaded bool
+)
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+// isSilenced reports whether notifications for the alert are currently
+// suppressed by an API silence or a configured maintenance window.
+func isSilenced(alert Alert) (bool, string) {
+	now := time.Now().UTC()
+
+	silencesMu.Lock()
+	loadSilencesLocked()
+	expireSilencesLocked(now)
+	for _, s := range silences {
+		startsAt, _ := time.Parse(time.RFC3339, s.StartsAt)
+		if now.Before(startsAt) {
+			continue
+		}
+		if matchAlertID(s.Match, alert.ID) {
+			silencesMu.Unlock()
+			return true, fmt.Sprintf("silence %s by %s", s.ID, s.CreatedBy)
+		}
+	}
+	silencesMu.Unlock()
+
+	for _, window := range currentConfig().MaintenanceWindows {
+		if matchAlertID(window.Match, alert.ID) && window.activeAt(time.Now()) {
+			return true, fmt.Sprintf("maintenance window %s", window.Name)
+		}
+	}
+	return false, ""
+}
+
+// matchAlertID matches an alert ID against a glob where * matches any run
+// of characters (including "/" in mountpoints) and ? a single character.
+func matchAlertID(pattern, id string) bool {
+	expr := regexp.QuoteMeta(pattern)
+	expr = strings.ReplaceAll(expr, `\*`, ".*")
+	expr = strings.ReplaceAll(expr, `\?`, ".")
+	matched, _ := regexp.MatchString("^"+expr+"$", id)
+	return matched
+}
+
+// activeAt reports whether local time t falls inside the window. Windows
+// whose end is before their start wrap past midnight.
+func (w MaintenanceWindow) activeAt(t time.Time) bool {
+	start, _ := time.Parse("15:04", w.Start)
+	end, _ := time.Parse("15:04", w.End)
+	minute := t.Hour()*60 + t.Minute()
+	startMin := start.Hour()*60 + start.Minute()
+	endMin := end.Hour()*60 + end.Minute()
+
+	// A window that wraps midnight belongs to the day it started on
+	day := t.Weekday()
+	inWindow := minute >= startMin && minute < endMin
+	if endMin <= startMin {
+		inWindow = minute >= startMin || minute < endMin
+		if minute < endMin {
+			day = (day + 6) % 7
+		}
+	}
+	if !inWindow {
+		return false
+	}
+	if len(w.Days) == 0 {
+		return true
+	}
+	for _, d := range w.Days {
+		if weekdays[strings.ToLower(d)] == day {
+			return true
+		}
+	}
+	return false
+}
+
+func expireSilencesLocked(now time.Time) {
+	for id, s := range silences {
+		endsAt, err := time.Parse(time.RFC3339, s.EndsAt)
+		if err == nil && now.Before(endsAt) {
+			continue
+		}
+		delete(silences, id)
+		recordSilenceAuditLocked("expire", s, "system", "")
+	}
+}
+
+// recordSilenceAuditLocked appends to the audit log and saves the state
+// file, after the change to silences has been made.
+func recordSilenceAuditLocked(action string, s *Silence, by, comment string) {
+	silenceAudit = append(silenceAudit, SilenceAudit{
+		Time:      time.Now().UTC().Format(time.RFC3339),
+		Action:    action,
+		SilenceID: s.ID,
+		Match:     s.Match,
+		By:        by,
+		Comment:   comment,
+	})
+	if len(silenceAudit) > SILENCE_AUDIT_SIZE {
+		silenceAudit = silenceAudit[len(silenceAudit)-SILENCE_AUDIT_SIZE:]
+	}
+	log.Printf("[SILENCE] %s %s (match %q) by %s", action, s.ID, s.Match, by)
+	saveSilencesLocked()
+}
+
+// silencesPath returns the state file, next to the spool directory, or ""
+// if the executable cannot be found.
+func silencesPath() string {
+	root := spoolRoot(currentConfig().Spool)
+	if root == "" {
+		return ""
+	}
+	return filepath.Join(filepath.Dir(filepath.Clean(root)), SILENCES_FILE)
+}
+
+// loadSilencesLocked reads the state file once. Silences that ended while
+// the agent was stopped expire on the next check, like any other.
+func loadSilencesLocked() {
+	if silencesLoaded {
+		return
+	}
+	silencesLoaded = true
+	path := silencesPath()
+	if path == "" {
+		return
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Printf("[SILENCE] Failed to read %s: %v", path, err)
+		}
+		return
+	}
+	var record silenceRecord
+	if err := json.Unmarshal(data, &record); err != nil {
+		log.Printf("[SILENCE] Ignoring unreadable %s: %v", path, err)
+		return
+	}
+	for i := range record.Silences {
+		s := record.Silences[i]
+		silences[s.ID] = &s
+	}
+	silenceAudit = append(record.Audit, silenceAudit...)
+	if len(silenceAudit) > SILENCE_AUDIT_SIZE {
+		silenceAudit = silenceAudit[len(silenceAudit)-SILENCE_AUDIT_SIZE:]
+	}
+	log.Printf("[SILENCE] Loaded %d silences from %s", len(record.Silences), path)
+}
+
+// saveSilencesLocked replaces the state file through a rename, so a crash
+// mid-write keeps the previous state. Nothing is written in read-only mode.
+func saveSilencesLocked() {
+	path := silencesPath()
+	if path == "" || readOnlyMode {
+		return
+	}
+	record := silenceRecord{Silences: make([]Silence, 0, len(silences)), Audit: silenceAudit}
+	for _, s := range silences {
+		record.Silences = append(record.Silences, *s)
+	}
+	sort.Slice(record.Silences, func(i, j int) bool { return record.Silences[i].CreatedAt < record.Silences[j].CreatedAt })
+	data, err := json.MarshalIndent(record, "", "  ")
+	if err == nil {
+		tmp := path + ".tmp"
+		if err = os.WriteFile(tmp, append(data, '\n'), 0644); err == nil {
+			if err = os.Rename(tmp, path); err != nil {
+				os.Remove(tmp)
+			}
+		}
+	}
+	if err != nil {
+		log.Printf("[SILENCE] Failed to save %s: %v", path, err)
+	}
+}
+
+// silenceActor names who changes a silence: the API key requireAPIToken
+// accepted and the client's address. Names sent in the request are only
+// kept as comments, since anyone can claim any name.
+func silenceActor(r *http.Request) string {
+	name := "unknown"
+	if key := matchAPIKey(currentConfig().API, r); key != nil {
+		name = key.Name
+	}
+	return name + "@" + r.RemoteAddr
+}
+
+func newSilenceID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// silenceHandler manages silences:
+//
+//	GET    /alerts/silence          list active silences and the audit log
+//	POST   /alerts/silence          create {match, comment, created_by, duration_minutes | ends_at, starts_at}
+//	DELETE /alerts/silence?id=...   remove a silence (&by= adds a comment)
+//
+// Creating and removing need the API token (see requireAPIToken), and are
+// attributed to its key; created_by and by only end up in comments.
+//
+// listSilencesHandler returns active silences, maintenance windows and the
+// audit log.
+func listSilencesHandler(w http.ResponseWriter, r *http.Request) {
+	silencesMu.Lock()
+	loadSilencesLocked()
+	expireSilencesLocked(time.Now().UTC())
+	list := make([]Silence, 0, len(silences))
+	for _, s := range silences {
+		list = append(list, *s)
+	}
+	audit := append([]SilenceAudit{}, silenceAudit...)
+	silencesMu.Unlock()
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"silences":            list,
+		"maintenance_windows": currentConfig().MaintenanceWindows,
+		"audit":               audit,
+	})
+}
+
+func createSilenceHandler(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Match           string `json:"match"`
+		Comment         string `json:"comment"`
+		CreatedBy       string `json:"created_by"`
+		StartsAt        string `json:"starts_at"`
+		EndsAt          string `json:"ends_at"`
+		DurationMinutes int    `json:"duration_minutes"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid JSON: %v", err), http.StatusBadRequest)
+		return
+	}
+	if req.Match == "" {
+		http.Error(w, "match is required", http.StatusBadRequest)
+		return
+	}
+
+	now := time.Now().UTC()
+	startsAt := now
+	if req.StartsAt != "" {
+		t, err := time.Parse(time.RFC3339, req.StartsAt)
+		if err != nil {
+			http.Error(w, "starts_at must be RFC3339", http.StatusBadRequest)
+			return
+		}
+		startsAt = t.UTC()
+	}
+	var endsAt time.Time
+	switch {
+	case req.EndsAt != "":
+		t, err := time.Parse(time.RFC3339, req.EndsAt)
+		if err != nil {
+			http.Error(w, "ends_at must be RFC3339", http.StatusBadRequest)
+			return
+		}
+		endsAt = t.UTC()
+	case req.DurationMinutes > 0:
+		endsAt = startsAt.Add(time.Duration(req.DurationMinutes) * time.Minute)
+	default:
+		http.Error(w, "ends_at or duration_minutes is required", http.StatusBadRequest)
+		return
+	}
+	if !endsAt.After(now) || !endsAt.After(startsAt) {
+		http.Error(w, "silence must end in the future and after it starts", http.StatusBadRequest)
+		return
+	}
+
+	comment := req.Comment
+	if req.CreatedBy != "" {
+		comment = strings.TrimSpace(comment + " (created_by " + req.CreatedBy + ")")
+	}
+	createdBy := silenceActor(r)
+	silence := &Silence{
+		ID:        newSilenceID(),
+		Match:     req.Match,
+		Comment:   comment,
+		CreatedBy: createdBy,
+		CreatedAt: now.Format(time.RFC3339),
+		StartsAt:  startsAt.Format(time.RFC3339),
+		EndsAt:    endsAt.Format(time.RFC3339),
+	}
+
+	silencesMu.Lock()
+	loadSilencesLocked()
+	silences[silence.ID] = silence
+	recordSilenceAuditLocked("create", silence, createdBy, comment)
+	silencesMu.Unlock()
+
+	writeJSON(w, http.StatusCreated, silence)
+}
+
+func deleteSilenceHandler(w http.ResponseWriter, r *http.Request) {
+	id := r.URL.Query().Get("id")
+	comment := ""
+	if by := r.URL.Query().Get("by"); by != "" {
+		comment = "by " + by
+	}
+
+	silencesMu.Lock()
+	loadSilencesLocked()
+	silence, ok := silences[id]
+	if ok {
+		delete(silences, id)
+		recordSilenceAuditLocked("delete", silence, silenceActor(r), comment)
+	}
+	silencesMu.Unlock()
+
+	if !ok {
+		http.Error(w, "Silence not found", http.StatusNotFound)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"status": "deleted", "id": id})
+}
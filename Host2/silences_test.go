@@ -0,0 +1,83 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Silences and their audit log come back after a restart, attributed to
+// the API key rather than the name the client sent.
+func TestSilencesSurviveRestart(t *testing.T) {
+	dir := t.TempDir()
+	cfg := defaultConfig()
+	cfg.Spool.Dir = filepath.Join(dir, "spool")
+	cfg.API.Keys = []APIKey{{Name: "ops", Key: "ops-secret", Scope: "admin"}}
+	if err := cfg.validate(); err != nil {
+		t.Fatal(err)
+	}
+	previous := currentConfig()
+	applyConfig(cfg)
+	restart := func() {
+		silencesMu.Lock()
+		silences = make(map[string]*Silence)
+		silenceAudit = nil
+		silencesLoaded = false
+		silencesMu.Unlock()
+	}
+	t.Cleanup(func() {
+		restart()
+		if previous != nil {
+			applyConfig(previous)
+		}
+	})
+	restart()
+
+	body := `{"match": "dir_size:*", "duration_minutes": 120, "created_by": "alice", "comment": "nightly backup"}`
+	req := httptest.NewRequest("POST", "/alerts/silence", strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer ops-secret")
+	req.RemoteAddr = "192.0.2.10:52100"
+	rec := httptest.NewRecorder()
+	requireAPIToken(createSilenceHandler)(rec, req)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("create: %d %s", rec.Code, rec.Body)
+	}
+	var created Silence
+	json.Unmarshal(rec.Body.Bytes(), &created)
+	if created.CreatedBy != "ops@192.0.2.10:52100" || created.Comment != "nightly backup (created_by alice)" {
+		t.Errorf("created by %q with comment %q", created.CreatedBy, created.Comment)
+	}
+
+	restart()
+	if silenced, _ := isSilenced(Alert{ID: "dir_size:/var/backups"}); !silenced {
+		t.Fatal("silence lost on restart")
+	}
+
+	req = httptest.NewRequest("DELETE", "/alerts/silence?id="+created.ID+"&by=bob", nil)
+	req.Header.Set("X-API-Key", "ops-secret")
+	req.RemoteAddr = "192.0.2.11:40000"
+	rec = httptest.NewRecorder()
+	requireAPIToken(deleteSilenceHandler)(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("delete: %d %s", rec.Code, rec.Body)
+	}
+
+	restart()
+	rec = httptest.NewRecorder()
+	listSilencesHandler(rec, httptest.NewRequest("GET", "/alerts/silence", nil))
+	var list struct {
+		Silences []Silence      `json:"silences"`
+		Audit    []SilenceAudit `json:"audit"`
+	}
+	json.Unmarshal(rec.Body.Bytes(), &list)
+	if len(list.Silences) != 0 {
+		t.Errorf("deleted silence came back: %+v", list.Silences)
+	}
+	if len(list.Audit) != 2 || list.Audit[0].By != "ops@192.0.2.10:52100" || list.Audit[1].Action != "delete" ||
+		list.Audit[1].By != "ops@192.0.2.11:40000" || list.Audit[1].Comment != "by bob" {
+		t.Errorf("audit log %+v", list.Audit)
+	}
+}
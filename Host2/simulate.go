@@ -0,0 +1,190 @@
+package main
+
+import (
+	"math"
+	"math/rand"
+	"runtime"
+	"sync"
+	"time"
+)
+
+// Set by --simulate; snapshots are generated instead of read from the OS
+var simulateMode bool
+
+const (
+	SIM_CPU_PERIOD    = 10 * time.Minute
+	SIM_MEMORY_PERIOD = 30 * time.Minute
+	SIM_GPU_PERIOD    = 5 * time.Minute
+	// The root filesystem fills at this rate and is "cleaned up" at 97%
+	SIM_DISK_FILL_PERCENT_PER_HOUR = 2.5
+	// Chance per collection that a temperature spike starts
+	SIM_SPIKE_CHANCE = 0.05
+)
+
+var simState = struct {
+	sync.Mutex
+	started    time.Time
+	last       time.Time
+	rxBytes    uint64
+	txBytes    uint64
+	spikeUntil time.Time
+	load       [3]float64
+}{started: time.Now(), rxBytes: 52e9, txBytes: 13e9}
+
+// simWave is a sine between mid-amplitude and mid+amplitude with some
+// noise, clamped to [0, 100].
+func simWave(elapsed, period time.Duration, mid, amplitude, noise float64) float64 {
+	v := mid + amplitude*math.Sin(2*math.Pi*elapsed.Seconds()/period.Seconds()) + (rand.Float64()*2-1)*noise
+	return math.Max(0, math.Min(100, v))
+}
+
+// simulatedMetrics builds a plausible snapshot without touching the OS:
+// sinusoidal CPU, memory and GPU load, a slowly filling root filesystem,
+// steadily growing network counters and occasional CPU temperature spikes.
+// Background results (checks, log and directory watchers, exec plugins,
+// SNMP) are included as usual, and thresholds, alerts and history apply.
+func simulatedMetrics(plan *sectionPlan) *SystemMetrics {
+	simState.Lock()
+	defer simState.Unlock()
+	now := plan.now
+	elapsed := now.Sub(simState.started)
+	step := now.Sub(simState.last).Seconds()
+	if simState.last.IsZero() {
+		step = 0
+	}
+	simState.last = now
+
+	cpuUsage := simWave(elapsed, SIM_CPU_PERIOD, 45, 35, 5)
+	// Load averages follow the CPU like the kernel's exponential averages
+	for i, window := range []float64{60, 300, 900} {
+		target := cpuUsage / 100 * 8
+		weight := 1.0
+		if step > 0 {
+			weight = 1 - math.Exp(-step/window)
+		}
+		simState.load[i] += (target - simState.load[i]) * weight
+	}
+
+	memPercent := simWave(elapsed, SIM_MEMORY_PERIOD, 55, 10, 2)
+	const memTotal = 16384
+	memUsed := uint64(memTotal * memPercent / 100)
+
+	rootPercent := 62 + math.Mod(elapsed.Hours()*SIM_DISK_FILL_PERCENT_PER_HOUR, 35)
+	rxRate := 2e6 + 1e6*math.Sin(2*math.Pi*elapsed.Seconds()/SIM_CPU_PERIOD.Seconds())
+	simState.rxBytes += uint64(rxRate * step)
+	simState.txBytes += uint64(rxRate / 4 * step)
+
+	metrics := &SystemMetrics{
+		Timestamp: now.Format("2006-01-02T15:04:05Z"),
+		Platform:  runtime.GOOS,
+		Source:    "simulated",
+		Labels:    currentConfig().Labels,
+		System: SystemInfo{
+			OS:            "linux",
+			Hostname:      agentHostname(),
+			AgentID:       agentID(),
+			UptimeSeconds: uint64(3*24*3600 + elapsed.Seconds()),
+			Kernel:        "6.1.0-simulated",
+		},
+		Uptime: UptimeInfo{Boot: BootPerformance{Status: "unavailable"}, Availability: []AvailabilityWindow{}},
+		CPU: CPUInfo{
+			UsagePercent:      cpuUsage,
+			LogicalProcessors: 8,
+			Load1:             simState.load[0],
+			Load5:             simState.load[1],
+			Load15:            simState.load[2],
+			Vendor:            "GenuineIntel",
+			Model:             "Simulated CPU @ 3.00GHz",
+			Status:            "ok",
+		},
+		Memory: MemoryInfo{
+			TotalMB:      memTotal,
+			UsedMB:       memUsed,
+			FreeMB:       memTotal - memUsed,
+			AvailableMB:  memTotal - memUsed,
+			UsagePercent: memPercent,
+			Status:       "ok",
+		},
+		Disk: []DiskInfo{
+			{Device: "/", Filesystem: "ext4", TotalGB: 500, UsedGB: 500 * rootPercent / 100, UsedPercent: rootPercent},
+			{Device: "/data", Filesystem: "xfs", TotalGB: 2000, UsedGB: 800, UsedPercent: 40},
+		},
+		MissingMounts: []MissingMount{},
+		Network: []NetworkInfo{
+			{Iface: "eth0", RxBytes: simState.rxBytes, TxBytes: simState.txBytes},
+			{Iface: "lo", RxBytes: simState.txBytes / 10, TxBytes: simState.txBytes / 10},
+		},
+		Temperature:    TemperatureInfo{Status: "disabled", Drives: []DriveTemperature{}},
+		GPU:            GPUInfo{Status: "disabled", Devices: []GPUDevice{}},
+		Kernel:         KernelActivityInfo{Status: "disabled"},
+		EventLog:       EventLogInfo{Channels: []EventChannelCount{}, Status: "disabled"},
+		KernelLog:      KernelLogInfo{Status: "disabled"},
+		ZFS:            ZFSInfo{Pools: []ZFSPool{}, Status: "disabled"},
+		RAID:           RAIDInfo{Arrays: []MDArray{}, VolumeGroups: []LVMVolumeGroup{}, Status: "disabled"},
+		Sockets:        SocketsInfo{Status: "disabled"},
+		Security:       SecurityInfo{CPUVulnerabilities: []CPUVulnerability{}, AccessControl: []AccessControl{}, Status: "disabled"},
+		Updates:        UpdatesInfo{Sources: []UpdateSource{}, RebootReasons: []string{}, Status: "disabled"},
+		Users:          UsersInfo{Top: []UserUsage{}, Status: "disabled"},
+		Cgroups:        CgroupsInfo{Groups: []CgroupUsage{}, Status: "disabled"},
+		NUMA:           NUMAInfo{Nodes: []NUMANode{}, Status: "disabled"},
+		Hugepages:      HugepagesInfo{Pools: []HugepagePool{}, Status: "disabled"},
+		Entropy:        EntropyInfo{Status: "disabled"},
+		Limits:         LimitsInfo{Limits: []KernelLimit{}, Status: "disabled"},
+		DiskIO:         DiskIOInfo{Devices: []DiskDeviceIO{}, Status: "disabled"},
+		Quotas:         QuotasInfo{Entries: []QuotaEntry{}, Status: "disabled"},
+		HyperV:         HyperVInfo{VMs: []HyperVVM{}, Status: "disabled"},
+		PerfCounters:   PerfCountersInfo{Counters: []PerfCounterValue{}, Status: "disabled"},
+		ProcessWatch:   []WatchedProcess{},
+		ScheduledTasks: []ScheduledTaskInfo{},
+		FileMetrics:    []FileMetricValue{},
+		Degraded:       []CapabilityInfo{},
+	}
+	applyDiskForecasts(metrics.Disk)
+
+	gpuUsage := simWave(elapsed, SIM_GPU_PERIOD, 30, 30, 5)
+	if collectorEnabled("temperature") {
+		if now.After(simState.spikeUntil) && rand.Float64() < SIM_SPIKE_CHANCE {
+			simState.spikeUntil = now.Add(time.Duration(60+rand.Intn(60)) * time.Second)
+		}
+		cpuTemp := 42 + cpuUsage*0.3 + rand.Float64()*2
+		if now.Before(simState.spikeUntil) {
+			cpuTemp += 30
+		}
+		metrics.Temperature = TemperatureInfo{
+			CPUCelsius: int(cpuTemp),
+			CPUVendor:  "GenuineIntel",
+			GPUCelsius: int(45 + gpuUsage*0.35),
+			GPUVendor:  "NVIDIA",
+			Status:     "ok",
+			Drives:     []DriveTemperature{},
+		}
+		calibrateTemperatures(&metrics.Temperature)
+	}
+	if collectorEnabled("gpu") {
+		metrics.GPU = GPUInfo{Status: "ok", Count: 1, Devices: []GPUDevice{{
+			Vendor:             "NVIDIA",
+			Model:              "Simulated GPU",
+			UtilizationPercent: int(gpuUsage),
+			MemoryUsedMB:       int(8192 * gpuUsage / 100),
+			MemoryTotalMB:      8192,
+			TemperatureCelsius: int(45 + gpuUsage*0.35),
+			Status:             "ok",
+		}}}
+		calibrateGPUTemperatures(&metrics.GPU)
+	}
+
+	metrics.Checks = latestCheckResults()
+	metrics.LogWatch = latestLogWatchResults()
+	metrics.DirWatch = latestDirWatchResults()
+	metrics.Custom = latestExecResults()
+	metrics.SNMPDevices = latestSNMPDevices()
+	metrics.Alerts = currentAlerts()
+
+	applyStatusThresholds(metrics)
+	for _, name := range sampledSections {
+		plan.collected[name] = now
+		plan.trace(name).ok("simulated")
+	}
+	plan.finish(metrics)
+	return metrics
+}
@@ -0,0 +1,244 @@
+package main
+
+import (
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sync"
+	"time"
+)
+
+// sink delivers periodic snapshots to an external system. Snapshots are
+// encoded when collected and spooled until send succeeds, so every sink
+// type gets the same buffering, retry and at-least-once delivery.
+type sink interface {
+	name() string
+	encode(metrics *SystemMetrics) ([]byte, error)
+	send(batch [][]byte) error
+}
+
+// sinkQueue pairs a sink with its spool and delivery settings.
+type sinkQueue struct {
+	sink       sink
+	spool      *spool
+	batchSize  int
+	interval   time.Duration // minimum time between deliveries
+	maxBackoff time.Duration
+}
+
+var (
+	sinksMu sync.RWMutex
+	sinks   []*sinkQueue
+	// sinkStop is closed when sinks are rebuilt, stopping the delivery
+	// goroutines of the previous set
+	sinkStop = make(chan struct{})
+	// In-memory spools are kept across reloads so queued snapshots are not
+	// lost; on-disk spools are simply reopened
+	memorySpools = make(map[string]*spool)
+)
+
+var unsafeSpoolChars = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// spoolDir returns the directory for one sink's spool, or "" to keep it in
+// memory while file writing is disabled.
+func spoolDir(cfg SpoolConfig, sinkName string) string {
+	if readOnlyMode {
+		return ""
+	}
+	dir := spoolRoot(cfg)
+	if dir == "" {
+		return ""
+	}
+	return filepath.Join(dir, unsafeSpoolChars.ReplaceAllString(sinkName, "_"))
+}
+
+// spoolRoot returns spool.dir, by default "spool" next to the executable,
+// or "" if the executable cannot be found.
+func spoolRoot(cfg SpoolConfig) string {
+	if cfg.Dir != "" {
+		return cfg.Dir
+	}
+	exePath, err := os.Executable()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(filepath.Dir(exePath), "spool")
+}
+
+// initSinks builds the sink list from config and starts one delivery
+// goroutine per sink.
+func initSinks(cfg []SinkConfig, spoolCfg SpoolConfig) {
+	sinksMu.Lock()
+	defer sinksMu.Unlock()
+
+	close(sinkStop)
+	sinkStop = make(chan struct{})
+	sinks = nil
+	for _, c := range cfg {
+		var s sink
+		switch c.Type {
+		case "http":
+			s = &httpSink{cfg: c}
+		case "influxdb":
+			s = &influxSink{cfg: c}
+		case "zabbix":
+			s = &zabbixSink{cfg: c}
+		case "s3", "azure_blob":
+			s = newArchiveSink(c)
+		case "elasticsearch":
+			s = &elasticsearchSink{cfg: c}
+		case "nats":
+			s = &natsSink{cfg: c}
+		case "redis":
+			s = &redisSink{cfg: c}
+		case "mqtt":
+			s = &mqttSink{cfg: c}
+		case "kafka":
+			s = &kafkaSink{cfg: c}
+		case "syslog":
+			s = &syslogSink{cfg: c}
+		}
+
+		limit := int64(spoolCfg.MaxSizeMB) * 1024 * 1024
+		dir := spoolDir(spoolCfg, s.name())
+		var sp *spool
+		var err error
+		if dir == "" {
+			if sp = memorySpools[s.name()]; sp != nil {
+				sp.limit = limit
+			} else {
+				sp, _ = newSpool("", limit)
+				memorySpools[s.name()] = sp
+			}
+		} else if sp, err = newSpool(dir, limit); err != nil {
+			log.Printf("[SINK] Skipping %s: %v", s.name(), err)
+			continue
+		}
+
+		q := &sinkQueue{
+			sink:       s,
+			spool:      sp,
+			batchSize:  c.BatchSize,
+			interval:   time.Duration(c.IntervalSeconds) * time.Second,
+			maxBackoff: time.Duration(spoolCfg.MaxBackoffSeconds) * time.Second,
+		}
+		sinks = append(sinks, q)
+		go q.run(sinkStop)
+		queued, _, _ := sp.stats()
+		log.Printf("[SINK] Enabled %s (%d snapshots queued)", s.name(), queued)
+	}
+}
+
+// startSinks starts delivery and rebuilds the sinks on every reload. Only
+// the server delivers, so one-shot commands never touch the spools.
+func startSinks() {
+	reloaded := configReloaded()
+	cfg := currentConfig()
+	initSinks(cfg.Sinks, cfg.Spool)
+	go func() {
+		for {
+			<-reloaded
+			reloaded = configReloaded()
+			cfg := currentConfig()
+			initSinks(cfg.Sinks, cfg.Spool)
+		}
+	}()
+}
+
+// publishToSinks encodes a snapshot for every sink and spools it. Delivery
+// happens in the background.
+func publishToSinks(metrics *SystemMetrics) {
+	sinksMu.RLock()
+	defer sinksMu.RUnlock()
+	for _, q := range sinks {
+		data, err := q.sink.encode(metrics)
+		if err != nil {
+			log.Printf("[SINK] %s failed to encode snapshot: %v", q.sink.name(), err)
+			continue
+		}
+		if err := q.spool.push(data); err != nil {
+			log.Printf("[SINK] %s: %v", q.sink.name(), err)
+		}
+		if _, _, dropped := q.spool.stats(); dropped > 0 {
+			log.Printf("[SINK] %s spool full, dropped %d oldest snapshots", q.sink.name(), dropped)
+		}
+	}
+}
+
+// alertEncoder is implemented by sinks that also deliver alert events.
+type alertEncoder interface {
+	encodeAlert(event AlertEvent) ([]byte, error)
+}
+
+// publishAlertToSinks spools an alert event for every sink that accepts
+// them, so events share the snapshots' retry and ordering.
+func publishAlertToSinks(event AlertEvent) {
+	sinksMu.RLock()
+	defer sinksMu.RUnlock()
+	for _, q := range sinks {
+		encoder, ok := q.sink.(alertEncoder)
+		if !ok {
+			continue
+		}
+		data, err := encoder.encodeAlert(event)
+		if err != nil {
+			log.Printf("[SINK] %s failed to encode alert event: %v", q.sink.name(), err)
+			continue
+		}
+		if err := q.spool.push(data); err != nil {
+			log.Printf("[SINK] %s: %v", q.sink.name(), err)
+		}
+	}
+}
+
+// run delivers spooled batches until stop is closed, backing off
+// exponentially while the sink keeps failing. Sinks with an interval let
+// snapshots accumulate between deliveries, sending a backlog larger than
+// one batch without waiting.
+func (q *sinkQueue) run(stop <-chan struct{}) {
+	// Sinks holding a connection open release it once replaced
+	if c, ok := q.sink.(interface{ close() }); ok {
+		defer c.close()
+	}
+	backoff := time.Second
+	next := time.Now().Add(q.interval)
+	for {
+		if wait := time.Until(next); wait > 0 {
+			select {
+			case <-time.After(wait):
+			case <-stop:
+				return
+			}
+		}
+
+		batch, last := q.spool.peek(q.batchSize)
+		if len(batch) == 0 {
+			select {
+			case <-q.spool.wake:
+				continue
+			case <-stop:
+				return
+			}
+		}
+
+		if err := q.sink.send(batch); err != nil {
+			queued, _, _ := q.spool.stats()
+			log.Printf("[SINK] %s delivery failed (%d queued), retrying in %v: %v", q.sink.name(), queued, backoff, err)
+			select {
+			case <-time.After(backoff):
+			case <-stop:
+				return
+			}
+			if backoff *= 2; backoff > q.maxBackoff {
+				backoff = q.maxBackoff
+			}
+			continue
+		}
+		q.spool.ack(last)
+		backoff = time.Second
+		if queued, _, _ := q.spool.stats(); queued < q.batchSize {
+			next = time.Now().Add(q.interval)
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+)
+
+// objectStore is the part of an object storage service an archive needs.
+type objectStore interface {
+	put(key string, data []byte) error
+	// list returns the objects under prefix with their modification time
+	list(prefix string) (map[string]time.Time, error)
+	delete(key string) error
+}
+
+// archiveSink uploads batches of snapshots as gzipped NDJSON objects named
+// <prefix><agent id>/YYYY/MM/DD/<first>-<last>.ndjson.gz, and deletes
+// objects older than retention_days.
+type archiveSink struct {
+	cfg         SinkConfig
+	store       objectStore
+	lastCleanup time.Time
+}
+
+func newArchiveSink(c SinkConfig) *archiveSink {
+	s := &archiveSink{cfg: c}
+	switch c.Type {
+	case "s3":
+		s.store = newS3Store(c)
+	case "azure_blob":
+		s.store = &azureBlobStore{containerURL: c.URL}
+	}
+	return s
+}
+
+func (s *archiveSink) name() string { return s.cfg.Type + ":" + s.cfg.Name }
+
+func (s *archiveSink) encode(metrics *SystemMetrics) ([]byte, error) {
+	return json.Marshal(metrics)
+}
+
+func (s *archiveSink) send(batch [][]byte) error {
+	var first, last struct {
+		Timestamp string `json:"timestamp"`
+		System    struct {
+			AgentID string `json:"agent_id"`
+		} `json:"system"`
+	}
+	json.Unmarshal(batch[0], &first)
+	json.Unmarshal(batch[len(batch)-1], &last)
+	from, err := time.Parse("2006-01-02T15:04:05Z", first.Timestamp)
+	if err != nil {
+		return fmt.Errorf("corrupt spooled snapshot: %v", err)
+	}
+	to, err := time.Parse("2006-01-02T15:04:05Z", last.Timestamp)
+	if err != nil {
+		to = from
+	}
+
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	for _, data := range batch {
+		gz.Write(data)
+		gz.Write([]byte{'\n'})
+	}
+	if err := gz.Close(); err != nil {
+		return err
+	}
+
+	dir := s.cfg.Prefix + first.System.AgentID + "/"
+	key := dir + from.Format("2006/01/02/") + from.Format("20060102T150405Z") + "-" + to.Format("20060102T150405Z") + ".ndjson.gz"
+	if err := s.store.put(key, buf.Bytes()); err != nil {
+		return err
+	}
+
+	if s.cfg.RetentionDays > 0 && time.Since(s.lastCleanup) > 24*time.Hour {
+		s.lastCleanup = time.Now()
+		go s.cleanup(dir)
+	}
+	return nil
+}
+
+// cleanup deletes this agent's archives older than the retention. Errors
+// are only logged; the next upload a day later tries again.
+func (s *archiveSink) cleanup(dir string) {
+	objects, err := s.store.list(dir)
+	if err != nil {
+		log.Printf("[SINK] %s retention: listing %s: %v", s.name(), dir, err)
+		return
+	}
+	cutoff := time.Now().AddDate(0, 0, -s.cfg.RetentionDays)
+	deleted := 0
+	for key, modified := range objects {
+		if modified.After(cutoff) {
+			continue
+		}
+		if err := s.store.delete(key); err != nil {
+			log.Printf("[SINK] %s retention: deleting %s: %v", s.name(), key, err)
+			return
+		}
+		deleted++
+	}
+	if deleted > 0 {
+		log.Printf("[SINK] %s retention: deleted %d archives older than %d days", s.name(), deleted, s.cfg.RetentionDays)
+	}
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// elasticsearchSink bulk-indexes snapshots into daily indices
+// (<index>-YYYY.MM.DD) of an Elasticsearch or OpenSearch cluster at url,
+// installing an index template first so every number maps to double and
+// every string to keyword.
+type elasticsearchSink struct {
+	cfg       SinkConfig
+	templated bool
+}
+
+// Dynamic mappings would type a field by its first value, so a CPU usage of
+// exactly 0 would make the field a long; free-form plugin output is kept in
+// _source but not indexed, so it cannot cause mapping conflicts.
+var elasticsearchTemplate = map[string]interface{}{
+	"priority": 100,
+	"template": map[string]interface{}{
+		"mappings": map[string]interface{}{
+			"dynamic_templates": []interface{}{
+				map[string]interface{}{"numbers": map[string]interface{}{
+					"match_mapping_type": "long",
+					"mapping":            map[string]interface{}{"type": "double"},
+				}},
+				map[string]interface{}{"floats": map[string]interface{}{
+					"match_mapping_type": "double",
+					"mapping":            map[string]interface{}{"type": "double"},
+				}},
+				map[string]interface{}{"strings": map[string]interface{}{
+					"match_mapping_type": "string",
+					"mapping":            map[string]interface{}{"type": "keyword", "ignore_above": 1024},
+				}},
+			},
+			"properties": map[string]interface{}{
+				"@timestamp": map[string]interface{}{"type": "date"},
+				"timestamp":  map[string]interface{}{"type": "date"},
+				"custom":     map[string]interface{}{"type": "object", "dynamic": false},
+			},
+		},
+	},
+}
+
+func (s *elasticsearchSink) name() string { return "elasticsearch:" + s.cfg.Name }
+
+// encode renders the bulk action and document lines for one snapshot. The
+// document ID is derived from the agent and the collection time, so a
+// batch resent after a failure overwrites instead of duplicating.
+func (s *elasticsearchSink) encode(metrics *SystemMetrics) ([]byte, error) {
+	at, err := time.Parse("2006-01-02T15:04:05Z", metrics.Timestamp)
+	if err != nil {
+		at = time.Now().UTC()
+	}
+	action, err := json.Marshal(map[string]interface{}{"index": map[string]string{
+		"_index": s.cfg.Index + "-" + at.Format("2006.01.02"),
+		"_id":    fmt.Sprintf("%s-%d", metrics.System.AgentID, at.Unix()),
+	}})
+	if err != nil {
+		return nil, err
+	}
+	doc, err := json.Marshal(struct {
+		Timestamp string `json:"@timestamp"`
+		*SystemMetrics
+	}{metrics.Timestamp, metrics})
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	buf.Write(action)
+	buf.WriteByte('\n')
+	buf.Write(doc)
+	buf.WriteByte('\n')
+	return buf.Bytes(), nil
+}
+
+func (s *elasticsearchSink) send(batch [][]byte) error {
+	base := strings.TrimRight(s.cfg.URL, "/")
+	if !s.templated {
+		template := map[string]interface{}{"index_patterns": []string{s.cfg.Index + "-*"}}
+		for k, v := range elasticsearchTemplate {
+			template[k] = v
+		}
+		body, _ := json.Marshal(template)
+		if _, err := s.request(http.MethodPut, base+"/_index_template/"+s.cfg.Index, "application/json", body); err != nil {
+			return fmt.Errorf("installing index template: %v", err)
+		}
+		s.templated = true
+	}
+
+	response, err := s.request(http.MethodPost, base+"/_bulk", "application/x-ndjson", bytes.Join(batch, nil))
+	if err != nil {
+		return err
+	}
+
+	var result struct {
+		Errors bool `json:"errors"`
+		Items  []map[string]struct {
+			Status int `json:"status"`
+			Error  struct {
+				Type   string `json:"type"`
+				Reason string `json:"reason"`
+			} `json:"error"`
+		} `json:"items"`
+	}
+	if err := json.Unmarshal(response, &result); err != nil {
+		return fmt.Errorf("invalid bulk response: %v", err)
+	}
+	if !result.Errors {
+		return nil
+	}
+	// Rejections under load are retried with the whole batch; documents
+	// the cluster refuses outright would fail again, so they are dropped
+	for _, item := range result.Items {
+		for _, outcome := range item {
+			switch {
+			case outcome.Status == http.StatusTooManyRequests || outcome.Status >= 500:
+				return fmt.Errorf("bulk item rejected with status %d: %s", outcome.Status, outcome.Error.Reason)
+			case outcome.Status >= 300:
+				log.Printf("[SINK] %s dropped a snapshot: %s: %s", s.name(), outcome.Error.Type, outcome.Error.Reason)
+			}
+		}
+	}
+	return nil
+}
+
+// request sends body with the configured headers and returns the response
+// body, treating non-2xx statuses as errors.
+func (s *elasticsearchSink) request(method, url, contentType string, body []byte) ([]byte, error) {
+	req, err := http.NewRequest(method, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", contentType)
+	for k, v := range s.cfg.Headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := notifyHTTPClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 16*1024*1024))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		if len(data) > 512 {
+			data = data[:512]
+		}
+		return nil, fmt.Errorf("unexpected status %d: %s", resp.StatusCode, strings.TrimSpace(string(data)))
+	}
+	return data, nil
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+)
+
+// httpSink POSTs batches of snapshots as a JSON array.
+type httpSink struct {
+	cfg SinkConfig
+}
+
+func (s *httpSink) name() string { return "http:" + s.cfg.Name }
+
+func (s *httpSink) encode(metrics *SystemMetrics) ([]byte, error) {
+	return json.Marshal(metrics)
+}
+
+func (s *httpSink) send(batch [][]byte) error {
+	body := append([]byte{'['}, bytes.Join(batch, []byte{','})...)
+	body = append(body, ']')
+
+	contentType := "application/json"
+	headers := make(map[string]string, len(s.cfg.Headers))
+	for k, v := range s.cfg.Headers {
+		if strings.EqualFold(k, "Content-Type") {
+			contentType = v
+			continue
+		}
+		headers[k] = v
+	}
+	return postRaw(s.cfg.URL, contentType, headers, body)
+}
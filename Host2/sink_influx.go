@@ -0,0 +1,72 @@
+package main
+
+import (
+	"bytes"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// influxSink writes snapshots in InfluxDB line protocol to a write
+// endpoint, e.g. http://influx:8086/api/v2/write?org=o&bucket=b&precision=ns
+// (with an Authorization header) or /write?db=metrics for 1.x.
+type influxSink struct {
+	cfg SinkConfig
+}
+
+var influxTagEscaper = strings.NewReplacer(",", `\,`, "=", `\=`, " ", `\ `)
+
+func (s *influxSink) name() string { return "influxdb:" + s.cfg.Name }
+
+// encode renders every history metric as one line, tagged with the host,
+// agent ID, the static labels and the sample's labels.
+func (s *influxSink) encode(metrics *SystemMetrics) ([]byte, error) {
+	at, err := time.Parse("2006-01-02T15:04:05Z", metrics.Timestamp)
+	if err != nil {
+		at = time.Now()
+	}
+	ts := strconv.FormatInt(at.UnixNano(), 10)
+
+	var buf bytes.Buffer
+	for _, sample := range flattenMetrics(metrics) {
+		if math.IsNaN(sample.Value) || math.IsInf(sample.Value, 0) {
+			continue
+		}
+		buf.WriteString(influxTagEscaper.Replace(sample.Name))
+		if metrics.System.Hostname != "" {
+			buf.WriteString(",host=" + influxTagEscaper.Replace(metrics.System.Hostname))
+		}
+		if metrics.System.AgentID != "" {
+			buf.WriteString(",agent_id=" + metrics.System.AgentID)
+		}
+		// Static labels first, so a sample label of the same name wins
+		tags := make(map[string]string, len(metrics.Labels)+len(sample.Labels))
+		for k, v := range metrics.Labels {
+			tags[k] = v
+		}
+		for k, v := range sample.Labels {
+			tags[k] = v
+		}
+		keys := make([]string, 0, len(tags))
+		for k := range tags {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			if tags[k] == "" {
+				continue
+			}
+			buf.WriteString("," + influxTagEscaper.Replace(k) + "=" + influxTagEscaper.Replace(tags[k]))
+		}
+		buf.WriteString(" value=")
+		buf.WriteString(strconv.FormatFloat(sample.Value, 'f', -1, 64))
+		buf.WriteString(" " + ts + "\n")
+	}
+	return buf.Bytes(), nil
+}
+
+func (s *influxSink) send(batch [][]byte) error {
+	return postRaw(s.cfg.URL, "text/plain; charset=utf-8", s.cfg.Headers, bytes.Join(batch, nil))
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/segmentio/kafka-go/sasl/plain"
+)
+
+// kafkaSink produces every snapshot as one JSON record on a Kafka topic,
+// keyed by the agent ID so a host's snapshots stay in order on one
+// partition.
+type kafkaSink struct {
+	cfg SinkConfig
+}
+
+func (s *kafkaSink) name() string { return "kafka:" + s.cfg.Name }
+
+func (s *kafkaSink) encode(metrics *SystemMetrics) ([]byte, error) {
+	return json.Marshal(metrics)
+}
+
+// send produces the batch with acks from all in-sync replicas, so it only
+// counts as delivered once the cluster has it. Retries are left to the
+// spool. Every delivery connects anew: the client keeps background
+// goroutines per connection that nothing would stop once a reload replaces
+// the sink.
+func (s *kafkaSink) send(batch [][]byte) error {
+	brokers, transport, err := s.transport()
+	if err != nil {
+		return err
+	}
+	defer transport.CloseIdleConnections()
+
+	writer := &kafka.Writer{
+		Addr:         kafka.TCP(brokers...),
+		Topic:        s.cfg.Topic,
+		Balancer:     &kafka.Hash{},
+		RequiredAcks: kafka.RequireAll,
+		MaxAttempts:  1,
+		BatchSize:    len(batch),
+		WriteTimeout: 30 * time.Second,
+		Transport:    transport,
+	}
+	defer writer.Close()
+
+	key := []byte(agentID())
+	messages := make([]kafka.Message, len(batch))
+	for i, data := range batch {
+		messages[i] = kafka.Message{Key: key, Value: data}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+	return writer.WriteMessages(ctx, messages...)
+}
+
+// transport reads the bootstrap brokers from a kafka://host1:9092,host2
+// URL, using TLS for kafkas:// and SASL/PLAIN with the user name and
+// password of the URL. The broker list is split by hand, since url.Parse
+// rejects a port anywhere but at the end of the host.
+func (s *kafkaSink) transport() ([]string, *kafka.Transport, error) {
+	scheme, rest, _ := strings.Cut(s.cfg.URL, "://")
+	var user *url.Userinfo
+	if i := strings.LastIndex(rest, "@"); i >= 0 {
+		parsed, err := url.Parse("kafka://" + rest[:i] + "@broker")
+		if err != nil {
+			return nil, nil, err
+		}
+		user, rest = parsed.User, rest[i+1:]
+	}
+	var brokers []string
+	for _, host := range strings.Split(strings.TrimSuffix(rest, "/"), ",") {
+		if host == "" {
+			return nil, nil, fmt.Errorf("empty broker address in %q", rest)
+		}
+		if _, _, err := net.SplitHostPort(host); err != nil {
+			host = net.JoinHostPort(host, "9092")
+		}
+		brokers = append(brokers, host)
+	}
+
+	transport := &kafka.Transport{
+		DialTimeout: 10 * time.Second,
+		ClientID:    "host-agent",
+	}
+	if scheme == "kafkas" {
+		transport.TLS = &tls.Config{}
+	}
+	if user != nil {
+		password, _ := user.Password()
+		transport.SASL = plain.Mechanism{Username: user.Username(), Password: password}
+	}
+	return brokers, transport, nil
+}
@@ -0,0 +1,249 @@
+package main
+
+import (
+	"bufio"
+	"crypto/tls"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"time"
+)
+
+// MQTT 3.1.1 control packet types, shifted into the fixed header's high
+// nibble
+const (
+	MQTT_CONNECT  = 1 << 4
+	MQTT_CONNACK  = 2 << 4
+	MQTT_PUBLISH  = 3 << 4
+	MQTT_PUBACK   = 4 << 4
+	MQTT_PINGREQ  = 12 << 4
+	MQTT_PINGRESP = 13 << 4
+	// Largest remaining length the four-byte varint can express
+	MQTT_MAX_PACKET = 268435455
+	// Longest packet accepted from the broker; it only sends acknowledgements
+	MQTT_MAX_INCOMING = 64 * 1024
+)
+
+var mqttConnackErrors = map[byte]string{
+	1: "unacceptable protocol version",
+	2: "client identifier rejected",
+	3: "server unavailable",
+	4: "bad user name or password",
+	5: "not authorized",
+}
+
+// mqttSink publishes every snapshot as one JSON message on an MQTT topic,
+// speaking MQTT 3.1.1 over a connection that is kept open between
+// deliveries.
+type mqttSink struct {
+	cfg      SinkConfig
+	conn     net.Conn
+	reader   *bufio.Reader
+	packetID uint16
+}
+
+func (s *mqttSink) name() string { return "mqtt:" + s.cfg.Name }
+
+func (s *mqttSink) encode(metrics *SystemMetrics) ([]byte, error) {
+	return json.Marshal(metrics)
+}
+
+// send publishes the batch and waits for the broker to confirm it: a PUBACK
+// per message at QoS 1, or a PINGRESP after the last one at QoS 0, which
+// the broker only sends once it has processed every PUBLISH before it.
+func (s *mqttSink) send(batch [][]byte) error {
+	if s.conn == nil {
+		if err := s.connect(); err != nil {
+			return err
+		}
+	}
+	err := s.publish(batch)
+	if err != nil {
+		s.close()
+	}
+	return err
+}
+
+func (s *mqttSink) publish(batch [][]byte) error {
+	s.conn.SetDeadline(time.Now().Add(30 * time.Second))
+	w := bufio.NewWriter(s.conn)
+	pending := map[uint16]bool{}
+	for _, data := range batch {
+		body := mqttString(s.cfg.Topic)
+		flags := byte(0)
+		if s.cfg.QoS == 1 {
+			s.packetID++
+			if s.packetID == 0 {
+				s.packetID = 1
+			}
+			pending[s.packetID] = true
+			body = binary.BigEndian.AppendUint16(body, s.packetID)
+			flags = 1 << 1
+		}
+		if err := writeMQTTPacket(w, MQTT_PUBLISH|flags, append(body, data...)); err != nil {
+			return err
+		}
+	}
+	if s.cfg.QoS == 0 {
+		writeMQTTPacket(w, MQTT_PINGREQ, nil)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	for s.cfg.QoS == 0 || len(pending) > 0 {
+		kind, body, err := readMQTTPacket(s.reader)
+		if err != nil {
+			return err
+		}
+		switch {
+		case kind == MQTT_PINGRESP && s.cfg.QoS == 0:
+			return nil
+		case kind == MQTT_PUBACK && len(body) == 2:
+			delete(pending, binary.BigEndian.Uint16(body))
+		}
+	}
+	return nil
+}
+
+// connect dials the server, using TLS for mqtts:// URLs, and authenticates
+// with the user name and password of the URL. The session is clean, so the
+// broker keeps nothing for the agent while it is disconnected, and keepalive
+// is off because deliveries can be further apart than any sensible interval.
+func (s *mqttSink) connect() error {
+	parsed, err := url.Parse(s.cfg.URL)
+	if err != nil {
+		return err
+	}
+	port := "1883"
+	if parsed.Scheme == "mqtts" {
+		port = "8883"
+	}
+	address := parsed.Host
+	if parsed.Port() == "" {
+		address = net.JoinHostPort(parsed.Hostname(), port)
+	}
+	conn, err := net.DialTimeout("tcp", address, 10*time.Second)
+	if err != nil {
+		return err
+	}
+	if parsed.Scheme == "mqtts" {
+		tlsConn := tls.Client(conn, &tls.Config{ServerName: parsed.Hostname()})
+		tlsConn.SetDeadline(time.Now().Add(30 * time.Second))
+		if err := tlsConn.Handshake(); err != nil {
+			conn.Close()
+			return fmt.Errorf("TLS handshake: %v", err)
+		}
+		conn = tlsConn
+	}
+	conn.SetDeadline(time.Now().Add(30 * time.Second))
+	s.conn = conn
+	s.reader = bufio.NewReader(conn)
+
+	// Protocol name, level 4 (3.1.1), clean session, keepalive 0
+	body := append(mqttString("MQTT"), 4, 1<<1, 0, 0)
+	// Servers must accept client IDs of up to 23 characters
+	clientID := "host-agent-" + agentID()
+	if len(clientID) > 23 {
+		clientID = clientID[:23]
+	}
+	payload := mqttString(clientID)
+	if user := parsed.User; user != nil {
+		body[len(body)-3] |= 1 << 7
+		payload = append(payload, mqttString(user.Username())...)
+		if password, ok := user.Password(); ok {
+			body[len(body)-3] |= 1 << 6
+			payload = append(payload, mqttString(password)...)
+		}
+	}
+	if err := writeMQTTPacket(conn, MQTT_CONNECT, append(body, payload...)); err != nil {
+		s.close()
+		return err
+	}
+
+	kind, ack, err := readMQTTPacket(s.reader)
+	if err != nil {
+		s.close()
+		return fmt.Errorf("reading CONNACK: %v", err)
+	}
+	if kind != MQTT_CONNACK || len(ack) != 2 {
+		s.close()
+		return fmt.Errorf("unexpected packet type %d instead of CONNACK", kind>>4)
+	}
+	if code := ack[1]; code != 0 {
+		s.close()
+		if reason, ok := mqttConnackErrors[code]; ok {
+			return fmt.Errorf("connection refused: %s", reason)
+		}
+		return fmt.Errorf("connection refused with code %d", code)
+	}
+	return nil
+}
+
+func (s *mqttSink) close() {
+	if s.conn != nil {
+		s.conn.Close()
+		s.conn = nil
+	}
+}
+
+// mqttString encodes a UTF-8 string with its two-byte length prefix.
+func mqttString(value string) []byte {
+	return append(binary.BigEndian.AppendUint16(nil, uint16(len(value))), value...)
+}
+
+// writeMQTTPacket writes a fixed header with the variable-length remaining
+// length, followed by the body.
+func writeMQTTPacket(w io.Writer, header byte, body []byte) error {
+	if len(body) > MQTT_MAX_PACKET {
+		return fmt.Errorf("packet of %d bytes exceeds the MQTT limit", len(body))
+	}
+	packet := []byte{header}
+	for n := len(body); ; {
+		digit := byte(n % 128)
+		n /= 128
+		if n > 0 {
+			digit |= 0x80
+		}
+		packet = append(packet, digit)
+		if n == 0 {
+			break
+		}
+	}
+	_, err := w.Write(append(packet, body...))
+	return err
+}
+
+// readMQTTPacket reads one control packet and returns its type, with the
+// flags masked off, and its body.
+func readMQTTPacket(r *bufio.Reader) (byte, []byte, error) {
+	header, err := r.ReadByte()
+	if err != nil {
+		return 0, nil, err
+	}
+	length, shift := 0, 0
+	for {
+		digit, err := r.ReadByte()
+		if err != nil {
+			return 0, nil, err
+		}
+		length |= int(digit&0x7f) << shift
+		if digit&0x80 == 0 {
+			break
+		}
+		if shift += 7; shift > 21 {
+			return 0, nil, fmt.Errorf("malformed remaining length")
+		}
+	}
+	if length > MQTT_MAX_INCOMING {
+		return 0, nil, fmt.Errorf("packet of %d bytes too long", length)
+	}
+	body := make([]byte, length)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return 0, nil, err
+	}
+	return header & 0xf0, body, nil
+}
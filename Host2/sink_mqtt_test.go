@@ -0,0 +1,98 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"net"
+	"strings"
+	"testing"
+)
+
+// fakeBroker accepts one connection, answers CONNACK with code and then
+// acknowledges every PUBLISH and PINGREQ, recording what it received.
+type fakeBroker struct {
+	listener net.Listener
+	code     byte
+	connect  chan []byte
+	messages chan string
+}
+
+func newFakeBroker(t *testing.T, code byte) *fakeBroker {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Skipf("cannot listen: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	b := &fakeBroker{listener: listener, code: code, connect: make(chan []byte, 1), messages: make(chan string, 10)}
+	go b.serve()
+	return b
+}
+
+func (b *fakeBroker) serve() {
+	conn, err := b.listener.Accept()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+	for {
+		header, err := reader.Peek(1)
+		if err != nil {
+			return
+		}
+		flags := header[0] & 0x0f
+		kind, body, err := readMQTTPacket(reader)
+		if err != nil {
+			return
+		}
+		switch kind {
+		case MQTT_CONNECT:
+			b.connect <- body
+			writeMQTTPacket(conn, MQTT_CONNACK, []byte{0, b.code})
+		case MQTT_PUBLISH:
+			topicLength := int(binary.BigEndian.Uint16(body))
+			topic, rest := string(body[2:2+topicLength]), body[2+topicLength:]
+			if flags&0x06 != 0 {
+				writeMQTTPacket(conn, MQTT_PUBACK, rest[:2])
+				rest = rest[2:]
+			}
+			b.messages <- topic + " " + string(rest)
+		case MQTT_PINGREQ:
+			writeMQTTPacket(conn, MQTT_PINGRESP, nil)
+		}
+	}
+}
+
+func TestMQTTSinkPublishes(t *testing.T) {
+	for _, qos := range []int{0, 1} {
+		broker := newFakeBroker(t, 0)
+		s := &mqttSink{cfg: SinkConfig{URL: "mqtt://agent:secret@" + broker.listener.Addr().String(), Topic: "hosts/metrics", QoS: qos}}
+		if err := s.send([][]byte{[]byte(`{"a":1}`), []byte(`{"a":2}`)}); err != nil {
+			t.Fatalf("qos %d: send: %v", qos, err)
+		}
+		s.close()
+
+		connect := string(<-broker.connect)
+		if !strings.HasPrefix(connect, "\x00\x04MQTT\x04") || !strings.HasSuffix(connect, "\x00\x05agent\x00\x06secret") {
+			t.Errorf("qos %d: CONNECT body %q", qos, connect)
+		}
+		for _, want := range []string{`hosts/metrics {"a":1}`, `hosts/metrics {"a":2}`} {
+			if got := <-broker.messages; got != want {
+				t.Errorf("qos %d: published %q, want %q", qos, got, want)
+			}
+		}
+	}
+}
+
+func TestMQTTSinkRefused(t *testing.T) {
+	broker := newFakeBroker(t, 4)
+	s := &mqttSink{cfg: SinkConfig{URL: "mqtt://" + broker.listener.Addr().String(), Topic: "hosts/metrics"}}
+	err := s.send([][]byte{[]byte(`{}`)})
+	if err == nil || !strings.Contains(err.Error(), "bad user name or password") {
+		t.Fatalf("send error %v, want a refused connection", err)
+	}
+	if s.conn != nil {
+		t.Errorf("connection left open after a refusal")
+	}
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"bufio"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// redisSink publishes every snapshot as JSON to a Redis pub/sub channel
+// and/or appends it to a capped stream, pipelining the whole batch over a
+// connection that is kept open between deliveries.
+type redisSink struct {
+	cfg    SinkConfig
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+func (s *redisSink) name() string { return "redis:" + s.cfg.Name }
+
+func (s *redisSink) encode(metrics *SystemMetrics) ([]byte, error) {
+	return json.Marshal(metrics)
+}
+
+func (s *redisSink) send(batch [][]byte) error {
+	if s.conn == nil {
+		if err := s.connect(); err != nil {
+			return err
+		}
+	}
+	var commands [][]string
+	for _, data := range batch {
+		if s.cfg.Channel != "" {
+			commands = append(commands, []string{"PUBLISH", s.cfg.Channel, string(data)})
+		}
+		if s.cfg.Stream != "" {
+			commands = append(commands, []string{"XADD", s.cfg.Stream, "MAXLEN", "~", strconv.Itoa(s.cfg.MaxLen), "*", "snapshot", string(data)})
+		}
+	}
+	err := s.pipeline(commands)
+	if err != nil {
+		s.close()
+	}
+	return err
+}
+
+// pipeline writes all commands before reading any reply and fails on the
+// first error reply.
+func (s *redisSink) pipeline(commands [][]string) error {
+	s.conn.SetDeadline(time.Now().Add(30 * time.Second))
+	w := bufio.NewWriter(s.conn)
+	for _, args := range commands {
+		fmt.Fprintf(w, "*%d\r\n", len(args))
+		for _, arg := range args {
+			fmt.Fprintf(w, "$%d\r\n%s\r\n", len(arg), arg)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	var failed error
+	for _, args := range commands {
+		if err := s.readReply(); err != nil {
+			if _, ok := err.(redisError); !ok {
+				return err
+			}
+			if failed == nil {
+				failed = fmt.Errorf("%s: %v", args[0], err)
+			}
+		}
+	}
+	return failed
+}
+
+// redisError is an error reply; the connection is still usable after it.
+type redisError string
+
+func (e redisError) Error() string { return string(e) }
+
+// readReply consumes one RESP reply, returning error replies as redisError.
+func (s *redisSink) readReply() error {
+	line, err := s.reader.ReadString('\n')
+	if err != nil {
+		return err
+	}
+	line = strings.TrimRight(line, "\r\n")
+	if line == "" {
+		return fmt.Errorf("empty reply")
+	}
+	switch line[0] {
+	case '+', ':':
+		return nil
+	case '-':
+		return redisError(line[1:])
+	case '$':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return fmt.Errorf("invalid bulk length %q", line)
+		}
+		if n < 0 {
+			return nil
+		}
+		_, err = s.reader.Discard(n + 2)
+		return err
+	case '*':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return fmt.Errorf("invalid array length %q", line)
+		}
+		for i := 0; i < n; i++ {
+			if err := s.readReply(); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return fmt.Errorf("unexpected reply %q", line)
+}
+
+// connect dials redis://[user:password@]host[:port][/db], or rediss://
+// for TLS, then authenticates and selects the database.
+func (s *redisSink) connect() error {
+	parsed, err := url.Parse(s.cfg.URL)
+	if err != nil {
+		return err
+	}
+	address := parsed.Host
+	if parsed.Port() == "" {
+		address = net.JoinHostPort(parsed.Hostname(), "6379")
+	}
+	dialer := &net.Dialer{Timeout: 10 * time.Second}
+	var conn net.Conn
+	if parsed.Scheme == "rediss" {
+		conn, err = tls.DialWithDialer(dialer, "tcp", address, &tls.Config{ServerName: parsed.Hostname()})
+	} else {
+		conn, err = dialer.Dial("tcp", address)
+	}
+	if err != nil {
+		return err
+	}
+	s.conn = conn
+	s.reader = bufio.NewReader(conn)
+
+	var setup [][]string
+	if user := parsed.User; user != nil {
+		if password, ok := user.Password(); ok {
+			if user.Username() != "" {
+				setup = append(setup, []string{"AUTH", user.Username(), password})
+			} else {
+				setup = append(setup, []string{"AUTH", password})
+			}
+		}
+	}
+	if db := strings.Trim(parsed.Path, "/"); db != "" && db != "0" {
+		setup = append(setup, []string{"SELECT", db})
+	}
+	if err := s.pipeline(setup); err != nil {
+		s.close()
+		return err
+	}
+	return nil
+}
+
+func (s *redisSink) close() {
+	if s.conn != nil {
+		s.conn.Close()
+		s.conn = nil
+	}
+}
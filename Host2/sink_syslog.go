@@ -0,0 +1,191 @@
+package main
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Structured data IDs use the example enterprise number reserved by RFC 5612
+const SYSLOG_SD_SUFFIX = "@32473"
+
+// Local syslog sockets, tried in order when the sink has no url
+var syslogLocalSockets = []string{"/dev/log", "/var/run/syslog", "/var/run/log"}
+
+var syslogFacilities = map[string]int{
+	"kern": 0, "user": 1, "mail": 2, "daemon": 3, "auth": 4, "syslog": 5,
+	"lpr": 6, "news": 7, "uucp": 8, "cron": 9, "authpriv": 10, "ftp": 11,
+	"local0": 16, "local1": 17, "local2": 18, "local3": 19,
+	"local4": 20, "local5": 21, "local6": 22, "local7": 23,
+}
+
+var syslogParamEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, `]`, `\]`)
+
+// syslogSink writes RFC 5424 messages: a one-line summary per snapshot and
+// one message per alert event, over UDP, TCP, TLS or the local socket.
+type syslogSink struct {
+	cfg  SinkConfig
+	conn net.Conn
+}
+
+func (s *syslogSink) name() string { return "syslog:" + s.cfg.Name }
+
+// message renders one RFC 5424 message with structured data params
+// in the given order.
+func (s *syslogSink) message(severity int, at time.Time, hostname, msgID, sdID string, params [][2]string, text string) []byte {
+	if hostname == "" {
+		hostname = "-"
+	}
+	var sd strings.Builder
+	sd.WriteString("[" + sdID + SYSLOG_SD_SUFFIX)
+	for _, p := range params {
+		sd.WriteString(" " + p[0] + `="` + syslogParamEscaper.Replace(p[1]) + `"`)
+	}
+	sd.WriteString("]")
+	pri := syslogFacilities[s.cfg.Facility]*8 + severity
+	return []byte(fmt.Sprintf("<%d>1 %s %s host-agent - %s %s %s",
+		pri, at.UTC().Format("2006-01-02T15:04:05Z"), hostname, msgID, sd.String(), text))
+}
+
+// encode condenses a snapshot to the headline numbers at severity info.
+func (s *syslogSink) encode(metrics *SystemMetrics) ([]byte, error) {
+	at, err := time.Parse("2006-01-02T15:04:05Z", metrics.Timestamp)
+	if err != nil {
+		at = time.Now()
+	}
+	params := [][2]string{
+		{"agent_id", metrics.System.AgentID},
+		{"health", metrics.Health},
+		{"cpu", fmt.Sprintf("%.1f", metrics.CPU.UsagePercent)},
+		{"load1", fmt.Sprintf("%.2f", metrics.CPU.Load1)},
+		{"memory", fmt.Sprintf("%.1f", metrics.Memory.UsagePercent)},
+		{"temperature", fmt.Sprintf("%d", metrics.Temperature.CPUCelsius)},
+		{"alerts", fmt.Sprintf("%d", len(metrics.Alerts))},
+	}
+	text := fmt.Sprintf("health %s cpu %.1f%% mem %.1f%% load %.2f", metrics.Health,
+		metrics.CPU.UsagePercent, metrics.Memory.UsagePercent, metrics.CPU.Load1)
+	var disks []string
+	for _, disk := range metrics.Disk {
+		if disk.Status == "timeout" {
+			continue
+		}
+		disks = append(disks, fmt.Sprintf("%s %.1f%%", disk.Device, disk.UsedPercent))
+	}
+	if len(disks) > 0 {
+		text += " disk " + strings.Join(disks, ", ")
+	}
+	if metrics.Temperature.CPUCelsius > 0 {
+		text += fmt.Sprintf(" temp %dC", metrics.Temperature.CPUCelsius)
+	}
+	if len(metrics.Alerts) > 0 {
+		text += fmt.Sprintf(" alerts %d", len(metrics.Alerts))
+	}
+	return s.message(6, at, metrics.System.Hostname, "metrics", "metrics", params, text), nil
+}
+
+// encodeAlert maps critical alerts to crit, others to warning and
+// resolutions to notice.
+func (s *syslogSink) encodeAlert(event AlertEvent) ([]byte, error) {
+	at, err := time.Parse("2006-01-02T15:04:05Z", event.Timestamp)
+	if err != nil {
+		at = time.Now()
+	}
+	severity := 4
+	switch {
+	case event.Status == "resolved":
+		severity = 5
+	case event.Alert.Severity == "critical":
+		severity = 2
+	}
+	params := [][2]string{
+		{"agent_id", event.AgentID},
+		{"id", event.Alert.ID},
+		{"rule", event.Alert.Rule},
+		{"status", event.Status},
+		{"severity", event.Alert.Severity},
+		{"value", fmt.Sprintf("%g", event.Alert.Value)},
+		{"started_at", event.Alert.StartedAt},
+	}
+	text := strings.ToUpper(event.Status) + " " + event.Alert.Message
+	return s.message(severity, at, event.Hostname, "alert", "alert", params, text), nil
+}
+
+// send writes each message as one datagram, or with octet-counting framing
+// (RFC 6587) on stream connections.
+func (s *syslogSink) send(batch [][]byte) error {
+	if s.conn == nil {
+		conn, err := s.dial()
+		if err != nil {
+			return err
+		}
+		s.conn = conn
+	}
+	s.conn.SetWriteDeadline(time.Now().Add(30 * time.Second))
+	stream := s.conn.LocalAddr() != nil && s.conn.LocalAddr().Network() == "tcp"
+	for _, data := range batch {
+		if stream {
+			data = append([]byte(fmt.Sprintf("%d ", len(data))), data...)
+		}
+		if _, err := s.conn.Write(data); err != nil {
+			s.close()
+			return err
+		}
+	}
+	return nil
+}
+
+// dial connects to udp://, tcp:// or tls:// host[:port] (514, or 6514 for
+// TLS), unix:///path, or the first local syslog socket without a url.
+func (s *syslogSink) dial() (net.Conn, error) {
+	if s.cfg.URL == "" {
+		var lastErr error
+		for _, path := range syslogLocalSockets {
+			for _, network := range []string{"unixgram", "unix"} {
+				conn, err := net.DialTimeout(network, path, 10*time.Second)
+				if err == nil {
+					return conn, nil
+				}
+				lastErr = err
+			}
+		}
+		return nil, fmt.Errorf("no local syslog socket: %v", lastErr)
+	}
+
+	parsed, err := url.Parse(s.cfg.URL)
+	if err != nil {
+		return nil, err
+	}
+	if parsed.Scheme == "unix" {
+		conn, err := net.DialTimeout("unixgram", parsed.Path, 10*time.Second)
+		if err != nil {
+			conn, err = net.DialTimeout("unix", parsed.Path, 10*time.Second)
+		}
+		return conn, err
+	}
+	address := parsed.Host
+	if parsed.Port() == "" {
+		port := "514"
+		if parsed.Scheme == "tls" {
+			port = "6514"
+		}
+		address = net.JoinHostPort(parsed.Hostname(), port)
+	}
+	dialer := &net.Dialer{Timeout: 10 * time.Second}
+	switch parsed.Scheme {
+	case "tls":
+		return tls.DialWithDialer(dialer, "tcp", address, &tls.Config{ServerName: parsed.Hostname()})
+	case "tcp":
+		return dialer.Dial("tcp", address)
+	}
+	return dialer.Dial("udp", address)
+}
+
+func (s *syslogSink) close() {
+	if s.conn != nil {
+		s.conn.Close()
+		s.conn = nil
+	}
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Largest Zabbix server response read
+const ZABBIX_MAX_RESPONSE = 64 * 1024
+
+// zabbixSink sends snapshots to a Zabbix server or proxy with the trapper
+// ("sender data") protocol, one item per history series.
+type zabbixSink struct {
+	cfg      SinkConfig
+	rejected string // last logged rejected count
+}
+
+type zabbixItem struct {
+	Host  string `json:"host"`
+	Key   string `json:"key"`
+	Value string `json:"value"`
+	Clock int64  `json:"clock"`
+}
+
+var zabbixProcessed = regexp.MustCompile(`processed: (\d+); failed: (\d+)`)
+
+func (s *zabbixSink) name() string { return "zabbix:" + s.cfg.Name }
+
+// zabbixKey renders a series as an item key, with the label values as
+// parameters in label name order: disk_used_percent["/dev/sda1"].
+func zabbixKey(name string, labels map[string]string) string {
+	if len(labels) == 0 {
+		return name
+	}
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	params := make([]string, len(keys))
+	for i, k := range keys {
+		params[i] = `"` + strings.ReplaceAll(labels[k], `"`, `\"`) + `"`
+	}
+	return name + "[" + strings.Join(params, ",") + "]"
+}
+
+// encode stores the snapshot as a JSON array of items.
+func (s *zabbixSink) encode(metrics *SystemMetrics) ([]byte, error) {
+	at, err := time.Parse("2006-01-02T15:04:05Z", metrics.Timestamp)
+	if err != nil {
+		at = time.Now()
+	}
+	host := s.cfg.Host
+	if host == "" {
+		host = metrics.System.Hostname
+	}
+
+	items := []zabbixItem{{Host: host, Key: "health", Value: metrics.Health, Clock: at.Unix()}}
+	for _, sample := range flattenMetrics(metrics) {
+		if math.IsNaN(sample.Value) || math.IsInf(sample.Value, 0) {
+			continue
+		}
+		items = append(items, zabbixItem{
+			Host:  host,
+			Key:   zabbixKey(sample.Name, sample.Labels),
+			Value: strconv.FormatFloat(sample.Value, 'f', -1, 64),
+			Clock: at.Unix(),
+		})
+	}
+	return json.Marshal(items)
+}
+
+func (s *zabbixSink) send(batch [][]byte) error {
+	var items []zabbixItem
+	for _, data := range batch {
+		var snapshot []zabbixItem
+		if err := json.Unmarshal(data, &snapshot); err != nil {
+			return fmt.Errorf("corrupt spooled snapshot: %v", err)
+		}
+		items = append(items, snapshot...)
+	}
+	body, err := json.Marshal(map[string]interface{}{
+		"request": "sender data",
+		"data":    items,
+		"clock":   time.Now().Unix(),
+	})
+	if err != nil {
+		return err
+	}
+
+	address := s.cfg.URL
+	if parsed, err := url.Parse(s.cfg.URL); err == nil && parsed.Host != "" {
+		address = parsed.Host
+	}
+	if _, _, err := net.SplitHostPort(address); err != nil {
+		address = net.JoinHostPort(address, "10051")
+	}
+	conn, err := net.DialTimeout("tcp", address, 10*time.Second)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(30 * time.Second))
+
+	if _, err := conn.Write(zabbixPacket(body)); err != nil {
+		return err
+	}
+	response, err := readZabbixPacket(conn)
+	if err != nil {
+		return fmt.Errorf("reading response: %v", err)
+	}
+
+	var result struct {
+		Response string `json:"response"`
+		Info     string `json:"info"`
+	}
+	if err := json.Unmarshal(response, &result); err != nil {
+		return fmt.Errorf("invalid response: %v", err)
+	}
+	if result.Response != "success" {
+		return fmt.Errorf("server answered %q: %s", result.Response, result.Info)
+	}
+	// Items without a matching trapper item are rejected individually;
+	// resending would not help, so they are logged when the count changes
+	if m := zabbixProcessed.FindStringSubmatch(result.Info); m != nil && m[2] != s.rejected {
+		s.rejected = m[2]
+		if m[2] != "0" {
+			log.Printf("[SINK] %s: %s of %d items rejected (no matching trapper item?)", s.name(), m[2], len(items))
+		}
+	}
+	return nil
+}
+
+// zabbixPacket frames data with the ZBXD header and little-endian length.
+func zabbixPacket(data []byte) []byte {
+	packet := make([]byte, 13, 13+len(data))
+	copy(packet, "ZBXD\x01")
+	binary.LittleEndian.PutUint64(packet[5:], uint64(len(data)))
+	return append(packet, data...)
+}
+
+func readZabbixPacket(r io.Reader) ([]byte, error) {
+	header := make([]byte, 13)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, err
+	}
+	if !bytes.HasPrefix(header, []byte("ZBXD")) {
+		return nil, fmt.Errorf("missing ZBXD header")
+	}
+	if header[4]&0x02 != 0 {
+		return nil, fmt.Errorf("compressed responses are not supported")
+	}
+	length := binary.LittleEndian.Uint32(header[5:])
+	if length > ZABBIX_MAX_RESPONSE {
+		return nil, fmt.Errorf("response too large (%d bytes)", length)
+	}
+	data := make([]byte, length)
+	_, err := io.ReadFull(r, data)
+	return data, err
+}
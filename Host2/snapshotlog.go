@@ -0,0 +1,166 @@
+package main
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// snapshotLog appends each periodic snapshot as one JSON line to
+// snapshot_log.path and rotates the file by size or age.
+type snapshotLog struct {
+	mu       sync.Mutex
+	file     *os.File
+	path     string
+	size     int64
+	openedAt time.Time
+}
+
+var snapshots = &snapshotLog{}
+
+// append writes one snapshot, rotating first when the current file is too
+// large or too old. A disabled or changed config closes the open file.
+func (s *snapshotLog) append(metrics *SystemMetrics) {
+	cfg := currentConfig().SnapshotLog
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.file != nil && s.path != cfg.Path {
+		s.file.Close()
+		s.file = nil
+	}
+	if cfg.Path == "" {
+		return
+	}
+
+	line, err := json.Marshal(metrics)
+	if err != nil {
+		log.Printf("[SNAPSHOT] Failed to marshal snapshot: %v", err)
+		return
+	}
+	line = append(line, '\n')
+
+	if s.file == nil {
+		if err := s.open(cfg.Path); err != nil {
+			log.Printf("[SNAPSHOT] %v", err)
+			return
+		}
+	}
+
+	tooBig := cfg.MaxSizeMB > 0 && s.size+int64(len(line)) > int64(cfg.MaxSizeMB*1024*1024)
+	tooOld := cfg.MaxAgeHours > 0 && time.Since(s.openedAt) > time.Duration(cfg.MaxAgeHours*float64(time.Hour))
+	if s.size > 0 && (tooBig || tooOld) {
+		if err := s.rotate(cfg); err != nil {
+			log.Printf("[SNAPSHOT] Rotation failed: %v", err)
+			return
+		}
+	}
+
+	n, err := s.file.Write(line)
+	s.size += int64(n)
+	if err != nil {
+		log.Printf("[SNAPSHOT] Write to %s failed: %v", s.path, err)
+	}
+}
+
+func (s *snapshotLog) open(path string) error {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("cannot open %s: %v", path, err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("cannot stat %s: %v", path, err)
+	}
+	s.file, s.path, s.size = file, path, info.Size()
+	// Age counts from the file's creation as far as we can tell; an
+	// existing file keeps the age of its last modification
+	s.openedAt = time.Now()
+	if s.size > 0 {
+		s.openedAt = info.ModTime()
+	}
+	return nil
+}
+
+// rotate renames the active file to path.<timestamp>, starts a new one and
+// compresses and prunes rotated files in the background.
+func (s *snapshotLog) rotate(cfg SnapshotLogConfig) error {
+	s.file.Close()
+	s.file = nil
+
+	rotated := fmt.Sprintf("%s.%s", s.path, time.Now().UTC().Format("20060102T150405Z"))
+	if err := os.Rename(s.path, rotated); err != nil {
+		return err
+	}
+	if err := s.open(s.path); err != nil {
+		return err
+	}
+	log.Printf("[SNAPSHOT] Rotated %s to %s", s.path, rotated)
+
+	go func() {
+		if cfg.Compress {
+			if err := gzipFile(rotated); err != nil {
+				log.Printf("[SNAPSHOT] Failed to compress %s: %v", rotated, err)
+			}
+		}
+		pruneRotated(s.path, cfg.Keep)
+	}()
+	return nil
+}
+
+// gzipFile replaces path with path.gz.
+func gzipFile(path string) error {
+	in, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(path+".gz", os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	gz := gzip.NewWriter(out)
+	if _, err := io.Copy(gz, in); err != nil {
+		out.Close()
+		os.Remove(path + ".gz")
+		return err
+	}
+	if err := gz.Close(); err != nil {
+		out.Close()
+		os.Remove(path + ".gz")
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	return os.Remove(path)
+}
+
+// pruneRotated deletes the oldest rotated files beyond keep. Rotated names
+// sort chronologically by their timestamp suffix.
+func pruneRotated(path string, keep int) {
+	if keep <= 0 {
+		return
+	}
+	matches, err := filepath.Glob(path + ".*")
+	if err != nil {
+		return
+	}
+	rotated := matches
+	sort.Strings(rotated)
+	for len(rotated) > keep {
+		if err := os.Remove(rotated[0]); err != nil {
+			log.Printf("[SNAPSHOT] Failed to remove %s: %v", rotated[0], err)
+		}
+		rotated = rotated[1:]
+	}
+}
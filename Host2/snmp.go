@@ -0,0 +1,388 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// BER tags used by SNMPv1/v2c
+const (
+	berInteger     = 0x02
+	berOctetString = 0x04
+	berNull        = 0x05
+	berOID         = 0x06
+	berSequence    = 0x30
+	berIPAddress   = 0x40
+	berCounter32   = 0x41
+	berGauge32     = 0x42
+	berTimeTicks   = 0x43
+	berCounter64   = 0x46
+
+	snmpNoSuchObject   = 0x80
+	snmpNoSuchInstance = 0x81
+	snmpEndOfMibView   = 0x82
+
+	snmpGetRequest     = 0xA0
+	snmpGetNextRequest = 0xA1
+	snmpResponse       = 0xA2
+	snmpSetRequest     = 0xA3
+	snmpGetBulkRequest = 0xA5
+
+	snmpVersion1  = 0
+	snmpVersion2c = 1
+)
+
+// SNMP error-status values
+const (
+	snmpNoError    = 0
+	snmpTooBig     = 1
+	snmpNoSuchName = 2
+	snmpGenErr     = 5
+	snmpNoAccess   = 6
+	snmpReadOnly   = 4
+)
+
+var errBERTruncated = errors.New("truncated BER data")
+
+// oid is an object identifier as its numeric arcs.
+type oid []uint32
+
+func parseOID(s string) (oid, error) {
+	parts := strings.Split(strings.TrimPrefix(s, "."), ".")
+	if len(parts) < 2 {
+		return nil, fmt.Errorf("invalid OID %q", s)
+	}
+	o := make(oid, len(parts))
+	for i, part := range parts {
+		arc, err := strconv.ParseUint(part, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid OID %q", s)
+		}
+		o[i] = uint32(arc)
+	}
+	return o, nil
+}
+
+func (o oid) String() string {
+	parts := make([]string, len(o))
+	for i, arc := range o {
+		parts[i] = strconv.FormatUint(uint64(arc), 10)
+	}
+	return strings.Join(parts, ".")
+}
+
+// child returns o extended by arcs, without sharing o's backing array.
+func (o oid) child(arcs ...uint32) oid {
+	return append(append(oid{}, o...), arcs...)
+}
+
+func (o oid) hasPrefix(prefix oid) bool {
+	return len(o) >= len(prefix) && compareOID(o[:len(prefix)], prefix) == 0
+}
+
+// compareOID orders OIDs lexicographically, as GETNEXT walks them.
+func compareOID(a, b oid) int {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if a[i] != b[i] {
+			if a[i] < b[i] {
+				return -1
+			}
+			return 1
+		}
+	}
+	switch {
+	case len(a) < len(b):
+		return -1
+	case len(a) > len(b):
+		return 1
+	}
+	return 0
+}
+
+// snmpVarBind is one name/value pair. Value is int64 for INTEGER, uint64
+// for counters, gauges and time ticks, []byte for strings and IP
+// addresses, oid for OIDs, and nil for NULL and the v2c exceptions.
+type snmpVarBind struct {
+	Name  oid
+	Type  byte
+	Value interface{}
+}
+
+// snmpMessage is a v1/v2c message. For GETBULK, ErrorStatus and ErrorIndex
+// carry non-repeaters and max-repetitions.
+type snmpMessage struct {
+	Version     int
+	Community   string
+	PDUType     byte
+	RequestID   int32
+	ErrorStatus int
+	ErrorIndex  int
+	VarBinds    []snmpVarBind
+}
+
+func berTLV(tag byte, content []byte) []byte {
+	n := len(content)
+	out := []byte{tag}
+	switch {
+	case n < 0x80:
+		out = append(out, byte(n))
+	case n <= 0xFF:
+		out = append(out, 0x81, byte(n))
+	case n <= 0xFFFF:
+		out = append(out, 0x82, byte(n>>8), byte(n))
+	default:
+		out = append(out, 0x83, byte(n>>16), byte(n>>8), byte(n))
+	}
+	return append(out, content...)
+}
+
+func berEncodeInt(tag byte, v int64) []byte {
+	var content []byte
+	for {
+		content = append([]byte{byte(v)}, content...)
+		// Stop once the remaining value is just the sign extension
+		if (v >= -128 && v < 128) || len(content) == 8 {
+			break
+		}
+		v >>= 8
+	}
+	return berTLV(tag, content)
+}
+
+func berEncodeUint(tag byte, v uint64) []byte {
+	var content []byte
+	for {
+		content = append([]byte{byte(v)}, content...)
+		v >>= 8
+		if v == 0 {
+			break
+		}
+	}
+	if content[0]&0x80 != 0 {
+		content = append([]byte{0}, content...)
+	}
+	return berTLV(tag, content)
+}
+
+func berEncodeOID(o oid) []byte {
+	if len(o) < 2 {
+		return berTLV(berOID, nil)
+	}
+	content := appendBase128(nil, o[0]*40+o[1])
+	for _, arc := range o[2:] {
+		content = appendBase128(content, arc)
+	}
+	return berTLV(berOID, content)
+}
+
+func appendBase128(out []byte, v uint32) []byte {
+	var chunk []byte
+	chunk = append(chunk, byte(v&0x7F))
+	for v >>= 7; v > 0; v >>= 7 {
+		chunk = append([]byte{byte(v&0x7F) | 0x80}, chunk...)
+	}
+	return append(out, chunk...)
+}
+
+func (vb snmpVarBind) encodeValue() []byte {
+	switch vb.Type {
+	case berInteger:
+		return berEncodeInt(berInteger, vb.Value.(int64))
+	case berCounter32, berGauge32, berTimeTicks, berCounter64:
+		return berEncodeUint(vb.Type, vb.Value.(uint64))
+	case berOctetString, berIPAddress:
+		return berTLV(vb.Type, vb.Value.([]byte))
+	case berOID:
+		return berEncodeOID(vb.Value.(oid))
+	}
+	// NULL and the noSuchObject/noSuchInstance/endOfMibView exceptions
+	return berTLV(vb.Type, nil)
+}
+
+func (m *snmpMessage) marshal() []byte {
+	var binds []byte
+	for _, vb := range m.VarBinds {
+		binds = append(binds, berTLV(berSequence, append(berEncodeOID(vb.Name), vb.encodeValue()...))...)
+	}
+	pdu := berEncodeInt(berInteger, int64(m.RequestID))
+	pdu = append(pdu, berEncodeInt(berInteger, int64(m.ErrorStatus))...)
+	pdu = append(pdu, berEncodeInt(berInteger, int64(m.ErrorIndex))...)
+	pdu = append(pdu, berTLV(berSequence, binds)...)
+
+	msg := berEncodeInt(berInteger, int64(m.Version))
+	msg = append(msg, berTLV(berOctetString, []byte(m.Community))...)
+	msg = append(msg, berTLV(m.PDUType, pdu)...)
+	return berTLV(berSequence, msg)
+}
+
+// berRead splits the first TLV off data.
+func berRead(data []byte) (tag byte, content, rest []byte, err error) {
+	if len(data) < 2 {
+		return 0, nil, nil, errBERTruncated
+	}
+	tag, length, offset := data[0], int(data[1]), 2
+	if length&0x80 != 0 {
+		n := length & 0x7F
+		if n == 0 || n > 3 || len(data) < 2+n {
+			return 0, nil, nil, errBERTruncated
+		}
+		length = 0
+		for _, b := range data[2 : 2+n] {
+			length = length<<8 | int(b)
+		}
+		offset += n
+	}
+	if len(data) < offset+length {
+		return 0, nil, nil, errBERTruncated
+	}
+	return tag, data[offset : offset+length], data[offset+length:], nil
+}
+
+func berDecodeInt(content []byte) int64 {
+	var v int64
+	for i, b := range content {
+		if i == 0 && b&0x80 != 0 {
+			v = -1
+		}
+		v = v<<8 | int64(b)
+	}
+	return v
+}
+
+func berDecodeUint(content []byte) uint64 {
+	var v uint64
+	for _, b := range content {
+		v = v<<8 | uint64(b)
+	}
+	return v
+}
+
+func berDecodeOID(content []byte) (oid, error) {
+	var arcs []uint32
+	var v uint32
+	for i, b := range content {
+		v = v<<7 | uint32(b&0x7F)
+		if b&0x80 != 0 {
+			if i == len(content)-1 {
+				return nil, errBERTruncated
+			}
+			continue
+		}
+		if len(arcs) == 0 {
+			first := v / 40
+			if first > 2 {
+				first = 2
+			}
+			arcs = append(arcs, first, v-first*40)
+		} else {
+			arcs = append(arcs, v)
+		}
+		v = 0
+	}
+	return arcs, nil
+}
+
+// berExpectInt reads an INTEGER TLV.
+func berExpectInt(data []byte) (int64, []byte, error) {
+	tag, content, rest, err := berRead(data)
+	if err != nil {
+		return 0, nil, err
+	}
+	if tag != berInteger {
+		return 0, nil, fmt.Errorf("expected INTEGER, got tag 0x%02x", tag)
+	}
+	return berDecodeInt(content), rest, nil
+}
+
+func unmarshalSNMP(data []byte) (*snmpMessage, error) {
+	tag, body, _, err := berRead(data)
+	if err != nil {
+		return nil, err
+	}
+	if tag != berSequence {
+		return nil, fmt.Errorf("not an SNMP message")
+	}
+
+	m := &snmpMessage{}
+	version, body, err := berExpectInt(body)
+	if err != nil {
+		return nil, err
+	}
+	m.Version = int(version)
+	tag, community, body, err := berRead(body)
+	if err != nil {
+		return nil, err
+	}
+	if tag != berOctetString {
+		return nil, fmt.Errorf("expected community string")
+	}
+	m.Community = string(community)
+
+	m.PDUType, body, _, err = berRead(body)
+	if err != nil {
+		return nil, err
+	}
+	requestID, body, err := berExpectInt(body)
+	if err != nil {
+		return nil, err
+	}
+	m.RequestID = int32(requestID)
+	errorStatus, body, err := berExpectInt(body)
+	if err != nil {
+		return nil, err
+	}
+	errorIndex, body, err := berExpectInt(body)
+	if err != nil {
+		return nil, err
+	}
+	m.ErrorStatus, m.ErrorIndex = int(errorStatus), int(errorIndex)
+
+	tag, list, _, err := berRead(body)
+	if err != nil {
+		return nil, err
+	}
+	if tag != berSequence {
+		return nil, fmt.Errorf("expected varbind list")
+	}
+	for len(list) > 0 {
+		var bind []byte
+		if tag, bind, list, err = berRead(list); err != nil {
+			return nil, err
+		}
+		if tag != berSequence {
+			return nil, fmt.Errorf("expected varbind")
+		}
+		var nameTag, valueTag byte
+		var name, value []byte
+		if nameTag, name, bind, err = berRead(bind); err != nil {
+			return nil, err
+		}
+		if nameTag != berOID {
+			return nil, fmt.Errorf("expected varbind name")
+		}
+		if valueTag, value, _, err = berRead(bind); err != nil {
+			return nil, err
+		}
+
+		vb := snmpVarBind{Type: valueTag}
+		if vb.Name, err = berDecodeOID(name); err != nil {
+			return nil, err
+		}
+		switch valueTag {
+		case berInteger:
+			vb.Value = berDecodeInt(value)
+		case berCounter32, berGauge32, berTimeTicks, berCounter64:
+			vb.Value = berDecodeUint(value)
+		case berOctetString, berIPAddress:
+			vb.Value = append([]byte{}, value...)
+		case berOID:
+			if vb.Value, err = berDecodeOID(value); err != nil {
+				return nil, err
+			}
+		}
+		m.VarBinds = append(m.VarBinds, vb)
+	}
+	return m, nil
+}
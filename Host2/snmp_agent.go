@@ -0,0 +1,272 @@
+package main
+
+import (
+	"log"
+	"math"
+	"net"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Largest response the agent sends; GETBULK stops adding rows before it
+const SNMP_MAX_RESPONSE = 1400
+
+// MIB-II system group
+var (
+	oidSysDescr    = oid{1, 3, 6, 1, 2, 1, 1, 1, 0}
+	oidSysObjectID = oid{1, 3, 6, 1, 2, 1, 1, 2, 0}
+	oidSysUpTime   = oid{1, 3, 6, 1, 2, 1, 1, 3, 0}
+	oidSysName     = oid{1, 3, 6, 1, 2, 1, 1, 5, 0}
+)
+
+// snmpView is the sorted, read-only MIB built from one snapshot.
+type snmpView struct {
+	snapshot *SystemMetrics
+	base     oid
+	binds    []snmpVarBind
+}
+
+var snmpState struct {
+	sync.Mutex
+	view *snmpView
+}
+
+// Start of the SNMP agent, reported as sysUpTime
+var snmpStarted time.Time
+
+// currentSNMPView rebuilds the view when a new snapshot was collected.
+func currentSNMPView(base oid) *snmpView {
+	sectionState.Lock()
+	snapshot := sectionState.last
+	sectionState.Unlock()
+
+	snmpState.Lock()
+	defer snmpState.Unlock()
+	if snmpState.view == nil || snmpState.view.snapshot != snapshot || compareOID(snmpState.view.base, base) != 0 {
+		snmpState.view = buildSNMPView(snapshot, base)
+	}
+	return snmpState.view
+}
+
+func snmpString(name oid, s string) snmpVarBind {
+	return snmpVarBind{Name: name, Type: berOctetString, Value: []byte(s)}
+}
+
+func snmpInteger(name oid, n int64) snmpVarBind {
+	return snmpVarBind{Name: name, Type: berInteger, Value: n}
+}
+
+// buildSNMPView lays out the agent's subtree:
+//
+//	base.1.1.0  hostname          base.1.4.0  agent ID
+//	base.1.2.0  health            base.1.5.0  snapshot timestamp
+//	base.1.3.0  health code       base.1.6.0  active alerts
+//	base.2.1.{1..4}.row  metrics table: index, series, value, rounded value
+//
+// Table rows are sorted by series key, so a row index can change when
+// series appear or disappear; pollers should match on the series column.
+func buildSNMPView(m *SystemMetrics, base oid) *snmpView {
+	view := &snmpView{snapshot: m, base: base, binds: []snmpVarBind{
+		snmpString(oidSysDescr, "host-agent "+VERSION),
+		{Name: oidSysObjectID, Type: berOID, Value: base},
+		{Name: oidSysUpTime, Type: berTimeTicks},
+		snmpString(oidSysName, agentHostname()),
+	}}
+	if m == nil {
+		return view
+	}
+
+	scalars := base.child(1)
+	view.binds = append(view.binds,
+		snmpString(scalars.child(1, 0), m.System.Hostname),
+		snmpString(scalars.child(2, 0), m.Health),
+		snmpInteger(scalars.child(3, 0), int64(statusRank[m.Health])),
+		snmpString(scalars.child(4, 0), m.System.AgentID),
+		snmpString(scalars.child(5, 0), m.Timestamp),
+		snmpVarBind{Name: scalars.child(6, 0), Type: berGauge32, Value: uint64(len(currentAlerts()))},
+	)
+
+	samples := flattenMetrics(m)
+	rows := make([]metricSample, 0, len(samples))
+	for _, s := range samples {
+		if !math.IsNaN(s.Value) && !math.IsInf(s.Value, 0) {
+			rows = append(rows, s)
+		}
+	}
+	sort.Slice(rows, func(i, j int) bool {
+		return seriesKey(rows[i].Name, rows[i].Labels) < seriesKey(rows[j].Name, rows[j].Labels)
+	})
+
+	// Columns are emitted in order, so the view stays sorted without
+	// another pass
+	entry := base.child(2, 1)
+	for column := uint32(1); column <= 4; column++ {
+		for i, s := range rows {
+			name := entry.child(column, uint32(i+1))
+			switch column {
+			case 1:
+				view.binds = append(view.binds, snmpInteger(name, int64(i+1)))
+			case 2:
+				view.binds = append(view.binds, snmpString(name, seriesKey(s.Name, s.Labels)))
+			case 3:
+				view.binds = append(view.binds, snmpString(name, strconv.FormatFloat(s.Value, 'f', -1, 64)))
+			case 4:
+				rounded := math.Round(s.Value)
+				if rounded > math.MaxInt64 || rounded < math.MinInt64 {
+					rounded = 0
+				}
+				view.binds = append(view.binds, snmpInteger(name, int64(rounded)))
+			}
+		}
+	}
+	return view
+}
+
+// at returns object i, filling in sysUpTime at the time of the request.
+func (v *snmpView) at(i int) snmpVarBind {
+	vb := v.binds[i]
+	if compareOID(vb.Name, oidSysUpTime) == 0 {
+		vb.Value = uint64(time.Since(snmpStarted) / (10 * time.Millisecond))
+	}
+	return vb
+}
+
+// get returns the exact object, or a noSuchObject exception.
+func (v *snmpView) get(name oid) snmpVarBind {
+	i := sort.Search(len(v.binds), func(i int) bool { return compareOID(v.binds[i].Name, name) >= 0 })
+	if i < len(v.binds) && compareOID(v.binds[i].Name, name) == 0 {
+		return v.at(i)
+	}
+	return snmpVarBind{Name: name, Type: snmpNoSuchObject}
+}
+
+// next returns the first object after name, or endOfMibView.
+func (v *snmpView) next(name oid) snmpVarBind {
+	i := sort.Search(len(v.binds), func(i int) bool { return compareOID(v.binds[i].Name, name) > 0 })
+	if i < len(v.binds) {
+		return v.at(i)
+	}
+	return snmpVarBind{Name: name, Type: snmpEndOfMibView}
+}
+
+// handleSNMP answers one request, or returns nil to drop it.
+func handleSNMP(cfg SNMPConfig, req *snmpMessage) *snmpMessage {
+	if req.Community != cfg.Community || (req.Version != snmpVersion1 && req.Version != snmpVersion2c) {
+		return nil
+	}
+	resp := &snmpMessage{Version: req.Version, Community: req.Community, PDUType: snmpResponse, RequestID: req.RequestID}
+	view := currentSNMPView(cfg.baseOID)
+
+	// SNMPv1 has no exceptions: a missing object fails the whole request
+	v1Error := func(i int) *snmpMessage {
+		resp.ErrorStatus, resp.ErrorIndex = snmpNoSuchName, i+1
+		resp.VarBinds = req.VarBinds
+		return resp
+	}
+
+	switch req.PDUType {
+	case snmpGetRequest, snmpGetNextRequest:
+		for i, vb := range req.VarBinds {
+			result := view.get(vb.Name)
+			if req.PDUType == snmpGetNextRequest {
+				result = view.next(vb.Name)
+			}
+			if result.Type >= snmpNoSuchObject && req.Version == snmpVersion1 {
+				return v1Error(i)
+			}
+			resp.VarBinds = append(resp.VarBinds, result)
+		}
+	case snmpGetBulkRequest:
+		if req.Version == snmpVersion1 {
+			return nil
+		}
+		nonRepeaters, maxRepetitions := req.ErrorStatus, req.ErrorIndex
+		if nonRepeaters < 0 {
+			nonRepeaters = 0
+		}
+		if nonRepeaters > len(req.VarBinds) {
+			nonRepeaters = len(req.VarBinds)
+		}
+		for _, vb := range req.VarBinds[:nonRepeaters] {
+			resp.VarBinds = append(resp.VarBinds, view.next(vb.Name))
+		}
+		repeaters := req.VarBinds[nonRepeaters:]
+		cursors := make([]oid, len(repeaters))
+		for i, vb := range repeaters {
+			cursors[i] = vb.Name
+		}
+	bulk:
+		for r := 0; r < maxRepetitions && len(repeaters) > 0; r++ {
+			for i := range cursors {
+				result := view.next(cursors[i])
+				resp.VarBinds = append(resp.VarBinds, result)
+				// Keep the response within one unfragmented datagram
+				if len(resp.marshal()) > SNMP_MAX_RESPONSE {
+					resp.VarBinds = resp.VarBinds[:len(resp.VarBinds)-1]
+					break bulk
+				}
+				cursors[i] = result.Name
+			}
+		}
+	case snmpSetRequest:
+		resp.ErrorStatus, resp.ErrorIndex = snmpNoAccess, 1
+		if req.Version == snmpVersion1 {
+			resp.ErrorStatus = snmpReadOnly
+		}
+		resp.VarBinds = req.VarBinds
+	default:
+		return nil
+	}
+
+	if len(resp.marshal()) > SNMP_MAX_RESPONSE && req.PDUType != snmpGetBulkRequest {
+		resp.ErrorStatus, resp.ErrorIndex, resp.VarBinds = snmpTooBig, 0, nil
+	}
+	return resp
+}
+
+// serveSNMP answers requests on conn until it is closed.
+func serveSNMP(conn net.PacketConn, cfg SNMPConfig) {
+	buf := make([]byte, 65535)
+	for {
+		n, addr, err := conn.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		if udpAddr, ok := addr.(*net.UDPAddr); ok && len(cfg.allowNets) > 0 && !containsIP(cfg.allowNets, udpAddr.IP) {
+			continue
+		}
+		req, err := unmarshalSNMP(buf[:n])
+		if err != nil {
+			continue
+		}
+		if resp := handleSNMP(cfg, req); resp != nil {
+			conn.WriteTo(resp.marshal(), addr)
+		}
+	}
+}
+
+// startSNMPAgent serves the snapshot over SNMP while snmp.enabled is set,
+// rebinding whenever the configuration is reloaded.
+func startSNMPAgent() {
+	snmpStarted = time.Now()
+	for {
+		reloaded := configReloaded()
+		cfg := currentConfig().SNMP
+		var conn net.PacketConn
+		if cfg.Enabled {
+			var err error
+			if conn, err = net.ListenPacket("udp", cfg.Listen); err != nil {
+				log.Printf("[SNMP] Failed to listen on %s: %v", cfg.Listen, err)
+			} else {
+				log.Printf("[SNMP] Agent listening on %s (subtree %s)", conn.LocalAddr(), cfg.baseOID)
+				go serveSNMP(conn, cfg)
+			}
+		}
+		<-reloaded
+		if conn != nil {
+			conn.Close()
+		}
+	}
+}
@@ -0,0 +1,493 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"math/rand"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Objects read from every polled device
+var (
+	oidIfEntry  = oid{1, 3, 6, 1, 2, 1, 2, 2, 1}
+	oidIfXEntry = oid{1, 3, 6, 1, 2, 1, 31, 1, 1, 1}
+)
+
+// Columns of ifEntry and ifXEntry
+const (
+	ifDescr       = 2
+	ifSpeed       = 5
+	ifOperStatus  = 8
+	ifInOctets    = 10
+	ifInErrors    = 14
+	ifOutOctets   = 16
+	ifOutErrors   = 20
+	ifName        = 1
+	ifHCInOctets  = 6
+	ifHCOutOctets = 10
+	ifHighSpeed   = 15
+)
+
+var ifOperStatusNames = map[int64]string{1: "up", 2: "down", 3: "testing", 4: "unknown", 5: "dormant", 6: "not_present", 7: "lower_layer_down"}
+
+// SNMPDeviceInfo is the last poll of one SNMP device.
+type SNMPDeviceInfo struct {
+	Name          string            `json:"name"`
+	Host          string            `json:"host"`
+	SysName       string            `json:"sys_name"`
+	SysDescr      string            `json:"sys_descr"`
+	UptimeSeconds uint64            `json:"uptime_seconds"`
+	Interfaces    []SNMPInterface   `json:"interfaces"`
+	Sensors       []SNMPSensorValue `json:"sensors"`
+	LastPoll      string            `json:"last_poll"`
+	DurationMs    float64           `json:"duration_ms"`
+	Status        string            `json:"status"` // "ok", "unreachable" or "error"
+	Error         string            `json:"error,omitempty"`
+}
+
+type SNMPInterface struct {
+	Index         uint32  `json:"index"`
+	Name          string  `json:"name"`
+	Description   string  `json:"description"`
+	Status        string  `json:"status"` // ifOperStatus: "up", "down", ...
+	SpeedMbps     uint64  `json:"speed_mbps"`
+	RxBytes       uint64  `json:"rx_bytes"`
+	TxBytes       uint64  `json:"tx_bytes"`
+	RxBytesPerSec float64 `json:"rx_bytes_per_sec"`
+	TxBytesPerSec float64 `json:"tx_bytes_per_sec"`
+	InErrors      uint64  `json:"in_errors"`
+	OutErrors     uint64  `json:"out_errors"`
+}
+
+// SNMPSensorValue is one configured OID read as a number.
+type SNMPSensorValue struct {
+	Name  string  `json:"name"`
+	OID   string  `json:"oid"`
+	Value float64 `json:"value"`
+	Error string  `json:"error,omitempty"`
+}
+
+// snmpCounters is the previous reading of an interface, for rates.
+type snmpCounters struct {
+	at     time.Time
+	rx, tx uint64
+	wrap   float64 // counter width, 2^32 or 2^64
+}
+
+var (
+	snmpPollMu   sync.RWMutex
+	latestSNMP   = map[string]SNMPDeviceInfo{}
+	snmpPrevious = map[string]snmpCounters{}
+)
+
+var errSNMPTimeout = errors.New("no response")
+
+// snmpClient sends v1/v2c requests to one device over UDP.
+type snmpClient struct {
+	conn      net.Conn
+	version   int
+	community string
+	timeout   time.Duration
+	retries   int
+	requestID int32
+}
+
+func dialSNMP(cfg SNMPDeviceConfig) (*snmpClient, error) {
+	conn, err := net.Dial("udp", net.JoinHostPort(cfg.Host, strconv.Itoa(cfg.Port)))
+	if err != nil {
+		return nil, err
+	}
+	version := snmpVersion2c
+	if cfg.Version == "1" {
+		version = snmpVersion1
+	}
+	return &snmpClient{
+		conn:      conn,
+		version:   version,
+		community: cfg.Community,
+		timeout:   time.Duration(cfg.TimeoutMs) * time.Millisecond,
+		retries:   cfg.Retries,
+		requestID: rand.Int31(),
+	}, nil
+}
+
+func (c *snmpClient) Close() error {
+	return c.conn.Close()
+}
+
+// request sends one PDU and waits for the response with the same request
+// ID, resending it up to retries times.
+func (c *snmpClient) request(pduType byte, names []oid, nonRepeaters, maxRepetitions int) (*snmpMessage, error) {
+	c.requestID++
+	req := &snmpMessage{Version: c.version, Community: c.community, PDUType: pduType, RequestID: c.requestID,
+		ErrorStatus: nonRepeaters, ErrorIndex: maxRepetitions}
+	for _, name := range names {
+		req.VarBinds = append(req.VarBinds, snmpVarBind{Name: name, Type: berNull})
+	}
+	packet := req.marshal()
+
+	buf := make([]byte, 65535)
+	for attempt := 0; attempt <= c.retries; attempt++ {
+		if _, err := c.conn.Write(packet); err != nil {
+			return nil, err
+		}
+		c.conn.SetReadDeadline(time.Now().Add(c.timeout))
+		for {
+			n, err := c.conn.Read(buf)
+			if err != nil {
+				if ne, ok := err.(net.Error); ok && ne.Timeout() {
+					break
+				}
+				// Refused ports surface as read errors on Linux
+				return nil, err
+			}
+			resp, err := unmarshalSNMP(buf[:n])
+			if err != nil || resp.PDUType != snmpResponse || resp.RequestID != req.RequestID {
+				continue
+			}
+			if resp.ErrorStatus != snmpNoError {
+				return resp, fmt.Errorf("error-status %d at index %d", resp.ErrorStatus, resp.ErrorIndex)
+			}
+			return resp, nil
+		}
+	}
+	return nil, errSNMPTimeout
+}
+
+// get reads single objects; missing objects come back as nil values.
+func (c *snmpClient) get(names ...oid) ([]snmpVarBind, error) {
+	resp, err := c.request(snmpGetRequest, names, 0, 0)
+	if err != nil {
+		return nil, err
+	}
+	if len(resp.VarBinds) != len(names) {
+		return nil, fmt.Errorf("expected %d values, got %d", len(names), len(resp.VarBinds))
+	}
+	return resp.VarBinds, nil
+}
+
+// walk visits every object below root in order, using GETBULK on v2c and
+// GETNEXT on v1.
+func (c *snmpClient) walk(root oid, visit func(snmpVarBind)) error {
+	cursor := root
+	for {
+		var resp *snmpMessage
+		var err error
+		if c.version == snmpVersion1 {
+			resp, err = c.request(snmpGetNextRequest, []oid{cursor}, 0, 0)
+			// v1 agents signal the end of the MIB with noSuchName
+			if resp != nil && resp.ErrorStatus == snmpNoSuchName {
+				return nil
+			}
+		} else {
+			resp, err = c.request(snmpGetBulkRequest, []oid{cursor}, 0, 25)
+		}
+		if err != nil {
+			return err
+		}
+		if len(resp.VarBinds) == 0 {
+			return nil
+		}
+		for _, vb := range resp.VarBinds {
+			if vb.Type == snmpEndOfMibView || !vb.Name.hasPrefix(root) {
+				return nil
+			}
+			// A broken agent that does not advance would loop forever
+			if compareOID(vb.Name, cursor) <= 0 {
+				return fmt.Errorf("walk of %s did not advance past %s", root, cursor)
+			}
+			visit(vb)
+			cursor = vb.Name
+		}
+	}
+}
+
+// walkColumns reads the given columns of a table entry, keyed by column
+// and then by row index.
+func (c *snmpClient) walkColumns(entry oid, columns ...uint32) (map[uint32]map[uint32]snmpVarBind, error) {
+	table := make(map[uint32]map[uint32]snmpVarBind, len(columns))
+	for _, column := range columns {
+		root := entry.child(column)
+		rows := make(map[uint32]snmpVarBind)
+		err := c.walk(root, func(vb snmpVarBind) {
+			if len(vb.Name) == len(root)+1 {
+				rows[vb.Name[len(root)]] = vb
+			}
+		})
+		if err != nil {
+			return nil, err
+		}
+		table[column] = rows
+	}
+	return table, nil
+}
+
+// snmpNumber converts a numeric value, or a string holding a number as some
+// devices report sensors, to float64.
+func snmpNumber(vb snmpVarBind) (float64, error) {
+	switch v := vb.Value.(type) {
+	case int64:
+		return float64(v), nil
+	case uint64:
+		return float64(v), nil
+	case []byte:
+		if vb.Type == berOctetString {
+			if n, err := strconv.ParseFloat(strings.TrimSpace(string(v)), 64); err == nil {
+				return n, nil
+			}
+		}
+	}
+	switch vb.Type {
+	case snmpNoSuchObject, snmpNoSuchInstance, berNull:
+		return 0, fmt.Errorf("no such object")
+	}
+	return 0, fmt.Errorf("not a number (type 0x%02x)", vb.Type)
+}
+
+func snmpUint(vb snmpVarBind) uint64 {
+	switch v := vb.Value.(type) {
+	case uint64:
+		return v
+	case int64:
+		if v > 0 {
+			return uint64(v)
+		}
+	}
+	return 0
+}
+
+func snmpText(vb snmpVarBind) string {
+	if v, ok := vb.Value.([]byte); ok && vb.Type == berOctetString {
+		return strings.TrimRight(string(v), "\x00")
+	}
+	return ""
+}
+
+// pollSNMPDevice reads the system group, the interface table and the
+// configured sensor OIDs of one device.
+func pollSNMPDevice(cfg SNMPDeviceConfig) (info SNMPDeviceInfo) {
+	start := time.Now()
+	info = SNMPDeviceInfo{
+		Name:       cfg.Name,
+		Host:       cfg.Host,
+		Interfaces: []SNMPInterface{},
+		Sensors:    []SNMPSensorValue{},
+		LastPoll:   start.UTC().Format("2006-01-02T15:04:05Z"),
+		Status:     "ok",
+	}
+	defer func() { info.DurationMs = float64(time.Since(start).Microseconds()) / 1000 }()
+
+	// Timeouts and refused ports mean the device is unreachable; anything
+	// else is an error reported by the agent on the device
+	fail := func(context string, err error) SNMPDeviceInfo {
+		var netErr net.Error
+		info.Status, info.Error = "error", context+err.Error()
+		if errors.Is(err, errSNMPTimeout) || errors.As(err, &netErr) {
+			info.Status = "unreachable"
+		}
+		return info
+	}
+
+	client, err := dialSNMP(cfg)
+	if err != nil {
+		return fail("", err)
+	}
+	defer client.Close()
+
+	system, err := client.get(oidSysDescr, oidSysUpTime, oidSysName)
+	if err != nil {
+		return fail("", err)
+	}
+	info.SysDescr = snmpText(system[0])
+	info.UptimeSeconds = snmpUint(system[1]) / 100
+	info.SysName = snmpText(system[2])
+
+	if cfg.Interfaces {
+		if info.Interfaces, err = pollSNMPInterfaces(client, cfg.Name, start); err != nil {
+			return fail("interfaces: ", err)
+		}
+	}
+
+	for _, sensor := range cfg.OIDs {
+		value := SNMPSensorValue{Name: sensor.Name, OID: sensor.OID}
+		name, _ := parseOID(sensor.OID)
+		binds, err := client.get(name)
+		if err == nil {
+			value.Value, err = snmpNumber(binds[0])
+			value.Value *= sensor.Scale
+		}
+		if err != nil {
+			value.Error = err.Error()
+		}
+		info.Sensors = append(info.Sensors, value)
+	}
+	return info
+}
+
+// pollSNMPInterfaces reads ifTable, preferring the 64-bit counters and
+// names of ifXTable where the device has them, and derives byte rates
+// from the previous poll.
+func pollSNMPInterfaces(client *snmpClient, device string, now time.Time) ([]SNMPInterface, error) {
+	table, err := client.walkColumns(oidIfEntry, ifDescr, ifSpeed, ifOperStatus, ifInOctets, ifInErrors, ifOutOctets, ifOutErrors)
+	if err != nil {
+		return nil, err
+	}
+	// ifXTable is SNMPv2 only and optional
+	xtable := map[uint32]map[uint32]snmpVarBind{}
+	if client.version == snmpVersion2c {
+		if xtable, err = client.walkColumns(oidIfXEntry, ifName, ifHCInOctets, ifHCOutOctets, ifHighSpeed); err != nil {
+			return nil, err
+		}
+	}
+
+	var indexes []uint32
+	for index := range table[ifDescr] {
+		indexes = append(indexes, index)
+	}
+	sort.Slice(indexes, func(i, j int) bool { return indexes[i] < indexes[j] })
+
+	snmpPollMu.Lock()
+	defer snmpPollMu.Unlock()
+	interfaces := make([]SNMPInterface, 0, len(indexes))
+	for _, index := range indexes {
+		iface := SNMPInterface{
+			Index:       index,
+			Description: snmpText(table[ifDescr][index]),
+			SpeedMbps:   snmpUint(table[ifSpeed][index]) / 1000000,
+			RxBytes:     snmpUint(table[ifInOctets][index]),
+			TxBytes:     snmpUint(table[ifOutOctets][index]),
+			InErrors:    snmpUint(table[ifInErrors][index]),
+			OutErrors:   snmpUint(table[ifOutErrors][index]),
+		}
+		if status, ok := table[ifOperStatus][index].Value.(int64); ok {
+			iface.Status = ifOperStatusNames[status]
+		}
+		iface.Name = snmpText(xtable[ifName][index])
+		if iface.Name == "" {
+			iface.Name = iface.Description
+		}
+		if speed := snmpUint(xtable[ifHighSpeed][index]); speed > 0 {
+			iface.SpeedMbps = speed
+		}
+		wrap := float64(1 << 32)
+		if rx, ok := xtable[ifHCInOctets][index]; ok && rx.Type == berCounter64 {
+			iface.RxBytes = snmpUint(rx)
+			iface.TxBytes = snmpUint(xtable[ifHCOutOctets][index])
+			wrap = 1 << 64
+		}
+
+		key := device + "/" + strconv.FormatUint(uint64(index), 10)
+		if prev, ok := snmpPrevious[key]; ok && prev.wrap == wrap {
+			if elapsed := now.Sub(prev.at).Seconds(); elapsed > 0 {
+				iface.RxBytesPerSec = wrappedDelta(prev.rx, iface.RxBytes, wrap) / elapsed
+				iface.TxBytesPerSec = wrappedDelta(prev.tx, iface.TxBytes, wrap) / elapsed
+			}
+		}
+		snmpPrevious[key] = snmpCounters{at: now, rx: iface.RxBytes, tx: iface.TxBytes, wrap: wrap}
+		interfaces = append(interfaces, iface)
+	}
+	return interfaces, nil
+}
+
+// wrappedDelta is the increase of a counter of the given width that may
+// have wrapped once since the previous reading.
+func wrappedDelta(from, to uint64, wrap float64) float64 {
+	if to >= from {
+		return float64(to - from)
+	}
+	return wrap - float64(from) + float64(to)
+}
+
+// latestSNMPDevices returns the last poll of every configured device, in
+// config order.
+func latestSNMPDevices() []SNMPDeviceInfo {
+	snmpPollMu.RLock()
+	defer snmpPollMu.RUnlock()
+	devices := []SNMPDeviceInfo{}
+	for _, cfg := range currentConfig().SNMPDevices {
+		if info, ok := latestSNMP[cfg.Name]; ok {
+			devices = append(devices, info)
+		}
+	}
+	return devices
+}
+
+// startSNMPPoller polls every configured device on its own interval,
+// restarting the set when the config is reloaded.
+func startSNMPPoller() {
+	for {
+		devices := currentConfig().SNMPDevices
+		reloaded := configReloaded()
+
+		snmpPollMu.Lock()
+		latestSNMP = map[string]SNMPDeviceInfo{}
+		snmpPrevious = map[string]snmpCounters{}
+		snmpPollMu.Unlock()
+
+		if len(devices) > 0 {
+			log.Printf("[SNMP] Polling %d devices", len(devices))
+		}
+		for _, device := range devices {
+			go runSNMPPollLoop(device, reloaded)
+		}
+		<-reloaded
+	}
+}
+
+func runSNMPPollLoop(cfg SNMPDeviceConfig, stop <-chan struct{}) {
+	interval := time.Duration(cfg.IntervalSeconds) * time.Second
+	status := ""
+	for {
+		info := pollSNMPDevice(cfg)
+		switch {
+		case info.Status != "ok" && info.Status != status:
+			log.Printf("[SNMP] %s (%s) is %s: %s", cfg.Name, cfg.Host, info.Status, info.Error)
+		case info.Status == "ok" && status != "ok" && status != "":
+			log.Printf("[SNMP] %s (%s) is reachable again", cfg.Name, cfg.Host)
+		}
+		status = info.Status
+
+		select {
+		case <-stop:
+			return
+		default:
+		}
+		snmpPollMu.Lock()
+		latestSNMP[cfg.Name] = info
+		snmpPollMu.Unlock()
+
+		select {
+		case <-time.After(interval):
+		case <-stop:
+			return
+		}
+	}
+}
+
+// snmpDeviceAlerts raises one alert per device that did not answer.
+func snmpDeviceAlerts(devices []SNMPDeviceInfo) []Alert {
+	severities := make(map[string]string)
+	for _, cfg := range currentConfig().SNMPDevices {
+		severities[cfg.Name] = cfg.Severity
+	}
+
+	var firing []Alert
+	for _, device := range devices {
+		if device.Status == "ok" {
+			continue
+		}
+		firing = append(firing, Alert{
+			ID:       "snmp:" + device.Name,
+			Rule:     "snmp_device",
+			Severity: severities[device.Name],
+			Message:  fmt.Sprintf("SNMP device %s (%s) is %s: %s", device.Name, device.Host, device.Status, device.Error),
+		})
+	}
+	return firing
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"bufio"
+	"strconv"
+	"strings"
+)
+
+// TCP states as printed in /proc/net/tcp
+const (
+	TCP_ESTABLISHED = "01"
+	TCP_TIME_WAIT   = "06"
+	TCP_CLOSE_WAIT  = "08"
+	TCP_LISTEN      = "0A"
+)
+
+// SocketsInfo reports socket table pressure: connection tracking usage,
+// TCP connection states and how much of the ephemeral port range is taken.
+type SocketsInfo struct {
+	ConntrackCount     uint64  `json:"conntrack_count"`
+	ConntrackMax       uint64  `json:"conntrack_max"` // 0 when nf_conntrack is not loaded
+	ConntrackPercent   float64 `json:"conntrack_percent"`
+	Established        int     `json:"established"`
+	TimeWait           int     `json:"time_wait"`
+	CloseWait          int     `json:"close_wait"`
+	EphemeralPortsUsed int     `json:"ephemeral_ports_used"` // distinct local ports in the range
+	EphemeralPortRange [2]int  `json:"ephemeral_port_range"`
+	EphemeralPercent   float64 `json:"ephemeral_percent"`
+	Status             string  `json:"status"` // of the worse of conntrack and ephemeral usage
+}
+
+// pressurePercent is the figure the sockets threshold applies to.
+func (s SocketsInfo) pressurePercent() float64 {
+	if s.ConntrackPercent > s.EphemeralPercent {
+		return s.ConntrackPercent
+	}
+	return s.EphemeralPercent
+}
+
+// collectSocketsInfo reads the conntrack counters from procfs and walks
+// the TCP socket tables of the agent's network namespace, on Linux only.
+func collectSocketsInfo() SocketsInfo {
+	info := SocketsInfo{Status: "unavailable"}
+	if collectorOS != "linux" {
+		return info
+	}
+
+	if max, err := readUint("/proc/sys/net/netfilter/nf_conntrack_max"); err == nil && max > 0 {
+		info.ConntrackMax = max
+		info.ConntrackCount, _ = readUint("/proc/sys/net/netfilter/nf_conntrack_count")
+		info.ConntrackPercent = float64(info.ConntrackCount) / float64(max) * 100
+	}
+
+	if fields := strings.Fields(readTrimmed("/proc/sys/net/ipv4/ip_local_port_range")); len(fields) == 2 {
+		info.EphemeralPortRange[0], _ = strconv.Atoi(fields[0])
+		info.EphemeralPortRange[1], _ = strconv.Atoi(fields[1])
+	}
+
+	low, high := info.EphemeralPortRange[0], info.EphemeralPortRange[1]
+	ephemeral := map[int]bool{}
+	found := false
+	for _, path := range []string{"/proc/net/tcp", "/proc/net/tcp6"} {
+		file, err := hostFS.Open(path)
+		if err != nil {
+			continue
+		}
+		found = true
+		scanner := bufio.NewScanner(file)
+		scanner.Scan() // header
+		for scanner.Scan() {
+			// sl local_address rem_address st ...
+			fields := strings.Fields(scanner.Text())
+			if len(fields) < 4 {
+				continue
+			}
+			switch fields[3] {
+			case TCP_ESTABLISHED:
+				info.Established++
+			case TCP_TIME_WAIT:
+				info.TimeWait++
+			case TCP_CLOSE_WAIT:
+				info.CloseWait++
+			case TCP_LISTEN:
+				continue
+			}
+			_, portHex, ok := strings.Cut(fields[1], ":")
+			if !ok {
+				continue
+			}
+			port, err := strconv.ParseUint(portHex, 16, 16)
+			if err == nil && int(port) >= low && int(port) <= high {
+				ephemeral[int(port)] = true
+			}
+		}
+		file.Close()
+	}
+	if !found && info.ConntrackMax == 0 {
+		return info
+	}
+
+	info.EphemeralPortsUsed = len(ephemeral)
+	if high >= low && low > 0 {
+		info.EphemeralPercent = float64(len(ephemeral)) / float64(high-low+1) * 100
+	}
+	info.Status = "ok"
+	return info
+}
+
+func readUint(path string) (uint64, error) {
+	return strconv.ParseUint(readTrimmed(path), 10, 64)
+}
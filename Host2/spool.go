@@ -0,0 +1,170 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// spoolItem is one encoded snapshot waiting for delivery.
+type spoolItem struct {
+	seq  uint64
+	file string // empty for in-memory items
+	data []byte // nil for on-disk items until read
+	size int64
+}
+
+// spool is a bounded FIFO of encoded snapshots for one sink. With a
+// directory every item is a file, so undelivered snapshots survive
+// restarts; without one the items live in memory. When the size limit is
+// exceeded the oldest items are dropped.
+type spool struct {
+	mu      sync.Mutex
+	dir     string
+	limit   int64
+	items   []spoolItem
+	size    int64
+	seq     uint64
+	dropped int
+	wake    chan struct{}
+}
+
+func newSpool(dir string, limit int64) (*spool, error) {
+	s := &spool{dir: dir, limit: limit, wake: make(chan struct{}, 1)}
+	if dir == "" {
+		return s, nil
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create spool %s: %v", dir, err)
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read spool %s: %v", dir, err)
+	}
+	// File names are zero-padded timestamps, so name order is age order
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+	for _, entry := range entries {
+		if entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		s.seq++
+		s.items = append(s.items, spoolItem{seq: s.seq, file: filepath.Join(dir, entry.Name()), size: info.Size()})
+		s.size += info.Size()
+	}
+	s.trim()
+	if len(s.items) > 0 {
+		s.signal()
+	}
+	return s, nil
+}
+
+// push queues an item, writing it to disk first when the spool has a
+// directory.
+func (s *spool) push(data []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.seq++
+	item := spoolItem{seq: s.seq, data: data, size: int64(len(data))}
+	if s.dir != "" {
+		name := fmt.Sprintf("%020d-%06d", time.Now().UnixNano(), s.seq%1000000)
+		tmp := filepath.Join(s.dir, "."+name)
+		if err := os.WriteFile(tmp, data, 0644); err != nil {
+			return fmt.Errorf("failed to spool snapshot: %v", err)
+		}
+		item.file = filepath.Join(s.dir, name)
+		if err := os.Rename(tmp, item.file); err != nil {
+			os.Remove(tmp)
+			return fmt.Errorf("failed to spool snapshot: %v", err)
+		}
+		item.data = nil
+	}
+	s.items = append(s.items, item)
+	s.size += item.size
+	s.trim()
+	s.signal()
+	return nil
+}
+
+// trim drops the oldest items until the spool fits its limit.
+func (s *spool) trim() {
+	for s.limit > 0 && s.size > s.limit && len(s.items) > 1 {
+		s.remove(s.items[0])
+		s.items = s.items[1:]
+		s.dropped++
+	}
+}
+
+func (s *spool) remove(item spoolItem) {
+	s.size -= item.size
+	if item.file != "" {
+		if err := os.Remove(item.file); err != nil && !os.IsNotExist(err) {
+			log.Printf("[SINK] Failed to remove %s: %v", item.file, err)
+		}
+	}
+}
+
+func (s *spool) signal() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// peek returns up to n of the oldest items with their data loaded, and
+// the sequence number to acknowledge once they are delivered. Unreadable
+// files are discarded.
+func (s *spool) peek(n int) ([][]byte, uint64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var batch [][]byte
+	var last uint64
+	for i := 0; i < len(s.items) && len(batch) < n; i++ {
+		item := s.items[i]
+		data := item.data
+		if data == nil {
+			var err error
+			if data, err = os.ReadFile(item.file); err != nil {
+				log.Printf("[SINK] Discarding unreadable %s: %v", item.file, err)
+				s.remove(item)
+				s.items = append(s.items[:i], s.items[i+1:]...)
+				i--
+				continue
+			}
+		}
+		batch = append(batch, data)
+		last = item.seq
+	}
+	return batch, last
+}
+
+// ack removes every item up to and including seq. Items are identified by
+// sequence so a delivery racing a reload never removes newer items.
+func (s *spool) ack(seq uint64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	i := 0
+	for ; i < len(s.items) && s.items[i].seq <= seq; i++ {
+		s.remove(s.items[i])
+	}
+	s.items = append([]spoolItem{}, s.items[i:]...)
+}
+
+// stats reports the queued item count and bytes, and resets the count of
+// items dropped for space since the last call.
+func (s *spool) stats() (queued int, bytes int64, dropped int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	dropped, s.dropped = s.dropped, 0
+	return len(s.items), s.size, dropped
+}
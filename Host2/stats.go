@@ -0,0 +1,122 @@
+package main
+
+import (
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SeriesStats summarises one history series over a window.
+type SeriesStats struct {
+	Count      int     `json:"count"`
+	Min        float64 `json:"min"`
+	Max        float64 `json:"max"`
+	Avg        float64 `json:"avg"`
+	P50        float64 `json:"p50"`
+	P95        float64 `json:"p95"`
+	P99        float64 `json:"p99"`
+	Resolution string  `json:"resolution"`
+}
+
+// Series covered by /stats; metric names expand to all label variants
+var statsMetrics = []string{"cpu_usage_percent", "memory_usage_percent", "disk_used_percent", "temperature_cpu_celsius"}
+
+// percentile interpolates linearly between the closest ranks of sorted
+// values.
+func percentile(sorted []float64, p float64) float64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := p / 100 * float64(len(sorted)-1)
+	lower := int(math.Floor(rank))
+	upper := int(math.Ceil(rank))
+	return sorted[lower] + (sorted[upper]-sorted[lower])*(rank-float64(lower))
+}
+
+// parseWindow accepts Go durations plus a "d" suffix for days.
+func parseWindow(value string) (time.Duration, error) {
+	if days, ok := strings.CutSuffix(value, "d"); ok {
+		n, err := strconv.ParseFloat(days, 64)
+		if err != nil {
+			return 0, err
+		}
+		return time.Duration(n * float64(24*time.Hour)), nil
+	}
+	return time.ParseDuration(value)
+}
+
+// seriesStats computes the summary of one series. Beyond the raw window
+// percentiles and the average come from rollup averages, while min and max
+// use the rollup extremes.
+func seriesStats(key string, from, to time.Time) (SeriesStats, bool) {
+	points, resolution := history.pointsAt(key, from, to, "auto", "avg")
+	if len(points) == 0 {
+		return SeriesStats{}, false
+	}
+
+	values := make([]float64, len(points))
+	sum := 0.0
+	for i, p := range points {
+		values[i] = p.Value
+		sum += p.Value
+	}
+	sort.Float64s(values)
+
+	stats := SeriesStats{
+		Count:      len(values),
+		Min:        values[0],
+		Max:        values[len(values)-1],
+		Avg:        sum / float64(len(values)),
+		P50:        percentile(values, 50),
+		P95:        percentile(values, 95),
+		P99:        percentile(values, 99),
+		Resolution: resolution,
+	}
+	if resolution != "raw" {
+		lows, _ := history.pointsAt(key, from, to, resolution, "min")
+		highs, _ := history.pointsAt(key, from, to, resolution, "max")
+		for _, p := range lows {
+			stats.Min = math.Min(stats.Min, p.Value)
+		}
+		for _, p := range highs {
+			stats.Max = math.Max(stats.Max, p.Value)
+		}
+	}
+	return stats, true
+}
+
+// statsHandler returns min/max/avg/p50/p95/p99 of CPU, memory, disk and
+// temperature over ?window= (default 1h, e.g. 30m, 24h, 7d).
+func statsHandler(w http.ResponseWriter, r *http.Request) {
+	window := time.Hour
+	if v := r.URL.Query().Get("window"); v != "" {
+		d, err := parseWindow(v)
+		if err != nil || d <= 0 {
+			http.Error(w, "window must be a positive duration such as 30m, 24h or 7d", http.StatusBadRequest)
+			return
+		}
+		window = d
+	}
+
+	to := time.Now().UTC()
+	from := to.Add(-window)
+	stats := map[string]SeriesStats{}
+	for _, metric := range statsMetrics {
+		keys, _ := history.matchSeries(metric)
+		for _, key := range keys {
+			if s, ok := seriesStats(key, from, to); ok {
+				stats[key] = s
+			}
+		}
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"window": window.String(),
+		"from":   from.Format("2006-01-02T15:04:05Z"),
+		"to":     to.Format("2006-01-02T15:04:05Z"),
+		"stats":  stats,
+	})
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"time"
+)
+
+// telegrafMetrics shapes a snapshot for Telegraf's json parser: a flat
+// array of objects with the measurement, a unix timestamp, string tags and
+// numeric fields. Samples are grouped by measurement, the metric name up
+// to the first "_", and label set, so disk_used_percent{device="/"} becomes
+// field used_percent of measurement disk tagged device=/.
+func telegrafMetrics(m *SystemMetrics) []map[string]interface{} {
+	at, err := time.Parse("2006-01-02T15:04:05Z", m.Timestamp)
+	if err != nil {
+		at = time.Now()
+	}
+	tags := map[string]string{"host": m.System.Hostname, "agent_id": m.System.AgentID}
+	for k, v := range m.Labels {
+		tags[k] = v
+	}
+
+	groups := map[string]map[string]interface{}{}
+	for _, sample := range flattenMetrics(m) {
+		if math.IsNaN(sample.Value) || math.IsInf(sample.Value, 0) {
+			continue
+		}
+		measurement, field, found := strings.Cut(sample.Name, "_")
+		if !found {
+			field = "value"
+		}
+		key := seriesKey(measurement, sample.Labels)
+		group := groups[key]
+		if group == nil {
+			group = map[string]interface{}{"measurement": measurement, "timestamp": at.Unix()}
+			for k, v := range tags {
+				if v != "" {
+					group[k] = v
+				}
+			}
+			for k, v := range sample.Labels {
+				group[k] = v
+			}
+			groups[key] = group
+		}
+		group[field] = sample.Value
+	}
+
+	keys := make([]string, 0, len(groups))
+	for key := range groups {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	out := make([]map[string]interface{}, len(keys))
+	for i, key := range keys {
+		out[i] = groups[key]
+	}
+	return out
+}
@@ -0,0 +1,470 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// temperatureSource is one way of reading the CPU temperature. Sources in
+// a group can be selected together with temperature.source.
+type temperatureSource struct {
+	name  string
+	group string // "wmi", "hwmon" or "external"
+	os    string
+	exec  bool // runs a program; failures are remembered, see retry_seconds
+	read  func() (int, error)
+}
+
+// In the order "auto" tries them
+var temperatureSources = []temperatureSource{
+	{"librehardwaremonitor", "external", "windows", false, tempFromLHM},
+	{"wmi", "wmi", "windows", true, tempFromWMIThermalZone},
+	{"wmi-probe", "wmi", "windows", true, tempFromWMIProbe},
+	{"wmi-perf", "wmi", "windows", true, tempFromWMIPerfCounter},
+	{"powershell-wmi", "wmi", "windows", true, tempFromPowerShellWMI},
+	{"cim", "wmi", "windows", true, tempFromCIM},
+	{"lm-sensors", "external", "linux", true, tempFromLMSensors},
+	{"hwmon", "hwmon", "linux", false, tempFromHwmon},
+	{"thermal_zone", "hwmon", "linux", false, tempFromThermalZones},
+	{"acpi", "external", "linux", true, tempFromACPI},
+	{"coretemp", "hwmon", "linux", false, tempFromCoretemp},
+	{"osx-cpu-temp", "external", "darwin", true, tempFromOSXCPUTemp},
+	{"smc", "external", "darwin", true, tempFromSMC},
+}
+
+// HardwareSensor is a motherboard, CPU or GPU sensor reading.
+type HardwareSensor struct {
+	Hardware string  `json:"hardware"` // e.g. "AMD Ryzen 7 5800X", "Nuvoton NCT6798D"
+	Name     string  `json:"name"`     // e.g. "Core (Tctl/Tdie)", "Fan #2", "Vcore"
+	Type     string  `json:"type"`     // "temperature", "fan", "voltage" or "power"
+	Value    float64 `json:"value"`
+	Unit     string  `json:"unit"` // "°C", "RPM", "V" or "W"
+
+	// Limits programmed into the chip, and whether it flags the reading as
+	// outside them (e.g. undervoltage)
+	Min   *float64 `json:"min,omitempty"`
+	Max   *float64 `json:"max,omitempty"`
+	Alarm bool     `json:"alarm,omitempty"`
+}
+
+// temperatureSourceKnown reports whether name is a source or group.
+func temperatureSourceKnown(name string) bool {
+	for _, s := range temperatureSources {
+		if s.name == name || s.group == name {
+			return true
+		}
+	}
+	return false
+}
+
+func temperatureSourceNames() []string {
+	names := []string{"auto"}
+	seen := map[string]bool{"auto": true}
+	for _, s := range temperatureSources {
+		for _, name := range []string{s.group, s.name} {
+			if !seen[name] {
+				seen[name] = true
+				names = append(names, name)
+			}
+		}
+	}
+	return names
+}
+
+// A program-based source that failed, skipped until retry
+type temperatureFailure struct {
+	err   error
+	retry time.Time
+}
+
+// The source that produced the last reading, tried first next time, and
+// the failed program-based sources
+var temperatureCache = struct {
+	sync.Mutex
+	working string
+	failed  map[string]temperatureFailure
+}{failed: make(map[string]temperatureFailure)}
+
+// temperatureCandidates orders this platform's sources for one reading:
+// the configured source or group first (or alone when forced), and among
+// equals the one that worked last time.
+func temperatureCandidates(cfg TemperatureConfig) []temperatureSource {
+	var preferred, rest []temperatureSource
+	for _, s := range temperatureSources {
+		if s.os != collectorOS {
+			continue
+		}
+		if cfg.Source != "auto" && (s.name == cfg.Source || s.group == cfg.Source) {
+			preferred = append(preferred, s)
+		} else if !cfg.Force {
+			rest = append(rest, s)
+		}
+	}
+
+	temperatureCache.Lock()
+	working := temperatureCache.working
+	temperatureCache.Unlock()
+	first := func(list []temperatureSource) {
+		for i, s := range list {
+			if s.name == working {
+				copy(list[1:i+1], list[:i])
+				list[0] = s
+				return
+			}
+		}
+	}
+	if len(preferred) > 0 {
+		first(preferred)
+	} else {
+		first(rest)
+	}
+	return append(preferred, rest...)
+}
+
+// collectTemperatureInfo reads the CPU temperature from the first source
+// that has a plausible value, see temperature.source.
+func collectTemperatureInfo(cpuVendor string, trace *sectionTrace) TemperatureInfo {
+	tempInfo := TemperatureInfo{
+		CPUVendor: cpuVendor,
+		Status:    "unavailable",
+	}
+
+	cfg := currentConfig().Temperature
+	candidates := temperatureCandidates(cfg)
+	if len(candidates) == 0 {
+		trace.fail(cfg.Source, fmt.Errorf("not available on %s", collectorOS))
+	}
+
+	now := clock.Now()
+	for _, source := range candidates {
+		temperatureCache.Lock()
+		failure, failed := temperatureCache.failed[source.name]
+		temperatureCache.Unlock()
+		if failed && now.Before(failure.retry) {
+			trace.fail(source.name, fmt.Errorf("%s (retried after %s)", describeCollectorError(failure.err), failure.retry.UTC().Format("2006-01-02T15:04:05Z")))
+			continue
+		}
+
+		celsius, err := source.read()
+		if err == nil && (celsius <= 0 || celsius >= 150) {
+			err = errNoReading
+		}
+		temperatureCache.Lock()
+		if err != nil {
+			if source.exec {
+				temperatureCache.failed[source.name] = temperatureFailure{err, now.Add(time.Duration(cfg.RetrySeconds) * time.Second)}
+			}
+			temperatureCache.Unlock()
+			trace.fail(source.name, err)
+			continue
+		}
+		delete(temperatureCache.failed, source.name)
+		temperatureCache.working = source.name
+		temperatureCache.Unlock()
+
+		trace.ok(source.name)
+		tempInfo.CPUCelsius = celsius
+		tempInfo.Source = source.name
+		tempInfo.Status = "ok"
+		break
+	}
+
+	if collectorOS == "windows" || cfg.LHMURL != "" {
+		addLHMReadings(&tempInfo)
+	}
+	tempInfo.Sensors = append(tempInfo.Sensors, collectRailSensors()...)
+	return tempInfo
+}
+
+// wmicReading returns the first numeric row of a wmic table.
+func wmicReading(output []byte, header string) (int, error) {
+	for _, line := range strings.Split(string(output), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.Contains(line, header) {
+			continue
+		}
+		if value, err := strconv.Atoi(line); err == nil {
+			return value, nil
+		}
+	}
+	return 0, errNoReading
+}
+
+// tempFromWMIThermalZone reads MSAcpi_ThermalZoneTemperature, in tenths of
+// Kelvin.
+func tempFromWMIThermalZone() (int, error) {
+	output, err := commands.Output("wmic", "/namespace:\\\\root\\wmi", "PATH", "MSAcpi_ThermalZoneTemperature", "GET", "CurrentTemperature")
+	if err != nil {
+		return 0, err
+	}
+	temp, err := wmicReading(output, "CurrentTemperature")
+	return temp/10 - 273, err
+}
+
+// tempFromWMIProbe reads Win32_TemperatureProbe, in tenths of Kelvin.
+func tempFromWMIProbe() (int, error) {
+	output, err := commands.Output("wmic", "path", "Win32_TemperatureProbe", "get", "CurrentReading")
+	if err != nil {
+		return 0, err
+	}
+	temp, err := wmicReading(output, "CurrentReading")
+	return temp/10 - 273, err
+}
+
+// tempFromWMIPerfCounter reads the thermal zone performance counter, in
+// Kelvin.
+func tempFromWMIPerfCounter() (int, error) {
+	output, err := commands.Output("wmic", "path", "Win32_PerfFormattedData_Counters_ThermalZoneInformation", "get", "Temperature")
+	if err != nil {
+		return 0, err
+	}
+	temp, err := wmicReading(output, "Temperature")
+	return temp - 273, err
+}
+
+// tempFromPowerShellWMI queries MSAcpi_ThermalZoneTemperature through
+// PowerShell, which works on systems without wmic.
+func tempFromPowerShellWMI() (int, error) {
+	output, err := commands.Output("powershell", "-Command", "(Get-WmiObject -Namespace root/wmi -Class MSAcpi_ThermalZoneTemperature | Select-Object -First 1).CurrentTemperature")
+	if err != nil {
+		return 0, err
+	}
+	temp, err := strconv.Atoi(strings.TrimSpace(string(output)))
+	if err != nil {
+		return 0, errNoReading
+	}
+	return temp/10 - 273, nil
+}
+
+// tempFromCIM reads CIM_TemperatureSensor (newer Windows interface).
+func tempFromCIM() (int, error) {
+	output, err := commands.Output("powershell", "-Command", "(Get-CimInstance -ClassName CIM_TemperatureSensor | Select-Object -First 1).CurrentReading")
+	if err != nil {
+		return 0, err
+	}
+	temp, err := strconv.ParseFloat(strings.TrimSpace(string(output)), 64)
+	if err != nil {
+		return 0, errNoReading
+	}
+	return int(temp), nil
+}
+
+// tempFromLMSensors parses "sensors -u" (lm-sensors) for the first core or
+// package input.
+func tempFromLMSensors() (int, error) {
+	output, err := commands.Output("sensors", "-u")
+	if err != nil {
+		return 0, err
+	}
+	for _, line := range strings.Split(string(output), "\n") {
+		// Look for coretemp or k10temp (AMD/Intel)
+		if strings.Contains(line, "_input:") && (strings.Contains(line, "temp") || strings.Contains(line, "Core")) {
+			fields := strings.Fields(line)
+			if len(fields) >= 2 {
+				if temp, err := strconv.ParseFloat(fields[1], 64); err == nil && temp > 0 && temp < 150 {
+					return int(temp), nil
+				}
+			}
+		}
+	}
+	return 0, errNoReading
+}
+
+// readMillidegrees returns the first plausible reading among files holding
+// millidegrees Celsius.
+func readMillidegrees(files []string) (int, error) {
+	for _, file := range files {
+		data, err := hostFS.ReadFile(file)
+		if err != nil {
+			continue
+		}
+		if temp, err := strconv.Atoi(strings.TrimSpace(string(data))); err == nil {
+			if celsius := temp / 1000; celsius > 0 && celsius < 150 {
+				return celsius, nil
+			}
+		}
+	}
+	return 0, errNoReading
+}
+
+// tempFromHwmon reads the kernel's CPU sensors (coretemp, k10temp,
+// zenpower) under /sys/class/hwmon.
+func tempFromHwmon() (int, error) {
+	hwmonDirs, _ := hostFS.Glob("/sys/class/hwmon/hwmon*")
+	for _, hwmonDir := range hwmonDirs {
+		nameBytes, err := hostFS.ReadFile(filepath.Join(hwmonDir, "name"))
+		if err != nil {
+			continue
+		}
+		name := strings.ToLower(strings.TrimSpace(string(nameBytes)))
+		if strings.Contains(name, "coretemp") || strings.Contains(name, "k10temp") ||
+			strings.Contains(name, "zenpower") || strings.Contains(name, "cpu") {
+			tempFiles, _ := hostFS.Glob(filepath.Join(hwmonDir, "temp*_input"))
+			if celsius, err := readMillidegrees(tempFiles); err == nil {
+				return celsius, nil
+			}
+		}
+	}
+	return 0, errNoReading
+}
+
+// tempFromThermalZones reads /sys/class/thermal/thermal_zone*.
+func tempFromThermalZones() (int, error) {
+	zones, _ := hostFS.Glob("/sys/class/thermal/thermal_zone*/temp")
+	return readMillidegrees(zones)
+}
+
+// tempFromACPI parses "acpi -t": "Thermal 0: ok, 45.0 degrees C".
+func tempFromACPI() (int, error) {
+	output, err := commands.Output("acpi", "-t")
+	if err != nil {
+		return 0, err
+	}
+	for _, line := range strings.Split(string(output), "\n") {
+		if !strings.Contains(line, "ok,") {
+			continue
+		}
+		parts := strings.Split(line, ",")
+		if len(parts) >= 2 {
+			tempStr := strings.Split(strings.TrimSpace(parts[1]), " ")[0]
+			if temp, err := strconv.ParseFloat(tempStr, 64); err == nil && temp > 0 && temp < 150 {
+				return int(temp), nil
+			}
+		}
+	}
+	return 0, errNoReading
+}
+
+// tempFromCoretemp reads the package temperature of the Intel coretemp or
+// AMD k10temp platform device directly.
+func tempFromCoretemp() (int, error) {
+	var files []string
+	for _, pattern := range []string{
+		"/sys/devices/platform/coretemp.0/hwmon/hwmon*/temp1_input", // Intel
+		"/sys/devices/platform/k10temp.0/hwmon/hwmon*/temp1_input",  // AMD
+	} {
+		matches, _ := hostFS.Glob(pattern)
+		files = append(files, matches...)
+	}
+	return readMillidegrees(files)
+}
+
+// tempFromOSXCPUTemp runs osx-cpu-temp (Homebrew), which prints "61.8°C".
+func tempFromOSXCPUTemp() (int, error) {
+	output, err := commands.Output("osx-cpu-temp")
+	if err != nil {
+		return 0, err
+	}
+	temp, err := strconv.ParseFloat(strings.TrimSuffix(strings.TrimSpace(string(output)), "°C"), 64)
+	if err != nil {
+		return 0, errNoReading
+	}
+	return int(temp), nil
+}
+
+// tempFromSMC reads the CPU proximity key TC0P with smc.
+func tempFromSMC() (int, error) {
+	temp, err := smcValue("TC0P")
+	if err != nil {
+		return 0, err
+	}
+	if temp <= 0 || temp >= 150 {
+		return 0, errNoReading
+	}
+	return int(temp), nil
+}
+
+// smcValue reads an SMC key with smc, which prints
+// "  TC0P  [sp78]  45.5 (bytes 2d 80)".
+func smcValue(key string) (float64, error) {
+	output, err := commands.Output("smc", "-k", key, "-r")
+	if err != nil {
+		return 0, err
+	}
+	for _, line := range strings.Split(string(output), "\n") {
+		if !strings.Contains(line, "bytes") {
+			continue
+		}
+		fields := strings.Fields(line)
+		for i, field := range fields {
+			if strings.HasPrefix(field, "(bytes") && i > 0 {
+				if value, err := strconv.ParseFloat(fields[i-1], 64); err == nil {
+					return value, nil
+				}
+			}
+		}
+	}
+	return 0, errNoReading
+}
+
+// temperatureOffset returns the calibration offset configured for the first
+// of keys that has one.
+func temperatureOffset(cfg TemperatureConfig, keys ...string) float64 {
+	for _, key := range keys {
+		if offset, ok := cfg.Offsets[key]; ok {
+			return offset
+		}
+	}
+	return 0
+}
+
+// calibrate applies an offset to a reading in whole degrees; zero means no
+// reading and is left alone.
+func calibrate(celsius int, offset float64) int {
+	if celsius == 0 || offset == 0 {
+		return celsius
+	}
+	return int(math.Round(float64(celsius) + offset))
+}
+
+// fahrenheit converts a reading for temperature.fahrenheit, to a tenth of
+// a degree.
+func fahrenheit(celsius float64) *float64 {
+	f := math.Round((celsius*9/5+32)*10) / 10
+	return &f
+}
+
+// calibrateTemperatures applies temperature.offsets to freshly collected
+// CPU and drive readings (a CPU source's own offset wins over "cpu") and
+// adds the Fahrenheit values when configured.
+func calibrateTemperatures(info *TemperatureInfo) {
+	cfg := currentConfig().Temperature
+	info.CPUCelsius = calibrate(info.CPUCelsius, temperatureOffset(cfg, info.Source, "cpu"))
+	info.GPUCelsius = calibrate(info.GPUCelsius, temperatureOffset(cfg, "gpu"))
+	for i := range info.Drives {
+		d := &info.Drives[i]
+		if offset := temperatureOffset(cfg, d.Device, filepath.Base(d.Device)); offset != 0 && d.Celsius != 0 {
+			d.Celsius = math.Round((d.Celsius+offset)*10) / 10
+		}
+		if cfg.Fahrenheit {
+			d.Fahrenheit = fahrenheit(d.Celsius)
+		}
+	}
+	if cfg.Fahrenheit {
+		if info.CPUCelsius != 0 {
+			info.CPUFahrenheit = fahrenheit(float64(info.CPUCelsius))
+		}
+		if info.GPUCelsius != 0 {
+			info.GPUFahrenheit = fahrenheit(float64(info.GPUCelsius))
+		}
+	}
+}
+
+// calibrateGPUTemperatures does the same for the GPU devices, with the
+// "gpu" offset.
+func calibrateGPUTemperatures(info *GPUInfo) {
+	cfg := currentConfig().Temperature
+	offset := temperatureOffset(cfg, "gpu")
+	for i := range info.Devices {
+		d := &info.Devices[i]
+		d.TemperatureCelsius = calibrate(d.TemperatureCelsius, offset)
+		if cfg.Fahrenheit && d.TemperatureCelsius != 0 {
+			d.TemperatureFahrenheit = fahrenheit(float64(d.TemperatureCelsius))
+		}
+	}
+}
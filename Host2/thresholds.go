@@ -0,0 +1,96 @@
+package main
+
+// Status levels, ordered by severity
+var statusRank = map[string]int{"ok": 0, "warning": 1, "critical": 2}
+
+// thresholdStatus maps a value onto ok/warning/critical. A zero limit
+// disables that level.
+func thresholdStatus(value float64, t ThresholdConfig) string {
+	switch {
+	case t.Critical > 0 && value >= t.Critical:
+		return "critical"
+	case t.Warning > 0 && value >= t.Warning:
+		return "warning"
+	}
+	return "ok"
+}
+
+// applyStatusThresholds replaces the "ok" placeholders set by the collectors
+// with levels derived from the configured thresholds, then rolls them up
+// into the top-level health field. Sections that were not collected keep
+// their status and do not affect health.
+func applyStatusThresholds(m *SystemMetrics) {
+	cfg := currentConfig().Thresholds
+	health := "ok"
+	worst := func(status string) string {
+		if statusRank[status] > statusRank[health] {
+			health = status
+		}
+		return status
+	}
+
+	if m.CPU.Status == "ok" {
+		m.CPU.Status = worst(thresholdStatus(m.CPU.UsagePercent, cfg.CPU))
+	}
+	if m.Memory.Status == "ok" {
+		m.Memory.Status = worst(thresholdStatus(m.Memory.UsagePercent, cfg.Memory))
+	}
+	if m.Temperature.Status == "ok" {
+		m.Temperature.Status = worst(thresholdStatus(float64(m.Temperature.CPUCelsius), cfg.Temperature))
+	}
+	for i := range m.Disk {
+		// A mount whose usage call hung keeps its status but degrades health
+		if m.Disk[i].Status == "timeout" {
+			worst("warning")
+			continue
+		}
+		if m.Disk[i].Status == "read_only" {
+			worst("critical")
+			continue
+		}
+		m.Disk[i].Status = worst(thresholdStatus(m.Disk[i].UsedPercent, cfg.Disk))
+	}
+	if len(m.MissingMounts) > 0 {
+		worst("warning")
+	}
+	if m.Sockets.Status == "ok" {
+		m.Sockets.Status = worst(thresholdStatus(m.Sockets.pressurePercent(), cfg.Sockets))
+	}
+	if m.Limits.Status == "ok" {
+		for i := range m.Limits.Limits {
+			m.Limits.Limits[i].Status = thresholdStatus(m.Limits.Limits[i].Percent, cfg.Limits)
+		}
+		m.Limits.Status = worst(thresholdStatus(m.Limits.usedPercent(), cfg.Limits))
+	}
+	if m.Quotas.Status == "ok" && m.Quotas.NearLimit > 0 {
+		m.Quotas.Status = worst("warning")
+	}
+	if m.Entropy.Status == "ok" && m.Entropy.Available < currentConfig().Entropy.MinAvailable {
+		m.Entropy.Status = worst("warning")
+	}
+	for i := range m.Temperature.Drives {
+		m.Temperature.Drives[i].Status = worst(thresholdStatus(m.Temperature.Drives[i].Celsius, cfg.Drive))
+	}
+	// Pool and array statuses come from ZFS and md themselves
+	for _, pool := range m.ZFS.Pools {
+		worst(pool.Status)
+	}
+	for _, array := range m.RAID.Arrays {
+		worst(array.Status)
+	}
+	for _, w := range m.ProcessWatch {
+		switch w.Status {
+		case "missing":
+			worst("critical")
+		case "restarted":
+			worst("warning")
+		}
+	}
+	for _, t := range m.ScheduledTasks {
+		if t.Status == "failed" || t.Status == "overdue" {
+			worst("warning")
+		}
+	}
+
+	m.Health = health
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ANSI sequences used by the terminal dashboard
+const (
+	ansiClear     = "\033[H\033[2J"
+	ansiHide      = "\033[?25l"
+	ansiShow      = "\033[?25h"
+	ansiReset     = "\033[0m"
+	ansiBold      = "\033[1m"
+	ansiDim       = "\033[2m"
+	ansiGreen     = "\033[32m"
+	ansiYellow    = "\033[33m"
+	ansiRed       = "\033[31m"
+	tuiLabelWidth = 14
+)
+
+// topCommand renders metrics as a live terminal dashboard until Ctrl+C.
+// With --url it polls a running agent instead of collecting locally.
+func topCommand(args []string) error {
+	fs := newFlagSet("top")
+	interval := fs.Duration("interval", 2*time.Second, "refresh interval")
+	url := fs.String("url", "", "poll a running agent, e.g. http://host:8889, instead of collecting locally")
+	fs.Parse(args)
+
+	if *url == "" {
+		cfg, err := loadConfig()
+		if err != nil {
+			return err
+		}
+		applyConfig(cfg)
+	}
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt)
+	fmt.Print(ansiHide)
+	defer fmt.Print(ansiShow)
+
+	var previous *SystemMetrics
+	var previousAt time.Time
+	for {
+		var metrics *SystemMetrics
+		var err error
+		if *url != "" {
+			metrics, err = fetchRemoteMetrics(*url)
+		} else {
+			metrics, err = collectMetrics(true)
+		}
+		now := time.Now()
+
+		if err != nil {
+			fmt.Print(ansiClear + ansiRed + "Error: " + err.Error() + ansiReset + "\n")
+		} else {
+			fmt.Print(ansiClear + renderDashboard(metrics, previous, now.Sub(previousAt), terminalWidth()))
+			previous, previousAt = metrics, now
+		}
+
+		select {
+		case <-stop:
+			fmt.Println()
+			return nil
+		case <-time.After(*interval):
+		}
+	}
+}
+
+func fetchRemoteMetrics(base string) (*SystemMetrics, error) {
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Get(strings.TrimRight(base, "/") + "/metrics")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s returned %s", base, resp.Status)
+	}
+	metrics := &SystemMetrics{}
+	if err := json.NewDecoder(resp.Body).Decode(metrics); err != nil {
+		return nil, fmt.Errorf("invalid metrics response: %v", err)
+	}
+	return metrics, nil
+}
+
+// terminalWidth uses $COLUMNS when exported, otherwise 80.
+func terminalWidth() int {
+	if cols, err := strconv.Atoi(os.Getenv("COLUMNS")); err == nil && cols >= 40 {
+		return cols
+	}
+	return 80
+}
+
+func statusColor(status string) string {
+	switch status {
+	case "critical":
+		return ansiRed
+	case "warning":
+		return ansiYellow
+	case "ok":
+		return ansiGreen
+	}
+	return ansiDim
+}
+
+// gauge draws "label [#####.....]  42.0% detail" scaled to the width,
+// leaving room for a short detail column.
+func gauge(label string, percent float64, status, detail string, width int) string {
+	barWidth := width - tuiLabelWidth - 32
+	if barWidth < 10 {
+		barWidth = 10
+	}
+	filled := int(percent / 100 * float64(barWidth))
+	if filled < 0 {
+		filled = 0
+	}
+	if filled > barWidth {
+		filled = barWidth
+	}
+	if len(label) > tuiLabelWidth {
+		label = label[:tuiLabelWidth-1] + "~"
+	}
+	return fmt.Sprintf("%-*s [%s%s%s%s] %5.1f%% %s\n", tuiLabelWidth, label,
+		statusColor(status), strings.Repeat("█", filled), ansiReset,
+		strings.Repeat("·", barWidth-filled), percent, detail)
+}
+
+func formatRate(bytesPerSecond float64) string {
+	units := []string{"B/s", "KB/s", "MB/s", "GB/s"}
+	i := 0
+	for bytesPerSecond >= 1024 && i < len(units)-1 {
+		bytesPerSecond /= 1024
+		i++
+	}
+	return fmt.Sprintf("%7.1f %s", bytesPerSecond, units[i])
+}
+
+// renderDashboard lays out one frame. Network rates need the previous
+// sample and show as "-" on the first frame.
+func renderDashboard(m, previous *SystemMetrics, elapsed time.Duration, width int) string {
+	var b strings.Builder
+	uptime := time.Duration(m.System.UptimeSeconds) * time.Second
+	fmt.Fprintf(&b, "%s%s%s  %s  up %s  health %s%s%s  %s\n\n", ansiBold, m.System.Hostname, ansiReset,
+		m.Platform, uptime.Truncate(time.Minute), statusColor(m.Health), m.Health, ansiReset, m.Timestamp)
+
+	fmt.Fprintf(&b, "%sCPU%s  %s (%d threads)\n", ansiBold, ansiReset, m.CPU.Model, m.CPU.LogicalProcessors)
+	b.WriteString(gauge("usage", m.CPU.UsagePercent, m.CPU.Status, "", width))
+	if m.Temperature.Status == "ok" || m.Temperature.Status == "warning" || m.Temperature.Status == "critical" {
+		b.WriteString(gauge("temperature", float64(m.Temperature.CPUCelsius), m.Temperature.Status,
+			fmt.Sprintf("%d°C", m.Temperature.CPUCelsius), width))
+	}
+
+	fmt.Fprintf(&b, "\n%sMemory%s\n", ansiBold, ansiReset)
+	b.WriteString(gauge("used", m.Memory.UsagePercent, m.Memory.Status,
+		fmt.Sprintf("%d/%d MB", m.Memory.UsedMB, m.Memory.TotalMB), width))
+
+	if len(m.Disk) > 0 {
+		fmt.Fprintf(&b, "\n%sDisks%s\n", ansiBold, ansiReset)
+		for _, d := range m.Disk {
+			b.WriteString(gauge(d.Device, d.UsedPercent, d.Status, fmt.Sprintf("%.1f/%.1f GB", d.UsedGB, d.TotalGB), width))
+		}
+	}
+
+	if len(m.Network) > 0 {
+		fmt.Fprintf(&b, "\n%s%-*s%s %14s %14s\n", ansiBold, tuiLabelWidth, "Network", ansiReset, "RX", "TX")
+		prev := map[string]NetworkInfo{}
+		if previous != nil {
+			for _, n := range previous.Network {
+				prev[n.Iface] = n
+			}
+		}
+		ifaces := append([]NetworkInfo{}, m.Network...)
+		sort.Slice(ifaces, func(i, j int) bool { return ifaces[i].Iface < ifaces[j].Iface })
+		for _, n := range ifaces {
+			rx, tx := "-", "-"
+			if p, ok := prev[n.Iface]; ok && elapsed > 0 && n.RxBytes >= p.RxBytes && n.TxBytes >= p.TxBytes {
+				rx = formatRate(float64(n.RxBytes-p.RxBytes) / elapsed.Seconds())
+				tx = formatRate(float64(n.TxBytes-p.TxBytes) / elapsed.Seconds())
+			}
+			fmt.Fprintf(&b, "%-*s %14s %14s\n", tuiLabelWidth, n.Iface, rx, tx)
+		}
+	}
+
+	if len(m.GPU.Devices) > 0 {
+		fmt.Fprintf(&b, "\n%sGPU%s\n", ansiBold, ansiReset)
+		for _, g := range m.GPU.Devices {
+			fmt.Fprintf(&b, "%s %s (%d°C)\n", g.Vendor, g.Model, g.TemperatureCelsius)
+			b.WriteString(gauge("utilization", float64(g.UtilizationPercent), "ok", "", width))
+			if g.MemoryTotalMB > 0 {
+				b.WriteString(gauge("memory", float64(g.MemoryUsedMB)/float64(g.MemoryTotalMB)*100, "ok",
+					fmt.Sprintf("%d/%d MB", g.MemoryUsedMB, g.MemoryTotalMB), width))
+			}
+		}
+	}
+
+	if len(m.Alerts) > 0 {
+		fmt.Fprintf(&b, "\n%sAlerts%s\n", ansiBold, ansiReset)
+		for _, a := range m.Alerts {
+			fmt.Fprintf(&b, "%s%-8s%s %s\n", statusColor(a.Severity), a.Severity, ansiReset, a.Message)
+		}
+	}
+
+	fmt.Fprintf(&b, "\n%sCtrl+C to quit%s\n", ansiDim, ansiReset)
+	return b.String()
+}
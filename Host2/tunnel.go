@@ -0,0 +1,217 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"runtime"
+	"time"
+	"unicode/utf8"
+)
+
+// Longest wait between reconnection attempts
+const TUNNEL_MAX_BACKOFF = 60 * time.Second
+
+// tunnelMessage is one JSON text frame of the reverse tunnel. The agent
+// opens with "hello"; the aggregator sends "request" frames and gets a
+// "response" with the same id for each.
+type tunnelMessage struct {
+	Type       string            `json:"type"`
+	ID         string            `json:"id,omitempty"`
+	Method     string            `json:"method,omitempty"`
+	Path       string            `json:"path,omitempty"`
+	Headers    map[string]string `json:"headers,omitempty"`
+	Status     int               `json:"status,omitempty"`
+	Body       string            `json:"body,omitempty"`        // UTF-8 response bodies
+	BodyBase64 []byte            `json:"body_base64,omitempty"` // anything else (MessagePack, CBOR)
+
+	// hello
+	AgentID  string            `json:"agent_id,omitempty"`
+	Hostname string            `json:"hostname,omitempty"`
+	Labels   map[string]string `json:"labels,omitempty"`
+	Version  string            `json:"version,omitempty"`
+	Platform string            `json:"platform,omitempty"`
+}
+
+// tunnelResponse buffers a handler's response for the tunnel.
+type tunnelResponse struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (t *tunnelResponse) Header() http.Header { return t.header }
+
+func (t *tunnelResponse) WriteHeader(status int) {
+	if t.status == 0 {
+		t.status = status
+	}
+}
+
+func (t *tunnelResponse) Write(b []byte) (int, error) {
+	t.WriteHeader(http.StatusOK)
+	return t.body.Write(b)
+}
+
+// startTunnel keeps a WebSocket open to tunnel.url while it is set, so an
+// aggregator can query an agent behind NAT through the agent's own API
+// handler.
+func startTunnel(handler http.Handler) {
+	for {
+		reloaded := configReloaded()
+		cfg := currentConfig().Tunnel
+		if cfg.URL == "" {
+			<-reloaded
+			continue
+		}
+
+		stop := make(chan struct{})
+		done := make(chan struct{})
+		go func() {
+			runTunnel(cfg, handler, stop)
+			close(done)
+		}()
+		<-reloaded
+		close(stop)
+		<-done
+	}
+}
+
+// runTunnel connects and serves until stop is closed, reconnecting with
+// exponential backoff.
+func runTunnel(cfg TunnelConfig, handler http.Handler, stop <-chan struct{}) {
+	backoff := time.Second
+	for {
+		started := time.Now()
+		err := serveTunnel(cfg, handler, stop)
+		select {
+		case <-stop:
+			return
+		default:
+		}
+		// A connection that stayed up a while starts the backoff over
+		if time.Since(started) > TUNNEL_MAX_BACKOFF {
+			backoff = time.Second
+		}
+		log.Printf("[TUNNEL] Disconnected from %s, reconnecting in %v: %v", cfg.URL, backoff, err)
+		select {
+		case <-time.After(backoff):
+		case <-stop:
+			return
+		}
+		if backoff *= 2; backoff > TUNNEL_MAX_BACKOFF {
+			backoff = TUNNEL_MAX_BACKOFF
+		}
+	}
+}
+
+func serveTunnel(cfg TunnelConfig, handler http.Handler, stop <-chan struct{}) error {
+	ping := time.Duration(cfg.PingSeconds) * time.Second
+	ws, err := dialWebSocket(cfg.URL, cfg.Headers, 15*time.Second)
+	if err != nil {
+		return err
+	}
+	defer ws.close()
+	// Three missed pongs mean the path is dead even if TCP has not noticed
+	ws.readTimeout = 3 * ping
+
+	hello, _ := json.Marshal(tunnelMessage{
+		Type:     "hello",
+		AgentID:  agentID(),
+		Hostname: agentHostname(),
+		Labels:   currentConfig().Labels,
+		Version:  VERSION,
+		Platform: runtime.GOOS,
+	})
+	if err := ws.writeFrame(WS_TEXT, hello); err != nil {
+		return err
+	}
+	log.Printf("[TUNNEL] Connected to %s", cfg.URL)
+
+	closed := make(chan struct{})
+	defer close(closed)
+	go func() {
+		ticker := time.NewTicker(ping)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if ws.writeFrame(WS_PING, nil) != nil {
+					return
+				}
+			case <-stop:
+				// Unblocks the read loop below
+				ws.conn.Close()
+				return
+			case <-closed:
+				return
+			}
+		}
+	}()
+
+	for {
+		opcode, data, err := ws.readMessage()
+		if err != nil {
+			return err
+		}
+		if opcode != WS_TEXT {
+			continue
+		}
+		var msg tunnelMessage
+		if err := json.Unmarshal(data, &msg); err != nil || msg.Type != "request" {
+			log.Printf("[TUNNEL] Ignoring invalid message from %s", cfg.URL)
+			continue
+		}
+		go func(msg tunnelMessage) {
+			reply, _ := json.Marshal(handleTunnelRequest(handler, msg, ws.conn.RemoteAddr().String()))
+			ws.writeFrame(WS_TEXT, reply)
+		}(msg)
+	}
+}
+
+// handleTunnelRequest runs one request through the API handler, with the
+// aggregator's address as the client for the IP lists and audit log. Only
+// reads are served, whatever the API token would allow.
+func handleTunnelRequest(handler http.Handler, msg tunnelMessage, remoteAddr string) tunnelMessage {
+	reply := tunnelMessage{Type: "response", ID: msg.ID}
+	if msg.Method == "" {
+		msg.Method = http.MethodGet
+	}
+	if msg.Method != http.MethodGet && msg.Method != http.MethodHead {
+		reply.Status = http.StatusMethodNotAllowed
+		reply.Body = "Only GET and HEAD are served over the tunnel\n"
+		return reply
+	}
+
+	req, err := http.NewRequest(msg.Method, msg.Path, nil)
+	if err != nil || len(msg.Path) == 0 || msg.Path[0] != '/' {
+		reply.Status = http.StatusBadRequest
+		reply.Body = "path must be absolute\n"
+		return reply
+	}
+	for k, v := range msg.Headers {
+		req.Header.Set(k, v)
+	}
+	req.RemoteAddr = remoteAddr
+
+	recorder := &tunnelResponse{header: http.Header{}}
+	handler.ServeHTTP(recorder, req)
+	if recorder.status == 0 {
+		recorder.status = http.StatusOK
+	}
+
+	reply.Status = recorder.status
+	reply.Headers = map[string]string{}
+	for k := range recorder.header {
+		reply.Headers[k] = recorder.header.Get(k)
+	}
+	body, _ := io.ReadAll(&recorder.body)
+	if utf8.Valid(body) && recorder.header.Get("Content-Encoding") == "" {
+		reply.Body = string(body)
+	} else {
+		reply.BodyBase64 = body
+	}
+	return reply
+}
@@ -0,0 +1,497 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/shirou/gopsutil/v3/process"
+)
+
+const (
+	// Records an installed release until it has proven healthy
+	UPDATE_STATE_FILE = "agent_update.json"
+	// Starts a new release gets to become healthy before it is rolled back
+	UPDATE_MAX_STARTS = 3
+	UPDATE_MAX_BINARY = 256 * 1024 * 1024
+	// Set on the process started by restartAgent on Windows, which must
+	// wait for its predecessor to release the listen addresses
+	UPDATE_WAIT_PID_ENV = "HOST_AGENT_WAIT_PID"
+)
+
+// UpdateManifest is the signed description of a channel's current release,
+// published at update.url with its Ed25519 signature at update.url + ".sig".
+type UpdateManifest struct {
+	Version    string                  `json:"version"`
+	ReleasedAt string                  `json:"released_at,omitempty"`
+	Notes      string                  `json:"notes,omitempty"`
+	Binaries   map[string]UpdateBinary `json:"binaries"` // by "GOOS/GOARCH"
+}
+
+// UpdateBinary is one platform's executable. A relative url is resolved
+// against the manifest URL.
+type UpdateBinary struct {
+	URL    string `json:"url"`
+	SHA256 string `json:"sha256"`
+}
+
+// updateState is kept in UPDATE_STATE_FILE between installing a release and
+// confirming that it works.
+type updateState struct {
+	Version         string `json:"version"`
+	PreviousVersion string `json:"previous_version"`
+	Backup          string `json:"backup"`
+	InstalledAt     string `json:"installed_at"`
+	Starts          int    `json:"starts"`
+}
+
+var updateHTTPClient = &http.Client{Timeout: 5 * time.Minute}
+
+// Resolved at startup, as the path reported later follows the file when an
+// update renames it
+var startupExecutable, startupExecutableErr = os.Executable()
+
+// parseUpdateKey accepts an Ed25519 public key as PEM (as written by
+// "openssl pkey -pubout") or as the base64 of its 32 bytes.
+func parseUpdateKey(s string) (ed25519.PublicKey, error) {
+	if block, _ := pem.Decode([]byte(s)); block != nil {
+		parsed, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		key, ok := parsed.(ed25519.PublicKey)
+		if !ok {
+			return nil, fmt.Errorf("not an Ed25519 key")
+		}
+		return key, nil
+	}
+	raw, err := base64.StdEncoding.DecodeString(strings.TrimSpace(s))
+	if err != nil || len(raw) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("expected a PEM public key or %d base64-encoded bytes", ed25519.PublicKeySize)
+	}
+	return ed25519.PublicKey(raw), nil
+}
+
+// updatePaths returns the running executable, where the previous one is
+// kept after an update, and the state file next to them.
+func updatePaths() (exe, backup, state string, err error) {
+	if exe, err = startupExecutable, startupExecutableErr; err != nil {
+		return "", "", "", err
+	}
+	if resolved, err := filepath.EvalSymlinks(exe); err == nil {
+		exe = resolved
+	}
+	ext := filepath.Ext(exe)
+	backup = strings.TrimSuffix(exe, ext) + ".old" + ext
+	return exe, backup, filepath.Join(filepath.Dir(exe), UPDATE_STATE_FILE), nil
+}
+
+func fetchLimited(rawURL string, limit int64) ([]byte, error) {
+	resp, err := updateHTTPClient.Get(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s: unexpected status %d", rawURL, resp.StatusCode)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > limit {
+		return nil, fmt.Errorf("%s: larger than %d bytes", rawURL, limit)
+	}
+	return data, nil
+}
+
+// fetchManifest downloads the channel manifest and checks its signature,
+// which may be the raw 64 bytes or their base64.
+func fetchManifest(cfg UpdateConfig) (*UpdateManifest, error) {
+	data, err := fetchLimited(cfg.URL, 1024*1024)
+	if err != nil {
+		return nil, err
+	}
+	sig, err := fetchLimited(cfg.URL+".sig", 1024)
+	if err != nil {
+		return nil, fmt.Errorf("fetching signature: %v", err)
+	}
+	if len(sig) != ed25519.SignatureSize {
+		if sig, err = base64.StdEncoding.DecodeString(strings.TrimSpace(string(sig))); err != nil {
+			return nil, fmt.Errorf("invalid signature encoding")
+		}
+	}
+	if !ed25519.Verify(cfg.publicKey, data, sig) {
+		return nil, fmt.Errorf("manifest signature does not match update.public_key")
+	}
+
+	var manifest UpdateManifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, fmt.Errorf("invalid manifest: %v", err)
+	}
+	if manifest.Version == "" {
+		return nil, fmt.Errorf("manifest has no version")
+	}
+	return &manifest, nil
+}
+
+// compareVersions orders dotted numeric versions such as "1.10.2"; a
+// leading "v" and any "-pre" or "+build" suffix are ignored.
+func compareVersions(a, b string) int {
+	parts := func(v string) []int {
+		v = strings.TrimPrefix(v, "v")
+		if i := strings.IndexAny(v, "-+"); i >= 0 {
+			v = v[:i]
+		}
+		var nums []int
+		for _, field := range strings.Split(v, ".") {
+			n, _ := strconv.Atoi(field)
+			nums = append(nums, n)
+		}
+		return nums
+	}
+	pa, pb := parts(a), parts(b)
+	for i := 0; i < len(pa) || i < len(pb); i++ {
+		var x, y int
+		if i < len(pa) {
+			x = pa[i]
+		}
+		if i < len(pb) {
+			y = pb[i]
+		}
+		if x != y {
+			if x < y {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
+
+// installRelease downloads this platform's binary, verifies its checksum,
+// makes sure it runs, and swaps it in for the current executable, which is
+// kept as the rollback copy. The new binary proves itself on its next start
+// (see checkPendingUpdate).
+func installRelease(cfg UpdateConfig, manifest *UpdateManifest) error {
+	platform := runtime.GOOS + "/" + runtime.GOARCH
+	binary, ok := manifest.Binaries[platform]
+	if !ok {
+		return fmt.Errorf("release %s has no binary for %s", manifest.Version, platform)
+	}
+	base, _ := url.Parse(cfg.URL)
+	ref, err := url.Parse(binary.URL)
+	if err != nil {
+		return fmt.Errorf("invalid binary url: %v", err)
+	}
+	exe, backup, statePath, err := updatePaths()
+	if err != nil {
+		return err
+	}
+
+	data, err := fetchLimited(base.ResolveReference(ref).String(), UPDATE_MAX_BINARY)
+	if err != nil {
+		return err
+	}
+	sum := sha256.Sum256(data)
+	if !strings.EqualFold(hex.EncodeToString(sum[:]), binary.SHA256) {
+		return fmt.Errorf("checksum mismatch for %s: got %x", binary.URL, sum)
+	}
+
+	ext := filepath.Ext(exe)
+	staged := strings.TrimSuffix(exe, ext) + ".new" + ext
+	if err := os.WriteFile(staged, data, 0755); err != nil {
+		return fmt.Errorf("cannot write %s: %v", staged, err)
+	}
+	defer os.Remove(staged)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+	out, err := exec.CommandContext(ctx, staged, "version").Output()
+	if err != nil || !strings.HasPrefix(string(out), "host-agent "+manifest.Version) {
+		return fmt.Errorf("new binary failed its self-test (%v): %s", err, bytes.TrimSpace(out))
+	}
+
+	os.Remove(backup)
+	if err := os.Rename(exe, backup); err != nil {
+		return fmt.Errorf("cannot move %s aside: %v", exe, err)
+	}
+	if err := os.Rename(staged, exe); err != nil {
+		os.Rename(backup, exe)
+		return fmt.Errorf("cannot install %s: %v", exe, err)
+	}
+
+	state, _ := json.MarshalIndent(updateState{
+		Version:         manifest.Version,
+		PreviousVersion: VERSION,
+		Backup:          backup,
+		InstalledAt:     time.Now().UTC().Format("2006-01-02T15:04:05Z"),
+	}, "", "  ")
+	if err := os.WriteFile(statePath, state, 0644); err != nil {
+		log.Printf("[UPDATE] Cannot record the update in %s, rollback is manual: %v", statePath, err)
+	}
+	log.Printf("[UPDATE] Installed %s (was %s, kept as %s)", manifest.Version, VERSION, backup)
+	return nil
+}
+
+// rollbackUpdate puts the kept executable back.
+func rollbackUpdate() error {
+	exe, backup, statePath, err := updatePaths()
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(backup); err != nil {
+		return fmt.Errorf("no previous version to roll back to (%s)", backup)
+	}
+	// Windows cannot overwrite a running executable but can rename it
+	failed := exe + ".failed"
+	os.Remove(failed)
+	if err := os.Rename(exe, failed); err != nil {
+		return fmt.Errorf("cannot move %s aside: %v", exe, err)
+	}
+	if err := os.Rename(backup, exe); err != nil {
+		os.Rename(failed, exe)
+		return fmt.Errorf("cannot restore %s: %v", backup, err)
+	}
+	os.Remove(failed)
+	os.Remove(statePath)
+	return nil
+}
+
+// checkPendingUpdate runs when serving starts. A release installed by
+// installRelease gets UPDATE_MAX_STARTS starts, each allowed
+// update.health_check_seconds to pass updateHealthy; otherwise the previous
+// executable is restored and started.
+func checkPendingUpdate() {
+	waitForPredecessor()
+
+	_, _, statePath, err := updatePaths()
+	if err != nil {
+		return
+	}
+	data, err := os.ReadFile(statePath)
+	if err != nil {
+		return
+	}
+	var state updateState
+	if err := json.Unmarshal(data, &state); err != nil || state.Version != VERSION {
+		// Not running the release being tried: it was already rolled back
+		os.Remove(statePath)
+		return
+	}
+
+	state.Starts++
+	if state.Starts > UPDATE_MAX_STARTS {
+		failUpdate(state, fmt.Sprintf("not healthy after %d starts", UPDATE_MAX_STARTS))
+		return
+	}
+	data, _ = json.MarshalIndent(state, "", "  ")
+	os.WriteFile(statePath, data, 0644)
+
+	go func() {
+		time.Sleep(time.Duration(currentConfig().Update.HealthCheckSeconds) * time.Second)
+		if err := updateHealthy(); err != nil {
+			failUpdate(state, err.Error())
+			return
+		}
+		os.Remove(statePath)
+		log.Printf("[UPDATE] Release %s is healthy", state.Version)
+	}()
+}
+
+func failUpdate(state updateState, reason string) {
+	log.Printf("[UPDATE] Release %s failed its health check (%s); rolling back to %s", state.Version, reason, state.PreviousVersion)
+	if err := rollbackUpdate(); err != nil {
+		log.Printf("[UPDATE] Rollback failed: %v", err)
+		return
+	}
+	restartAgent()
+}
+
+// updateHealthy requires a completed collection and an API that answers.
+// Any status short of a server error counts, since api.allow may well
+// refuse the loopback address.
+func updateHealthy() error {
+	sectionState.Lock()
+	collected := sectionState.last != nil
+	sectionState.Unlock()
+	if !collected {
+		return fmt.Errorf("no metrics collected yet")
+	}
+
+	addrs, err := resolveListenAddresses(currentConfig().API.Listen)
+	if err != nil || len(addrs) == 0 {
+		return fmt.Errorf("no API address: %v", err)
+	}
+	host, port, _ := net.SplitHostPort(addrs[0])
+	if ip := net.ParseIP(host); host == "" || (ip != nil && ip.IsUnspecified()) {
+		host = "127.0.0.1"
+		if ip != nil && ip.To4() == nil {
+			host = "::1"
+		}
+	}
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Get("http://" + net.JoinHostPort(host, port) + "/health")
+	if err != nil {
+		return fmt.Errorf("API not answering: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 500 {
+		return fmt.Errorf("API answered %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// waitForPredecessor blocks, for up to 30 seconds, until the process that
+// started this one through restartAgent has exited.
+func waitForPredecessor() {
+	pid, err := strconv.Atoi(os.Getenv(UPDATE_WAIT_PID_ENV))
+	os.Unsetenv(UPDATE_WAIT_PID_ENV)
+	if err != nil {
+		return
+	}
+	for deadline := time.Now().Add(30 * time.Second); time.Now().Before(deadline); time.Sleep(200 * time.Millisecond) {
+		if exists, err := process.PidExists(int32(pid)); err != nil || !exists {
+			return
+		}
+	}
+}
+
+// runUpdate checks the channel and installs a newer release (any release
+// with force). It reports whether one was installed.
+func runUpdate(cfg UpdateConfig, force bool) (bool, error) {
+	manifest, err := fetchManifest(cfg)
+	if err != nil {
+		return false, err
+	}
+	if !force && compareVersions(manifest.Version, VERSION) <= 0 {
+		return false, nil
+	}
+	if err := installRelease(cfg, manifest); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// startAutoUpdate checks update.url every update.interval_hours while
+// update.auto is set, and restarts into a newly installed release.
+func startAutoUpdate() {
+	for {
+		reloaded := configReloaded()
+		cfg := currentConfig().Update
+		if !cfg.Auto || cfg.URL == "" || readOnlyMode {
+			<-reloaded
+			continue
+		}
+
+		_, _, statePath, _ := updatePaths()
+		if _, err := os.Stat(statePath); err == nil {
+			// The running release has not been confirmed yet
+		} else if installed, err := runUpdate(cfg, false); err != nil {
+			log.Printf("[UPDATE] Checking %s failed: %v", cfg.URL, err)
+		} else if installed {
+			restartAgent()
+		}
+
+		select {
+		case <-time.After(time.Duration(cfg.IntervalHours) * time.Hour):
+		case <-reloaded:
+		}
+	}
+}
+
+// restartService restarts the agent installed by "host-agent install" so
+// it runs the new executable.
+func restartService(name string) error {
+	var steps [][]string
+	switch runtime.GOOS {
+	case "linux":
+		steps = [][]string{{"systemctl", "restart", name}}
+	case "darwin":
+		steps = [][]string{{"launchctl", "kickstart", "-k", "system/com." + name}}
+	case "windows":
+		steps = [][]string{{"schtasks", "/End", "/TN", name}, {"schtasks", "/Run", "/TN", name}}
+	default:
+		return fmt.Errorf("restart the agent to run the new version")
+	}
+	for _, step := range steps {
+		out, err := exec.Command(step[0], step[1:]...).CombinedOutput()
+		if err != nil {
+			return fmt.Errorf("%s failed: %v: %s", strings.Join(step, " "), err, strings.TrimSpace(string(out)))
+		}
+	}
+	return nil
+}
+
+// updateCommand checks the configured channel and installs a newer
+// release, or with --rollback restores the previous executable.
+func updateCommand(args []string) error {
+	fs := newFlagSet("update")
+	check := fs.Bool("check", false, "only report whether a newer release is available")
+	force := fs.Bool("force", false, "install the channel's release even if it is not newer")
+	rollback := fs.Bool("rollback", false, "restore the executable replaced by the last update")
+	restart := fs.Bool("restart", true, "restart the installed service afterwards")
+	name := fs.String("name", "host-agent", "service name given to install")
+	fs.Parse(args)
+
+	if *rollback {
+		if err := rollbackUpdate(); err != nil {
+			return err
+		}
+		fmt.Println("Restored the previous version")
+	} else {
+		cfg, err := loadConfig()
+		if err != nil {
+			return err
+		}
+		if cfg.Update.URL == "" {
+			return fmt.Errorf("update.url is not configured")
+		}
+		manifest, err := fetchManifest(cfg.Update)
+		if err != nil {
+			return err
+		}
+		newer := compareVersions(manifest.Version, VERSION) > 0
+		fmt.Printf("Installed: %s\nAvailable: %s\n", VERSION, manifest.Version)
+		if !newer && !*force {
+			fmt.Println("Already up to date")
+			return nil
+		}
+		if *check {
+			fmt.Println("Run \"host-agent update\" to install it")
+			return nil
+		}
+		if err := installRelease(cfg.Update, manifest); err != nil {
+			return err
+		}
+		fmt.Printf("Installed %s; it is rolled back unless healthy within %d seconds of starting\n", manifest.Version, cfg.Update.HealthCheckSeconds)
+	}
+
+	if !*restart {
+		return nil
+	}
+	if err := restartService(*name); err != nil {
+		return fmt.Errorf("%v; restart the agent to run the new version", err)
+	}
+	fmt.Printf("Restarted %s\n", *name)
+	return nil
+}
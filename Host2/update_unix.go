@@ -0,0 +1,24 @@
+//go:build !windows
+
+package main
+
+import (
+	"log"
+	"os"
+	"syscall"
+)
+
+// restartAgent replaces the process with the executable now on disk,
+// keeping the PID a service manager watches. Listening sockets are
+// close-on-exec, so the new process can bind them again.
+func restartAgent() {
+	exe, _, _, err := updatePaths()
+	if err != nil {
+		log.Printf("[UPDATE] Cannot restart: %v", err)
+		return
+	}
+	log.Printf("[UPDATE] Restarting %s", exe)
+	if err := syscall.Exec(exe, os.Args, os.Environ()); err != nil {
+		log.Printf("[UPDATE] Cannot restart: %v", err)
+	}
+}
@@ -0,0 +1,30 @@
+//go:build windows
+
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+)
+
+// restartAgent starts the executable now on disk with the same arguments
+// and exits; the new process waits for this one to release its listen
+// addresses.
+func restartAgent() {
+	exe, _, _, err := updatePaths()
+	if err != nil {
+		log.Printf("[UPDATE] Cannot restart: %v", err)
+		return
+	}
+	cmd := exec.Command(exe, os.Args[1:]...)
+	cmd.Env = append(os.Environ(), fmt.Sprintf("%s=%d", UPDATE_WAIT_PID_ENV, os.Getpid()))
+	cmd.Stdout, cmd.Stderr = os.Stdout, os.Stderr
+	if err := cmd.Start(); err != nil {
+		log.Printf("[UPDATE] Cannot restart: %v", err)
+		return
+	}
+	log.Printf("[UPDATE] Restarted as PID %d", cmd.Process.Pid)
+	os.Exit(0)
+}
@@ -0,0 +1,229 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// UpdatesInfo reports patch compliance: package updates waiting to be
+// installed and whether an installed update still needs a reboot.
+type UpdatesInfo struct {
+	Pending        int            `json:"pending"`
+	Security       int            `json:"security"` // of pending, where the package manager classifies them
+	Sources        []UpdateSource `json:"sources"`
+	RebootRequired bool           `json:"reboot_required"`
+	RebootReasons  []string       `json:"reboot_reasons"` // e.g. packages from /var/run/reboot-required.pkgs
+	Status         string         `json:"status"`
+}
+
+// UpdateSource is one package manager's view of the pending updates.
+type UpdateSource struct {
+	Name     string `json:"name"` // "apt", "dnf", "yum", "windows_update" or "winget"
+	Pending  int    `json:"pending"`
+	Security int    `json:"security"`
+	Error    string `json:"error,omitempty"`
+}
+
+// Package managers are asked from their local metadata only (no refresh,
+// no online search), so a collection does not wait on mirrors; the OS's
+// own update timer keeps that metadata current.
+func collectUpdatesInfo(trace *sectionTrace) UpdatesInfo {
+	info := UpdatesInfo{Sources: []UpdateSource{}, RebootReasons: []string{}, Status: "unavailable"}
+
+	var checks []func() (UpdateSource, error)
+	switch collectorOS {
+	case "linux":
+		checks = []func() (UpdateSource, error){aptUpdates, dnfUpdates}
+	case "windows":
+		checks = []func() (UpdateSource, error){windowsUpdates, wingetUpdates}
+	default:
+		trace.fail("updates", fmt.Errorf("not supported on %s", collectorOS))
+		return info
+	}
+
+	var methods []string
+	for _, check := range checks {
+		source, err := check()
+		if source.Name == "" {
+			// The package manager is not installed
+			continue
+		}
+		if err != nil {
+			source.Error = describeCollectorError(err)
+			trace.fail(source.Name, err)
+		} else {
+			methods = append(methods, source.Name)
+			info.Pending += source.Pending
+			info.Security += source.Security
+		}
+		info.Sources = append(info.Sources, source)
+	}
+
+	info.RebootRequired, info.RebootReasons = rebootRequired()
+	if len(methods) > 0 {
+		trace.ok(strings.Join(methods, ", "))
+		info.Status = "ok"
+	} else if len(info.Sources) == 0 {
+		trace.fail("updates", errors.New("no supported package manager found"))
+	}
+	return info
+}
+
+// aptUpdates simulates a dist-upgrade; security updates come from a
+// "-security" suite, e.g. "Inst openssl [3.0.2-0ubuntu1.14] (3.0.2-0ubuntu1.15
+// Ubuntu:22.04/jammy-security [amd64])".
+func aptUpdates() (UpdateSource, error) {
+	if _, err := commands.LookPath("apt-get"); err != nil {
+		return UpdateSource{}, nil
+	}
+	source := UpdateSource{Name: "apt"}
+	output, err := commands.Output("apt-get", "-s", "-o", "Debug::NoLocking=1", "dist-upgrade")
+	if err != nil {
+		return source, err
+	}
+	for _, line := range strings.Split(string(output), "\n") {
+		if !strings.HasPrefix(line, "Inst ") {
+			continue
+		}
+		source.Pending++
+		if strings.Contains(line, "-security") {
+			source.Security++
+		}
+	}
+	return source, nil
+}
+
+// dnfUpdates lists updates from the cached metadata; check-update exits
+// with 100 when there are some.
+func dnfUpdates() (UpdateSource, error) {
+	name := "dnf"
+	if _, err := commands.LookPath(name); err != nil {
+		name = "yum"
+		if _, err := commands.LookPath(name); err != nil {
+			return UpdateSource{}, nil
+		}
+	}
+	source := UpdateSource{Name: name}
+	output, err := commands.Output(name, "-q", "--cacheonly", "check-update")
+	var exitErr *exec.ExitError
+	if err != nil && !(errors.As(err, &exitErr) && exitErr.ExitCode() == 100) {
+		return source, err
+	}
+	source.Pending = countPackageLines(output)
+
+	// updateinfo needs the advisory metadata, which not every repository has
+	if output, err := commands.Output(name, "-q", "--cacheonly", "updateinfo", "list", "--security"); err == nil {
+		source.Security = countPackageLines(output)
+	}
+	return source, nil
+}
+
+// countPackageLines counts the "name.arch version repository" lines of
+// dnf's listings, stopping at the obsoletes section.
+func countPackageLines(output []byte) int {
+	count := 0
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, "Obsoleting") {
+			break
+		}
+		if fields := strings.Fields(line); len(fields) == 3 && !strings.HasPrefix(line, " ") {
+			count++
+		}
+	}
+	return count
+}
+
+// windowsUpdatesScript searches the Windows Update agent's cached results
+// instead of going online, which can take minutes.
+const windowsUpdatesScript = `$s = (New-Object -ComObject Microsoft.Update.Session).CreateUpdateSearcher()
+$s.Online = $false
+$r = $s.Search('IsInstalled=0 and IsHidden=0 and Type=''Software''')
+$sec = @($r.Updates | Where-Object { $_.MsrcSeverity -or ($_.Categories | Where-Object { $_.Name -eq 'Security Updates' }) }).Count
+ConvertTo-Json -Compress @{ pending = $r.Updates.Count; security = $sec }`
+
+func windowsUpdates() (UpdateSource, error) {
+	source := UpdateSource{Name: "windows_update"}
+	output, err := commands.Output("powershell", "-NoProfile", "-Command", windowsUpdatesScript)
+	if err != nil {
+		return source, err
+	}
+	var result struct{ Pending, Security int }
+	if err := json.Unmarshal(bytes.TrimSpace(output), &result); err != nil {
+		return source, fmt.Errorf("unexpected output: %v", err)
+	}
+	source.Pending, source.Security = result.Pending, result.Security
+	return source, nil
+}
+
+// wingetUpdates counts the rows of "winget upgrade" below its header rule.
+func wingetUpdates() (UpdateSource, error) {
+	if _, err := commands.LookPath("winget"); err != nil {
+		return UpdateSource{}, nil
+	}
+	source := UpdateSource{Name: "winget"}
+	output, err := commands.Output("winget", "upgrade", "--accept-source-agreements", "--disable-interactivity")
+	if err != nil && len(output) == 0 {
+		return source, err
+	}
+	rows := false
+	for _, line := range strings.Split(string(output), "\n") {
+		line = strings.TrimSpace(line)
+		switch {
+		case strings.HasPrefix(line, "---"):
+			rows = true
+		case line == "":
+			rows = false
+		case rows && !strings.Contains(line, "upgrades available") && !strings.Contains(line, "package(s)"):
+			source.Pending++
+		}
+	}
+	return source, nil
+}
+
+// windowsRebootScript checks the registry flags Windows Update and
+// component servicing set while an installation waits for a restart.
+const windowsRebootScript = `$k = 'HKLM:\SOFTWARE\Microsoft\Windows\CurrentVersion'
+if (Test-Path "$k\WindowsUpdate\Auto Update\RebootRequired") { 'Windows Update' }
+if (Test-Path "$k\Component Based Servicing\RebootPending") { 'Component Based Servicing' }
+if ((Get-ItemProperty 'HKLM:\SYSTEM\CurrentControlSet\Control\Session Manager' -ErrorAction SilentlyContinue).PendingFileRenameOperations) { 'Pending file rename operations' }`
+
+// rebootRequired reports whether installed updates wait for a reboot, and
+// what needs it.
+func rebootRequired() (bool, []string) {
+	reasons := []string{}
+	switch collectorOS {
+	case "linux":
+		// Debian and Ubuntu
+		if _, err := hostFS.Stat("/var/run/reboot-required"); err == nil {
+			reasons = append(reasons, strings.Fields(readTrimmed("/var/run/reboot-required.pkgs"))...)
+			if len(reasons) == 0 {
+				reasons = append(reasons, "/var/run/reboot-required")
+			}
+			return true, reasons
+		}
+		// Red Hat family: exits with 1 when core libraries or the kernel changed
+		if _, err := commands.LookPath("needs-restarting"); err == nil {
+			var exitErr *exec.ExitError
+			if err := commands.Run("needs-restarting", "-r"); errors.As(err, &exitErr) && exitErr.ExitCode() == 1 {
+				return true, append(reasons, "needs-restarting")
+			}
+		}
+	case "windows":
+		output, err := commands.Output("powershell", "-NoProfile", "-Command", windowsRebootScript)
+		if err == nil {
+			for _, line := range strings.Split(string(output), "\n") {
+				if line = strings.TrimSpace(line); line != "" {
+					reasons = append(reasons, line)
+				}
+			}
+		}
+	}
+	return len(reasons) > 0, reasons
+}
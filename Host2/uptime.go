@@ -0,0 +1,247 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"math"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/shirou/gopsutil/v3/host"
+)
+
+// Default uptime state file, next to the executable
+const UPTIME_FILE = "agent_uptime.json"
+
+const (
+	REBOOT_HISTORY       = 500         // reboots kept in the state file
+	UPTIME_SAVE_INTERVAL = time.Minute // how stale the persisted last sample may get
+)
+
+// RebootEvent is one observed reboot. The downtime runs from the last
+// sample of the previous boot, so it includes any time the agent itself
+// was stopped before the reboot.
+type RebootEvent struct {
+	ShutdownAt      string `json:"shutdown_at"`
+	BootAt          string `json:"boot_at"`
+	DowntimeSeconds int64  `json:"downtime_seconds"`
+	UptimeSeconds   int64  `json:"uptime_seconds"` // of the boot that ended
+}
+
+// AvailabilityWindow is the share of one uptime.windows_days window the
+// host was up.
+type AvailabilityWindow struct {
+	Window          string  `json:"window"` // e.g. "7d"
+	Percent         float64 `json:"percent"`
+	DowntimeSeconds int64   `json:"downtime_seconds"`
+	Reboots         int     `json:"reboots"`
+	CoveredSeconds  int64   `json:"covered_seconds"` // shorter than the window until the agent has tracked the host that long
+}
+
+type UptimeInfo struct {
+	BootTime      string               `json:"boot_time,omitempty"`
+	UptimeSeconds int64                `json:"uptime_seconds"` // current on every collection, unlike system.uptime_seconds
+	Boot          BootPerformance      `json:"boot"`
+	TrackingSince string               `json:"tracking_since,omitempty"`
+	Availability  []AvailabilityWindow `json:"availability"`
+}
+
+// uptimeRecord is persisted in uptime.state_file so reboots are counted
+// even though the agent restarts with the host.
+type uptimeRecord struct {
+	TrackingSince time.Time      `json:"tracking_since"` // first boot the agent saw
+	BootTime      time.Time      `json:"boot_time"`
+	LastSeen      time.Time      `json:"last_seen"`
+	Reboots       []rebootRecord `json:"reboots"` // oldest first
+}
+
+type rebootRecord struct {
+	PreviousBoot time.Time `json:"previous_boot"`
+	Shutdown     time.Time `json:"shutdown"` // last sample of the previous boot
+	Boot         time.Time `json:"boot"`
+}
+
+var uptimeState = struct {
+	sync.Mutex
+	path   string
+	record *uptimeRecord
+	saved  time.Time
+}{}
+
+func uptimeStatePath() string {
+	if path := currentConfig().Uptime.StateFile; path != "" {
+		return path
+	}
+	exePath, err := os.Executable()
+	if err != nil {
+		return UPTIME_FILE
+	}
+	return filepath.Join(filepath.Dir(exePath), UPTIME_FILE)
+}
+
+// collectUptime records the current boot and reports availability over
+// each configured window. A reboot is a boot time later than the last
+// sample of the previous boot; smaller changes are the kernel's boot time
+// following clock adjustments. The state file is only written when save
+// is set.
+func collectUptime(now time.Time, save bool) UptimeInfo {
+	bootSeconds, err := host.BootTime()
+	if err != nil {
+		log.Printf("[UPTIME] Failed to read the boot time: %v", err)
+		return UptimeInfo{Boot: BootPerformance{Status: "unavailable"}, Availability: []AvailabilityWindow{}}
+	}
+	boot := time.Unix(int64(bootSeconds), 0).UTC()
+	now = now.UTC().Truncate(time.Second)
+	perf := bootPerformance(boot, now)
+
+	path := uptimeStatePath()
+	uptimeState.Lock()
+	defer uptimeState.Unlock()
+	if uptimeState.record == nil || uptimeState.path != path {
+		uptimeState.path = path
+		uptimeState.record = loadUptimeRecord(path)
+		uptimeState.saved = time.Time{}
+	}
+	record := uptimeState.record
+
+	changed := false
+	switch {
+	case record.LastSeen.IsZero():
+		record.TrackingSince = boot
+		changed = true
+	case boot.After(record.LastSeen):
+		record.Reboots = append(record.Reboots, rebootRecord{PreviousBoot: record.BootTime, Shutdown: record.LastSeen, Boot: boot})
+		if len(record.Reboots) > REBOOT_HISTORY {
+			record.Reboots = append([]rebootRecord{}, record.Reboots[len(record.Reboots)-REBOOT_HISTORY:]...)
+		}
+		log.Printf("[UPTIME] Host rebooted at %s, last seen up at %s", boot.Format("2006-01-02T15:04:05Z"), record.LastSeen.Format("2006-01-02T15:04:05Z"))
+		changed = true
+	}
+	record.BootTime = boot
+	if now.After(record.LastSeen) {
+		record.LastSeen = now
+	}
+
+	if save && !readOnlyMode && (changed || now.Sub(uptimeState.saved) >= UPTIME_SAVE_INTERVAL) {
+		if err := saveUptimeRecord(path, record); err != nil {
+			log.Printf("[UPTIME] Failed to save %s: %v", path, err)
+		} else {
+			uptimeState.saved = now
+		}
+	}
+	info := uptimeSummary(record, now)
+	info.Boot = perf
+	return info
+}
+
+func loadUptimeRecord(path string) *uptimeRecord {
+	record := &uptimeRecord{}
+	data, err := hostFS.ReadFile(path)
+	if err == nil {
+		if err := json.Unmarshal(data, record); err != nil {
+			log.Printf("[UPTIME] Ignoring unreadable %s: %v", path, err)
+			record = &uptimeRecord{}
+		}
+	} else if !os.IsNotExist(err) {
+		log.Printf("[UPTIME] Failed to read %s: %v", path, err)
+	}
+	return record
+}
+
+// saveUptimeRecord replaces the state file through a rename, so a crash
+// mid-write cannot lose the recorded reboots.
+func saveUptimeRecord(path string, record *uptimeRecord) error {
+	data, err := json.MarshalIndent(record, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, append(data, '\n'), 0644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return nil
+}
+
+// uptimeSummary computes availability over every uptime.windows_days
+// window ending at now. Only the time since tracking_since is covered.
+func uptimeSummary(record *uptimeRecord, now time.Time) UptimeInfo {
+	info := UptimeInfo{
+		BootTime:      record.BootTime.Format("2006-01-02T15:04:05Z"),
+		UptimeSeconds: int64(now.Sub(record.BootTime).Seconds()),
+		TrackingSince: record.TrackingSince.Format("2006-01-02T15:04:05Z"),
+		Availability:  []AvailabilityWindow{},
+	}
+	for _, days := range currentConfig().Uptime.WindowsDays {
+		start := now.Add(-time.Duration(days) * 24 * time.Hour)
+		if start.Before(record.TrackingSince) {
+			start = record.TrackingSince
+		}
+		window := AvailabilityWindow{Window: strconv.Itoa(days) + "d", Percent: 100, CoveredSeconds: int64(now.Sub(start).Seconds())}
+		var downtime time.Duration
+		for _, reboot := range record.Reboots {
+			if !reboot.Boot.After(start) {
+				continue
+			}
+			window.Reboots++
+			from := reboot.Shutdown
+			if from.Before(start) {
+				from = start
+			}
+			downtime += reboot.Boot.Sub(from)
+		}
+		window.DowntimeSeconds = int64(downtime.Seconds())
+		if window.CoveredSeconds > 0 {
+			// Three decimals tell 99.9% from 99.99%
+			window.Percent = math.Round(100000*(1-downtime.Seconds()/now.Sub(start).Seconds())) / 1000
+		}
+		info.Availability = append(info.Availability, window)
+	}
+	return info
+}
+
+// uptimeHandler serves the current boot and how long it took,
+// availability per window and the recorded reboots, newest first.
+func uptimeHandler(w http.ResponseWriter, r *http.Request) {
+	uptimeState.Lock()
+	record := uptimeState.record
+	var info UptimeInfo
+	var reboots []RebootEvent
+	now := clock.Now().UTC()
+	if record != nil {
+		info = uptimeSummary(record, now)
+		reboots = make([]RebootEvent, 0, len(record.Reboots))
+		for i := len(record.Reboots) - 1; i >= 0; i-- {
+			reboot := record.Reboots[i]
+			reboots = append(reboots, RebootEvent{
+				ShutdownAt:      reboot.Shutdown.Format("2006-01-02T15:04:05Z"),
+				BootAt:          reboot.Boot.Format("2006-01-02T15:04:05Z"),
+				DowntimeSeconds: int64(reboot.Boot.Sub(reboot.Shutdown).Seconds()),
+				UptimeSeconds:   int64(reboot.Shutdown.Sub(reboot.PreviousBoot).Seconds()),
+			})
+		}
+	}
+	uptimeState.Unlock()
+	if record == nil {
+		w.Header().Set("Retry-After", "30")
+		http.Error(w, "Uptime not collected yet", http.StatusServiceUnavailable)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"boot_time":      info.BootTime,
+		"uptime_seconds": info.UptimeSeconds,
+		"boot":           latestBootPerformance(),
+		"tracking_since": info.TrackingSince,
+		"availability":   info.Availability,
+		"reboots":        reboots,
+		"timestamp":      now.Format("2006-01-02T15:04:05Z"),
+	})
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"math"
+	"os/user"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/shirou/gopsutil/v3/process"
+)
+
+// UserUsage is the summed usage of every process one user runs.
+type UserUsage struct {
+	User          string  `json:"user"`
+	Processes     int     `json:"processes"`
+	CPUPercent    float64 `json:"cpu_percent"`    // of one core, as in top, averaged since the previous sample
+	MemoryMB      float64 `json:"memory_mb"`      // resident; shared pages count once per process
+	MemoryPercent float64 `json:"memory_percent"` // of physical memory
+}
+
+type UsersInfo struct {
+	Top    []UserUsage `json:"top"`   // busiest first, users.top of them
+	Users  int         `json:"users"` // distinct users running processes
+	Status string      `json:"status"`
+}
+
+// Per-process CPU time at the previous sample, keyed by PID and checked
+// against the creation time so a reused PID is not mistaken for the old
+// process
+var userUsageState = struct {
+	sync.Mutex
+	cpu     map[int32]processCPU
+	sampled time.Time
+	names   map[string]string // uid -> user name
+}{names: map[string]string{}}
+
+type processCPU struct {
+	created int64
+	seconds float64
+}
+
+// collectUsersInfo sums CPU and memory by process owner. CPU is the CPU
+// time used between this sample and the previous one, so the first sample
+// reports memory only; processes that start and exit between samples are
+// not seen.
+func collectUsersInfo(now time.Time, totalMB uint64, trace *sectionTrace) UsersInfo {
+	info := UsersInfo{Top: []UserUsage{}, Status: "unavailable"}
+	procs, err := process.Processes()
+	if err != nil {
+		trace.fail("gopsutil", err)
+		return info
+	}
+
+	userUsageState.Lock()
+	defer userUsageState.Unlock()
+	previous, since := userUsageState.cpu, userUsageState.sampled
+	elapsed := now.Sub(since).Seconds()
+	current := make(map[int32]processCPU, len(procs))
+
+	byUser := make(map[string]*UserUsage)
+	for _, p := range procs {
+		name := processOwner(p)
+		if name == "" {
+			continue
+		}
+		usage, ok := byUser[name]
+		if !ok {
+			usage = &UserUsage{User: name}
+			byUser[name] = usage
+		}
+		usage.Processes++
+		if mem, err := p.MemoryInfo(); err == nil {
+			usage.MemoryMB += float64(mem.RSS) / 1024 / 1024
+		}
+
+		times, err := p.Times()
+		if err != nil {
+			continue
+		}
+		created, _ := p.CreateTime()
+		sample := processCPU{created: created, seconds: times.User + times.System}
+		current[p.Pid] = sample
+		if previous == nil || elapsed <= 0 {
+			continue
+		}
+		if before, ok := previous[p.Pid]; ok && before.created == created {
+			usage.CPUPercent += math.Max(sample.seconds-before.seconds, 0) / elapsed * 100
+		} else if created >= since.UnixMilli() {
+			// Started since the previous sample: all of its CPU time is new
+			usage.CPUPercent += sample.seconds / elapsed * 100
+		}
+	}
+	userUsageState.cpu, userUsageState.sampled = current, now
+
+	for _, usage := range byUser {
+		usage.CPUPercent = math.Round(usage.CPUPercent*10) / 10
+		if totalMB > 0 {
+			usage.MemoryPercent = math.Round(usage.MemoryMB/float64(totalMB)*1000) / 10
+		}
+		usage.MemoryMB = math.Round(usage.MemoryMB*10) / 10
+		info.Top = append(info.Top, *usage)
+	}
+	sort.Slice(info.Top, func(i, j int) bool {
+		if a, b := info.Top[i].CPUPercent, info.Top[j].CPUPercent; a != b {
+			return a > b
+		}
+		return info.Top[i].MemoryMB > info.Top[j].MemoryMB
+	})
+	info.Users = len(info.Top)
+	if top := currentConfig().Users.Top; len(info.Top) > top {
+		info.Top = info.Top[:top]
+	}
+	trace.ok("gopsutil")
+	info.Status = "ok"
+	return info
+}
+
+// processOwner returns the user name of the process's real user. On Unix
+// the uid is resolved once and cached, as every lookup reads the user
+// database; Windows reports DOMAIN\user from the process token. Callers
+// hold userUsageState.
+func processOwner(p *process.Process) string {
+	if collectorOS == "windows" {
+		name, _ := p.Username()
+		return name
+	}
+	uids, err := p.Uids()
+	if err != nil || len(uids) == 0 {
+		return ""
+	}
+	uid := strconv.Itoa(int(uids[0]))
+	name, ok := userUsageState.names[uid]
+	if !ok {
+		name = uid
+		if u, err := user.LookupId(uid); err == nil {
+			name = u.Username
+		}
+		userUsageState.names[uid] = name
+	}
+	return name
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/shirou/gopsutil/v3/host"
+)
+
+// VirtualizationInfo tells what the agent runs on. Type is the outermost
+// layer that matters for interpreting metrics: "wsl", "container", "vm",
+// "bare_metal" or "unknown".
+type VirtualizationInfo struct {
+	Type       string `json:"type"`
+	Hypervisor string `json:"hypervisor,omitempty"` // e.g. "kvm", "vmware", "hyperv"
+	Container  string `json:"container,omitempty"`  // e.g. "docker", "podman", "lxc"
+	Method     string `json:"method"`               // how it was detected
+}
+
+var (
+	virtOnce sync.Once
+	virtInfo VirtualizationInfo
+)
+
+// virtualization detects the environment once; it cannot change while the
+// agent runs.
+func virtualization() VirtualizationInfo {
+	virtOnce.Do(func() {
+		virtInfo = detectVirtualization()
+		switch {
+		case virtInfo.Container != "" && virtInfo.Type != "wsl":
+			virtInfo.Type = "container"
+		case virtInfo.Hypervisor != "" && virtInfo.Type == "":
+			virtInfo.Type = "vm"
+		case virtInfo.Type == "" && virtInfo.Method != "":
+			virtInfo.Type = "bare_metal"
+		case virtInfo.Type == "":
+			virtInfo.Type = "unknown"
+		}
+	})
+	return virtInfo
+}
+
+// detectVirtualization uses the platform's own sources on Linux and
+// Windows; elsewhere it relies on gopsutil, which knows a few hypervisors
+// on macOS and the BSDs.
+func detectVirtualization() VirtualizationInfo {
+	switch collectorOS {
+	case "linux":
+		return linuxVirtualization()
+	case "windows":
+		return windowsVirtualization()
+	}
+	system, role, err := host.Virtualization()
+	if err != nil {
+		return VirtualizationInfo{}
+	}
+	info := VirtualizationInfo{Method: "gopsutil"}
+	if role == "guest" {
+		switch system {
+		case "jail", "docker", "lxc":
+			info.Container = system
+		default:
+			info.Hypervisor = system
+		}
+	}
+	return info
+}
+
+// linuxVirtualization prefers systemd-detect-virt and falls back to
+// container marker files, DMI strings and the CPUID hypervisor flag.
+func linuxVirtualization() VirtualizationInfo {
+	var info VirtualizationInfo
+	if release, err := hostFS.ReadFile("/proc/sys/kernel/osrelease"); err == nil {
+		if r := strings.ToLower(string(release)); strings.Contains(r, "microsoft") || strings.Contains(r, "wsl") {
+			info.Type = "wsl"
+			info.Hypervisor = "microsoft"
+		}
+	}
+
+	if _, err := commands.LookPath("systemd-detect-virt"); err == nil {
+		info.Method = "systemd-detect-virt"
+		if info.Container == "" {
+			info.Container = detectVirtOutput("--container")
+		}
+		if info.Hypervisor == "" {
+			info.Hypervisor = detectVirtOutput("--vm")
+		}
+		if info.Container == "wsl" {
+			info.Container = ""
+		}
+		return info
+	}
+
+	info.Method = "sysfs"
+	switch {
+	case fileExists("/.dockerenv"):
+		info.Container = "docker"
+	case fileExists("/run/.containerenv"):
+		info.Container = "podman"
+	default:
+		if cgroup, err := hostFS.ReadFile("/proc/1/cgroup"); err == nil {
+			c := string(cgroup)
+			switch {
+			case strings.Contains(c, "kubepods"):
+				info.Container = "kubernetes"
+			case strings.Contains(c, "docker"):
+				info.Container = "docker"
+			case strings.Contains(c, "lxc"):
+				info.Container = "lxc"
+			}
+		}
+	}
+
+	if info.Hypervisor == "" {
+		vendor, _ := hostFS.ReadFile("/sys/class/dmi/id/sys_vendor")
+		product, _ := hostFS.ReadFile("/sys/class/dmi/id/product_name")
+		info.Hypervisor = hypervisorFromDMI(string(vendor), string(product))
+	}
+	if info.Hypervisor == "" {
+		// CPUID leaf 1 ECX bit 31, as exposed by the kernel
+		if cpuinfo, err := hostFS.ReadFile("/proc/cpuinfo"); err == nil && strings.Contains(string(cpuinfo), " hypervisor") {
+			info.Hypervisor = "unknown"
+		}
+	}
+	return info
+}
+
+// detectVirtOutput runs systemd-detect-virt with a flag; "none" and errors
+// (it exits 1 when nothing is detected) both mean not virtualized.
+func detectVirtOutput(flag string) string {
+	out, _ := commands.Output("systemd-detect-virt", flag)
+	if v := strings.TrimSpace(string(out)); v != "none" {
+		return v
+	}
+	return ""
+}
+
+func fileExists(path string) bool {
+	_, err := hostFS.Stat(path)
+	return err == nil
+}
+
+// windowsVirtualization reads the SMBIOS manufacturer and model through
+// WMI. Windows containers report the container user.
+func windowsVirtualization() VirtualizationInfo {
+	info := VirtualizationInfo{Method: "wmi"}
+	out, err := commands.Output("wmic", "computersystem", "get", "Manufacturer,Model", "/format:list")
+	if err != nil {
+		info.Method = ""
+		return info
+	}
+
+	var vendor, model string
+	for _, line := range strings.Split(string(out), "\n") {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "Manufacturer=") {
+			vendor = strings.TrimPrefix(line, "Manufacturer=")
+		} else if strings.HasPrefix(line, "Model=") {
+			model = strings.TrimPrefix(line, "Model=")
+		}
+	}
+	info.Hypervisor = hypervisorFromDMI(vendor, model)
+
+	if user, _ := commands.Output("whoami"); strings.Contains(strings.ToLower(string(user)), "containeradministrator") ||
+		strings.Contains(strings.ToLower(string(user)), "containeruser") {
+		info.Container = "windows"
+	}
+	return info
+}
+
+// sensorsApplicable reports whether a hardware sensor collector is worth
+// running. Guests rarely expose real sensors, so in VMs, containers and
+// WSL it only runs when enabled explicitly in the collectors map.
+func sensorsApplicable(collector string) bool {
+	if enabled, explicit := currentConfig().Collectors[collector]; explicit {
+		return enabled
+	}
+	switch virtualization().Type {
+	case "vm", "container", "wsl":
+		return false
+	}
+	return true
+}
+
+// hypervisorFromDMI maps SMBIOS vendor and product strings to a
+// hypervisor name, or "" for physical hardware.
+func hypervisorFromDMI(vendor, product string) string {
+	v := strings.ToLower(vendor + " " + product)
+	switch {
+	case strings.Contains(v, "vmware"):
+		return "vmware"
+	case strings.Contains(v, "virtualbox") || strings.Contains(v, "innotek"):
+		return "oracle"
+	case strings.Contains(v, "qemu"):
+		return "qemu"
+	case strings.Contains(v, "kvm"):
+		return "kvm"
+	case strings.Contains(v, "xen"):
+		return "xen"
+	case strings.Contains(v, "parallels"):
+		return "parallels"
+	case strings.Contains(v, "bochs"):
+		return "bochs"
+	case strings.Contains(v, "microsoft") && strings.Contains(v, "virtual"):
+		return "microsoft"
+	case strings.Contains(v, "amazon ec2"):
+		return "amazon"
+	case strings.Contains(v, "google compute engine"):
+		return "google"
+	}
+	return ""
+}
@@ -0,0 +1,88 @@
+package main
+
+import "testing"
+
+func TestDetectVirtualization(t *testing.T) {
+	tests := []struct {
+		name    string
+		goos    string
+		files   map[string]string
+		outputs map[string]string
+		want    VirtualizationInfo
+	}{
+		{
+			name: "systemd-detect-virt in a container",
+			goos: "linux",
+			outputs: map[string]string{
+				"systemd-detect-virt --container": "docker\n",
+				"systemd-detect-virt --vm":        "none\n",
+			},
+			want: VirtualizationInfo{Container: "docker", Method: "systemd-detect-virt"},
+		},
+		{
+			name:    "WSL reported by the kernel release",
+			goos:    "linux",
+			files:   map[string]string{"/proc/sys/kernel/osrelease": "5.15.153.1-microsoft-standard-WSL2\n"},
+			outputs: map[string]string{"systemd-detect-virt --container": "wsl\n"},
+			want:    VirtualizationInfo{Type: "wsl", Hypervisor: "microsoft", Method: "systemd-detect-virt"},
+		},
+		{
+			name: "kubernetes pod on a KVM guest",
+			goos: "linux",
+			files: map[string]string{
+				"/proc/1/cgroup":                 "0::/kubepods/besteffort/pod1234\n",
+				"/sys/class/dmi/id/sys_vendor":   "QEMU\n",
+				"/sys/class/dmi/id/product_name": "Standard PC (Q35 + ICH9, 2009)\n",
+				"/proc/sys/kernel/osrelease":     "6.1.0-13-amd64\n",
+			},
+			want: VirtualizationInfo{Hypervisor: "qemu", Container: "kubernetes", Method: "sysfs"},
+		},
+		{
+			name: "podman marker and the CPUID hypervisor flag",
+			goos: "linux",
+			files: map[string]string{
+				"/run/.containerenv": "",
+				"/proc/cpuinfo":      "flags\t\t: fpu vme sse2 hypervisor lahf_lm\n",
+			},
+			want: VirtualizationInfo{Hypervisor: "unknown", Container: "podman", Method: "sysfs"},
+		},
+		{
+			name:  "bare metal",
+			goos:  "linux",
+			files: map[string]string{"/sys/class/dmi/id/sys_vendor": "Dell Inc.\n", "/proc/cpuinfo": "flags\t\t: fpu vme\n"},
+			want:  VirtualizationInfo{Method: "sysfs"},
+		},
+		{
+			name: "Hyper-V guest",
+			goos: "windows",
+			outputs: map[string]string{
+				"wmic computersystem get Manufacturer,Model /format:list": "\r\r\nManufacturer=Microsoft Corporation\r\r\nModel=Virtual Machine\r\r\n",
+				"whoami": "desktop-1\\admin\r\n",
+			},
+			want: VirtualizationInfo{Hypervisor: "microsoft", Method: "wmi"},
+		},
+		{
+			name: "Windows container on VMware",
+			goos: "windows",
+			outputs: map[string]string{
+				"wmic computersystem get Manufacturer,Model /format:list": "Manufacturer=VMware, Inc.\r\nModel=VMware7,1\r\n",
+				"whoami": "user manager\\containeradministrator\r\n",
+			},
+			want: VirtualizationInfo{Hypervisor: "vmware", Container: "windows", Method: "wmi"},
+		},
+		{
+			name: "WMI unavailable",
+			goos: "windows",
+			want: VirtualizationInfo{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			withHost(t, &fakeRunner{outputs: tt.outputs}, newFakeFS(tt.files), nil)
+			withOS(t, tt.goos)
+			if got := detectVirtualization(); got != tt.want {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
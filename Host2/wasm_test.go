@@ -0,0 +1,159 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Helpers to assemble modules in the binary format
+
+const wasmI32 = 0x7f
+
+func wasmLEB(v int) []byte {
+	var out []byte
+	for {
+		b := byte(v & 0x7f)
+		if v >>= 7; v == 0 {
+			return append(out, b)
+		}
+		out = append(out, b|0x80)
+	}
+}
+
+func wasmVec(items ...[]byte) []byte {
+	out := wasmLEB(len(items))
+	for _, item := range items {
+		out = append(out, item...)
+	}
+	return out
+}
+
+func wasmSection(id byte, items ...[]byte) []byte {
+	body := wasmVec(items...)
+	return append(append([]byte{id}, wasmLEB(len(body))...), body...)
+}
+
+func wasmString(s string) []byte { return append(wasmLEB(len(s)), s...) }
+
+func wasmAssemble(sections ...[]byte) []byte {
+	out := []byte("\x00asm\x01\x00\x00\x00")
+	for _, section := range sections {
+		out = append(out, section...)
+	}
+	return out
+}
+
+// wasiModule is a WASI command whose _start runs code, with one function
+// imported from WASI as function 0, of type sig, and one page of memory
+// starting with data.
+func wasiModule(imported string, sig []byte, data []byte, code ...byte) []byte {
+	body := append([]byte{0}, code...)
+	return wasmAssemble(
+		wasmSection(1, sig, []byte{0x60, 0, 0}),
+		wasmSection(2, append(append(wasmString("wasi_snapshot_preview1"), wasmString(imported)...), 0, 0)),
+		wasmSection(3, []byte{1}),
+		wasmSection(5, []byte{0, 1}),
+		wasmSection(7, append(wasmString("_start"), 0, 1)),
+		wasmSection(10, append(wasmLEB(len(body)), body...)),
+		wasmSection(11, append([]byte{0, 0x41, 0, 0x0b}, wasmString(string(data))...)),
+	)
+}
+
+var (
+	fdWriteType  = []byte{0x60, 4, wasmI32, wasmI32, wasmI32, wasmI32, 1, wasmI32}
+	procExitType = []byte{0x60, 1, wasmI32, 0}
+)
+
+// loadTestModule compiles data as the plugin name in a runtime with pages
+// of memory.
+func loadTestModule(t *testing.T, pages uint32, name string, data []byte) (*wasmRuntime, error) {
+	t.Helper()
+	engine, err := newWasmRuntime(pages)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(engine.close)
+	path := filepath.Join(t.TempDir(), name+".wasm")
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	_, err = engine.load(path)
+	return engine, err
+}
+
+func runTestPlugin(t *testing.T, cfg WasmPluginsConfig, name string, data []byte) ExecResult {
+	t.Helper()
+	engine, err := loadTestModule(t, 16, name, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, cached := range engine.modules {
+		return runWasmPlugin(engine, name, cached.module, cfg)
+	}
+	return ExecResult{}
+}
+
+func TestRunWasmPlugin(t *testing.T) {
+	cfg := WasmPluginsConfig{TimeoutMs: 1000}
+	output := "load=2\nqueue=jobs\n"
+	// An iovec for the text at 16, written to stdout
+	data := append([]byte{16, 0, 0, 0, byte(len(output)), 0, 0, 0}, make([]byte, 8)...)
+	result := runTestPlugin(t, cfg, "queue", wasiModule("fd_write", fdWriteType, append(data, output...),
+		0x41, 1, 0x41, 0, 0x41, 1, 0x41, 8, 0x10, 0, 0x1a, 0x0b))
+	if result.Status != "ok" || result.Data["load"] != 2.0 || result.Data["queue"] != "jobs" {
+		t.Errorf("result %+v", result)
+	}
+
+	result = runTestPlugin(t, cfg, "fail", wasiModule("proc_exit", procExitType, nil, 0x41, 3, 0x10, 0, 0x0b))
+	if result.Status != "error" || result.Error != "exit status 3" {
+		t.Errorf("proc_exit(3): %+v", result)
+	}
+
+	// loop br 0 end
+	cfg.TimeoutMs = 50
+	result = runTestPlugin(t, cfg, "spin", wasiModule("fd_write", fdWriteType, nil, 0x03, 0x40, 0x0c, 0, 0x0b, 0x0b))
+	if result.Status != "timeout" {
+		t.Errorf("endless loop: %+v", result)
+	}
+}
+
+func TestWasmPluginChecks(t *testing.T) {
+	tests := []struct {
+		name  string
+		pages uint32
+		data  []byte
+		want  string
+	}{
+		{"not wasm", 16, []byte("#!/bin/sh\n"), "invalid magic number"},
+		{"reactor", 16, wasmAssemble(
+			wasmSection(1, []byte{0x60, 0, 0}),
+			wasmSection(3, []byte{0}),
+			wasmSection(7, append(wasmString("run"), 0, 0)),
+			wasmSection(10, []byte{2, 0, 0x0b}),
+		), "no exported _start"},
+		{"socket", 16, wasmAssemble(
+			wasmSection(1, []byte{0x60, 0, 0}),
+			wasmSection(2, append(append(wasmString("env"), wasmString("socket")...), 0, 0)),
+			wasmSection(3, []byte{0}),
+			wasmSection(7, append(wasmString("_start"), 0, 1)),
+			wasmSection(10, []byte{2, 0, 0x0b}),
+		), "unknown import env.socket"},
+		{"too big", 1, wasmAssemble(wasmSection(5, []byte{0, 2})), "memory"},
+	}
+	for _, tt := range tests {
+		if _, err := loadTestModule(t, tt.pages, tt.name, tt.data); err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: error %v, want %q", tt.name, err, tt.want)
+		}
+	}
+}
+
+func TestWasmMemoryPages(t *testing.T) {
+	tests := map[int]uint32{1: 16, 64: 1024, 4095: 65520, 4096: WASM_MAX_PAGES, 8192: WASM_MAX_PAGES}
+	for mb, want := range tests {
+		if got := wasmMemoryPages(mb); got != want {
+			t.Errorf("wasmMemoryPages(%d) = %d, want %d", mb, got, want)
+		}
+	}
+}
@@ -0,0 +1,323 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tetratelabs/wazero"
+	"github.com/tetratelabs/wazero/api"
+	"github.com/tetratelabs/wazero/imports/wasi_snapshot_preview1"
+	"github.com/tetratelabs/wazero/sys"
+)
+
+const (
+	WASM_PAGE_SIZE = 65536
+	// 4 GiB, all a 32-bit module can address
+	WASM_MAX_PAGES = 65536
+)
+
+var (
+	wasmMu     sync.RWMutex
+	latestWasm = map[string]ExecResult{}
+
+	// The runtime plugins run in; only used by startWasmPlugins
+	wasmEngine *wasmRuntime
+)
+
+// wasmRuntime is a wazero runtime with WASI, and the modules compiled in
+// it by path, reused until the file changes. Memory limits are set per
+// runtime, so a new max_memory_mb needs a new one.
+type wasmRuntime struct {
+	runtime wazero.Runtime
+	pages   uint32
+	wasi    map[string]api.FunctionDefinition // by name
+	modules map[string]wasmCachedModule
+}
+
+type wasmCachedModule struct {
+	modTime time.Time
+	size    int64
+	module  wazero.CompiledModule
+}
+
+// wasmMemoryPages converts max_memory_mb to 64 KiB pages, capped at the
+// 4 GiB a module can address.
+func wasmMemoryPages(mb int) uint32 {
+	pages := uint64(mb) << 20 / WASM_PAGE_SIZE
+	if pages > WASM_MAX_PAGES {
+		pages = WASM_MAX_PAGES
+	}
+	return uint32(pages)
+}
+
+// newWasmRuntime starts a runtime whose modules get at most pages of
+// memory and stop when their context is done.
+func newWasmRuntime(pages uint32) (*wasmRuntime, error) {
+	ctx := context.Background()
+	config := wazero.NewRuntimeConfig().WithMemoryLimitPages(pages).WithCloseOnContextDone(true)
+	r := wazero.NewRuntimeWithConfig(ctx, config)
+	wasi, err := wasi_snapshot_preview1.NewBuilder(r).Compile(ctx)
+	if err == nil {
+		_, err = r.InstantiateModule(ctx, wasi, wazero.NewModuleConfig())
+	}
+	if err != nil {
+		r.Close(ctx)
+		return nil, err
+	}
+	return &wasmRuntime{runtime: r, pages: pages, wasi: wasi.ExportedFunctions(), modules: map[string]wasmCachedModule{}}, nil
+}
+
+func (w *wasmRuntime) close() {
+	w.runtime.Close(context.Background())
+}
+
+// wasmPluginFiles lists the modules in dir by plugin name, the file name
+// without .wasm.
+func wasmPluginFiles(dir string) (map[string]string, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.wasm"))
+	if err != nil {
+		return nil, err
+	}
+	files := make(map[string]string, len(paths))
+	for _, path := range paths {
+		files[strings.TrimSuffix(filepath.Base(path), ".wasm")] = path
+	}
+	return files, nil
+}
+
+// load compiles the module at path and checks it is a WASI command, or
+// returns the cached one if the file has not changed.
+func (w *wasmRuntime) load(path string) (wazero.CompiledModule, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if cached, ok := w.modules[path]; ok && cached.modTime.Equal(info.ModTime()) && cached.size == info.Size() {
+		return cached.module, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	ctx := context.Background()
+	module, err := w.runtime.CompileModule(ctx, data)
+	if err != nil {
+		return nil, err
+	}
+	if err := w.check(module); err != nil {
+		module.Close(ctx)
+		return nil, err
+	}
+	if cached, ok := w.modules[path]; ok {
+		cached.module.Close(ctx)
+	}
+	w.modules[path] = wasmCachedModule{modTime: info.ModTime(), size: info.Size(), module: module}
+	return module, nil
+}
+
+// check rejects modules without a _start or importing anything but WASI
+// functions, which would only fail once run.
+func (w *wasmRuntime) check(module wazero.CompiledModule) error {
+	if _, ok := module.ExportedFunctions()["_start"]; !ok {
+		return fmt.Errorf("no exported _start; build it as a WASI command")
+	}
+	for _, fn := range module.ImportedFunctions() {
+		moduleName, name, _ := fn.Import()
+		if _, ok := w.wasi[name]; moduleName != wasi_snapshot_preview1.ModuleName || !ok {
+			return fmt.Errorf("unknown import %s.%s", moduleName, name)
+		}
+	}
+	return nil
+}
+
+// forget drops the compiled modules whose plugin file is gone.
+func (w *wasmRuntime) forget(files map[string]string) {
+	for path, cached := range w.modules {
+		if files[strings.TrimSuffix(filepath.Base(path), ".wasm")] != path {
+			cached.module.Close(context.Background())
+			delete(w.modules, path)
+		}
+	}
+}
+
+// runWasmPlugin runs a module's _start in a fresh instance and parses what
+// it printed, as runExecPlugin does for a command. A module that runs past
+// the timeout is interrupted, sleeping or not. It sees its name as argv[0],
+// stdout, stderr, the clocks and random numbers, but no environment,
+// filesystem or network.
+func runWasmPlugin(w *wasmRuntime, name string, module wazero.CompiledModule, cfg WasmPluginsConfig) ExecResult {
+	start := time.Now()
+	result := ExecResult{Data: map[string]interface{}{}, LastRun: start.UTC().Format("2006-01-02T15:04:05Z"), Status: "error"}
+
+	stdout := &limitedBuffer{limit: EXEC_MAX_OUTPUT}
+	stderr := &limitedBuffer{limit: 512}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(cfg.TimeoutMs)*time.Millisecond)
+	defer cancel()
+	config := wazero.NewModuleConfig().
+		WithName("").
+		WithArgs(name).
+		WithStdout(stdout).
+		WithStderr(stderr).
+		WithSysWalltime().
+		WithSysNanotime().
+		WithNanosleep(func(ns int64) {
+			timer := time.NewTimer(time.Duration(ns))
+			defer timer.Stop()
+			select {
+			case <-timer.C:
+			case <-ctx.Done():
+			}
+		}).
+		WithRandSource(rand.Reader)
+
+	instance, err := w.runtime.InstantiateModule(ctx, module, config)
+	if instance != nil {
+		instance.Close(context.Background())
+	}
+	var exit *sys.ExitError
+	if errors.As(err, &exit) {
+		switch {
+		case exit.ExitCode() == 0:
+			err = nil
+		case ctx.Err() == nil:
+			err = fmt.Errorf("exit status %d", exit.ExitCode())
+		}
+	}
+	result.DurationMs = float64(time.Since(start).Microseconds()) / 1000
+
+	switch {
+	case ctx.Err() != nil && err != nil:
+		result.Status = "timeout"
+		result.Error = fmt.Sprintf("interrupted after %d ms", cfg.TimeoutMs)
+		return result
+	case err != nil:
+		result.Error = err.Error()
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			result.Error += ": " + msg
+		}
+		return result
+	case stdout.truncated:
+		result.Error = fmt.Sprintf("output exceeds %d bytes", EXEC_MAX_OUTPUT)
+		return result
+	}
+
+	data, err := parseExecOutput(stdout.Bytes(), cfg.Format)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	result.Data = data
+	result.Status = "ok"
+	return result
+}
+
+// runWasmPlugins runs every module in the directory once, concurrently,
+// and replaces the stored results; plugins whose file is gone are dropped.
+func runWasmPlugins(w *wasmRuntime, cfg WasmPluginsConfig) map[string]ExecResult {
+	files, err := wasmPluginFiles(cfg.Dir)
+	if err != nil {
+		log.Printf("[WASM] %s: %v", cfg.Dir, err)
+	}
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	results := make(map[string]ExecResult, len(files))
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, name := range names {
+		module, err := w.load(files[name])
+		if err != nil {
+			log.Printf("[WASM] %s: %v", name, err)
+			results[name] = ExecResult{Data: map[string]interface{}{}, LastRun: time.Now().UTC().Format("2006-01-02T15:04:05Z"), Status: "error", Error: err.Error()}
+			continue
+		}
+		wg.Add(1)
+		go func(name string, module wazero.CompiledModule) {
+			defer wg.Done()
+			result := runWasmPlugin(w, name, module, cfg)
+			if result.Status != "ok" {
+				log.Printf("[WASM] %s: %s", name, result.Error)
+			}
+			mu.Lock()
+			results[name] = result
+			mu.Unlock()
+		}(name, module)
+	}
+	wg.Wait()
+	w.forget(files)
+	return results
+}
+
+// startWasmPlugins rescans the plugin directory and runs its modules every
+// interval until the process exits, following config reloads.
+func startWasmPlugins() {
+	for {
+		cfg := currentConfig().WasmPlugins
+		reloaded := configReloaded()
+		if wasmEngine != nil && (cfg.Dir == "" || wasmEngine.pages != wasmMemoryPages(cfg.MaxMemoryMB)) {
+			wasmEngine.close()
+			wasmEngine = nil
+		}
+		if cfg.Dir == "" {
+			wasmMu.Lock()
+			latestWasm = map[string]ExecResult{}
+			wasmMu.Unlock()
+			<-reloaded
+			continue
+		}
+		if wasmEngine == nil {
+			engine, err := newWasmRuntime(wasmMemoryPages(cfg.MaxMemoryMB))
+			if err != nil {
+				log.Printf("[WASM] Failed to start the runtime: %v", err)
+				<-reloaded
+				continue
+			}
+			wasmEngine = engine
+		}
+
+		log.Printf("[WASM] Running WebAssembly plugins from %s", cfg.Dir)
+		for running := true; running; {
+			results := runWasmPlugins(wasmEngine, cfg)
+			select {
+			case <-reloaded:
+				// Superseded while running
+				running = false
+				continue
+			default:
+			}
+			wasmMu.Lock()
+			latestWasm = results
+			wasmMu.Unlock()
+
+			select {
+			case <-time.After(time.Duration(cfg.IntervalSeconds) * time.Second):
+			case <-reloaded:
+				running = false
+			}
+		}
+	}
+}
+
+// latestWasmResults returns a copy of the WASM plugin results by plugin
+// name.
+func latestWasmResults() map[string]ExecResult {
+	wasmMu.RLock()
+	defer wasmMu.RUnlock()
+	results := make(map[string]ExecResult, len(latestWasm))
+	for name, result := range latestWasm {
+		results[name] = result
+	}
+	return results
+}
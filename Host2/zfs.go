@@ -0,0 +1,229 @@
+package main
+
+import (
+	"bufio"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ZFSInfo reports pool health and ARC efficiency.
+type ZFSInfo struct {
+	Pools  []ZFSPool `json:"pools"`
+	ARC    *ZFSARC   `json:"arc"`
+	Status string    `json:"status"`
+}
+
+type ZFSPool struct {
+	Name                 string  `json:"name"`
+	Health               string  `json:"health"` // ONLINE, DEGRADED, FAULTED, ...
+	SizeGB               float64 `json:"size_gb"`
+	AllocatedGB          float64 `json:"allocated_gb"`
+	FreeGB               float64 `json:"free_gb"`
+	CapacityPercent      float64 `json:"capacity_percent"`
+	FragmentationPercent float64 `json:"fragmentation_percent"`
+	Scan                 string  `json:"scan"`       // "none", "scrub" or "resilver"
+	ScanState            string  `json:"scan_state"` // "finished", "in_progress" or "canceled"
+	ScanProgressPercent  float64 `json:"scan_progress_percent"`
+	ScanEnd              string  `json:"scan_end"` // as printed by zpool, e.g. "Sun Oct 12 00:24:02 2025"
+	ReadErrors           uint64  `json:"read_errors"`
+	WriteErrors          uint64  `json:"write_errors"`
+	ChecksumErrors       uint64  `json:"checksum_errors"`
+	DataErrors           int     `json:"data_errors"`
+	Status               string  `json:"status"`
+}
+
+type ZFSARC struct {
+	SizeMB    float64 `json:"size_mb"`
+	MaxSizeMB float64 `json:"max_size_mb"`
+	Hits      uint64  `json:"hits"`
+	Misses    uint64  `json:"misses"`
+	// Over the interval since the previous sample, or since boot on the first
+	HitRatePercent float64 `json:"hit_rate_percent"`
+}
+
+var (
+	zfsMu         sync.Mutex
+	lastARCHits   uint64
+	lastARCMisses uint64
+
+	zfsProgressPattern   = regexp.MustCompile(`([\d.]+)% done`)
+	zfsDataErrorsPattern = regexp.MustCompile(`^errors: (\d+) data errors`)
+)
+
+// collectZFSInfo runs zpool for capacity and per-pool status, and reads the
+// ARC kstats. Hosts without zpool report "unavailable".
+func collectZFSInfo(trace *sectionTrace) ZFSInfo {
+	info := ZFSInfo{Pools: []ZFSPool{}, Status: "unavailable"}
+	if _, err := commands.LookPath("zpool"); err != nil {
+		trace.fail("zpool", err)
+		return info
+	}
+
+	out, err := commands.Output("zpool", "list", "-Hp", "-o", "name,size,alloc,free,cap,frag,health")
+	if err != nil {
+		trace.fail("zpool", err)
+		info.Status = "error"
+		return info
+	}
+	trace.ok("zpool")
+	for _, line := range strings.Split(strings.TrimSpace(string(out)), "\n") {
+		fields := strings.Split(line, "\t")
+		if len(fields) < 7 {
+			continue
+		}
+		pool := ZFSPool{
+			Name:                 fields[0],
+			SizeGB:               parseZFSNumber(fields[1]) / 1024 / 1024 / 1024,
+			AllocatedGB:          parseZFSNumber(fields[2]) / 1024 / 1024 / 1024,
+			FreeGB:               parseZFSNumber(fields[3]) / 1024 / 1024 / 1024,
+			CapacityPercent:      parseZFSNumber(fields[4]),
+			FragmentationPercent: parseZFSNumber(fields[5]),
+			Health:               fields[6],
+			Scan:                 "none",
+		}
+		if status, err := commands.Output("zpool", "status", "-p", pool.Name); err == nil {
+			parseZpoolStatus(string(status), &pool)
+		}
+		pool.Status = zfsPoolStatus(pool)
+		info.Pools = append(info.Pools, pool)
+	}
+
+	if stats, ok := readARCStats(); ok {
+		arc := &ZFSARC{
+			SizeMB:    float64(stats["size"]) / 1024 / 1024,
+			MaxSizeMB: float64(stats["c_max"]) / 1024 / 1024,
+			Hits:      stats["hits"],
+			Misses:    stats["misses"],
+		}
+		zfsMu.Lock()
+		hits, misses := arc.Hits, arc.Misses
+		if lastARCHits <= hits && lastARCMisses <= misses {
+			hits, misses = hits-lastARCHits, misses-lastARCMisses
+		}
+		lastARCHits, lastARCMisses = arc.Hits, arc.Misses
+		zfsMu.Unlock()
+		if hits+misses > 0 {
+			arc.HitRatePercent = float64(hits) / float64(hits+misses) * 100
+		}
+		info.ARC = arc
+	}
+
+	info.Status = "ok"
+	return info
+}
+
+// parseZFSNumber parses exact (-p) values; "-" means not applicable.
+func parseZFSNumber(s string) float64 {
+	v, _ := strconv.ParseFloat(strings.TrimSuffix(s, "%"), 64)
+	return v
+}
+
+// parseZpoolStatus fills in scan progress and error counters from the
+// text output of zpool status, which every OpenZFS version prints.
+func parseZpoolStatus(text string, pool *ZFSPool) {
+	inConfig := false
+	scanner := bufio.NewScanner(strings.NewReader(text))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case strings.HasPrefix(line, "scan:"):
+			scan := strings.TrimSpace(strings.TrimPrefix(line, "scan:"))
+			switch {
+			case strings.HasPrefix(scan, "scrub"):
+				pool.Scan = "scrub"
+			case strings.HasPrefix(scan, "resilver"):
+				pool.Scan = "resilver"
+			}
+			switch {
+			case strings.Contains(scan, "in progress"):
+				pool.ScanState = "in_progress"
+			case strings.Contains(scan, "canceled"):
+				pool.ScanState = "canceled"
+			case pool.Scan != "none":
+				pool.ScanState = "finished"
+			}
+			if i := strings.LastIndex(scan, " on "); i >= 0 && pool.ScanState != "in_progress" {
+				pool.ScanEnd = scan[i+4:]
+			}
+		case pool.ScanState == "in_progress" && zfsProgressPattern.MatchString(line):
+			pool.ScanProgressPercent, _ = strconv.ParseFloat(zfsProgressPattern.FindStringSubmatch(line)[1], 64)
+		case strings.HasPrefix(line, "config:"):
+			inConfig = true
+		case strings.HasPrefix(line, "errors:"):
+			inConfig = false
+			if m := zfsDataErrorsPattern.FindStringSubmatch(line); m != nil {
+				pool.DataErrors, _ = strconv.Atoi(m[1])
+			}
+		case inConfig:
+			// NAME STATE READ WRITE CKSUM rows for the pool and every vdev
+			fields := strings.Fields(line)
+			if len(fields) < 5 || fields[0] == "NAME" {
+				continue
+			}
+			read, err1 := strconv.ParseUint(fields[2], 10, 64)
+			write, err2 := strconv.ParseUint(fields[3], 10, 64)
+			cksum, err3 := strconv.ParseUint(fields[4], 10, 64)
+			if err1 == nil && err2 == nil && err3 == nil {
+				pool.ReadErrors += read
+				pool.WriteErrors += write
+				pool.ChecksumErrors += cksum
+			}
+		}
+	}
+}
+
+// zfsPoolStatus maps pool health and error counters to ok/warning/critical.
+func zfsPoolStatus(pool ZFSPool) string {
+	switch pool.Health {
+	case "ONLINE":
+		if pool.DataErrors > 0 || pool.ReadErrors+pool.WriteErrors+pool.ChecksumErrors > 0 {
+			return "warning"
+		}
+		return "ok"
+	case "DEGRADED":
+		return "warning"
+	}
+	return "critical"
+}
+
+// readARCStats reads the ARC counters from procfs on Linux, and from the
+// kstat sysctls exposed by FreeBSD and other OpenZFS ports elsewhere.
+func readARCStats() (map[string]uint64, bool) {
+	if collectorOS == "linux" {
+		return linuxARCStats()
+	}
+	stats := make(map[string]uint64)
+	for _, name := range []string{"size", "c_max", "hits", "misses"} {
+		out, err := commands.Output("sysctl", "-n", "kstat.zfs.misc.arcstats."+name)
+		if err != nil {
+			return nil, false
+		}
+		v, err := strconv.ParseUint(strings.TrimSpace(string(out)), 10, 64)
+		if err != nil {
+			return nil, false
+		}
+		stats[name] = v
+	}
+	return stats, true
+}
+
+// linuxARCStats parses /proc/spl/kstat/zfs/arcstats ("name type data").
+func linuxARCStats() (map[string]uint64, bool) {
+	data, err := hostFS.ReadFile("/proc/spl/kstat/zfs/arcstats")
+	if err != nil {
+		return nil, false
+	}
+	stats := make(map[string]uint64)
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 3 {
+			continue
+		}
+		if v, err := strconv.ParseUint(fields[2], 10, 64); err == nil {
+			stats[fields[0]] = v
+		}
+	}
+	return stats, len(stats) > 0
+}
@@ -0,0 +1,128 @@
+package main
+
+import "testing"
+
+func TestParseZpoolStatus(t *testing.T) {
+	tests := []struct {
+		name   string
+		text   string
+		health string
+		want   ZFSPool
+		status string
+	}{
+		{
+			name: "finished scrub, no errors",
+			text: `  pool: tank
+ state: ONLINE
+  scan: scrub repaired 0B in 00:24:02 with 0 errors on Sun Oct 12 00:24:02 2025
+config:
+
+	NAME        STATE     READ WRITE CKSUM
+	tank        ONLINE       0     0     0
+	  mirror-0  ONLINE       0     0     0
+	    sda     ONLINE       0     0     0
+	    sdb     ONLINE       0     0     0
+
+errors: No known data errors
+`,
+			health: "ONLINE",
+			want:   ZFSPool{Scan: "scrub", ScanState: "finished", ScanEnd: "Sun Oct 12 00:24:02 2025"},
+			status: "ok",
+		},
+		{
+			name: "resilver in progress on a degraded pool",
+			text: `  pool: tank
+ state: DEGRADED
+  scan: resilver in progress since Mon Oct 13 10:00:00 2025
+	1.20T scanned at 400M/s, 600G issued at 200M/s, 2.40T total
+	300G resilvered, 25.00% done, 02:30:00 to go
+config:
+
+	NAME        STATE     READ WRITE CKSUM
+	tank        DEGRADED     0     0     0
+	  mirror-0  DEGRADED     0     0     0
+	    sda     ONLINE       0     0     0
+	    sdb     FAULTED      3     1     0
+
+errors: No known data errors
+`,
+			health: "DEGRADED",
+			want:   ZFSPool{Scan: "resilver", ScanState: "in_progress", ScanProgressPercent: 25, ReadErrors: 3, WriteErrors: 1},
+			status: "warning",
+		},
+		{
+			name: "checksum and data errors",
+			text: `  pool: tank
+ state: ONLINE
+  scan: none requested
+config:
+
+	NAME        STATE     READ WRITE CKSUM
+	tank        ONLINE       0     0     2
+	  sda       ONLINE       0     0     2
+
+errors: 4 data errors, use '-v' for a list
+`,
+			health: "ONLINE",
+			want:   ZFSPool{Scan: "none", ChecksumErrors: 4, DataErrors: 4},
+			status: "warning",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pool := ZFSPool{Health: tt.health, Scan: "none"}
+			parseZpoolStatus(tt.text, &pool)
+			tt.want.Health = tt.health
+			if pool != tt.want {
+				t.Errorf("parsed %+v, want %+v", pool, tt.want)
+			}
+			if got := zfsPoolStatus(pool); got != tt.status {
+				t.Errorf("status %q, want %q", got, tt.status)
+			}
+		})
+	}
+}
+
+func TestCollectZFSInfo(t *testing.T) {
+	tests := []struct {
+		name    string
+		outputs map[string]string
+		status  string
+		pools   []string
+	}{
+		{
+			name:   "zpool not installed",
+			status: "unavailable",
+		},
+		{
+			name: "one faulted and one healthy pool",
+			outputs: map[string]string{
+				"zpool list -Hp -o name,size,alloc,free,cap,frag,health": "tank\t2199023255552\t1099511627776\t1099511627776\t50\t12\tONLINE\nold\t1073741824\t0\t1073741824\t0\t0\tFAULTED\n",
+				"zpool status -p tank": "  scan: none requested\nerrors: No known data errors\n",
+			},
+			status: "ok",
+			pools:  []string{"tank:ok", "old:critical"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			withHost(t, &fakeRunner{outputs: tt.outputs}, newFakeFS(nil), nil)
+			info := collectZFSInfo(nil)
+			if info.Status != tt.status {
+				t.Fatalf("status %q, want %q", info.Status, tt.status)
+			}
+			var pools []string
+			for _, pool := range info.Pools {
+				pools = append(pools, pool.Name+":"+pool.Status)
+			}
+			if len(pools) != len(tt.pools) {
+				t.Fatalf("pools %v, want %v", pools, tt.pools)
+			}
+			for i := range pools {
+				if pools[i] != tt.pools[i] {
+					t.Errorf("pools %v, want %v", pools, tt.pools)
+				}
+			}
+		})
+	}
+}